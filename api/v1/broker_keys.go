@@ -0,0 +1,68 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+)
+
+// MaxCallbackPublicKeys is how many callback public keys a Broker keeps
+// accepted: the current key and those it replaced, so callbacks signed
+// before a rotation still verify
+const MaxCallbackPublicKeys = 3
+
+// CallbackKeyID identifies a base64 encoded callback public key. Brokers send
+// it in the X-KIDP-Key-ID header so the manager can try the matching key first.
+func CallbackKeyID(publicKey string) string {
+	sum := sha256.Sum256([]byte(publicKey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// CallbackKeys returns the public keys callbacks from the broker may be
+// signed with, the current key first
+func (s *BrokerStatus) CallbackKeys() []string {
+	var keys []string
+	if s.CallbackPublicKey != "" {
+		keys = append(keys, s.CallbackPublicKey)
+	}
+	for _, key := range s.CallbackPublicKeys {
+		if key != "" && key != s.CallbackPublicKey {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RotateCallbackPublicKey makes publicKey the broker's current callback key,
+// keeping the keys it replaced accepted up to MaxCallbackPublicKeys. It
+// reports whether the status changed.
+func (s *BrokerStatus) RotateCallbackPublicKey(publicKey string) bool {
+	rotated := []string{publicKey}
+	for _, key := range s.CallbackKeys() {
+		if key != publicKey && len(rotated) < MaxCallbackPublicKeys {
+			rotated = append(rotated, key)
+		}
+	}
+	if s.CallbackPublicKey == publicKey && slices.Equal(s.CallbackPublicKeys, rotated) {
+		return false
+	}
+	s.CallbackPublicKey = publicKey
+	s.CallbackPublicKeys = rotated
+	return true
+}
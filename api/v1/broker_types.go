@@ -69,12 +69,37 @@ type BrokerCapability struct {
 	// Regions lists specific regions where this capability is available
 	// +optional
 	Regions []string `json:"regions,omitempty"`
+
+	// Priority overrides the broker's Priority when selecting a broker for
+	// this resource type
+	// +optional
+	Priority *int32 `json:"priority,omitempty"`
+
+	// ProviderPriorities overrides the priority for individual providers of
+	// this resource type (e.g., {"postgresql": 200, "mysql": 50})
+	// +optional
+	ProviderPriorities map[string]int32 `json:"providerPriorities,omitempty"`
 }
 
+// Broker authentication types the manager acts on
+const (
+	// BrokerAuthNone sends requests to the broker unsigned
+	BrokerAuthNone = "none"
+	// BrokerAuthEd25519 signs each request to the broker with the manager's
+	// Ed25519 key
+	BrokerAuthEd25519 = "ed25519"
+	// BrokerAuthMTLS presents the client certificate from the
+	// authentication Secret (tls.crt, tls.key and optionally ca.crt)
+	BrokerAuthMTLS = "mtls"
+	// BrokerAuthAPIKey sends the api-key from the authentication Secret as
+	// a bearer token
+	BrokerAuthAPIKey = "api-key"
+)
+
 // BrokerAuthentication defines how to authenticate with the broker
 type BrokerAuthentication struct {
-	// Type of authentication (jwt, mtls, api-key)
-	// +kubebuilder:validation:Enum=jwt;mtls;api-key;none
+	// Type of authentication (jwt, mtls, api-key, ed25519)
+	// +kubebuilder:validation:Enum=jwt;mtls;api-key;ed25519;none
 	// +kubebuilder:default=jwt
 	Type string `json:"type"`
 
@@ -99,7 +124,8 @@ type HealthCheckConfig struct {
 	// +kubebuilder:validation:Minimum=1
 	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
 
-	// FailureThreshold is consecutive failures before marking unhealthy
+	// FailureThreshold is consecutive failures before marking the broker
+	// Unhealthy. As many failures again mark it Offline.
 	// +kubebuilder:default=3
 	// +kubebuilder:validation:Minimum=1
 	FailureThreshold int32 `json:"failureThreshold,omitempty"`
@@ -108,13 +134,19 @@ type HealthCheckConfig struct {
 // BrokerStatus defines the observed state of Broker
 type BrokerStatus struct {
 	// Phase represents the current state of the broker
-	// +kubebuilder:validation:Enum=Pending;Ready;Unhealthy;Offline;Unknown
+	// +kubebuilder:validation:Enum=Pending;Ready;Unhealthy;Offline;Unknown;Draining
 	Phase string `json:"phase,omitempty"`
 
 	// LastHeartbeat is the timestamp of the last successful health check
 	// +optional
 	LastHeartbeat *metav1.Time `json:"lastHeartbeat,omitempty"`
 
+	// ConsecutiveFailures counts the health checks failed since the last
+	// one that passed. The broker goes Unhealthy when it reaches the health
+	// check's failure threshold, and Offline at twice the threshold.
+	// +optional
+	ConsecutiveFailures int32 `json:"consecutiveFailures,omitempty"`
+
 	// ActiveDeployments is the current number of active deployments
 	// +optional
 	ActiveDeployments int32 `json:"activeDeployments,omitempty"`
@@ -139,6 +171,17 @@ type BrokerStatus struct {
 	// The manager records this when the broker registers its keypair.
 	// +optional
 	CallbackPublicKey string `json:"callbackPublicKey,omitempty"`
+
+	// CallbackPublicKeys are the public keys callbacks may be signed with: the
+	// current key first, then those it replaced during rotation. Callbacks
+	// verified by any of them are accepted.
+	// +optional
+	CallbackPublicKeys []string `json:"callbackPublicKeys,omitempty"`
+
+	// OrphanedDeployments are the database deployments in the broker's
+	// inventory that no Database records, as of the last inventory check
+	// +optional
+	OrphanedDeployments []string `json:"orphanedDeployments,omitempty"`
 }
 
 // +kubebuilder:object:root=true
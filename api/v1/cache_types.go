@@ -0,0 +1,149 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CacheSpec defines the desired state of Cache
+type CacheSpec struct {
+	// Owner reference to the owning Tenant, Team or Application
+	Owner OwnerReference `json:"owner"`
+
+	// Engine specifies the cache engine
+	// +kubebuilder:validation:Enum=redis;memcached
+	Engine string `json:"engine"`
+
+	// Version specifies the engine version
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Size specifies the instance size
+	// +kubebuilder:validation:Enum=small;medium;large;xlarge
+	Size string `json:"size"`
+
+	// MaxMemory caps the memory used for cached data (e.g. "512Mi", "2Gi").
+	// Defaults to the memory of the instance size.
+	// +kubebuilder:validation:Pattern=`^[0-9]+(Ki|Mi|Gi)$`
+	// +optional
+	MaxMemory string `json:"maxMemory,omitempty"`
+
+	// EvictionPolicy decides which keys are evicted once MaxMemory is reached.
+	// Only redis supports policies other than allkeys-lru.
+	// +kubebuilder:validation:Enum=noeviction;allkeys-lru;allkeys-lfu;allkeys-random;volatile-lru;volatile-lfu;volatile-random;volatile-ttl
+	// +optional
+	EvictionPolicy string `json:"evictionPolicy,omitempty"`
+
+	// HighAvailability enables a replicated, failover-capable deployment
+	// +optional
+	HighAvailability bool `json:"highAvailability,omitempty"`
+
+	// Region is the cloud region to deploy into (e.g., eastus, us-west-2)
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// TargetNamespace is the namespace the broker creates the workload in.
+	// Defaults to the Cache's own namespace when empty.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// Parameters for engine-specific configuration
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// CacheStatus defines the observed state of Cache
+type CacheStatus struct {
+	// Phase represents the current state
+	// +kubebuilder:validation:Enum=Pending;Provisioning;Ready;Failed;Deleting;Suspended
+	Phase string `json:"phase,omitempty"`
+
+	// Conditions represent the latest available observations
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Endpoint is the connection endpoint
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Port is the connection port
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// ConnectionSecretRef references the secret containing connection details
+	// +optional
+	ConnectionSecretRef *SecretReference `json:"connectionSecretRef,omitempty"`
+
+	// DeploymentID from the broker
+	// +optional
+	DeploymentID string `json:"deploymentId,omitempty"`
+
+	// BrokerRef references the Broker CR that handled this deployment
+	// +optional
+	BrokerRef *ObjectReference `json:"brokerRef,omitempty"`
+
+	// CallbackTokenHash is the SHA-256 of the per-deployment callback token
+	// issued to the broker; callbacks for this deployment must present it
+	// +optional
+	CallbackTokenHash string `json:"callbackTokenHash,omitempty"`
+
+	// CallbackTokenExpiry is when the callback token stops being accepted
+	// +optional
+	CallbackTokenExpiry *metav1.Time `json:"callbackTokenExpiry,omitempty"`
+
+	// LastReconcileTime is when the controller last reconciled this cache
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// LastError is the error from the most recent reconcile, empty if it succeeded
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Engine",type=string,JSONPath=`.spec.engine`
+// +kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.endpoint`
+// +kubebuilder:printcolumn:name="Error",type=string,JSONPath=`.status.lastError`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Cache is the Schema for the caches API
+type Cache struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CacheSpec   `json:"spec,omitempty"`
+	Status CacheStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CacheList contains a list of Cache
+type CacheList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Cache `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Cache{}, &CacheList{})
+}
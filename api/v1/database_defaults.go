@@ -0,0 +1,140 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+// Database tiers
+const (
+	TierDev     = "dev"
+	TierStaging = "staging"
+	TierProd    = "prod"
+)
+
+// tierDefaults are the settings each tier applies to fields left unset
+type tierDefaults struct {
+	backupRetention    string // empty leaves backups off
+	highAvailability   bool
+	deletionProtection bool
+}
+
+var tiers = map[string]tierDefaults{
+	TierDev:     {},
+	TierStaging: {backupRetention: "7d"},
+	TierProd:    {backupRetention: "30d", highAvailability: true, deletionProtection: true},
+}
+
+// DefaultSize is the size of a Database that doesn't set one
+const DefaultSize = "small"
+
+// DefaultBackupRetention is the retention of enabled backups that don't set
+// one
+const DefaultBackupRetention = "7d"
+
+// engineDefaults are the settings each engine applies to fields left unset
+type engineDefaults struct {
+	version string
+}
+
+var engines = map[string]engineDefaults{
+	"postgresql": {version: "15"},
+	"mysql":      {version: "8.0"},
+	"mongodb":    {version: "7.0"},
+	"redis":      {version: "7.2"},
+	"sqlserver":  {version: "2022"},
+}
+
+// Default fills in the backup, high availability and deletion protection
+// settings implied by the tier, the engine's default version, the default
+// size and the default backup retention. Only unset fields are defaulted, so
+// an explicit value, including an explicit false or disabled backup, wins.
+// The version and size are left to the DatabaseClass of a Database that
+// references one.
+func (s *DatabaseSpec) Default() {
+	if defaults, ok := tiers[s.Tier]; ok {
+		if s.Backup == nil && defaults.backupRetention != "" {
+			s.Backup = &BackupConfig{Enabled: true, Retention: defaults.backupRetention}
+		}
+		if s.HighAvailability == nil {
+			ha := defaults.highAvailability
+			s.HighAvailability = &ha
+		}
+		if s.DeletionProtection == nil {
+			protect := defaults.deletionProtection
+			s.DeletionProtection = &protect
+		}
+	}
+
+	if s.ClassRef == nil {
+		if s.Version == "" {
+			s.Version = engines[s.Engine].version
+		}
+		if s.Size == "" {
+			s.Size = DefaultSize
+		}
+	}
+	s.defaultBackupRetention()
+}
+
+// defaultBackupRetention sets the retention of enabled backups that don't
+// set one
+func (s *DatabaseSpec) defaultBackupRetention() {
+	if s.Backup != nil && s.Backup.Enabled && s.Backup.Retention == "" {
+		s.Backup.Retention = DefaultBackupRetention
+	}
+}
+
+// ApplyClass fills in the fields the spec leaves unset from a DatabaseClass.
+// The spec's own tier defaults are applied first, as the admission webhook
+// does, so they win over the class; the class's tier then applies to
+// whatever is still unset. Parameters are merged key by key.
+func (s *DatabaseSpec) ApplyClass(class *DatabaseClassSpec) {
+	s.Default()
+
+	if s.Engine == "" {
+		s.Engine = class.Engine
+	}
+	if s.Version == "" {
+		s.Version = class.Version
+	}
+	if s.Size == "" {
+		s.Size = class.Size
+	}
+	if s.Backup == nil && class.Backup != nil {
+		s.Backup = class.Backup.DeepCopy()
+	}
+	if s.Encryption == nil && class.Encryption != nil {
+		s.Encryption = class.Encryption.DeepCopy()
+	}
+	if s.HighAvailability == nil && class.HighAvailability != nil {
+		ha := *class.HighAvailability
+		s.HighAvailability = &ha
+	}
+	for key, value := range class.Parameters {
+		if _, ok := s.Parameters[key]; ok {
+			continue
+		}
+		if s.Parameters == nil {
+			s.Parameters = map[string]string{}
+		}
+		s.Parameters[key] = value
+	}
+
+	if s.Tier == "" && class.Tier != "" {
+		s.Tier = class.Tier
+		s.Default()
+	}
+	s.defaultBackupRetention()
+}
@@ -21,27 +21,56 @@ import (
 )
 
 // DatabaseSpec defines the desired state of Database
+// +kubebuilder:validation:XValidation:rule="has(self.classRef) || (has(self.engine) && has(self.version) && has(self.size))",message="engine, version and size are required unless classRef is set"
 type DatabaseSpec struct {
-	// Owner reference to the owning Application or Team
+	// Owner reference to the owning Tenant, Team or Application
 	Owner OwnerReference `json:"owner"`
 
-	// Engine specifies the database engine (postgresql, mysql, mongodb, etc.)
+	// ClassRef names a DatabaseClass whose settings fill in the fields this
+	// spec leaves unset
+	// +optional
+	ClassRef *DatabaseClassReference `json:"classRef,omitempty"`
+
+	// Engine specifies the database engine (postgresql, mysql, mongodb, etc.).
+	// Required unless the class sets it.
 	// +kubebuilder:validation:Enum=postgresql;mysql;mongodb;redis;sqlserver
-	Engine string `json:"engine"`
+	// +optional
+	Engine string `json:"engine,omitempty"`
 
-	// Version specifies the engine version
+	// Version specifies the engine version. Required unless the class sets it.
 	// +kubebuilder:validation:MinLength=1
-	Version string `json:"version"`
+	// +optional
+	Version string `json:"version,omitempty"`
 
-	// Size specifies the instance size
+	// Size specifies the instance size. Required unless the class sets it.
 	// +kubebuilder:validation:Enum=small;medium;large;xlarge
-	Size string `json:"size"`
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// Tier is the environment the database serves. It sets defaults for
+	// backups, deletion protection and high availability; fields set
+	// explicitly in the spec always win.
+	// +kubebuilder:validation:Enum=dev;staging;prod
+	// +optional
+	Tier string `json:"tier,omitempty"`
 
 	// Target specifies where to deploy (e.g., azure-westus2-prod)
 	// +optional
 	Target string `json:"target,omitempty"`
 
-	// Backup configuration
+	// Region is the cloud region to deploy into (e.g., eastus, us-west-2).
+	// Only brokers advertising the region for the engine are selected.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// TargetNamespace is the namespace the broker creates the workload in.
+	// Defaults to the Database's own namespace when empty.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// Backup configuration. Defaults to enabled for the staging and prod tiers.
 	// +optional
 	Backup *BackupConfig `json:"backup,omitempty"`
 
@@ -49,15 +78,87 @@ type DatabaseSpec struct {
 	// +optional
 	Encryption *EncryptionConfig `json:"encryption,omitempty"`
 
-	// HighAvailability enables HA configuration
+	// HighAvailability enables HA configuration. Defaults to true for the
+	// prod tier.
+	// +optional
+	HighAvailability *bool `json:"highAvailability,omitempty"`
+
+	// DeletionProtection rejects deletes of the Database while true. Enforced
+	// by the admission webhook; defaults to true for the prod tier.
+	// +optional
+	DeletionProtection *bool `json:"deletionProtection,omitempty"`
+
+	// ConnectionLimit caps concurrent client connections (max_connections,
+	// maxIncomingConnections, maxclients or user connections, per engine).
+	// Changing it reconfigures the running database.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ConnectionLimit *int32 `json:"connectionLimit,omitempty"`
+
+	// StatementTimeout aborts statements running longer than this (e.g. "30s").
+	// Supported for postgresql, mysql and mongodb. Changing it reconfigures
+	// the running database.
+	// +optional
+	StatementTimeout *metav1.Duration `json:"statementTimeout,omitempty"`
+
+	// ReadOnly rejects writes to the database, e.g. during an incident.
+	// Supported for postgresql, mysql and sqlserver. Changing it reconfigures
+	// the running database.
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// AdminCredentialsSecretRef names a Secret in the Database's namespace
+	// holding the admin "username" and "password" to use instead of
+	// generated credentials. They are read when the database is created.
 	// +optional
-	HighAvailability bool `json:"highAvailability,omitempty"`
+	AdminCredentialsSecretRef *LocalSecretReference `json:"adminCredentialsSecretRef,omitempty"`
+
+	// InitScripts are SQL scripts run in order once the database accepts
+	// connections, before it is marked Ready. They run when the database is
+	// created; a failure is reported on the InitFailed condition. Supported
+	// for postgresql.
+	// +kubebuilder:validation:MaxItems=20
+	// +optional
+	InitScripts []InitScript `json:"initScripts,omitempty"`
 
 	// Parameters for database-specific configuration
 	// +optional
 	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
+// InitScript is SQL run against a new database. Exactly one of Inline,
+// ConfigMapKeyRef and SecretKeyRef must be set.
+type InitScript struct {
+	// Name identifies the script in status and events
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+
+	// Inline is the SQL itself
+	// +optional
+	Inline string `json:"inline,omitempty"`
+
+	// ConfigMapKeyRef selects the SQL from a ConfigMap in the Database's namespace
+	// +optional
+	ConfigMapKeyRef *KeyReference `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects the SQL from a Secret in the Database's namespace
+	// +optional
+	SecretKeyRef *KeyReference `json:"secretKeyRef,omitempty"`
+}
+
+// KeyReference selects a key of a ConfigMap or Secret in the referring
+// resource's namespace
+type KeyReference struct {
+	// Name of the ConfigMap or Secret
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key within it
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
 // OwnerReference points to the owning resource
 type OwnerReference struct {
 	// Kind of the owner (Team, Application)
@@ -77,9 +178,11 @@ type BackupConfig struct {
 	// Enabled determines if backups are enabled
 	Enabled bool `json:"enabled"`
 
-	// Retention period (e.g., "7d", "30d")
+	// Retention period (e.g., "7d", "30d"). Defaults to 7d when backups are
+	// enabled.
 	// +kubebuilder:validation:Pattern=`^\d+[dhm]$`
-	Retention string `json:"retention"`
+	// +optional
+	Retention string `json:"retention,omitempty"`
 
 	// Schedule in cron format
 	// +optional
@@ -123,7 +226,7 @@ type InTransitEncryption struct {
 // DatabaseStatus defines the observed state of Database
 type DatabaseStatus struct {
 	// Phase represents the current state
-	// +kubebuilder:validation:Enum=Pending;Provisioning;Ready;Failed;Deleting
+	// +kubebuilder:validation:Enum=Pending;PendingApproval;Provisioning;Ready;Failed;Deleting;Suspended
 	Phase string `json:"phase,omitempty"`
 
 	// Conditions represent the latest available observations
@@ -154,6 +257,37 @@ type DatabaseStatus struct {
 	// +optional
 	BrokerRef *ObjectReference `json:"brokerRef,omitempty"`
 
+	// Region is where the database was placed, as reported by the broker or,
+	// failing that, the region of the broker that provisioned it
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// ConnectionLimit is the connection limit the broker last applied
+	// +optional
+	ConnectionLimit *int32 `json:"connectionLimit,omitempty"`
+
+	// StatementTimeout is the statement timeout the broker last applied
+	// +optional
+	StatementTimeout *metav1.Duration `json:"statementTimeout,omitempty"`
+
+	// ReadOnly is whether the broker last made the database read-only
+	// +optional
+	ReadOnly bool `json:"readOnly,omitempty"`
+
+	// CallbackTokenHash is the SHA-256 of the per-deployment callback token
+	// issued to the broker; callbacks for this deployment must present it
+	// +optional
+	CallbackTokenHash string `json:"callbackTokenHash,omitempty"`
+
+	// CallbackTokenExpiry is when the callback token stops being accepted
+	// +optional
+	CallbackTokenExpiry *metav1.Time `json:"callbackTokenExpiry,omitempty"`
+
+	// CallbackURL is the manager callback URL the broker was last given for
+	// this deployment; a change is pushed to in-flight deployments
+	// +optional
+	CallbackURL string `json:"callbackUrl,omitempty"`
+
 	// Cost information
 	// +optional
 	Cost *CostInfo `json:"cost,omitempty"`
@@ -165,6 +299,120 @@ type DatabaseStatus struct {
 	// ObservedGeneration reflects the generation most recently observed
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastReconcileTime is when the controller last reconciled this database
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// LastError is the error from the most recent reconcile, empty if it succeeded
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// Transitions records the most recent phase changes, oldest first
+	// +kubebuilder:validation:MaxItems=20
+	// +optional
+	Transitions []PhaseTransition `json:"transitions,omitempty"`
+
+	// Snapshots records the named snapshots requested for this database,
+	// oldest first
+	// +kubebuilder:validation:MaxItems=20
+	// +optional
+	Snapshots []DatabaseSnapshot `json:"snapshots,omitempty"`
+}
+
+// MaxDatabaseSnapshots is how many snapshots a Database's status keeps
+const MaxDatabaseSnapshots = 20
+
+// Snapshot phases
+const (
+	SnapshotPhasePending   = "Pending"
+	SnapshotPhaseCompleted = "Completed"
+	SnapshotPhaseFailed    = "Failed"
+)
+
+// DatabaseSnapshot tracks a named snapshot of a Database taken on request,
+// separately from its automated backups
+type DatabaseSnapshot struct {
+	// Name is the snapshot name requested by the user
+	Name string `json:"name"`
+
+	// ID is the broker's identifier for the snapshot, empty if the broker
+	// never accepted it
+	// +optional
+	ID string `json:"id,omitempty"`
+
+	// Phase is Pending, Completed or Failed
+	// +kubebuilder:validation:Enum=Pending;Completed;Failed
+	Phase string `json:"phase"`
+
+	// RequestedAt is when the snapshot was requested from the broker
+	RequestedAt metav1.Time `json:"requestedAt"`
+
+	// CompletedAt is when the snapshot completed or failed
+	// +optional
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+
+	// Message explains a failed snapshot
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// Snapshot returns the snapshot with the given name, or nil
+func (s *DatabaseStatus) Snapshot(name string) *DatabaseSnapshot {
+	for i := range s.Snapshots {
+		if s.Snapshots[i].Name == name {
+			return &s.Snapshots[i]
+		}
+	}
+	return nil
+}
+
+// AddSnapshot records a snapshot, keeping only the newest
+// MaxDatabaseSnapshots
+func (s *DatabaseStatus) AddSnapshot(snapshot DatabaseSnapshot) {
+	s.Snapshots = append(s.Snapshots, snapshot)
+	if n := len(s.Snapshots); n > MaxDatabaseSnapshots {
+		s.Snapshots = append([]DatabaseSnapshot(nil), s.Snapshots[n-MaxDatabaseSnapshots:]...)
+	}
+}
+
+// MaxPhaseTransitions is how many phase changes a Database's status keeps
+const MaxPhaseTransitions = 20
+
+// PhaseTransition records a change of a resource's phase
+type PhaseTransition struct {
+	// From is the phase before the change, empty for the first phase
+	// +optional
+	From string `json:"from,omitempty"`
+
+	// To is the phase after the change
+	To string `json:"to"`
+
+	// Timestamp is when the phase changed
+	Timestamp metav1.Time `json:"timestamp"`
+
+	// Reason is a CamelCase reason for the change
+	// +optional
+	Reason string `json:"reason,omitempty"`
+}
+
+// SetPhase moves the Database to phase, recording the change and its reason
+// in Transitions. Setting the current phase again records nothing. Only the
+// newest MaxPhaseTransitions changes are kept.
+func (s *DatabaseStatus) SetPhase(phase, reason string) {
+	if s.Phase == phase {
+		return
+	}
+	s.Transitions = append(s.Transitions, PhaseTransition{
+		From:      s.Phase,
+		To:        phase,
+		Timestamp: metav1.Now(),
+		Reason:    reason,
+	})
+	if n := len(s.Transitions); n > MaxPhaseTransitions {
+		s.Transitions = append([]PhaseTransition(nil), s.Transitions[n-MaxPhaseTransitions:]...)
+	}
+	s.Phase = phase
 }
 
 // SecretReference points to a Kubernetes secret
@@ -173,6 +421,13 @@ type SecretReference struct {
 	Namespace string `json:"namespace"`
 }
 
+// LocalSecretReference points to a Secret in the referring resource's namespace
+type LocalSecretReference struct {
+	// Name of the Secret
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
 // CostInfo tracks resource costs
 type CostInfo struct {
 	// EstimatedMonthly in USD
@@ -192,6 +447,8 @@ type CostInfo struct {
 // +kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.spec.size`
 // +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
 // +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.endpoint`
+// +kubebuilder:printcolumn:name="Last Reconcile",type=date,JSONPath=`.status.lastReconcileTime`
+// +kubebuilder:printcolumn:name="Error",type=string,JSONPath=`.status.lastError`,priority=1
 // +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Database is the Schema for the databases API
@@ -0,0 +1,244 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// maxConnectionLimits is the largest connection limit each engine accepts
+var maxConnectionLimits = map[string]int32{
+	"postgresql": 262143,
+	"mysql":      100000,
+	"mongodb":    1000000,
+	"redis":      1000000,
+	"sqlserver":  32767,
+}
+
+// statementTimeoutEngines are the engines with a server-side statement
+// timeout (statement_timeout, max_execution_time, defaultMaxTimeMS)
+var statementTimeoutEngines = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"mongodb":    true,
+}
+
+// readOnlyEngines are the engines that can be switched to read-only
+// (default_transaction_read_only, super_read_only, READ_ONLY)
+var readOnlyEngines = map[string]bool{
+	"postgresql": true,
+	"mysql":      true,
+	"sqlserver":  true,
+}
+
+// initScriptEngines are the engines that can run init scripts
+var initScriptEngines = map[string]bool{
+	"postgresql": true,
+}
+
+// maxInlineInitScriptBytes bounds an inline init script so the Database
+// stays well within the object size limit
+const maxInlineInitScriptBytes = 64 * 1024
+
+// maxStatementTimeout bounds StatementTimeout; MySQL and MongoDB take it in
+// milliseconds as a 32-bit value
+const maxStatementTimeout = 24 * time.Hour
+
+// ValidateRequired checks the engine, version and size are set. A Database
+// referencing a DatabaseClass is checked after the class is applied.
+func (s *DatabaseSpec) ValidateRequired(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for _, f := range []struct{ name, value string }{{"engine", s.Engine}, {"version", s.Version}, {"size", s.Size}} {
+		if f.value == "" {
+			errs = append(errs, field.Required(fldPath.Child(f.name), "must be set in the Database or its DatabaseClass"))
+		}
+	}
+	return errs
+}
+
+// ValidateGuardrails checks ConnectionLimit, StatementTimeout and ReadOnly
+// are supported by the engine and within its range
+func (s *DatabaseSpec) ValidateGuardrails(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+
+	if s.ConnectionLimit != nil {
+		limit := *s.ConnectionLimit
+		path := fldPath.Child("connectionLimit")
+		if limit < 1 {
+			errs = append(errs, field.Invalid(path, limit, "must be at least 1"))
+		} else if max, ok := maxConnectionLimits[s.Engine]; ok && limit > max {
+			errs = append(errs, field.Invalid(path, limit, fmt.Sprintf("must be at most %d for %s", max, s.Engine)))
+		}
+	}
+
+	if s.StatementTimeout != nil {
+		timeout := s.StatementTimeout.Duration
+		path := fldPath.Child("statementTimeout")
+		switch {
+		case !statementTimeoutEngines[s.Engine]:
+			errs = append(errs, field.Forbidden(path, fmt.Sprintf("%s does not support a statement timeout", s.Engine)))
+		case timeout < time.Millisecond:
+			errs = append(errs, field.Invalid(path, s.StatementTimeout.String(), "must be at least 1ms"))
+		case timeout > maxStatementTimeout:
+			errs = append(errs, field.Invalid(path, s.StatementTimeout.String(), fmt.Sprintf("must be at most %s", maxStatementTimeout)))
+		case timeout%time.Millisecond != 0:
+			errs = append(errs, field.Invalid(path, s.StatementTimeout.String(), "must be a whole number of milliseconds"))
+		}
+	}
+
+	if s.ReadOnly && !readOnlyEngines[s.Engine] {
+		errs = append(errs, field.Forbidden(fldPath.Child("readOnly"), fmt.Sprintf("%s does not support read-only mode", s.Engine)))
+	}
+
+	return errs
+}
+
+// ValidateCombinations checks options that depend on another option being
+// on, which the broker would otherwise reject or silently ignore
+func (s *DatabaseSpec) ValidateCombinations(fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if b := s.Backup; b != nil && !b.Enabled {
+		path := fldPath.Child("backup")
+		if b.PointInTimeRestore {
+			errs = append(errs, field.Forbidden(path.Child("pointInTimeRestore"), "requires backup.enabled to be true"))
+		}
+		if b.Schedule != "" {
+			errs = append(errs, field.Forbidden(path.Child("schedule"), "requires backup.enabled to be true"))
+		}
+	}
+	if e := s.Encryption; e != nil {
+		path := fldPath.Child("encryption")
+		if e.AtRest.KMSKeyID != "" && !e.AtRest.Enabled {
+			errs = append(errs, field.Forbidden(path.Child("atRest", "kmsKeyId"), "requires encryption.atRest.enabled to be true"))
+		}
+		if e.InTransit.MinTLSVersion != "" && !e.InTransit.Enabled {
+			errs = append(errs, field.Forbidden(path.Child("inTransit", "minTLSVersion"), "requires encryption.inTransit.enabled to be true"))
+		}
+	}
+	return errs
+}
+
+// ValidateInitScripts checks the engine runs init scripts and that each
+// script has a unique name and exactly one source
+func (s *DatabaseSpec) ValidateInitScripts(fldPath *field.Path) field.ErrorList {
+	if len(s.InitScripts) == 0 {
+		return nil
+	}
+	path := fldPath.Child("initScripts")
+	if !initScriptEngines[s.Engine] {
+		return field.ErrorList{field.Forbidden(path, fmt.Sprintf("%s does not support init scripts", s.Engine))}
+	}
+
+	var errs field.ErrorList
+	names := map[string]bool{}
+	for i, script := range s.InitScripts {
+		scriptPath := path.Index(i)
+		if script.Name == "" {
+			errs = append(errs, field.Required(scriptPath.Child("name"), "must name the script"))
+		} else if names[script.Name] {
+			errs = append(errs, field.Duplicate(scriptPath.Child("name"), script.Name))
+		}
+		names[script.Name] = true
+
+		sources := 0
+		if script.Inline != "" {
+			sources++
+			if len(script.Inline) > maxInlineInitScriptBytes {
+				errs = append(errs, field.TooLong(scriptPath.Child("inline"), "", maxInlineInitScriptBytes))
+			}
+		}
+		refs := []struct {
+			field string
+			ref   *KeyReference
+		}{{"configMapKeyRef", script.ConfigMapKeyRef}, {"secretKeyRef", script.SecretKeyRef}}
+		for _, r := range refs {
+			ref := r.ref
+			if ref == nil {
+				continue
+			}
+			sources++
+			refPath := scriptPath.Child(r.field)
+			if ref.Name == "" {
+				errs = append(errs, field.Required(refPath.Child("name"), "must name the source"))
+			}
+			for _, msg := range validation.IsConfigMapKey(ref.Key) {
+				errs = append(errs, field.Invalid(refPath.Child("key"), ref.Key, msg))
+			}
+		}
+		if sources != 1 {
+			errs = append(errs, field.Invalid(scriptPath, script.Name, "must set exactly one of inline, configMapKeyRef and secretKeyRef"))
+		}
+	}
+	return errs
+}
+
+// ValidateImmutable checks an update to a provisioned database against its
+// previous spec: the engine can't change, and the version can't go down,
+// since the deployed data can't follow either. Both specs should have their
+// class applied.
+func (s *DatabaseSpec) ValidateImmutable(old *DatabaseSpec, fldPath *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if old.Engine != "" && s.Engine != old.Engine {
+		errs = append(errs, field.Invalid(fldPath.Child("engine"), s.Engine,
+			fmt.Sprintf("is immutable once the database is provisioned; it was %q", old.Engine)))
+	}
+	if old.Version != "" && s.Version != "" && compareVersions(s.Version, old.Version) < 0 {
+		errs = append(errs, field.Invalid(fldPath.Child("version"), s.Version,
+			fmt.Sprintf("cannot be downgraded from %q once the database is provisioned", old.Version)))
+	}
+	return errs
+}
+
+// compareVersions compares dotted engine versions such as "15" and "8.0.36"
+// numerically, segment by segment, with missing segments counting as zero.
+// Versions with a non-numeric segment are reported equal, since their order
+// can't be told.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		x, err := versionSegment(as, i)
+		if err != nil {
+			return 0
+		}
+		y, err := versionSegment(bs, i)
+		if err != nil {
+			return 0
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionSegment returns the i'th segment of a split version, zero if the
+// version has fewer segments
+func versionSegment(segments []string, i int) (int, error) {
+	if i >= len(segments) {
+		return 0, nil
+	}
+	return strconv.Atoi(segments[i])
+}
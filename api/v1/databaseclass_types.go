@@ -0,0 +1,103 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseClassSpec holds the defaults a DatabaseClass gives the Databases
+// that reference it. Every field is optional; a Database's own values win.
+type DatabaseClassSpec struct {
+	// Description says what the class is for
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Engine specifies the database engine
+	// +kubebuilder:validation:Enum=postgresql;mysql;mongodb;redis;sqlserver
+	// +optional
+	Engine string `json:"engine,omitempty"`
+
+	// Version specifies the engine version
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Size specifies the instance size
+	// +kubebuilder:validation:Enum=small;medium;large;xlarge
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// Tier is the environment tier, whose own defaults apply after the class's
+	// +kubebuilder:validation:Enum=dev;staging;prod
+	// +optional
+	Tier string `json:"tier,omitempty"`
+
+	// Backup configuration
+	// +optional
+	Backup *BackupConfig `json:"backup,omitempty"`
+
+	// Encryption configuration
+	// +optional
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
+
+	// HighAvailability enables HA configuration
+	// +optional
+	HighAvailability *bool `json:"highAvailability,omitempty"`
+
+	// Parameters for database-specific configuration, merged key by key
+	// under the Database's own
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// DatabaseClassReference names the DatabaseClass a Database takes its
+// defaults from
+type DatabaseClassReference struct {
+	// Name of the DatabaseClass
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Engine",type=string,JSONPath=`.spec.engine`
+// +kubebuilder:printcolumn:name="Version",type=string,JSONPath=`.spec.version`
+// +kubebuilder:printcolumn:name="Size",type=string,JSONPath=`.spec.size`
+// +kubebuilder:printcolumn:name="Tier",type=string,JSONPath=`.spec.tier`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// DatabaseClass is a cluster-wide template of Database settings, so teams
+// don't repeat the same spec across many Databases
+type DatabaseClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DatabaseClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseClassList contains a list of DatabaseClass
+type DatabaseClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DatabaseClass{}, &DatabaseClassList{})
+}
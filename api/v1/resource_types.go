@@ -0,0 +1,38 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import "strings"
+
+// Resource types in their canonical form, as sent to brokers and echoed on
+// their callbacks
+const (
+	ResourceTypeDatabase = "database"
+	ResourceTypeCache    = "cache"
+	ResourceTypeTopic    = "topic"
+)
+
+// ResourceTypes lists every resource type the platform defines
+var ResourceTypes = []string{ResourceTypeDatabase, ResourceTypeCache, ResourceTypeTopic}
+
+// NormalizeResourceType returns the canonical form of a resource type, so
+// "Database", "database" and " DATABASE " all compare equal. Broker
+// capabilities, selection criteria and callbacks are normalized before they
+// are compared.
+func NormalizeResourceType(resourceType string) string {
+	return strings.ToLower(strings.TrimSpace(resourceType))
+}
@@ -84,6 +84,13 @@ type Budget struct {
 	// AlertThresholds define when to send alerts (e.g., 0.8 for 80%)
 	// +optional
 	AlertThresholds []float64 `json:"alertThresholds,omitempty"`
+
+	// ApprovalThreshold is the estimated monthly cost in USD above which a
+	// new Database waits in PendingApproval until it is annotated
+	// platform.company.com/approved=true
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ApprovalThreshold *float64 `json:"approvalThreshold,omitempty"`
 }
 
 // TeamQuotas defines resource quotas for a team
@@ -42,9 +42,32 @@ type TenantSpec struct {
 	// +optional
 	BillingCode string `json:"billingCode,omitempty"`
 
+	// Budget defines tenant-wide spending limits. A team's own budget
+	// settings take precedence for the team's resources.
+	// +optional
+	Budget *Budget `json:"budget,omitempty"`
+
 	// Quotas define tenant-wide limits
 	// +optional
 	Quotas *TenantQuotas `json:"quotas,omitempty"`
+
+	// Placement restricts which brokers may provision the tenant's
+	// databases, e.g. to keep data in the EU
+	// +optional
+	Placement *PlacementPolicy `json:"placement,omitempty"`
+}
+
+// PlacementPolicy limits broker selection for data residency. Each list that
+// is set must contain the broker's value; a broker that doesn't declare one
+// is not selected.
+type PlacementPolicy struct {
+	// Regions the tenant's resources may be placed in, e.g. [westeurope, northeurope]
+	// +optional
+	Regions []string `json:"regions,omitempty"`
+
+	// CloudProviders the tenant's resources may be placed with
+	// +optional
+	CloudProviders []string `json:"cloudProviders,omitempty"`
 }
 
 // TenantQuotas defines resource quotas for a tenant
@@ -0,0 +1,145 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TopicSpec defines the desired state of Topic
+type TopicSpec struct {
+	// Owner reference to the owning Tenant, Team or Application
+	Owner OwnerReference `json:"owner"`
+
+	// Engine specifies the messaging engine
+	// +kubebuilder:validation:Enum=kafka;rabbitmq;nats
+	Engine string `json:"engine"`
+
+	// Partitions is the number of partitions (or shards) the topic is split into.
+	// RabbitMQ and NATS ignore it.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=1
+	// +optional
+	Partitions int32 `json:"partitions,omitempty"`
+
+	// ReplicationFactor is how many copies of each message are kept
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=5
+	// +kubebuilder:default=1
+	// +optional
+	ReplicationFactor int32 `json:"replicationFactor,omitempty"`
+
+	// Retention is how long messages are kept (e.g. "12h", "7d")
+	// +kubebuilder:validation:Pattern=`^[0-9]+(m|h|d)$`
+	// +kubebuilder:default="7d"
+	// +optional
+	Retention string `json:"retention,omitempty"`
+
+	// Region is the cloud region to deploy into (e.g., eastus, us-west-2)
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// TargetNamespace is the namespace the broker creates the workload in.
+	// Defaults to the Topic's own namespace when empty.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// Parameters for engine-specific configuration
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// TopicStatus defines the observed state of Topic
+type TopicStatus struct {
+	// Phase represents the current state
+	// +kubebuilder:validation:Enum=Pending;Provisioning;Ready;Failed;Deleting;Suspended
+	Phase string `json:"phase,omitempty"`
+
+	// Conditions represent the latest available observations
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Endpoint is the bootstrap or connection endpoint
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Port is the connection port
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// ConnectionSecretRef references the secret containing connection details
+	// +optional
+	ConnectionSecretRef *SecretReference `json:"connectionSecretRef,omitempty"`
+
+	// DeploymentID from the broker
+	// +optional
+	DeploymentID string `json:"deploymentId,omitempty"`
+
+	// BrokerRef references the Broker CR that handled this deployment
+	// +optional
+	BrokerRef *ObjectReference `json:"brokerRef,omitempty"`
+
+	// CallbackTokenHash is the SHA-256 of the per-deployment callback token
+	// issued to the broker; callbacks for this deployment must present it
+	// +optional
+	CallbackTokenHash string `json:"callbackTokenHash,omitempty"`
+
+	// CallbackTokenExpiry is when the callback token stops being accepted
+	// +optional
+	CallbackTokenExpiry *metav1.Time `json:"callbackTokenExpiry,omitempty"`
+
+	// LastReconcileTime is when the controller last reconciled this topic
+	// +optional
+	LastReconcileTime *metav1.Time `json:"lastReconcileTime,omitempty"`
+
+	// LastError is the error from the most recent reconcile, empty if it succeeded
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Engine",type=string,JSONPath=`.spec.engine`
+// +kubebuilder:printcolumn:name="Partitions",type=integer,JSONPath=`.spec.partitions`
+// +kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.status.endpoint`
+// +kubebuilder:printcolumn:name="Error",type=string,JSONPath=`.status.lastError`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Topic is the Schema for the topics API
+type Topic struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TopicSpec   `json:"spec,omitempty"`
+	Status TopicStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TopicList contains a list of Topic
+type TopicList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Topic `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Topic{}, &TopicList{})
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aykay76/kidp/pkg/redact"
+)
+
+// requestIDHeader carries a request's correlation ID. An ID the caller sends
+// is kept, so the manager's logs and the broker's can be joined on it.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the caller-supplied IDs the broker accepts
+const maxRequestIDLength = 128
+
+// newLogger returns a JSON logger writing to w that drops records below
+// level (debug, info, warn or error). Credentials, tokens and connection
+// secrets are redacted from every record.
+func newLogger(w io.Writer, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+	return slog.New(redact.NewHandler(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: l}))), nil
+}
+
+// fatal logs msg as an error and exits
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying logger
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// log returns the logger of the request ctx belongs to, or the server's
+// logger outside a request
+func (s *Server) log(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
+
+// withLogAttrs adds fields to the request's logger, so every later line
+// logged for the request carries them
+func (s *Server) withLogAttrs(ctx context.Context, args ...any) context.Context {
+	return withLogger(ctx, s.log(ctx).With(args...))
+}
+
+// withRequestID gives each request a correlation ID, returned in the
+// X-Request-ID header and attached with the caller's address to every line
+// logged for the request. Each request is logged once handled; health and
+// readiness probes only at debug level.
+func (s *Server) withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := s.logger.With("requestId", id, "remoteAddr", r.RemoteAddr)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(withLogger(r.Context(), logger)))
+
+		level := slog.LevelInfo
+		if r.URL.Path == "/health" || r.URL.Path == "/readiness" {
+			level = slog.LevelDebug
+		}
+		logger.Log(r.Context(), level, "Handled request",
+			"method", r.Method, "path", r.URL.Path, "status", rec.status, "duration", time.Since(start))
+	})
+}
+
+// validRequestID reports whether a caller-supplied request ID is short and
+// printable enough to reuse
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 16 character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
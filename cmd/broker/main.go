@@ -17,33 +17,48 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
 	"github.com/aykay76/kidp/pkg/broker"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/tracing"
+	"github.com/aykay76/kidp/pkg/version"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/attribute"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	crclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-const (
-	version = "0.1.0"
-)
+// retryAfterSeconds is sent with 429/503 responses when the broker or a team
+// is at capacity
+const retryAfterSeconds = "30"
+
+// defaultDeploymentLogLimit is how many log entries /v1/deployments/{id}/logs
+// returns when no limit is given
+const defaultDeploymentLogLimit = 100
 
 // Server configuration
 type Config struct {
@@ -52,15 +67,97 @@ type Config struct {
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
 	LogLevel        string
+
+	// TLSCertFile and TLSKeyFile serve the API over HTTPS when both are set.
+	// TLSMinVersion (1.2 or 1.3) and TLSCipherSuites (approved TLS 1.2
+	// suites by name, all of them when empty) restrict the handshake.
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSCipherSuites []string
+
+	// TLSClientCAFile, when set, requires requests to the /v1/ API to
+	// present a client certificate signed by one of its CAs. It needs TLS.
+	TLSClientCAFile string
+
+	// MaxConcurrentDeployments caps in-flight deployments across all teams
+	// (0 = unlimited). It should match the Broker CR's spec.
+	MaxConcurrentDeployments int
+
+	// WorkerConcurrency caps how many accepted deployments provision at
+	// once (0 = unlimited). Accepted deployments beyond it wait in the
+	// worker queue, highest priority first.
+	WorkerConcurrency int
+
+	// TeamMaxConcurrent is the default number of in-flight deployments
+	// allowed per team (0 = unlimited); TeamLimits overrides it per team
+	TeamMaxConcurrent int
+	TeamLimits        map[string]int
+
+	// ProvisionTimeout bounds how long a provisioner waits for a resource to
+	// become ready; the provisioner's default is used when zero
+	ProvisionTimeout time.Duration
+
+	// PreProvisionHookURL and PostProvisionHookURL are optional webhooks
+	// called before and after each deployment; a denying pre-provision hook
+	// aborts it. HookTimeout bounds each call.
+	PreProvisionHookURL  string
+	PostProvisionHookURL string
+	HookTimeout          time.Duration
+
+	// Capabilities is what the broker advertises and validates requests
+	// against; the defaults are used when nil
+	Capabilities *broker.CapabilityStore
+
+	// SigningKey reports whether the callback signing key is loaded and
+	// registered; readiness fails until it is
+	SigningKey *broker.SigningKeyStatus
+
+	// DiagnosticsToken is the bearer token required by the diagnostics
+	// endpoint, which is disabled when it is empty
+	DiagnosticsToken string
+
+	// APIKey, when set, requires requests to the /v1/ API to carry it as a
+	// bearer token
+	APIKey string
+
+	// ManagerPublicKey, when set, requires requests to the /v1/ API to be
+	// signed by the manager's Ed25519 key; requests are unauthenticated
+	// when it is nil
+	ManagerPublicKey ed25519.PublicKey
+
+	// Callback controls how status callbacks to the manager are retried
+	Callback broker.CallbackConfig
+
+	// DeadLetters keeps callbacks that exhaust their retries for replay;
+	// they are dropped when nil
+	DeadLetters broker.DeadLetterStore
+
+	// PendingTasks keeps accepted provisions until they finish, so those
+	// queued or running when the broker stops resume when it starts again;
+	// they are lost on restart when nil
+	PendingTasks broker.TaskStore
 }
 
 // Server holds the HTTP server and dependencies
 type Server struct {
-	config    *Config
-	router    *http.ServeMux
-	logger    *log.Logger
-	k8sClient *broker.K8sClient
-	startTime time.Time
+	config       *Config
+	router       *http.ServeMux
+	logger       *slog.Logger
+	k8sClient    *broker.K8sClient
+	provisioners *broker.ProvisionerRegistry
+	worker       *broker.Worker
+	callbacks    *broker.CallbackClient
+	costs        broker.CostEstimator
+	capabilities *broker.CapabilityStore
+	signingKey   *broker.SigningKeyStatus
+	capacity     *broker.CapacityLimiter
+	teamLimiter  *broker.TeamLimiter
+	deployments  *broker.DeploymentTracker
+	audit        *broker.AuditLog
+	metrics      *broker.Metrics
+	registry     *prometheus.Registry
+	startTime    time.Time
 }
 
 func main() {
@@ -71,30 +168,162 @@ func main() {
 	flag.DurationVar(&config.WriteTimeout, "write-timeout", 15*time.Second, "HTTP write timeout")
 	flag.DurationVar(&config.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Graceful shutdown timeout")
 	flag.StringVar(&config.LogLevel, "log-level", "info", "Log level (debug, info, warn, error)")
+	flag.StringVar(&config.TLSCertFile, "tls-cert-file", "", "Certificate file for serving HTTPS; requires --tls-key-file")
+	flag.StringVar(&config.TLSKeyFile, "tls-key-file", "", "Private key file for serving HTTPS; requires --tls-cert-file")
+	flag.StringVar(&config.TLSMinVersion, "tls-min-version", DefaultTLSMinVersion, "Minimum TLS version accepted (1.2 or 1.3)")
+	flag.StringVar(&config.TLSClientCAFile, "tls-client-ca-file", "", "CA bundle for verifying manager client certificates; when set, /v1/ requests must present one (requires --tls-cert-file)")
+	tlsCipherSuites := flag.String("tls-cipher-suites", "", "Comma-separated TLS 1.2 cipher suites to accept, from the approved ECDHE AEAD suites (empty = all approved suites)")
+	flag.IntVar(&config.MaxConcurrentDeployments, "max-concurrent-deployments", 10, "Maximum in-flight deployments on this broker (0 = unlimited)")
+	flag.IntVar(&config.TeamMaxConcurrent, "team-max-concurrent", 5, "Maximum in-flight deployments per team (0 = unlimited)")
+	flag.IntVar(&config.WorkerConcurrency, "worker-concurrency", 5, "Maximum deployments provisioning at once; the rest queue by priority (0 = unlimited)")
+	flag.DurationVar(&config.ProvisionTimeout, "provision-timeout", 10*time.Minute, "How long to wait for a provisioned resource to become ready")
+	flag.StringVar(&config.PreProvisionHookURL, "pre-provision-hook-url", "", "Webhook that must approve each deployment before it is provisioned")
+	flag.StringVar(&config.PostProvisionHookURL, "post-provision-hook-url", "", "Webhook told the outcome of each deployment")
+	flag.DurationVar(&config.HookTimeout, "hook-timeout", 30*time.Second, "Timeout for each provisioning hook call")
+	callbackDefaults := broker.DefaultCallbackConfig()
+	flag.IntVar(&config.Callback.MaxRetries, "callback-max-retries", callbackDefaults.MaxRetries, "How many times a failed status callback is retried")
+	flag.DurationVar(&config.Callback.BaseBackoff, "callback-base-backoff", callbackDefaults.BaseBackoff, "Wait before the first callback retry; doubles for each further retry")
+	flag.DurationVar(&config.Callback.MaxBackoff, "callback-max-backoff", callbackDefaults.MaxBackoff, "Longest wait between callback retries")
+	flag.Float64Var(&config.Callback.JitterFraction, "callback-jitter", callbackDefaults.JitterFraction, "Fraction by which each callback retry wait is randomized either way")
+	deadLetterDir := flag.String("dead-letter-dir", "/var/lib/broker/dead-letters", "Directory where callbacks that exhaust their retries are kept for replay (empty = drop them)")
+	pendingTaskDir := flag.String("pending-task-dir", "/var/lib/broker/pending-tasks", "Directory where accepted provisions are kept until they finish, to resume them after a restart (empty = keep them in memory only)")
+	deadLetterReplay := flag.Duration("dead-letter-replay-interval", time.Minute, "How often to retry dead-lettered callbacks")
+	teamLimits := flag.String("team-limits", "", "Per-team overrides of team-max-concurrent, e.g. team-a=10,team-b=2")
+	capabilitiesFile := flag.String("capabilities-file", "", "YAML file (e.g. a mounted ConfigMap key) listing the resource types, providers, regions and sizes this broker supports")
+	capabilitiesReload := flag.Duration("capabilities-reload-interval", 30*time.Second, "How often to check the capabilities file for changes")
+	diagnosticsTokenFile := flag.String("diagnostics-token-file", "", "File (e.g. a mounted Secret key) holding the bearer token for /v1/diagnostics; the endpoint is disabled without one")
+	apiKeyFile := flag.String("api-key-file", "", "File (e.g. a mounted Secret key) holding the API key the manager must send as a bearer token on /v1/ requests")
+	managerPublicKeyFile := flag.String("manager-public-key-file", "", "File holding the manager's base64 Ed25519 public key; when set, /v1/ requests must be signed by the manager")
 	flag.Parse()
 
-	// Create logger
-	logger := log.New(os.Stdout, "[broker] ", log.LstdFlags|log.Lmsgprefix)
-	logger.Printf("Starting KIDP Deployment Broker v%s", version)
-	logger.Printf("Configuration: port=%d, read-timeout=%s, write-timeout=%s",
-		config.Port, config.ReadTimeout, config.WriteTimeout)
+	// Create logger. Packages logging through the standard library logger
+	// write through it too.
+	logger, err := newLogger(os.Stdout, config.LogLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --log-level: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	logger.Info("Starting KIDP Deployment Broker", "version", version.Version)
+	logger.Info("Configuration", "port", config.Port, "readTimeout", config.ReadTimeout,
+		"writeTimeout", config.WriteTimeout, "logLevel", config.LogLevel)
+
+	// Weak TLS settings are refused even before TLS is enabled
+	config.TLSCipherSuites = splitList(*tlsCipherSuites)
+	tlsConfig, err := newTLSConfig(config.TLSMinVersion, config.TLSCipherSuites)
+	if err != nil {
+		fatal(logger, "Invalid TLS configuration", "error", err)
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		fatal(logger, "--tls-cert-file and --tls-key-file must be set together")
+	}
+	if config.TLSClientCAFile != "" {
+		if config.TLSCertFile == "" {
+			fatal(logger, "--tls-client-ca-file requires --tls-cert-file and --tls-key-file")
+		}
+		if err := setClientCAs(tlsConfig, config.TLSClientCAFile); err != nil {
+			fatal(logger, "Invalid TLS configuration", "error", err)
+		}
+		logger.Info("Requiring manager client certificates", "path", config.TLSClientCAFile)
+	}
+
+	limits, err := broker.ParseTeamLimits(*teamLimits)
+	if err != nil {
+		fatal(logger, "Invalid --team-limits", "error", err)
+	}
+	config.TeamLimits = limits
+	logger.Info("Capacity", "maxConcurrentDeployments", config.MaxConcurrentDeployments,
+		"workerConcurrency", config.WorkerConcurrency, "teamMaxConcurrent", config.TeamMaxConcurrent, "teamLimits", config.TeamLimits)
+	if config.PreProvisionHookURL != "" || config.PostProvisionHookURL != "" {
+		logger.Info("Provisioning hooks", "pre", config.PreProvisionHookURL, "post", config.PostProvisionHookURL)
+	}
+
+	if *diagnosticsTokenFile != "" {
+		token, err := os.ReadFile(*diagnosticsTokenFile)
+		if err != nil {
+			fatal(logger, "Failed to read diagnostics token", "error", err)
+		}
+		config.DiagnosticsToken = strings.TrimSpace(string(token))
+		if config.DiagnosticsToken == "" {
+			fatal(logger, "Diagnostics token file is empty", "path", *diagnosticsTokenFile)
+		}
+	}
+
+	if *apiKeyFile != "" {
+		key, err := os.ReadFile(*apiKeyFile)
+		if err != nil {
+			fatal(logger, "Failed to read API key", "error", err)
+		}
+		config.APIKey = strings.TrimSpace(string(key))
+		if config.APIKey == "" {
+			fatal(logger, "API key file is empty", "path", *apiKeyFile)
+		}
+		logger.Info("Requiring an API key", "path", *apiKeyFile)
+	}
+
+	if *managerPublicKeyFile != "" {
+		key, err := loadManagerPublicKey(*managerPublicKeyFile)
+		if err != nil {
+			fatal(logger, "Failed to load manager public key", "error", err)
+		}
+		config.ManagerPublicKey = key
+		logger.Info("Requiring manager-signed requests", "path", *managerPublicKeyFile)
+	}
+
+	if *deadLetterDir != "" {
+		// Callbacks are still delivered without the store, so run without it
+		// rather than refusing to start
+		if deadLetters, err := broker.NewFileDeadLetterStore(*deadLetterDir); err != nil {
+			logger.Warn("Undelivered callbacks will be dropped", "error", err)
+		} else {
+			config.DeadLetters = deadLetters
+			logger.Info("Dead-lettering undelivered callbacks", "dir", *deadLetterDir)
+		}
+	}
+
+	if *pendingTaskDir != "" {
+		// Provisioning still works without the store, so run without it
+		// rather than refusing to start
+		if pendingTasks, err := broker.NewFileTaskStore(*pendingTaskDir); err != nil {
+			logger.Warn("Queued provisions will be lost on restart", "error", err)
+		} else {
+			config.PendingTasks = pendingTasks
+			logger.Info("Persisting queued provisions", "dir", *pendingTaskDir)
+		}
+	}
+
+	capabilities, err := broker.NewCapabilityStore(*capabilitiesFile)
+	if err != nil {
+		fatal(logger, "Failed to load capabilities", "error", err)
+	}
+	config.Capabilities = capabilities
+	if *capabilitiesFile != "" {
+		logger.Info("Loaded capabilities", "path", *capabilitiesFile)
+		go capabilities.Watch(context.Background(), *capabilitiesReload, logger)
+	}
+
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), "kidp-broker")
+	if err != nil {
+		fatal(logger, "Failed to set up tracing", "error", err)
+	}
 
 	// Create Kubernetes client
 	k8sClient, err := broker.NewK8sClient()
 	if err != nil {
-		logger.Fatalf("Failed to create Kubernetes client: %v", err)
+		fatal(logger, "Failed to create Kubernetes client", "error", err)
 	}
-	logger.Println("Successfully connected to Kubernetes cluster")
+	logger.Info("Successfully connected to Kubernetes cluster")
 
 	// Create controller-runtime client to patch Broker CR status
 	cfg := ctrl.GetConfigOrDie()
 	scheme := runtime.NewScheme()
 	if err := platformv1.AddToScheme(scheme); err != nil {
-		logger.Fatalf("Failed to add platformv1 to scheme: %v", err)
+		fatal(logger, "Failed to add platformv1 to scheme", "error", err)
 	}
 	crClient, err := crclient.New(cfg, crclient.Options{Scheme: scheme})
 	if err != nil {
-		logger.Fatalf("Failed to create controller-runtime client: %v", err)
+		fatal(logger, "Failed to create controller-runtime client", "error", err)
 	}
 
 	// Ensure broker private key exists and register public key in Broker CR
@@ -106,7 +335,7 @@ func main() {
 
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(privPath), 0700); err != nil {
-		logger.Fatalf("Failed to create key directory: %v", err)
+		fatal(logger, "Failed to create key directory", "error", err)
 	}
 
 	var priv ed25519.PrivateKey
@@ -114,12 +343,12 @@ func main() {
 		// Generate new key
 		pub, ppriv, genErr := ed25519.GenerateKey(rand.Reader)
 		if genErr != nil {
-			logger.Fatalf("Failed to generate ed25519 keypair: %v", genErr)
+			fatal(logger, "Failed to generate ed25519 keypair", "error", genErr)
 		}
 		priv = ppriv
 		// Write raw private key bytes to file (0600)
 		if writeErr := os.WriteFile(privPath, priv, 0600); writeErr != nil {
-			logger.Fatalf("Failed to write private key to %s: %v", privPath, writeErr)
+			fatal(logger, "Failed to write private key", "path", privPath, "error", writeErr)
 		}
 
 		// Persist public key to Broker CR if BROKER_NAME provided
@@ -133,34 +362,36 @@ func main() {
 			var brokerCR platformv1.Broker
 			ctx := context.Background()
 			if getErr := crClient.Get(ctx, crclient.ObjectKey{Namespace: brokerNS, Name: brokerName}, &brokerCR); getErr != nil {
-				logger.Printf("Failed to get Broker CR %s/%s: %v", brokerNS, brokerName, getErr)
+				logger.Error("Failed to get Broker CR", "namespace", brokerNS, "broker", brokerName, "error", getErr)
 			} else {
-				brokerCR.Status.CallbackPublicKey = pubB64
+				brokerCR.Status.RotateCallbackPublicKey(pubB64)
 				if upErr := crClient.Status().Update(ctx, &brokerCR); upErr != nil {
-					logger.Printf("Failed to update Broker CR status with public key: %v", upErr)
+					logger.Error("Failed to update Broker CR status with public key", "namespace", brokerNS, "broker", brokerName, "error", upErr)
 				} else {
-					logger.Printf("Registered broker public key in Broker CR %s/%s", brokerNS, brokerName)
+					logger.Info("Registered broker public key in Broker CR", "namespace", brokerNS, "broker", brokerName)
 				}
 			}
 		} else {
-			logger.Printf("BROKER_NAME not set; skipping Broker CR public key registration")
+			logger.Warn("BROKER_NAME not set; skipping Broker CR public key registration")
 		}
 	} else if err == nil {
 		// Read existing private key
 		b, rerr := os.ReadFile(privPath)
 		if rerr != nil {
-			logger.Fatalf("Failed to read existing private key: %v", rerr)
+			fatal(logger, "Failed to read existing private key", "path", privPath, "error", rerr)
 		}
 		if len(b) != ed25519.PrivateKeySize {
-			logger.Fatalf("Invalid private key size in %s: %d", privPath, len(b))
+			fatal(logger, "Invalid private key size", "path", privPath, "size", len(b))
 		}
 		priv = ed25519.PrivateKey(b)
 	} else {
-		logger.Fatalf("Failed to stat private key: %v", err)
+		fatal(logger, "Failed to stat private key", "path", privPath, "error", err)
 	}
 
 	// If private key was present (or generated above), ensure public key is stored in Broker CR
+	config.SigningKey = &broker.SigningKeyStatus{}
 	if priv != nil {
+		config.SigningKey.SetLoaded()
 		pub := priv.Public().(ed25519.PublicKey)
 		pubB64 := base64.StdEncoding.EncodeToString(pub)
 		brokerName := os.Getenv("BROKER_NAME")
@@ -172,39 +403,58 @@ func main() {
 			var brokerCR platformv1.Broker
 			ctx := context.Background()
 			if getErr := crClient.Get(ctx, crclient.ObjectKey{Namespace: brokerNS, Name: brokerName}, &brokerCR); getErr != nil {
-				logger.Printf("Failed to get Broker CR %s/%s: %v", brokerNS, brokerName, getErr)
+				logger.Error("Failed to get Broker CR", "namespace", brokerNS, "broker", brokerName, "error", getErr)
+				config.SigningKey.SetRegistered(fmt.Errorf("failed to get Broker CR %s/%s: %w", brokerNS, brokerName, getErr))
 			} else {
-				if brokerCR.Status.CallbackPublicKey != pubB64 {
-					brokerCR.Status.CallbackPublicKey = pubB64
+				// Keys this one replaced stay accepted so callbacks signed before
+				// a restart with a new key still verify
+				if brokerCR.Status.RotateCallbackPublicKey(pubB64) {
 					if upErr := crClient.Status().Update(ctx, &brokerCR); upErr != nil {
-						logger.Printf("Failed to update Broker CR status with public key: %v", upErr)
+						logger.Error("Failed to update Broker CR status with public key", "namespace", brokerNS, "broker", brokerName, "error", upErr)
+						config.SigningKey.SetRegistered(fmt.Errorf("failed to update Broker CR %s/%s: %w", brokerNS, brokerName, upErr))
 					} else {
-						logger.Printf("Updated broker public key in Broker CR %s/%s", brokerNS, brokerName)
+						logger.Info("Updated broker public key in Broker CR", "namespace", brokerNS, "broker", brokerName)
+						config.SigningKey.SetRegistered(nil)
 					}
+				} else {
+					config.SigningKey.SetRegistered(nil)
 				}
 			}
 		} else {
-			logger.Printf("BROKER_NAME not set; skipping Broker CR public key registration")
+			logger.Warn("BROKER_NAME not set; skipping Broker CR public key registration")
+			config.SigningKey.SetRegistered(fmt.Errorf("BROKER_NAME not set"))
 		}
 	}
 
 	// Create server
 	server := NewServer(config, logger, k8sClient)
+	if config.DeadLetters != nil {
+		go server.callbacks.RunDeadLetterReplayer(context.Background(), *deadLetterReplay)
+	}
+	server.resumePendingTasks(context.Background())
 
 	// Setup HTTP server
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", config.Port),
-		Handler:      server.router,
+		Handler:      server.handler(),
 		ReadTimeout:  config.ReadTimeout,
 		WriteTimeout: config.WriteTimeout,
 		IdleTimeout:  120 * time.Second,
+		TLSConfig:    tlsConfig,
 	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Printf("HTTP server listening on port %d", config.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Failed to start HTTP server: %v", err)
+		var err error
+		if config.TLSCertFile != "" {
+			logger.Info("HTTPS server listening", "port", config.Port, "tlsMinVersion", config.TLSMinVersion)
+			err = httpServer.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			logger.Info("HTTP server listening", "port", config.Port)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal(logger, "Failed to start HTTP server", "error", err)
 		}
 	}()
 
@@ -213,7 +463,10 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Println("Shutting down server...")
+	logger.Info("Shutting down server")
+
+	// Fail readiness so no new deployments are routed here while draining
+	server.worker.Stop()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
@@ -221,21 +474,73 @@ func main() {
 
 	// Attempt graceful shutdown
 	if err := httpServer.Shutdown(ctx); err != nil {
-		logger.Printf("Server forced to shutdown: %v", err)
+		logger.Error("Server forced to shutdown", "error", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
 	}
 
-	logger.Println("Server exited")
+	logger.Info("Server exited")
 }
 
 // NewServer creates a new broker server instance
-func NewServer(config *Config, logger *log.Logger, k8sClient *broker.K8sClient) *Server {
+func NewServer(config *Config, logger *slog.Logger, k8sClient *broker.K8sClient) *Server {
+	// Register a provisioner for each supported resource type
+	postgres := broker.NewPostgresProvisioner(k8sClient)
+	if config.ProvisionTimeout > 0 {
+		postgres.ReadyTimeout = config.ProvisionTimeout
+	}
+	provisioners := broker.NewProvisionerRegistry()
+	provisioners.Register(platformv1.ResourceTypeDatabase, &broker.EngineProvisioner{
+		Engines: map[string]broker.Provisioner{"postgresql": postgres},
+		Default: broker.StubDatabaseProvisioner{},
+	})
+	provisioners.Register(platformv1.ResourceTypeCache, broker.StubCacheProvisioner{})
+	provisioners.Register(platformv1.ResourceTypeTopic, broker.StubTopicProvisioner{})
+
+	capabilities := config.Capabilities
+	if capabilities == nil {
+		// An empty path can't fail to load
+		capabilities, _ = broker.NewCapabilityStore("")
+	}
+
+	signingKey := config.SigningKey
+	if signingKey == nil {
+		signingKey = &broker.SigningKeyStatus{}
+	}
+
+	registry := prometheus.NewRegistry()
+	metrics := broker.NewMetrics(registry)
+
+	callbacks := broker.NewCallbackClient(config.Callback)
+	callbacks.SetDeadLetterStore(config.DeadLetters)
+	callbacks.SetMetrics(metrics)
+
 	s := &Server{
-		config:    config,
-		router:    http.NewServeMux(),
-		logger:    logger,
-		k8sClient: k8sClient,
-		startTime: time.Now(),
+		config:       config,
+		router:       http.NewServeMux(),
+		logger:       logger,
+		k8sClient:    k8sClient,
+		provisioners: provisioners,
+		worker:       broker.NewWorker(provisioners, callbacks),
+		callbacks:    callbacks,
+		costs:        broker.NewStaticCostEstimator(),
+		capabilities: capabilities,
+		signingKey:   signingKey,
+		capacity:     broker.NewCapacityLimiter(config.MaxConcurrentDeployments),
+		teamLimiter:  broker.NewTeamLimiter(config.TeamMaxConcurrent, config.TeamLimits),
+		deployments:  broker.NewDeploymentTracker(),
+		audit:        broker.NewAuditLog(os.Stdout),
+		metrics:      metrics,
+		registry:     registry,
+		startTime:    time.Now(),
 	}
+	if config.PreProvisionHookURL != "" || config.PostProvisionHookURL != "" {
+		s.worker.SetHooks(broker.NewHooks(config.PreProvisionHookURL, config.PostProvisionHookURL, config.HookTimeout))
+	}
+	s.worker.SetConcurrency(config.WorkerConcurrency)
+	s.worker.SetTaskStore(config.PendingTasks)
+	s.registerCollectors()
 
 	// Register routes
 	s.registerRoutes()
@@ -248,12 +553,25 @@ func (s *Server) registerRoutes() {
 	// Health check
 	s.router.HandleFunc("/health", s.handleHealth)
 	s.router.HandleFunc("/readiness", s.handleReadiness)
+	s.router.Handle("/metrics", promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}))
 
 	// API v1 routes
 	s.router.HandleFunc("/v1/provision", s.handleProvision)
+	s.router.HandleFunc("/v1/reconfigure", s.handleReconfigure)
 	s.router.HandleFunc("/v1/deprovision", s.handleDeprovision)
+	s.router.HandleFunc("/v1/callback-url", s.handleCallbackURL)
+	s.router.HandleFunc("/v1/callback/replay", s.handleCallbackReplay)
+	s.router.HandleFunc("/v1/estimate", s.handleEstimate)
+	s.router.HandleFunc("/v1/snapshots", s.handleSnapshots)
+	s.router.HandleFunc("/v1/snapshots/{id}", s.handleSnapshot)
+	s.router.HandleFunc("/v1/capabilities", s.handleCapabilities)
+	s.router.HandleFunc("/v1/regions", s.handleRegions)
 	s.router.HandleFunc("/v1/status", s.handleStatus)
+	s.router.HandleFunc("/v1/deployments/{id}/connection", s.handleDeploymentConnection)
+	s.router.HandleFunc("/v1/deployments/{id}/logs", s.handleDeploymentLogs)
 	s.router.HandleFunc("/v1/resources", s.handleGetResources)
+	s.router.HandleFunc("/v1/inventory", s.handleInventory)
+	s.router.HandleFunc("/v1/diagnostics", s.handleDiagnostics)
 
 	// Root handler
 	s.router.HandleFunc("/", s.handleRoot)
@@ -267,61 +585,321 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	}
 
 	uptime := time.Since(s.startTime)
+	counts := s.deployments.Counts()
 
 	response := map[string]interface{}{
 		"status":            "healthy",
-		"version":           version,
+		"version":           version.Version,
 		"time":              time.Now().UTC().Format(time.RFC3339),
 		"uptime":            uptime.String(),
 		"uptimeSeconds":     int64(uptime.Seconds()),
-		"activeDeployments": 0, // TODO: Track active deployments
-		"totalDeployments":  0, // TODO: Track total deployments
-		"failedDeployments": 0, // TODO: Track failed deployments
+		"activeDeployments": counts.Active,
+		"totalDeployments":  counts.Total,
+		"failedDeployments": counts.Failed,
 	}
 
 	s.respondJSON(w, http.StatusOK, response)
 }
 
-// handleReadiness checks if broker is ready to accept requests
+// readinessGates lists the conditions the broker must meet before serving
+func (s *Server) readinessGates() []broker.ReadinessGate {
+	return []broker.ReadinessGate{
+		{Name: "kubernetes", Check: s.checkKubernetes},
+		{Name: "signing-key", Check: s.signingKey.Check},
+		{Name: "capabilities", Check: func(ctx context.Context) error { return s.capabilities.Err() }},
+		{Name: "worker", Check: s.worker.Ready},
+	}
+}
+
+// checkKubernetes is the Kubernetes API connectivity readiness gate
+func (s *Server) checkKubernetes(ctx context.Context) error {
+	if s.k8sClient == nil {
+		return fmt.Errorf("kubernetes client not initialized")
+	}
+	// Try to list namespaces as a health check
+	if _, err := s.k8sClient.Clientset().CoreV1().Namespaces().List(ctx, metav1.ListOptions{Limit: 1}); err != nil {
+		return fmt.Errorf("kubernetes API not accessible: %w", err)
+	}
+	return nil
+}
+
+// handleReadiness checks if broker is ready to accept requests, reporting
+// each readiness gate individually
 func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Check Kubernetes API connectivity
-	ready := true
-	reason := "ok"
-
-	if s.k8sClient != nil {
-		// Try to list namespaces as a health check
-		ctx := r.Context()
-		_, err := s.k8sClient.Clientset().CoreV1().Namespaces().List(ctx,
-			metav1.ListOptions{Limit: 1})
-		if err != nil {
-			ready = false
-			reason = fmt.Sprintf("kubernetes API not accessible: %v", err)
-			s.logger.Printf("Readiness check failed: %s", reason)
-		}
-	} else {
-		ready = false
-		reason = "kubernetes client not initialized"
-	}
+	ready, gates := broker.EvaluateGates(r.Context(), s.readinessGates())
 
 	status := http.StatusOK
+	reason := "ok"
 	if !ready {
 		status = http.StatusServiceUnavailable
+		reason = broker.FailedGatesReason(gates)
+		s.log(r.Context()).Warn("Readiness check failed", "reason", reason)
 	}
 
 	response := map[string]interface{}{
 		"ready":   ready,
 		"reason":  reason,
-		"version": version,
+		"gates":   gates,
+		"version": version.Version,
 	}
 
 	s.respondJSON(w, status, response)
 }
 
+// diagnosticChecks lists the checks run by the diagnostics endpoint. The
+// callback check probes sampleURL if given, otherwise a sample of the
+// callback URLs of in-flight deployments.
+func (s *Server) diagnosticChecks(sampleURL string) []broker.DiagnosticCheck {
+	return []broker.DiagnosticCheck{
+		{Name: "signing-key", Check: func(ctx context.Context) (string, error) {
+			if err := s.signingKey.Check(ctx); err != nil {
+				return "", err
+			}
+			return "loaded and registered on the Broker CR", nil
+		}},
+		{Name: "kubernetes", Check: func(ctx context.Context) (string, error) {
+			if err := s.checkKubernetes(ctx); err != nil {
+				return "", err
+			}
+			return "API reachable", nil
+		}},
+		{Name: "capabilities", Check: s.diagnoseCapabilities},
+		{Name: "callback-url", Check: func(ctx context.Context) (string, error) {
+			return s.diagnoseCallbacks(ctx, sampleURL)
+		}},
+		{Name: "worker", Check: func(ctx context.Context) (string, error) {
+			detail := fmt.Sprintf("%d deployment(s) in flight, %d queued, %d/%d capacity slots in use",
+				s.worker.InFlightCount(), s.worker.QueueLength(), s.capacity.Active(), s.capacity.Max())
+			return detail, s.worker.Ready(ctx)
+		}},
+	}
+}
+
+// diagnoseCapabilities checks that the capability config is valid and that
+// every advertised resource type has a provisioner to handle it
+func (s *Server) diagnoseCapabilities(ctx context.Context) (string, error) {
+	if err := s.capabilities.Err(); err != nil {
+		return "", err
+	}
+	caps := s.capabilities.Get()
+	var unhandled []string
+	for _, rc := range caps.ResourceTypes {
+		if _, ok := s.provisioners.Get(strings.ToLower(rc.Type)); !ok {
+			unhandled = append(unhandled, rc.Type)
+		}
+	}
+	detail := fmt.Sprintf("%d resource type(s) advertised", len(caps.ResourceTypes))
+	if len(unhandled) > 0 {
+		return detail, fmt.Errorf("no provisioner registered for advertised resource type(s): %s", strings.Join(unhandled, ", "))
+	}
+	return detail, nil
+}
+
+// diagnoseCallbacks checks that the manager's callback endpoint can be reached
+func (s *Server) diagnoseCallbacks(ctx context.Context, sampleURL string) (string, error) {
+	urls := s.worker.CallbackURLs(3)
+	if sampleURL != "" {
+		urls = []string{sampleURL}
+	}
+	if len(urls) == 0 {
+		return "no in-flight deployments to sample", nil
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	var unreachable []string
+	for _, u := range urls {
+		if err := broker.ProbeURL(ctx, client, u); err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s: %v", u, err))
+		}
+	}
+	detail := fmt.Sprintf("%d of %d callback URL(s) reachable", len(urls)-len(unreachable), len(urls))
+	if len(unreachable) > 0 {
+		return detail, fmt.Errorf("unreachable: %s", strings.Join(unreachable, "; "))
+	}
+	return detail, nil
+}
+
+// handleDiagnostics runs a one-shot self-test of the broker and returns a
+// structured report. It requires the diagnostics bearer token.
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeDiagnostics(w, r) {
+		return
+	}
+
+	report := broker.RunDiagnostics(r.Context(), 10*time.Second, s.diagnosticChecks(r.URL.Query().Get("callbackUrl")))
+	report.Version = version.Version
+	if report.Status != broker.DiagnosticsHealthy {
+		s.log(r.Context()).Warn("Diagnostics report unhealthy", "status", report.Status)
+	}
+
+	s.respondJSON(w, http.StatusOK, report)
+}
+
+// authorizeDiagnostics checks the request's bearer token against the
+// diagnostics token, writing an error response and returning false if it
+// does not match or no token is configured
+func (s *Server) authorizeDiagnostics(w http.ResponseWriter, r *http.Request) bool {
+	if s.config.DiagnosticsToken == "" {
+		s.respondJSON(w, http.StatusForbidden, broker.ErrorResponse{
+			Error:   "diagnostics_disabled",
+			Message: "Diagnostics are disabled; start the broker with --diagnostics-token-file to enable them",
+			Code:    http.StatusForbidden,
+		})
+		return false
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.DiagnosticsToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="kidp-broker"`)
+		s.respondJSON(w, http.StatusUnauthorized, broker.ErrorResponse{
+			Error:   "unauthorized",
+			Message: "A valid diagnostics bearer token is required",
+			Code:    http.StatusUnauthorized,
+		})
+		return false
+	}
+	return true
+}
+
+// diagnosticsTokenPath reports whether path is an operator endpoint, which
+// authorizeDiagnostics checks in place of the manager's credentials: the
+// diagnostics, callback replay and deployment connection and logs endpoints
+func diagnosticsTokenPath(path string) bool {
+	switch path {
+	case "/v1/diagnostics", "/v1/callback/replay":
+		return true
+	}
+	rest, ok := strings.CutPrefix(path, "/v1/deployments/")
+	if !ok {
+		return false
+	}
+	id, endpoint, ok := strings.Cut(rest, "/")
+	return ok && id != "" && (endpoint == "connection" || endpoint == "logs")
+}
+
+// maxSignedBodyBytes bounds the request body read to verify a signature
+const maxSignedBodyBytes = 1 << 20
+
+// signatureMaxAge and signatureMaxSkew bound how old, or how far in the
+// future, a signed request's timestamp may be
+const (
+	signatureMaxAge  = 5 * time.Minute
+	signatureMaxSkew = time.Minute
+)
+
+// loadManagerPublicKey reads the manager's base64 Ed25519 public key
+func loadManagerPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key size: %d", len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// withManagerAuth rejects /v1/ requests without a verified client
+// certificate when a client CA is configured, without the API key when one is
+// configured, and those that aren't signed by the manager when a manager
+// public key is configured. Operator endpoints have their own bearer token
+// and probes, metrics and the API index stay open.
+func (s *Server) withManagerAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/v1/") || diagnosticsTokenPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.config.TLSClientCAFile != "" && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			s.log(r.Context()).Warn("Rejected request without a client certificate", "path", r.URL.Path)
+			s.respondJSON(w, http.StatusUnauthorized, broker.ErrorResponse{
+				Error:   "unauthorized",
+				Message: "request must present a client certificate signed by the manager CA",
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+		if s.config.APIKey != "" {
+			key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(key), []byte(s.config.APIKey)) != 1 {
+				s.log(r.Context()).Warn("Rejected request without a valid API key", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="kidp-broker"`)
+				s.respondJSON(w, http.StatusUnauthorized, broker.ErrorResponse{
+					Error:   "unauthorized",
+					Message: "A valid API key bearer token is required",
+					Code:    http.StatusUnauthorized,
+				})
+				return
+			}
+		}
+		if s.config.ManagerPublicKey == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		if err != nil {
+			s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+				Error:   "invalid_request",
+				Message: fmt.Sprintf("Failed to read request body: %v", err),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		if err := s.verifyManagerSignature(r, body); err != nil {
+			s.log(r.Context()).Warn("Rejected unsigned or mis-signed request", "path", r.URL.Path, "error", err)
+			s.respondJSON(w, http.StatusUnauthorized, broker.ErrorResponse{
+				Error:   "unauthorized",
+				Message: err.Error(),
+				Code:    http.StatusUnauthorized,
+			})
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// verifyManagerSignature checks a request's timestamp and its signature by
+// the manager's key over brokerclient.SigningPayload
+func (s *Server) verifyManagerSignature(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(brokerclient.TimestampHeader)
+	signature := r.Header.Get(brokerclient.SignatureHeader)
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("request must be signed by the manager (%s and %s headers)", brokerclient.SignatureHeader, brokerclient.TimestampHeader)
+	}
+
+	ts, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", brokerclient.TimestampHeader, err)
+	}
+	if time.Since(ts) > signatureMaxAge || time.Until(ts) > signatureMaxSkew {
+		return fmt.Errorf("request timestamp %s is outside the allowed range", timestamp)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", brokerclient.SignatureHeader, err)
+	}
+	if !ed25519.Verify(s.config.ManagerPublicKey, brokerclient.SigningPayload(timestamp, r.Method, r.URL.RequestURI(), body), sig) {
+		return fmt.Errorf("request signature is not valid for the manager's key")
+	}
+	return nil
+}
+
 // handleProvision handles resource provisioning requests
 func (s *Server) handleProvision(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -329,12 +907,15 @@ func (s *Server) handleProvision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Printf("Received provision request from %s", r.RemoteAddr)
+	ctx, span := tracing.StartServerSpan(r, "broker.provision")
+	defer span.End()
+
+	s.log(ctx).Info("Received provision request")
 
 	// Parse request body
 	var req broker.ProvisionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.logger.Printf("Failed to decode provision request: %v", err)
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(ctx).Warn("Failed to decode provision request", "error", err)
 		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
 			Error:   "invalid_request",
 			Message: fmt.Sprintf("Failed to parse request body: %v", err),
@@ -343,9 +924,11 @@ func (s *Server) handleProvision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx = s.withLogAttrs(ctx, "resourceType", req.ResourceType, "resourceName", req.ResourceName, "namespace", req.Namespace)
+
 	// Validate request
 	if err := req.Validate(); err != nil {
-		s.logger.Printf("Invalid provision request: %v", err)
+		s.log(ctx).Warn("Invalid provision request", "error", err)
 		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
 			Error:   "validation_failed",
 			Message: err.Error(),
@@ -354,37 +937,57 @@ func (s *Server) handleProvision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !s.checkSupported(ctx, w, &req) || !s.acquireSlots(ctx, w, &req) {
+		return
+	}
+
 	// Generate deployment ID
-	deploymentID := generateDeploymentID()
-	s.logger.Printf("Created deployment %s for %s/%s in namespace %s",
-		deploymentID, req.ResourceType, req.ResourceName, req.Namespace)
+	deploymentID, err := s.deployments.NewDeploymentID()
+	if err != nil {
+		s.capacity.Release()
+		s.teamLimiter.Release(req.Team)
+		s.log(ctx).Error("Failed to allocate deployment ID", "error", err)
+		s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+			Error:   "deployment_id_unavailable",
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	ctx = s.withLogAttrs(ctx, "deploymentId", deploymentID)
+	s.log(ctx).Info("Created deployment", "workloadNamespace", req.WorkloadNamespace())
+
+	span.SetAttributes(attribute.String("kidp.deployment_id", deploymentID))
 
-	// TODO: Queue the provisioning task
-	// TODO: Start async provisioning in a goroutine
+	monthlyCost := s.startTask(ctx, deploymentID, req)
+	s.recordAudit(ctx, broker.NewAuditEvent(broker.AuditActionProvision, deploymentID, req))
 
 	// Return accepted response
 	response := broker.ProvisionResponse{
-		Status:       "accepted",
-		DeploymentID: deploymentID,
-		Message:      fmt.Sprintf("Provisioning request accepted for %s/%s", req.ResourceType, req.ResourceName),
+		Status:               "accepted",
+		DeploymentID:         deploymentID,
+		Message:              fmt.Sprintf("Provisioning request accepted for %s/%s", req.ResourceType, req.ResourceName),
+		EstimatedMonthlyCost: monthlyCost,
 	}
 
 	s.respondJSON(w, http.StatusAccepted, response)
 }
 
-// handleDeprovision handles resource deprovisioning requests
-func (s *Server) handleDeprovision(w http.ResponseWriter, r *http.Request) {
+// handleReconfigure applies a changed spec to a resource this broker already
+// provisioned. The provisioner re-runs against the existing deployment, so
+// its steps must be idempotent.
+func (s *Server) handleReconfigure(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	s.logger.Printf("Received deprovision request from %s", r.RemoteAddr)
+	ctx, span := tracing.StartServerSpan(r, "broker.reconfigure")
+	defer span.End()
 
-	// Parse request body
-	var req broker.DeprovisionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.logger.Printf("Failed to decode deprovision request: %v", err)
+	var req broker.ReconfigureRequest
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(ctx).Warn("Failed to decode reconfigure request", "error", err)
 		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
 			Error:   "invalid_request",
 			Message: fmt.Sprintf("Failed to parse request body: %v", err),
@@ -393,9 +996,11 @@ func (s *Server) handleDeprovision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate request
+	ctx = s.withLogAttrs(ctx, "deploymentId", req.DeploymentID, "resourceType", req.ResourceType,
+		"resourceName", req.ResourceName, "namespace", req.Namespace)
+
 	if err := req.Validate(); err != nil {
-		s.logger.Printf("Invalid deprovision request: %v", err)
+		s.log(ctx).Warn("Invalid reconfigure request", "error", err)
 		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
 			Error:   "validation_failed",
 			Message: err.Error(),
@@ -404,112 +1009,631 @@ func (s *Server) handleDeprovision(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.logger.Printf("Deprovisioning %s for deployment %s", req.ResourceName, req.DeploymentID)
-
-	// TODO: Queue the deprovisioning task
-	// TODO: Start async deprovisioning in a goroutine
-
-	// Return accepted response
-	response := broker.DeprovisionResponse{
-		Status:  "accepted",
-		Message: fmt.Sprintf("Deprovisioning request accepted for deployment %s", req.DeploymentID),
-	}
-
-	s.respondJSON(w, http.StatusAccepted, response)
-}
+	span.SetAttributes(attribute.String("kidp.deployment_id", req.DeploymentID))
 
-// handleStatus returns the status of a deployment
-func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	if s.worker.InFlight(req.DeploymentID) {
+		s.respondJSON(w, http.StatusConflict, broker.ErrorResponse{
+			Error:   "deployment_in_progress",
+			Message: fmt.Sprintf("Deployment %s is still in progress; retry once it completes", req.DeploymentID),
+			Code:    http.StatusConflict,
+		})
 		return
 	}
 
-	deploymentID := r.URL.Query().Get("id")
-	if deploymentID == "" {
-		http.Error(w, "Missing deployment ID", http.StatusBadRequest)
+	if !s.checkSupported(ctx, w, &req.ProvisionRequest) || !s.acquireSlots(ctx, w, &req.ProvisionRequest) {
 		return
 	}
 
-	s.logger.Printf("Status query for deployment: %s", deploymentID)
-
-	// TODO: Implement status lookup
-	response := map[string]interface{}{
-		"deploymentId": deploymentID,
-		"status":       "unknown",
-		"message":      "Status endpoint - implementation pending",
-	}
+	s.log(ctx).Info("Reconfiguring deployment")
+	monthlyCost := s.startTask(ctx, req.DeploymentID, req.ProvisionRequest)
+	s.recordAudit(ctx, broker.NewAuditEvent(broker.AuditActionReconfigure, req.DeploymentID, req.ProvisionRequest))
 
-	s.respondJSON(w, http.StatusOK, response)
+	s.respondJSON(w, http.StatusAccepted, broker.ProvisionResponse{
+		Status:               "accepted",
+		DeploymentID:         req.DeploymentID,
+		Message:              fmt.Sprintf("Reconfiguration request accepted for %s/%s", req.ResourceType, req.ResourceName),
+		EstimatedMonthlyCost: monthlyCost,
+	})
 }
 
-// handleGetResources returns the actual state of resources managed by this broker
-func (s *Server) handleGetResources(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet && r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// recordAudit appends to the audit trail; a failed write is logged but does
+// not fail the request
+func (s *Server) recordAudit(ctx context.Context, e broker.AuditEvent) {
+	if err := s.audit.Record(e); err != nil {
+		s.log(ctx).Error("Failed to record audit event", "deploymentId", e.DeploymentID, "error", err)
 	}
+}
 
-	var req broker.ResourceStateRequest
-
-	// Support both GET with query params and POST with JSON body
-	if r.Method == http.MethodGet {
-		req = broker.ResourceStateRequest{
-			Namespace:    r.URL.Query().Get("namespace"),
-			ResourceType: r.URL.Query().Get("resourceType"),
-			ResourceName: r.URL.Query().Get("resourceName"),
-			DeploymentID: r.URL.Query().Get("deploymentId"),
-		}
-	} else {
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			s.logger.Printf("Failed to decode resource state request: %v", err)
-			s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
-				Error:   "invalid_request",
-				Message: fmt.Sprintf("Failed to parse request body: %v", err),
-				Code:    http.StatusBadRequest,
-			})
-			return
-		}
+// checkSupported rejects resource types we have no provisioner for and
+// providers, regions and sizes this broker doesn't advertise, writing the
+// error response if so
+func (s *Server) checkSupported(ctx context.Context, w http.ResponseWriter, req *broker.ProvisionRequest) bool {
+	if _, ok := s.provisioners.Get(req.ResourceType); !ok {
+		s.log(ctx).Warn("Unsupported resource type in request")
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "unsupported_resource_type",
+			Message: fmt.Sprintf("No provisioner available for resource type %q", req.ResourceType),
+			Code:    http.StatusBadRequest,
+		})
+		return false
 	}
 
-	// Validate request
-	if err := req.Validate(); err != nil {
-		s.logger.Printf("Invalid resource state request: %v", err)
+	if err := s.capabilities.Get().ValidateRequest(req); err != nil {
+		s.log(ctx).Warn("Unsupported request", "error", err)
 		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
-			Error:   "validation_failed",
+			Error:   "unsupported_capability",
 			Message: err.Error(),
 			Code:    http.StatusBadRequest,
 		})
-		return
+		return false
 	}
+	return true
+}
 
-	s.logger.Printf("Resource state query for namespace: %s, type: %s, name: %s",
-		req.Namespace, req.ResourceType, req.ResourceName)
+// acquireSlots enforces broker capacity against the live in-flight count,
+// then the team's share of it, writing the error response if either is full.
+// startTask releases the slots when the task finishes.
+func (s *Server) acquireSlots(ctx context.Context, w http.ResponseWriter, req *broker.ProvisionRequest) bool {
+	if err := s.capacity.Acquire(); err != nil {
+		s.log(ctx).Warn("Rejecting request", "error", err)
+		s.metrics.ProvisionRejected(req.ResourceType)
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		s.respondJSON(w, http.StatusServiceUnavailable, broker.ErrorResponse{
+			Error:   "broker_at_capacity",
+			Message: err.Error(),
+			Code:    http.StatusServiceUnavailable,
+		})
+		return false
+	}
+	if err := s.teamLimiter.Acquire(req.Team); err != nil {
+		s.capacity.Release()
+		s.log(ctx).Warn("Rejecting request", "team", req.Team, "error", err)
+		s.metrics.ProvisionRejected(req.ResourceType)
+		w.Header().Set("Retry-After", retryAfterSeconds)
+		s.respondJSON(w, http.StatusTooManyRequests, broker.ErrorResponse{
+			Error:   "team_quota_exceeded",
+			Message: err.Error(),
+			Code:    http.StatusTooManyRequests,
+		})
+		return false
+	}
+	return true
+}
 
-	// TODO: Implement actual resource state lookup from Kubernetes
-	// For now, return a placeholder response
-	response := broker.ResourceStateResponse{
-		Resources: []broker.ResourceState{},
-		Total:     0,
-		Namespace: req.Namespace,
+// startTask prices the request and queues it on the worker, which runs it
+// asynchronously by priority; progress is reported through callbacks. The worker continues the request's trace so
+// callbacks can be correlated. It returns the estimated monthly cost, or 0 if
+// the request couldn't be priced, which shouldn't block provisioning.
+func (s *Server) startTask(ctx context.Context, deploymentID string, req broker.ProvisionRequest) float64 {
+	var monthlyCost float64
+	if estimate, err := s.costs.Estimate(ctx, req.ResourceType, req.Spec); err != nil {
+		s.log(ctx).Debug("No cost estimate", "error", err)
+	} else {
+		monthlyCost = estimate.MonthlyCost
 	}
 
-	s.respondJSON(w, http.StatusOK, response)
+	task := broker.ProvisionTask{DeploymentID: deploymentID, Request: req, EstimatedMonthlyCost: monthlyCost}
+	s.enqueueTask(tracing.Detach(ctx), s.log(ctx), task, func() {
+		s.capacity.Release()
+		s.teamLimiter.Release(req.Team)
+	})
+	return monthlyCost
 }
 
-// handleRoot handles requests to the root path
-// This provides a self-documenting API discovery endpoint following REST HATEOAS principles
-func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
+// enqueueTask queues a task on the worker and records its outcome, calling
+// release once it finishes
+func (s *Server) enqueueTask(ctx context.Context, logger *slog.Logger, task broker.ProvisionTask, release func()) {
+	accepted := time.Now()
+	s.deployments.Start()
+	s.worker.Enqueue(ctx, task, func(err error) {
+		defer release()
+		if err != nil {
+			logger.Error("Deployment failed", "error", err)
+		}
+		s.metrics.ProvisionFinished(task.Request.ResourceType, err, time.Since(accepted))
+		s.deployments.Finish(task.DeploymentID, err)
+	})
+}
+
+// resumePendingTasks queues the provisions left unfinished when the broker
+// last stopped, in the order they were first queued. They were admitted
+// before the restart, so they aren't rejected when the broker or a team is
+// at capacity; they only take the slots that are free.
+func (s *Server) resumePendingTasks(ctx context.Context) {
+	pending, err := s.worker.PendingTasks()
+	if err != nil {
+		s.logger.Error("Failed to read pending provisions", "error", err)
 		return
 	}
-
-	response := map[string]interface{}{
-		// Service metadata
-		"service":     "KIDP Deployment Broker",
+	for _, p := range pending {
+		task := p.Task()
+		team := task.Request.Team
+		capacityErr := s.capacity.Acquire()
+		teamErr := s.teamLimiter.Acquire(team)
+		logger := s.logger.With("deploymentId", task.DeploymentID)
+		logger.Info("Resuming provision", "resourceType", task.Request.ResourceType,
+			"resourceName", task.Request.ResourceName, "queuedAt", p.QueuedAt)
+		s.enqueueTask(ctx, logger, task, func() {
+			if capacityErr == nil {
+				s.capacity.Release()
+			}
+			if teamErr == nil {
+				s.teamLimiter.Release(team)
+			}
+		})
+	}
+}
+
+// handleCapabilities returns the resource types, providers, regions and sizes
+// this broker supports
+func (s *Server) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.respondJSON(w, http.StatusOK, s.capabilities.Get())
+}
+
+// handleRegions lists the supported regions per resource type and provider,
+// optionally filtered by the resourceType and provider query parameters
+func (s *Server) handleRegions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	s.respondJSON(w, http.StatusOK, broker.RegionsResponse{
+		Regions: s.capabilities.Get().Regions(q.Get("resourceType"), q.Get("provider")),
+	})
+}
+
+// handleEstimate prices a resource without provisioning it
+func (s *Server) handleEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req broker.EstimateRequest
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(r.Context()).Warn("Failed to decode estimate request", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Failed to parse request body: %v", err),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	estimate, err := s.costs.Estimate(r.Context(), req.ResourceType, req.Spec)
+	if err != nil {
+		s.respondJSON(w, http.StatusUnprocessableEntity, broker.ErrorResponse{
+			Error:   "estimate_unavailable",
+			Message: err.Error(),
+			Code:    http.StatusUnprocessableEntity,
+		})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, estimate)
+}
+
+// handleDeprovision handles resource deprovisioning requests
+func (s *Server) handleDeprovision(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, span := tracing.StartServerSpan(r, "broker.deprovision")
+	defer span.End()
+
+	s.log(ctx).Info("Received deprovision request")
+
+	// Parse request body
+	var req broker.DeprovisionRequest
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(ctx).Warn("Failed to decode deprovision request", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Failed to parse request body: %v", err),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	ctx = s.withLogAttrs(ctx, "deploymentId", req.DeploymentID, "resourceType", req.ResourceType,
+		"resourceName", req.ResourceName, "namespace", req.Namespace)
+
+	// Validate request
+	if err := req.Validate(); err != nil {
+		s.log(ctx).Warn("Invalid deprovision request", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	s.log(ctx).Info("Deprovisioning deployment")
+	s.recordAudit(ctx, broker.AuditEvent{
+		Action:       broker.AuditActionDeprovision,
+		DeploymentID: req.DeploymentID,
+		ResourceType: req.ResourceType,
+		ResourceName: req.ResourceName,
+		Namespace:    req.Namespace,
+	})
+
+	// Delete what the broker created for the deployment. Without a Kubernetes
+	// client only stub provisioners run, which create nothing.
+	if s.k8sClient != nil {
+		deleted, err := s.k8sClient.DeleteDeployment(ctx, req.WorkloadNamespace(), req.DeploymentID)
+		if err != nil {
+			s.log(ctx).Error("Failed to deprovision deployment", "error", err)
+			s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+				Error:   "deprovision_failed",
+				Message: fmt.Sprintf("Failed to delete deployment resources: %v", err),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		s.log(ctx).Info("Deleted deployment resources", "resources", deleted)
+	}
+
+	// Pods and other dependents are removed in the background
+	response := broker.DeprovisionResponse{
+		Status:  "accepted",
+		Message: fmt.Sprintf("Deprovisioning request accepted for deployment %s", req.DeploymentID),
+	}
+
+	s.respondJSON(w, http.StatusAccepted, response)
+}
+
+// handleCallbackURL changes the callback URL of an in-flight deployment so its
+// remaining callbacks reach the manager after its webhook service moves
+func (s *Server) handleCallbackURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req broker.CallbackURLUpdate
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(r.Context()).Warn("Failed to decode callback URL update", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Failed to parse request body: %v", err),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	if err := s.worker.UpdateCallbackURL(req.DeploymentID, req.CallbackURL); err != nil {
+		s.respondJSON(w, http.StatusNotFound, broker.ErrorResponse{
+			Error:   "deployment_not_found",
+			Message: fmt.Sprintf("Deployment %s is not in flight on this broker", req.DeploymentID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	s.log(r.Context()).Info("Updated callback URL", "deploymentId", req.DeploymentID, "callbackUrl", req.CallbackURL)
+	s.respondJSON(w, http.StatusOK, broker.CallbackURLUpdateResponse{
+		Status:       "updated",
+		DeploymentID: req.DeploymentID,
+		CallbackURL:  req.CallbackURL,
+	})
+}
+
+// handleCallbackReplay re-sends the last callback of a deployment, signed
+// like any other callback, for when the manager missed it. It waits for the
+// delivery so the operator sees whether it landed.
+func (s *Server) handleCallbackReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeDiagnostics(w, r) {
+		return
+	}
+
+	var req broker.CallbackReplayRequest
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Failed to parse request body: %v", err),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	callbackURL, payload, ok := s.worker.LastCallback(req.DeploymentID)
+	if !ok {
+		s.respondJSON(w, http.StatusNotFound, broker.ErrorResponse{
+			Error:   "deployment_not_found",
+			Message: fmt.Sprintf("Deployment %s has sent no callbacks from this broker", req.DeploymentID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	// A fresh nonce, so a manager that did see the original doesn't discard
+	// the replay as a duplicate
+	payload.Nonce = ""
+	s.log(r.Context()).Info("Replaying callback", "deploymentId", req.DeploymentID, "resourceType", payload.ResourceType,
+		"namespace", payload.Namespace, "status", payload.Status, "callbackUrl", callbackURL)
+	if err := s.callbacks.NotifyStatus(r.Context(), callbackURL, payload); err != nil {
+		s.respondJSON(w, http.StatusBadGateway, broker.ErrorResponse{
+			Error:   "callback_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadGateway,
+		})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, broker.CallbackReplayResponse{
+		Status:       "replayed",
+		DeploymentID: req.DeploymentID,
+		Phase:        payload.Phase,
+		CallbackURL:  callbackURL,
+	})
+}
+
+// handleStatus returns the status of a deployment
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deploymentID := r.URL.Query().Get("id")
+	if deploymentID == "" {
+		http.Error(w, "Missing deployment ID", http.StatusBadRequest)
+		return
+	}
+
+	s.log(r.Context()).Debug("Status query", "deploymentId", deploymentID)
+
+	status, ok := s.worker.Status(deploymentID)
+	if !ok {
+		s.respondJSON(w, http.StatusNotFound, broker.ErrorResponse{
+			Error:   "deployment_not_found",
+			Message: fmt.Sprintf("Deployment %s is not known to this broker", deploymentID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, status)
+}
+
+// handleDeploymentConnection returns a deployment's connection metadata
+// without its credentials. Like diagnostics, it requires the diagnostics
+// bearer token.
+func (s *Server) handleDeploymentConnection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeDiagnostics(w, r) {
+		return
+	}
+	if s.k8sClient == nil {
+		s.respondJSON(w, http.StatusServiceUnavailable, broker.ErrorResponse{
+			Error:   "kubernetes_unavailable",
+			Message: "The broker has no Kubernetes client to read connection details from",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+
+	deploymentID := r.PathValue("id")
+	details, err := s.k8sClient.DeploymentConnection(r.Context(), deploymentID)
+	if errors.Is(err, broker.ErrDeploymentNotFound) {
+		s.respondJSON(w, http.StatusNotFound, broker.ErrorResponse{
+			Error:   "deployment_not_found",
+			Message: fmt.Sprintf("Deployment %s has no connection details on this broker", deploymentID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+	if err != nil {
+		s.log(r.Context()).Error("Failed to look up connection details", "deploymentId", deploymentID, "error", err)
+		s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+			Error:   "lookup_failed",
+			Message: fmt.Sprintf("Failed to look up connection details: %v", err),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	s.respondJSON(w, http.StatusOK, details)
+}
+
+// handleDeploymentLogs returns the most recent provisioning log entries of a
+// deployment, limited by the limit query parameter
+func (s *Server) handleDeploymentLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorizeDiagnostics(w, r) {
+		return
+	}
+
+	limit := defaultDeploymentLogLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+				Error:   "invalid_request",
+				Message: fmt.Sprintf("limit must be a positive integer, got %q", v),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+		limit = min(n, broker.MaxDeploymentLogEntries)
+	}
+
+	deploymentID := r.PathValue("id")
+	if _, ok := s.worker.Status(deploymentID); !ok {
+		s.respondJSON(w, http.StatusNotFound, broker.ErrorResponse{
+			Error:   "deployment_not_found",
+			Message: fmt.Sprintf("Deployment %s has no logs on this broker", deploymentID),
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	entries, truncated := s.worker.Logs(deploymentID, limit)
+	s.respondJSON(w, http.StatusOK, broker.DeploymentLogsResponse{
+		DeploymentID: deploymentID,
+		Entries:      entries,
+		Truncated:    truncated,
+	})
+}
+
+// handleGetResources returns the actual state of resources managed by this broker
+func (s *Server) handleGetResources(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req broker.ResourceStateRequest
+
+	// Support both GET with query params and POST with JSON body
+	if r.Method == http.MethodGet {
+		req = broker.ResourceStateRequest{
+			Namespace:    r.URL.Query().Get("namespace"),
+			ResourceType: r.URL.Query().Get("resourceType"),
+			ResourceName: r.URL.Query().Get("resourceName"),
+			DeploymentID: r.URL.Query().Get("deploymentId"),
+		}
+	} else {
+		if err := broker.DecodeJSON(r.Body, &req); err != nil {
+			s.log(r.Context()).Warn("Failed to decode resource state request", "error", err)
+			s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+				Error:   "invalid_request",
+				Message: fmt.Sprintf("Failed to parse request body: %v", err),
+				Code:    http.StatusBadRequest,
+			})
+			return
+		}
+	}
+
+	// Validate request
+	if err := req.Validate(); err != nil {
+		s.log(r.Context()).Warn("Invalid resource state request", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	ctx := s.withLogAttrs(r.Context(), "namespace", req.Namespace, "resourceType", req.ResourceType,
+		"resourceName", req.ResourceName, "deploymentId", req.DeploymentID)
+	s.log(ctx).Info("Resource state query")
+
+	resources := []broker.ResourceState{}
+	if s.k8sClient != nil {
+		found, err := s.k8sClient.ListManagedResources(ctx, req)
+		if err != nil {
+			s.log(ctx).Error("Failed to look up resources", "error", err)
+			s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+				Error:   "lookup_failed",
+				Message: fmt.Sprintf("Failed to look up resources: %v", err),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		resources = append(resources, found...)
+	}
+
+	response := broker.ResourceStateResponse{
+		Resources: resources,
+		Total:     len(resources),
+		Namespace: req.Namespace,
+	}
+
+	s.respondJSON(w, http.StatusOK, response)
+}
+
+// handleInventory lists every deployment the broker has workloads for, so
+// the manager can cross-check them against its resources
+func (s *Server) handleInventory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.k8sClient == nil {
+		s.respondJSON(w, http.StatusServiceUnavailable, broker.ErrorResponse{
+			Error:   "kubernetes_unavailable",
+			Message: "The broker has no Kubernetes client to list deployments from",
+			Code:    http.StatusServiceUnavailable,
+		})
+		return
+	}
+
+	items, err := s.k8sClient.Inventory(r.Context())
+	if err != nil {
+		s.log(r.Context()).Error("Failed to list inventory", "error", err)
+		s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+			Error:   "lookup_failed",
+			Message: fmt.Sprintf("Failed to list deployments: %v", err),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	s.log(r.Context()).Debug("Inventory query", "deployments", len(items))
+	s.respondJSON(w, http.StatusOK, broker.InventoryResponse{Deployments: items, Total: len(items)})
+}
+
+// handleRoot handles requests to the root path
+// This provides a self-documenting API discovery endpoint following REST HATEOAS principles
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	advertised := s.capabilities.Get()
+
+	response := map[string]interface{}{
+		// Service metadata
+		"service":     "KIDP Deployment Broker",
 		"description": "Stateless broker for provisioning and managing resources in Kubernetes clusters",
-		"version":     version,
+		"version":     version.Version,
 		"status":      "running",
 
 		// Support information
@@ -519,8 +1643,7 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 
 		// Capabilities
 		"capabilities": map[string]interface{}{
-			"resourceTypes": []string{"database", "cache", "queue"},
-			"databases":     []string{"postgresql", "mysql", "mongodb", "redis"},
+			"resourceTypes": advertised.ResourceTypes,
 			"features":      []string{"drift-detection", "async-provisioning", "health-monitoring"},
 		},
 
@@ -535,8 +1658,13 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 			"readiness": map[string]interface{}{
 				"method":      "GET",
 				"path":        "/readiness",
-				"description": "Checks broker readiness (includes Kubernetes API connectivity)",
-				"response":    map[string]interface{}{"ready": true, "reason": "ok"},
+				"description": "Checks broker readiness gates: Kubernetes API connectivity, signing key, capabilities and worker",
+				"response":    map[string]interface{}{"ready": true, "reason": "ok", "gates": []map[string]interface{}{{"name": "kubernetes", "ready": true}}},
+			},
+			"metrics": map[string]interface{}{
+				"method":      "GET",
+				"path":        "/metrics",
+				"description": "Prometheus metrics: provision outcomes and durations, deployment and callback backlogs, and HTTP request durations",
 			},
 			"provision": map[string]interface{}{
 				"method":      "POST",
@@ -544,6 +1672,32 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 				"description": "Provision a new resource in the target Kubernetes cluster",
 				"contentType": "application/json",
 				"request": map[string]interface{}{
+					"resourceType":    "database",
+					"resourceName":    "my-db",
+					"namespace":       "team-platform",
+					"targetNamespace": "infra-databases",
+					"team":            "platform-team",
+					"owner":           "user@example.com",
+					"callbackUrl":     "http://manager:9090/v1/callback",
+					"spec": map[string]interface{}{
+						"engine":  "postgresql",
+						"version": "15",
+						"size":    "medium",
+					},
+				},
+				"response": map[string]string{
+					"status":       "accepted",
+					"deploymentId": "deploy-abc123",
+					"message":      "Provisioning request accepted",
+				},
+			},
+			"reconfigure": map[string]interface{}{
+				"method":      "POST",
+				"path":        "/v1/reconfigure",
+				"description": "Apply a changed spec to a resource this broker already provisioned",
+				"contentType": "application/json",
+				"request": map[string]interface{}{
+					"deploymentId": "deploy-abc123",
 					"resourceType": "database",
 					"resourceName": "my-db",
 					"namespace":    "team-platform",
@@ -551,15 +1705,17 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 					"owner":        "user@example.com",
 					"callbackUrl":  "http://manager:9090/v1/callback",
 					"spec": map[string]interface{}{
-						"engine":  "postgresql",
-						"version": "15",
-						"size":    "medium",
+						"engine":           "postgresql",
+						"version":          "15",
+						"size":             "medium",
+						"connectionLimit":  200,
+						"statementTimeout": "30s",
 					},
 				},
 				"response": map[string]string{
 					"status":       "accepted",
 					"deploymentId": "deploy-abc123",
-					"message":      "Provisioning request accepted",
+					"message":      "Reconfiguration request accepted",
 				},
 			},
 			"deprovision": map[string]interface{}{
@@ -579,6 +1735,85 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 					"message": "Deprovisioning request accepted",
 				},
 			},
+			"callbackUrl": map[string]interface{}{
+				"method":      "PATCH",
+				"path":        "/v1/callback-url",
+				"description": "Change the callback URL of an in-flight deployment",
+				"contentType": "application/json",
+				"request": map[string]string{
+					"deploymentId": "deploy-abc123",
+					"callbackUrl":  "http://manager.new-ns:9090/v1/callback",
+				},
+				"response": map[string]string{
+					"status":       "updated",
+					"deploymentId": "deploy-abc123",
+					"callbackUrl":  "http://manager.new-ns:9090/v1/callback",
+				},
+			},
+			"callbackReplay": map[string]interface{}{
+				"method":         "POST",
+				"path":           "/v1/callback/replay",
+				"description":    "Re-send the last status callback of a deployment the manager missed",
+				"authentication": "Bearer token (--diagnostics-token-file)",
+				"contentType":    "application/json",
+				"request": map[string]string{
+					"deploymentId": "deploy-abc123",
+				},
+			},
+			"capabilities": map[string]interface{}{
+				"method":      "GET",
+				"path":        "/v1/capabilities",
+				"description": "List the resource types, providers, regions and sizes this broker supports",
+			},
+			"regions": map[string]interface{}{
+				"method":      "GET",
+				"path":        "/v1/regions",
+				"description": "List supported regions per resource type and provider",
+				"parameters": map[string]string{
+					"resourceType": "filter by type (optional)",
+					"provider":     "filter by provider (optional)",
+				},
+				"example": "/v1/regions?resourceType=database&provider=postgresql",
+			},
+			"estimate": map[string]interface{}{
+				"method":      "POST",
+				"path":        "/v1/estimate",
+				"description": "Estimate the monthly cost of a resource without provisioning it",
+				"contentType": "application/json",
+				"request": map[string]interface{}{
+					"resourceType": "database",
+					"spec":         map[string]interface{}{"engine": "postgresql", "size": "medium"},
+				},
+				"response": map[string]interface{}{"monthlyCost": 105.0, "currency": "USD"},
+			},
+			"snapshot": map[string]interface{}{
+				"method":      "POST",
+				"path":        "/v1/snapshots",
+				"description": "Take a named snapshot of a provisioned resource",
+				"contentType": "application/json",
+				"request": map[string]string{
+					"deploymentId": "deploy-abc123",
+					"resourceType": "database",
+					"engine":       "postgresql",
+					"name":         "release-1.4",
+				},
+				"response": map[string]string{
+					"snapshotId": "snap-0f3a9c1e2b4d5e6f",
+					"name":       "release-1.4",
+					"status":     "pending",
+				},
+			},
+			"snapshotStatus": map[string]interface{}{
+				"method":      "GET",
+				"path":        "/v1/snapshots/{id}",
+				"description": "Get the progress of a snapshot",
+				"parameters": map[string]string{
+					"deploymentId": "deployment the snapshot was taken of (required)",
+					"resourceType": "resource type of the deployment (required)",
+					"engine":       "database engine (databases only)",
+				},
+				"example": "/v1/snapshots/snap-0f3a9c1e2b4d5e6f?deploymentId=deploy-abc123&resourceType=database&engine=postgresql",
+			},
 			"status": map[string]interface{}{
 				"method":      "GET",
 				"path":        "/v1/status",
@@ -607,6 +1842,38 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 					"cost-tracking",
 				},
 			},
+			"inventory": map[string]interface{}{
+				"method":      "GET",
+				"path":        "/v1/inventory",
+				"description": "Every deployment the broker has workloads for, with its resource and phase",
+				"response":    map[string]string{"deployments": "[{deploymentId, resourceType, resourceName, namespace, phase}]"},
+			},
+			"connection": map[string]interface{}{
+				"method":         "GET",
+				"path":           "/v1/deployments/{id}/connection",
+				"description":    "Connection metadata (host, port, database) of a deployment, without credentials",
+				"authentication": "Bearer token (--diagnostics-token-file)",
+				"example":        "/v1/deployments/deploy-abc123/connection",
+			},
+			"logs": map[string]interface{}{
+				"method":         "GET",
+				"path":           "/v1/deployments/{id}/logs",
+				"description":    "Most recent provisioning log entries of a deployment, kept in memory since the broker started",
+				"authentication": "Bearer token (--diagnostics-token-file)",
+				"parameters": map[string]string{
+					"limit": "maximum number of entries, newest kept (optional, default 100, at most 200)",
+				},
+				"example": "/v1/deployments/deploy-abc123/logs?limit=50",
+			},
+			"diagnostics": map[string]interface{}{
+				"method":         "GET",
+				"path":           "/v1/diagnostics",
+				"description":    "Self-test of the signing key, Kubernetes, capabilities, callback reachability and worker pool",
+				"authentication": "Bearer token (--diagnostics-token-file)",
+				"parameters": map[string]string{
+					"callbackUrl": "callback URL to probe instead of sampling in-flight deployments (optional)",
+				},
+			},
 		},
 
 		// Hypermedia links (HATEOAS)
@@ -623,18 +1890,66 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 				"href":   "/readiness",
 				"method": "GET",
 			},
+			"metrics": map[string]string{
+				"href":   "/metrics",
+				"method": "GET",
+			},
 			"provision": map[string]string{
 				"href":   "/v1/provision",
 				"method": "POST",
 			},
+			"reconfigure": map[string]string{
+				"href":   "/v1/reconfigure",
+				"method": "POST",
+			},
 			"deprovision": map[string]string{
 				"href":   "/v1/deprovision",
 				"method": "POST",
 			},
+			"estimate": map[string]string{
+				"href":   "/v1/estimate",
+				"method": "POST",
+			},
+			"callbackUrl": map[string]string{
+				"href":   "/v1/callback-url",
+				"method": "PATCH",
+			},
+			"snapshots": map[string]string{
+				"href":   "/v1/snapshots",
+				"method": "POST",
+			},
+			"callbackReplay": map[string]string{
+				"href":   "/v1/callback/replay",
+				"method": "POST",
+			},
+			"capabilities": map[string]string{
+				"href":   "/v1/capabilities",
+				"method": "GET",
+			},
+			"regions": map[string]string{
+				"href":   "/v1/regions",
+				"method": "GET",
+			},
 			"resources": map[string]string{
 				"href":    "/v1/resources",
 				"methods": "GET, POST",
 			},
+			"inventory": map[string]string{
+				"href":   "/v1/inventory",
+				"method": "GET",
+			},
+			"connection": map[string]string{
+				"href":   "/v1/deployments/{id}/connection",
+				"method": "GET",
+			},
+			"logs": map[string]string{
+				"href":   "/v1/deployments/{id}/logs",
+				"method": "GET",
+			},
+			"diagnostics": map[string]string{
+				"href":   "/v1/diagnostics",
+				"method": "GET",
+			},
 		},
 
 		// API versioning and compatibility
@@ -660,16 +1975,6 @@ func (s *Server) respondJSON(w http.ResponseWriter, status int, data interface{}
 	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		s.logger.Printf("Error encoding JSON response: %v", err)
-	}
-}
-
-// generateDeploymentID creates a unique deployment identifier
-func generateDeploymentID() string {
-	b := make([]byte, 16)
-	if _, err := rand.Read(b); err != nil {
-		// Fallback to timestamp-based ID if crypto/rand fails
-		return fmt.Sprintf("deploy-%d", time.Now().UnixNano())
+		s.logger.Error("Error encoding JSON response", "error", err)
 	}
-	return fmt.Sprintf("deploy-%s", hex.EncodeToString(b))
 }
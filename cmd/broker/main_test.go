@@ -0,0 +1,1147 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"github.com/aykay76/kidp/pkg/broker"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// blockingProvisioner holds every deployment open until release is closed
+type blockingProvisioner struct {
+	release chan struct{}
+}
+
+func (p *blockingProvisioner) Provision(ctx context.Context, task broker.ProvisionTask, progress broker.ProgressFunc) error {
+	<-p.release
+	return nil
+}
+
+func newTestServer(t *testing.T, config *Config) (*Server, *blockingProvisioner) {
+	t.Helper()
+	s := NewServer(config, slog.New(slog.NewTextHandler(io.Discard, nil)), broker.NewK8sClientForClientset(fake.NewSimpleClientset()))
+
+	p := &blockingProvisioner{release: make(chan struct{})}
+	t.Cleanup(func() { close(p.release) })
+	s.provisioners.Register("database", p)
+	s.worker = broker.NewWorker(s.provisioners, nil)
+	s.audit = broker.NewAuditLog(io.Discard)
+	return s, p
+}
+
+func provisionBody(team, name string) string {
+	return `{"resourceType":"database","resourceName":"` + name + `","namespace":"team-ns","team":"` + team +
+		`","owner":"alice","callbackUrl":"http://manager/v1/callback","spec":{"engine":"postgresql"}}`
+}
+
+func postProvision(s *Server, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/provision", strings.NewReader(body)))
+	return rec
+}
+
+func TestHandleProvision_TeamQuota(t *testing.T) {
+	s, _ := newTestServer(t, &Config{TeamMaxConcurrent: 1, TeamLimits: map[string]int{"team-b": 2}})
+
+	if rec := postProvision(s, provisionBody("team-a", "db1")); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected first team-a request to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := postProvision(s, provisionBody("team-a", "db2"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected team-a to be throttled, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header on throttled response")
+	}
+	if !strings.Contains(rec.Body.String(), "team_quota_exceeded") {
+		t.Fatalf("expected team_quota_exceeded error, got %s", rec.Body)
+	}
+
+	// team-b has a larger share and is unaffected by team-a's usage
+	for _, name := range []string{"db3", "db4"} {
+		if rec := postProvision(s, provisionBody("team-b", name)); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected team-b request %s to be accepted, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestHandleProvision_BrokerCapacity(t *testing.T) {
+	s, p := newTestServer(t, &Config{MaxConcurrentDeployments: 2})
+
+	for _, name := range []string{"db1", "db2"} {
+		if rec := postProvision(s, provisionBody("team-"+name, name)); rec.Code != http.StatusAccepted {
+			t.Fatalf("expected %s to be accepted, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	rec := postProvision(s, provisionBody("team-c", "db3"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once the broker is at capacity, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header on 503 response")
+	}
+	if !strings.Contains(rec.Body.String(), "broker_at_capacity") {
+		t.Fatalf("expected broker_at_capacity error, got %s", rec.Body)
+	}
+
+	// Finishing a deployment frees its slot
+	p.release <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.capacity.Active() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a slot to be released, %d still active", s.capacity.Active())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec := postProvision(s, provisionBody("team-c", "db3")); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected provision to be accepted after capacity freed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleProvision_TeamRejectionReleasesCapacity(t *testing.T) {
+	s, _ := newTestServer(t, &Config{MaxConcurrentDeployments: 5, TeamMaxConcurrent: 1})
+
+	postProvision(s, provisionBody("team-a", "db1"))
+	if rec := postProvision(s, provisionBody("team-a", "db2")); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected team quota rejection, got %d", rec.Code)
+	}
+	if got := s.capacity.Active(); got != 1 {
+		t.Fatalf("expected a team-rejected request not to hold broker capacity, got %d active", got)
+	}
+}
+
+func TestHandleEstimate(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/estimate", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"resourceType":"database","spec":{"engine":"postgresql","size":"medium"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var estimate broker.CostEstimate
+	if err := json.Unmarshal(rec.Body.Bytes(), &estimate); err != nil {
+		t.Fatalf("failed to decode estimate: %v", err)
+	}
+	if estimate.MonthlyCost != 105 || len(estimate.Breakdown) == 0 {
+		t.Fatalf("unexpected estimate: %+v", estimate)
+	}
+
+	if rec := post(`{"resourceType":"database","spec":{"engine":"oracle","size":"medium"}}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for unpriced engine, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleProvision_ReportsEstimatedCost(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+
+	body := `{"resourceType":"database","resourceName":"db1","namespace":"team-ns","team":"team-a",` +
+		`"owner":"alice","callbackUrl":"http://manager/v1/callback","spec":{"engine":"postgresql","size":"small"}}`
+	rec := postProvision(s, body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.ProvisionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.EstimatedMonthlyCost != 26 {
+		t.Fatalf("expected estimated cost 26, got %v", resp.EstimatedMonthlyCost)
+	}
+
+	// Requests the estimator can't price are still accepted
+	if rec := postProvision(s, provisionBody("team-a", "db2")); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected unpriced request to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleCapabilities_FromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capabilities.yaml")
+	data := "resourceTypes:\n- type: database\n  providers: [postgresql]\n  sizes:\n    small: {cpu: \"1\"}\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := broker.NewCapabilityStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := newTestServer(t, &Config{Capabilities: store})
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/capabilities", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var caps broker.Capabilities
+	if err := json.Unmarshal(rec.Body.Bytes(), &caps); err != nil {
+		t.Fatalf("failed to decode capabilities: %v", err)
+	}
+	if len(caps.ResourceTypes) != 1 || caps.ResourceTypes[0].Providers[0] != "postgresql" {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+
+	body := `{"resourceType":"database","resourceName":"db1","namespace":"team-ns","team":"team-a",` +
+		`"owner":"alice","callbackUrl":"http://manager/v1/callback","spec":{"engine":"mysql"}}`
+	rec = postProvision(s, body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "unsupported_capability") {
+		t.Fatalf("expected unsupported engine to be rejected, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := postProvision(s, provisionBody("team-a", "db2")); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected advertised engine to be accepted, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleRegions(t *testing.T) {
+	caps, err := broker.ParseCapabilities([]byte("resourceTypes:\n- type: database\n  providers: [postgresql, mysql]\n  regions: [eastus]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "capabilities.yaml")
+	data, _ := json.Marshal(caps)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := broker.NewCapabilityStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := newTestServer(t, &Config{Capabilities: store})
+
+	get := func(url string) broker.RegionsResponse {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200 from %s, got %d", url, rec.Code)
+		}
+		var resp broker.RegionsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode regions: %v", err)
+		}
+		return resp
+	}
+
+	if all := get("/v1/regions"); len(all.Regions) != 2 {
+		t.Fatalf("expected regions for both providers, got %+v", all)
+	}
+	filtered := get("/v1/regions?resourceType=database&provider=mysql")
+	if len(filtered.Regions) != 1 || filtered.Regions[0].Provider != "mysql" || filtered.Regions[0].Regions[0] != "eastus" {
+		t.Fatalf("unexpected filtered regions: %+v", filtered)
+	}
+	if none := get("/v1/regions?resourceType=cache"); none.Regions == nil || len(none.Regions) != 0 {
+		t.Fatalf("expected an empty list for an unsupported type, got %+v", none)
+	}
+}
+
+func TestHandleCallbackURL(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+
+	rec := postProvision(s, provisionBody("team-a", "db1"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var provisioned broker.ProvisionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &provisioned); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/v1/callback-url", strings.NewReader(body)))
+		return rec
+	}
+
+	rec = patch(`{"deploymentId":"` + provisioned.DeploymentID + `","callbackUrl":"http://manager.new-ns:9090/v1/callback"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for an in-flight deployment, got %d: %s", rec.Code, rec.Body)
+	}
+	var updated broker.CallbackURLUpdateResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if updated.Status != "updated" || updated.CallbackURL != "http://manager.new-ns:9090/v1/callback" {
+		t.Fatalf("unexpected response: %+v", updated)
+	}
+
+	if rec := patch(`{"deploymentId":"deploy-unknown","callbackUrl":"http://manager.new-ns:9090/v1/callback"}`); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown deployment, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := patch(`{"deploymentId":"` + provisioned.DeploymentID + `","callbackUrl":"manager/v1/callback"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a relative callback URL, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleReadiness_Gates(t *testing.T) {
+	tests := []struct {
+		name     string
+		gate     string
+		breakIt  func(t *testing.T, s *Server)
+		contains string
+	}{
+		{
+			name: "kubernetes unreachable",
+			gate: "kubernetes",
+			breakIt: func(t *testing.T, s *Server) {
+				cs := fake.NewSimpleClientset()
+				cs.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+				s.k8sClient = broker.NewK8sClientForClientset(cs)
+			},
+			contains: "connection refused",
+		},
+		{
+			name:     "signing key not loaded",
+			gate:     "signing-key",
+			breakIt:  func(t *testing.T, s *Server) { s.signingKey = &broker.SigningKeyStatus{} },
+			contains: "not loaded",
+		},
+		{
+			name: "signing key not registered",
+			gate: "signing-key",
+			breakIt: func(t *testing.T, s *Server) {
+				s.signingKey.SetRegistered(errors.New("broker CR not found"))
+			},
+			contains: "broker CR not found",
+		},
+		{
+			name: "capabilities invalid",
+			gate: "capabilities",
+			breakIt: func(t *testing.T, s *Server) {
+				path := filepath.Join(t.TempDir(), "capabilities.yaml")
+				if err := os.WriteFile(path, []byte("resourceTypes:\n- type: database\n  providers: [postgresql]\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				store, err := broker.NewCapabilityStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("resourceTypes: []\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := store.Reload(); err == nil {
+					t.Fatal("expected reload of an empty capabilities file to fail")
+				}
+				s.capabilities = store
+			},
+			contains: "at least one resource type",
+		},
+		{
+			name:     "worker stopped",
+			gate:     "worker",
+			breakIt:  func(t *testing.T, s *Server) { s.worker.Stop() },
+			contains: "worker stopped",
+		},
+		{
+			name: "no provisioners",
+			gate: "worker",
+			breakIt: func(t *testing.T, s *Server) {
+				s.worker = broker.NewWorker(broker.NewProvisionerRegistry(), nil)
+			},
+			contains: "no provisioners",
+		},
+	}
+
+	readiness := func(s *Server) (int, map[string]broker.GateResult, string) {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readiness", nil))
+		var resp struct {
+			Reason string              `json:"reason"`
+			Gates  []broker.GateResult `json:"gates"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to decode readiness: %v", err)
+		}
+		gates := make(map[string]broker.GateResult)
+		for _, g := range resp.Gates {
+			gates[g.Name] = g
+		}
+		return rec.Code, gates, resp.Reason
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signingKey := &broker.SigningKeyStatus{}
+			signingKey.SetLoaded()
+			signingKey.SetRegistered(nil)
+			s, _ := newTestServer(t, &Config{SigningKey: signingKey})
+
+			if code, gates, _ := readiness(s); code != http.StatusOK || len(gates) != 4 {
+				t.Fatalf("expected all four gates to pass before breaking one, got %d: %+v", code, gates)
+			}
+
+			tt.breakIt(t, s)
+			code, gates, reason := readiness(s)
+			if code != http.StatusServiceUnavailable {
+				t.Fatalf("expected 503, got %d", code)
+			}
+			for name, g := range gates {
+				if name == tt.gate {
+					if g.Ready || !strings.Contains(g.Reason, tt.contains) {
+						t.Fatalf("expected gate %s to fail with %q, got %+v", name, tt.contains, g)
+					}
+				} else if !g.Ready {
+					t.Fatalf("expected only gate %s to fail, but %s failed: %s", tt.gate, name, g.Reason)
+				}
+			}
+			if !strings.HasPrefix(reason, tt.gate+": ") {
+				t.Fatalf("expected reason to name the failed gate, got %q", reason)
+			}
+		})
+	}
+}
+
+func TestHandleReconfigure(t *testing.T) {
+	s, p := newTestServer(t, &Config{})
+
+	reconfigure := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/reconfigure", strings.NewReader(body)))
+		return rec
+	}
+	reconfigureBody := func(deploymentID string) string {
+		return `{"deploymentId":"` + deploymentID + `","resourceType":"database","resourceName":"db1","namespace":"team-ns",` +
+			`"team":"team-a","owner":"alice","callbackUrl":"http://manager/v1/callback",` +
+			`"spec":{"engine":"postgresql","connectionLimit":200,"statementTimeout":"30s"}}`
+	}
+
+	if rec := reconfigure(reconfigureBody("")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a deploymentId, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := reconfigure(reconfigureBody("deploy-existing"))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.ProvisionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.DeploymentID != "deploy-existing" {
+		t.Fatalf("expected reconfiguration to keep the deployment ID, got %s", resp.DeploymentID)
+	}
+	if s.capacity.Active() != 1 {
+		t.Fatalf("expected reconfiguration to hold a capacity slot, got %d active", s.capacity.Active())
+	}
+
+	// A second change can't be applied while the first is still running
+	if rec := reconfigure(reconfigureBody("deploy-existing")); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while the deployment is in progress, got %d: %s", rec.Code, rec.Body)
+	}
+
+	p.release <- struct{}{}
+	deadline := time.Now().Add(2 * time.Second)
+	for s.worker.InFlight("deploy-existing") {
+		if time.Now().After(deadline) {
+			t.Fatalf("reconfiguration did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec := reconfigure(reconfigureBody("deploy-existing")); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected a new reconfiguration to be accepted once the first finished, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleProvision_AuditsSource(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+	var audit bytes.Buffer
+	s.audit = broker.NewAuditLog(&audit)
+
+	body := `{"resourceType":"database","resourceName":"db1","namespace":"team-ns","team":"team-a","owner":"alice",` +
+		`"callbackUrl":"http://manager/v1/callback","spec":{"engine":"postgresql"},` +
+		`"source":{"repository":"https://github.com/acme/platform","revision":"4f2c1ab","application":"payments"}}`
+	rec := postProvision(s, body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.ProvisionResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	var e broker.AuditEvent
+	if err := json.Unmarshal(audit.Bytes(), &e); err != nil {
+		t.Fatalf("failed to decode audit entry %q: %v", audit.String(), err)
+	}
+	if e.Action != broker.AuditActionProvision || e.DeploymentID != resp.DeploymentID {
+		t.Fatalf("expected a provision audit entry for %s, got %+v", resp.DeploymentID, e)
+	}
+	if e.Source == nil || e.Source.Repository != "https://github.com/acme/platform" || e.Source.Application != "payments" {
+		t.Fatalf("expected the request source in the audit entry, got %+v", e.Source)
+	}
+}
+
+// outcomeProvisioner fails deployments whose resource name starts with "fail"
+type outcomeProvisioner struct{}
+
+func (outcomeProvisioner) Provision(ctx context.Context, task broker.ProvisionTask, progress broker.ProgressFunc) error {
+	if strings.HasPrefix(task.Request.ResourceName, "fail") {
+		return errors.New("provisioning failed")
+	}
+	return nil
+}
+
+func TestHandleHealth_DeploymentCounts(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+	s.provisioners.Register("database", outcomeProvisioner{})
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("db%d", i)
+		if i%4 == 0 {
+			name = "fail" + name
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec := postProvision(s, provisionBody("team-a", name)); rec.Code != http.StatusAccepted {
+				t.Errorf("expected %s to be accepted, got %d: %s", name, rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var health map[string]interface{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil {
+			t.Fatalf("failed to decode health response: %v", err)
+		}
+		if health["activeDeployments"] == float64(0) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := map[string]float64{"activeDeployments": 0, "totalDeployments": n, "failedDeployments": n / 4}
+	for k, v := range want {
+		if health[k] != v {
+			t.Fatalf("expected %s=%v, got %v", k, v, health[k])
+		}
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+	getStatus := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/status?id="+id, nil))
+		return rec
+	}
+	provision := func(name string) string {
+		rec := postProvision(s, provisionBody("team-a", name))
+		var resp broker.ProvisionResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusAccepted {
+			t.Fatalf("expected %s to be accepted, got %d: %s", name, rec.Code, rec.Body)
+		}
+		return resp.DeploymentID
+	}
+
+	// The blocking provisioner holds the first deployment in progress
+	inProgress := provision("db1")
+	rec := getStatus(inProgress)
+	var status broker.StatusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a status, got %d: %s", rec.Code, rec.Body)
+	}
+	if status.DeploymentID != inProgress || status.Phase != "Pending" || status.LastUpdated.IsZero() {
+		t.Fatalf("expected the in-progress deployment to be Pending, got %+v", status)
+	}
+
+	s.provisioners.Register("database", outcomeProvisioner{})
+	completed := provision("db2")
+	deadline := time.Now().Add(5 * time.Second)
+	for status.Phase != "Ready" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if err := json.Unmarshal(getStatus(completed).Body.Bytes(), &status); err != nil {
+			t.Fatalf("failed to decode status: %v", err)
+		}
+	}
+	if status.DeploymentID != completed || status.Phase != "Ready" {
+		t.Fatalf("expected the completed deployment to be Ready, got %+v", status)
+	}
+
+	rec = getStatus("deploy-unknown")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "deployment_not_found") {
+		t.Fatalf("expected 404 deployment_not_found, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleDiagnostics(t *testing.T) {
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer manager.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	diagnostics := func(s *Server, token, query string) (int, broker.DiagnosticsReport) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/diagnostics"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(rec, req)
+		var report broker.DiagnosticsReport
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+		}
+		return rec.Code, report
+	}
+	newServer := func(t *testing.T) *Server {
+		signingKey := &broker.SigningKeyStatus{}
+		signingKey.SetLoaded()
+		signingKey.SetRegistered(nil)
+		s, _ := newTestServer(t, &Config{SigningKey: signingKey, DiagnosticsToken: "s3cret"})
+		return s
+	}
+
+	t.Run("authentication", func(t *testing.T) {
+		s, _ := newTestServer(t, &Config{})
+		if code, _ := diagnostics(s, "s3cret", ""); code != http.StatusForbidden {
+			t.Fatalf("expected 403 when no token is configured, got %d", code)
+		}
+		s = newServer(t)
+		if code, _ := diagnostics(s, "", ""); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 without a token, got %d", code)
+		}
+		if code, _ := diagnostics(s, "wrong", ""); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 with the wrong token, got %d", code)
+		}
+	})
+
+	t.Run("healthy", func(t *testing.T) {
+		s := newServer(t)
+		code, report := diagnostics(s, "s3cret", "?callbackUrl="+manager.URL+"/v1/callback")
+		if code != http.StatusOK || report.Status != broker.DiagnosticsHealthy {
+			t.Fatalf("expected a healthy report, got %d: %+v", code, report)
+		}
+		if len(report.Checks) != 5 {
+			t.Fatalf("expected five checks, got %+v", report.Checks)
+		}
+		for _, c := range report.Checks {
+			if !c.Healthy || c.Detail == "" {
+				t.Fatalf("expected check %s to pass with a detail, got %+v", c.Name, c)
+			}
+		}
+	})
+
+	t.Run("degraded", func(t *testing.T) {
+		s := newServer(t)
+		cs := fake.NewSimpleClientset()
+		cs.PrependReactor("list", "namespaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+		s.k8sClient = broker.NewK8sClientForClientset(cs)
+		s.provisioners = broker.NewProvisionerRegistry()
+		s.provisioners.Register("database", broker.StubDatabaseProvisioner{})
+		// A deployment in flight gives the callback check a URL to sample
+		s.worker = broker.NewWorker(s.provisioners, nil)
+		s.worker.Track(broker.ProvisionTask{DeploymentID: "deploy-1", Request: broker.ProvisionRequest{CallbackURL: closed.URL}})
+
+		code, report := diagnostics(s, "s3cret", "")
+		if code != http.StatusOK || report.Status != broker.DiagnosticsDegraded {
+			t.Fatalf("expected a degraded report, got %d: %+v", code, report)
+		}
+		wantFailed := map[string]string{
+			"kubernetes":   "connection refused",
+			"capabilities": "cache",
+			"callback-url": closed.URL,
+		}
+		for _, c := range report.Checks {
+			want, shouldFail := wantFailed[c.Name]
+			if c.Healthy == shouldFail {
+				t.Fatalf("expected check %s healthy=%v, got %+v", c.Name, !shouldFail, c)
+			}
+			if shouldFail && !strings.Contains(c.Error, want) {
+				t.Fatalf("expected check %s to report %q, got %q", c.Name, want, c.Error)
+			}
+		}
+	})
+}
+
+func TestHandleDeploymentConnection(t *testing.T) {
+	s, _ := newTestServer(t, &Config{DiagnosticsToken: "s3cret"})
+	s.k8sClient = broker.NewK8sClientForClientset(fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orders-db-credentials",
+			Namespace: "team-a",
+			Labels:    map[string]string{broker.LabelDeploymentID: "deploy-1"},
+		},
+		Data: map[string][]byte{
+			"host":     []byte("orders-db.team-a.svc.cluster.local"),
+			"port":     []byte("5432"),
+			"database": []byte("orders"),
+			"username": []byte("orders"),
+			"password": []byte("hunter2"),
+		},
+	}))
+
+	connection := func(id, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/deployments/"+id+"/connection", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := connection("deploy-1", "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "hunter2") {
+		t.Fatalf("expected credentials to stay out of the response, got %s", rec.Body)
+	}
+	var details broker.ConnectionDetails
+	if err := json.Unmarshal(rec.Body.Bytes(), &details); err != nil {
+		t.Fatalf("failed to decode connection details: %v", err)
+	}
+	want := broker.ConnectionDetails{
+		DeploymentID:     "deploy-1",
+		Namespace:        "team-a",
+		Host:             "orders-db.team-a.svc.cluster.local",
+		Port:             5432,
+		Database:         "orders",
+		ConnectionSecret: "orders-db-credentials",
+	}
+	if details != want {
+		t.Fatalf("expected %+v, got %+v", want, details)
+	}
+
+	rec = connection("deploy-unknown", "s3cret")
+	if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "deployment_not_found") {
+		t.Fatalf("expected 404 deployment_not_found, got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec = connection("deploy-1", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rec.Code)
+	}
+}
+
+func TestHandleInventory(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+
+	inventory := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/inventory", nil))
+		return rec
+	}
+
+	s.k8sClient = nil
+	if rec := inventory(); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 without a Kubernetes client, got %d", rec.Code)
+	}
+
+	managed := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "team-a",
+		Name:      "orders-db",
+		Labels:    broker.ResourceLabels("deploy-1", "database", "orders-db"),
+	}}
+	s.k8sClient = broker.NewK8sClientForClientset(fake.NewSimpleClientset(managed))
+
+	rec := inventory()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.InventoryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode inventory: %v", err)
+	}
+	want := broker.InventoryItem{DeploymentID: "deploy-1", ResourceType: "database", ResourceName: "orders-db", Namespace: "team-a", Phase: "Provisioning"}
+	if resp.Total != 1 || len(resp.Deployments) != 1 || resp.Deployments[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, resp)
+	}
+}
+
+func TestHandleDeprovisionRemovesDeploymentFromInventory(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+
+	labelled := func(deploymentID, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "team-a", Name: name, Labels: broker.ResourceLabels(deploymentID, "database", name)}
+	}
+	cs := fake.NewSimpleClientset(
+		&appsv1.StatefulSet{ObjectMeta: labelled("deploy-1", "orders-db")},
+		&corev1.Service{ObjectMeta: labelled("deploy-1", "orders-db")},
+		&corev1.Secret{ObjectMeta: labelled("deploy-1", "orders-db-credentials")},
+		&appsv1.StatefulSet{ObjectMeta: labelled("deploy-2", "payments-db")},
+	)
+	s.k8sClient = broker.NewK8sClientForClientset(cs)
+
+	deprovision := func() *httptest.ResponseRecorder {
+		body := `{"deploymentId":"deploy-1","resourceType":"database","resourceName":"orders-db","namespace":"team-a","callbackUrl":"http://manager/v1/callback"}`
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/deprovision", strings.NewReader(body)))
+		return rec
+	}
+	if rec := deprovision(); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/inventory", nil))
+	var resp broker.InventoryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode inventory: %v", err)
+	}
+	if resp.Total != 1 || resp.Deployments[0].DeploymentID != "deploy-2" {
+		t.Fatalf("expected only deploy-2 left in the inventory, got %+v", resp)
+	}
+	ctx := context.Background()
+	if _, err := cs.CoreV1().Services("team-a").Get(ctx, "orders-db", metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the deployment's service to be deleted")
+	}
+	if _, err := cs.CoreV1().Secrets("team-a").Get(ctx, "orders-db-credentials", metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the deployment's credentials secret to be deleted")
+	}
+
+	// Deprovisioning again finds nothing left and still succeeds
+	if rec := deprovision(); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected a repeated deprovision to return 202, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A failed delete is reported rather than accepted
+	cs.PrependReactor("list", "statefulsets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	if rec := deprovision(); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 when the resources can't be listed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestHandleCallbackReplay(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BROKER_PRIVATE_KEY", base64.StdEncoding.EncodeToString(priv))
+
+	var mu sync.Mutex
+	var received []broker.CallbackRequest
+	var signed []bool
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload broker.CallbackRequest
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		received = append(received, payload)
+		signed = append(signed, r.Header.Get("X-KIDP-Signature") != "")
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer manager.Close()
+
+	s, _ := newTestServer(t, &Config{DiagnosticsToken: "s3cret"})
+	s.callbacks = broker.NewCallbackClient(broker.CallbackConfig{})
+	s.worker = broker.NewWorker(s.provisioners, s.callbacks)
+
+	// A deployment the broker can't provision ends with a failed callback
+	req := broker.ProvisionRequest{ResourceType: "queue", ResourceName: "q1", Namespace: "team-a", CallbackURL: manager.URL}
+	_ = s.worker.Run(context.Background(), broker.ProvisionTask{DeploymentID: "deploy-1", Request: req})
+
+	replay := func(body, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/v1/callback/replay", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := replay(`{"deploymentId":"deploy-1"}`, "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.CallbackReplayResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != "replayed" || resp.Phase != "Failed" || resp.CallbackURL != manager.URL {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected the original callback and its replay, got %d", len(received))
+	}
+	original, replayed := received[0], received[1]
+	if replayed.DeploymentID != "deploy-1" || replayed.Phase != original.Phase || replayed.Error != original.Error {
+		t.Fatalf("expected the replay to repeat the last callback, got %+v", replayed)
+	}
+	if replayed.Nonce == "" || replayed.Nonce == original.Nonce {
+		t.Fatalf("expected the replay to carry a fresh nonce, got %q", replayed.Nonce)
+	}
+	if !signed[1] {
+		t.Fatal("expected the replay to be signed")
+	}
+
+	if rec := replay(`{"deploymentId":"deploy-unknown"}`, "s3cret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown deployment, got %d", rec.Code)
+	}
+	if rec := replay(`{}`, "s3cret"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without a deployment ID, got %d", rec.Code)
+	}
+	if rec := replay(`{"deploymentId":"deploy-1"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the bearer token, got %d", rec.Code)
+	}
+}
+
+func TestHandleDeploymentLogs(t *testing.T) {
+	s, _ := newTestServer(t, &Config{DiagnosticsToken: "s3cret"})
+
+	// A deployment the broker can't provision logs its failure
+	req := broker.ProvisionRequest{ResourceType: "queue", ResourceName: "q1", Namespace: "team-a", CallbackURL: "http://manager/v1/callback"}
+	_ = s.worker.Run(context.Background(), broker.ProvisionTask{DeploymentID: "deploy-1", Request: req})
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		s.router.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get("/v1/deployments/deploy-1/logs", "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.DeploymentLogsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.DeploymentID != "deploy-1" || len(resp.Entries) == 0 || resp.Truncated {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if last := resp.Entries[len(resp.Entries)-1]; !strings.Contains(last.Message, `no provisioner registered for resource type "queue"`) {
+		t.Fatalf("expected the failure to be logged, got %+v", resp.Entries)
+	}
+
+	s.worker.Track(broker.ProvisionTask{DeploymentID: "deploy-2", Request: req})
+	rec = get("/v1/deployments/deploy-2/logs", "s3cret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 for a deployment with no logs yet, got %d", rec.Code)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Entries == nil {
+		t.Fatalf("expected an empty list of entries, got %s", rec.Body)
+	}
+
+	if rec := get("/v1/deployments/deploy-unknown/logs", "s3cret"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown deployment, got %d", rec.Code)
+	}
+	if rec := get("/v1/deployments/deploy-1/logs?limit=0", "s3cret"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid limit, got %d", rec.Code)
+	}
+	if rec := get("/v1/deployments/deploy-1/logs", ""); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without the bearer token, got %d", rec.Code)
+	}
+}
+
+func TestManagerAuth_DiagnosticsTokenEndpoints(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	configs := map[string]*Config{
+		"api key":           {APIKey: "broker-api-key", DiagnosticsToken: "s3cret"},
+		"manager signature": {ManagerPublicKey: pub, DiagnosticsToken: "s3cret"},
+	}
+	for mode, config := range configs {
+		s, _ := newTestServer(t, config)
+		srv := httptest.NewServer(s.handler())
+		defer srv.Close()
+
+		// Operators hold the diagnostics token, not the manager's credentials
+		for _, ep := range []struct{ method, path, body string }{
+			{http.MethodGet, "/v1/diagnostics?callbackUrl=" + srv.URL + "/health", ""},
+			{http.MethodPost, "/v1/callback/replay", `{"deploymentId":"deploy-unknown"}`},
+			{http.MethodGet, "/v1/deployments/deploy-unknown/connection", ""},
+			{http.MethodGet, "/v1/deployments/deploy-unknown/logs", ""},
+		} {
+			req, _ := http.NewRequest(ep.method, srv.URL+ep.path, strings.NewReader(ep.body))
+			req.Header.Set("Authorization", "Bearer s3cret")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("%s %s: unexpected error: %v", mode, ep.path, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+				t.Errorf("%s: expected %s to accept the diagnostics token, got %d", mode, ep.path, resp.StatusCode)
+			}
+		}
+
+		// The diagnostics token doesn't stand in for the manager's credentials
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/v1/regions", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", mode, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected /v1/regions to reject the diagnostics token, got %d", mode, resp.StatusCode)
+		}
+	}
+}
+
+func TestManagerAuth_RoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := newTestServer(t, &Config{ManagerPublicKey: pub})
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	req := brokerclient.ProvisionRequest{
+		ResourceType: "database", ResourceName: "orders", Namespace: "team-ns", Team: "team-a", Owner: "alice",
+		CallbackURL: "http://manager/v1/callback", Spec: map[string]interface{}{"engine": "postgresql"},
+	}
+
+	// Requests signed with the manager's key are served, including GETs
+	signed := brokerclient.NewClient(srv.URL)
+	signed.SetSigningKey(priv)
+	if _, err := signed.Provision(context.Background(), req); err != nil {
+		t.Fatalf("expected a signed request to be accepted: %v", err)
+	}
+	if _, err := signed.Regions(context.Background()); err != nil {
+		t.Fatalf("expected a signed GET to be accepted: %v", err)
+	}
+
+	// Unsigned requests and requests signed with another key are refused
+	forged := brokerclient.NewClient(srv.URL)
+	forged.SetSigningKey(otherPriv)
+	for name, c := range map[string]*brokerclient.Client{"unsigned": brokerclient.NewClient(srv.URL), "wrong key": forged} {
+		_, err := c.Provision(context.Background(), req)
+		var brokerErr *brokerclient.BrokerError
+		if !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusUnauthorized || brokerErr.ErrorResponse.Error != "unauthorized" {
+			t.Errorf("%s: expected 401 unauthorized, got %v", name, err)
+		}
+	}
+
+	// A signature doesn't carry over to another body, endpoint or an old timestamp
+	sign := func(timestamp, method, uri, body string) *http.Request {
+		r := httptest.NewRequest(method, uri, strings.NewReader(body))
+		r.Header.Set(brokerclient.TimestampHeader, timestamp)
+		r.Header.Set(brokerclient.SignatureHeader, base64.StdEncoding.EncodeToString(
+			ed25519.Sign(priv, brokerclient.SigningPayload(timestamp, method, uri, []byte(body)))))
+		return r
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	tampered := sign(now, http.MethodPost, "/v1/provision", provisionBody("team-a", "orders"))
+	tampered.Body = io.NopCloser(strings.NewReader(provisionBody("team-a", "payments")))
+	redirected := sign(now, http.MethodPost, "/v1/provision", `{"deploymentId":"deploy-1"}`)
+	redirected.URL.Path = "/v1/deprovision"
+	redirected.RequestURI = "/v1/deprovision"
+	stale := sign(time.Now().Add(-10*time.Minute).UTC().Format(time.RFC3339), http.MethodGet, "/v1/regions", "")
+	for name, r := range map[string]*http.Request{"tampered body": tampered, "other endpoint": redirected, "stale": stale} {
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, r)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+
+	// Probes stay open
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /health to need no signature, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	s, _ := newTestServer(t, &Config{APIKey: "broker-api-key"})
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	valid := brokerclient.NewClient(srv.URL)
+	valid.SetAPIKey("broker-api-key")
+	if _, err := valid.Regions(context.Background()); err != nil {
+		t.Fatalf("expected a request with the API key to be accepted: %v", err)
+	}
+
+	wrong := brokerclient.NewClient(srv.URL)
+	wrong.SetAPIKey("other-key")
+	for name, c := range map[string]*brokerclient.Client{"missing key": brokerclient.NewClient(srv.URL), "wrong key": wrong} {
+		_, err := c.Regions(context.Background())
+		var brokerErr *brokerclient.BrokerError
+		if !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusUnauthorized || brokerErr.ErrorResponse.Error != "unauthorized" {
+			t.Errorf("%s: expected 401 unauthorized, got %v", name, err)
+		}
+	}
+
+	// Probes stay open
+	resp, err := http.Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /health to need no API key, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// handler is the broker's HTTP handler: the routes wrapped in request
+// metrics and request-ID logging
+func (s *Server) handler() http.Handler {
+	return s.withRequestID(s.withMetrics(s.withManagerAuth(s.router)))
+}
+
+// registerCollectors registers the metrics read at scrape time: Go runtime
+// and process metrics, the deployment counters, and the deployment and
+// callback backlogs
+func (s *Server) registerCollectors() {
+	s.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		s.deployments,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "broker_queued_deployments",
+			Help: "Accepted deployments waiting for a worker slot.",
+		}, func() float64 { return float64(s.worker.QueueLength()) }),
+	)
+	if s.config.DeadLetters != nil {
+		s.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "broker_callback_dead_letters",
+			Help: "Undelivered callbacks waiting to be replayed.",
+		}, func() float64 {
+			letters, err := s.config.DeadLetters.List()
+			if err != nil {
+				return math.NaN()
+			}
+			return float64(len(letters))
+		}))
+	}
+}
+
+// withMetrics records each request's duration under the route it matched
+func (s *Server) withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := s.router.Handler(r)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+		s.metrics.HTTPRequest(pattern, rec.status, time.Since(start))
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aykay76/kidp/pkg/broker"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	s, blocking := newTestServer(t, &Config{TeamMaxConcurrent: 1})
+	handler := s.handler()
+	post := func(name string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/provision", strings.NewReader(provisionBody("team-a", name))))
+		return rec.Code
+	}
+
+	// One deployment fails and finishes, one is held in flight and a third
+	// is rejected by the team quota
+	s.provisioners.Register("database", outcomeProvisioner{})
+	if code := post("faildb"); code != http.StatusAccepted {
+		t.Fatalf("expected the first request to be accepted, got %d", code)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for s.deployments.Counts().Active > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.provisioners.Register("database", blocking)
+	if code := post("db1"); code != http.StatusAccepted {
+		t.Fatalf("expected the second request to be accepted, got %d", code)
+	}
+	if code := post("db2"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected the third request to be rejected, got %d", code)
+	}
+
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer manager.Close()
+	if err := s.callbacks.NotifyStatus(context.Background(), manager.URL, broker.CallbackRequest{DeploymentID: "deploy-1"}); err != nil {
+		t.Fatalf("unexpected callback error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`broker_provision_requests_total{resource_type="database",result="failed"} 1`,
+		`broker_provision_requests_total{resource_type="database",result="rejected"} 1`,
+		`broker_provision_duration_seconds_count{resource_type="database",result="failed"} 1`,
+		`broker_active_deployments 1`,
+		`broker_deployments_total 2`,
+		`broker_failed_deployments_total 1`,
+		`broker_queued_deployments 0`,
+		`broker_callback_attempts_total{result="success"} 1`,
+		`broker_callback_successes_total 1`,
+		`broker_http_request_duration_seconds_count{code="202",path="/v1/provision"} 2`,
+		`broker_http_request_duration_seconds_count{code="429",path="/v1/provision"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to include %s", want)
+		}
+	}
+}
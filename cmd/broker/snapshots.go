@@ -0,0 +1,150 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aykay76/kidp/pkg/broker"
+)
+
+// handleSnapshots takes a named snapshot of a provisioned resource. The
+// response carries the snapshot ID to poll GET /v1/snapshots/{id} with until
+// the snapshot completes or fails.
+func (s *Server) handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req broker.SnapshotRequest
+	if err := broker.DecodeJSON(r.Body, &req); err != nil {
+		s.log(r.Context()).Warn("Failed to decode snapshot request", "error", err)
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "invalid_request",
+			Message: fmt.Sprintf("Failed to parse request body: %v", err),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	ctx := s.withLogAttrs(r.Context(), "deploymentId", req.DeploymentID, "resourceType", req.ResourceType,
+		"snapshot", req.Name)
+
+	if err := req.Validate(); err != nil {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	snapshotter, ok := s.snapshotter(ctx, w, req.ResourceType)
+	if !ok {
+		return
+	}
+	resp, err := snapshotter.Snapshot(ctx, req)
+	if !s.snapshotOK(ctx, w, err) {
+		return
+	}
+
+	s.log(ctx).Info("Snapshot requested", "snapshotId", resp.SnapshotID, "status", resp.Status)
+	s.respondJSON(w, http.StatusAccepted, resp)
+}
+
+// handleSnapshot reports the progress of a snapshot. The deploymentId and
+// resourceType query parameters, and engine for databases, identify the
+// resource it was taken of.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	req := broker.SnapshotRequest{
+		DeploymentID: query.Get("deploymentId"),
+		ResourceType: query.Get("resourceType"),
+		Engine:       query.Get("engine"),
+	}
+	if req.DeploymentID == "" || req.ResourceType == "" {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "validation_failed",
+			Message: "deploymentId and resourceType are required",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	ctx := r.Context()
+	snapshotter, ok := s.snapshotter(ctx, w, req.ResourceType)
+	if !ok {
+		return
+	}
+	resp, err := snapshotter.SnapshotStatus(ctx, req, r.PathValue("id"))
+	if !s.snapshotOK(ctx, w, err) {
+		return
+	}
+	s.respondJSON(w, http.StatusOK, resp)
+}
+
+// snapshotter returns the Snapshotter for a resource type, writing the error
+// response if its provisioner can't take snapshots
+func (s *Server) snapshotter(ctx context.Context, w http.ResponseWriter, resourceType string) (broker.Snapshotter, bool) {
+	provisioner, ok := s.provisioners.Get(resourceType)
+	if !ok {
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "unsupported_resource_type",
+			Message: fmt.Sprintf("No provisioner available for resource type %q", resourceType),
+			Code:    http.StatusBadRequest,
+		})
+		return nil, false
+	}
+	snapshotter, ok := provisioner.(broker.Snapshotter)
+	if !ok {
+		s.snapshotOK(ctx, w, broker.ErrSnapshotsUnsupported)
+		return nil, false
+	}
+	return snapshotter, true
+}
+
+// snapshotOK writes the error response for a failed snapshot call and
+// reports whether err was nil
+func (s *Server) snapshotOK(ctx context.Context, w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, broker.ErrSnapshotsUnsupported):
+		s.respondJSON(w, http.StatusBadRequest, broker.ErrorResponse{
+			Error:   "snapshots_unsupported",
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+	default:
+		s.log(ctx).Error("Snapshot call failed", "error", err)
+		s.respondJSON(w, http.StatusInternalServerError, broker.ErrorResponse{
+			Error:   "snapshot_failed",
+			Message: fmt.Sprintf("Snapshot failed: %v", err),
+			Code:    http.StatusInternalServerError,
+		})
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aykay76/kidp/pkg/broker"
+)
+
+func TestHandleSnapshots(t *testing.T) {
+	s, _ := newTestServer(t, &Config{})
+	s.provisioners.Register("database", &broker.EngineProvisioner{Default: broker.StubDatabaseProvisioner{}})
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/snapshots", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"deploymentId":"deploy-1","resourceType":"database","engine":"mysql","name":"release-1.4"}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp broker.SnapshotResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.SnapshotID == "" || resp.Name != "release-1.4" || resp.Status != broker.SnapshotStatusCompleted {
+		t.Fatalf("unexpected snapshot response: %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	s.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet,
+		"/v1/snapshots/"+resp.SnapshotID+"?deploymentId=deploy-1&resourceType=database&engine=mysql", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), resp.SnapshotID) {
+		t.Fatalf("expected the snapshot's status, got %d: %s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		name, body, code string
+	}{
+		{"missing name", `{"deploymentId":"deploy-1","resourceType":"database"}`, "validation_failed"},
+		{"unsupported resource type", `{"deploymentId":"deploy-1","resourceType":"cache","name":"snap"}`, "snapshots_unsupported"},
+		{"unknown resource type", `{"deploymentId":"deploy-1","resourceType":"queue","name":"snap"}`, "unsupported_resource_type"},
+	} {
+		rec := post(tc.body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tc.code) {
+			t.Errorf("%s: expected 400 %s, got %d: %s", tc.name, tc.code, rec.Code, rec.Body)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultTLSMinVersion is the oldest TLS version the broker accepts unless
+// configured otherwise
+const DefaultTLSMinVersion = "1.2"
+
+// tlsVersions are the minimum versions the broker can be configured with;
+// TLS 1.0 and 1.1 are refused
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// approvedCipherSuites are the TLS 1.2 cipher suites the broker allows:
+// ECDHE key exchange for forward secrecy and AEAD ciphers only. They are also
+// the default. TLS 1.3 suites are all approved and aren't configurable.
+var approvedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// newTLSConfig returns the server TLS configuration for a minimum version
+// and a list of cipher suite names, using the approved suites when none are
+// named. Versions below 1.2 and suites that aren't approved are rejected.
+func newTLSConfig(minVersion string, cipherSuites []string) (*tls.Config, error) {
+	version, ok := tlsVersions[minVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported minimum TLS version %q: must be 1.2 or 1.3", minVersion)
+	}
+
+	suites := approvedCipherSuites
+	if len(cipherSuites) > 0 {
+		approved := map[string]uint16{}
+		for _, id := range approvedCipherSuites {
+			approved[tls.CipherSuiteName(id)] = id
+		}
+		suites = make([]uint16, 0, len(cipherSuites))
+		for _, name := range cipherSuites {
+			id, ok := approved[name]
+			if !ok {
+				return nil, fmt.Errorf("cipher suite %q is not approved; use one of %s", name, strings.Join(approvedCipherSuiteNames(), ", "))
+			}
+			suites = append(suites, id)
+		}
+	}
+
+	return &tls.Config{
+		MinVersion:   version,
+		CipherSuites: suites,
+	}, nil
+}
+
+// setClientCAs makes config verify client certificates presented against the
+// CA bundle at path. Presenting one is left to the client so probes still
+// connect; withManagerAuth requires a verified certificate on the /v1/ API.
+func setClientCAs(config *tls.Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("no certificates found in client CA file %s", path)
+	}
+	config.ClientCAs = pool
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	return nil
+}
+
+// approvedCipherSuiteNames lists the approved suites by name
+func approvedCipherSuiteNames() []string {
+	names := make([]string, len(approvedCipherSuites))
+	for i, id := range approvedCipherSuites {
+		names[i] = tls.CipherSuiteName(id)
+	}
+	return names
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
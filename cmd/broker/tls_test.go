@@ -0,0 +1,221 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// tlsServer serves the broker's routes over TLS configured as newTLSConfig
+// builds it
+func tlsServer(t *testing.T, minVersion string, cipherSuites []string) *httptest.Server {
+	t.Helper()
+	config, err := newTLSConfig(minVersion, cipherSuites)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := newTestServer(t, &Config{})
+	srv := httptest.NewUnstartedServer(s.handler())
+	srv.TLS = config
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// handshake connects to srv with the client restricted to the given TLS
+// versions and cipher suites
+func handshake(srv *httptest.Server, minVersion, maxVersion uint16, cipherSuites []uint16) error {
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         minVersion,
+		MaxVersion:         maxVersion,
+		CipherSuites:       cipherSuites,
+	})
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func TestTLSServer_RejectsWeakHandshakes(t *testing.T) {
+	srv := tlsServer(t, DefaultTLSMinVersion, nil)
+
+	if err := handshake(srv, tls.VersionTLS10, tls.VersionTLS10, nil); err == nil {
+		t.Fatal("expected a TLS 1.0 handshake to be rejected")
+	}
+	if err := handshake(srv, tls.VersionTLS11, tls.VersionTLS11, nil); err == nil {
+		t.Fatal("expected a TLS 1.1 handshake to be rejected")
+	}
+	// A TLS 1.2 client offering only a non-forward-secret suite is refused
+	if err := handshake(srv, tls.VersionTLS12, tls.VersionTLS12, []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256}); err == nil {
+		t.Fatal("expected an unapproved cipher suite to be rejected")
+	}
+	if err := handshake(srv, tls.VersionTLS12, tls.VersionTLS12, nil); err != nil {
+		t.Fatalf("expected a TLS 1.2 handshake to succeed: %v", err)
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 over TLS, got %d", resp.StatusCode)
+	}
+
+	strict := tlsServer(t, "1.3", nil)
+	if err := handshake(strict, tls.VersionTLS12, tls.VersionTLS12, nil); err == nil {
+		t.Fatal("expected a TLS 1.2 handshake to be rejected when 1.3 is required")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	config, err := newTLSConfig("1.2", []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.MinVersion != tls.VersionTLS12 || len(config.CipherSuites) != 1 || config.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Fatalf("unexpected config: min=%x suites=%v", config.MinVersion, config.CipherSuites)
+	}
+
+	for _, tc := range []struct {
+		name         string
+		minVersion   string
+		cipherSuites []string
+	}{
+		{"TLS 1.0", "1.0", nil},
+		{"TLS 1.1", "1.1", nil},
+		{"unknown version", "tls12", nil},
+		{"insecure suite", "1.2", []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{"CBC suite", "1.2", []string{"TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA"}},
+		{"unknown suite", "1.2", []string{"TLS_MADE_UP"}},
+	} {
+		if _, err := newTLSConfig(tc.minVersion, tc.cipherSuites); err == nil {
+			t.Errorf("%s: expected the configuration to be rejected", tc.name)
+		}
+	}
+}
+
+// issueCert creates a client certificate for cn signed by parent, or a
+// self-signed CA when parent is nil
+func issueCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cert, key, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestTLSServer_RequiresClientCertificates(t *testing.T) {
+	ca, caKey, _ := issueCert(t, "manager-ca", nil, nil)
+	_, _, managerCert := issueCert(t, "kidp-manager", ca, caKey)
+	_, _, rogueCert := issueCert(t, "rogue", nil, nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config, err := newTLSConfig(DefaultTLSMinVersion, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := setClientCAs(config, caFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, _ := newTestServer(t, &Config{TLSClientCAFile: caFile})
+	srv := httptest.NewUnstartedServer(s.handler())
+	srv.TLS = config
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	regions := func(certs ...tls.Certificate) error {
+		c := brokerclient.NewClientWithTLS(srv.URL, &tls.Config{RootCAs: roots, Certificates: certs})
+		_, err := c.Regions(context.Background())
+		return err
+	}
+
+	if err := regions(managerCert); err != nil {
+		t.Fatalf("expected a request with the manager's certificate to succeed: %v", err)
+	}
+	var brokerErr *brokerclient.BrokerError
+	if err := regions(); !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a client certificate, got %v", err)
+	}
+	if err := regions(rogueCert); err == nil {
+		t.Fatal("expected a certificate from another CA to be rejected")
+	}
+
+	// Probes don't present a certificate
+	resp, err := srv.Client().Get(srv.URL + "/health")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected /health to stay open, got %d", resp.StatusCode)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := setClientCAs(config, notPEM); err == nil {
+		t.Fatal("expected a CA file without certificates to be rejected")
+	}
+}
@@ -17,8 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
 	"flag"
+	"log"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -32,7 +38,12 @@ import (
 	platformv1 "github.com/aykay76/kidp/api/v1"
 	"github.com/aykay76/kidp/internal/controller"
 	"github.com/aykay76/kidp/internal/webhook"
+	webhookv1 "github.com/aykay76/kidp/internal/webhook/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
 	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/redact"
+	"github.com/aykay76/kidp/pkg/tracing"
+	"github.com/aykay76/kidp/pkg/version"
 )
 
 var (
@@ -50,24 +61,114 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var webhookPort int
+	var fallbackBroker string
+	var enableAdmissionWebhooks bool
+	var teamResyncInterval time.Duration
+	var brokerSelectionStrategy string
+	var brokerReservationTTL time.Duration
+	var brokerNamespace string
+	var webhookShutdownTimeout time.Duration
+	var brokerSigningKeyFile string
+	var reprovisionOnBrokerOffline bool
+	var residencyCheckInterval time.Duration
+	var brokerInventoryInterval time.Duration
+	var cleanupOrphanedDeployments bool
+	var watchNamespaces string
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.IntVar(&webhookPort, "webhook-port", 9090, "The port the webhook server binds to.")
+	flag.StringVar(&fallbackBroker, "fallback-broker", "",
+		"Broker (namespace/name) to use as a last resort when no broker matches the selection criteria.")
+	flag.BoolVar(&enableAdmissionWebhooks, "enable-admission-webhooks", false,
+		"Serve the validating admission webhooks on :9443. Requires serving certificates in /tmp/k8s-webhook-server/serving-certs.")
+	flag.StringVar(&brokerSelectionStrategy, "broker-selection-strategy", string(brokerregistry.HighestScore),
+		"How to choose between brokers matching a request: HighestScore, WeightedRandom or RoundRobin.")
+	flag.DurationVar(&brokerReservationTTL, "broker-reservation-ttl", brokerregistry.DefaultReservationTTL,
+		"How long a dispatched provision request counts against its broker's capacity if no final callback arrives.")
+	flag.StringVar(&brokerNamespace, "broker-namespace", webhook.DefaultBrokerNamespace,
+		"Namespace of the Broker CRs that sign callbacks, used when a broker doesn't send X-KIDP-Broker-Namespace.")
+	flag.DurationVar(&webhookShutdownTimeout, "webhook-shutdown-timeout", webhook.DefaultShutdownTimeout,
+		"How long in-flight broker callbacks get to finish on shutdown before they are aborted.")
+	flag.StringVar(&brokerSigningKeyFile, "broker-signing-key-file", "",
+		"File holding the manager's Ed25519 private key (raw or base64), used to sign requests to brokers with ed25519 authentication.")
+	flag.BoolVar(&reprovisionOnBrokerOffline, "reprovision-on-broker-offline", false,
+		"Provision Databases again through another broker when theirs goes Offline, abandoning the old deployment.")
+	flag.DurationVar(&residencyCheckInterval, "residency-check-interval", 10*time.Minute,
+		"How often provisioned Databases' regions are checked against their tenant's allowed regions.")
+	flag.DurationVar(&brokerInventoryInterval, "broker-inventory-interval", 5*time.Minute,
+		"How often each Ready broker's inventory is cross-checked against the Databases to flag orphans.")
+	flag.BoolVar(&cleanupOrphanedDeployments, "cleanup-orphaned-deployments", false,
+		"Deprovision database deployments that have had no Database for two inventory checks in a row.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces whose Databases, Caches, Topics, Teams and Applications are watched. Empty watches all namespaces.")
+	flag.DurationVar(&teamResyncInterval, "team-resync-interval", 5*time.Minute,
+		"How often each Team's resource counts and current spend are refreshed.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 
+	// Each controller reconciles one object at a time unless raised here
+	concurrency := make(map[string]*int)
+	for _, kind := range []string{"application", "broker", "cache", "database", "team", "tenant", "topic"} {
+		concurrency[kind] = flag.Int(kind+"-max-concurrent-reconciles", 1,
+			"The number of "+kind+" objects reconciled concurrently.")
+	}
+
+	// Credentials, tokens and connection secrets are redacted from both the
+	// controller logs and the callback webhook's standard library logs
 	opts := zap.Options{
 		Development: true,
+		DestWriter:  redact.NewWriter(os.Stderr),
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	for kind, n := range concurrency {
+		if *n < 1 {
+			setupLog.Error(nil, "invalid --"+kind+"-max-concurrent-reconciles, must be at least 1", "value", *n)
+			os.Exit(1)
+		}
+	}
+
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), "kidp-manager")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			setupLog.Error(err, "failed to flush traces")
+		}
+	}()
+
+	var signingKey ed25519.PrivateKey
+	if brokerSigningKeyFile != "" {
+		signingKey, err = brokerclient.LoadSigningKey(brokerSigningKeyFile)
+		if err != nil {
+			setupLog.Error(err, "unable to load broker signing key")
+			os.Exit(1)
+		}
+		setupLog.Info("signing requests to brokers with ed25519 authentication", "path", brokerSigningKeyFile)
+	}
+
+	var namespaces controller.WatchNamespaces
+	for _, ns := range strings.Split(watchNamespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	if len(namespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+	}
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
+		Cache:  namespaces.CacheOptions(),
 		Metrics: metricsserver.Options{
 			BindAddress: metricsAddr,
 		},
@@ -79,51 +180,139 @@ func main() {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
+	// Counts and safety checks that span namespaces read past a scoped cache
+	clusterReader := namespaces.ClusterReader(mgr.GetAPIReader())
 
 	if err = (&controller.BrokerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		ClusterReader:           clusterReader,
+		MaxConcurrentReconciles: *concurrency["broker"],
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Broker")
 		os.Exit(1)
 	}
 
 	// Create broker registry for dynamic broker discovery
-	registry := brokerregistry.NewRegistry(mgr.GetClient())
+	strategy := brokerregistry.SelectionStrategy(brokerSelectionStrategy)
+	if !slices.Contains(brokerregistry.SelectionStrategies, strategy) {
+		setupLog.Error(nil, "invalid --broker-selection-strategy", "value", brokerSelectionStrategy)
+		os.Exit(1)
+	}
+	registryOpts := []brokerregistry.Option{
+		brokerregistry.WithSelectionStrategy(strategy),
+		brokerregistry.WithReservationTTL(brokerReservationTTL),
+		brokerregistry.WithInformers(mgr.GetCache()),
+	}
+	if fallbackBroker != "" {
+		ns, name, ok := strings.Cut(fallbackBroker, "/")
+		if !ok || ns == "" || name == "" {
+			setupLog.Error(nil, "invalid --fallback-broker, expected namespace/name", "value", fallbackBroker)
+			os.Exit(1)
+		}
+		registryOpts = append(registryOpts, brokerregistry.WithFallbackBroker(ns, name))
+		setupLog.Info("using fallback broker", "broker", fallbackBroker)
+	}
+	registry := brokerregistry.NewRegistry(mgr.GetClient(), registryOpts...)
 
 	if err = (&controller.DatabaseReconciler{
+		Client:                     mgr.GetClient(),
+		Scheme:                     mgr.GetScheme(),
+		APIReader:                  mgr.GetAPIReader(),
+		ClusterReader:              clusterReader,
+		BrokerRegistry:             registry,
+		SigningKey:                 signingKey,
+		ReprovisionOnBrokerOffline: reprovisionOnBrokerOffline,
+		ResidencyCheckInterval:     residencyCheckInterval,
+		MaxConcurrentReconciles:    *concurrency["database"],
+		Namespaces:                 namespaces,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Database")
+		os.Exit(1)
+	}
+
+	if err = (&controller.InventoryReconciler{
 		Client:         mgr.GetClient(),
 		Scheme:         mgr.GetScheme(),
-		BrokerRegistry: registry,
+		APIReader:      mgr.GetAPIReader(),
+		SigningKey:     signingKey,
+		Interval:       brokerInventoryInterval,
+		CleanupOrphans: cleanupOrphanedDeployments,
+		Namespaces:     namespaces,
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Database")
+		setupLog.Error(err, "unable to create controller", "controller", "BrokerInventory")
+		os.Exit(1)
+	}
+
+	if err = (&controller.CacheReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		APIReader:               mgr.GetAPIReader(),
+		BrokerRegistry:          registry,
+		SigningKey:              signingKey,
+		MaxConcurrentReconciles: *concurrency["cache"],
+		Namespaces:              namespaces,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Cache")
+		os.Exit(1)
+	}
+
+	if err = (&controller.TopicReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		APIReader:               mgr.GetAPIReader(),
+		BrokerRegistry:          registry,
+		SigningKey:              signingKey,
+		MaxConcurrentReconciles: *concurrency["topic"],
+		Namespaces:              namespaces,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Topic")
 		os.Exit(1)
 	}
 
 	if err = (&controller.TeamReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		ClusterReader:           clusterReader,
+		ResyncInterval:          teamResyncInterval,
+		MaxConcurrentReconciles: *concurrency["team"],
+		Namespaces:              namespaces,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Team")
 		os.Exit(1)
 	}
 
 	if err = (&controller.ApplicationReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		MaxConcurrentReconciles: *concurrency["application"],
+		Namespaces:              namespaces,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Application")
 		os.Exit(1)
 	}
 
 	if err = (&controller.TenantReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		ClusterReader:           clusterReader,
+		MaxConcurrentReconciles: *concurrency["tenant"],
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Tenant")
 		os.Exit(1)
 	}
 
+	if enableAdmissionWebhooks {
+		if err = webhookv1.SetupDatabaseWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Database")
+			os.Exit(1)
+		}
+		if err = webhookv1.SetupTeamWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Team")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -133,18 +322,36 @@ func main() {
 		os.Exit(1)
 	}
 
+	// The signal handler can only be set up once; the webhook server and
+	// the manager share it
+	ctx := ctrl.SetupSignalHandler()
+
+	if err := registry.StartWatch(ctx); err != nil {
+		setupLog.Error(err, "unable to watch brokers")
+		os.Exit(1)
+	}
+
 	// Start webhook server to receive callbacks from broker
 	webhookServer := webhook.NewServer(mgr.GetClient(), webhookPort)
+	webhookServer.SetBrokerRegistry(registry)
+	webhookServer.SetClusterReader(clusterReader)
+	webhookServer.SetBrokerNamespace(brokerNamespace)
+	webhookServer.SetShutdownTimeout(webhookShutdownTimeout)
+	webhookDone := make(chan struct{})
 	go func() {
-		if err := webhookServer.Start(ctrl.SetupSignalHandler()); err != nil {
+		defer close(webhookDone)
+		if err := webhookServer.Start(ctx); err != nil {
 			setupLog.Error(err, "problem running webhook server")
 		}
 	}()
 	setupLog.Info("started webhook server", "port", webhookPort)
 
-	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	setupLog.Info("starting manager", "version", version.Version)
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+
+	// Let in-flight callbacks finish before exiting
+	<-webhookDone
 }
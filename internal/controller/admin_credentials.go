@@ -0,0 +1,68 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// adminCredentialsKeys must be set in a Database's admin credentials Secret
+var adminCredentialsKeys = []string{"username", "password"}
+
+// checkAdminCredentials returns a message explaining why the database's
+// admin credentials Secret can't be used, or "" if it is usable or none is
+// referenced. Only the Secret's presence and keys are checked; the broker
+// reads the values itself.
+func (r *DatabaseReconciler) checkAdminCredentials(ctx context.Context, database *platformv1.Database) (string, error) {
+	ref := database.Spec.AdminCredentialsSecretRef
+	if ref == nil {
+		return "", nil
+	}
+
+	// Read secrets straight from the API server rather than caching every
+	// Secret in the cluster
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: database.Namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("Admin credentials secret %s not found", ref.Name), nil
+		}
+		return "", err
+	}
+
+	var missing []string
+	for _, key := range adminCredentialsKeys {
+		if len(secret.Data[key]) == 0 {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("Admin credentials secret %s is missing %s", ref.Name, strings.Join(missing, ", ")), nil
+	}
+	return "", nil
+}
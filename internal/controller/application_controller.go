@@ -3,16 +3,19 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
 )
 
 const applicationFinalizerName = "platform.company.com/application-cleanup"
@@ -22,13 +25,22 @@ type ApplicationReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// MaxConcurrentReconciles is how many Applications may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+
+	// Namespaces restricts the Applications reconciled to those namespaces. Empty
+	// reconciles every namespace.
+	Namespaces WatchNamespaces
 }
 
 // +kubebuilder:rbac:groups=platform.company.com,resources=applications,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.company.com,resources=applications/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=platform.company.com,resources=applications/finalizers,verbs=update
 
-func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("application", time.Now(), &err)
 	log := log.FromContext(ctx)
 
 	app := &platformv1.Application{}
@@ -47,21 +59,15 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	}
 
 	// Add finalizer
-	if !controllerutil.ContainsFinalizer(app, applicationFinalizerName) {
-		log.Info("Adding finalizer to Application", "name", app.Name)
-		controllerutil.AddFinalizer(app, applicationFinalizerName)
-		if err := r.Update(ctx, app); err != nil {
-			log.Error(err, "Failed to add finalizer")
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{Requeue: true}, nil
+	if added, err := r.helper().EnsureFinalizer(ctx, app); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
 	}
 
 	log.Info("Reconciling Application", "name", app.Name, "displayName", app.Spec.DisplayName)
 
 	if app.Status.Phase == "" {
 		app.Status.Phase = "Draft"
-		if err := UpdateStatusWithFallback(ctx, r.Client, app, log); err != nil {
+		if err := r.helper().UpdateStatus(ctx, app); err != nil {
 			log.Error(err, "Failed to update Application status")
 			return ctrl.Result{}, err
 		}
@@ -76,7 +82,7 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			r.Recorder.Eventf(app, "Warning", "TenantUnresolved", "tenant could not be resolved: %v", terr)
 		}
 		app.Status.Phase = "Suspended"
-		if statusErr := UpdateStatusWithFallback(ctx, r.Client, app, log); statusErr != nil {
+		if statusErr := r.helper().UpdateStatus(ctx, app); statusErr != nil {
 			log.Error(statusErr, "Failed to update Application status")
 			return ctrl.Result{}, statusErr
 		}
@@ -105,31 +111,24 @@ func (r *ApplicationReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 	return ctrl.Result{}, nil
 }
 
-func (r *ApplicationReconciler) handleDeletion(ctx context.Context, app *platformv1.Application) (ctrl.Result, error) {
-	log := log.FromContext(ctx)
-
-	if !controllerutil.ContainsFinalizer(app, applicationFinalizerName) {
-		return ctrl.Result{}, nil
-	}
-
-	log.Info("Handling Application deletion", "name", app.Name)
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *ApplicationReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Application", Finalizer: applicationFinalizerName}
+}
 
-	// Check for owned resources (databases) - if any exist, block deletion
-	if err := r.checkOwnedResources(ctx, app); err != nil {
-		log.Error(err, "Cannot delete Application, it still owns resources")
-		app.Status.Phase = "Deleting"
-		if statusErr := r.Status().Update(ctx, app); statusErr != nil {
-			log.Error(statusErr, "Failed to update Application status")
+func (r *ApplicationReconciler) handleDeletion(ctx context.Context, app *platformv1.Application) (ctrl.Result, error) {
+	return r.helper().HandleDeletion(ctx, app, func(ctx context.Context) error {
+		// Check for owned resources (databases) - if any exist, block deletion
+		if err := r.checkOwnedResources(ctx, app); err != nil {
+			app.Status.Phase = "Deleting"
+			if statusErr := r.helper().UpdateStatus(ctx, app); statusErr != nil {
+				log.FromContext(ctx).Error(statusErr, "Failed to update Application status")
+			}
+			return err
 		}
-		return ctrl.Result{}, err
-	}
-
-	controllerutil.RemoveFinalizer(app, applicationFinalizerName)
-	if err := r.Update(ctx, app); err != nil {
-		log.Error(err, "Failed to remove finalizer")
-		return ctrl.Result{}, err
-	}
-	return ctrl.Result{}, nil
+		return nil
+	})
 }
 
 func (r *ApplicationReconciler) checkOwnedResources(ctx context.Context, app *platformv1.Application) error {
@@ -155,6 +154,7 @@ func (r *ApplicationReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// Wire event recorder
 	r.Recorder = mgr.GetEventRecorderFor("application-controller")
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&platformv1.Application{}).
+		For(&platformv1.Application{}, builder.WithPredicates(r.Namespaces.Predicate())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,128 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// AnnotationApproved releases a Database held in PendingApproval when set to "true"
+const AnnotationApproved = "platform.company.com/approved"
+
+// approvalRequiredError is returned when a Database must be approved before
+// it is provisioned
+type approvalRequiredError struct {
+	message string
+}
+
+func (e *approvalRequiredError) Error() string {
+	return e.message
+}
+
+// checkApproval estimates the database's monthly cost with the selected
+// broker and holds it for approval if that exceeds the cost approval
+// threshold of its team or tenant. A database whose cost cannot be estimated
+// is held too, so the gate fails closed.
+func (r *DatabaseReconciler) checkApproval(ctx context.Context, brokerClient *brokerclient.Client, database *platformv1.Database, tenant *platformv1.Tenant) error {
+	if database.Annotations[AnnotationApproved] == "true" {
+		return nil
+	}
+	threshold, source := r.approvalThreshold(ctx, database, tenant)
+	if threshold == nil {
+		return nil
+	}
+
+	estimate, err := brokerClient.Estimate(ctx, brokerclient.EstimateRequest{
+		ResourceType: platformv1.ResourceTypeDatabase,
+		Spec:         databaseProvisionRequest(database, "").Spec,
+	})
+	if err != nil {
+		return &approvalRequiredError{message: fmt.Sprintf(
+			"Cost could not be estimated (%v) and %s requires approval above $%.2f/month; annotate with %s=true to provision",
+			err, source, *threshold, AnnotationApproved)}
+	}
+
+	database.Status.Cost = &platformv1.CostInfo{
+		EstimatedMonthly: estimate.MonthlyCost,
+		Currency:         estimate.Currency,
+		LastUpdated:      metav1.Now(),
+	}
+	if estimate.MonthlyCost <= *threshold {
+		return nil
+	}
+	return &approvalRequiredError{message: fmt.Sprintf(
+		"Estimated cost $%.2f/month exceeds the approval threshold of $%.2f/month set by %s; annotate with %s=true to provision",
+		estimate.MonthlyCost, *threshold, source, AnnotationApproved)}
+}
+
+// approvalThreshold returns the cost approval threshold that applies to the
+// database and what set it. The owning team's budget takes precedence over
+// the tenant's.
+func (r *DatabaseReconciler) approvalThreshold(ctx context.Context, database *platformv1.Database, tenant *platformv1.Tenant) (*float64, string) {
+	team, err := owningTeam(ctx, r.Client, database)
+	if err != nil {
+		log.FromContext(ctx).Info("Could not look up owning team, using tenant approval threshold", "database", database.Name, "err", err)
+	}
+	if team != nil && team.Spec.Budget != nil && team.Spec.Budget.ApprovalThreshold != nil {
+		return team.Spec.Budget.ApprovalThreshold, "team " + team.Name
+	}
+	if tenant != nil && tenant.Spec.Budget != nil && tenant.Spec.Budget.ApprovalThreshold != nil {
+		return tenant.Spec.Budget.ApprovalThreshold, "tenant " + tenant.Name
+	}
+	return nil, ""
+}
+
+// owningTeam returns the Team that owns the database, directly or through its
+// owning Application, or nil if it is not owned by a team
+func owningTeam(ctx context.Context, c client.Reader, database *platformv1.Database) (*platformv1.Team, error) {
+	return owningTeamOf(ctx, c, database.Spec.Owner, database.Namespace)
+}
+
+// owningTeamOf resolves the Team behind an owner reference made from
+// namespace, following an Application owner to its Team
+func owningTeamOf(ctx context.Context, c client.Reader, owner platformv1.OwnerReference, namespace string) (*platformv1.Team, error) {
+	ns := namespace
+	if owner.Namespace != "" {
+		ns = owner.Namespace
+	}
+
+	if owner.Kind == "Application" {
+		app := &platformv1.Application{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: owner.Name}, app); err != nil {
+			return nil, fmt.Errorf("owner application %s/%s not found: %w", ns, owner.Name, err)
+		}
+		owner = app.Spec.Owner
+		ns = app.Namespace
+	}
+	if owner.Kind != "Team" {
+		return nil, nil
+	}
+
+	team := &platformv1.Team{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: owner.Name}, team); err != nil {
+		return nil, fmt.Errorf("owner team %s/%s not found: %w", ns, owner.Name, err)
+	}
+	return team, nil
+}
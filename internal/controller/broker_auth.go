@@ -0,0 +1,203 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// newBrokerClient returns a client for the broker's endpoint that signs its
+// requests with key when the broker's authentication type is ed25519.
+// Requests to other brokers are sent unsigned.
+func newBrokerClient(broker *platformv1.Broker, key ed25519.PrivateKey) *brokerclient.Client {
+	c := brokerclient.NewClient(broker.Spec.Endpoint)
+	if auth := broker.Spec.Authentication; auth != nil && auth.Type == platformv1.BrokerAuthEd25519 {
+		c.SetSigningKey(key)
+	}
+	return c
+}
+
+// brokerCAKey optionally holds, in a broker's client certificate Secret, the
+// CA bundle that signed the broker's serving certificate
+const brokerCAKey = "ca.crt"
+
+// brokerAPIKeyKey holds the API key in a broker's authentication Secret
+const brokerAPIKeyKey = "api-key"
+
+// apiKeyCacheTTL is how long a broker's API key is reused before its Secret
+// is read again
+const apiKeyCacheTTL = time.Minute
+
+// brokerClient returns a client for the database's broker. A broker whose
+// authentication type is mtls is called with the client certificate from its
+// authentication Secret, and one whose type is api-key with the Secret's
+// api-key; others are handled as by newBrokerClient.
+func (r *DatabaseReconciler) brokerClient(ctx context.Context, broker *platformv1.Broker) (*brokerclient.Client, error) {
+	// Read secrets straight from the API server rather than caching every
+	// Secret in the cluster
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	return authenticatedBrokerClient(ctx, reader, &r.apiKeys, r.SigningKey, broker)
+}
+
+// brokerClient returns a client for the cache's broker, authenticated as by
+// DatabaseReconciler.brokerClient
+func (r *CacheReconciler) brokerClient(ctx context.Context, broker *platformv1.Broker) (*brokerclient.Client, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	return authenticatedBrokerClient(ctx, reader, &r.apiKeys, r.SigningKey, broker)
+}
+
+// brokerClient returns a client for the topic's broker, authenticated as by
+// DatabaseReconciler.brokerClient
+func (r *TopicReconciler) brokerClient(ctx context.Context, broker *platformv1.Broker) (*brokerclient.Client, error) {
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	return authenticatedBrokerClient(ctx, reader, &r.apiKeys, r.SigningKey, broker)
+}
+
+// authenticatedBrokerClient returns a client for the broker authenticated as
+// its spec asks, reading its authentication Secret through reader and
+// caching API keys in keys
+func authenticatedBrokerClient(ctx context.Context, reader client.Reader, keys *apiKeyCache, signingKey ed25519.PrivateKey, broker *platformv1.Broker) (*brokerclient.Client, error) {
+	auth := broker.Spec.Authentication
+	if auth == nil || (auth.Type != platformv1.BrokerAuthMTLS && auth.Type != platformv1.BrokerAuthAPIKey) {
+		return newBrokerClient(broker, signingKey), nil
+	}
+
+	if auth.Type == platformv1.BrokerAuthAPIKey {
+		key, err := keys.get(ctx, reader, broker)
+		if err != nil {
+			return nil, err
+		}
+		c := brokerclient.NewClient(broker.Spec.Endpoint)
+		c.SetAPIKey(key)
+		return c, nil
+	}
+	tlsConfig, err := brokerTLSConfig(ctx, reader, broker)
+	if err != nil {
+		return nil, err
+	}
+	return brokerclient.NewClientWithTLS(broker.Spec.Endpoint, tlsConfig), nil
+}
+
+// brokerSecretName returns where a broker's authentication Secret lives: the
+// broker's namespace unless the reference names one
+func brokerSecretName(broker *platformv1.Broker) (types.NamespacedName, error) {
+	ref := broker.Spec.Authentication.SecretRef
+	if ref == nil {
+		return types.NamespacedName{}, fmt.Errorf("broker %s/%s uses %s but has no authentication secretRef",
+			broker.Namespace, broker.Name, broker.Spec.Authentication.Type)
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = broker.Namespace
+	}
+	return types.NamespacedName{Namespace: namespace, Name: ref.Name}, nil
+}
+
+// apiKeyCache keeps brokers' API keys for apiKeyCacheTTL, so provisioning
+// doesn't read the Secret for every request. The zero value is ready to use.
+type apiKeyCache struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]cachedAPIKey
+}
+
+type cachedAPIKey struct {
+	key     string
+	expires time.Time
+}
+
+// get returns the API key from the broker's authentication Secret, reading
+// the Secret through reader when the cached key is missing or stale
+func (c *apiKeyCache) get(ctx context.Context, reader client.Reader, broker *platformv1.Broker) (string, error) {
+	name, err := brokerSecretName(broker)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[name]; ok && time.Now().Before(entry.expires) {
+		return entry.key, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, name, secret); err != nil {
+		return "", fmt.Errorf("failed to get API key secret %s for broker %s: %w", name, broker.Name, err)
+	}
+	key := string(secret.Data[brokerAPIKeyKey])
+	if key == "" {
+		return "", fmt.Errorf("API key secret %s has no %s", name, brokerAPIKeyKey)
+	}
+	if c.entries == nil {
+		c.entries = map[types.NamespacedName]cachedAPIKey{}
+	}
+	c.entries[name] = cachedAPIKey{key: key, expires: time.Now().Add(apiKeyCacheTTL)}
+	return key, nil
+}
+
+// brokerTLSConfig builds the client TLS configuration for an mtls broker from
+// the kubernetes.io/tls Secret its authentication references. The Secret's
+// ca.crt, if set, replaces the system roots for verifying the broker.
+func brokerTLSConfig(ctx context.Context, reader client.Reader, broker *platformv1.Broker) (*tls.Config, error) {
+	name, err := brokerSecretName(broker)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, name, secret); err != nil {
+		return nil, fmt.Errorf("failed to get client certificate secret %s for broker %s: %w", name, broker.Name, err)
+	}
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate in secret %s: %w", name, err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if ca := secret.Data[brokerCAKey]; len(ca) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s of secret %s", brokerCAKey, name)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
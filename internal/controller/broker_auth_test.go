@@ -0,0 +1,217 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+)
+
+// selfSignedClientCert returns a self-signed client certificate and its PEM
+// encoded certificate and key
+func selfSignedClientCert(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kidp-manager"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestDatabaseReconciler_MutualTLSBroker(t *testing.T) {
+	clientCert, certPEM, keyPEM := selfSignedClientCert(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+
+	var presented string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-mtls", Status: "accepted"})
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	srv.StartTLS()
+	defer srv.Close()
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tests := []struct {
+		name    string
+		secret  *corev1.Secret
+		wantErr bool
+	}{
+		{
+			name: "client certificate from secret",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-client-cert"},
+				Type:       corev1.SecretTypeTLS,
+				Data: map[string][]byte{
+					corev1.TLSCertKey:       certPEM,
+					corev1.TLSPrivateKeyKey: keyPEM,
+					"ca.crt":                serverCA,
+				},
+			},
+		},
+		{
+			name:    "secret missing",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			presented = ""
+			b := brokerFor(srv.URL, 0, 10)
+			b.Spec.Authentication = &platformv1.BrokerAuthentication{
+				Type:      platformv1.BrokerAuthMTLS,
+				SecretRef: &platformv1.SecretReference{Namespace: "kidp-system", Name: "broker-client-cert"},
+			}
+			db := provisionableDatabase("db-mtls")
+			objs := []client.Object{&platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}, b, db}
+			if tt.secret != nil {
+				objs = append(objs, tt.secret)
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(db).Build()
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error without the client certificate secret")
+				}
+				if presented != "" {
+					t.Fatal("expected the broker not to be called")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			if presented != "kidp-manager" {
+				t.Fatalf("expected the manager's client certificate, got %q", presented)
+			}
+
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			if out.Status.DeploymentID != "deploy-mtls" {
+				t.Fatalf("expected the deployment to be recorded, got %q", out.Status.DeploymentID)
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_APIKeyBroker(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	var sent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-key", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	b := brokerFor(srv.URL, 0, 10)
+	b.Spec.Authentication = &platformv1.BrokerAuthentication{
+		Type:      platformv1.BrokerAuthAPIKey,
+		SecretRef: &platformv1.SecretReference{Namespace: "kidp-system", Name: "broker-api-key"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-api-key"},
+		Data:       map[string][]byte{"api-key": []byte("key-1")},
+	}
+
+	db := provisionableDatabase("db-api-key")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, b, secret, db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if sent != "Bearer key-1" {
+		t.Fatalf("expected the API key as a bearer token, got %q", sent)
+	}
+
+	// The key is reused without reading the Secret again
+	if err := cl.Delete(context.Background(), secret); err != nil {
+		t.Fatalf("failed to delete secret: %v", err)
+	}
+	if _, err := r.brokerClient(context.Background(), b); err != nil {
+		t.Fatalf("expected the cached key to be used: %v", err)
+	}
+
+	// Without a cached key, a missing Secret fails the request
+	uncached := &DatabaseReconciler{Client: cl, Scheme: scheme}
+	if _, err := uncached.brokerClient(context.Background(), b); err == nil {
+		t.Fatal("expected an error without the API key secret")
+	}
+}
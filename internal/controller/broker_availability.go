@@ -0,0 +1,163 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ConditionBrokerUnavailable is True on a Database whose recorded broker is
+// Offline. Operators, or an automated policy, can react to it.
+const ConditionBrokerUnavailable = "BrokerUnavailable"
+
+// Reasons for the BrokerUnavailable condition
+const (
+	ReasonBrokerOffline   = "BrokerOffline"
+	ReasonBrokerAvailable = "BrokerAvailable"
+	ReasonReprovisioning  = "Reprovisioning"
+)
+
+// reconcileBrokerAvailability sets the BrokerUnavailable condition from the
+// phase of the broker that provisioned the database. With
+// ReprovisionOnBrokerOffline, a database on an Offline broker is instead
+// sent back to Pending so another broker provisions it; the deployment left
+// on the old broker is abandoned. It returns true when the reconcile should
+// stop there.
+func (r *DatabaseReconciler) reconcileBrokerAvailability(ctx context.Context, database *platformv1.Database) (ctrl.Result, bool, error) {
+	log := log.FromContext(ctx)
+
+	broker, err := r.recordedBroker(ctx, database)
+	if err != nil {
+		// A missing broker is reported when the database is deleted
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, false, nil
+		}
+		return ctrl.Result{}, false, err
+	}
+
+	if broker.Status.Phase != BrokerPhaseOffline {
+		if !meta.IsStatusConditionTrue(database.Status.Conditions, ConditionBrokerUnavailable) {
+			return ctrl.Result{}, false, nil
+		}
+		log.Info("Broker is back, clearing BrokerUnavailable", "name", database.Name, "broker", broker.Name)
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               ConditionBrokerUnavailable,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonBrokerAvailable,
+			Message:            fmt.Sprintf("Broker %s/%s is %s", broker.Namespace, broker.Name, broker.Status.Phase),
+			ObservedGeneration: database.Generation,
+		})
+		return ctrl.Result{}, false, UpdateStatusIfChanged(ctx, r.Client, database, log)
+	}
+
+	message := fmt.Sprintf("Broker %s/%s that provisioned deployment %s is Offline: %s",
+		broker.Namespace, broker.Name, database.Status.DeploymentID, broker.Status.Message)
+	if !meta.IsStatusConditionTrue(database.Status.Conditions, ConditionBrokerUnavailable) && r.Recorder != nil {
+		r.Recorder.Event(database, "Warning", ReasonBrokerOffline, message)
+	}
+	condition := metav1.Condition{
+		Type:               ConditionBrokerUnavailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonBrokerOffline,
+		Message:            message,
+		ObservedGeneration: database.Generation,
+	}
+
+	if r.ReprovisionOnBrokerOffline {
+		log.Info("Reprovisioning database away from offline broker", "name", database.Name,
+			"broker", broker.Name, "abandonedDeploymentId", database.Status.DeploymentID)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(database, "Warning", ReasonReprovisioning,
+				"Abandoning deployment %s on offline broker %s/%s and provisioning again", database.Status.DeploymentID, broker.Namespace, broker.Name)
+		}
+		if r.BrokerRegistry != nil {
+			r.BrokerRegistry.Release(database.Status.DeploymentID)
+		}
+		condition.Reason = ReasonReprovisioning
+		database.Status.DeploymentID = ""
+		database.Status.BrokerRef = nil
+		database.Status.Region = ""
+		database.Status.CallbackTokenHash = ""
+		database.Status.CallbackTokenExpiry = nil
+		database.Status.SetPhase("Pending", ReasonReprovisioning)
+		meta.SetStatusCondition(&database.Status.Conditions, condition)
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, true, err
+		}
+		return ctrl.Result{Requeue: true}, true, nil
+	}
+
+	log.Info("Database's broker is offline", "name", database.Name, "broker", broker.Name)
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		return ctrl.Result{}, true, err
+	}
+	// The Broker watch wakes the database when the broker comes back
+	return ctrl.Result{}, true, nil
+}
+
+// brokerOfflineChanged passes Brokers that go Offline or come back from it
+var brokerOfflineChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBroker, ok := e.ObjectOld.(*platformv1.Broker)
+		if !ok {
+			return false
+		}
+		newBroker, ok := e.ObjectNew.(*platformv1.Broker)
+		if !ok {
+			return false
+		}
+		return (oldBroker.Status.Phase == BrokerPhaseOffline) != (newBroker.Status.Phase == BrokerPhaseOffline)
+	},
+}
+
+// databasesOnBroker returns a request for every provisioned Database whose
+// status records the broker
+func (r *DatabaseReconciler) databasesOnBroker(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases on broker", "broker", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, db := range list.Items {
+		if db.Status.DeploymentID == "" || !db.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if brokerRefersTo(db.Status.BrokerRef, obj) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+		}
+	}
+	return requests
+}
@@ -25,26 +25,67 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/version"
 )
 
+const brokerFinalizerName = "platform.company.com/broker-cleanup"
+
+// AnnotationForceDelete, set to "true" on a Broker being deleted, removes its
+// finalizer even though deployments are still active on it. Resources left on
+// the broker are orphaned.
+const AnnotationForceDelete = "platform.company.com/force-delete"
+
+// BrokerPhaseDraining is the phase of a Broker whose deletion waits for its
+// deployments to go
+const BrokerPhaseDraining = "Draining"
+
+// brokerDrainRequeue is how often a draining Broker is checked again
+const brokerDrainRequeue = 30 * time.Second
+
+// BrokerPhaseOffline is the phase of a Broker that has kept failing its
+// health check for failureThreshold more checks after going Unhealthy.
+// Resources deployed through it are marked BrokerUnavailable.
+const BrokerPhaseOffline = "Offline"
+
+// defaultBrokerFailureThreshold is how many health checks in a row a Broker
+// may fail before it goes Unhealthy when its spec doesn't say
+const defaultBrokerFailureThreshold = 3
+
 // BrokerReconciler reconciles a Broker object
 type BrokerReconciler struct {
 	client.Client
 	Scheme     *runtime.Scheme
+	Recorder   record.EventRecorder
 	httpClient *http.Client
+
+	// ClusterReader lists the Databases, Caches and Topics that keep a
+	// broker from draining across every namespace when the manager's cache
+	// is scoped to some. Client is used when nil.
+	ClusterReader client.Reader
+
+	// MaxConcurrentReconciles is how many Brokers may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
 }
 
 // +kubebuilder:rbac:groups=platform.company.com,resources=brokers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.company.com,resources=brokers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=platform.company.com,resources=brokers/finalizers,verbs=update
+// +kubebuilder:rbac:groups=platform.company.com,resources=databases;caches;topics,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop
-func (r *BrokerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *BrokerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("broker", time.Now(), &err)
 	log := log.FromContext(ctx)
 
 	// Fetch the Broker instance
@@ -53,14 +94,23 @@ func (r *BrokerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	if !broker.DeletionTimestamp.IsZero() {
+		return r.handleDeletion(ctx, broker)
+	}
+	if requeue, err := r.helper().EnsureFinalizer(ctx, broker); err != nil || requeue {
+		return ctrl.Result{Requeue: requeue}, err
+	}
+
 	// Perform health check
 	healthy, message := r.checkBrokerHealth(ctx, broker)
 
 	// Update status based on health check
+	previousPhase := broker.Status.Phase
 	broker.Status.ObservedGeneration = broker.Generation
 	now := metav1.Now()
 
 	if healthy {
+		broker.Status.ConsecutiveFailures = 0
 		broker.Status.Phase = "Ready"
 		broker.Status.LastHeartbeat = &now
 		broker.Status.Message = "Broker is healthy and operational"
@@ -74,21 +124,50 @@ func (r *BrokerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 			ObservedGeneration: broker.Generation,
 		})
 	} else {
-		broker.Status.Phase = "Unhealthy"
-		broker.Status.Message = message
+		broker.Status.ConsecutiveFailures++
+		threshold := brokerFailureThreshold(broker)
 
-		// Set Ready condition to false
-		meta.SetStatusCondition(&broker.Status.Conditions, metav1.Condition{
-			Type:               "Ready",
-			Status:             metav1.ConditionFalse,
-			Reason:             "BrokerUnhealthy",
-			Message:            message,
-			ObservedGeneration: broker.Generation,
-		})
+		switch failures := broker.Status.ConsecutiveFailures; {
+		case failures < threshold:
+			// A transient blip leaves the broker in its phase, and selectable
+			// if it was Ready
+			if broker.Status.Phase == "" {
+				broker.Status.Phase = "Pending"
+			}
+			broker.Status.Message = fmt.Sprintf("Health check failed %d of %d times before Unhealthy: %s", failures, threshold, message)
+		case failures < 2*threshold:
+			broker.Status.Phase = "Unhealthy"
+			broker.Status.Message = message
+			meta.SetStatusCondition(&broker.Status.Conditions, metav1.Condition{
+				Type:               "Ready",
+				Status:             metav1.ConditionFalse,
+				Reason:             "BrokerUnhealthy",
+				Message:            message,
+				ObservedGeneration: broker.Generation,
+			})
+		default:
+			// Take the broker Offline once it has stayed Unhealthy as long again
+			if previousPhase != BrokerPhaseOffline {
+				log.Info("Broker is offline", "name", broker.Name, "failures", failures)
+				if r.Recorder != nil {
+					r.Recorder.Eventf(broker, "Warning", "BrokerOffline",
+						"Failed %d health checks in a row: %s", failures, message)
+				}
+			}
+			broker.Status.Phase = BrokerPhaseOffline
+			broker.Status.Message = fmt.Sprintf("Failed %d consecutive health checks: %s", failures, message)
+			meta.SetStatusCondition(&broker.Status.Conditions, metav1.Condition{
+				Type:               "Ready",
+				Status:             metav1.ConditionFalse,
+				Reason:             "BrokerOffline",
+				Message:            message,
+				ObservedGeneration: broker.Generation,
+			})
+		}
 	}
 
 	// Update the status
-	if err := r.Status().Update(ctx, broker); err != nil {
+	if err := UpdateStatusIfChanged(ctx, r.Client, broker, log); err != nil {
 		log.Error(err, "Failed to update Broker status")
 		return ctrl.Result{}, err
 	}
@@ -103,6 +182,108 @@ func (r *BrokerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	return ctrl.Result{RequeueAfter: requeueInterval}, nil
 }
 
+// brokerFailureThreshold is how many health checks in a row the broker may
+// fail before it goes Unhealthy
+func brokerFailureThreshold(broker *platformv1.Broker) int32 {
+	if broker.Spec.HealthCheck != nil && broker.Spec.HealthCheck.FailureThreshold > 0 {
+		return broker.Spec.HealthCheck.FailureThreshold
+	}
+	return defaultBrokerFailureThreshold
+}
+
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *BrokerReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Broker", Finalizer: brokerFinalizerName}
+}
+
+// handleDeletion keeps a Broker's finalizer while it still has active
+// deployments or resources recorded against it, so they aren't orphaned.
+// The Broker is marked Draining, which also keeps new work off it, until
+// they are gone or the force-delete annotation is set.
+func (r *BrokerReconciler) handleDeletion(ctx context.Context, broker *platformv1.Broker) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(broker, brokerFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+
+	blocker, err := r.drainBlocker(ctx, broker)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if blocker != "" {
+		if broker.Annotations[AnnotationForceDelete] != "true" {
+			message := fmt.Sprintf("Deletion waits for %s; set %s=true to delete anyway", blocker, AnnotationForceDelete)
+			log.Info("Broker deletion blocked", "name", broker.Name, "reason", blocker)
+			if r.Recorder != nil {
+				r.Recorder.Event(broker, "Warning", "DeletionBlocked", message)
+			}
+			broker.Status.Phase = BrokerPhaseDraining
+			broker.Status.Message = message
+			if err := r.helper().UpdateStatus(ctx, broker); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: brokerDrainRequeue}, nil
+		}
+		log.Info("Force-deleting Broker", "name", broker.Name, "orphaned", blocker)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(broker, "Warning", "ForceDeleted", "Deleted with %s orphaned", blocker)
+		}
+	}
+
+	return r.helper().HandleDeletion(ctx, broker, nil)
+}
+
+// drainBlocker describes what still depends on the broker, or returns "" if
+// nothing does: deployments it reports as active, or Databases, Caches and
+// Topics whose status records it
+func (r *BrokerReconciler) drainBlocker(ctx context.Context, broker *platformv1.Broker) (string, error) {
+	if broker.Status.ActiveDeployments > 0 {
+		return fmt.Sprintf("%d active deployment(s)", broker.Status.ActiveDeployments), nil
+	}
+
+	reader := clusterListReader(r.ClusterReader, r.Client)
+	count := 0
+	databases := &platformv1.DatabaseList{}
+	if err := reader.List(ctx, databases); err != nil {
+		return "", fmt.Errorf("failed to list databases: %w", err)
+	}
+	for i := range databases.Items {
+		if brokerRefersTo(databases.Items[i].Status.BrokerRef, broker) {
+			count++
+		}
+	}
+	caches := &platformv1.CacheList{}
+	if err := reader.List(ctx, caches); err != nil {
+		return "", fmt.Errorf("failed to list caches: %w", err)
+	}
+	for i := range caches.Items {
+		if brokerRefersTo(caches.Items[i].Status.BrokerRef, broker) {
+			count++
+		}
+	}
+	topics := &platformv1.TopicList{}
+	if err := reader.List(ctx, topics); err != nil {
+		return "", fmt.Errorf("failed to list topics: %w", err)
+	}
+	for i := range topics.Items {
+		if brokerRefersTo(topics.Items[i].Status.BrokerRef, broker) {
+			count++
+		}
+	}
+	if count > 0 {
+		return fmt.Sprintf("%d resource(s) deployed through it", count), nil
+	}
+	return "", nil
+}
+
+// brokerRefersTo reports whether a resource's status.brokerRef names the
+// broker. Refs recorded without a namespace are matched on name alone.
+func brokerRefersTo(ref *platformv1.ObjectReference, broker client.Object) bool {
+	return ref != nil && ref.Name == broker.GetName() && (ref.Namespace == "" || ref.Namespace == broker.GetNamespace())
+}
+
 // checkBrokerHealth performs a health check against the broker endpoint
 func (r *BrokerReconciler) checkBrokerHealth(ctx context.Context, broker *platformv1.Broker) (bool, string) {
 	// Build health check URL
@@ -126,6 +307,7 @@ func (r *BrokerReconciler) checkBrokerHealth(ctx context.Context, broker *platfo
 	if err != nil {
 		return false, fmt.Sprintf("Failed to create health check request: %v", err)
 	}
+	version.SetHeaders(req, version.ComponentManager)
 
 	// Execute request
 	resp, err := r.httpClient.Do(req)
@@ -144,6 +326,8 @@ func (r *BrokerReconciler) checkBrokerHealth(ctx context.Context, broker *platfo
 
 // SetupWithManager sets up the controller with the Manager
 func (r *BrokerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("broker-controller")
+
 	// Initialize HTTP client if not set
 	if r.httpClient == nil {
 		r.httpClient = &http.Client{
@@ -153,5 +337,6 @@ func (r *BrokerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&platformv1.Broker{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
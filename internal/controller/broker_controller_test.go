@@ -0,0 +1,335 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestBrokerReconciler_AddsFinalizer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	b := brokerFor(srv.URL, 0, 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).WithStatusSubresource(b).Build()
+	r := &BrokerReconciler{Client: cl, Scheme: scheme, httpClient: srv.Client()}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Broker{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(b), out); err != nil {
+		t.Fatalf("failed to get broker: %v", err)
+	}
+	if !controllerutil.ContainsFinalizer(out, brokerFinalizerName) {
+		t.Fatalf("expected the %s finalizer, got %v", brokerFinalizerName, out.Finalizers)
+	}
+}
+
+func TestBrokerReconciler_DrainsBeforeDeletion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	deployed := provisionableDatabase("db-deployed")
+	deployed.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	elsewhere := provisionableDatabase("db-elsewhere")
+	elsewhere.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-b"}
+
+	tests := []struct {
+		name        string
+		active      int32
+		force       bool
+		objs        []client.Object
+		wantBlocked string
+	}{
+		{
+			name:        "active deployments",
+			active:      2,
+			wantBlocked: "2 active deployment(s)",
+		},
+		{
+			name:        "database recorded against the broker",
+			objs:        []client.Object{deployed, elsewhere},
+			wantBlocked: "1 resource(s) deployed through it",
+		},
+		{
+			name: "nothing left on the broker",
+			objs: []client.Object{elsewhere},
+		},
+		{
+			name:   "force-delete annotation",
+			active: 2,
+			objs:   []client.Object{deployed},
+			force:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := brokerFor("http://broker", tt.active, 10)
+			b.Finalizers = []string{brokerFinalizerName}
+			b.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+			if tt.force {
+				b.Annotations = map[string]string{AnnotationForceDelete: "true"}
+			}
+			objs := append([]client.Object{b}, tt.objs...)
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(b).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &BrokerReconciler{Client: cl, Scheme: scheme, Recorder: recorder}
+
+			result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)})
+			if err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+
+			out := &platformv1.Broker{}
+			getErr := cl.Get(context.Background(), client.ObjectKeyFromObject(b), out)
+			if tt.wantBlocked == "" {
+				if !errors.IsNotFound(getErr) {
+					t.Fatalf("expected the broker to be deleted, got %v (finalizers %v)", getErr, out.Finalizers)
+				}
+				if tt.force && !strings.Contains(<-recorder.Events, "ForceDeleted") {
+					t.Fatal("expected a ForceDeleted event")
+				}
+				return
+			}
+
+			if getErr != nil {
+				t.Fatalf("expected the broker to be kept: %v", getErr)
+			}
+			if out.Status.Phase != BrokerPhaseDraining || !strings.Contains(out.Status.Message, tt.wantBlocked) {
+				t.Fatalf("expected phase Draining waiting for %s, got %s: %s", tt.wantBlocked, out.Status.Phase, out.Status.Message)
+			}
+			if result.RequeueAfter != brokerDrainRequeue {
+				t.Fatalf("expected a requeue after %v, got %+v", brokerDrainRequeue, result)
+			}
+			if event := <-recorder.Events; !strings.Contains(event, "DeletionBlocked") {
+				t.Fatalf("expected a DeletionBlocked event, got %q", event)
+			}
+		})
+	}
+}
+
+func TestBrokerReconciler_HonorsFailureThreshold(t *testing.T) {
+	type check struct {
+		healthy      bool
+		wantPhase    string
+		wantFailures int32
+	}
+	tests := []struct {
+		name         string
+		initialPhase string
+		checks       []check
+		wantOffline  bool
+	}{
+		{
+			name:         "transient blip stays Ready",
+			initialPhase: "Ready",
+			checks: []check{
+				{false, "Ready", 1},
+				{false, "Ready", 2},
+				{true, "Ready", 0},
+				{false, "Ready", 1},
+			},
+		},
+		{
+			name:         "unhealthy at the threshold and recovers on one success",
+			initialPhase: "Ready",
+			checks: []check{
+				{false, "Ready", 1},
+				{false, "Ready", 2},
+				{false, "Unhealthy", 3},
+				{true, "Ready", 0},
+			},
+		},
+		{
+			name:         "offline at twice the threshold",
+			initialPhase: "Ready",
+			checks: []check{
+				{false, "Ready", 1},
+				{false, "Ready", 2},
+				{false, "Unhealthy", 3},
+				{false, "Unhealthy", 4},
+				{false, "Unhealthy", 5},
+				{false, BrokerPhaseOffline, 6},
+				{false, BrokerPhaseOffline, 7},
+				{true, "Ready", 0},
+			},
+			wantOffline: true,
+		},
+		{
+			name: "new broker waits in Pending",
+			checks: []check{
+				{false, "Pending", 1},
+				{true, "Ready", 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy := false
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !healthy {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+
+			scheme := runtime.NewScheme()
+			_ = platformv1.AddToScheme(scheme)
+
+			b := brokerFor(srv.URL, 0, 10)
+			b.Finalizers = []string{brokerFinalizerName}
+			b.Spec.HealthCheck = &platformv1.HealthCheckConfig{FailureThreshold: 3}
+			b.Status.Phase = tt.initialPhase
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).WithStatusSubresource(b).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &BrokerReconciler{Client: cl, Scheme: scheme, Recorder: recorder, httpClient: srv.Client()}
+
+			for i, c := range tt.checks {
+				healthy = c.healthy
+				if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)}); err != nil {
+					t.Fatalf("check %d: reconcile returned error: %v", i+1, err)
+				}
+				out := &platformv1.Broker{}
+				if err := cl.Get(context.Background(), client.ObjectKeyFromObject(b), out); err != nil {
+					t.Fatalf("failed to get broker: %v", err)
+				}
+				if out.Status.Phase != c.wantPhase || out.Status.ConsecutiveFailures != c.wantFailures {
+					t.Fatalf("check %d: expected %s with %d failure(s), got %s with %d",
+						i+1, c.wantPhase, c.wantFailures, out.Status.Phase, out.Status.ConsecutiveFailures)
+				}
+				if cond := meta.FindStatusCondition(out.Status.Conditions, "Ready"); c.wantPhase == "Unhealthy" && (cond == nil || cond.Status != metav1.ConditionFalse) {
+					t.Fatalf("check %d: expected the Ready condition to be False, got %+v", i+1, cond)
+				}
+			}
+
+			// The BrokerOffline event is recorded once
+			var offlineEvents int
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, "BrokerOffline") {
+					offlineEvents++
+				}
+			}
+			if want := map[bool]int{true: 1}[tt.wantOffline]; offlineEvents != want {
+				t.Fatalf("expected %d BrokerOffline event(s), got %d", want, offlineEvents)
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_BrokerOffline(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	offline := brokerFor("http://broker-a", 0, 10)
+	offline.Status.Phase = BrokerPhaseOffline
+	offline.Status.Message = "Failed 3 consecutive health checks"
+
+	tests := []struct {
+		name        string
+		reprovision bool
+	}{
+		{name: "marked unavailable"},
+		{name: "reprovisioned", reprovision: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := provisionableDatabase("db1")
+			db.Status.Phase = "Ready"
+			db.Status.DeploymentID = "deploy-1"
+			db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+			broker := offline.DeepCopy()
+			tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, broker, db).
+				WithStatusSubresource(db, broker).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, ReprovisionOnBrokerOffline: tt.reprovision}
+
+			if requests := r.databasesOnBroker(context.Background(), broker); len(requests) != 1 || requests[0].Name != "db1" {
+				t.Fatalf("expected the broker to map to db1, got %v", requests)
+			}
+
+			req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+			res, err := r.Reconcile(context.Background(), req)
+			if err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+				t.Fatalf("failed to get database: %v", err)
+			}
+			cond := meta.FindStatusCondition(out.Status.Conditions, ConditionBrokerUnavailable)
+			if cond == nil || cond.Status != metav1.ConditionTrue {
+				t.Fatalf("expected BrokerUnavailable to be True, got %+v", cond)
+			}
+			if event := <-recorder.Events; !strings.Contains(event, ReasonBrokerOffline) {
+				t.Fatalf("expected a BrokerOffline event, got %q", event)
+			}
+
+			if tt.reprovision {
+				if out.Status.Phase != "Pending" || out.Status.DeploymentID != "" || out.Status.BrokerRef != nil || !res.Requeue {
+					t.Fatalf("expected the database to be sent back to Pending for reprovisioning, got phase=%s deploymentId=%q brokerRef=%v result=%+v",
+						out.Status.Phase, out.Status.DeploymentID, out.Status.BrokerRef, res)
+				}
+				return
+			}
+			if out.Status.Phase != "Ready" || out.Status.DeploymentID != "deploy-1" {
+				t.Fatalf("expected the deployment to be kept, got phase=%s deploymentId=%q", out.Status.Phase, out.Status.DeploymentID)
+			}
+
+			// The condition clears when the broker comes back
+			broker.Status.Phase = "Ready"
+			if err := cl.Status().Update(context.Background(), broker); err != nil {
+				t.Fatalf("failed to update broker: %v", err)
+			}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+				t.Fatalf("failed to get database: %v", err)
+			}
+			if cond := meta.FindStatusCondition(out.Status.Conditions, ConditionBrokerUnavailable); cond == nil || cond.Status != metav1.ConditionFalse {
+				t.Fatalf("expected BrokerUnavailable to be False, got %+v", cond)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// ConditionInventoryConsistent reports on a Broker whether every database
+// deployment in its inventory is recorded by a Database
+const ConditionInventoryConsistent = "InventoryConsistent"
+
+// ConditionOrphanedDesiredState is True on a Ready Database whose deployment
+// isn't in its broker's inventory, e.g. because it was deleted behind the
+// manager's back
+const ConditionOrphanedDesiredState = "OrphanedDesiredState"
+
+// Reasons for the InventoryConsistent and OrphanedDesiredState conditions
+const (
+	ReasonInventoryInSync      = "InSync"
+	ReasonOrphanedDeployments  = "OrphanedDeployments"
+	ReasonInventoryUnavailable = "InventoryUnavailable"
+	ReasonNotInBrokerInventory = "NotInBrokerInventory"
+	ReasonInBrokerInventory    = "InBrokerInventory"
+)
+
+// Event reasons for the cleanup of orphaned deployments
+const (
+	ReasonOrphanCleanedUp     = "OrphanCleanedUp"
+	ReasonOrphanCleanupFailed = "OrphanCleanupFailed"
+)
+
+// defaultInventoryInterval is how often a Broker's inventory is checked when
+// InventoryReconciler.Interval is unset
+const defaultInventoryInterval = 5 * time.Minute
+
+// InventoryReconciler periodically asks each Ready Broker for the deployments
+// it manages and cross-checks them against the Databases, flagging orphans on
+// either side. Databases are never changed beyond their status; orphaned
+// deployments are deprovisioned only when CleanupOrphans is set.
+type InventoryReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// APIReader reads brokers' authentication Secrets. Client is used when nil.
+	APIReader client.Reader
+
+	// SigningKey signs requests to brokers whose authentication type is ed25519
+	SigningKey ed25519.PrivateKey
+
+	// Interval is how often each Broker's inventory is checked. Zero uses
+	// defaultInventoryInterval.
+	Interval time.Duration
+
+	// CleanupOrphans deprovisions database deployments that have had no
+	// Database for two checks in a row. The second check keeps a deployment
+	// whose Database hasn't recorded it yet from being removed.
+	CleanupOrphans bool
+
+	// Namespaces restricts the check to deployments requested from those
+	// namespaces, the ones whose Databases the manager's cache holds. A
+	// deployment from another namespace is never flagged as an orphan, since
+	// its Database can't be seen. Empty checks every namespace.
+	Namespaces WatchNamespaces
+
+	// apiKeys caches the API keys of brokers authenticated by api-key
+	apiKeys apiKeyCache
+}
+
+// +kubebuilder:rbac:groups=platform.company.com,resources=brokers,verbs=get;list;watch
+// +kubebuilder:rbac:groups=platform.company.com,resources=brokers/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=platform.company.com,resources=databases,verbs=get;list;watch
+// +kubebuilder:rbac:groups=platform.company.com,resources=databases/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// Reconcile checks one Broker's inventory
+func (r *InventoryReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("broker-inventory", time.Now(), &err)
+	log := log.FromContext(ctx)
+
+	broker := &platformv1.Broker{}
+	if err := r.Get(ctx, req.NamespacedName, broker); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !broker.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = defaultInventoryInterval
+	}
+	// An unhealthy broker's inventory is checked once it is back
+	if broker.Status.Phase != "Ready" {
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	brokerClient, err := authenticatedBrokerClient(ctx, reader, &r.apiKeys, r.SigningKey, broker)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	inventory, err := brokerClient.Inventory(ctx)
+	if err != nil {
+		log.Info("Could not get broker inventory", "broker", broker.Name, "err", err)
+		meta.SetStatusCondition(&broker.Status.Conditions, metav1.Condition{
+			Type:               ConditionInventoryConsistent,
+			Status:             metav1.ConditionUnknown,
+			Reason:             ReasonInventoryUnavailable,
+			Message:            fmt.Sprintf("Could not get the broker's inventory: %v", err),
+			ObservedGeneration: broker.Generation,
+		})
+		if err := UpdateStatusIfChanged(ctx, r.Client, broker, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: interval}, nil
+	}
+
+	var databases platformv1.DatabaseList
+	if err := r.List(ctx, &databases); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// Broker side: database deployments no Database records
+	recorded := map[string]bool{}
+	for _, db := range databases.Items {
+		if db.Status.DeploymentID != "" {
+			recorded[db.Status.DeploymentID] = true
+		}
+	}
+	held := map[string]bool{}
+	var orphans []brokerclient.InventoryItem
+	for _, item := range inventory.Deployments {
+		held[item.DeploymentID] = true
+		if platformv1.NormalizeResourceType(item.ResourceType) == platformv1.ResourceTypeDatabase &&
+			r.inScope(item.Namespace) && !recorded[item.DeploymentID] {
+			orphans = append(orphans, item)
+		}
+	}
+	slices.SortFunc(orphans, func(a, b brokerclient.InventoryItem) int {
+		return strings.Compare(a.DeploymentID, b.DeploymentID)
+	})
+	var orphaned []string
+	for _, item := range orphans {
+		orphaned = append(orphaned, item.DeploymentID)
+	}
+	previouslyOrphaned := broker.Status.OrphanedDeployments
+	if err := r.recordOrphanedDeployments(ctx, broker, orphaned); err != nil {
+		return ctrl.Result{}, err
+	}
+	if r.CleanupOrphans {
+		for _, item := range orphans {
+			if slices.Contains(previouslyOrphaned, item.DeploymentID) {
+				r.cleanupOrphan(ctx, brokerClient, broker, item)
+			}
+		}
+	}
+
+	// Manager side: Ready Databases whose deployment the broker doesn't have
+	for i := range databases.Items {
+		db := &databases.Items[i]
+		if db.Status.DeploymentID == "" || !db.DeletionTimestamp.IsZero() || !brokerRefersTo(db.Status.BrokerRef, broker) || !r.inScope(db.Namespace) {
+			continue
+		}
+		if err := r.recordOrphanedDesiredState(ctx, db, broker, !held[db.Status.DeploymentID]); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	log.V(1).Info("Checked broker inventory", "broker", broker.Name, "deployments", len(inventory.Deployments), "orphaned", len(orphaned))
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// inScope reports whether a broker deployment requested from namespace is
+// compared with the Databases. A deployment that doesn't name its namespace
+// only is when every namespace is watched.
+func (r *InventoryReconciler) inScope(namespace string) bool {
+	if namespace == "" {
+		return len(r.Namespaces) == 0
+	}
+	return r.Namespaces.Contains(namespace)
+}
+
+// recordOrphanedDeployments sets the broker's orphaned deployments and its
+// InventoryConsistent condition, with a Warning event when new orphans appear
+func (r *InventoryReconciler) recordOrphanedDeployments(ctx context.Context, broker *platformv1.Broker, orphaned []string) error {
+	condition := metav1.Condition{
+		Type:               ConditionInventoryConsistent,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonInventoryInSync,
+		Message:            "Every database deployment on the broker is recorded by a Database",
+		ObservedGeneration: broker.Generation,
+	}
+	if len(orphaned) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = ReasonOrphanedDeployments
+		condition.Message = fmt.Sprintf("%d deployment(s) on the broker have no Database: %s", len(orphaned), strings.Join(orphaned, ", "))
+		var added []string
+		for _, id := range orphaned {
+			if !slices.Contains(broker.Status.OrphanedDeployments, id) {
+				added = append(added, id)
+			}
+		}
+		if len(added) > 0 && r.Recorder != nil {
+			r.Recorder.Eventf(broker, "Warning", ReasonOrphanedDeployments,
+				"Deployment(s) %s have no Database", strings.Join(added, ", "))
+		}
+	}
+	broker.Status.OrphanedDeployments = orphaned
+	meta.SetStatusCondition(&broker.Status.Conditions, condition)
+	return UpdateStatusIfChanged(ctx, r.Client, broker, log.FromContext(ctx))
+}
+
+// cleanupOrphan asks the broker to deprovision a deployment no Database
+// records. Failures are reported and retried on the next check rather than
+// failing the reconcile, so one stuck deployment doesn't hold up the rest.
+func (r *InventoryReconciler) cleanupOrphan(ctx context.Context, brokerClient *brokerclient.Client, broker *platformv1.Broker, item brokerclient.InventoryItem) {
+	log := log.FromContext(ctx)
+
+	_, err := brokerClient.Deprovision(ctx, brokerclient.DeprovisionRequest{
+		DeploymentID:    item.DeploymentID,
+		ResourceType:    platformv1.ResourceTypeDatabase,
+		ResourceName:    item.ResourceName,
+		Namespace:       item.Namespace,
+		TargetNamespace: item.TargetNamespace,
+		CallbackURL:     managerCallbackURL(),
+	})
+	if err != nil {
+		log.Error(err, "Failed to deprovision orphaned deployment", "broker", broker.Name, "deploymentId", item.DeploymentID)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(broker, "Warning", ReasonOrphanCleanupFailed,
+				"Failed to deprovision orphaned deployment %s: %v", item.DeploymentID, err)
+		}
+		return
+	}
+	log.Info("Deprovisioned orphaned deployment", "broker", broker.Name, "deploymentId", item.DeploymentID,
+		"resourceName", item.ResourceName, "namespace", item.Namespace)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(broker, "Normal", ReasonOrphanCleanedUp,
+			"Requested deprovisioning of orphaned deployment %s (%s/%s)", item.DeploymentID, item.Namespace, item.ResourceName)
+	}
+}
+
+// recordOrphanedDesiredState sets a provisioned database's
+// OrphanedDesiredState condition. Only Ready databases are flagged, since the broker may not have
+// created anything for a deployment still in progress.
+func (r *InventoryReconciler) recordOrphanedDesiredState(ctx context.Context, database *platformv1.Database, broker *platformv1.Broker, missing bool) error {
+	wasMissing := meta.IsStatusConditionTrue(database.Status.Conditions, ConditionOrphanedDesiredState)
+	switch {
+	case missing && database.Status.Phase == "Ready":
+		message := fmt.Sprintf("Deployment %s is not in the inventory of broker %s/%s",
+			database.Status.DeploymentID, broker.Namespace, broker.Name)
+		if !wasMissing && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", ReasonNotInBrokerInventory, message)
+		}
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               ConditionOrphanedDesiredState,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonNotInBrokerInventory,
+			Message:            message,
+			ObservedGeneration: database.Generation,
+		})
+	case !missing && wasMissing:
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               ConditionOrphanedDesiredState,
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonInBrokerInventory,
+			Message:            fmt.Sprintf("Deployment %s is in the inventory of broker %s/%s", database.Status.DeploymentID, broker.Namespace, broker.Name),
+			ObservedGeneration: database.Generation,
+		})
+	default:
+		return nil
+	}
+	return UpdateStatusIfChanged(ctx, r.Client, database, log.FromContext(ctx))
+}
+
+// SetupWithManager sets up the controller with the Manager. Status updates,
+// including its own and the health checks', don't trigger a check; the
+// interval does.
+func (r *InventoryReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("broker-inventory-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("broker-inventory").
+		For(&platformv1.Broker{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
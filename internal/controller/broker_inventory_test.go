@@ -0,0 +1,271 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+func TestInventoryReconciler_FlagsOrphans(t *testing.T) {
+	inventory := []brokerclient.InventoryItem{
+		{DeploymentID: "deploy-1", ResourceType: "database", ResourceName: "db1", Namespace: "dev", Phase: "Ready"},
+		{DeploymentID: "deploy-orphan", ResourceType: "database", ResourceName: "old-db", Namespace: "dev", Phase: "Ready"},
+		{DeploymentID: "deploy-cache", ResourceType: "cache", ResourceName: "sessions", Namespace: "dev", Phase: "Ready"},
+	}
+	deprovisioned := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/inventory":
+			_ = json.NewEncoder(w).Encode(brokerclient.InventoryResponse{Deployments: inventory, Total: len(inventory)})
+		case "/v1/deprovision":
+			deprovisioned++
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.DeprovisionResponse{Status: "accepted"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	provisioned := func(name, deploymentID, phase string) *platformv1.Database {
+		db := provisionableDatabase(name)
+		db.Status.Phase = phase
+		db.Status.DeploymentID = deploymentID
+		db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+		return db
+	}
+	present := provisioned("db1", "deploy-1", "Ready")
+	gone := provisioned("db-gone", "deploy-2", "Ready")
+	inProgress := provisioned("db-new", "deploy-3", "Provisioning")
+	b := brokerFor(srv.URL, 0, 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b, present, gone, inProgress).
+		WithStatusSubresource(b, present, gone, inProgress).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &InventoryReconciler{Client: cl, Scheme: scheme, Recorder: recorder, Interval: time.Minute}
+
+	reconcileAndGet := func() (*platformv1.Broker, map[string]*metav1.Condition) {
+		t.Helper()
+		result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)})
+		if err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+		if result.RequeueAfter != time.Minute {
+			t.Fatalf("expected the inventory to be checked again after a minute, got %+v", result)
+		}
+		out := &platformv1.Broker{}
+		if err := cl.Get(context.Background(), client.ObjectKeyFromObject(b), out); err != nil {
+			t.Fatalf("failed to get broker: %v", err)
+		}
+		missing := map[string]*metav1.Condition{}
+		for _, db := range []*platformv1.Database{present, gone, inProgress} {
+			got := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), got); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			missing[db.Name] = meta.FindStatusCondition(got.Status.Conditions, ConditionOrphanedDesiredState)
+		}
+		return out, missing
+	}
+
+	out, missing := reconcileAndGet()
+	if !slices.Equal(out.Status.OrphanedDeployments, []string{"deploy-orphan"}) {
+		t.Fatalf("expected deploy-orphan to be orphaned, got %v", out.Status.OrphanedDeployments)
+	}
+	if !meta.IsStatusConditionFalse(out.Status.Conditions, ConditionInventoryConsistent) {
+		t.Fatalf("expected InventoryConsistent False, got %+v", out.Status.Conditions)
+	}
+	if cond := missing["db-gone"]; cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != ReasonNotInBrokerInventory {
+		t.Fatalf("expected db-gone's deployment to be missing, got %+v", cond)
+	}
+	if missing["db1"] != nil || missing["db-new"] != nil {
+		t.Fatalf("expected only Ready databases missing from the inventory to be flagged, got db1=%+v db-new=%+v", missing["db1"], missing["db-new"])
+	}
+	if !hasEvent(recorder, ReasonOrphanedDeployments) {
+		t.Fatal("expected an OrphanedDeployments event")
+	}
+
+	// Without CleanupOrphans, orphans are only reported
+	reconcileAndGet()
+	if deprovisioned != 0 {
+		t.Fatalf("expected no orphan to be deprovisioned without CleanupOrphans, got %d", deprovisioned)
+	}
+
+	// Once the orphan is cleaned up and db-gone's deployment is back, both
+	// sides are in sync
+	inventory[1].DeploymentID = "deploy-2"
+	out, missing = reconcileAndGet()
+	if len(out.Status.OrphanedDeployments) != 0 || !meta.IsStatusConditionTrue(out.Status.Conditions, ConditionInventoryConsistent) {
+		t.Fatalf("expected the inventory to be in sync, got orphaned=%v conditions=%+v", out.Status.OrphanedDeployments, out.Status.Conditions)
+	}
+	if cond := missing["db-gone"]; cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonInBrokerInventory {
+		t.Fatalf("expected db-gone's deployment to be found again, got %+v", cond)
+	}
+}
+
+func TestInventoryReconciler_IgnoresDeploymentsOutsideWatchScope(t *testing.T) {
+	var deprovisioned []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/inventory":
+			items := []brokerclient.InventoryItem{
+				{DeploymentID: "deploy-dev", ResourceType: "database", ResourceName: "db-dev", Namespace: "dev", Phase: "Ready"},
+				// Recorded by a Database the scoped cache doesn't hold
+				{DeploymentID: "deploy-prod", ResourceType: "database", ResourceName: "db-prod", Namespace: "prod", Phase: "Ready"},
+			}
+			_ = json.NewEncoder(w).Encode(brokerclient.InventoryResponse{Deployments: items, Total: len(items)})
+		case "/v1/deprovision":
+			var req brokerclient.DeprovisionRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			deprovisioned = append(deprovisioned, req.DeploymentID)
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.DeprovisionResponse{Status: "accepted"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	b := brokerFor(srv.URL, 0, 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).WithStatusSubresource(b).Build()
+	r := &InventoryReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(20), CleanupOrphans: true, Namespaces: WatchNamespaces{"dev"}}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)}
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+	}
+
+	out := &platformv1.Broker{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get broker: %v", err)
+	}
+	if !slices.Equal(out.Status.OrphanedDeployments, []string{"deploy-dev"}) {
+		t.Fatalf("expected only the watched namespace's deployment to be flagged, got %v", out.Status.OrphanedDeployments)
+	}
+	if !slices.Equal(deprovisioned, []string{"deploy-dev"}) {
+		t.Fatalf("expected only the watched namespace's orphan to be cleaned up, got %v", deprovisioned)
+	}
+}
+
+func TestInventoryReconciler_InventoryUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "kubernetes_unavailable"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	b := brokerFor(srv.URL, 0, 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).WithStatusSubresource(b).Build()
+	r := &InventoryReconciler{Client: cl, Scheme: scheme}
+
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)})
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter != defaultInventoryInterval {
+		t.Fatalf("expected a retry after the default interval, got %+v", result)
+	}
+	out := &platformv1.Broker{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(b), out); err != nil {
+		t.Fatalf("failed to get broker: %v", err)
+	}
+	cond := meta.FindStatusCondition(out.Status.Conditions, ConditionInventoryConsistent)
+	if cond == nil || cond.Status != metav1.ConditionUnknown || cond.Reason != ReasonInventoryUnavailable {
+		t.Fatalf("expected InventoryConsistent Unknown, got %+v", out.Status.Conditions)
+	}
+}
+
+func TestInventoryReconciler_CleansUpOrphans(t *testing.T) {
+	var deprovisioned []brokerclient.DeprovisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/inventory":
+			items := []brokerclient.InventoryItem{{
+				DeploymentID: "deploy-orphan", ResourceType: "database", ResourceName: "old-db",
+				Namespace: "team-b", TargetNamespace: "infra-databases", Phase: "Ready",
+			}}
+			_ = json.NewEncoder(w).Encode(brokerclient.InventoryResponse{Deployments: items, Total: len(items)})
+		case "/v1/deprovision":
+			var req brokerclient.DeprovisionRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			deprovisioned = append(deprovisioned, req)
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.DeprovisionResponse{Status: "accepted"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	b := brokerFor(srv.URL, 0, 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b).WithStatusSubresource(b).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &InventoryReconciler{Client: cl, Scheme: scheme, Recorder: recorder, CleanupOrphans: true}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(b)}
+
+	// A deployment seen orphaned once may just not be recorded yet
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(deprovisioned) != 0 {
+		t.Fatalf("expected no cleanup on the first sighting, got %+v", deprovisioned)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(deprovisioned) != 1 {
+		t.Fatalf("expected the orphan to be deprovisioned on the second check, got %+v", deprovisioned)
+	}
+	got := deprovisioned[0]
+	if got.DeploymentID != "deploy-orphan" || got.ResourceName != "old-db" || got.Namespace != "team-b" || got.TargetNamespace != "infra-databases" {
+		t.Fatalf("unexpected deprovision request: %+v", got)
+	}
+	if !hasEvent(recorder, ReasonOrphanCleanedUp) {
+		t.Fatal("expected an OrphanCleanedUp event")
+	}
+}
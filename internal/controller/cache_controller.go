@@ -0,0 +1,461 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/tracing"
+)
+
+const cacheFinalizerName = "platform.company.com/cache-cleanup"
+
+// CacheReconciler reconciles a Cache object
+type CacheReconciler struct {
+	client.Client
+	Scheme         *runtime.Scheme
+	BrokerRegistry *brokerregistry.Registry
+	Recorder       record.EventRecorder
+
+	// APIReader reads brokers' authentication Secrets. Client is used when nil.
+	APIReader client.Reader
+
+	// SigningKey is the manager's Ed25519 key, used to sign requests to
+	// brokers whose authentication type is ed25519
+	SigningKey ed25519.PrivateKey
+
+	// MaxConcurrentReconciles is how many Caches may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+
+	// Namespaces restricts the Caches reconciled to those namespaces. Empty
+	// reconciles every namespace.
+	Namespaces WatchNamespaces
+
+	// apiKeys caches the API keys of brokers authenticated by api-key
+	apiKeys apiKeyCache
+}
+
+// +kubebuilder:rbac:groups=platform.company.com,resources=caches,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=platform.company.com,resources=caches/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=platform.company.com,resources=caches/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// Reconcile is part of the main kubernetes reconciliation loop
+func (r *CacheReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("cache", time.Now(), &err)
+	log := log.FromContext(ctx)
+
+	cache := &platformv1.Cache{}
+	if err := r.Get(ctx, req.NamespacedName, cache); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Cache resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Cache")
+		return ctrl.Result{}, err
+	}
+
+	if !cache.DeletionTimestamp.IsZero() {
+		return r.handleDeletion(ctx, cache)
+	}
+
+	fetched := cache.DeepCopy()
+	result, err = r.reconcileCache(ctx, cache)
+	r.recordReconcile(ctx, fetched, cache, err)
+	return result, err
+}
+
+// reconcileCache drives a live Cache towards its desired state
+func (r *CacheReconciler) reconcileCache(ctx context.Context, cache *platformv1.Cache) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if added, err := r.helper().EnsureFinalizer(ctx, cache); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
+	}
+
+	log.Info("Reconciling Cache",
+		"name", cache.Name,
+		"namespace", cache.Namespace,
+		"engine", cache.Spec.Engine,
+		"size", cache.Spec.Size)
+
+	tenant, terr := ResolveTenant(ctx, r.Client, cache)
+	if terr != nil {
+		log.Info("Unable to resolve tenant for cache, suspending until tenant is available", "cache", cache.Name, "err", terr)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(cache, "Warning", "TenantUnresolved", "tenant could not be resolved: %v", terr)
+		}
+		cache.Status.Phase = "Suspended"
+		setWaitingCondition(&cache.Status.Conditions, cache.Generation, WaitingReasonTenantUnresolved, fmt.Sprintf("Tenant could not be resolved: %v", terr))
+		if err := UpdateStatusIfChanged(ctx, r.Client, cache, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if cache.Status.Phase == "Suspended" {
+		log.Info("Tenant resolved, resuming suspended cache", "cache", cache.Name, "tenant", tenant.Name)
+		cache.Status.Phase = "Pending"
+		meta.RemoveStatusCondition(&cache.Status.Conditions, ConditionWaiting)
+		if err := UpdateStatusIfChanged(ctx, r.Client, cache, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Label with the tenant so it can be found by tenant-wide queries
+	if cache.Labels == nil {
+		cache.Labels = map[string]string{}
+	}
+	if cache.Labels["platform.company.com/tenant"] != tenant.Name {
+		cache.Labels["platform.company.com/tenant"] = tenant.Name
+		if err := r.Update(ctx, cache); err != nil {
+			log.Error(err, "Failed to label Cache with tenant")
+			return ctrl.Result{}, err
+		}
+		if r.Recorder != nil {
+			r.Recorder.Eventf(cache, "Normal", "TenantAssigned", "Assigned tenant %s to cache %s", tenant.Name, cache.Name)
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Status updates for an existing deployment come via webhook callbacks
+	if cache.Status.DeploymentID != "" {
+		log.Info("Cache already provisioned or in progress",
+			"deploymentId", cache.Status.DeploymentID,
+			"phase", cache.Status.Phase)
+		return ctrl.Result{}, nil
+	}
+
+	if tenant.Status.Phase == "Suspended" {
+		log.Info("Tenant is suspended, waiting before provisioning", "cache", cache.Name, "tenant", tenant.Name)
+		cache.Status.Phase = "Pending"
+		setWaitingCondition(&cache.Status.Conditions, cache.Generation, WaitingReasonTenantSuspended, fmt.Sprintf("Tenant %s is suspended", tenant.Name))
+		if err := UpdateStatusIfChanged(ctx, r.Client, cache, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+
+	if cache.Status.Phase != "Provisioning" {
+		cache.Status.Phase = "Provisioning"
+		meta.RemoveStatusCondition(&cache.Status.Conditions, ConditionWaiting)
+		if err := UpdateStatusIfChanged(ctx, r.Client, cache, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.provisionCache(ctx, cache); err != nil {
+		if reason, retryAfter, ok := waitingReasonFor(err); ok {
+			log.Info("Cache provisioning is waiting", "name", cache.Name, "reason", reason, "err", err)
+			cache.Status.Phase = "Pending"
+			setWaitingCondition(&cache.Status.Conditions, cache.Generation, reason, err.Error())
+			if statusErr := UpdateStatusIfChanged(ctx, r.Client, cache, log); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{RequeueAfter: retryAfter}, nil
+		}
+
+		log.Error(err, "Failed to provision cache")
+		cache.Status.Phase = "Failed"
+		if statusErr := UpdateStatusIfChanged(ctx, r.Client, cache, log); statusErr != nil {
+			log.Error(statusErr, "Failed to update status to Failed")
+		}
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Cache provisioning request sent to broker", "name", cache.Name)
+	return ctrl.Result{}, nil
+}
+
+// recordReconcile stamps the outcome of a reconcile onto the Cache status
+func (r *CacheReconciler) recordReconcile(ctx context.Context, fetched, cache *platformv1.Cache, reconcileErr error) {
+	log := log.FromContext(ctx)
+
+	cache.Status.LastError = ""
+	if reconcileErr != nil {
+		cache.Status.LastError = reconcileErr.Error()
+	}
+	if !statusChangedSinceReconcile(fetched, cache) {
+		log.V(2).Info("Status unchanged, skipping update", "name", cache.Name, "namespace", cache.Namespace)
+		return
+	}
+	now := metav1.Now()
+	cache.Status.LastReconcileTime = &now
+
+	if err := UpdateStatusIfChanged(ctx, r.Client, cache, log); err != nil {
+		log.Error(err, "Failed to record reconcile outcome", "name", cache.Name)
+	}
+}
+
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *CacheReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Cache", Finalizer: cacheFinalizerName}
+}
+
+// handleDeletion deprovisions the cache before releasing its finalizer
+func (r *CacheReconciler) handleDeletion(ctx context.Context, cache *platformv1.Cache) (ctrl.Result, error) {
+	return r.helper().HandleDeletion(ctx, cache, func(ctx context.Context) error {
+		return r.cleanupCache(ctx, cache)
+	})
+}
+
+// cleanupCache asks the broker that provisioned the cache to deprovision it
+func (r *CacheReconciler) cleanupCache(ctx context.Context, cache *platformv1.Cache) error {
+	log := log.FromContext(ctx)
+
+	if cache.Status.DeploymentID == "" || r.BrokerRegistry == nil {
+		return nil
+	}
+
+	// Deprovision through the broker that handled provisioning. Another
+	// broker wouldn't know the deployment, so don't pick one if it's gone.
+	var selectedBroker *platformv1.Broker
+	var err error
+	if ref := cache.Status.BrokerRef; ref != nil && ref.Name != "" {
+		selectedBroker, err = getRecordedBroker(ctx, r.Client, ref, cache.Namespace)
+		if err != nil {
+			err = fmt.Errorf("broker %s that provisioned deployment %s is unavailable; restore it or remove the %s finalizer to abandon the deployment: %w",
+				brokerRefString(ref, cache.Namespace), cache.Status.DeploymentID, cacheFinalizerName, err)
+			if r.Recorder != nil {
+				r.Recorder.Event(cache, "Warning", "BrokerNotFound", err.Error())
+			}
+			return err
+		}
+	}
+
+	// Caches provisioned before the broker was recorded fall back to one
+	// matching their capabilities
+	if selectedBroker == nil {
+		selectedBroker, err = r.BrokerRegistry.SelectBroker(ctx, brokerregistry.SelectionCriteria{
+			ResourceType: platformv1.ResourceTypeCache,
+			Provider:     cache.Spec.Engine,
+		})
+		if err != nil {
+			// The broker that provisioned it may no longer exist
+			log.Error(err, "Failed to select broker for deprovisioning, continuing anyway")
+			return nil
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "CacheReconciler.deprovision", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.cache", cache.Namespace+"/"+cache.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+			attribute.String("kidp.deployment_id", cache.Status.DeploymentID),
+		))
+	defer span.End()
+
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return err
+	}
+	_, err = brokerClient.Deprovision(ctx, brokerclient.DeprovisionRequest{
+		DeploymentID:    cache.Status.DeploymentID,
+		ResourceType:    platformv1.ResourceTypeCache,
+		ResourceName:    cache.Name,
+		Namespace:       cache.Namespace,
+		TargetNamespace: cache.Spec.TargetNamespace,
+		CallbackURL:     managerCallbackURL(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to call broker deprovision: %w", err)
+	}
+
+	log.Info("Deprovisioning request sent to broker",
+		"deploymentId", cache.Status.DeploymentID,
+		"broker", selectedBroker.Name)
+	return nil
+}
+
+// provisionCache selects a broker for the cache and asks it to provision one
+func (r *CacheReconciler) provisionCache(ctx context.Context, cache *platformv1.Cache) error {
+	log := log.FromContext(ctx)
+
+	if r.BrokerRegistry == nil {
+		return fmt.Errorf("broker registry not configured")
+	}
+
+	criteria := brokerregistry.SelectionCriteria{
+		ResourceType: platformv1.ResourceTypeCache,
+		Region:       cache.Spec.Region,
+		Provider:     cache.Spec.Engine,
+	}
+	selection, err := r.BrokerRegistry.Select(ctx, criteria)
+	if err != nil {
+		return fmt.Errorf("failed to select broker: %w", err)
+	}
+	selectedBroker := selection.Broker
+
+	log.Info("Selected broker for provisioning",
+		"broker", selectedBroker.Name,
+		"endpoint", selectedBroker.Spec.Endpoint,
+		"score", selection.Score,
+		"candidates", selection.Candidates)
+	if r.Recorder != nil {
+		if selection.Fallback {
+			r.Recorder.Eventf(cache, "Warning", "BrokerSelected",
+				"No broker matched criteria: %s; using fallback broker %s/%s",
+				criteria, selectedBroker.Namespace, selectedBroker.Name)
+		} else {
+			r.Recorder.Eventf(cache, "Normal", "BrokerSelected",
+				"Selected broker %s/%s (score %.1f, %s) for criteria: %s",
+				selectedBroker.Namespace, selectedBroker.Name, selection.Score, selection.Basis(), criteria)
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "CacheReconciler.provision", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.cache", cache.Namespace+"/"+cache.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+		))
+	defer span.End()
+
+	token, err := callbacktoken.Issue(time.Now(), callbacktoken.DefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return err
+	}
+	resp, err := brokerClient.Provision(ctx, cacheProvisionRequest(cache, token.Token))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to call broker provision: %w", err)
+	}
+
+	log.Info("Broker accepted provisioning request",
+		"deploymentId", resp.DeploymentID,
+		"status", resp.Status)
+	span.SetAttributes(attribute.String("kidp.deployment_id", resp.DeploymentID))
+	r.BrokerRegistry.Reserve(selectedBroker, resp.DeploymentID)
+
+	expires := metav1.NewTime(token.Expires)
+	err = UpdateStatusWithRetry(ctx, r.Client, cache, log, func() {
+		cache.Status.DeploymentID = resp.DeploymentID
+		cache.Status.CallbackTokenHash = token.Hash
+		cache.Status.CallbackTokenExpiry = &expires
+		cache.Status.BrokerRef = &platformv1.ObjectReference{
+			Name:      selectedBroker.Name,
+			Namespace: selectedBroker.Namespace,
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update status with deploymentId: %w", err)
+	}
+	return nil
+}
+
+// cacheProvisionRequest builds the broker request for the cache's spec
+func cacheProvisionRequest(cache *platformv1.Cache, callbackToken string) brokerclient.ProvisionRequest {
+	req := brokerclient.ProvisionRequest{
+		ResourceType:    platformv1.ResourceTypeCache,
+		ResourceName:    cache.Name,
+		Namespace:       cache.Namespace,
+		TargetNamespace: cache.Spec.TargetNamespace,
+		Team:            fmt.Sprintf("%s/%s", cache.Spec.Owner.Kind, cache.Spec.Owner.Name),
+		Owner:           cache.Spec.Owner.Name,
+		CallbackURL:     managerCallbackURL(),
+		CallbackToken:   callbackToken,
+		Source:          sourceFromAnnotations(cache.Annotations),
+		Spec: map[string]interface{}{
+			"engine":           cache.Spec.Engine,
+			"size":             cache.Spec.Size,
+			"highAvailability": cache.Spec.HighAvailability,
+		},
+	}
+	if cache.Spec.Version != "" {
+		req.Spec["version"] = cache.Spec.Version
+	}
+	if cache.Spec.MaxMemory != "" {
+		req.Spec["maxMemory"] = cache.Spec.MaxMemory
+	}
+	if cache.Spec.EvictionPolicy != "" {
+		req.Spec["evictionPolicy"] = cache.Spec.EvictionPolicy
+	}
+	if cache.Spec.Region != "" {
+		req.Spec["region"] = cache.Spec.Region
+	}
+	if len(cache.Spec.Parameters) > 0 {
+		req.Spec["parameters"] = cache.Spec.Parameters
+	}
+	return req
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CacheReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("cache-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.Cache{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		), r.Namespaces.Predicate())).
+		Watches(&platformv1.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.suspendedCaches)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// suspendedCaches returns a request for every Cache suspended because its
+// tenant could not be resolved
+func (r *CacheReconciler) suspendedCaches(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.CacheList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list caches awaiting a tenant")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, cache := range list.Items {
+		if cache.Status.Phase != "Suspended" || !cache.DeletionTimestamp.IsZero() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&cache)})
+	}
+	return requests
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+)
+
+func cacheBroker(endpoint string) *platformv1.Broker {
+	return &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"},
+		Spec: platformv1.BrokerSpec{
+			Endpoint:      endpoint,
+			CloudProvider: "on-prem",
+			Capabilities:  []platformv1.BrokerCapability{{ResourceType: "Cache", Providers: []string{"redis"}}},
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready"},
+	}
+}
+
+func TestCacheReconciler_LabelFromNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"platform.company.com/tenant": "acme"}}}
+	cache := &platformv1.Cache{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "cache1"}}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, ns, cache).Build()
+	r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cache)}
+
+	// Adds the finalizer, then labels with the tenant
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("reconcile %d returned error: %v", i+1, err)
+		}
+	}
+
+	out := &platformv1.Cache{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get cache: %v", err)
+	}
+	if len(out.Finalizers) != 1 || out.Finalizers[0] != cacheFinalizerName {
+		t.Fatalf("expected finalizer %s, got %v", cacheFinalizerName, out.Finalizers)
+	}
+	if out.Labels["platform.company.com/tenant"] != "acme" {
+		t.Fatalf("expected tenant label acme on cache, got: %v", out.Labels)
+	}
+}
+
+func TestCacheReconciler_SuspendWhenNoTenant(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	cache := &platformv1.Cache{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "cache2", Finalizers: []string{cacheFinalizerName}},
+		Spec:       platformv1.CacheSpec{Engine: "redis", Owner: platformv1.OwnerReference{Kind: "Team", Name: "missing"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cache).Build()
+	r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cache)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	out := &platformv1.Cache{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get cache: %v", err)
+	}
+	if out.Status.Phase != "Suspended" {
+		t.Fatalf("expected cache to be Suspended when no tenant found, got phase=%s", out.Status.Phase)
+	}
+	if requests := r.suspendedCaches(context.Background(), &platformv1.Tenant{}); len(requests) != 1 || requests[0] != req {
+		t.Fatalf("expected tenant changes to enqueue %v, got %v", req, requests)
+	}
+}
+
+func TestCacheReconciler_ProvisionsThroughBroker(t *testing.T) {
+	var sent brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cache := &platformv1.Cache{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "sessions",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{cacheFinalizerName},
+		},
+		Spec: platformv1.CacheSpec{
+			Owner:          platformv1.OwnerReference{Kind: "Tenant", Name: "acme"},
+			Engine:         "redis",
+			Size:           "small",
+			MaxMemory:      "512Mi",
+			EvictionPolicy: "allkeys-lru",
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, cacheBroker(srv.URL), cache).Build()
+	r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cache)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	if sent.ResourceType != "cache" || sent.ResourceName != "sessions" || sent.CallbackToken == "" {
+		t.Fatalf("unexpected provision request: %+v", sent)
+	}
+	for key, want := range map[string]interface{}{"engine": "redis", "size": "small", "maxMemory": "512Mi", "evictionPolicy": "allkeys-lru", "highAvailability": false} {
+		if sent.Spec[key] != want {
+			t.Fatalf("expected spec %s=%v, got %v", key, want, sent.Spec[key])
+		}
+	}
+
+	out := &platformv1.Cache{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(cache), out); err != nil {
+		t.Fatalf("failed to get cache: %v", err)
+	}
+	if out.Status.DeploymentID != "deploy-1" || out.Status.Phase != "Provisioning" {
+		t.Fatalf("expected deploy-1 to be provisioning, got %s/%s", out.Status.DeploymentID, out.Status.Phase)
+	}
+	if out.Status.BrokerRef == nil || out.Status.BrokerRef.Name != "broker-a" || out.Status.CallbackTokenHash == "" {
+		t.Fatalf("expected the broker and token hash to be recorded, got %+v", out.Status)
+	}
+}
+
+func TestCacheReconciler_DeprovisionsOnDelete(t *testing.T) {
+	var sent brokerclient.DeprovisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.DeprovisionResponse{Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	now := metav1.Now()
+	cache := &platformv1.Cache{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "sessions", Finalizers: []string{cacheFinalizerName}, DeletionTimestamp: &now},
+		Spec:       platformv1.CacheSpec{Engine: "redis"},
+		Status: platformv1.CacheStatus{
+			DeploymentID: "deploy-1",
+			BrokerRef:    &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cacheBroker(srv.URL), cache).Build()
+	r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cache)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if sent.DeploymentID != "deploy-1" || sent.ResourceType != "cache" {
+		t.Fatalf("expected deploy-1 to be deprovisioned, got %+v", sent)
+	}
+	// Releasing the last finalizer lets the object go
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(cache), &platformv1.Cache{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the cache to be deleted once deprovisioned, got %v", err)
+	}
+}
+
+func TestCacheReconciler_APIKeyBroker(t *testing.T) {
+	sent := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent[r.URL.Path] = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-key", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	b := cacheBroker(srv.URL)
+	b.Spec.Authentication = &platformv1.BrokerAuthentication{
+		Type:      platformv1.BrokerAuthAPIKey,
+		SecretRef: &platformv1.SecretReference{Namespace: "kidp-system", Name: "broker-api-key"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-api-key"},
+		Data:       map[string][]byte{"api-key": []byte("key-1")},
+	}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cache := &platformv1.Cache{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "sessions",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{cacheFinalizerName},
+		},
+		Spec: platformv1.CacheSpec{Owner: platformv1.OwnerReference{Kind: "Tenant", Name: "acme"}, Engine: "redis"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, b, secret, cache).Build()
+	r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cache)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if got := sent["/v1/provision"]; got != "Bearer key-1" {
+		t.Fatalf("expected the API key on the provision request, got %q", got)
+	}
+
+	if err := cl.Delete(context.Background(), cache); err != nil {
+		t.Fatalf("failed to delete cache: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if got := sent["/v1/deprovision"]; got != "Bearer key-1" {
+		t.Fatalf("expected the API key on the deprovision request, got %q", got)
+	}
+}
+
+func TestCacheReconciler_CleanupCrossNamespaceBrokerRef(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	var recordedCalls, decoyCalls int
+	recordedSrv := countingBroker(&recordedCalls)
+	defer recordedSrv.Close()
+	decoySrv := countingBroker(&decoyCalls)
+	defer decoySrv.Close()
+
+	// The broker that provisioned the cache lives in kidp-system; a broker of
+	// the same name in the cache's namespace must not be used
+	recorded := cacheBroker(recordedSrv.URL)
+	decoy := cacheBroker(decoySrv.URL)
+	decoy.Namespace = "dev"
+
+	tests := []struct {
+		name         string
+		ref          platformv1.ObjectReference
+		objects      []client.Object
+		wantErr      bool
+		wantRecorded int
+	}{
+		{
+			name:         "recorded namespace",
+			ref:          platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy(), decoy.DeepCopy()},
+			wantRecorded: 1,
+		},
+		{
+			name:    "recorded broker gone",
+			ref:     platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects: []client.Object{decoy.DeepCopy()},
+			wantErr: true,
+		},
+		{
+			name:         "legacy ref without namespace",
+			ref:          platformv1.ObjectReference{Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy()},
+			wantRecorded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordedCalls, decoyCalls = 0, 0
+			cache := &platformv1.Cache{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "sessions", Finalizers: []string{cacheFinalizerName}},
+				Spec:       platformv1.CacheSpec{Engine: "redis"},
+			}
+			cache.Status.DeploymentID = "deploy-1"
+			ref := tt.ref
+			cache.Status.BrokerRef = &ref
+
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(tt.objects, cache)...).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &CacheReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			err := r.cleanupCache(context.Background(), cache)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "kidp-system/broker-a") {
+					t.Fatalf("expected an error naming the recorded broker, got %v", err)
+				}
+				if len(recorder.Events) == 0 || !strings.Contains(<-recorder.Events, "BrokerNotFound") {
+					t.Fatalf("expected a BrokerNotFound event")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recordedCalls != tt.wantRecorded {
+				t.Fatalf("expected %d call(s) to the recorded broker, got %d", tt.wantRecorded, recordedCalls)
+			}
+			if decoyCalls != 0 {
+				t.Fatalf("expected no calls to another broker, got %d", decoyCalls)
+			}
+		})
+	}
+}
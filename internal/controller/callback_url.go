@@ -0,0 +1,72 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// callbackURLMoved reports whether the manager's callback URL has changed
+// since the broker was given one for the database's in-flight deployment
+func callbackURLMoved(database *platformv1.Database) bool {
+	return database.Status.Phase == "Provisioning" && database.Status.CallbackURL != managerCallbackURL()
+}
+
+// reconcileCallbackURL points the remaining callbacks of the database's
+// in-flight deployment at the manager's current callback URL. A broker that
+// no longer has the deployment in flight answers 404; it sends no more
+// callbacks, so the URL is just recorded.
+func (r *DatabaseReconciler) reconcileCallbackURL(ctx context.Context, database *platformv1.Database) error {
+	log := log.FromContext(ctx)
+	callbackURL := managerCallbackURL()
+
+	selectedBroker, err := r.recordedBroker(ctx, database)
+	if err != nil {
+		return fmt.Errorf("failed to find broker for callback URL update: %w", err)
+	}
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return err
+	}
+
+	err = brokerClient.UpdateCallbackURL(ctx, database.Status.DeploymentID, callbackURL)
+	var brokerErr *brokerclient.BrokerError
+	switch {
+	case err == nil:
+		log.Info("Moved deployment callbacks to the current callback URL",
+			"deploymentId", database.Status.DeploymentID, "callbackURL", callbackURL)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(database, "Normal", "CallbackURLUpdated", "Broker %s now sends callbacks to %s", selectedBroker.Name, callbackURL)
+		}
+	case stderrors.As(err, &brokerErr) && brokerErr.StatusCode == http.StatusNotFound:
+		log.Info("Deployment is no longer in flight on the broker, recording the callback URL",
+			"deploymentId", database.Status.DeploymentID)
+	default:
+		return fmt.Errorf("failed to update callback URL: %w", err)
+	}
+
+	database.Status.CallbackURL = callbackURL
+	return UpdateStatusIfChanged(ctx, r.Client, database, log)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+)
+
+// runWorkers drains the requests through r with the given number of workers.
+// Like controller-runtime, the workqueue never hands the same request to two
+// workers at once, and a request asking to be requeued goes back on the queue.
+func runWorkers(t *testing.T, r reconcile.Reconciler, workers int, requests []reconcile.Request) {
+	t.Helper()
+
+	queue := workqueue.NewTyped[reconcile.Request]()
+	var pending atomic.Int64
+	pending.Add(int64(len(requests)))
+	for _, req := range requests {
+		queue.Add(req)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				req, shutdown := queue.Get()
+				if shutdown {
+					return
+				}
+				res, err := r.Reconcile(context.Background(), req)
+				if err != nil {
+					t.Errorf("reconcile %s returned error: %v", req, err)
+				}
+				if err == nil && (res.Requeue || res.RequeueAfter > 0) {
+					queue.Add(req)
+				} else if pending.Add(-1) == 0 {
+					queue.ShutDown()
+				}
+				queue.Done(req)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDatabaseReconciler_ConcurrentReconciles(t *testing.T) {
+	var mu sync.Mutex
+	provisioned := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req brokerclient.ProvisionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		provisioned[req.ResourceName]++
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-" + req.ResourceName, Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	const count = 20
+	objs := []client.Object{&platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}, brokerFor(srv.URL, 0, 0)}
+	var requests []reconcile.Request
+	for i := 0; i < count; i++ {
+		// Start without finalizer or tenant label so every database takes
+		// several passes through the queue
+		db := provisionableDatabase(fmt.Sprintf("db-%02d", i))
+		db.Labels = nil
+		db.Finalizers = nil
+		objs = append(objs, db)
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&platformv1.Database{}).Build()
+	r := &DatabaseReconciler{
+		Client:                  cl,
+		Scheme:                  scheme,
+		Recorder:                record.NewFakeRecorder(10 * count),
+		BrokerRegistry:          brokerregistry.NewRegistry(cl),
+		MaxConcurrentReconciles: 4,
+	}
+
+	runWorkers(t, r, r.MaxConcurrentReconciles, requests)
+
+	for _, req := range requests {
+		out := &platformv1.Database{}
+		if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+			t.Fatalf("failed to get %s: %v", req, err)
+		}
+		if provisioned[out.Name] != 1 {
+			t.Errorf("expected %s to be provisioned exactly once, got %d", out.Name, provisioned[out.Name])
+		}
+		if out.Status.Phase != "Provisioning" || out.Status.DeploymentID != "deploy-"+out.Name {
+			t.Errorf("expected %s to be provisioning its own deployment, got phase=%s deploymentId=%s",
+				out.Name, out.Status.Phase, out.Status.DeploymentID)
+		}
+		if out.Status.BrokerRef == nil || out.Status.BrokerRef.Name != "broker-a" {
+			t.Errorf("expected %s to record its broker, got %+v", out.Name, out.Status.BrokerRef)
+		}
+		if out.Labels["platform.company.com/tenant"] != "acme" || len(out.Finalizers) != 1 {
+			t.Errorf("expected %s to be labelled and finalized, got labels=%v finalizers=%v", out.Name, out.Labels, out.Finalizers)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ConditionConnectionSecretValid reports whether a Ready Database's
+// connection Secret has the keys its engine promises. Teams mount the Secret
+// into their pods by key, so a broker that leaves one out breaks them.
+const ConditionConnectionSecretValid = "ConnectionSecretValid"
+
+// Reasons for the ConnectionSecretValid condition
+const (
+	ReasonConnectionSecretConforms      = "Conforms"
+	ReasonConnectionSecretNonConformant = "NonConformant"
+	ReasonConnectionSecretNotFound      = "SecretNotFound"
+)
+
+// connectionSecretSchemas are the keys a Database's connection Secret must
+// set, by engine. Engines without a schema aren't checked.
+var connectionSecretSchemas = map[string][]string{
+	"postgresql": {"host", "port", "username", "password", "database"},
+	"mysql":      {"host", "port", "username", "password", "database"},
+	"sqlserver":  {"host", "port", "username", "password", "database"},
+	"mongodb":    {"host", "port", "username", "password", "database"},
+	"redis":      {"host", "port", "password"},
+}
+
+// checkConnectionSecret returns a reason and message explaining why the
+// database's connection Secret doesn't conform to its engine's schema, or
+// two empty strings if it does
+func (r *DatabaseReconciler) checkConnectionSecret(ctx context.Context, database *platformv1.Database, keys []string) (string, string, error) {
+	ref := database.Status.ConnectionSecretRef
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = database.Namespace
+	}
+
+	reader := r.APIReader
+	if reader == nil {
+		reader = r.Client
+	}
+	secret := &corev1.Secret{}
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return ReasonConnectionSecretNotFound, fmt.Sprintf("Connection secret %s not found", ref.Name), nil
+		}
+		return "", "", err
+	}
+
+	var missing []string
+	for _, key := range keys {
+		if len(secret.Data[key]) == 0 {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return ReasonConnectionSecretNonConformant, fmt.Sprintf("Connection secret %s is missing %s required for %s",
+			ref.Name, strings.Join(missing, ", "), database.Spec.Engine), nil
+	}
+	return "", "", nil
+}
+
+// reconcileConnectionSecret records whether a Ready database's connection
+// Secret conforms to its engine's schema. A non-conforming Secret is flagged
+// with a Warning event and rechecked until the broker fixes it.
+func (r *DatabaseReconciler) reconcileConnectionSecret(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	keys, ok := connectionSecretSchemas[database.Spec.Engine]
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	reason, message, err := r.checkConnectionSecret(ctx, database, keys)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               ConditionConnectionSecretValid,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonConnectionSecretConforms,
+		Message:            fmt.Sprintf("Connection secret %s has the keys required for %s", database.Status.ConnectionSecretRef.Name, database.Spec.Engine),
+		ObservedGeneration: database.Generation,
+	}
+	if reason != "" {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = message
+		if !meta.IsStatusConditionPresentAndEqual(database.Status.Conditions, ConditionConnectionSecretValid, metav1.ConditionFalse) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", reason, message)
+		}
+		log.Info("Connection secret does not conform to its engine's schema", "name", database.Name, "reason", message)
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if reason != "" {
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+	return ctrl.Result{}, nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ReasonRegionNotAllowed marks a Database rejected because it asks for a
+// region outside its tenant's placement policy
+const ReasonRegionNotAllowed = "RegionNotAllowed"
+
+// ConditionResidencyViolation is True on a provisioned Database whose region
+// is outside the regions its tenant allows, which only happens if a broker
+// placed it somewhere other than where it was sent
+const ConditionResidencyViolation = "ResidencyViolation"
+
+// Reasons for the ResidencyViolation condition
+const (
+	ReasonOutsideAllowedRegions = "OutsideAllowedRegions"
+	ReasonWithinAllowedRegions  = "WithinAllowedRegions"
+)
+
+// defaultResidencyCheckInterval is how often a provisioned Database's region
+// is checked against its tenant's policy when
+// DatabaseReconciler.ResidencyCheckInterval is unset
+const defaultResidencyCheckInterval = 10 * time.Minute
+
+// allowedRegions returns the regions the tenant's placement policy allows,
+// empty if it allows any
+func allowedRegions(tenant *platformv1.Tenant) []string {
+	if tenant == nil || tenant.Spec.Placement == nil {
+		return nil
+	}
+	return tenant.Spec.Placement.Regions
+}
+
+// checkRegionAllowed returns a message explaining why the database's
+// requested region is outside its tenant's allowed regions, or "" if it is
+// allowed. A database that doesn't name a region is kept inside the policy
+// by broker selection.
+func checkRegionAllowed(database *platformv1.Database, tenant *platformv1.Tenant) string {
+	regions := allowedRegions(tenant)
+	if len(regions) == 0 || database.Spec.Region == "" || slices.Contains(regions, database.Spec.Region) {
+		return ""
+	}
+	return fmt.Sprintf("Region %q is not allowed by tenant %s, which allows %s",
+		database.Spec.Region, tenant.Name, strings.Join(regions, ", "))
+}
+
+// isRegionRejected reports whether the database was rejected for asking for
+// a region its tenant doesn't allow
+func isRegionRejected(database *platformv1.Database) bool {
+	return hasReadyReason(database, ReasonRegionNotAllowed)
+}
+
+// residencyCheckInterval returns how often provisioned databases' regions
+// are checked
+func (r *DatabaseReconciler) residencyCheckInterval() time.Duration {
+	if r.ResidencyCheckInterval > 0 {
+		return r.ResidencyCheckInterval
+	}
+	return defaultResidencyCheckInterval
+}
+
+// reconcileDataResidency sets the ResidencyViolation condition from the
+// region the database was placed in. A violation is flagged with a Warning
+// event but otherwise left for operators to resolve, since moving the data
+// is beyond the controller. It returns how long until the region should be
+// checked again, zero while the tenant allows any region.
+func (r *DatabaseReconciler) reconcileDataResidency(ctx context.Context, database *platformv1.Database, tenant *platformv1.Tenant) (time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	regions := allowedRegions(tenant)
+	if len(regions) == 0 {
+		// The policy was lifted
+		if meta.FindStatusCondition(database.Status.Conditions, ConditionResidencyViolation) != nil {
+			meta.RemoveStatusCondition(&database.Status.Conditions, ConditionResidencyViolation)
+			return 0, UpdateStatusIfChanged(ctx, r.Client, database, log)
+		}
+		return 0, nil
+	}
+	// Nothing to check until the broker's region is known
+	if database.Status.Region == "" {
+		return r.residencyCheckInterval(), nil
+	}
+
+	condition := metav1.Condition{
+		Type:               ConditionResidencyViolation,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonWithinAllowedRegions,
+		Message:            fmt.Sprintf("Region %s is allowed by tenant %s", database.Status.Region, tenant.Name),
+		ObservedGeneration: database.Generation,
+	}
+	if !slices.Contains(regions, database.Status.Region) {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = ReasonOutsideAllowedRegions
+		condition.Message = fmt.Sprintf("Deployment %s is in region %s, outside the regions tenant %s allows: %s",
+			database.Status.DeploymentID, database.Status.Region, tenant.Name, strings.Join(regions, ", "))
+		if !meta.IsStatusConditionTrue(database.Status.Conditions, ConditionResidencyViolation) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", ReasonOutsideAllowedRegions, condition.Message)
+		}
+		log.Info("Database is outside its tenant's allowed regions", "name", database.Name,
+			"region", database.Status.Region, "allowed", regions)
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, condition)
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		return 0, err
+	}
+	return r.residencyCheckInterval(), nil
+}
+
+// requeueWithin shortens result's requeue to at most after, unless after is
+// zero or the result already requeues immediately
+func requeueWithin(result ctrl.Result, after time.Duration) ctrl.Result {
+	if after == 0 || result.Requeue {
+		return result
+	}
+	if result.RequeueAfter == 0 || result.RequeueAfter > after {
+		result.RequeueAfter = after
+	}
+	return result
+}
+
+// tenantPlacementChanged passes Tenants whose placement policy changed
+var tenantPlacementChanged = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldTenant, ok := e.ObjectOld.(*platformv1.Tenant)
+		if !ok {
+			return false
+		}
+		newTenant, ok := e.ObjectNew.(*platformv1.Tenant)
+		if !ok {
+			return false
+		}
+		return !equality.Semantic.DeepEqual(oldTenant.Spec.Placement, newTenant.Spec.Placement)
+	},
+}
+
+// databasesUnderPlacement returns a request for every Database of the tenant
+// that its placement policy affects: those provisioned, whose residency is
+// rechecked, and those rejected for their region, which it may now allow
+func (r *DatabaseReconciler) databasesUnderPlacement(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list, client.MatchingLabels{"platform.company.com/tenant": obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases of tenant", "tenant", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, db := range list.Items {
+		if !db.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if db.Status.DeploymentID != "" || isRegionRejected(&db) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// applyDatabaseClass fills in the fields the database's spec leaves unset
+// from the DatabaseClass it references. The merge is only made in memory, so
+// the stored spec keeps just what the user wrote and class changes carry
+// through. It returns a message explaining why the class can't be applied,
+// or "" if it was applied or none is referenced.
+func (r *DatabaseReconciler) applyDatabaseClass(ctx context.Context, database *platformv1.Database) (string, error) {
+	ref := database.Spec.ClassRef
+	if ref == nil {
+		return "", nil
+	}
+
+	class := &platformv1.DatabaseClass{}
+	if err := r.Get(ctx, client.ObjectKey{Name: ref.Name}, class); err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("DatabaseClass %s not found", ref.Name), nil
+		}
+		return "", err
+	}
+	database.Spec.ApplyClass(&class.Spec)
+	return "", nil
+}
+
+// databasesForClass returns the databases referencing a DatabaseClass, so
+// changes to the class reach them and databases waiting for it resume
+func (r *DatabaseReconciler) databasesForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases using a DatabaseClass", "class", obj.GetName())
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, db := range list.Items {
+		if ref := db.Spec.ClassRef; ref != nil && ref.Name == obj.GetName() && db.DeletionTimestamp.IsZero() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+		}
+	}
+	return requests
+}
@@ -18,38 +18,138 @@ package controller
 
 import (
 	"context"
+	"crypto/ed25519"
+	stderrors "errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
 	"github.com/aykay76/kidp/pkg/brokerclient"
 	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/tracing"
 )
 
 const databaseFinalizerName = "platform.company.com/database-cleanup"
 
+// ConditionWaiting is set on a Database that cannot progress yet; its reason
+// says what it is waiting for
+const ConditionWaiting = "Waiting"
+
+// ConditionThrottled is set on a Database while brokers push back for lack of
+// capacity. Its message says when provisioning will be retried.
+const ConditionThrottled = "Throttled"
+
+// ReasonProvisioningFailed marks a Database the broker could not provision.
+// The Ready condition's message carries the broker's explanation.
+const ReasonProvisioningFailed = "ProvisioningFailed"
+
+// Reasons for the Waiting condition
+const (
+	WaitingReasonTenantUnresolved  = "TenantUnresolved"
+	WaitingReasonTenantSuspended   = "TenantSuspended"
+	WaitingReasonBrokerAtCapacity  = "BrokerAtCapacity"
+	WaitingReasonNoBrokerAvailable = "NoBrokerAvailable"
+	WaitingReasonTeamQuotaExceeded = "TeamQuotaExceeded"
+	WaitingReasonApprovalRequired  = "ApprovalRequired"
+
+	WaitingReasonAdminCredentialsInvalid = "AdminCredentialsInvalid"
+	WaitingReasonDatabaseClassNotFound   = "DatabaseClassNotFound"
+)
+
+// Annotations a GitOps pipeline sets on a Database to record its provenance.
+// They are passed to the broker, which tags the resources it creates and
+// records them in its audit trail.
+const (
+	AnnotationSourceRepository  = "platform.company.com/source-repository"
+	AnnotationSourceRevision    = "platform.company.com/source-revision"
+	AnnotationSourcePath        = "platform.company.com/source-path"
+	AnnotationSourceApplication = "platform.company.com/source-application"
+	AnnotationCorrelationID     = "platform.company.com/correlation-id"
+)
+
+// defaultWaitRequeue is how long to wait before retrying a Database that is
+// waiting on capacity or its tenant
+const defaultWaitRequeue = 30 * time.Second
+
 // DatabaseReconciler reconciles a Database object
 type DatabaseReconciler struct {
 	client.Client
 	Scheme         *runtime.Scheme
 	BrokerRegistry *brokerregistry.Registry
 	Recorder       record.EventRecorder
+
+	// APIReader reads objects the manager doesn't cache, such as admin
+	// credentials Secrets. Client is used when nil.
+	APIReader client.Reader
+
+	// ClusterReader lists the Databases counted against a team's quota
+	// across every namespace when the manager's cache is scoped to some.
+	// Client is used when nil.
+	ClusterReader client.Reader
+
+	// SigningKey is the manager's Ed25519 key, used to sign requests to
+	// brokers whose authentication type is ed25519
+	SigningKey ed25519.PrivateKey
+
+	// ReprovisionOnBrokerOffline provisions a Database again through another
+	// broker when the one it was provisioned through goes Offline, abandoning
+	// the old deployment. Otherwise the Database is only marked
+	// BrokerUnavailable.
+	ReprovisionOnBrokerOffline bool
+
+	// ResidencyCheckInterval is how often a provisioned Database's region is
+	// checked against its tenant's allowed regions. Zero uses
+	// defaultResidencyCheckInterval.
+	ResidencyCheckInterval time.Duration
+
+	// apiKeys caches the API keys of brokers authenticated by api-key
+	apiKeys apiKeyCache
+
+	// MaxConcurrentReconciles is how many Databases may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+
+	// Namespaces restricts the Databases reconciled to those namespaces. Empty
+	// reconciles every namespace.
+	Namespaces WatchNamespaces
 }
 
 // +kubebuilder:rbac:groups=platform.company.com,resources=databases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.company.com,resources=databases/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=platform.company.com,resources=databases/finalizers,verbs=update
+// +kubebuilder:rbac:groups=platform.company.com,resources=tenants;teams;applications,verbs=get;list;watch
+// +kubebuilder:rbac:groups=platform.company.com,resources=databaseclasses,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
 
 // Reconcile is part of the main kubernetes reconciliation loop
-func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("database", time.Now(), &err)
 	log := log.FromContext(ctx)
 
 	// Trace reconcile entry (use V(2) for very noisy environments)
@@ -57,13 +157,14 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 
 	// Fetch the Database instance
 	database := &platformv1.Database{}
-	err := r.Get(ctx, req.NamespacedName, database)
+	err = r.Get(ctx, req.NamespacedName, database)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			// Object not found, could have been deleted after reconcile request.
 			// Return and don't requeue
 			log.Info("Database resource not found. Ignoring since object must be deleted")
 			log.V(2).Info("initial Get returned NotFound", "namespace", req.Namespace, "name", req.Name)
+			metrics.DatabasePhases.Delete(req.NamespacedName.String())
 			return ctrl.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
@@ -73,23 +174,27 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	log.V(1).Info("fetched Database object", "namespace", database.Namespace, "name", database.Name, "finalizers", database.Finalizers)
+	// Count the Database under whatever phase this reconcile leaves it in
+	defer func() { metrics.DatabasePhases.Set(req.NamespacedName.String(), database.Status.Phase) }()
 
 	// Handle deletion
 	if !database.DeletionTimestamp.IsZero() {
 		return r.handleDeletion(ctx, database)
 	}
 
-	// Add finalizer if not present
-	if !controllerutil.ContainsFinalizer(database, databaseFinalizerName) {
-		log.Info("Adding finalizer to Database", "name", database.Name, "namespace", database.Namespace)
-		controllerutil.AddFinalizer(database, databaseFinalizerName)
-		if err := r.Update(ctx, database); err != nil {
-			log.Error(err, "Failed to add finalizer")
-			log.V(2).Info("Update(add finalizer) returned error", "error", err, "isNotFound", errors.IsNotFound(err))
-			return ctrl.Result{}, err
-		}
-		// Requeue to process with finalizer in place
-		return ctrl.Result{Requeue: true}, nil
+	fetched := database.DeepCopy()
+	result, err = r.reconcileDatabase(ctx, database)
+	r.recordReconcile(ctx, fetched, database, err)
+	return result, err
+}
+
+// reconcileDatabase drives a live Database towards its desired state
+func (r *DatabaseReconciler) reconcileDatabase(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	// Add finalizer if not present, requeueing to process with it in place
+	if added, err := r.helper().EnsureFinalizer(ctx, database); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
 	}
 
 	// Log the reconciliation
@@ -106,13 +211,27 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		if r.Recorder != nil {
 			r.Recorder.Eventf(database, "Warning", "TenantUnresolved", "tenant could not be resolved: %v", terr)
 		}
-		database.Status.Phase = "Suspended"
-		if err := UpdateStatusWithFallback(ctx, r.Client, database, log); err != nil {
+		database.Status.SetPhase("Suspended", WaitingReasonTenantUnresolved)
+		setWaiting(database, WaitingReasonTenantUnresolved, fmt.Sprintf("Tenant could not be resolved: %v", terr))
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
 			return ctrl.Result{}, err
 		}
 		return ctrl.Result{}, nil
 	}
 
+	// The tenant has become resolvable since the database was suspended
+	if database.Status.Phase == "Suspended" {
+		log.Info("Tenant resolved, resuming suspended database", "database", database.Name, "tenant", tenant.Name)
+		database.Status.SetPhase("Pending", "TenantResolved")
+		meta.RemoveStatusCondition(&database.Status.Conditions, ConditionWaiting)
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		if r.Recorder != nil {
+			r.Recorder.Eventf(database, "Normal", "TenantResolved", "Tenant %s resolved, resuming provisioning", tenant.Name)
+		}
+	}
+
 	// Ensure DB has tenant label for easy querying by other controllers
 	if database.Labels == nil {
 		database.Labels = map[string]string{}
@@ -131,29 +250,208 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	// Fill in the fields left to the Database's class. This must follow the
+	// last update of the Database itself so the merge isn't written back.
+	classMessage, err := r.applyDatabaseClass(ctx, database)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if classMessage != "" {
+		if database.Status.DeploymentID != "" {
+			// Leave a provisioned database alone until its class is back
+			log.Info("DatabaseClass is missing, not reconciling provisioned database", "name", database.Name, "reason", classMessage)
+			return ctrl.Result{}, nil
+		}
+		log.Info("DatabaseClass is missing, waiting before provisioning", "name", database.Name, "reason", classMessage)
+		if !isWaitingFor(database, WaitingReasonDatabaseClassNotFound) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", WaitingReasonDatabaseClassNotFound, classMessage)
+		}
+		database.Status.SetPhase("Pending", WaitingReasonDatabaseClassNotFound)
+		setWaiting(database, WaitingReasonDatabaseClassNotFound, classMessage)
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+
 	// If deploymentId exists, provisioning is in progress or complete
 	// Status updates will come via webhook callbacks
 	if database.Status.DeploymentID != "" {
-		log.Info("Database already provisioned or in progress",
-			"deploymentId", database.Status.DeploymentID,
-			"phase", database.Status.Phase)
+		// Flag, or move off, a broker that has gone Offline
+		if database.Status.BrokerRef != nil {
+			if result, done, err := r.reconcileBrokerAvailability(ctx, database); done || err != nil {
+				return result, err
+			}
+		}
+		// Flag a database placed outside its tenant's allowed regions, and
+		// keep checking while the tenant restricts them
+		recheck, err := r.reconcileDataResidency(ctx, database, tenant)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		result, err := r.reconcileProvisioned(ctx, database)
+		return requeueWithin(result, recheck), err
+	}
+
+	// Don't provision into a suspended tenant
+	if tenant.Status.Phase == "Suspended" {
+		log.Info("Tenant is suspended, waiting before provisioning", "database", database.Name, "tenant", tenant.Name)
+		database.Status.SetPhase("Pending", WaitingReasonTenantSuspended)
+		setWaiting(database, WaitingReasonTenantSuspended, fmt.Sprintf("Tenant %s is suspended", tenant.Name))
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+
+	// Wait for a referenced admin credentials secret to be usable
+	credentialsMessage, err := r.checkAdminCredentials(ctx, database)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if credentialsMessage != "" {
+		log.Info("Admin credentials are not usable, waiting before provisioning", "database", database.Name, "reason", credentialsMessage)
+		if !isWaitingFor(database, WaitingReasonAdminCredentialsInvalid) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", WaitingReasonAdminCredentialsInvalid, credentialsMessage)
+		}
+		database.Status.SetPhase("Pending", WaitingReasonAdminCredentialsInvalid)
+		setWaiting(database, WaitingReasonAdminCredentialsInvalid, credentialsMessage)
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+
+	// Don't provision outside the tenant's allowed regions
+	if regionMessage := checkRegionAllowed(database, tenant); regionMessage != "" {
+		log.Info("Database asks for a region its tenant doesn't allow", "name", database.Name, "reason", regionMessage)
+		if !isRegionRejected(database) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", ReasonRegionNotAllowed, regionMessage)
+		}
+		database.Status.SetPhase("Failed", ReasonRegionNotAllowed)
+		meta.RemoveStatusCondition(&database.Status.Conditions, ConditionWaiting)
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               "Ready",
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonRegionNotAllowed,
+			Message:            regionMessage,
+			ObservedGeneration: database.Generation,
+		})
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Changing the region, or the tenant's placement policy, retries it
 		return ctrl.Result{}, nil
 	}
 
+	// Don't provision past the owning team's database quota
+	quotaMessage, err := r.checkTeamQuota(ctx, database)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if quotaMessage != "" {
+		log.Info("Database exceeds its team's quota", "name", database.Name, "reason", quotaMessage)
+		if !isQuotaRejected(database) && r.Recorder != nil {
+			r.Recorder.Event(database, "Warning", ReasonQuotaExceeded, quotaMessage)
+		}
+		database.Status.SetPhase("Failed", ReasonQuotaExceeded)
+		meta.RemoveStatusCondition(&database.Status.Conditions, ConditionWaiting)
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               "Ready",
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonQuotaExceeded,
+			Message:            quotaMessage,
+			ObservedGeneration: database.Generation,
+		})
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		// Changing the team, e.g. raising its quota, retries it
+		return ctrl.Result{}, nil
+	}
+	if isQuotaRejected(database) || isRegionRejected(database) || hasReadyReason(database, ReasonProvisioningFailed) {
+		meta.RemoveStatusCondition(&database.Status.Conditions, "Ready")
+	}
+
 	// Update status to Provisioning
 	if database.Status.Phase != "Provisioning" {
-		database.Status.Phase = "Provisioning"
-		if err := UpdateStatusWithFallback(ctx, r.Client, database, log); err != nil {
+		database.Status.SetPhase("Provisioning", "ProvisioningStarted")
+		meta.RemoveStatusCondition(&database.Status.Conditions, ConditionWaiting)
+		meta.RemoveStatusCondition(&database.Status.Conditions, ConditionThrottled)
+		if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
 			return ctrl.Result{}, err
 		}
 		log.Info("Database status updated to Provisioning", "name", database.Name)
+		// A status update retried after a conflict re-reads the Database,
+		// dropping the class merge
+		if _, err := r.applyDatabaseClass(ctx, database); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
 	// Call broker to provision database
-	if err := r.provisionDatabase(ctx, database); err != nil {
+	if err := r.provisionDatabase(ctx, database, tenant); err != nil {
+		// Costly databases wait for someone to approve them
+		var approvalErr *approvalRequiredError
+		if stderrors.As(err, &approvalErr) {
+			log.Info("Database requires approval before provisioning", "name", database.Name, "reason", err)
+			if database.Status.Phase != "PendingApproval" && r.Recorder != nil {
+				r.Recorder.Event(database, "Warning", "ApprovalRequired", err.Error())
+			}
+			database.Status.SetPhase("PendingApproval", WaitingReasonApprovalRequired)
+			setWaiting(database, WaitingReasonApprovalRequired, err.Error())
+			if statusErr := UpdateStatusIfChanged(ctx, r.Client, database, log); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+			// Setting the approval annotation triggers the next reconcile
+			return ctrl.Result{}, nil
+		}
+
+		// Capacity and quota rejections are transient: wait rather than fail
+		if reason, retryAfter, ok := waitingReasonFor(err); ok {
+			log.Info("Database provisioning is waiting", "name", database.Name, "reason", reason, "err", err)
+			database.Status.SetPhase("Pending", reason)
+			setWaiting(database, reason, err.Error())
+			if reason == WaitingReasonBrokerAtCapacity {
+				setThrottled(database, time.Now().Add(retryAfter))
+			}
+			if statusErr := UpdateStatusIfChanged(ctx, r.Client, database, log); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{RequeueAfter: retryAfter}, nil
+		}
+
+		// Unreachable or erroring brokers are retried with the controller's
+		// backoff while the database stays Provisioning
+		if brokerclient.IsTransient(err) {
+			log.Info("Broker call failed, will retry", "name", database.Name, "err", err)
+			if r.Recorder != nil {
+				r.Recorder.Eventf(database, "Warning", "ProvisioningRetrying", "Provisioning will be retried: %v", err)
+			}
+			return ctrl.Result{}, err
+		}
+
+		// A broker that rejected the request won't accept it again until the
+		// spec or the broker changes. Its explanation goes on the Ready
+		// condition.
 		log.Error(err, "Failed to provision database")
-		database.Status.Phase = "Failed"
-		if statusErr := UpdateStatusWithFallback(ctx, r.Client, database, log); statusErr != nil {
+		database.Status.SetPhase("Failed", ReasonProvisioningFailed)
+		message := err.Error()
+		var brokerErr *brokerclient.BrokerError
+		if stderrors.As(err, &brokerErr) {
+			if brokerErr.Message() != "" {
+				message = brokerErr.Message()
+			}
+			err = reconcile.TerminalError(err)
+		}
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               "Ready",
+			Status:             metav1.ConditionFalse,
+			Reason:             ReasonProvisioningFailed,
+			Message:            message,
+			ObservedGeneration: database.Generation,
+		})
+		if statusErr := UpdateStatusIfChanged(ctx, r.Client, database, log); statusErr != nil {
 			log.Error(statusErr, "Failed to update status to Failed")
 		}
 		return ctrl.Result{}, err
@@ -164,39 +462,137 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	return ctrl.Result{}, nil
 }
 
-// handleDeletion performs cleanup when a Database is being deleted
-func (r *DatabaseReconciler) handleDeletion(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
-	log := log.FromContext(ctx)
-
-	if !controllerutil.ContainsFinalizer(database, databaseFinalizerName) {
-		// Finalizer already removed, nothing to do
-		return ctrl.Result{}, nil
+// reconcileProvisioned follows a database the broker has accepted:
+// reconfiguring it, taking snapshots and checking its connection Secret.
+// Status updates otherwise come via webhook callbacks.
+func (r *DatabaseReconciler) reconcileProvisioned(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	// Keep an in-flight deployment's callbacks coming to the manager when
+	// its callback URL has moved
+	if callbackURLMoved(database) {
+		if err := r.reconcileCallbackURL(ctx, database); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	// Apply guardrail changes once the database is Ready; changes made
+	// while a deployment is running are picked up when it becomes Ready
+	if database.Status.Phase == "Ready" && guardrailsChanged(database) {
+		return r.reconfigureDatabase(ctx, database)
+	}
+	// Take requested snapshots and follow pending ones
+	if (database.Status.Phase == "Ready" && requestedSnapshot(database) != "") || hasPendingSnapshot(database) {
+		return r.reconcileSnapshots(ctx, database)
 	}
+	// Check the connection Secret the broker produced
+	if database.Status.Phase == "Ready" && database.Status.ConnectionSecretRef != nil {
+		return r.reconcileConnectionSecret(ctx, database)
+	}
+	log.FromContext(ctx).Info("Database already provisioned or in progress",
+		"deploymentId", database.Status.DeploymentID,
+		"phase", database.Status.Phase)
+	return ctrl.Result{}, nil
+}
 
-	log.Info("Handling Database deletion",
-		"name", database.Name,
-		"namespace", database.Namespace,
-		"deploymentId", database.Status.DeploymentID)
+// hasReadyReason reports whether the database's Ready condition has reason
+func hasReadyReason(database *platformv1.Database, reason string) bool {
+	cond := meta.FindStatusCondition(database.Status.Conditions, "Ready")
+	return cond != nil && cond.Reason == reason
+}
 
-	// Perform cleanup operations
-	if err := r.cleanupDatabase(ctx, database); err != nil {
-		log.Error(err, "Failed to cleanup Database, will retry")
-		// Don't remove finalizer yet, retry cleanup
-		return ctrl.Result{}, err
+// setWaiting records why the database cannot progress yet
+func setWaiting(database *platformv1.Database, reason, message string) {
+	setWaitingCondition(&database.Status.Conditions, database.Generation, reason, message)
+}
+
+// setThrottled records that brokers are pushing back and when provisioning
+// will be retried, so it isn't mistaken for a failure
+func setThrottled(database *platformv1.Database, retryAt time.Time) {
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:               ConditionThrottled,
+		Status:             metav1.ConditionTrue,
+		Reason:             WaitingReasonBrokerAtCapacity,
+		Message:            fmt.Sprintf("Waiting on broker capacity, retrying at %s", retryAt.UTC().Format(time.RFC3339)),
+		ObservedGeneration: database.Generation,
+	})
+}
+
+// isWaitingFor reports whether the database is already waiting for reason
+func isWaitingFor(database *platformv1.Database, reason string) bool {
+	cond := meta.FindStatusCondition(database.Status.Conditions, ConditionWaiting)
+	return cond != nil && cond.Status == metav1.ConditionTrue && cond.Reason == reason
+}
+
+// setWaitingCondition sets the Waiting condition on any resource's conditions
+func setWaitingCondition(conditions *[]metav1.Condition, generation int64, reason, message string) {
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               ConditionWaiting,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+}
+
+// waitingReasonFor classifies provisioning errors that mean "try again
+// later" and returns the Waiting reason and how long to wait
+func waitingReasonFor(err error) (string, time.Duration, bool) {
+	if stderrors.Is(err, brokerregistry.ErrBrokersAtCapacity) {
+		return WaitingReasonBrokerAtCapacity, defaultWaitRequeue, true
+	}
+	if stderrors.Is(err, brokerregistry.ErrNoBrokerAvailable) {
+		return WaitingReasonNoBrokerAvailable, defaultWaitRequeue, true
 	}
 
-	// Cleanup successful, remove finalizer
-	log.Info("Database cleanup completed, removing finalizer",
-		"name", database.Name,
-		"namespace", database.Namespace)
+	var brokerErr *brokerclient.BrokerError
+	if !stderrors.As(err, &brokerErr) {
+		return "", 0, false
+	}
+	retryAfter := brokerErr.RetryAfter
+	if retryAfter <= 0 {
+		retryAfter = defaultWaitRequeue
+	}
+	switch brokerErr.StatusCode {
+	case http.StatusServiceUnavailable:
+		return WaitingReasonBrokerAtCapacity, retryAfter, true
+	case http.StatusTooManyRequests:
+		return WaitingReasonTeamQuotaExceeded, retryAfter, true
+	}
+	return "", 0, false
+}
 
-	controllerutil.RemoveFinalizer(database, databaseFinalizerName)
-	if err := r.Update(ctx, database); err != nil {
-		log.Error(err, "Failed to remove finalizer")
-		return ctrl.Result{}, err
+// recordReconcile stamps the outcome of a reconcile onto the Database status.
+// The time is only stamped when the status differs from fetched, the Database
+// as the reconcile read it, so a reconcile that changes nothing writes nothing. Failures here are logged rather than
+// returned so they don't mask the reconcile result.
+func (r *DatabaseReconciler) recordReconcile(ctx context.Context, fetched, database *platformv1.Database, reconcileErr error) {
+	log := log.FromContext(ctx)
+
+	database.Status.LastError = ""
+	if reconcileErr != nil {
+		database.Status.LastError = reconcileErr.Error()
+	}
+	if !statusChangedSinceReconcile(fetched, database) {
+		log.V(2).Info("Status unchanged, skipping update", "name", database.Name, "namespace", database.Namespace)
+		return
 	}
+	now := metav1.Now()
+	database.Status.LastReconcileTime = &now
 
-	return ctrl.Result{}, nil
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		log.Error(err, "Failed to record reconcile outcome", "name", database.Name)
+	}
+}
+
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *DatabaseReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Database", Finalizer: databaseFinalizerName}
+}
+
+// handleDeletion performs cleanup when a Database is being deleted
+func (r *DatabaseReconciler) handleDeletion(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	return r.helper().HandleDeletion(ctx, database, func(ctx context.Context) error {
+		return r.cleanupDatabase(ctx, database)
+	})
 }
 
 // cleanupDatabase performs the actual cleanup operations
@@ -208,28 +604,27 @@ func (r *DatabaseReconciler) cleanupDatabase(ctx context.Context, database *plat
 		log.Info("Calling broker to deprovision database",
 			"deploymentId", database.Status.DeploymentID,
 			"engine", database.Spec.Engine)
-		// Prefer the broker that handled provisioning if recorded in status
+		// Deprovision through the broker that handled provisioning. Another
+		// broker wouldn't know the deployment, so don't pick one if it's gone.
 		var selectedBroker *platformv1.Broker
 		var err error
-		if database.Status.BrokerRef != nil && database.Status.BrokerRef.Name != "" {
-			// Try to fetch the Broker CR directly
-			broker := &platformv1.Broker{}
-			ns := database.Status.BrokerRef.Namespace
-			if ns == "" {
-				ns = database.Namespace
-			}
-			if getErr := r.Get(ctx, client.ObjectKey{Namespace: ns, Name: database.Status.BrokerRef.Name}, broker); getErr == nil {
-				selectedBroker = broker
-			} else {
-				log.Info("Recorded BrokerRef not found, falling back to registry selection",
-					"brokerRefName", database.Status.BrokerRef.Name, "err", getErr)
+		if ref := database.Status.BrokerRef; ref != nil && ref.Name != "" {
+			selectedBroker, err = r.recordedBroker(ctx, database)
+			if err != nil {
+				err = fmt.Errorf("broker %s that provisioned deployment %s is unavailable; restore it or remove the %s finalizer to abandon the deployment: %w",
+					brokerRefString(ref, database.Namespace), database.Status.DeploymentID, databaseFinalizerName, err)
+				if r.Recorder != nil {
+					r.Recorder.Event(database, "Warning", "BrokerNotFound", err.Error())
+				}
+				return err
 			}
 		}
 
-		// If no broker from status, select one matching capabilities
+		// Databases provisioned before the broker was recorded fall back to
+		// one matching their capabilities
 		if selectedBroker == nil {
 			criteria := brokerregistry.SelectionCriteria{
-				ResourceType: "Database",
+				ResourceType: platformv1.ResourceTypeDatabase,
 				Provider:     database.Spec.Engine,
 			}
 
@@ -242,24 +637,35 @@ func (r *DatabaseReconciler) cleanupDatabase(ctx context.Context, database *plat
 		}
 
 		if selectedBroker != nil {
-			// Create broker client for deprovisioning
-			brokerClient := brokerclient.NewClient(selectedBroker.Spec.Endpoint)
+			var span trace.Span
+			ctx, span = tracing.Tracer().Start(ctx, "DatabaseReconciler.deprovision", trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("kidp.database", database.Namespace+"/"+database.Name),
+					attribute.String("kidp.broker", selectedBroker.Name),
+					attribute.String("kidp.deployment_id", database.Status.DeploymentID),
+				))
+			defer span.End()
 
-			// Get callback URL from environment or use default
-			callbackURL := os.Getenv("KIDP_CALLBACK_URL")
-			if callbackURL == "" {
-				callbackURL = "http://manager-webhook-service.kidp-system.svc.cluster.local:9090/v1/callback"
+			// Create broker client for deprovisioning
+			brokerClient, err := r.brokerClient(ctx, selectedBroker)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return err
 			}
 
 			deprovReq := brokerclient.DeprovisionRequest{
-				DeploymentID: database.Status.DeploymentID,
-				ResourceType: "database",
-				ResourceName: database.Name,
-				Namespace:    database.Namespace,
-				CallbackURL:  callbackURL,
+				DeploymentID:    database.Status.DeploymentID,
+				ResourceType:    platformv1.ResourceTypeDatabase,
+				ResourceName:    database.Name,
+				Namespace:       database.Namespace,
+				TargetNamespace: database.Spec.TargetNamespace,
+				CallbackURL:     managerCallbackURL(),
 			}
 
 			if _, err := brokerClient.Deprovision(ctx, deprovReq); err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
 				return fmt.Errorf("failed to call broker deprovision: %w", err)
 			}
 
@@ -277,21 +683,32 @@ func (r *DatabaseReconciler) cleanupDatabase(ctx context.Context, database *plat
 }
 
 // provisionDatabase calls the broker to provision a new database
-func (r *DatabaseReconciler) provisionDatabase(ctx context.Context, database *platformv1.Database) error {
+func (r *DatabaseReconciler) provisionDatabase(ctx context.Context, database *platformv1.Database, tenant *platformv1.Tenant) error {
 	log := log.FromContext(ctx)
 
 	if r.BrokerRegistry == nil {
 		return fmt.Errorf("broker registry not configured")
 	}
 
+	// The admission webhook normally rejects these, but it is optional
+	if err := r.validateGuardrails(database); err != nil {
+		return err
+	}
+
 	// Select appropriate broker based on database spec
 	criteria := brokerregistry.SelectionCriteria{
-		ResourceType:  "Database",
-		CloudProvider: "",                   // Could be extracted from database.Spec.Target or labels
-		Region:        "",                   // Could be extracted from database.Spec.Target
+		ResourceType:  platformv1.ResourceTypeDatabase,
+		CloudProvider: "", // Could be extracted from database.Spec.Target or labels
+		Region:        database.Spec.Region,
 		Provider:      database.Spec.Engine, // e.g., "postgresql", "mysql"
 	}
 
+	// Keep the database within its tenant's placement policy
+	if tenant != nil && tenant.Spec.Placement != nil {
+		criteria.AllowedRegions = tenant.Spec.Placement.Regions
+		criteria.AllowedCloudProviders = tenant.Spec.Placement.CloudProviders
+	}
+
 	// TODO: Parse Target field to extract cloudProvider and region
 	// For now, if Target is not empty, try to use it as cloudProvider hint
 	if database.Spec.Target != "" {
@@ -303,49 +720,121 @@ func (r *DatabaseReconciler) provisionDatabase(ctx context.Context, database *pl
 	}
 
 	// Select broker
-	selectedBroker, err := r.BrokerRegistry.SelectBroker(ctx, criteria)
+	selection, err := r.BrokerRegistry.Select(ctx, criteria)
 	if err != nil {
 		return fmt.Errorf("failed to select broker: %w", err)
 	}
+	selectedBroker := selection.Broker
 
 	log.Info("Selected broker for provisioning",
 		"broker", selectedBroker.Name,
 		"endpoint", selectedBroker.Spec.Endpoint,
 		"cloudProvider", selectedBroker.Spec.CloudProvider,
-		"region", selectedBroker.Spec.Region)
+		"region", selectedBroker.Spec.Region,
+		"score", selection.Score,
+		"candidates", selection.Candidates)
+	if r.Recorder != nil {
+		if selection.Fallback {
+			r.Recorder.Eventf(database, "Warning", "BrokerSelected",
+				"No broker matched criteria: %s; using fallback broker %s/%s",
+				criteria, selectedBroker.Namespace, selectedBroker.Name)
+		} else {
+			r.Recorder.Eventf(database, "Normal", "BrokerSelected",
+				"Selected broker %s/%s (score %.1f, %s) for criteria: %s",
+				selectedBroker.Namespace, selectedBroker.Name, selection.Score, selection.Basis(), criteria)
+		}
+	}
+
+	// Fall back to the next best broker while the chosen one can't be reached
+	tried := map[string]bool{}
+	var alternates []*platformv1.Broker
+	for {
+		err := r.provisionWithBroker(ctx, database, tenant, selectedBroker)
+		if err == nil || !isBrokerUnreachable(ctx, err) {
+			return err
+		}
+		tried[selectedBroker.Namespace+"/"+selectedBroker.Name] = true
+
+		if alternates == nil {
+			alternates, _ = r.BrokerRegistry.SelectBrokers(ctx, criteria)
+		}
+		next := nextUntriedBroker(alternates, tried)
+		if next == nil {
+			return err
+		}
+		log.Info("Broker unreachable, failing over to the next candidate",
+			"broker", selectedBroker.Name, "next", next.Name, "err", err)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(database, "Warning", "BrokerFailover",
+				"Broker %s/%s is unreachable (%v); trying %s/%s",
+				selectedBroker.Namespace, selectedBroker.Name, err, next.Namespace, next.Name)
+		}
+		selectedBroker = next
+	}
+}
+
+// provisionWithBroker asks one broker to provision the database and records
+// the accepted deployment in its status
+func (r *DatabaseReconciler) provisionWithBroker(ctx context.Context, database *platformv1.Database, tenant *platformv1.Tenant, selectedBroker *platformv1.Broker) error {
+	log := log.FromContext(ctx)
+
+	// The span context is propagated to the broker and on into its callbacks
+	ctx, span := tracing.Tracer().Start(ctx, "DatabaseReconciler.provision", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.database", database.Namespace+"/"+database.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+		))
+	defer span.End()
 
 	// Create broker client for the selected broker
-	brokerClient := brokerclient.NewClient(selectedBroker.Spec.Endpoint)
-
-	// Get callback URL from environment or use default
-	callbackURL := os.Getenv("KIDP_CALLBACK_URL")
-	if callbackURL == "" {
-		callbackURL = "http://manager-webhook-service.kidp-system.svc.cluster.local:9090/v1/callback"
-	}
-
-	// Build provision request
-	provReq := brokerclient.ProvisionRequest{
-		ResourceType: "database",
-		ResourceName: database.Name,
-		Namespace:    database.Namespace,
-		Team:         fmt.Sprintf("%s/%s", database.Spec.Owner.Kind, database.Spec.Owner.Name),
-		Owner:        database.Spec.Owner.Name,
-		CallbackURL:  callbackURL,
-		Spec: map[string]interface{}{
-			"engine":  database.Spec.Engine,
-			"version": database.Spec.Version,
-			"size":    database.Spec.Size,
-		},
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
 	}
 
+	// The Broker CR's advertised regions can lag the broker's own, so check
+	// the live list before asking it to provision
+	if database.Spec.Region != "" {
+		regions, err := brokerClient.Regions(ctx)
+		if err != nil {
+			log.Info("Could not list broker regions, leaving region validation to the broker", "broker", selectedBroker.Name, "err", err)
+		} else if !regions.Supports(platformv1.ResourceTypeDatabase, database.Spec.Engine, database.Spec.Region) {
+			err := fmt.Errorf("broker %s/%s does not support %s in region %q", selectedBroker.Namespace, selectedBroker.Name, database.Spec.Engine, database.Spec.Region)
+			if r.Recorder != nil {
+				r.Recorder.Event(database, "Warning", "UnsupportedRegion", err.Error())
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			// Retrying won't help until the spec or the broker changes
+			return reconcile.TerminalError(err)
+		}
+	}
+
+	if err := r.checkApproval(ctx, brokerClient, database, tenant); err != nil {
+		span.SetAttributes(attribute.Bool("kidp.approval_required", true))
+		return err
+	}
+
+	// Issue a token scoped to this deployment; the broker echoes it on callbacks
+	token, err := callbacktoken.Issue(time.Now(), callbacktoken.DefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	provReq := databaseProvisionRequest(database, token.Token)
+
 	// Call broker
 	log.Info("Calling broker to provision database",
 		"engine", database.Spec.Engine,
 		"size", database.Spec.Size,
-		"callbackURL", callbackURL)
+		"callbackURL", provReq.CallbackURL)
 
 	resp, err := brokerClient.Provision(ctx, provReq)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to call broker provision: %w", err)
 	}
 
@@ -353,32 +842,478 @@ func (r *DatabaseReconciler) provisionDatabase(ctx context.Context, database *pl
 		"deploymentId", resp.DeploymentID,
 		"status", resp.Status)
 
-	// Store deploymentID in status
-	database.Status.DeploymentID = resp.DeploymentID
+	span.SetAttributes(attribute.String("kidp.deployment_id", resp.DeploymentID))
 
-	// Persist which broker handled the provisioning so deprovision targets the same broker
-	database.Status.BrokerRef = &platformv1.ObjectReference{
-		Name:      selectedBroker.Name,
-		Namespace: selectedBroker.Namespace,
+	// Hold a slot on the broker until its final callback, since its reported
+	// load lags behind what we dispatch
+	r.BrokerRegistry.Reserve(selectedBroker, resp.DeploymentID)
+
+	// Store deploymentID and the token hash in status. The broker has the
+	// deployment now, so a conflict must not lose them.
+	expires := metav1.NewTime(token.Expires)
+	err = UpdateStatusWithRetry(ctx, r.Client, database, log, func() {
+		database.Status.DeploymentID = resp.DeploymentID
+		database.Status.CallbackTokenHash = token.Hash
+		database.Status.CallbackTokenExpiry = &expires
+		database.Status.CallbackURL = provReq.CallbackURL
+
+		// Persist which broker handled the provisioning so deprovision targets the same broker
+		database.Status.BrokerRef = &platformv1.ObjectReference{
+			Name:      selectedBroker.Name,
+			Namespace: selectedBroker.Namespace,
+		}
+		// The broker's region until its callback reports where it placed the
+		// database
+		database.Status.Region = selectedBroker.Spec.Region
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update status with deploymentId: %w", err)
 	}
-	if err := r.Status().Update(ctx, database); err != nil {
-		// try fallback to full update for fake clients
-		if errors.IsNotFound(err) {
-			if uerr := r.Update(ctx, database); uerr != nil {
-				return fmt.Errorf("failed to update status with deploymentId (fallback): %w", uerr)
-			}
-		} else {
-			return fmt.Errorf("failed to update status with deploymentId: %w", err)
+
+	return nil
+}
+
+// reconfigureDatabase asks the broker that provisioned the database to apply
+// changed guardrails. The database keeps serving with the old values until the
+// broker reports them applied.
+func (r *DatabaseReconciler) reconfigureDatabase(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if err := r.validateGuardrails(database); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	selectedBroker, err := r.recordedBroker(ctx, database)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to find broker for reconfiguration: %w", err)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "DatabaseReconciler.reconfigure", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.database", database.Namespace+"/"+database.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+			attribute.String("kidp.deployment_id", database.Status.DeploymentID),
+		))
+	defer span.End()
+
+	// Callbacks for the reconfiguration must present a fresh token
+	token, err := callbacktoken.Issue(time.Now(), callbacktoken.DefaultTTL)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Calling broker to reconfigure database",
+		"deploymentId", database.Status.DeploymentID,
+		"broker", selectedBroker.Name)
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return ctrl.Result{}, err
+	}
+	_, err = brokerClient.Reconfigure(ctx, brokerclient.ReconfigureRequest{
+		DeploymentID:     database.Status.DeploymentID,
+		ProvisionRequest: databaseProvisionRequest(database, token.Token),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if _, retryAfter, ok := waitingReasonFor(err); ok {
+			log.Info("Broker cannot take the reconfiguration yet", "name", database.Name, "err", err)
+			return ctrl.Result{RequeueAfter: retryAfter}, nil
 		}
+		return ctrl.Result{}, fmt.Errorf("failed to call broker reconfigure: %w", err)
 	}
 
+	database.Status.SetPhase("Provisioning", "Reconfiguring")
+	database.Status.CallbackTokenHash = token.Hash
+	expires := metav1.NewTime(token.Expires)
+	database.Status.CallbackTokenExpiry = &expires
+	database.Status.CallbackURL = managerCallbackURL()
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		return ctrl.Result{}, err
+	}
+	if r.Recorder != nil {
+		r.Recorder.Eventf(database, "Normal", "Reconfiguring", "Applying connectionLimit=%s statementTimeout=%s readOnly=%t",
+			formatConnectionLimit(database.Spec.ConnectionLimit), formatStatementTimeout(database.Spec.StatementTimeout), database.Spec.ReadOnly)
+	}
+	return ctrl.Result{}, nil
+}
+
+// isBrokerUnreachable reports whether err means the request never reached
+// the broker, as opposed to the broker answering with an error
+func isBrokerUnreachable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var urlErr *url.Error
+	return stderrors.As(err, &urlErr)
+}
+
+// nextUntriedBroker returns the first broker not yet tried, or nil
+func nextUntriedBroker(brokers []*platformv1.Broker, tried map[string]bool) *platformv1.Broker {
+	for _, broker := range brokers {
+		if !tried[broker.Namespace+"/"+broker.Name] {
+			return broker
+		}
+	}
 	return nil
 }
 
+// validateGuardrails rejects guardrails the engine doesn't support. Retrying
+// won't help until the spec changes.
+func (r *DatabaseReconciler) validateGuardrails(database *platformv1.Database) error {
+	errs := database.Spec.ValidateGuardrails(field.NewPath("spec"))
+	if len(errs) == 0 {
+		return nil
+	}
+	err := errs.ToAggregate()
+	if r.Recorder != nil {
+		r.Recorder.Event(database, "Warning", "InvalidGuardrails", err.Error())
+	}
+	return reconcile.TerminalError(err)
+}
+
+// recordedBroker returns the Broker CR that provisioned the database
+func (r *DatabaseReconciler) recordedBroker(ctx context.Context, database *platformv1.Database) (*platformv1.Broker, error) {
+	return getRecordedBroker(ctx, r.Client, database.Status.BrokerRef, database.Namespace)
+}
+
+// getRecordedBroker returns the Broker CR a resource's status.brokerRef points
+// to. Refs recorded without a namespace look in the resource's namespace, then
+// for the only broker of that name in any namespace.
+func getRecordedBroker(ctx context.Context, c client.Client, ref *platformv1.ObjectReference, namespace string) (*platformv1.Broker, error) {
+	if ref == nil || ref.Name == "" {
+		return nil, fmt.Errorf("no recorded broker")
+	}
+	ns := ref.Namespace
+	if ns == "" {
+		ns = namespace
+	}
+	broker := &platformv1.Broker{}
+	err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: ref.Name}, broker)
+	if err == nil {
+		return broker, nil
+	}
+	if ref.Namespace != "" || !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var brokers platformv1.BrokerList
+	if listErr := c.List(ctx, &brokers); listErr != nil {
+		return nil, listErr
+	}
+	var found *platformv1.Broker
+	for i := range brokers.Items {
+		if brokers.Items[i].Name != ref.Name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("broker %q recorded without a namespace is ambiguous: found in %s and %s",
+				ref.Name, found.Namespace, brokers.Items[i].Namespace)
+		}
+		found = &brokers.Items[i]
+	}
+	if found == nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+// brokerRefString renders a broker ref as namespace/name, defaulting the
+// namespace as getRecordedBroker first does
+func brokerRefString(ref *platformv1.ObjectReference, namespace string) string {
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return namespace + "/" + ref.Name
+}
+
+// tierPriority is the broker queue priority of a database tier: prod work
+// goes ahead of dev work when the broker is saturated
+func tierPriority(tier string) int {
+	switch tier {
+	case platformv1.TierProd:
+		return brokerclient.PriorityHigh
+	case platformv1.TierDev:
+		return brokerclient.PriorityLow
+	default:
+		return brokerclient.PriorityNormal
+	}
+}
+
+// databaseProvisionRequest builds the broker request for the database's
+// current spec; reconfiguration sends the same request for the existing deployment
+func databaseProvisionRequest(database *platformv1.Database, callbackToken string) brokerclient.ProvisionRequest {
+	// Tier defaults also apply when the manager runs without admission webhooks
+	spec := database.Spec.DeepCopy()
+	spec.Default()
+
+	req := brokerclient.ProvisionRequest{
+		ResourceType:    platformv1.ResourceTypeDatabase,
+		ResourceName:    database.Name,
+		Namespace:       database.Namespace,
+		TargetNamespace: database.Spec.TargetNamespace,
+		Team:            fmt.Sprintf("%s/%s", database.Spec.Owner.Kind, database.Spec.Owner.Name),
+		Owner:           database.Spec.Owner.Name,
+		CallbackURL:     managerCallbackURL(),
+		CallbackToken:   callbackToken,
+		Source:          sourceFromAnnotations(database.Annotations),
+		Priority:        tierPriority(database.Spec.Tier),
+		Spec: map[string]interface{}{
+			"engine":  database.Spec.Engine,
+			"version": database.Spec.Version,
+			"size":    database.Spec.Size,
+			// Priced by the broker's cost estimator
+			"highAvailability": spec.HighAvailability != nil && *spec.HighAvailability,
+		},
+	}
+	if spec.Backup != nil {
+		req.Spec["backup"] = map[string]interface{}{
+			"enabled":   spec.Backup.Enabled,
+			"retention": spec.Backup.Retention,
+		}
+	}
+	if database.Spec.Region != "" {
+		req.Spec["region"] = database.Spec.Region
+	}
+	if database.Spec.ConnectionLimit != nil {
+		req.Spec["connectionLimit"] = *database.Spec.ConnectionLimit
+	}
+	if database.Spec.StatementTimeout != nil {
+		req.Spec["statementTimeout"] = database.Spec.StatementTimeout.Duration.String()
+	}
+	if database.Spec.ReadOnly {
+		req.Spec["readOnly"] = true
+	}
+	if ref := database.Spec.AdminCredentialsSecretRef; ref != nil {
+		// The broker reads it from the request's namespace
+		req.Spec["adminCredentialsSecretRef"] = map[string]interface{}{"name": ref.Name}
+	}
+	if len(database.Spec.InitScripts) > 0 {
+		req.Spec["initScripts"] = initScriptsSpec(database.Spec.InitScripts)
+	}
+	return req
+}
+
+// initScriptsSpec renders init scripts for the broker request. Referenced
+// scripts are passed by reference; the broker reads them from the request's
+// namespace.
+func initScriptsSpec(scripts []platformv1.InitScript) []interface{} {
+	keyRef := func(ref *platformv1.KeyReference) map[string]interface{} {
+		return map[string]interface{}{"name": ref.Name, "key": ref.Key}
+	}
+	out := make([]interface{}, 0, len(scripts))
+	for _, script := range scripts {
+		entry := map[string]interface{}{"name": script.Name}
+		switch {
+		case script.ConfigMapKeyRef != nil:
+			entry["configMapKeyRef"] = keyRef(script.ConfigMapKeyRef)
+		case script.SecretKeyRef != nil:
+			entry["secretKeyRef"] = keyRef(script.SecretKeyRef)
+		default:
+			entry["inline"] = script.Inline
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// sourceFromAnnotations reads a Database's provenance annotations, returning
+// nil when none are set
+func sourceFromAnnotations(annotations map[string]string) *brokerclient.Source {
+	source := &brokerclient.Source{
+		Repository:    annotations[AnnotationSourceRepository],
+		Revision:      annotations[AnnotationSourceRevision],
+		Path:          annotations[AnnotationSourcePath],
+		Application:   annotations[AnnotationSourceApplication],
+		CorrelationID: annotations[AnnotationCorrelationID],
+	}
+	if *source == (brokerclient.Source{}) {
+		return nil
+	}
+	return source
+}
+
+// managerCallbackURL returns the callback URL from the environment or the default
+func managerCallbackURL() string {
+	if callbackURL := os.Getenv("KIDP_CALLBACK_URL"); callbackURL != "" {
+		return callbackURL
+	}
+	return "http://manager-webhook-service.kidp-system.svc.cluster.local:9090/v1/callback"
+}
+
+// guardrailsChanged reports whether the spec's guardrails, including
+// read-only mode, differ from those the broker last applied
+func guardrailsChanged(database *platformv1.Database) bool {
+	spec, status := database.Spec, database.Status
+	if spec.ReadOnly != status.ReadOnly {
+		return true
+	}
+	if (spec.ConnectionLimit == nil) != (status.ConnectionLimit == nil) ||
+		(spec.ConnectionLimit != nil && *spec.ConnectionLimit != *status.ConnectionLimit) {
+		return true
+	}
+	if (spec.StatementTimeout == nil) != (status.StatementTimeout == nil) ||
+		(spec.StatementTimeout != nil && spec.StatementTimeout.Duration != status.StatementTimeout.Duration) {
+		return true
+	}
+	return false
+}
+
+func formatConnectionLimit(limit *int32) string {
+	if limit == nil {
+		return "default"
+	}
+	return fmt.Sprintf("%d", *limit)
+}
+
+func formatStatementTimeout(timeout *metav1.Duration) string {
+	if timeout == nil {
+		return "default"
+	}
+	return timeout.Duration.String()
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorderFor("database-controller")
+	// Status-only updates (including the reconcile bookkeeping above) must
+	// not retrigger reconciliation
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&platformv1.Database{}).
+		For(&platformv1.Database{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+			becameReady,
+		), r.Namespaces.Predicate())).
+		// A suspended database has no event of its own to wake it when its
+		// tenant, owner chain or namespace label appears
+		Watches(&platformv1.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.suspendedDatabases)).
+		// A tenant's placement policy admits or flags its databases
+		Watches(&platformv1.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.databasesUnderPlacement),
+			builder.WithPredicates(tenantPlacementChanged)).
+		Watches(&platformv1.Team{}, handler.EnqueueRequestsFromMapFunc(r.suspendedOrQuotaRejectedDatabases)).
+		Watches(&platformv1.Application{}, handler.EnqueueRequestsFromMapFunc(r.suspendedDatabases)).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.suspendedDatabases),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		Watches(&platformv1.DatabaseClass{}, handler.EnqueueRequestsFromMapFunc(r.databasesForClass)).
+		// Databases waiting for a broker would otherwise only retry on their
+		// requeue interval
+		Watches(&platformv1.Broker{}, handler.EnqueueRequestsFromMapFunc(r.databasesAwaitingBroker),
+			builder.WithPredicates(brokerBecameReady)).
+		// Provisioned databases follow their broker going Offline and back
+		Watches(&platformv1.Broker{}, handler.EnqueueRequestsFromMapFunc(r.databasesOnBroker),
+			builder.WithPredicates(brokerOfflineChanged)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
+
+// becameReady passes the status update that moves a Database to Ready, so
+// guardrails changed while it was provisioning are then reconfigured
+var becameReady = predicate.Funcs{
+	CreateFunc:  func(event.CreateEvent) bool { return false },
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldDB, ok := e.ObjectOld.(*platformv1.Database)
+		if !ok {
+			return false
+		}
+		newDB, ok := e.ObjectNew.(*platformv1.Database)
+		if !ok {
+			return false
+		}
+		return oldDB.Status.Phase != "Ready" && newDB.Status.Phase == "Ready"
+	},
+}
+
+// brokerBecameReady passes Brokers that are created Ready or move to Ready
+var brokerBecameReady = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		broker, ok := e.Object.(*platformv1.Broker)
+		return ok && broker.Status.Phase == "Ready"
+	},
+	DeleteFunc:  func(event.DeleteEvent) bool { return false },
+	GenericFunc: func(event.GenericEvent) bool { return false },
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBroker, ok := e.ObjectOld.(*platformv1.Broker)
+		if !ok {
+			return false
+		}
+		newBroker, ok := e.ObjectNew.(*platformv1.Broker)
+		if !ok {
+			return false
+		}
+		return oldBroker.Status.Phase != "Ready" && newBroker.Status.Phase == "Ready"
+	},
+}
+
+// databasesAwaitingBroker returns a request for every Pending Database that
+// found no broker, or only brokers at capacity, which a newly Ready broker
+// may now serve. The broker cache is refreshed first so their next
+// selection sees the new broker.
+func (r *DatabaseReconciler) databasesAwaitingBroker(ctx context.Context, obj client.Object) []reconcile.Request {
+	if r.BrokerRegistry != nil {
+		if err := r.BrokerRegistry.RefreshCache(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to refresh broker cache", "broker", obj.GetName())
+		}
+	}
+
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases awaiting a broker")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, db := range list.Items {
+		if db.Status.Phase != "Pending" || !db.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if isWaitingFor(&db, WaitingReasonNoBrokerAvailable) || isWaitingFor(&db, WaitingReasonBrokerAtCapacity) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+		}
+	}
+	return requests
+}
+
+// suspendedOrQuotaRejectedDatabases returns the suspended databases along
+// with those in the team's namespace rejected by its quota, which a change to
+// the team's quota may now admit
+func (r *DatabaseReconciler) suspendedOrQuotaRejectedDatabases(ctx context.Context, obj client.Object) []reconcile.Request {
+	requests := r.suspendedDatabases(ctx, obj)
+
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases rejected by team quota")
+		return requests
+	}
+	for _, db := range list.Items {
+		if isQuotaRejected(&db) && db.DeletionTimestamp.IsZero() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+		}
+	}
+	return requests
+}
+
+// suspendedDatabases returns a request for every Database suspended because
+// its tenant could not be resolved. Any change in the tenant hierarchy can
+// make a tenant resolvable, and suspended databases are few, so they are all
+// retried rather than working out which ones the change affects.
+func (r *DatabaseReconciler) suspendedDatabases(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.DatabaseList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list databases awaiting a tenant")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, db := range list.Items {
+		if db.Status.Phase != "Suspended" || !db.DeletionTimestamp.IsZero() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&db)})
+	}
+	return requests
+}
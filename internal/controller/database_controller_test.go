@@ -2,19 +2,31 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
 )
 
 func TestDatabaseReconciler_LabelFromNamespace(t *testing.T) {
@@ -100,3 +112,2211 @@ func TestDatabaseReconciler_SuspendWhenNoTenant(t *testing.T) {
 		t.Fatalf("expected db to be Suspended when no tenant found, got phase=%s", out.Status.Phase)
 	}
 }
+
+func TestDatabaseReconciler_UnsuspendsWhenTenantCreated(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-early")
+	db.Labels = nil
+	ready := provisionableDatabase("db-ready")
+	ready.Status.Phase = "Ready"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db, ready).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Suspended" {
+		t.Fatalf("expected db to be Suspended before its tenant exists, got phase=%s", out.Status.Phase)
+	}
+
+	// Creating the tenant must wake the suspended database, and only it
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	if err := cl.Create(ctx, tenant); err != nil {
+		t.Fatalf("failed to create tenant: %v", err)
+	}
+	requests := r.suspendedDatabases(ctx, tenant)
+	if len(requests) != 1 || requests[0] != req {
+		t.Fatalf("expected tenant creation to enqueue only %v, got %v", req, requests)
+	}
+
+	if _, err := r.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase == "Suspended" {
+		t.Fatalf("expected db to unsuspend once its tenant exists")
+	}
+	if meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting) != nil {
+		t.Fatalf("expected Waiting condition to be cleared, got %+v", out.Status.Conditions)
+	}
+	if out.Labels["platform.company.com/tenant"] != "acme" {
+		t.Fatalf("expected tenant label acme, got %v", out.Labels)
+	}
+}
+
+func TestDatabaseReconciler_RecordsReconcileOutcome(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "dev", Labels: map[string]string{"platform.company.com/tenant": "acme"}}}
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db3"}}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, ns, db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, BrokerRegistry: nil, Recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "dev", Name: "db3"}}
+
+	// Adding the finalizer succeeds and is recorded without an error
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("first reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.LastReconcileTime == nil {
+		t.Fatalf("expected LastReconcileTime to be set after a successful reconcile")
+	}
+	if out.Status.LastError != "" {
+		t.Fatalf("expected LastError to be empty after a successful reconcile, got %q", out.Status.LastError)
+	}
+	firstReconcile := out.Status.LastReconcileTime
+
+	// Labelling with the tenant, then provisioning fails without a broker registry
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("second reconcile returned error: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err == nil {
+		t.Fatalf("expected provisioning to fail without a broker registry")
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.LastError == "" {
+		t.Fatalf("expected LastError to be recorded after a failed reconcile")
+	}
+	if out.Status.LastReconcileTime == nil || out.Status.LastReconcileTime.Before(firstReconcile) {
+		t.Fatalf("expected LastReconcileTime to advance, got %v", out.Status.LastReconcileTime)
+	}
+	if out.Status.Phase != "Failed" {
+		t.Fatalf("expected phase Failed, got %s", out.Status.Phase)
+	}
+}
+
+func TestDatabaseReconciler_NoOpReconcileWritesNothing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db2"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	// Add the finalizer, then suspend for want of a tenant
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Suspended" || out.Status.LastReconcileTime == nil {
+		t.Fatalf("expected a suspended, stamped database, got %+v", out.Status)
+	}
+	// Age the stamp so a fresh one would differ
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	out.Status.LastReconcileTime = &earlier
+	if err := cl.Status().Update(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	rv := out.ResourceVersion
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.ResourceVersion != rv {
+		t.Fatalf("expected a reconcile that changes nothing to leave resourceVersion %s, got %s", rv, out.ResourceVersion)
+	}
+	if !out.Status.LastReconcileTime.Equal(&earlier) {
+		t.Fatalf("expected LastReconcileTime to stay %v, got %v", earlier, out.Status.LastReconcileTime)
+	}
+}
+
+func TestDatabaseReconciler_PhaseChangeRestampsReconcileTime(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	var calls int
+	srv := countingBroker(&calls)
+	defer srv.Close()
+
+	db := provisionableDatabase("db-restamp")
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	// Suspend for want of the tenant, then age the stamp
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Suspended" {
+		t.Fatalf("expected a suspended database, got %s", out.Status.Phase)
+	}
+	earlier := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	out.Status.LastReconcileTime = &earlier
+	if err := cl.Status().Update(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tenant appearing moves the database on; the reconcile saves the
+	// new phase itself before the outcome is recorded
+	if err := cl.Create(ctx, &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Provisioning" || out.Status.LastError != "" {
+		t.Fatalf("expected the database to be provisioning without error, got %s %q", out.Status.Phase, out.Status.LastError)
+	}
+	if out.Status.LastReconcileTime == nil || !out.Status.LastReconcileTime.After(earlier.Time) {
+		t.Fatalf("expected the phase change to restamp LastReconcileTime after %v, got %v", earlier, out.Status.LastReconcileTime)
+	}
+}
+
+func TestDatabaseReconciler_RecordsPhaseTransitions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	brokerSrv := brokerReturning(http.StatusAccepted, "accepted", "")
+	defer brokerSrv.Close()
+
+	db := provisionableDatabase("db-history")
+	db.Labels = nil
+	// A full history drops its oldest entries as new ones are recorded
+	for i := 0; i < platformv1.MaxPhaseTransitions; i++ {
+		db.Status.Transitions = append(db.Status.Transitions, platformv1.PhaseTransition{To: "Old"})
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db, brokerFor(brokerSrv.URL, 0, 0)).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, BrokerRegistry: brokerregistry.NewRegistry(cl), Recorder: record.NewFakeRecorder(10)}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Create(ctx, &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}); err != nil {
+		t.Fatalf("failed to create tenant: %v", err)
+	}
+	// The first reconcile after the tenant appears labels the database and
+	// requeues; the next one provisions it
+	for i := 0; i < 2; i++ {
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	transitions := out.Status.Transitions
+	if len(transitions) != platformv1.MaxPhaseTransitions {
+		t.Fatalf("expected the history to be capped at %d, got %d", platformv1.MaxPhaseTransitions, len(transitions))
+	}
+	want := []platformv1.PhaseTransition{
+		{From: "", To: "Suspended", Reason: WaitingReasonTenantUnresolved},
+		{From: "Suspended", To: "Pending", Reason: "TenantResolved"},
+		{From: "Pending", To: "Provisioning", Reason: "ProvisioningStarted"},
+	}
+	recent := transitions[len(transitions)-len(want):]
+	for i, got := range recent {
+		if got.From != want[i].From || got.To != want[i].To || got.Reason != want[i].Reason {
+			t.Fatalf("transition %d: expected %+v, got %+v", i, want[i], got)
+		}
+		if got.Timestamp.IsZero() {
+			t.Fatalf("transition %d has no timestamp", i)
+		}
+	}
+}
+
+func TestDatabaseReconciler_RecordsBrokerSelectedEvent(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	brokerSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "deploymentId": "deploy-1"})
+	}))
+	defer brokerSrv.Close()
+
+	brokerCR := &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"},
+		Spec: platformv1.BrokerSpec{
+			Endpoint:      brokerSrv.URL,
+			CloudProvider: "on-prem",
+			Priority:      100,
+			Capabilities:  []platformv1.BrokerCapability{{ResourceType: "Database", Providers: []string{"postgresql"}}},
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready"},
+	}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	db := &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "db4",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{databaseFinalizerName},
+		},
+		Spec: platformv1.DatabaseSpec{Engine: "postgresql", Owner: platformv1.OwnerReference{Kind: "Tenant", Name: "acme"}},
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(brokerCR, tenant, db).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, BrokerRegistry: brokerregistry.NewRegistry(cl), Recorder: recorder}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "dev", Name: "db4"}}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	for {
+		select {
+		case event := <-recorder.Events:
+			if !strings.Contains(event, "BrokerSelected") {
+				continue
+			}
+			for _, want := range []string{"kidp-system/broker-a", "score", "resourceType=database", "provider=postgresql"} {
+				if !strings.Contains(event, want) {
+					t.Fatalf("expected BrokerSelected event to mention %q, got: %s", want, event)
+				}
+			}
+			return
+		default:
+			t.Fatalf("expected a BrokerSelected event to be recorded")
+		}
+	}
+}
+
+// provisionableDatabase returns a Database that is ready to be handed to a broker
+func provisionableDatabase(name string) *platformv1.Database {
+	return &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       name,
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{databaseFinalizerName},
+		},
+		Spec: platformv1.DatabaseSpec{Engine: "postgresql", Owner: platformv1.OwnerReference{Kind: "Tenant", Name: "acme"}},
+	}
+}
+
+func brokerReturning(status int, code string, retryAfter string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": code, "message": code, "code": status})
+	}))
+}
+
+func brokerFor(endpoint string, active, max int32) *platformv1.Broker {
+	return &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"},
+		Spec: platformv1.BrokerSpec{
+			Endpoint:                 endpoint,
+			CloudProvider:            "on-prem",
+			MaxConcurrentDeployments: max,
+			Capabilities:             []platformv1.BrokerCapability{{ResourceType: "Database", Providers: []string{"postgresql"}}},
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready", ActiveDeployments: active},
+	}
+}
+
+func TestDatabaseReconciler_WaitingReasons(t *testing.T) {
+	quota := brokerReturning(http.StatusTooManyRequests, "team_quota_exceeded", "")
+	defer quota.Close()
+	busy := brokerReturning(http.StatusServiceUnavailable, "broker_at_capacity", "15")
+	defer busy.Close()
+
+	activeTenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	suspendedTenant := activeTenant.DeepCopy()
+	suspendedTenant.Status.Phase = "Suspended"
+
+	unresolved := provisionableDatabase("db-unresolved")
+	unresolved.Spec.Owner = platformv1.OwnerReference{Kind: "Tenant", Name: "missing"}
+
+	tests := []struct {
+		name         string
+		objs         []client.Object
+		db           *platformv1.Database
+		wantReason   string
+		wantPhase    string
+		wantRequeue  time.Duration
+		withRegistry bool
+	}{
+		{
+			name:       "tenant unresolved",
+			db:         unresolved,
+			wantReason: WaitingReasonTenantUnresolved,
+			wantPhase:  "Suspended",
+		},
+		{
+			name:        "tenant suspended",
+			objs:        []client.Object{suspendedTenant},
+			db:          provisionableDatabase("db-suspended"),
+			wantReason:  WaitingReasonTenantSuspended,
+			wantPhase:   "Pending",
+			wantRequeue: defaultWaitRequeue,
+		},
+		{
+			name:         "all brokers at capacity",
+			objs:         []client.Object{activeTenant, brokerFor("http://unused", 5, 5)},
+			db:           provisionableDatabase("db-saturated"),
+			wantReason:   WaitingReasonBrokerAtCapacity,
+			wantPhase:    "Pending",
+			wantRequeue:  defaultWaitRequeue,
+			withRegistry: true,
+		},
+		{
+			name:         "broker rejects at capacity",
+			objs:         []client.Object{activeTenant, brokerFor(busy.URL, 0, 10)},
+			db:           provisionableDatabase("db-busy"),
+			wantReason:   WaitingReasonBrokerAtCapacity,
+			wantPhase:    "Pending",
+			wantRequeue:  15 * time.Second,
+			withRegistry: true,
+		},
+		{
+			name:         "team quota exceeded",
+			objs:         []client.Object{activeTenant, brokerFor(quota.URL, 0, 10)},
+			db:           provisionableDatabase("db-quota"),
+			wantReason:   WaitingReasonTeamQuotaExceeded,
+			wantPhase:    "Pending",
+			wantRequeue:  defaultWaitRequeue,
+			withRegistry: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = platformv1.AddToScheme(scheme)
+			_ = corev1.AddToScheme(scheme)
+
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(tt.objs, tt.db)...).Build()
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+			if tt.withRegistry {
+				r.BrokerRegistry = brokerregistry.NewRegistry(cl)
+			}
+
+			res, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(tt.db)})
+			if err != nil {
+				t.Fatalf("expected waiting rather than an error, got: %v", err)
+			}
+			if res.RequeueAfter != tt.wantRequeue {
+				t.Fatalf("expected requeue after %v, got %v", tt.wantRequeue, res.RequeueAfter)
+			}
+
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(tt.db), out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			if out.Status.Phase != tt.wantPhase {
+				t.Fatalf("expected phase %s, got %s", tt.wantPhase, out.Status.Phase)
+			}
+			cond := meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting)
+			if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != tt.wantReason {
+				t.Fatalf("expected Waiting condition with reason %s, got %+v", tt.wantReason, cond)
+			}
+			if cond.Message == "" {
+				t.Fatalf("expected Waiting condition to explain the reason")
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_ThrottledByBrokerBackpressure(t *testing.T) {
+	busy := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if busy {
+			w.Header().Set("Retry-After", "20")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": "broker_at_capacity", "code": http.StatusServiceUnavailable})
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-throttled")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	before := time.Now()
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("expected throttling rather than an error, got: %v", err)
+	}
+	if res.RequeueAfter != 20*time.Second {
+		t.Fatalf("expected requeue after the broker's Retry-After, got %v", res.RequeueAfter)
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.Phase != "Pending" {
+		t.Fatalf("expected phase Pending while throttled, got %s", out.Status.Phase)
+	}
+	cond := meta.FindStatusCondition(out.Status.Conditions, ConditionThrottled)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != WaitingReasonBrokerAtCapacity {
+		t.Fatalf("expected a Throttled condition, got %+v", cond)
+	}
+	retryAt, err := time.Parse(time.RFC3339, cond.Message[strings.LastIndex(cond.Message, " ")+1:])
+	if err != nil {
+		t.Fatalf("expected the retry time in the message, got %q", cond.Message)
+	}
+	if wantAt := before.Add(20 * time.Second).Truncate(time.Second); retryAt.Before(wantAt) || retryAt.After(wantAt.Add(5*time.Second)) {
+		t.Fatalf("expected a retry around %s, got %s", wantAt, retryAt)
+	}
+
+	// Capacity frees up: the next attempt goes through and clears the condition
+	busy = false
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(out.Status.Conditions, ConditionThrottled) != nil {
+		t.Fatalf("expected the Throttled condition to be cleared, got %+v", out.Status.Conditions)
+	}
+}
+
+func TestDatabaseReconciler_RejectsUnsupportedRegion(t *testing.T) {
+	provisioned := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/regions" {
+			_ = json.NewEncoder(w).Encode(brokerclient.RegionsResponse{Regions: []brokerclient.ProviderRegions{
+				{ResourceType: "database", Provider: "postgresql", Regions: []string{"westeurope"}},
+			}})
+			return
+		}
+		provisioned = true
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-region")
+	db.Spec.Region = "eastus"
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+	if err == nil || !errors.Is(err, reconcile.TerminalError(nil)) {
+		t.Fatalf("expected a terminal error for an unsupported region, got %v", err)
+	}
+	if provisioned {
+		t.Fatalf("expected the broker not to be asked to provision")
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Failed" {
+		t.Fatalf("expected phase Failed, got %s", out.Status.Phase)
+	}
+
+	found := false
+	for len(recorder.Events) > 0 {
+		if e := <-recorder.Events; strings.Contains(e, "UnsupportedRegion") && strings.Contains(e, "eastus") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected an UnsupportedRegion event")
+	}
+}
+
+func TestDatabaseReconciler_IssuesCallbackToken(t *testing.T) {
+	var sent brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-token")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if sent.CallbackToken == "" {
+		t.Fatalf("expected a callback token to be sent to the broker")
+	}
+	if out.Status.CallbackTokenExpiry == nil {
+		t.Fatalf("expected the token expiry to be recorded")
+	}
+	if err := callbacktoken.Verify(sent.CallbackToken, out.Status.CallbackTokenHash, out.Status.CallbackTokenExpiry.Time, time.Now()); err != nil {
+		t.Fatalf("expected the sent token to verify against the stored hash: %v", err)
+	}
+	if strings.Contains(out.Status.CallbackTokenHash, sent.CallbackToken) {
+		t.Fatalf("the token itself must not be stored")
+	}
+}
+
+func TestDatabaseReconciler_PropagatesGuardrails(t *testing.T) {
+	var sent brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	limit := int32(200)
+	db := provisionableDatabase("db-guardrails")
+	db.Spec.ConnectionLimit = &limit
+	db.Spec.StatementTimeout = &metav1.Duration{Duration: 30 * time.Second}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if sent.Spec["connectionLimit"] != float64(200) || sent.Spec["statementTimeout"] != "30s" {
+		t.Fatalf("expected guardrails in the provision spec, got %v", sent.Spec)
+	}
+}
+
+func TestDatabaseReconciler_ReconfiguresOnGuardrailChange(t *testing.T) {
+	var calls int
+	var sent brokerclient.ReconfigureRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/reconfigure" {
+			http.NotFound(w, r)
+			return
+		}
+		calls++
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: sent.DeploymentID, Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	applied, wanted := int32(100), int32(250)
+	db := provisionableDatabase("db-reconfigure")
+	db.Spec.ConnectionLimit = &applied
+	db.Status.Phase = "Ready"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	db.Status.ConnectionLimit = &applied
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	// Guardrails already applied: nothing to do
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected no reconfiguration while guardrails match, got %d calls", calls)
+	}
+
+	current := &platformv1.Database{}
+	if err := cl.Get(context.Background(), req.NamespacedName, current); err != nil {
+		t.Fatal(err)
+	}
+	current.Spec.ConnectionLimit = &wanted
+	current.Spec.StatementTimeout = &metav1.Duration{Duration: 5 * time.Second}
+	if err := cl.Update(context.Background(), current); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected one reconfiguration, got %d", calls)
+	}
+	if sent.DeploymentID != "deploy-1" || sent.Spec["connectionLimit"] != float64(250) || sent.Spec["statementTimeout"] != "5s" {
+		t.Fatalf("expected the new guardrails for deploy-1, got %s %v", sent.DeploymentID, sent.Spec)
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.Phase != "Provisioning" {
+		t.Fatalf("expected phase Provisioning while reconfiguring, got %s", out.Status.Phase)
+	}
+	if err := callbacktoken.Verify(sent.CallbackToken, out.Status.CallbackTokenHash, out.Status.CallbackTokenExpiry.Time, time.Now()); err != nil {
+		t.Fatalf("expected a fresh callback token for the reconfiguration: %v", err)
+	}
+	if *out.Status.ConnectionLimit != applied {
+		t.Fatalf("applied connection limit must not change until the broker reports it, got %d", *out.Status.ConnectionLimit)
+	}
+	if ev := <-recorder.Events; !strings.Contains(ev, "Reconfiguring") || !strings.Contains(ev, "connectionLimit=250") {
+		t.Fatalf("expected a Reconfiguring event, got %q", ev)
+	}
+
+	// A second reconcile while the broker works doesn't resend
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected no reconfiguration while one is in progress, got %d calls", calls)
+	}
+}
+
+func TestDatabaseReconciler_TogglesReadOnly(t *testing.T) {
+	var sent []brokerclient.ReconfigureRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/reconfigure" {
+			http.NotFound(w, r)
+			return
+		}
+		var req brokerclient.ReconfigureRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		sent = append(sent, req)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: req.DeploymentID, Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-read-only")
+	db.Status.Phase = "Ready"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	// toggle sets spec.readOnly, reconciles, then stands in for the broker's
+	// callback by recording the applied state and returning to Ready
+	toggle := func(readOnly bool) {
+		t.Helper()
+		current := &platformv1.Database{}
+		if err := cl.Get(context.Background(), req.NamespacedName, current); err != nil {
+			t.Fatal(err)
+		}
+		current.Spec.ReadOnly = readOnly
+		if err := cl.Update(context.Background(), current); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+		if err := cl.Get(context.Background(), req.NamespacedName, current); err != nil {
+			t.Fatal(err)
+		}
+		current.Status.Phase = "Ready"
+		current.Status.ReadOnly = readOnly
+		if err := cl.Status().Update(context.Background(), current); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toggle(true)
+	if len(sent) != 1 || sent[0].Spec["readOnly"] != true {
+		t.Fatalf("expected a reconfiguration making the database read-only, got %+v", sent)
+	}
+
+	toggle(false)
+	if len(sent) != 2 {
+		t.Fatalf("expected a reconfiguration making the database writable, got %d calls", len(sent))
+	}
+	if _, ok := sent[1].Spec["readOnly"]; ok {
+		t.Fatalf("expected readOnly to be omitted once writable, got %v", sent[1].Spec)
+	}
+
+	// Applied state matches the spec again: nothing more to send
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(sent) != 2 {
+		t.Fatalf("expected no reconfiguration once read-only state is applied, got %d calls", len(sent))
+	}
+}
+
+func TestDatabaseReconciler_RejectsUnsupportedGuardrails(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-redis")
+	db.Spec.Engine = "redis"
+	db.Spec.StatementTimeout = &metav1.Duration{Duration: time.Second}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+	if !errors.Is(err, reconcile.TerminalError(nil)) {
+		t.Fatalf("expected a terminal error, got %v", err)
+	}
+	if calls != 0 {
+		t.Fatalf("expected the broker not to be called, got %d calls", calls)
+	}
+	var found bool
+	for len(recorder.Events) > 0 {
+		if strings.Contains(<-recorder.Events, "InvalidGuardrails") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected an InvalidGuardrails event")
+	}
+}
+
+func TestBecameReadyPredicate(t *testing.T) {
+	withPhase := func(phase string) *platformv1.Database {
+		db := provisionableDatabase("db1")
+		db.Status.Phase = phase
+		return db
+	}
+	if !becameReady.Update(event.UpdateEvent{ObjectOld: withPhase("Provisioning"), ObjectNew: withPhase("Ready")}) {
+		t.Fatalf("expected the move to Ready to trigger a reconcile")
+	}
+	if becameReady.Update(event.UpdateEvent{ObjectOld: withPhase("Ready"), ObjectNew: withPhase("Ready")}) {
+		t.Fatalf("expected an update that stays Ready not to trigger a reconcile")
+	}
+}
+
+func TestDatabaseReconciler_PropagatesSource(t *testing.T) {
+	var sent brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-source")
+	db.Annotations = map[string]string{
+		AnnotationSourceRepository: "https://github.com/acme/platform",
+		AnnotationSourceRevision:   "4f2c1ab",
+		AnnotationSourcePath:       "envs/prod/db.yaml",
+		AnnotationCorrelationID:    "chg-42",
+	}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	want := brokerclient.Source{
+		Repository:    "https://github.com/acme/platform",
+		Revision:      "4f2c1ab",
+		Path:          "envs/prod/db.yaml",
+		CorrelationID: "chg-42",
+	}
+	if sent.Source == nil || *sent.Source != want {
+		t.Fatalf("expected source %+v, got %+v", want, sent.Source)
+	}
+
+	if src := sourceFromAnnotations(map[string]string{"unrelated": "x"}); src != nil {
+		t.Fatalf("expected no source without provenance annotations, got %+v", src)
+	}
+}
+
+func TestDatabaseProvisionRequest_TierDefaults(t *testing.T) {
+	db := provisionableDatabase("db-prod")
+	db.Spec.Tier = platformv1.TierProd
+
+	req := databaseProvisionRequest(db, "")
+	if req.Spec["highAvailability"] != true {
+		t.Fatalf("expected prod tier to default to high availability, got %v", req.Spec)
+	}
+	backup, ok := req.Spec["backup"].(map[string]interface{})
+	if !ok || backup["enabled"] != true || backup["retention"] != "30d" {
+		t.Fatalf("expected prod tier to default to 30d backups, got %v", req.Spec["backup"])
+	}
+	if db.Spec.HighAvailability != nil || db.Spec.Backup != nil {
+		t.Fatalf("expected defaults not to be written back to the Database, got %+v", db.Spec)
+	}
+
+	ha := false
+	db.Spec.HighAvailability = &ha
+	if req := databaseProvisionRequest(db, ""); req.Spec["highAvailability"] != false {
+		t.Fatalf("expected explicit highAvailability to win over the tier, got %v", req.Spec)
+	}
+}
+
+func TestDatabaseProvisionRequest_TierPriority(t *testing.T) {
+	for tier, want := range map[string]int{
+		platformv1.TierProd:    brokerclient.PriorityHigh,
+		platformv1.TierStaging: brokerclient.PriorityNormal,
+		"":                     brokerclient.PriorityNormal,
+		platformv1.TierDev:     brokerclient.PriorityLow,
+	} {
+		db := provisionableDatabase("db1")
+		db.Spec.Tier = tier
+		if got := databaseProvisionRequest(db, "").Priority; got != want {
+			t.Errorf("tier %q: expected priority %d, got %d", tier, want, got)
+		}
+	}
+}
+
+func TestDatabaseReconciler_ApprovalGate(t *testing.T) {
+	provisioned := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/estimate":
+			_ = json.NewEncoder(w).Encode(brokerclient.CostEstimate{MonthlyCost: 480, Currency: "USD"})
+		case "/v1/provision":
+			provisioned++
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	threshold := func(v float64) *platformv1.Budget {
+		return &platformv1.Budget{MonthlyLimit: 1000, ApprovalThreshold: &v}
+	}
+
+	tests := []struct {
+		name         string
+		teamBudget   *platformv1.Budget
+		tenantBudget *platformv1.Budget
+		wantGated    bool
+	}{
+		{name: "no threshold", wantGated: false},
+		{name: "under team threshold", teamBudget: threshold(500), wantGated: false},
+		{name: "over team threshold", teamBudget: threshold(200), wantGated: true},
+		{name: "over tenant threshold", tenantBudget: threshold(200), wantGated: true},
+		{name: "team threshold overrides tenant", teamBudget: threshold(500), tenantBudget: threshold(200), wantGated: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provisioned = 0
+			scheme := runtime.NewScheme()
+			_ = platformv1.AddToScheme(scheme)
+			_ = corev1.AddToScheme(scheme)
+
+			tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}, Spec: platformv1.TenantSpec{Budget: tt.tenantBudget}}
+			team := &platformv1.Team{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments"},
+				Spec:       platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "acme"}, Budget: tt.teamBudget},
+			}
+			db := provisionableDatabase("db-costly")
+			db.Spec.Owner = platformv1.OwnerReference{Kind: "Team", Name: "payments"}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, team, brokerFor(srv.URL, 0, 10), db).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+			req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+			res, err := r.Reconcile(context.Background(), req)
+			if err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+
+			if !tt.wantGated {
+				if provisioned != 1 || out.Status.Phase != "Provisioning" {
+					t.Fatalf("expected the database to be provisioned, got phase=%s provisioned=%d", out.Status.Phase, provisioned)
+				}
+				return
+			}
+
+			if provisioned != 0 {
+				t.Fatalf("expected no provision call while awaiting approval")
+			}
+			if out.Status.Phase != "PendingApproval" || res.RequeueAfter != 0 {
+				t.Fatalf("expected PendingApproval without requeue, got phase=%s requeue=%v", out.Status.Phase, res.RequeueAfter)
+			}
+			cond := meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting)
+			if cond == nil || cond.Reason != WaitingReasonApprovalRequired || !strings.Contains(cond.Message, "$480.00") {
+				t.Fatalf("expected an ApprovalRequired condition quoting the estimate, got %+v", cond)
+			}
+			if out.Status.Cost == nil || out.Status.Cost.EstimatedMonthly != 480 {
+				t.Fatalf("expected the estimate to be recorded, got %+v", out.Status.Cost)
+			}
+			gotEvent := false
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, "ApprovalRequired") {
+					gotEvent = true
+				}
+			}
+			if !gotEvent {
+				t.Fatalf("expected an ApprovalRequired event")
+			}
+
+			// Approval releases the gate
+			out.Annotations = map[string]string{AnnotationApproved: "true"}
+			if err := cl.Update(context.Background(), out); err != nil {
+				t.Fatalf("failed to approve db: %v", err)
+			}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			if provisioned != 1 || out.Status.Phase != "Provisioning" || out.Status.DeploymentID != "deploy-1" {
+				t.Fatalf("expected the approved database to be provisioned, got phase=%s deploymentId=%s", out.Status.Phase, out.Status.DeploymentID)
+			}
+			if meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting) != nil {
+				t.Fatalf("expected the Waiting condition to be cleared once approved")
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_TeamQuota(t *testing.T) {
+	provisioned := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req brokerclient.ProvisionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		provisioned[req.ResourceName]++
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-" + req.ResourceName, Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	maxDatabases := int32(1)
+	team := &platformv1.Team{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments"},
+		Spec: platformv1.TeamSpec{
+			TenantRef: &platformv1.ObjectReference{Name: "acme"},
+			Quotas:    &platformv1.TeamQuotas{MaxDatabases: &maxDatabases},
+		},
+	}
+	first := provisionableDatabase("db-first")
+	first.Spec.Owner = platformv1.OwnerReference{Kind: "Team", Name: "payments"}
+	first.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	second := provisionableDatabase("db-second")
+	second.Spec.Owner = platformv1.OwnerReference{Kind: "Team", Name: "payments"}
+	second.CreationTimestamp = metav1.Now()
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, team, brokerFor(srv.URL, 0, 10), first, second).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	reconcileDB := func(db *platformv1.Database) *platformv1.Database {
+		t.Helper()
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+		if _, err := r.Reconcile(context.Background(), req); err != nil {
+			t.Fatalf("reconcile %s returned error: %v", db.Name, err)
+		}
+		out := &platformv1.Database{}
+		if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+			t.Fatalf("failed to get %s: %v", db.Name, err)
+		}
+		return out
+	}
+
+	// The newer database is rejected even when it is reconciled first,
+	// because the older one is ahead of it for the team's only slot
+	out := reconcileDB(second)
+	if out.Status.Phase != "Failed" || provisioned["db-second"] != 0 {
+		t.Fatalf("expected db-second to fail without calling the broker, got phase=%s calls=%d", out.Status.Phase, provisioned["db-second"])
+	}
+	cond := meta.FindStatusCondition(out.Status.Conditions, "Ready")
+	if cond == nil || cond.Reason != ReasonQuotaExceeded || !strings.Contains(cond.Message, "quota of 1") {
+		t.Fatalf("expected a QuotaExceeded condition, got %+v", cond)
+	}
+	gotEvent := false
+	for len(recorder.Events) > 0 {
+		if strings.HasPrefix(<-recorder.Events, "Warning QuotaExceeded") {
+			gotEvent = true
+		}
+	}
+	if !gotEvent {
+		t.Fatalf("expected a QuotaExceeded warning event")
+	}
+
+	if out := reconcileDB(first); out.Status.Phase != "Provisioning" || provisioned["db-first"] != 1 {
+		t.Fatalf("expected db-first to be provisioned, got phase=%s calls=%d", out.Status.Phase, provisioned["db-first"])
+	}
+	if out := reconcileDB(second); out.Status.Phase != "Failed" || provisioned["db-second"] != 0 {
+		t.Fatalf("expected db-second to stay rejected, got phase=%s calls=%d", out.Status.Phase, provisioned["db-second"])
+	}
+
+	// Raising the quota retries the rejected database and admits it
+	maxDatabases = 2
+	if err := cl.Update(context.Background(), team); err != nil {
+		t.Fatalf("failed to raise quota: %v", err)
+	}
+	if requests := r.suspendedOrQuotaRejectedDatabases(context.Background(), team); len(requests) != 1 || requests[0].Name != "db-second" {
+		t.Fatalf("expected the team change to retry db-second, got %v", requests)
+	}
+	out = reconcileDB(second)
+	if out.Status.Phase != "Provisioning" || provisioned["db-second"] != 1 {
+		t.Fatalf("expected db-second to be provisioned once the quota allows, got phase=%s calls=%d", out.Status.Phase, provisioned["db-second"])
+	}
+	if meta.FindStatusCondition(out.Status.Conditions, "Ready") != nil {
+		t.Fatalf("expected the QuotaExceeded condition to be cleared")
+	}
+}
+
+func TestDatabaseReconciler_ProvisionsWhenBrokerBecomesReady(t *testing.T) {
+	provisioned := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provisioned++
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	broker := brokerFor(srv.URL, 0, 10)
+	broker.Status.Phase = "Pending"
+	db := provisionableDatabase("db-waiting")
+	ready := provisionableDatabase("db-ready")
+	ready.Status.Phase = "Ready"
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, broker, db, ready).WithStatusSubresource(broker).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	ctx := context.Background()
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	// With no Ready broker the database waits rather than failing
+	if _, err := r.Reconcile(ctx, req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Pending" || !isWaitingFor(out, WaitingReasonNoBrokerAvailable) || provisioned != 0 {
+		t.Fatalf("expected db to wait for a broker, got phase=%s conditions=%+v", out.Status.Phase, out.Status.Conditions)
+	}
+
+	// The broker becoming Ready wakes only the waiting database
+	oldBroker := broker.DeepCopy()
+	broker.Status.Phase = "Ready"
+	if err := cl.Status().Update(ctx, broker); err != nil {
+		t.Fatalf("failed to mark broker Ready: %v", err)
+	}
+	if !brokerBecameReady.Update(event.UpdateEvent{ObjectOld: oldBroker, ObjectNew: broker}) {
+		t.Fatalf("expected the move to Ready to trigger reconciles")
+	}
+	if brokerBecameReady.Update(event.UpdateEvent{ObjectOld: broker, ObjectNew: broker}) {
+		t.Fatalf("expected updates to an already Ready broker not to trigger reconciles")
+	}
+	requests := r.databasesAwaitingBroker(ctx, broker)
+	if len(requests) != 1 || requests[0] != req {
+		t.Fatalf("expected the broker to enqueue only %v, got %v", req, requests)
+	}
+
+	if _, err := r.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(ctx, req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Provisioning" || provisioned != 1 {
+		t.Fatalf("expected db to provision once the broker is Ready, got phase=%s calls=%d", out.Status.Phase, provisioned)
+	}
+	if meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting) != nil {
+		t.Fatalf("expected the Waiting condition to be cleared")
+	}
+}
+
+func TestDatabaseReconciler_AdminCredentialsSecret(t *testing.T) {
+	var received []brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req brokerclient.ProvisionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received = append(received, req)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db1")
+	db.Spec.AdminCredentialsSecretRef = &platformv1.LocalSecretReference{Name: "db1-admin"}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).
+		WithStatusSubresource(&platformv1.Database{}).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, APIReader: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+	reconcileDB := func() (reconcile.Result, *platformv1.Database) {
+		t.Helper()
+		res, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+		out := &platformv1.Database{}
+		if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+			t.Fatalf("failed to get database: %v", err)
+		}
+		return res, out
+	}
+	expectWaiting := func(out *platformv1.Database, res reconcile.Result, message string) {
+		t.Helper()
+		if out.Status.Phase != "Pending" || res.RequeueAfter == 0 || len(received) != 0 {
+			t.Fatalf("expected to wait without calling the broker, got phase=%s requeueAfter=%s calls=%d", out.Status.Phase, res.RequeueAfter, len(received))
+		}
+		cond := meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting)
+		if cond == nil || cond.Reason != WaitingReasonAdminCredentialsInvalid || !strings.Contains(cond.Message, message) {
+			t.Fatalf("expected an AdminCredentialsInvalid waiting condition mentioning %q, got %+v", message, cond)
+		}
+	}
+
+	// Missing secret
+	res, out := reconcileDB()
+	expectWaiting(out, res, "not found")
+	gotEvent := false
+	for len(recorder.Events) > 0 {
+		if strings.HasPrefix(<-recorder.Events, "Warning AdminCredentialsInvalid") {
+			gotEvent = true
+		}
+	}
+	if !gotEvent {
+		t.Fatalf("expected an AdminCredentialsInvalid warning event")
+	}
+
+	// Secret without a password
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1-admin"},
+		Data:       map[string][]byte{"username": []byte("owner")},
+	}
+	if err := cl.Create(context.Background(), secret); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	res, out = reconcileDB()
+	expectWaiting(out, res, "missing password")
+
+	// Complete secret: provisioned with the reference passed to the broker
+	secret.Data["password"] = []byte("s3cret")
+	if err := cl.Update(context.Background(), secret); err != nil {
+		t.Fatalf("failed to update secret: %v", err)
+	}
+	_, out = reconcileDB()
+	if out.Status.Phase != "Provisioning" || len(received) != 1 {
+		t.Fatalf("expected the database to be provisioned, got phase=%s calls=%d", out.Status.Phase, len(received))
+	}
+	if meta.FindStatusCondition(out.Status.Conditions, ConditionWaiting) != nil {
+		t.Fatalf("expected the waiting condition to be cleared")
+	}
+	ref, _ := received[0].Spec["adminCredentialsSecretRef"].(map[string]interface{})
+	if ref["name"] != "db1-admin" {
+		t.Fatalf("expected the secret reference in the provision request, got %v", received[0].Spec)
+	}
+}
+
+func TestDatabaseReconciler_ChecksConnectionSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	complete := map[string][]byte{
+		"host": []byte("db1.internal"), "port": []byte("5432"), "username": []byte("app"),
+		"password": []byte("s3cret"), "database": []byte("db1"),
+	}
+
+	tests := []struct {
+		name       string
+		engine     string
+		data       map[string][]byte
+		noSecret   bool
+		wantStatus metav1.ConditionStatus
+		wantReason string
+		wantText   string
+	}{
+		{
+			name:       "conforming postgresql secret",
+			engine:     "postgresql",
+			data:       complete,
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonConnectionSecretConforms,
+		},
+		{
+			name:       "conforming redis secret",
+			engine:     "redis",
+			data:       map[string][]byte{"host": []byte("cache"), "port": []byte("6379"), "password": []byte("s3cret")},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonConnectionSecretConforms,
+		},
+		{
+			name:       "missing and empty keys",
+			engine:     "postgresql",
+			data:       map[string][]byte{"host": []byte("db1.internal"), "port": []byte("5432"), "username": []byte("app"), "password": {}},
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonConnectionSecretNonConformant,
+			wantText:   "missing password, database",
+		},
+		{
+			name:       "secret not created",
+			engine:     "mysql",
+			noSecret:   true,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonConnectionSecretNotFound,
+			wantText:   "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := provisionableDatabase("db1")
+			db.Spec.Engine = tt.engine
+			db.Status.DeploymentID = "deploy-1"
+			db.Status.Phase = "Ready"
+			db.Status.ConnectionSecretRef = &platformv1.SecretReference{Name: "db1-connection", Namespace: "dev"}
+			objs := []client.Object{&platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}, db}
+			if !tt.noSecret {
+				objs = append(objs, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1-connection"},
+					Data:       tt.data,
+				})
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(db).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &DatabaseReconciler{Client: cl, APIReader: cl, Scheme: scheme, Recorder: recorder}
+
+			res, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+			if err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+				t.Fatalf("failed to get database: %v", err)
+			}
+			cond := meta.FindStatusCondition(out.Status.Conditions, ConditionConnectionSecretValid)
+			if cond == nil || cond.Status != tt.wantStatus || cond.Reason != tt.wantReason || !strings.Contains(cond.Message, tt.wantText) {
+				t.Fatalf("expected %s %s condition mentioning %q, got %+v", tt.wantStatus, tt.wantReason, tt.wantText, cond)
+			}
+
+			if tt.wantStatus == metav1.ConditionTrue {
+				if res.RequeueAfter != 0 || len(recorder.Events) != 0 {
+					t.Fatalf("expected no requeue or events for a conforming secret, got %+v and %d event(s)", res, len(recorder.Events))
+				}
+				return
+			}
+			if res.RequeueAfter != defaultWaitRequeue {
+				t.Fatalf("expected a requeue after %v, got %+v", defaultWaitRequeue, res)
+			}
+			if event := <-recorder.Events; !strings.HasPrefix(event, "Warning "+tt.wantReason) {
+				t.Fatalf("expected a %s warning event, got %q", tt.wantReason, event)
+			}
+
+			// The warning isn't repeated while the secret stays non-conforming
+			if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			if len(recorder.Events) != 0 {
+				t.Fatalf("expected a single warning event, got another: %q", <-recorder.Events)
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_PassesInitScripts(t *testing.T) {
+	var received []brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req brokerclient.ProvisionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received = append(received, req)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db1")
+	db.Spec.InitScripts = []platformv1.InitScript{
+		{Name: "schema", Inline: "CREATE TABLE orders (id bigint PRIMARY KEY);"},
+		{Name: "seed", ConfigMapKeyRef: &platformv1.KeyReference{Name: "orders-seed", Key: "seed.sql"}},
+		{Name: "grants", SecretKeyRef: &platformv1.KeyReference{Name: "orders-grants", Key: "grants.sql"}},
+	}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).
+		WithStatusSubresource(&platformv1.Database{}).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("expected one provision request, got %d", len(received))
+	}
+
+	// Scripts keep their order; referenced scripts are passed by reference
+	want := []interface{}{
+		map[string]interface{}{"name": "schema", "inline": "CREATE TABLE orders (id bigint PRIMARY KEY);"},
+		map[string]interface{}{"name": "seed", "configMapKeyRef": map[string]interface{}{"name": "orders-seed", "key": "seed.sql"}},
+		map[string]interface{}{"name": "grants", "secretKeyRef": map[string]interface{}{"name": "orders-grants", "key": "grants.sql"}},
+	}
+	if got := received[0].Spec["initScripts"]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected init scripts %v in the provision request, got %v", want, got)
+	}
+}
+
+func TestDatabaseReconciler_FailsOverToReachableBroker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-backup", Status: "accepted"})
+	}))
+	defer srv.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	// The preferred broker is down; the lower-scored one is healthy
+	preferred := brokerFor(down.URL, 0, 10)
+	preferred.Name = "preferred"
+	preferred.Spec.Priority = 200
+	backup := brokerFor(srv.URL, 0, 10)
+	backup.Name = "backup"
+
+	db := provisionableDatabase("db-failover")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, preferred, backup, db).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.DeploymentID != "deploy-backup" {
+		t.Fatalf("expected deployment on the backup broker, got %q", out.Status.DeploymentID)
+	}
+	if out.Status.BrokerRef == nil || out.Status.BrokerRef.Name != "backup" {
+		t.Fatalf("expected brokerRef to point at backup, got %+v", out.Status.BrokerRef)
+	}
+
+	failedOver := false
+	for len(recorder.Events) > 0 {
+		if strings.Contains(<-recorder.Events, "BrokerFailover") {
+			failedOver = true
+		}
+	}
+	if !failedOver {
+		t.Fatalf("expected a BrokerFailover event")
+	}
+}
+
+func TestDatabaseReconciler_TenantPlacementPolicy(t *testing.T) {
+	var called []string
+	brokerServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			called = append(called, name)
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-" + name, Status: "accepted"})
+		}))
+	}
+	euSrv := brokerServer("eu")
+	defer euSrv.Close()
+	usSrv := brokerServer("us")
+	defer usSrv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tests := []struct {
+		name       string
+		withEU     bool
+		wantBroker string
+	}{
+		{name: "restricted to the EU broker", withEU: true, wantBroker: "eu"},
+		{name: "no broker in an allowed region"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = nil
+			// The US broker scores higher but is outside the tenant's regions
+			us := brokerFor(usSrv.URL, 0, 10)
+			us.Name = "us"
+			us.Spec.Region = "eastus"
+			us.Spec.Priority = 200
+			objs := []client.Object{us}
+			if tt.withEU {
+				eu := brokerFor(euSrv.URL, 0, 10)
+				eu.Name = "eu"
+				eu.Spec.Region = "westeurope"
+				objs = append(objs, eu)
+			}
+
+			tenant := &platformv1.Tenant{
+				ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+				Spec:       platformv1.TenantSpec{Placement: &platformv1.PlacementPolicy{Regions: []string{"westeurope", "northeurope"}}},
+			}
+			db := provisionableDatabase("db-eu")
+			objs = append(objs, tenant, db)
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(db).Build()
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(20), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+
+			if tt.wantBroker == "" {
+				if len(called) != 0 || !isWaitingFor(out, WaitingReasonNoBrokerAvailable) {
+					t.Fatalf("expected to wait for a broker in an allowed region, got calls=%v conditions=%+v", called, out.Status.Conditions)
+				}
+				return
+			}
+			if len(called) != 1 || called[0] != tt.wantBroker || out.Status.BrokerRef == nil || out.Status.BrokerRef.Name != tt.wantBroker {
+				t.Fatalf("expected provisioning on %s only, got calls=%v brokerRef=%+v", tt.wantBroker, called, out.Status.BrokerRef)
+			}
+			if out.Status.Region != "westeurope" {
+				t.Fatalf("expected the broker's region to be recorded, got %q", out.Status.Region)
+			}
+		})
+	}
+}
+
+// hasEvent drains the recorder, reporting whether any event had reason
+func hasEvent(recorder *record.FakeRecorder, reason string) bool {
+	found := false
+	for len(recorder.Events) > 0 {
+		if strings.Contains(<-recorder.Events, reason) {
+			found = true
+		}
+	}
+	return found
+}
+
+func TestDatabaseReconciler_EnforcesAllowedRegions(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without a regions listing the region is left to the broker
+		if r.Method == http.MethodGet {
+			http.NotFound(w, r)
+			return
+		}
+		calls++
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-us", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	b := brokerFor(srv.URL, 0, 10)
+	b.Spec.Region = "eastus"
+	tenant := &platformv1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+		Spec:       platformv1.TenantSpec{Placement: &platformv1.PlacementPolicy{Regions: []string{"westeurope"}}},
+	}
+	db := provisionableDatabase("db-us")
+	db.Spec.Region = "eastus"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(b, tenant, db).WithStatusSubresource(db, tenant).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if calls != 0 || out.Status.Phase != "Failed" || !isRegionRejected(out) {
+		t.Fatalf("expected rejection before broker selection, got calls=%d phase=%s conditions=%+v", calls, out.Status.Phase, out.Status.Conditions)
+	}
+	if !hasEvent(recorder, ReasonRegionNotAllowed) {
+		t.Fatal("expected a RegionNotAllowed event")
+	}
+
+	// Allowing the region admits the database
+	tenant.Spec.Placement.Regions = append(tenant.Spec.Placement.Regions, "eastus")
+	if err := cl.Update(context.Background(), tenant); err != nil {
+		t.Fatalf("failed to update tenant: %v", err)
+	}
+	if reqs := r.databasesUnderPlacement(context.Background(), tenant); len(reqs) != 1 {
+		t.Fatalf("expected the rejected database to be retried, got %v", reqs)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if calls != 1 || out.Status.DeploymentID != "deploy-us" || isRegionRejected(out) {
+		t.Fatalf("expected the database to be provisioned, got calls=%d status=%+v", calls, out.Status)
+	}
+}
+
+func TestDatabaseReconciler_DetectsResidencyViolation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tenant := &platformv1.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+		Spec:       platformv1.TenantSpec{Placement: &platformv1.PlacementPolicy{Regions: []string{"westeurope"}}},
+	}
+	db := provisionableDatabase("db-moved")
+	db.Labels = map[string]string{"platform.company.com/tenant": "acme"}
+	db.Status.Phase = "Ready"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.Region = "eastus"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, db).WithStatusSubresource(db).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, ResidencyCheckInterval: time.Minute}
+
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Fatalf("expected the region to be rechecked after a minute, got %+v", result)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	cond := meta.FindStatusCondition(out.Status.Conditions, ConditionResidencyViolation)
+	if cond == nil || cond.Status != metav1.ConditionTrue || cond.Reason != ReasonOutsideAllowedRegions {
+		t.Fatalf("expected a ResidencyViolation, got %+v", out.Status.Conditions)
+	}
+	if out.Status.Phase != "Ready" {
+		t.Fatalf("expected the database to stay Ready, got %s", out.Status.Phase)
+	}
+	if !hasEvent(recorder, ReasonOutsideAllowedRegions) {
+		t.Fatal("expected a residency violation event")
+	}
+
+	// Once the database is back in an allowed region the violation clears
+	out.Status.Region = "westeurope"
+	if err := cl.Status().Update(context.Background(), out); err != nil {
+		t.Fatalf("failed to update db: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	cond = meta.FindStatusCondition(out.Status.Conditions, ConditionResidencyViolation)
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonWithinAllowedRegions {
+		t.Fatalf("expected the violation to clear, got %+v", out.Status.Conditions)
+	}
+
+	// Without a regions policy the database isn't rechecked
+	tenant.Spec.Placement = nil
+	if err := cl.Update(context.Background(), tenant); err != nil {
+		t.Fatalf("failed to update tenant: %v", err)
+	}
+	result, err = r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if result.RequeueAfter != 0 || meta.FindStatusCondition(out.Status.Conditions, ConditionResidencyViolation) != nil {
+		t.Fatalf("expected no residency check without a policy, got result=%+v conditions=%+v", result, out.Status.Conditions)
+	}
+}
+
+func TestDatabaseReconciler_DoesNotFailOverOnBrokerRejection(t *testing.T) {
+	var backupCalls int
+	backupSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupCalls++
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-backup", Status: "accepted"})
+	}))
+	defer backupSrv.Close()
+	invalid := brokerReturning(http.StatusBadRequest, "validation_failed", "")
+	defer invalid.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	preferred := brokerFor(invalid.URL, 0, 10)
+	preferred.Name = "preferred"
+	preferred.Spec.Priority = 200
+	backup := brokerFor(backupSrv.URL, 0, 10)
+	backup.Name = "backup"
+
+	db := provisionableDatabase("db-rejected")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, preferred, backup, db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(20), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err == nil {
+		t.Fatalf("expected the broker's rejection to be returned")
+	}
+	if backupCalls != 0 {
+		t.Fatalf("expected no failover when the broker answered, got %d call(s) to backup", backupCalls)
+	}
+}
+
+// countingBroker returns a broker server that accepts every request and
+// counts the calls it receives
+func countingBroker(calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "accepted", "deploymentId": "deploy-1"})
+	}))
+}
+
+func TestDatabaseReconciler_RecordsBrokerNamespace(t *testing.T) {
+	var calls int
+	srv := countingBroker(&calls)
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-ref")
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	want := platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	if out.Status.BrokerRef == nil || *out.Status.BrokerRef != want {
+		t.Fatalf("expected brokerRef %+v, got %+v", want, out.Status.BrokerRef)
+	}
+}
+
+func TestDatabaseReconciler_CleanupCrossNamespaceBrokerRef(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	var recordedCalls, decoyCalls int
+	recordedSrv := countingBroker(&recordedCalls)
+	defer recordedSrv.Close()
+	decoySrv := countingBroker(&decoyCalls)
+	defer decoySrv.Close()
+
+	// The broker that provisioned the database lives in kidp-system; a
+	// broker of the same name in the database's namespace must not be used
+	recorded := brokerFor(recordedSrv.URL, 0, 10)
+	decoy := brokerFor(decoySrv.URL, 0, 10)
+	decoy.Namespace = "dev"
+
+	tests := []struct {
+		name         string
+		ref          platformv1.ObjectReference
+		objects      []client.Object
+		wantErr      bool
+		wantRecorded int
+	}{
+		{
+			name:         "recorded namespace",
+			ref:          platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy(), decoy.DeepCopy()},
+			wantRecorded: 1,
+		},
+		{
+			name:    "recorded broker gone",
+			ref:     platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects: []client.Object{decoy.DeepCopy()},
+			wantErr: true,
+		},
+		{
+			name:         "legacy ref without namespace",
+			ref:          platformv1.ObjectReference{Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy()},
+			wantRecorded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordedCalls, decoyCalls = 0, 0
+			db := provisionableDatabase("db-cleanup")
+			db.Status.DeploymentID = "deploy-1"
+			ref := tt.ref
+			db.Status.BrokerRef = &ref
+
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(tt.objects, db)...).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			err := r.cleanupDatabase(context.Background(), db)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "kidp-system/broker-a") {
+					t.Fatalf("expected an error naming the recorded broker, got %v", err)
+				}
+				if len(recorder.Events) == 0 || !strings.Contains(<-recorder.Events, "BrokerNotFound") {
+					t.Fatalf("expected a BrokerNotFound event")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recordedCalls != tt.wantRecorded {
+				t.Fatalf("expected %d call(s) to the recorded broker, got %d", tt.wantRecorded, recordedCalls)
+			}
+			if decoyCalls != 0 {
+				t.Fatalf("expected no calls to another broker, got %d", decoyCalls)
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_RetriesTransientBrokerErrors(t *testing.T) {
+	failing := brokerReturning(http.StatusInternalServerError, "internal_error", "")
+	defer failing.Close()
+	invalid := brokerReturning(http.StatusBadRequest, "validation_failed", "")
+	defer invalid.Close()
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable.Close()
+
+	tests := []struct {
+		name      string
+		endpoint  string
+		wantPhase string
+		terminal  bool
+	}{
+		{name: "server error", endpoint: failing.URL, wantPhase: "Provisioning"},
+		{name: "unreachable", endpoint: unreachable.URL, wantPhase: "Provisioning"},
+		{name: "rejected as invalid", endpoint: invalid.URL, wantPhase: "Failed", terminal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = platformv1.AddToScheme(scheme)
+			_ = corev1.AddToScheme(scheme)
+
+			db := provisionableDatabase("db-retry")
+			tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(tt.endpoint, 0, 10), db).
+				WithStatusSubresource(db).Build()
+			recorder := record.NewFakeRecorder(20)
+			r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)})
+			if err == nil {
+				t.Fatalf("expected the broker failure to be returned")
+			}
+			if terminal := errors.Is(err, reconcile.TerminalError(nil)); terminal != tt.terminal {
+				t.Fatalf("expected terminal=%t, got %v", tt.terminal, err)
+			}
+
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			if out.Status.Phase != tt.wantPhase {
+				t.Fatalf("expected phase %s, got %s", tt.wantPhase, out.Status.Phase)
+			}
+			if tt.terminal {
+				// The broker's message is surfaced on the Ready condition
+				cond := meta.FindStatusCondition(out.Status.Conditions, "Ready")
+				if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != ReasonProvisioningFailed || cond.Message != "validation_failed" {
+					t.Fatalf("expected Ready=False with the broker's message, got %+v", cond)
+				}
+			}
+
+			retrying := false
+			for len(recorder.Events) > 0 {
+				if strings.Contains(<-recorder.Events, "ProvisioningRetrying") {
+					retrying = true
+				}
+			}
+			if retrying == tt.terminal {
+				t.Fatalf("expected a ProvisioningRetrying event only for transient failures, got %t", retrying)
+			}
+		})
+	}
+}
+
+func TestDatabaseReconciler_TakesRequestedSnapshots(t *testing.T) {
+	var requested []brokerclient.SnapshotRequest
+	status := brokerclient.SnapshotStatusPending
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/snapshots":
+			var req brokerclient.SnapshotRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			requested = append(requested, req)
+			if req.Name == "bad name" {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": "validation_failed", "message": "invalid snapshot name"})
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(brokerclient.SnapshotResponse{SnapshotID: "snap-1", Name: req.Name, Status: brokerclient.SnapshotStatusPending})
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/snapshots/snap-1":
+			_ = json.NewEncoder(w).Encode(brokerclient.SnapshotResponse{SnapshotID: "snap-1", Status: status})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-snapshot")
+	db.Annotations = map[string]string{AnnotationSnapshot: "release-1.4"}
+	db.Status.Phase = "Ready"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	recorder := record.NewFakeRecorder(20)
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+	get := func() *platformv1.Database {
+		out := &platformv1.Database{}
+		if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	// The annotation triggers a snapshot, polled while pending
+	res, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if res.RequeueAfter != snapshotPollInterval {
+		t.Fatalf("expected to poll the pending snapshot, got requeue %v", res.RequeueAfter)
+	}
+	if len(requested) != 1 || requested[0].Name != "release-1.4" || requested[0].DeploymentID != "deploy-1" || requested[0].Engine != "postgresql" {
+		t.Fatalf("expected one snapshot request for deploy-1, got %+v", requested)
+	}
+	snapshot := get().Status.Snapshot("release-1.4")
+	if snapshot == nil || snapshot.ID != "snap-1" || snapshot.Phase != platformv1.SnapshotPhasePending || snapshot.CompletedAt != nil {
+		t.Fatalf("expected a pending snapshot snap-1, got %+v", snapshot)
+	}
+
+	// Still pending: polled again without a second request
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(requested) != 1 {
+		t.Fatalf("expected the snapshot not to be requested again, got %d requests", len(requested))
+	}
+
+	status = brokerclient.SnapshotStatusCompleted
+	res, err = r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if res.RequeueAfter != 0 {
+		t.Fatalf("expected no polling once the snapshot completed, got %v", res.RequeueAfter)
+	}
+	snapshot = get().Status.Snapshot("release-1.4")
+	if snapshot.Phase != platformv1.SnapshotPhaseCompleted || snapshot.CompletedAt == nil {
+		t.Fatalf("expected the snapshot to be completed, got %+v", snapshot)
+	}
+
+	// A snapshot the broker rejects is failed rather than retried
+	current := get()
+	current.Annotations[AnnotationSnapshot] = "bad name"
+	if err := cl.Update(context.Background(), current); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(requested) != 2 {
+		t.Fatalf("expected the rejected snapshot to be requested once, got %d requests", len(requested))
+	}
+	out := get()
+	failed := out.Status.Snapshot("bad name")
+	if failed == nil || failed.Phase != platformv1.SnapshotPhaseFailed || !strings.Contains(failed.Message, "invalid snapshot name") {
+		t.Fatalf("expected a failed snapshot, got %+v", failed)
+	}
+	if len(out.Status.Snapshots) != 2 || out.Status.Phase != "Ready" {
+		t.Fatalf("expected both snapshots recorded on the Ready database, got %+v in %s", out.Status.Snapshots, out.Status.Phase)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	for _, want := range []string{"SnapshotRequested", "SnapshotCompleted", "SnapshotFailed"} {
+		if !strings.Contains(strings.Join(events, "\n"), want) {
+			t.Errorf("expected a %s event, got %v", want, events)
+		}
+	}
+}
+
+func TestDatabaseReconciler_AppliesDatabaseClass(t *testing.T) {
+	var received []brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req brokerclient.ProvisionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		received = append(received, req)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	class := &platformv1.DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-standard"},
+		Spec: platformv1.DatabaseClassSpec{
+			Engine:  "postgresql",
+			Version: "15",
+			Size:    "medium",
+			Tier:    platformv1.TierProd,
+			Backup:  &platformv1.BackupConfig{Enabled: true, Retention: "14d"},
+		},
+	}
+	// One database takes everything from the class, the other overrides
+	// its size and backups and turns off the high availability its tier implies
+	defaulted := provisionableDatabase("db-defaulted")
+	defaulted.Spec = platformv1.DatabaseSpec{
+		Owner:    defaulted.Spec.Owner,
+		ClassRef: &platformv1.DatabaseClassReference{Name: "postgres-standard"},
+	}
+	noHA := false
+	overridden := provisionableDatabase("db-overridden")
+	overridden.Spec = platformv1.DatabaseSpec{
+		Owner:            overridden.Spec.Owner,
+		ClassRef:         &platformv1.DatabaseClassReference{Name: "postgres-standard"},
+		Size:             "large",
+		Backup:           &platformv1.BackupConfig{Enabled: true, Retention: "90d"},
+		HighAvailability: &noHA,
+	}
+	missing := provisionableDatabase("db-missing-class")
+	missing.Spec.ClassRef = &platformv1.DatabaseClassReference{Name: "postgres-premium"}
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), class, defaulted, overridden, missing).
+		WithStatusSubresource(&platformv1.Database{}).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	for _, db := range []*platformv1.Database{defaulted, overridden} {
+		if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}); err != nil {
+			t.Fatalf("reconcile of %s returned error: %v", db.Name, err)
+		}
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected two provision requests, got %d", len(received))
+	}
+
+	for _, tc := range []struct {
+		name string
+		spec map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"class defaults", received[0].Spec, map[string]interface{}{
+			"engine": "postgresql", "version": "15", "size": "medium", "highAvailability": true,
+			"backup": map[string]interface{}{"enabled": true, "retention": "14d"},
+		}},
+		{"overridden", received[1].Spec, map[string]interface{}{
+			"engine": "postgresql", "version": "15", "size": "large", "highAvailability": false,
+			"backup": map[string]interface{}{"enabled": true, "retention": "90d"},
+		}},
+	} {
+		if !reflect.DeepEqual(tc.spec, tc.want) {
+			t.Errorf("%s: expected provision spec %v, got %v", tc.name, tc.want, tc.spec)
+		}
+	}
+	if received[0].Priority != brokerclient.PriorityHigh {
+		t.Errorf("expected the class's prod tier to set the priority, got %d", received[0].Priority)
+	}
+
+	// The class is merged in memory only; the stored spec is what was written
+	var stored platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(defaulted), &stored); err != nil {
+		t.Fatalf("failed to get database: %v", err)
+	}
+	if stored.Spec.Engine != "" || stored.Spec.Backup != nil || stored.Spec.Tier != "" {
+		t.Fatalf("expected the stored spec to be left alone, got %+v", stored.Spec)
+	}
+
+	// A database whose class doesn't exist waits for it
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(missing)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(missing), &stored); err != nil {
+		t.Fatalf("failed to get database: %v", err)
+	}
+	if stored.Status.Phase != "Pending" || !isWaitingFor(&stored, WaitingReasonDatabaseClassNotFound) || len(received) != 2 {
+		t.Fatalf("expected the database to wait for its class, got phase %q and %d provision requests", stored.Status.Phase, len(received))
+	}
+	if requests := r.databasesForClass(context.Background(), &platformv1.DatabaseClass{ObjectMeta: metav1.ObjectMeta{Name: "postgres-premium"}}); len(requests) != 1 || requests[0].Name != missing.Name {
+		t.Fatalf("expected creating the class to wake the waiting database, got %v", requests)
+	}
+}
+
+func TestDatabaseReconciler_PushesMovedCallbackURL(t *testing.T) {
+	var sent []map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/v1/callback-url" {
+			http.NotFound(w, r)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		sent = append(sent, body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	t.Setenv("KIDP_CALLBACK_URL", "http://new-manager:9090/v1/callback")
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := provisionableDatabase("db-callback-url")
+	db.Status.Phase = "Provisioning"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.BrokerRef = &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"}
+	db.Status.CallbackURL = "http://old-manager/v1/callback"
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, brokerFor(srv.URL, 0, 10), db).WithStatusSubresource(db).Build()
+	r := &DatabaseReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(db)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected one callback URL update, got %d", len(sent))
+	}
+	if sent[0]["deploymentId"] != "deploy-1" || sent[0]["callbackUrl"] != "http://new-manager:9090/v1/callback" {
+		t.Fatalf("unexpected callback URL update %v", sent[0])
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.CallbackURL != "http://new-manager:9090/v1/callback" {
+		t.Fatalf("expected the new callback URL in status, got %q", out.Status.CallbackURL)
+	}
+
+	// The broker already has the current URL: nothing to resend
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if len(sent) != 1 {
+		t.Fatalf("expected no further callback URL updates, got %d", len(sent))
+	}
+}
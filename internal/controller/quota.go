@@ -0,0 +1,88 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ReasonQuotaExceeded marks a Database rejected because its team is at its
+// MaxDatabases quota
+const ReasonQuotaExceeded = "QuotaExceeded"
+
+// checkTeamQuota returns a message explaining why the database would exceed
+// its owning team's MaxDatabases quota, or "" if it fits. Databases already
+// provisioned hold a slot, and so do older ones still waiting to provision,
+// so the oldest databases win however their reconciles interleave.
+func (r *DatabaseReconciler) checkTeamQuota(ctx context.Context, database *platformv1.Database) (string, error) {
+	team, err := owningTeam(ctx, r.Client, database)
+	if err != nil || team == nil {
+		// No team, no team quota; an unresolvable owner is reported elsewhere
+		return "", nil
+	}
+	if team.Spec.Quotas == nil || team.Spec.Quotas.MaxDatabases == nil {
+		return "", nil
+	}
+	limit := int(*team.Spec.Quotas.MaxDatabases)
+
+	owned, err := databasesOwnedByTeam(ctx, clusterListReader(r.ClusterReader, r.Client), team)
+	if err != nil {
+		return "", err
+	}
+	used := 0
+	for i := range owned {
+		if holdsQuotaSlotBefore(&owned[i], database) {
+			used++
+		}
+	}
+	if used < limit {
+		return "", nil
+	}
+	return fmt.Sprintf("Team %s is at its quota of %d database(s)", team.Name, limit), nil
+}
+
+// holdsQuotaSlotBefore reports whether other counts against the team quota
+// ahead of database
+func holdsQuotaSlotBefore(other, database *platformv1.Database) bool {
+	if other.Namespace == database.Namespace && other.Name == database.Name {
+		return false
+	}
+	if !other.DeletionTimestamp.IsZero() {
+		return false
+	}
+	if other.Status.DeploymentID != "" {
+		return true
+	}
+	if other.Status.Phase == "Failed" {
+		return false
+	}
+	if !other.CreationTimestamp.Equal(&database.CreationTimestamp) {
+		return other.CreationTimestamp.Before(&database.CreationTimestamp)
+	}
+	return other.Namespace+"/"+other.Name < database.Namespace+"/"+database.Name
+}
+
+// isQuotaRejected reports whether the database was rejected by its team's quota
+func isQuotaRejected(database *platformv1.Database) bool {
+	cond := meta.FindStatusCondition(database.Status.Conditions, "Ready")
+	return cond != nil && cond.Reason == ReasonQuotaExceeded
+}
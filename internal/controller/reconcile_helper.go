@@ -0,0 +1,93 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ReconcileHelper holds the finalizer and status handling every platform
+// reconciler shares, so each one only implements what is specific to its kind
+type ReconcileHelper struct {
+	Client client.Client
+
+	// Kind names the reconciled resource in log messages
+	Kind string
+
+	// Finalizer is the finalizer that holds the resource until its cleanup
+	// has run
+	Finalizer string
+}
+
+// EnsureFinalizer adds the finalizer to obj if it is missing. It reports
+// whether obj was updated, in which case the caller should requeue and
+// continue once the update is observed.
+func (h ReconcileHelper) EnsureFinalizer(ctx context.Context, obj client.Object) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if controllerutil.ContainsFinalizer(obj, h.Finalizer) {
+		return false, nil
+	}
+	log.Info("Adding finalizer to "+h.Kind, "name", obj.GetName(), "namespace", obj.GetNamespace())
+	controllerutil.AddFinalizer(obj, h.Finalizer)
+	if err := h.Client.Update(ctx, obj); err != nil {
+		log.Error(err, "Failed to add finalizer")
+		return false, err
+	}
+	return true, nil
+}
+
+// HandleDeletion runs cleanup for an object being deleted and then removes
+// its finalizer. If cleanup fails the finalizer is kept and the error is
+// returned so the deletion is retried; cleanup records any status explaining
+// why. Objects without the finalizer are left alone.
+func (h ReconcileHelper) HandleDeletion(ctx context.Context, obj client.Object, cleanup func(context.Context) error) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if !controllerutil.ContainsFinalizer(obj, h.Finalizer) {
+		// Finalizer already removed, nothing to do
+		return ctrl.Result{}, nil
+	}
+
+	log.Info("Handling "+h.Kind+" deletion", "name", obj.GetName(), "namespace", obj.GetNamespace())
+
+	if cleanup != nil {
+		if err := cleanup(ctx); err != nil {
+			log.Error(err, "Failed to clean up "+h.Kind+", will retry")
+			return ctrl.Result{}, err
+		}
+	}
+
+	log.Info(h.Kind+" cleanup completed, removing finalizer", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	controllerutil.RemoveFinalizer(obj, h.Finalizer)
+	if err := h.Client.Update(ctx, obj); err != nil {
+		log.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// UpdateStatus writes obj's status if it changed, falling back to a full
+// update for clients without the status subresource
+func (h ReconcileHelper) UpdateStatus(ctx context.Context, obj client.Object) error {
+	return UpdateStatusIfChanged(ctx, h.Client, obj, log.FromContext(ctx))
+}
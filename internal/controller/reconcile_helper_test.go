@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+const testFinalizer = "platform.company.com/test-cleanup"
+
+func TestReconcileHelper_EnsureFinalizer(t *testing.T) {
+	app := &platformv1.Application{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "app1"}}
+	cl, writes := countingClient(t, app)
+	h := ReconcileHelper{Client: cl, Kind: "Application", Finalizer: testFinalizer}
+	ctx := context.Background()
+
+	for i, wantAdded := range []bool{true, false} {
+		current := &platformv1.Application{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(app), current); err != nil {
+			t.Fatal(err)
+		}
+		added, err := h.EnsureFinalizer(ctx, current)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if added != wantAdded {
+			t.Fatalf("call %d: expected added=%t, got %t", i+1, wantAdded, added)
+		}
+	}
+	if *writes != 1 {
+		t.Fatalf("expected the finalizer to be written once, got %d writes", *writes)
+	}
+
+	current := &platformv1.Application{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(app), current)
+	if !controllerutil.ContainsFinalizer(current, testFinalizer) {
+		t.Fatalf("expected the finalizer to be persisted, got %v", current.Finalizers)
+	}
+}
+
+func TestReconcileHelper_HandleDeletion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	now := metav1.Now()
+	app := &platformv1.Application{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "dev", Name: "app1", DeletionTimestamp: &now, Finalizers: []string{testFinalizer},
+	}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(app).WithStatusSubresource(app).Build()
+	h := ReconcileHelper{Client: cl, Kind: "Application", Finalizer: testFinalizer}
+	ctx := context.Background()
+	key := client.ObjectKeyFromObject(app)
+
+	// A failed cleanup keeps the finalizer and surfaces the error for a retry
+	blocked := errors.New("still owns resources")
+	current := &platformv1.Application{}
+	if err := cl.Get(ctx, key, current); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.HandleDeletion(ctx, current, func(ctx context.Context) error {
+		current.Status.Phase = "Deleting"
+		if err := h.UpdateStatus(ctx, current); err != nil {
+			t.Fatal(err)
+		}
+		return blocked
+	}); !errors.Is(err, blocked) {
+		t.Fatalf("expected the cleanup error, got %v", err)
+	}
+	if err := cl.Get(ctx, key, current); err != nil {
+		t.Fatalf("expected the application to be held by its finalizer: %v", err)
+	}
+	if current.Status.Phase != "Deleting" {
+		t.Fatalf("expected the status cleanup recorded, got phase %q", current.Status.Phase)
+	}
+
+	// A successful cleanup releases the finalizer and the object goes away
+	cleanups := 0
+	if _, err := h.HandleDeletion(ctx, current, func(context.Context) error {
+		cleanups++
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cleanups != 1 {
+		t.Fatalf("expected cleanup to run once, got %d", cleanups)
+	}
+	if err := cl.Get(ctx, key, &platformv1.Application{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the application to be deleted, got %v", err)
+	}
+
+	// Without the finalizer there is nothing to clean up
+	released := app.DeepCopy()
+	released.Finalizers = nil
+	if _, err := h.HandleDeletion(ctx, released, func(context.Context) error {
+		t.Fatal("cleanup must not run without the finalizer")
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReconcileHelper_UpdateStatusFallsBackToUpdate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	// Without the status subresource registered the fake client returns
+	// NotFound for status updates
+	team := &platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "team-a"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(team).Build()
+	h := ReconcileHelper{Client: cl, Kind: "Team", Finalizer: testFinalizer}
+	ctx := context.Background()
+
+	current := &platformv1.Team{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(team), current); err != nil {
+		t.Fatal(err)
+	}
+	current.Status.Phase = "Active"
+	if err := h.UpdateStatus(ctx, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after := &platformv1.Team{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(team), after)
+	if after.Status.Phase != "Active" {
+		t.Fatalf("expected phase Active to be persisted, got %q", after.Status.Phase)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+)
+
+// AnnotationSnapshot asks for a named snapshot of a Ready Database, e.g. as a
+// release checkpoint. Setting it to a name not yet in status.snapshots takes
+// a new snapshot; automated backups are unaffected.
+const AnnotationSnapshot = "platform.company.com/snapshot"
+
+// snapshotPollInterval is how often the broker is asked about pending snapshots
+const snapshotPollInterval = 30 * time.Second
+
+// requestedSnapshot returns the snapshot name the annotation asks for if it
+// hasn't been taken yet
+func requestedSnapshot(database *platformv1.Database) string {
+	name := strings.TrimSpace(database.Annotations[AnnotationSnapshot])
+	if name == "" || database.Status.Snapshot(name) != nil {
+		return ""
+	}
+	return name
+}
+
+// hasPendingSnapshot reports whether any snapshot is still being taken
+func hasPendingSnapshot(database *platformv1.Database) bool {
+	for _, snapshot := range database.Status.Snapshots {
+		if snapshot.Phase == platformv1.SnapshotPhasePending {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileSnapshots polls the broker for pending snapshots and takes the one
+// the snapshot annotation asks for, recording both in status. It requeues
+// while any snapshot is pending. Broker errors worth retrying are returned;
+// others fail the snapshot.
+func (r *DatabaseReconciler) reconcileSnapshots(ctx context.Context, database *platformv1.Database) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	selectedBroker, err := r.recordedBroker(ctx, database)
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to find broker for snapshot: %w", err)
+	}
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	req := brokerclient.SnapshotRequest{
+		DeploymentID: database.Status.DeploymentID,
+		ResourceType: platformv1.ResourceTypeDatabase,
+		ResourceName: database.Name,
+		Namespace:    database.Namespace,
+		Engine:       database.Spec.Engine,
+	}
+
+	for i := range database.Status.Snapshots {
+		snapshot := &database.Status.Snapshots[i]
+		if snapshot.Phase != platformv1.SnapshotPhasePending {
+			continue
+		}
+		resp, err := brokerClient.GetSnapshot(ctx, req, snapshot.ID)
+		if err != nil && brokerclient.IsTransient(err) {
+			log.Info("Could not check snapshot, will retry", "snapshot", snapshot.Name, "err", err)
+			continue
+		}
+		r.applySnapshotResult(database, snapshot, resp, err)
+	}
+
+	if name := requestedSnapshot(database); name != "" && database.Status.Phase == "Ready" {
+		req.Name = name
+		log.Info("Requesting database snapshot", "snapshot", name, "broker", selectedBroker.Name)
+		resp, err := brokerClient.Snapshot(ctx, req)
+		if err != nil && brokerclient.IsTransient(err) {
+			return ctrl.Result{}, fmt.Errorf("failed to request snapshot %q: %w", name, err)
+		}
+		database.Status.AddSnapshot(platformv1.DatabaseSnapshot{
+			Name:        name,
+			Phase:       platformv1.SnapshotPhasePending,
+			RequestedAt: metav1.Now(),
+		})
+		snapshot := database.Status.Snapshot(name)
+		if err == nil && r.Recorder != nil {
+			r.Recorder.Eventf(database, "Normal", "SnapshotRequested", "Requested snapshot %s", name)
+		}
+		r.applySnapshotResult(database, snapshot, resp, err)
+	}
+
+	if err := UpdateStatusIfChanged(ctx, r.Client, database, log); err != nil {
+		return ctrl.Result{}, err
+	}
+	if hasPendingSnapshot(database) {
+		return ctrl.Result{RequeueAfter: snapshotPollInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// applySnapshotResult records the broker's answer about a snapshot, or the
+// error that fails it, recording an event when it completes or fails
+func (r *DatabaseReconciler) applySnapshotResult(database *platformv1.Database, snapshot *platformv1.DatabaseSnapshot, resp *brokerclient.SnapshotResponse, err error) {
+	if err == nil && resp.SnapshotID == "" {
+		err = fmt.Errorf("broker returned no snapshot ID")
+	}
+	if err != nil {
+		snapshot.Phase = platformv1.SnapshotPhaseFailed
+		snapshot.Message = err.Error()
+	} else {
+		snapshot.ID = resp.SnapshotID
+		switch resp.Status {
+		case brokerclient.SnapshotStatusCompleted:
+			snapshot.Phase = platformv1.SnapshotPhaseCompleted
+		case brokerclient.SnapshotStatusFailed:
+			snapshot.Phase = platformv1.SnapshotPhaseFailed
+			snapshot.Message = resp.Message
+		}
+	}
+	if snapshot.Phase == platformv1.SnapshotPhasePending {
+		return
+	}
+
+	completedAt := metav1.Now()
+	if resp != nil && resp.CompletedAt != nil {
+		completedAt = metav1.NewTime(*resp.CompletedAt)
+	}
+	snapshot.CompletedAt = &completedAt
+	if r.Recorder == nil {
+		return
+	}
+	if snapshot.Phase == platformv1.SnapshotPhaseCompleted {
+		r.Recorder.Eventf(database, "Normal", "SnapshotCompleted", "Snapshot %s (%s) completed", snapshot.Name, snapshot.ID)
+	} else {
+		r.Recorder.Eventf(database, "Warning", "SnapshotFailed", "Snapshot %s failed: %s", snapshot.Name, snapshot.Message)
+	}
+}
@@ -4,26 +4,121 @@ import (
 	"context"
 
 	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // UpdateStatusWithFallback tries to update the status subresource, and if the
 // underlying client doesn't support the status subresource (fake client may
-// return NotFound), falls back to a full Update. The provided logger is used
+// return NotFound), falls back to a full Update. A conflict is returned rather
+// than retried: obj's status was computed from a stale copy, and writing it
+// over the latest version would drop what a concurrent writer, such as a
+// broker callback, stored. Returning the error requeues the reconcile, which
+// recomputes the status from the latest object. The provided logger is used
 // for error messages.
 func UpdateStatusWithFallback(ctx context.Context, c client.Client, obj client.Object, logger logr.Logger) error {
+	err := updateStatusOnce(ctx, c, obj, logger)
+	if apierrors.IsConflict(err) {
+		logger.V(1).Info("Status update conflicted, requeueing to recompute from the latest version", "name", obj.GetName(), "namespace", obj.GetNamespace())
+	}
+	return err
+}
+
+// UpdateStatusWithRetry applies mutate to obj and writes its status like
+// UpdateStatusWithFallback. On a conflict it re-reads the object and applies
+// mutate again to the latest version, so only the fields mutate sets are
+// written over a concurrent change. It is for writes that must land, such as
+// recording a deployment the broker has already accepted, where requeueing
+// would provision again.
+func UpdateStatusWithRetry(ctx context.Context, c client.Client, obj client.Object, logger logr.Logger, mutate func()) error {
+	attempt := 0
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if attempt++; attempt > 1 {
+			logger.V(1).Info("Status update conflicted, retrying on the latest version", "name", obj.GetName(), "namespace", obj.GetNamespace(), "attempt", attempt)
+			if err := c.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+				return err
+			}
+		}
+		mutate()
+		return updateStatusOnce(ctx, c, obj, logger)
+	})
+}
+
+// updateStatusOnce makes a single status update, falling back to a full
+// Update for clients without the status subresource
+func updateStatusOnce(ctx context.Context, c client.Client, obj client.Object, logger logr.Logger) error {
 	if err := c.Status().Update(ctx, obj); err != nil {
-		logger.Error(err, "Status().Update failed")
 		if apierrors.IsNotFound(err) {
 			// Fallback to full update for clients which do not support status subresource
 			if uerr := c.Update(ctx, obj); uerr != nil {
-				logger.Error(uerr, "Fallback Update after Status().Update failed")
+				if !apierrors.IsConflict(uerr) {
+					logger.Error(uerr, "Fallback Update after Status().Update failed")
+				}
 				return uerr
 			}
 			return nil
 		}
+		if !apierrors.IsConflict(err) {
+			logger.Error(err, "Status().Update failed")
+		}
 		return err
 	}
 	return nil
 }
+
+// UpdateStatusIfChanged writes obj's status only when it differs from the
+// status currently stored for the object, avoiding needless API writes and
+// resourceVersion churn when a reconcile recomputes the same status. If the
+// current object cannot be read the update is attempted anyway.
+func UpdateStatusIfChanged(ctx context.Context, c client.Client, obj client.Object, logger logr.Logger) error {
+	if current, ok := obj.DeepCopyObject().(client.Object); ok {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err == nil {
+			if same, cmpErr := statusEqual(current, obj); cmpErr == nil && same {
+				logger.V(2).Info("Status unchanged, skipping update", "name", obj.GetName(), "namespace", obj.GetNamespace())
+				return nil
+			}
+		}
+	}
+	return UpdateStatusWithFallback(ctx, c, obj, logger)
+}
+
+// statusEqual reports whether two objects carry semantically equal status fields
+func statusEqual(a, b client.Object) (bool, error) {
+	ua, err := runtime.DefaultUnstructuredConverter.ToUnstructured(a)
+	if err != nil {
+		return false, err
+	}
+	ub, err := runtime.DefaultUnstructuredConverter.ToUnstructured(b)
+	if err != nil {
+		return false, err
+	}
+	return equality.Semantic.DeepEqual(ua["status"], ub["status"]), nil
+}
+
+// statusChangedSinceReconcile reports whether obj's status differs from
+// fetched's, the object as it was read at the start of the reconcile, in
+// anything but lastReconcileTime, or fetched was never stamped. Reconcilers
+// stamp the time only then, so a reconcile that changes nothing writes
+// nothing. Comparing with the fetched object rather than the stored one
+// counts status the reconcile has already saved as a change.
+func statusChangedSinceReconcile(fetched, obj client.Object) bool {
+	before, err := runtime.DefaultUnstructuredConverter.ToUnstructured(fetched)
+	if err != nil {
+		return true
+	}
+	after, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return true
+	}
+	beforeStatus, _ := before["status"].(map[string]interface{})
+	afterStatus, _ := after["status"].(map[string]interface{})
+	if beforeStatus["lastReconcileTime"] == nil {
+		return true
+	}
+	delete(beforeStatus, "lastReconcileTime")
+	delete(afterStatus, "lastReconcileTime")
+	return !equality.Semantic.DeepEqual(beforeStatus, afterStatus)
+}
@@ -0,0 +1,295 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// countingClient returns a fake client that counts status and full updates
+func countingClient(t *testing.T, objs ...client.Object) (client.Client, *int) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	writes := 0
+	cl := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(objs...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				writes++
+				return c.Update(ctx, obj, opts...)
+			},
+			SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				writes++
+				return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	return cl, &writes
+}
+
+func TestUpdateStatusIfChanged_SkipsUnchangedStatus(t *testing.T) {
+	db := &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"},
+		Status:     platformv1.DatabaseStatus{Phase: "Provisioning"},
+	}
+	cl, writes := countingClient(t, db)
+	ctx := context.Background()
+
+	current := &platformv1.Database{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(db), current); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	rv := current.ResourceVersion
+
+	// Re-setting the same phase must not write
+	current.Status.Phase = "Provisioning"
+	if err := UpdateStatusIfChanged(ctx, cl, current, log.Log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *writes != 0 {
+		t.Fatalf("expected no write for unchanged status, got %d", *writes)
+	}
+
+	after := &platformv1.Database{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(db), after)
+	if after.ResourceVersion != rv {
+		t.Fatalf("expected resourceVersion to stay %s, got %s", rv, after.ResourceVersion)
+	}
+}
+
+func TestUpdateStatusIfChanged_WritesChangedStatus(t *testing.T) {
+	db := &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"},
+		Status:     platformv1.DatabaseStatus{Phase: "Provisioning"},
+	}
+	cl, writes := countingClient(t, db)
+	ctx := context.Background()
+
+	current := &platformv1.Database{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(db), current); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+
+	current.Status.Phase = "Failed"
+	if err := UpdateStatusIfChanged(ctx, cl, current, log.Log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *writes != 1 {
+		t.Fatalf("expected exactly one write for changed status, got %d", *writes)
+	}
+
+	after := &platformv1.Database{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(db), after)
+	if after.Status.Phase != "Failed" {
+		t.Fatalf("expected phase Failed to be persisted, got %s", after.Status.Phase)
+	}
+}
+
+func TestUpdateStatusWithFallback_KeepsConcurrentStatusWrite(t *testing.T) {
+	db := &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"},
+		Status:     platformv1.DatabaseStatus{Phase: "Provisioning"},
+	}
+	cl, _ := countingClient(t, db)
+	ctx := context.Background()
+
+	stale := &platformv1.Database{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(db), stale); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+
+	// A callback marks the database Ready after the reconcile read its copy
+	callback := stale.DeepCopy()
+	callback.Status.Phase = "Ready"
+	callback.Status.Endpoint = "db1.dev.svc.cluster.local"
+	if err := cl.Status().Update(ctx, callback); err != nil {
+		t.Fatal(err)
+	}
+
+	stale.Status.LastError = "broker unavailable"
+	err := UpdateStatusWithFallback(ctx, cl, stale, log.Log)
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected the stale write to return a conflict, got: %v", err)
+	}
+
+	// The requeued reconcile recomputes from the latest version
+	latest := &platformv1.Database{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(db), latest); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	latest.Status.LastError = "broker unavailable"
+	if err := UpdateStatusWithFallback(ctx, cl, latest, log.Log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	after := &platformv1.Database{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(db), after)
+	if after.Status.Phase != "Ready" || after.Status.Endpoint != "db1.dev.svc.cluster.local" {
+		t.Fatalf("expected the callback's phase and endpoint to survive, got %+v", after.Status)
+	}
+	if after.Status.LastError != "broker unavailable" {
+		t.Fatalf("expected the recomputed status to be written, got %+v", after.Status)
+	}
+}
+
+func TestUpdateStatusWithRetry_ReappliesMutateOnConflict(t *testing.T) {
+	db := &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"},
+		Status:     platformv1.DatabaseStatus{Phase: "Provisioning"},
+	}
+	cl, _ := countingClient(t, db)
+	ctx := context.Background()
+
+	stale := &platformv1.Database{}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(db), stale); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	concurrent := stale.DeepCopy()
+	concurrent.Status.Endpoint = "db1.dev.svc.cluster.local"
+	if err := cl.Status().Update(ctx, concurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err := UpdateStatusWithRetry(ctx, cl, stale, log.Log, func() {
+		calls++
+		stale.Status.DeploymentID = "deploy-1"
+	})
+	if err != nil {
+		t.Fatalf("expected the conflict to be retried, got: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("expected mutate to run again on the latest version, ran %d times", calls)
+	}
+
+	after := &platformv1.Database{}
+	_ = cl.Get(ctx, client.ObjectKeyFromObject(db), after)
+	if after.Status.DeploymentID != "deploy-1" || after.Status.Endpoint != "db1.dev.svc.cluster.local" {
+		t.Fatalf("expected both the mutation and the concurrent endpoint, got %+v", after.Status)
+	}
+}
+
+// TestControllers_StatusWithoutSubresource runs each reconciler against a
+// client that rejects status subresource updates, as clients without the
+// subresource do, and checks the status still lands
+func TestControllers_StatusWithoutSubresource(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer healthy.Close()
+
+	finalized := func(name, finalizer string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: "dev", Name: name, Finalizers: []string{finalizer}}
+	}
+	orphanOwner := platformv1.OwnerReference{Kind: "Tenant", Name: "missing"}
+
+	tests := []struct {
+		name       string
+		obj        client.Object
+		reconciler func(client.Client, *runtime.Scheme) reconcile.Reconciler
+		wantPhase  string
+	}{
+		{
+			name: "database",
+			obj:  &platformv1.Database{ObjectMeta: finalized("db1", databaseFinalizerName), Spec: platformv1.DatabaseSpec{Engine: "postgresql", Owner: orphanOwner}},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &DatabaseReconciler{Client: c, Scheme: s, Recorder: record.NewFakeRecorder(10)}
+			},
+			wantPhase: "Suspended",
+		},
+		{
+			name: "cache",
+			obj:  &platformv1.Cache{ObjectMeta: finalized("cache1", cacheFinalizerName)},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &CacheReconciler{Client: c, Scheme: s, Recorder: record.NewFakeRecorder(10)}
+			},
+			wantPhase: "Suspended",
+		},
+		{
+			name: "topic",
+			obj:  &platformv1.Topic{ObjectMeta: finalized("topic1", topicFinalizerName)},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &TopicReconciler{Client: c, Scheme: s, Recorder: record.NewFakeRecorder(10)}
+			},
+			wantPhase: "Suspended",
+		},
+		{
+			name: "application",
+			obj:  &platformv1.Application{ObjectMeta: finalized("app1", applicationFinalizerName)},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &ApplicationReconciler{Client: c, Scheme: s, Recorder: record.NewFakeRecorder(10)}
+			},
+			wantPhase: "Suspended",
+		},
+		{
+			name: "team",
+			obj:  &platformv1.Team{ObjectMeta: finalized("team-a", teamFinalizerName)},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &TeamReconciler{Client: c, Scheme: s, Recorder: record.NewFakeRecorder(10)}
+			},
+			wantPhase: "Suspended",
+		},
+		{
+			name: "tenant",
+			obj:  &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme", Finalizers: []string{tenantFinalizerName}}},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &TenantReconciler{Client: c, Scheme: s}
+			},
+			wantPhase: "Active",
+		},
+		{
+			name: "broker",
+			obj:  &platformv1.Broker{ObjectMeta: finalized("broker-a", brokerFinalizerName), Spec: platformv1.BrokerSpec{Endpoint: healthy.URL}},
+			reconciler: func(c client.Client, s *runtime.Scheme) reconcile.Reconciler {
+				return &BrokerReconciler{Client: c, Scheme: s, httpClient: healthy.Client()}
+			},
+			wantPhase: "Ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = platformv1.AddToScheme(scheme)
+			_ = corev1.AddToScheme(scheme)
+
+			// No WithStatusSubresource: status updates return NotFound
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.obj).Build()
+			req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(tt.obj)}
+			if _, err := tt.reconciler(cl, scheme).Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("reconcile returned error: %v", err)
+			}
+
+			out := tt.obj.DeepCopyObject().(client.Object)
+			if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+				t.Fatal(err)
+			}
+			u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, _ := u["status"].(map[string]interface{})
+			if status["phase"] != tt.wantPhase {
+				t.Fatalf("expected phase %s to be persisted, got status %v", tt.wantPhase, status)
+			}
+		})
+	}
+}
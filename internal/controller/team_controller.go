@@ -19,16 +19,20 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
 )
 
 const teamFinalizerName = "platform.company.com/team-cleanup"
@@ -36,20 +40,40 @@ const teamFinalizerName = "platform.company.com/team-cleanup"
 // TeamReconciler reconciles a Team object
 type TeamReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// ClusterReader lists the resources a Team owns across every namespace
+	// when the manager's cache is scoped to some. Client is used when nil.
+	ClusterReader client.Reader
+
+	// ResyncInterval is how often a Team's resource counts and spend are
+	// refreshed. Zero uses five minutes.
+	ResyncInterval time.Duration
+
+	// MaxConcurrentReconciles is how many Teams may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+
+	// Namespaces restricts the Teams reconciled to those namespaces. Empty
+	// reconciles every namespace.
+	Namespaces WatchNamespaces
 }
 
 // +kubebuilder:rbac:groups=platform.company.com,resources=teams,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.company.com,resources=teams/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=platform.company.com,resources=teams/finalizers,verbs=update
+// +kubebuilder:rbac:groups=platform.company.com,resources=applications;caches;databases;topics,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop
-func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("team", time.Now(), &err)
 	log := log.FromContext(ctx)
 
 	// Fetch the Team instance
 	team := &platformv1.Team{}
-	err := r.Get(ctx, req.NamespacedName, team)
+	err = r.Get(ctx, req.NamespacedName, team)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			log.Info("Team resource not found. Ignoring since object must be deleted")
@@ -64,16 +88,9 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return r.handleDeletion(ctx, team)
 	}
 
-	// Add finalizer if not present
-	if !controllerutil.ContainsFinalizer(team, teamFinalizerName) {
-		log.Info("Adding finalizer to Team", "name", team.Name)
-		controllerutil.AddFinalizer(team, teamFinalizerName)
-		if err := r.Update(ctx, team); err != nil {
-			log.Error(err, "Failed to add finalizer")
-			return ctrl.Result{}, err
-		}
-		// Requeue to process with finalizer in place
-		return ctrl.Result{Requeue: true}, nil
+	// Add finalizer if not present, requeueing to process with it in place
+	if added, err := r.helper().EnsureFinalizer(ctx, team); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
 	}
 
 	log.Info("Reconciling Team",
@@ -91,7 +108,7 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 			if errors.IsNotFound(err) {
 				log.Info("Referenced tenant not found, suspending team", "team", team.Name, "tenant", tenantName)
 				team.Status.Phase = "Suspended"
-				if statusErr := UpdateStatusWithFallback(ctx, r.Client, team, log); statusErr != nil {
+				if statusErr := r.helper().UpdateStatus(ctx, team); statusErr != nil {
 					log.Error(statusErr, "Failed to update Team status")
 					return ctrl.Result{}, statusErr
 				}
@@ -100,6 +117,18 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 			log.Error(err, "Failed to get Tenant for TenantRef")
 			return ctrl.Result{}, err
 		}
+		// Label the team so the tenant can count it
+		if team.Labels["platform.company.com/tenant"] != tenantName {
+			if team.Labels == nil {
+				team.Labels = map[string]string{}
+			}
+			team.Labels["platform.company.com/tenant"] = tenantName
+			if err := r.Update(ctx, team); err != nil {
+				log.Error(err, "Failed to label Team with tenant", "team", team.Name, "tenant", tenantName)
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{Requeue: true}, nil
+		}
 	} else {
 		// Try to infer tenant from namespace label set by Tenant controller
 		ns := &corev1.Namespace{}
@@ -118,7 +147,7 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		// No TenantRef and no namespace label: mark suspended
 		log.Info("No tenantRef set and no tenant label on namespace; suspending team", "team", team.Name)
 		team.Status.Phase = "Suspended"
-		if statusErr := UpdateStatusWithFallback(ctx, r.Client, team, log); statusErr != nil {
+		if statusErr := r.helper().UpdateStatus(ctx, team); statusErr != nil {
 			log.Error(statusErr, "Failed to update Team status")
 			return ctrl.Result{}, statusErr
 		}
@@ -131,7 +160,7 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		if team.Status.ResourceCount == nil {
 			team.Status.ResourceCount = &platformv1.ResourceCount{}
 		}
-		if err := UpdateStatusWithFallback(ctx, r.Client, team, log); err != nil {
+		if err := r.helper().UpdateStatus(ctx, team); err != nil {
 			log.Error(err, "Failed to update Team status")
 			return ctrl.Result{}, err
 		}
@@ -139,91 +168,170 @@ func (r *TeamReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		log.Info("Team status initialized", "name", team.Name)
 	}
 
-	// TODO: Implement team management logic
-	// 1. Count resources owned by this team
-	// 2. Calculate current spend
-	// 3. Check quota limits
-	// 4. Update status
+	// Refresh the resource counts and spend; owned resources don't trigger
+	// a reconcile, so they are recounted periodically
+	if err := r.updateUsage(ctx, team); err != nil {
+		log.Error(err, "Failed to count Team resources")
+		return ctrl.Result{}, err
+	}
+	if err := r.helper().UpdateStatus(ctx, team); err != nil {
+		log.Error(err, "Failed to update Team status")
+		return ctrl.Result{}, err
+	}
 
 	log.Info("Team reconciliation complete", "name", team.Name)
 
-	return ctrl.Result{}, nil
+	resync := r.ResyncInterval
+	if resync <= 0 {
+		resync = defaultTeamResyncInterval
+	}
+	return ctrl.Result{RequeueAfter: resync}, nil
+}
+
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *TeamReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Team", Finalizer: teamFinalizerName}
 }
 
 // handleDeletion performs cleanup and safety checks when a Team is being deleted
 func (r *TeamReconciler) handleDeletion(ctx context.Context, team *platformv1.Team) (ctrl.Result, error) {
+	return r.helper().HandleDeletion(ctx, team, func(ctx context.Context) error {
+		// Check for owned resources before allowing deletion
+		if err := r.checkOwnedResources(ctx, team); err != nil {
+			// Update status to indicate why deletion is blocked; the finalizer
+			// stays until the user deletes the owned resources
+			team.Status.Phase = "Deleting"
+			if statusErr := r.helper().UpdateStatus(ctx, team); statusErr != nil {
+				log.FromContext(ctx).Error(statusErr, "Failed to update Team status")
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// checkOwnedResources verifies that no resources are owned by this team
+func (r *TeamReconciler) checkOwnedResources(ctx context.Context, team *platformv1.Team) error {
 	log := log.FromContext(ctx)
 
-	if !controllerutil.ContainsFinalizer(team, teamFinalizerName) {
-		// Finalizer already removed, nothing to do
-		return ctrl.Result{}, nil
+	// Check for databases owned by this team
+	reader := clusterListReader(r.ClusterReader, r.Client)
+	ownedDatabases, err := databasesOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	for _, db := range ownedDatabases {
+		log.Info("Found database owned by team",
+			"database", db.Name,
+			"namespace", db.Namespace,
+			"team", team.Name)
 	}
 
-	log.Info("Handling Team deletion", "name", team.Name)
-
-	// Check for owned resources before allowing deletion
-	if err := r.checkOwnedResources(ctx, team); err != nil {
-		log.Error(err, "Cannot delete Team, it still owns resources")
-		// Update status to indicate why deletion is blocked
-		team.Status.Phase = "Deleting"
-		if statusErr := r.Status().Update(ctx, team); statusErr != nil {
-			log.Error(statusErr, "Failed to update Team status")
-		}
-		// Don't remove finalizer - user must delete owned resources first
-		return ctrl.Result{}, err
+	if len(ownedDatabases) > 0 {
+		return fmt.Errorf("team %s still owns %d database(s), delete them first",
+			team.Name, len(ownedDatabases))
 	}
 
-	// All checks passed, safe to delete
-	log.Info("Team cleanup completed, removing finalizer", "name", team.Name)
+	// Check for caches and topics owned by this team
+	ownedCaches, err := cachesOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	for _, cache := range ownedCaches {
+		log.Info("Found cache owned by team",
+			"cache", cache.Name,
+			"namespace", cache.Namespace,
+			"team", team.Name)
+	}
+	ownedTopics, err := topicsOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	for _, topic := range ownedTopics {
+		log.Info("Found topic owned by team",
+			"topic", topic.Name,
+			"namespace", topic.Namespace,
+			"team", team.Name)
+	}
 
-	controllerutil.RemoveFinalizer(team, teamFinalizerName)
-	if err := r.Update(ctx, team); err != nil {
-		log.Error(err, "Failed to remove finalizer")
-		return ctrl.Result{}, err
+	if len(ownedCaches) > 0 || len(ownedTopics) > 0 {
+		return fmt.Errorf("team %s still owns %d cache(s) and %d topic(s), delete them first",
+			team.Name, len(ownedCaches), len(ownedTopics))
 	}
 
-	return ctrl.Result{}, nil
-}
+	// TODO: Check for other resource types when implemented:
+	// - Applications
+	// - Services
 
-// checkOwnedResources verifies that no resources are owned by this team
-func (r *TeamReconciler) checkOwnedResources(ctx context.Context, team *platformv1.Team) error {
-	log := log.FromContext(ctx)
+	log.Info("No owned resources found for team", "name", team.Name)
+	return nil
+}
 
-	// Check for databases owned by this team
+// databasesOwnedByTeam lists the databases the team owns, directly or through
+// one of its applications
+func databasesOwnedByTeam(ctx context.Context, c client.Reader, team *platformv1.Team) ([]platformv1.Database, error) {
 	databaseList := &platformv1.DatabaseList{}
-	if err := r.List(ctx, databaseList); err != nil {
-		return fmt.Errorf("failed to list databases: %w", err)
+	if err := c.List(ctx, databaseList); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
 	}
 
-	ownedDatabases := 0
+	var owned []platformv1.Database
 	for _, db := range databaseList.Items {
-		if db.Spec.Owner.Kind == "Team" && db.Spec.Owner.Name == team.Name {
-			ownedDatabases++
-			log.Info("Found database owned by team",
-				"database", db.Name,
-				"namespace", db.Namespace,
-				"team", team.Name)
+		if db.Spec.Owner.Kind != "Team" && db.Spec.Owner.Kind != "Application" {
+			continue
+		}
+		// A database whose owner chain is broken belongs to no team
+		owner, err := owningTeam(ctx, c, &db)
+		if err != nil || owner == nil {
+			continue
+		}
+		if owner.Namespace == team.Namespace && owner.Name == team.Name {
+			owned = append(owned, db)
 		}
 	}
+	return owned, nil
+}
 
-	if ownedDatabases > 0 {
-		return fmt.Errorf("team %s still owns %d database(s), delete them first",
-			team.Name, ownedDatabases)
+// cachesOwnedByTeam lists the caches the team owns, directly or through one
+// of its applications
+func cachesOwnedByTeam(ctx context.Context, c client.Reader, team *platformv1.Team) ([]platformv1.Cache, error) {
+	cacheList := &platformv1.CacheList{}
+	if err := c.List(ctx, cacheList); err != nil {
+		return nil, fmt.Errorf("failed to list caches: %w", err)
 	}
 
-	// TODO: Check for other resource types when implemented:
-	// - Applications
-	// - Services
-	// - Caches
-	// - Topics
+	var owned []platformv1.Cache
+	for _, cache := range cacheList.Items {
+		if ownedBy(ctx, c, cache.Spec.Owner, cache.Namespace, team) {
+			owned = append(owned, cache)
+		}
+	}
+	return owned, nil
+}
 
-	log.Info("No owned resources found for team", "name", team.Name)
-	return nil
+// topicsOwnedByTeam lists the topics the team owns, directly or through one
+// of its applications
+func topicsOwnedByTeam(ctx context.Context, c client.Reader, team *platformv1.Team) ([]platformv1.Topic, error) {
+	topicList := &platformv1.TopicList{}
+	if err := c.List(ctx, topicList); err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	var owned []platformv1.Topic
+	for _, topic := range topicList.Items {
+		if ownedBy(ctx, c, topic.Spec.Owner, topic.Namespace, team) {
+			owned = append(owned, topic)
+		}
+	}
+	return owned, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TeamReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("team-controller")
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&platformv1.Team{}).
+		For(&platformv1.Team{}, builder.WithPredicates(r.Namespaces.Predicate())).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,163 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestTeamReconciler_UsageAndBudgetAlerts(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	costing := func(name string, owner platformv1.OwnerReference, cost float64) *platformv1.Database {
+		db := &platformv1.Database{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: name},
+			Spec:       platformv1.DatabaseSpec{Engine: "postgresql", Owner: owner},
+		}
+		db.Status.Cost = &platformv1.CostInfo{EstimatedMonthly: cost, Currency: "USD"}
+		return db
+	}
+	payments := platformv1.OwnerReference{Kind: "Team", Name: "payments"}
+	team := &platformv1.Team{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "payments",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{teamFinalizerName},
+		},
+		Spec: platformv1.TeamSpec{
+			DisplayName: "Payments",
+			TenantRef:   &platformv1.ObjectReference{Name: "acme"},
+			Budget:      &platformv1.Budget{MonthlyLimit: 100, AlertThresholds: []float64{0.5, 0.8, 1}},
+		},
+	}
+	objs := []client.Object{
+		&platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}},
+		team,
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "search"}},
+		&platformv1.Application{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "checkout"}, Spec: platformv1.ApplicationSpec{Owner: payments}},
+		&platformv1.Cache{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "sessions"}, Spec: platformv1.CacheSpec{Owner: payments}},
+		costing("ledger", payments, 40.25),
+		// Owned through the team's application
+		costing("orders", platformv1.OwnerReference{Kind: "Application", Name: "checkout"}, 45),
+		costing("other", platformv1.OwnerReference{Kind: "Team", Name: "search"}, 500),
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&platformv1.Team{}).Build()
+	recorder := record.NewFakeRecorder(10)
+	r := &TeamReconciler{Client: cl, Scheme: scheme, Recorder: recorder, ResyncInterval: time.Minute}
+
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(team)}
+	reconcileTeam := func() (reconcile.Result, *platformv1.Team) {
+		t.Helper()
+		res, err := r.Reconcile(context.Background(), req)
+		if err != nil {
+			t.Fatalf("reconcile returned error: %v", err)
+		}
+		out := &platformv1.Team{}
+		if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+			t.Fatalf("failed to get team: %v", err)
+		}
+		return res, out
+	}
+
+	res, out := reconcileTeam()
+	if res.RequeueAfter != time.Minute {
+		t.Fatalf("expected a requeue after the resync interval, got %+v", res)
+	}
+	want := platformv1.ResourceCount{Applications: 1, Databases: 2, Caches: 1}
+	if out.Status.ResourceCount == nil || *out.Status.ResourceCount != want {
+		t.Fatalf("expected counts %+v, got %+v", want, out.Status.ResourceCount)
+	}
+	if out.Status.CurrentSpend != 85.25 || out.Status.LastUpdated.IsZero() {
+		t.Fatalf("expected spend 85.25 with LastUpdated set, got %v at %v", out.Status.CurrentSpend, out.Status.LastUpdated)
+	}
+
+	// 85.25 of 100 crosses the 50% and 80% thresholds but not 100%
+	var alerts []string
+	for len(recorder.Events) > 0 {
+		if e := <-recorder.Events; strings.HasPrefix(e, "Warning "+ReasonBudgetThresholdExceeded) {
+			alerts = append(alerts, e)
+		}
+	}
+	if len(alerts) != 2 || !strings.Contains(alerts[0], "50%") || !strings.Contains(alerts[1], "80%") {
+		t.Fatalf("expected 50%% and 80%% budget alerts, got %v", alerts)
+	}
+
+	// Thresholds already crossed don't alert again
+	lastUpdated := out.Status.LastUpdated
+	if _, out = reconcileTeam(); !out.Status.LastUpdated.Equal(&lastUpdated) {
+		t.Fatalf("expected LastUpdated to stay put while usage is unchanged")
+	}
+	if len(recorder.Events) != 0 {
+		t.Fatalf("expected no further alerts, got %s", <-recorder.Events)
+	}
+}
+
+func TestTeamReconciler_DeletionBlockedByOwnedCachesAndTopics(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	payments := platformv1.OwnerReference{Kind: "Team", Name: "payments"}
+	team := &platformv1.Team{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments", Finalizers: []string{teamFinalizerName}},
+		Spec:       platformv1.TeamSpec{DisplayName: "Payments"},
+	}
+	cache := &platformv1.Cache{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "sessions"}, Spec: platformv1.CacheSpec{Owner: payments}}
+	topic := &platformv1.Topic{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "orders"}, Spec: platformv1.TopicSpec{Owner: payments}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(team, cache, topic).WithStatusSubresource(&platformv1.Team{}).Build()
+	r := &TeamReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(team)}
+
+	if err := cl.Delete(context.Background(), team); err != nil {
+		t.Fatalf("failed to delete team: %v", err)
+	}
+	for _, owned := range []client.Object{cache, topic} {
+		if _, err := r.Reconcile(context.Background(), req); err == nil || !strings.Contains(err.Error(), "still owns") {
+			t.Fatalf("expected deletion to be blocked by owned resources, got %v", err)
+		}
+		if err := cl.Get(context.Background(), req.NamespacedName, &platformv1.Team{}); err != nil {
+			t.Fatalf("expected the team to be kept: %v", err)
+		}
+		if err := cl.Delete(context.Background(), owned); err != nil {
+			t.Fatalf("failed to delete %s: %v", owned.GetName(), err)
+		}
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if err := cl.Get(context.Background(), req.NamespacedName, &platformv1.Team{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the team to be deleted once it owns nothing, got %v", err)
+	}
+}
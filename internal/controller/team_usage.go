@@ -0,0 +1,121 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// defaultTeamResyncInterval is how often a Team's usage is refreshed when
+// TeamReconciler.ResyncInterval is unset
+const defaultTeamResyncInterval = 5 * time.Minute
+
+// ReasonBudgetThresholdExceeded marks the event fired when a Team's spend
+// crosses one of its budget alert thresholds
+const ReasonBudgetThresholdExceeded = "BudgetThresholdExceeded"
+
+// updateUsage recounts the resources the team owns and sums the estimated
+// monthly cost of its databases into the team's status. LastUpdated moves
+// only when the counts or spend change.
+func (r *TeamReconciler) updateUsage(ctx context.Context, team *platformv1.Team) error {
+	reader := clusterListReader(r.ClusterReader, r.Client)
+	databases, err := databasesOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	count := &platformv1.ResourceCount{Databases: int32(len(databases))}
+	spend := 0.0
+	for _, db := range databases {
+		if db.Status.Cost != nil {
+			spend += db.Status.Cost.EstimatedMonthly
+		}
+	}
+
+	apps := &platformv1.ApplicationList{}
+	if err := reader.List(ctx, apps); err != nil {
+		return fmt.Errorf("failed to list applications: %w", err)
+	}
+	for _, app := range apps.Items {
+		if ownedBy(ctx, reader, app.Spec.Owner, app.Namespace, team) {
+			count.Applications++
+		}
+	}
+	caches, err := cachesOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	count.Caches = int32(len(caches))
+	topics, err := topicsOwnedByTeam(ctx, reader, team)
+	if err != nil {
+		return err
+	}
+	count.Topics = int32(len(topics))
+
+	spend = math.Round(spend*100) / 100
+	if team.Status.ResourceCount != nil && *team.Status.ResourceCount == *count &&
+		team.Status.CurrentSpend == spend && !team.Status.LastUpdated.IsZero() {
+		// Unchanged; leaving LastUpdated alone keeps the status write, and
+		// the reconcile it would trigger, from repeating every resync
+		return nil
+	}
+
+	previous := team.Status.CurrentSpend
+	team.Status.ResourceCount = count
+	team.Status.CurrentSpend = spend
+	team.Status.LastUpdated = metav1.Now()
+
+	r.alertOnBudget(team, previous)
+	return nil
+}
+
+// ownedBy reports whether the owner reference made from namespace resolves
+// to the team. References whose chain is broken belong to no team.
+func ownedBy(ctx context.Context, c client.Reader, owner platformv1.OwnerReference, namespace string, team *platformv1.Team) bool {
+	if owner.Kind != "Team" && owner.Kind != "Application" {
+		return false
+	}
+	resolved, err := owningTeamOf(ctx, c, owner, namespace)
+	if err != nil || resolved == nil {
+		return false
+	}
+	return resolved.Namespace == team.Namespace && resolved.Name == team.Name
+}
+
+// alertOnBudget fires a warning event for each budget alert threshold the
+// team's spend crossed since it was last counted
+func (r *TeamReconciler) alertOnBudget(team *platformv1.Team, previousSpend float64) {
+	budget := team.Spec.Budget
+	if budget == nil || budget.MonthlyLimit <= 0 || r.Recorder == nil {
+		return
+	}
+	for _, threshold := range budget.AlertThresholds {
+		limit := threshold * budget.MonthlyLimit
+		if previousSpend < limit && team.Status.CurrentSpend >= limit {
+			r.Recorder.Eventf(team, "Warning", ReasonBudgetThresholdExceeded,
+				"Estimated monthly spend $%.2f has reached %.0f%% of the $%.2f budget",
+				team.Status.CurrentSpend, threshold*100, budget.MonthlyLimit)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"context"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -25,26 +26,41 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
 )
 
 const tenantFinalizerName = "platform.company.com/tenant-cleanup"
 
+// tenantResyncInterval is how often a Tenant's resource counts are refreshed
+const tenantResyncInterval = 60 * time.Second
+
 // TenantReconciler reconciles a Tenant object
 type TenantReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// ClusterReader lists the Teams, Applications and Databases counted
+	// across every namespace when the manager's cache is scoped to some.
+	// Client is used when nil.
+	ClusterReader client.Reader
+
+	// MaxConcurrentReconciles is how many Tenants may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
 }
 
 // +kubebuilder:rbac:groups=platform.company.com,resources=tenants,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=platform.company.com,resources=tenants/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=platform.company.com,resources=tenants/finalizers,verbs=update
+// +kubebuilder:rbac:groups=platform.company.com,resources=teams;applications;databases,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop
-func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("tenant", time.Now(), &err)
 	log := log.FromContext(ctx)
 
 	tenant := &platformv1.Tenant{}
@@ -65,14 +81,8 @@ func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// Add finalizer if not present
-	if !controllerutil.ContainsFinalizer(tenant, tenantFinalizerName) {
-		log.Info("Adding finalizer to Tenant", "name", tenant.Name)
-		controllerutil.AddFinalizer(tenant, tenantFinalizerName)
-		if err := r.Update(ctx, tenant); err != nil {
-			log.Error(err, "Failed to add finalizer")
-			return ctrl.Result{}, err
-		}
-		return ctrl.Result{Requeue: true}, nil
+	if added, err := r.helper().EnsureFinalizer(ctx, tenant); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
 	}
 
 	log.Info("Reconciling Tenant", "name", tenant.Name, "displayName", tenant.Spec.DisplayName)
@@ -83,7 +93,7 @@ func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		if tenant.Status.ResourceCount == nil {
 			tenant.Status.ResourceCount = &platformv1.TenantResourceCount{}
 		}
-		if err := r.Status().Update(ctx, tenant); err != nil {
+		if err := r.helper().UpdateStatus(ctx, tenant); err != nil {
 			log.Error(err, "Failed to update Tenant status")
 			return ctrl.Result{}, err
 		}
@@ -91,9 +101,7 @@ func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 	}
 
 	// TODO: Implement tenant management logic
-	// - Ensure namespaces for tenant exist
-	// - Enforce tenant-level quotas
-	// - Aggregate resource counts and spend across namespaces belonging to tenant
+	// - Aggregate spend across namespaces belonging to tenant
 
 	// Ensure tenant namespace exists (namespace per tenant for boundary)
 	nsName := "tenant-" + tenant.Name
@@ -120,35 +128,64 @@ func (r *TenantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		}
 	}
 
+	// Refresh the resource counts; they drift as resources come and go, so
+	// they are recounted periodically rather than on every change
+	count, err := r.countResources(ctx, tenant)
+	if err != nil {
+		log.Error(err, "Failed to count Tenant resources")
+		return ctrl.Result{}, err
+	}
+	tenant.Status.ResourceCount = count
+	if err := r.helper().UpdateStatus(ctx, tenant); err != nil {
+		log.Error(err, "Failed to update Tenant resource counts")
+		return ctrl.Result{}, err
+	}
+
 	log.Info("Tenant reconciliation complete", "name", tenant.Name)
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: tenantResyncInterval}, nil
 }
 
-func (r *TenantReconciler) handleDeletion(ctx context.Context, tenant *platformv1.Tenant) (ctrl.Result, error) {
-	log := log.FromContext(ctx)
+// countResources counts the Teams, Applications and Databases labelled with
+// the tenant across all namespaces
+func (r *TenantReconciler) countResources(ctx context.Context, tenant *platformv1.Tenant) (*platformv1.TenantResourceCount, error) {
+	selector := client.MatchingLabels{"platform.company.com/tenant": tenant.Name}
+	reader := clusterListReader(r.ClusterReader, r.Client)
 
-	if !controllerutil.ContainsFinalizer(tenant, tenantFinalizerName) {
-		return ctrl.Result{}, nil
+	teams := &platformv1.TeamList{}
+	if err := reader.List(ctx, teams, selector); err != nil {
+		return nil, err
+	}
+	apps := &platformv1.ApplicationList{}
+	if err := reader.List(ctx, apps, selector); err != nil {
+		return nil, err
+	}
+	databases := &platformv1.DatabaseList{}
+	if err := reader.List(ctx, databases, selector); err != nil {
+		return nil, err
 	}
+	return &platformv1.TenantResourceCount{
+		Teams:        int32(len(teams.Items)),
+		Applications: int32(len(apps.Items)),
+		Databases:    int32(len(databases.Items)),
+	}, nil
+}
 
-	log.Info("Handling Tenant deletion", "name", tenant.Name)
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *TenantReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Tenant", Finalizer: tenantFinalizerName}
+}
 
+func (r *TenantReconciler) handleDeletion(ctx context.Context, tenant *platformv1.Tenant) (ctrl.Result, error) {
 	// Check for teams or other resources across namespaces before allowing deletion
 	// TODO: Implement checks similar to TeamReconciler.checkOwnedResources but across all namespaces
-
-	// Remove finalizer
-	controllerutil.RemoveFinalizer(tenant, tenantFinalizerName)
-	if err := r.Update(ctx, tenant); err != nil {
-		log.Error(err, "Failed to remove finalizer")
-		return ctrl.Result{}, err
-	}
-
-	return ctrl.Result{}, nil
+	return r.helper().HandleDeletion(ctx, tenant, nil)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *TenantReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&platformv1.Tenant{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
@@ -0,0 +1,105 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestTenantReconciler_CountsResources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	acme := map[string]string{"platform.company.com/tenant": "acme"}
+	globex := map[string]string{"platform.company.com/tenant": "globex"}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme", Finalizers: []string{tenantFinalizerName}}}
+	objs := []client.Object{
+		tenant,
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments", Labels: acme}},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "search", Labels: acme}},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "other", Labels: globex}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1", Labels: acme}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db2", Labels: acme}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "db3", Labels: acme}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "db4", Labels: globex}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "unlabelled"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithStatusSubresource(&platformv1.Tenant{}).Build()
+	r := &TenantReconciler{Client: cl, Scheme: scheme}
+
+	res, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(tenant)})
+	if err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if res.RequeueAfter != tenantResyncInterval {
+		t.Fatalf("expected a periodic requeue of %s, got %+v", tenantResyncInterval, res)
+	}
+
+	out := &platformv1.Tenant{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(tenant), out); err != nil {
+		t.Fatalf("failed to get tenant: %v", err)
+	}
+	want := platformv1.TenantResourceCount{Teams: 2, Applications: 0, Databases: 3}
+	if out.Status.ResourceCount == nil || *out.Status.ResourceCount != want {
+		t.Fatalf("expected counts %+v, got %+v", want, out.Status.ResourceCount)
+	}
+}
+
+func TestTenantReconciler_CountsPastScopedCache(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	acme := map[string]string{"platform.company.com/tenant": "acme"}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme", Finalizers: []string{tenantFinalizerName}}}
+	watched := []client.Object{
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments", Labels: acme}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1", Labels: acme}},
+	}
+	unwatched := []client.Object{
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "search", Labels: acme}},
+		&platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "prod", Name: "db2", Labels: acme}},
+	}
+	// The manager's cache holds the watched namespace; the API server has both
+	cached := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(watched, tenant)...).WithStatusSubresource(&platformv1.Tenant{}).Build()
+	apiServer := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(watched, unwatched...)...).Build()
+	scope := WatchNamespaces{"dev"}
+	r := &TenantReconciler{Client: cached, Scheme: scheme, ClusterReader: scope.ClusterReader(apiServer)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(tenant)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	out := &platformv1.Tenant{}
+	if err := cached.Get(context.Background(), client.ObjectKeyFromObject(tenant), out); err != nil {
+		t.Fatalf("failed to get tenant: %v", err)
+	}
+	want := platformv1.TenantResourceCount{Teams: 2, Databases: 2}
+	if out.Status.ResourceCount == nil || *out.Status.ResourceCount != want {
+		t.Fatalf("expected counts across every namespace %+v, got %+v", want, out.Status.ResourceCount)
+	}
+}
@@ -47,42 +47,21 @@ func resolveTenant(ctx context.Context, c client.Client, obj client.Object, dept
 			return t, nil
 		}
 	case *platformv1.Database:
-		// Databases use OwnerReference struct
-		if o.Spec.Owner.Kind == "Tenant" {
-			t := &platformv1.Tenant{}
-			if err := c.Get(ctx, client.ObjectKey{Name: o.Spec.Owner.Name}, t); err != nil {
-				return nil, fmt.Errorf("referenced tenant %s not found: %w", o.Spec.Owner.Name, err)
-			}
-			return t, nil
+		if t, ok, err := resolveResourceOwner(ctx, c, o.Spec.Owner, o.Namespace, depth); ok {
+			return t, err
+		}
+	case *platformv1.Cache:
+		if t, ok, err := resolveResourceOwner(ctx, c, o.Spec.Owner, o.Namespace, depth); ok {
+			return t, err
+		}
+	case *platformv1.Topic:
+		if t, ok, err := resolveResourceOwner(ctx, c, o.Spec.Owner, o.Namespace, depth); ok {
+			return t, err
 		}
 	}
 
 	// 2) Follow owner chains where possible
 	switch o := obj.(type) {
-	case *platformv1.Database:
-		if o.Spec.Owner.Kind == "Team" {
-			// owner is a Team in the same namespace unless Namespace provided
-			ns := o.Namespace
-			if o.Spec.Owner.Namespace != "" {
-				ns = o.Spec.Owner.Namespace
-			}
-			team := &platformv1.Team{}
-			if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: o.Spec.Owner.Name}, team); err != nil {
-				return nil, fmt.Errorf("owner team %s/%s not found: %w", ns, o.Spec.Owner.Name, err)
-			}
-			return resolveTenant(ctx, c, team, depth+1)
-		}
-		if o.Spec.Owner.Kind == "Application" {
-			ns := o.Namespace
-			if o.Spec.Owner.Namespace != "" {
-				ns = o.Spec.Owner.Namespace
-			}
-			app := &platformv1.Application{}
-			if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: o.Spec.Owner.Name}, app); err != nil {
-				return nil, fmt.Errorf("owner application %s/%s not found: %w", ns, o.Spec.Owner.Name, err)
-			}
-			return resolveTenant(ctx, c, app, depth+1)
-		}
 	case *platformv1.Application:
 		if o.Spec.Owner.Kind == "Team" {
 			team := &platformv1.Team{}
@@ -119,3 +98,38 @@ func resolveTenant(ctx context.Context, c client.Client, obj client.Object, dept
 
 	return nil, errors.New("tenant unresolved")
 }
+
+// resolveResourceOwner resolves the tenant of a provisioned resource (Database,
+// Cache, Topic) from its spec.owner. The owner is in the resource's namespace
+// unless it names another. ok is false when the owner kind gives no tenant and
+// the namespace label should be tried instead.
+func resolveResourceOwner(ctx context.Context, c client.Client, owner platformv1.OwnerReference, namespace string, depth int) (tenant *platformv1.Tenant, ok bool, err error) {
+	ns := namespace
+	if owner.Namespace != "" {
+		ns = owner.Namespace
+	}
+
+	switch owner.Kind {
+	case "Tenant":
+		t := &platformv1.Tenant{}
+		if err := c.Get(ctx, client.ObjectKey{Name: owner.Name}, t); err != nil {
+			return nil, true, fmt.Errorf("referenced tenant %s not found: %w", owner.Name, err)
+		}
+		return t, true, nil
+	case "Team":
+		team := &platformv1.Team{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: owner.Name}, team); err != nil {
+			return nil, true, fmt.Errorf("owner team %s/%s not found: %w", ns, owner.Name, err)
+		}
+		t, err := resolveTenant(ctx, c, team, depth+1)
+		return t, true, err
+	case "Application":
+		app := &platformv1.Application{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: ns, Name: owner.Name}, app); err != nil {
+			return nil, true, fmt.Errorf("owner application %s/%s not found: %w", ns, owner.Name, err)
+		}
+		t, err := resolveTenant(ctx, c, app, depth+1)
+		return t, true, err
+	}
+	return nil, false, nil
+}
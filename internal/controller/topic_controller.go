@@ -0,0 +1,459 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/tracing"
+)
+
+const topicFinalizerName = "platform.company.com/topic-cleanup"
+
+// TopicReconciler reconciles a Topic object
+type TopicReconciler struct {
+	client.Client
+	Scheme         *runtime.Scheme
+	BrokerRegistry *brokerregistry.Registry
+	Recorder       record.EventRecorder
+
+	// APIReader reads brokers' authentication Secrets. Client is used when nil.
+	APIReader client.Reader
+
+	// SigningKey is the manager's Ed25519 key, used to sign requests to
+	// brokers whose authentication type is ed25519
+	SigningKey ed25519.PrivateKey
+
+	// MaxConcurrentReconciles is how many Topics may be reconciled at once.
+	// Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+
+	// Namespaces restricts the Topics reconciled to those namespaces. Empty
+	// reconciles every namespace.
+	Namespaces WatchNamespaces
+
+	// apiKeys caches the API keys of brokers authenticated by api-key
+	apiKeys apiKeyCache
+}
+
+// +kubebuilder:rbac:groups=platform.company.com,resources=topics,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=platform.company.com,resources=topics/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=platform.company.com,resources=topics/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get
+
+// Reconcile is part of the main kubernetes reconciliation loop
+func (r *TopicReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	defer metrics.ObserveReconcile("topic", time.Now(), &err)
+	log := log.FromContext(ctx)
+
+	topic := &platformv1.Topic{}
+	if err := r.Get(ctx, req.NamespacedName, topic); err != nil {
+		if errors.IsNotFound(err) {
+			log.Info("Topic resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Topic")
+		return ctrl.Result{}, err
+	}
+
+	if !topic.DeletionTimestamp.IsZero() {
+		return r.handleDeletion(ctx, topic)
+	}
+
+	fetched := topic.DeepCopy()
+	result, err = r.reconcileTopic(ctx, topic)
+	r.recordReconcile(ctx, fetched, topic, err)
+	return result, err
+}
+
+// reconcileTopic drives a live Topic towards its desired state
+func (r *TopicReconciler) reconcileTopic(ctx context.Context, topic *platformv1.Topic) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if added, err := r.helper().EnsureFinalizer(ctx, topic); err != nil || added {
+		return ctrl.Result{Requeue: added}, err
+	}
+
+	log.Info("Reconciling Topic",
+		"name", topic.Name,
+		"namespace", topic.Namespace,
+		"engine", topic.Spec.Engine,
+		"partitions", topic.Spec.Partitions)
+
+	tenant, terr := ResolveTenant(ctx, r.Client, topic)
+	if terr != nil {
+		log.Info("Unable to resolve tenant for topic, suspending until tenant is available", "topic", topic.Name, "err", terr)
+		if r.Recorder != nil {
+			r.Recorder.Eventf(topic, "Warning", "TenantUnresolved", "tenant could not be resolved: %v", terr)
+		}
+		topic.Status.Phase = "Suspended"
+		setWaitingCondition(&topic.Status.Conditions, topic.Generation, WaitingReasonTenantUnresolved, fmt.Sprintf("Tenant could not be resolved: %v", terr))
+		if err := UpdateStatusIfChanged(ctx, r.Client, topic, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if topic.Status.Phase == "Suspended" {
+		log.Info("Tenant resolved, resuming suspended topic", "topic", topic.Name, "tenant", tenant.Name)
+		topic.Status.Phase = "Pending"
+		meta.RemoveStatusCondition(&topic.Status.Conditions, ConditionWaiting)
+		if err := UpdateStatusIfChanged(ctx, r.Client, topic, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Label with the tenant so it can be found by tenant-wide queries
+	if topic.Labels == nil {
+		topic.Labels = map[string]string{}
+	}
+	if topic.Labels["platform.company.com/tenant"] != tenant.Name {
+		topic.Labels["platform.company.com/tenant"] = tenant.Name
+		if err := r.Update(ctx, topic); err != nil {
+			log.Error(err, "Failed to label Topic with tenant")
+			return ctrl.Result{}, err
+		}
+		if r.Recorder != nil {
+			r.Recorder.Eventf(topic, "Normal", "TenantAssigned", "Assigned tenant %s to topic %s", tenant.Name, topic.Name)
+		}
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	// Status updates for an existing deployment come via webhook callbacks
+	if topic.Status.DeploymentID != "" {
+		log.Info("Topic already provisioned or in progress",
+			"deploymentId", topic.Status.DeploymentID,
+			"phase", topic.Status.Phase)
+		return ctrl.Result{}, nil
+	}
+
+	if tenant.Status.Phase == "Suspended" {
+		log.Info("Tenant is suspended, waiting before provisioning", "topic", topic.Name, "tenant", tenant.Name)
+		topic.Status.Phase = "Pending"
+		setWaitingCondition(&topic.Status.Conditions, topic.Generation, WaitingReasonTenantSuspended, fmt.Sprintf("Tenant %s is suspended", tenant.Name))
+		if err := UpdateStatusIfChanged(ctx, r.Client, topic, log); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: defaultWaitRequeue}, nil
+	}
+
+	if topic.Status.Phase != "Provisioning" {
+		topic.Status.Phase = "Provisioning"
+		meta.RemoveStatusCondition(&topic.Status.Conditions, ConditionWaiting)
+		if err := UpdateStatusIfChanged(ctx, r.Client, topic, log); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	if err := r.provisionTopic(ctx, topic); err != nil {
+		if reason, retryAfter, ok := waitingReasonFor(err); ok {
+			log.Info("Topic provisioning is waiting", "name", topic.Name, "reason", reason, "err", err)
+			topic.Status.Phase = "Pending"
+			setWaitingCondition(&topic.Status.Conditions, topic.Generation, reason, err.Error())
+			if statusErr := UpdateStatusIfChanged(ctx, r.Client, topic, log); statusErr != nil {
+				return ctrl.Result{}, statusErr
+			}
+			return ctrl.Result{RequeueAfter: retryAfter}, nil
+		}
+
+		log.Error(err, "Failed to provision topic")
+		topic.Status.Phase = "Failed"
+		if statusErr := UpdateStatusIfChanged(ctx, r.Client, topic, log); statusErr != nil {
+			log.Error(statusErr, "Failed to update status to Failed")
+		}
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Topic provisioning request sent to broker", "name", topic.Name)
+	return ctrl.Result{}, nil
+}
+
+// recordReconcile stamps the outcome of a reconcile onto the Topic status
+func (r *TopicReconciler) recordReconcile(ctx context.Context, fetched, topic *platformv1.Topic, reconcileErr error) {
+	log := log.FromContext(ctx)
+
+	topic.Status.LastError = ""
+	if reconcileErr != nil {
+		topic.Status.LastError = reconcileErr.Error()
+	}
+	if !statusChangedSinceReconcile(fetched, topic) {
+		log.V(2).Info("Status unchanged, skipping update", "name", topic.Name, "namespace", topic.Namespace)
+		return
+	}
+	now := metav1.Now()
+	topic.Status.LastReconcileTime = &now
+
+	if err := UpdateStatusIfChanged(ctx, r.Client, topic, log); err != nil {
+		log.Error(err, "Failed to record reconcile outcome", "name", topic.Name)
+	}
+}
+
+// helper returns the finalizer and status handling shared with the other
+// reconcilers
+func (r *TopicReconciler) helper() ReconcileHelper {
+	return ReconcileHelper{Client: r.Client, Kind: "Topic", Finalizer: topicFinalizerName}
+}
+
+// handleDeletion deprovisions the topic before releasing its finalizer
+func (r *TopicReconciler) handleDeletion(ctx context.Context, topic *platformv1.Topic) (ctrl.Result, error) {
+	return r.helper().HandleDeletion(ctx, topic, func(ctx context.Context) error {
+		return r.cleanupTopic(ctx, topic)
+	})
+}
+
+// cleanupTopic asks the broker that provisioned the topic to deprovision it
+func (r *TopicReconciler) cleanupTopic(ctx context.Context, topic *platformv1.Topic) error {
+	log := log.FromContext(ctx)
+
+	if topic.Status.DeploymentID == "" || r.BrokerRegistry == nil {
+		return nil
+	}
+
+	// Deprovision through the broker that handled provisioning. Another
+	// broker wouldn't know the deployment, so don't pick one if it's gone.
+	var selectedBroker *platformv1.Broker
+	var err error
+	if ref := topic.Status.BrokerRef; ref != nil && ref.Name != "" {
+		selectedBroker, err = getRecordedBroker(ctx, r.Client, ref, topic.Namespace)
+		if err != nil {
+			err = fmt.Errorf("broker %s that provisioned deployment %s is unavailable; restore it or remove the %s finalizer to abandon the deployment: %w",
+				brokerRefString(ref, topic.Namespace), topic.Status.DeploymentID, topicFinalizerName, err)
+			if r.Recorder != nil {
+				r.Recorder.Event(topic, "Warning", "BrokerNotFound", err.Error())
+			}
+			return err
+		}
+	}
+
+	// Topics provisioned before the broker was recorded fall back to one
+	// matching their capabilities
+	if selectedBroker == nil {
+		selectedBroker, err = r.BrokerRegistry.SelectBroker(ctx, brokerregistry.SelectionCriteria{
+			ResourceType: platformv1.ResourceTypeTopic,
+			Provider:     topic.Spec.Engine,
+		})
+		if err != nil {
+			// The broker that provisioned it may no longer exist
+			log.Error(err, "Failed to select broker for deprovisioning, continuing anyway")
+			return nil
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "TopicReconciler.deprovision", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.topic", topic.Namespace+"/"+topic.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+			attribute.String("kidp.deployment_id", topic.Status.DeploymentID),
+		))
+	defer span.End()
+
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return err
+	}
+	_, err = brokerClient.Deprovision(ctx, brokerclient.DeprovisionRequest{
+		DeploymentID:    topic.Status.DeploymentID,
+		ResourceType:    platformv1.ResourceTypeTopic,
+		ResourceName:    topic.Name,
+		Namespace:       topic.Namespace,
+		TargetNamespace: topic.Spec.TargetNamespace,
+		CallbackURL:     managerCallbackURL(),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to call broker deprovision: %w", err)
+	}
+
+	log.Info("Deprovisioning request sent to broker",
+		"deploymentId", topic.Status.DeploymentID,
+		"broker", selectedBroker.Name)
+	return nil
+}
+
+// provisionTopic selects a broker for the topic and asks it to provision one
+func (r *TopicReconciler) provisionTopic(ctx context.Context, topic *platformv1.Topic) error {
+	log := log.FromContext(ctx)
+
+	if r.BrokerRegistry == nil {
+		return fmt.Errorf("broker registry not configured")
+	}
+
+	criteria := brokerregistry.SelectionCriteria{
+		ResourceType: platformv1.ResourceTypeTopic,
+		Region:       topic.Spec.Region,
+		Provider:     topic.Spec.Engine,
+	}
+	selection, err := r.BrokerRegistry.Select(ctx, criteria)
+	if err != nil {
+		return fmt.Errorf("failed to select broker: %w", err)
+	}
+	selectedBroker := selection.Broker
+
+	log.Info("Selected broker for provisioning",
+		"broker", selectedBroker.Name,
+		"endpoint", selectedBroker.Spec.Endpoint,
+		"score", selection.Score,
+		"candidates", selection.Candidates)
+	if r.Recorder != nil {
+		if selection.Fallback {
+			r.Recorder.Eventf(topic, "Warning", "BrokerSelected",
+				"No broker matched criteria: %s; using fallback broker %s/%s",
+				criteria, selectedBroker.Namespace, selectedBroker.Name)
+		} else {
+			r.Recorder.Eventf(topic, "Normal", "BrokerSelected",
+				"Selected broker %s/%s (score %.1f, %s) for criteria: %s",
+				selectedBroker.Namespace, selectedBroker.Name, selection.Score, selection.Basis(), criteria)
+		}
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "TopicReconciler.provision", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("kidp.topic", topic.Namespace+"/"+topic.Name),
+			attribute.String("kidp.broker", selectedBroker.Name),
+		))
+	defer span.End()
+
+	token, err := callbacktoken.Issue(time.Now(), callbacktoken.DefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	brokerClient, err := r.brokerClient(ctx, selectedBroker)
+	if err != nil {
+		return err
+	}
+	resp, err := brokerClient.Provision(ctx, topicProvisionRequest(topic, token.Token))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("failed to call broker provision: %w", err)
+	}
+
+	log.Info("Broker accepted provisioning request",
+		"deploymentId", resp.DeploymentID,
+		"status", resp.Status)
+	span.SetAttributes(attribute.String("kidp.deployment_id", resp.DeploymentID))
+	r.BrokerRegistry.Reserve(selectedBroker, resp.DeploymentID)
+
+	expires := metav1.NewTime(token.Expires)
+	err = UpdateStatusWithRetry(ctx, r.Client, topic, log, func() {
+		topic.Status.DeploymentID = resp.DeploymentID
+		topic.Status.CallbackTokenHash = token.Hash
+		topic.Status.CallbackTokenExpiry = &expires
+		topic.Status.BrokerRef = &platformv1.ObjectReference{
+			Name:      selectedBroker.Name,
+			Namespace: selectedBroker.Namespace,
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update status with deploymentId: %w", err)
+	}
+	return nil
+}
+
+// topicProvisionRequest builds the broker request for the topic's spec
+func topicProvisionRequest(topic *platformv1.Topic, callbackToken string) brokerclient.ProvisionRequest {
+	req := brokerclient.ProvisionRequest{
+		ResourceType:    platformv1.ResourceTypeTopic,
+		ResourceName:    topic.Name,
+		Namespace:       topic.Namespace,
+		TargetNamespace: topic.Spec.TargetNamespace,
+		Team:            fmt.Sprintf("%s/%s", topic.Spec.Owner.Kind, topic.Spec.Owner.Name),
+		Owner:           topic.Spec.Owner.Name,
+		CallbackURL:     managerCallbackURL(),
+		CallbackToken:   callbackToken,
+		Source:          sourceFromAnnotations(topic.Annotations),
+		Spec: map[string]interface{}{
+			"engine": topic.Spec.Engine,
+		},
+	}
+	if topic.Spec.Partitions > 0 {
+		req.Spec["partitions"] = topic.Spec.Partitions
+	}
+	if topic.Spec.ReplicationFactor > 0 {
+		req.Spec["replicationFactor"] = topic.Spec.ReplicationFactor
+	}
+	if topic.Spec.Retention != "" {
+		req.Spec["retention"] = topic.Spec.Retention
+	}
+	if topic.Spec.Region != "" {
+		req.Spec["region"] = topic.Spec.Region
+	}
+	if len(topic.Spec.Parameters) > 0 {
+		req.Spec["parameters"] = topic.Spec.Parameters
+	}
+	return req
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TopicReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorderFor("topic-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&platformv1.Topic{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		), r.Namespaces.Predicate())).
+		Watches(&platformv1.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.suspendedTopics)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+// suspendedTopics returns a request for every Topic suspended because its
+// tenant could not be resolved
+func (r *TopicReconciler) suspendedTopics(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list platformv1.TopicList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list topics awaiting a tenant")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, topic := range list.Items {
+		if topic.Status.Phase != "Suspended" || !topic.DeletionTimestamp.IsZero() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&topic)})
+	}
+	return requests
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+)
+
+func topicBroker(endpoint string) *platformv1.Broker {
+	return &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"},
+		Spec: platformv1.BrokerSpec{
+			Endpoint:      endpoint,
+			CloudProvider: "on-prem",
+			Capabilities:  []platformv1.BrokerCapability{{ResourceType: "Topic", Providers: []string{"kafka"}}},
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready"},
+	}
+}
+
+func TestTopicReconciler_SuspendWhenNoTenant(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	topic := &platformv1.Topic{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "topic2", Finalizers: []string{topicFinalizerName}},
+		Spec:       platformv1.TopicSpec{Engine: "kafka", Owner: platformv1.OwnerReference{Kind: "Team", Name: "missing"}},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(topic).Build()
+	r := &TopicReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(topic)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	out := &platformv1.Topic{}
+	if err := cl.Get(context.Background(), req.NamespacedName, out); err != nil {
+		t.Fatalf("failed to get topic: %v", err)
+	}
+	if out.Status.Phase != "Suspended" {
+		t.Fatalf("expected topic to be Suspended when no tenant found, got phase=%s", out.Status.Phase)
+	}
+	if requests := r.suspendedTopics(context.Background(), &platformv1.Tenant{}); len(requests) != 1 || requests[0] != req {
+		t.Fatalf("expected tenant changes to enqueue %v, got %v", req, requests)
+	}
+}
+
+func TestTopicReconciler_ProvisionsThroughBroker(t *testing.T) {
+	var sent brokerclient.ProvisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	topic := &platformv1.Topic{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "orders",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{topicFinalizerName},
+		},
+		Spec: platformv1.TopicSpec{
+			Owner:             platformv1.OwnerReference{Kind: "Tenant", Name: "acme"},
+			Engine:            "kafka",
+			Partitions:        6,
+			ReplicationFactor: 3,
+			Retention:         "7d",
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, topicBroker(srv.URL), topic).Build()
+	r := &TopicReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(topic)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+
+	if sent.ResourceType != "topic" || sent.ResourceName != "orders" || sent.CallbackToken == "" {
+		t.Fatalf("unexpected provision request: %+v", sent)
+	}
+	for key, want := range map[string]interface{}{"engine": "kafka", "partitions": float64(6), "replicationFactor": float64(3), "retention": "7d"} {
+		if sent.Spec[key] != want {
+			t.Fatalf("expected spec %s=%v, got %v", key, want, sent.Spec[key])
+		}
+	}
+
+	out := &platformv1.Topic{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(topic), out); err != nil {
+		t.Fatalf("failed to get topic: %v", err)
+	}
+	if out.Status.DeploymentID != "deploy-1" || out.Status.Phase != "Provisioning" {
+		t.Fatalf("expected deploy-1 to be provisioning, got %s/%s", out.Status.DeploymentID, out.Status.Phase)
+	}
+	if out.Status.BrokerRef == nil || out.Status.BrokerRef.Name != "broker-a" || out.Status.CallbackTokenHash == "" {
+		t.Fatalf("expected the broker and token hash to be recorded, got %+v", out.Status)
+	}
+}
+
+func TestTopicReconciler_DeprovisionsOnDelete(t *testing.T) {
+	var sent brokerclient.DeprovisionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.DeprovisionResponse{Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	now := metav1.Now()
+	topic := &platformv1.Topic{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "orders", Finalizers: []string{topicFinalizerName}, DeletionTimestamp: &now},
+		Spec:       platformv1.TopicSpec{Engine: "kafka"},
+		Status: platformv1.TopicStatus{
+			DeploymentID: "deploy-1",
+			BrokerRef:    &platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+		},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(topicBroker(srv.URL), topic).Build()
+	r := &TopicReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+	if _, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(topic)}); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if sent.DeploymentID != "deploy-1" || sent.ResourceType != "topic" {
+		t.Fatalf("expected deploy-1 to be deprovisioned, got %+v", sent)
+	}
+	// Releasing the last finalizer lets the object go
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(topic), &platformv1.Topic{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected the topic to be deleted once deprovisioned, got %v", err)
+	}
+}
+
+func TestTopicReconciler_APIKeyBroker(t *testing.T) {
+	sent := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent[r.URL.Path] = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(brokerclient.ProvisionResponse{DeploymentID: "deploy-key", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	b := topicBroker(srv.URL)
+	b.Spec.Authentication = &platformv1.BrokerAuthentication{
+		Type:      platformv1.BrokerAuthAPIKey,
+		SecretRef: &platformv1.SecretReference{Namespace: "kidp-system", Name: "broker-api-key"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-api-key"},
+		Data:       map[string][]byte{"api-key": []byte("key-1")},
+	}
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	topic := &platformv1.Topic{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "dev",
+			Name:       "orders",
+			Labels:     map[string]string{"platform.company.com/tenant": "acme"},
+			Finalizers: []string{topicFinalizerName},
+		},
+		Spec: platformv1.TopicSpec{Owner: platformv1.OwnerReference{Kind: "Tenant", Name: "acme"}, Engine: "kafka"},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tenant, b, secret, topic).Build()
+	r := &TopicReconciler{Client: cl, Scheme: scheme, Recorder: record.NewFakeRecorder(10), BrokerRegistry: brokerregistry.NewRegistry(cl)}
+	req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(topic)}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if got := sent["/v1/provision"]; got != "Bearer key-1" {
+		t.Fatalf("expected the API key on the provision request, got %q", got)
+	}
+
+	if err := cl.Delete(context.Background(), topic); err != nil {
+		t.Fatalf("failed to delete topic: %v", err)
+	}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("reconcile returned error: %v", err)
+	}
+	if got := sent["/v1/deprovision"]; got != "Bearer key-1" {
+		t.Fatalf("expected the API key on the deprovision request, got %q", got)
+	}
+}
+
+func TestTopicReconciler_CleanupCrossNamespaceBrokerRef(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	var recordedCalls, decoyCalls int
+	recordedSrv := countingBroker(&recordedCalls)
+	defer recordedSrv.Close()
+	decoySrv := countingBroker(&decoyCalls)
+	defer decoySrv.Close()
+
+	// The broker that provisioned the topic lives in kidp-system; a broker of
+	// the same name in the topic's namespace must not be used
+	recorded := topicBroker(recordedSrv.URL)
+	decoy := topicBroker(decoySrv.URL)
+	decoy.Namespace = "dev"
+
+	tests := []struct {
+		name         string
+		ref          platformv1.ObjectReference
+		objects      []client.Object
+		wantErr      bool
+		wantRecorded int
+	}{
+		{
+			name:         "recorded namespace",
+			ref:          platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy(), decoy.DeepCopy()},
+			wantRecorded: 1,
+		},
+		{
+			name:    "recorded broker gone",
+			ref:     platformv1.ObjectReference{Namespace: "kidp-system", Name: "broker-a"},
+			objects: []client.Object{decoy.DeepCopy()},
+			wantErr: true,
+		},
+		{
+			name:         "legacy ref without namespace",
+			ref:          platformv1.ObjectReference{Name: "broker-a"},
+			objects:      []client.Object{recorded.DeepCopy()},
+			wantRecorded: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordedCalls, decoyCalls = 0, 0
+			topic := &platformv1.Topic{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "orders", Finalizers: []string{topicFinalizerName}},
+				Spec:       platformv1.TopicSpec{Engine: "kafka"},
+			}
+			topic.Status.DeploymentID = "deploy-1"
+			ref := tt.ref
+			topic.Status.BrokerRef = &ref
+
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(tt.objects, topic)...).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &TopicReconciler{Client: cl, Scheme: scheme, Recorder: recorder, BrokerRegistry: brokerregistry.NewRegistry(cl)}
+
+			err := r.cleanupTopic(context.Background(), topic)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "kidp-system/broker-a") {
+					t.Fatalf("expected an error naming the recorded broker, got %v", err)
+				}
+				if len(recorder.Events) == 0 || !strings.Contains(<-recorder.Events, "BrokerNotFound") {
+					t.Fatalf("expected a BrokerNotFound event")
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if recordedCalls != tt.wantRecorded {
+				t.Fatalf("expected %d call(s) to the recorded broker, got %d", tt.wantRecorded, recordedCalls)
+			}
+			if decoyCalls != 0 {
+				t.Fatalf("expected no calls to another broker, got %d", decoyCalls)
+			}
+		})
+	}
+}
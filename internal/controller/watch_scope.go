@@ -0,0 +1,85 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// WatchNamespaces restricts the namespaces whose Databases, Caches, Topics,
+// Teams and Applications the controllers watch. Empty watches every
+// namespace. Cluster-scoped objects such as Tenants and DatabaseClasses are
+// always watched, and so are Brokers, which serve every namespace wherever
+// they are registered.
+type WatchNamespaces []string
+
+// CacheOptions returns the manager cache options for the scope
+func (w WatchNamespaces) CacheOptions() cache.Options {
+	if len(w) == 0 {
+		return cache.Options{}
+	}
+	namespaces := make(map[string]cache.Config, len(w))
+	for _, ns := range w {
+		namespaces[ns] = cache.Config{}
+	}
+	return cache.Options{
+		DefaultNamespaces: namespaces,
+		ByObject: map[client.Object]cache.ByObject{
+			&platformv1.Broker{}: {Namespaces: map[string]cache.Config{cache.AllNamespaces: {}}},
+		},
+	}
+}
+
+// ClusterReader returns the reader for lists that must see every namespace,
+// such as counts across a tenant or the resources still using a broker: nil,
+// leaving the manager's cached client, when every namespace is watched, and
+// apiReader when the cache holds only the watched ones
+func (w WatchNamespaces) ClusterReader(apiReader client.Reader) client.Reader {
+	if len(w) == 0 {
+		return nil
+	}
+	return apiReader
+}
+
+// clusterListReader returns reader, or c when the reconciler was given none
+func clusterListReader(reader client.Reader, c client.Client) client.Reader {
+	if reader != nil {
+		return reader
+	}
+	return c
+}
+
+// Contains reports whether objects in the namespace are watched. The empty
+// namespace of cluster-scoped objects always is.
+func (w WatchNamespaces) Contains(namespace string) bool {
+	return len(w) == 0 || namespace == "" || slices.Contains(w, namespace)
+}
+
+// Predicate passes objects in the scope. The manager's cache already holds
+// nothing else; the predicate keeps a controller to its scope when it is run
+// with a wider cache.
+func (w WatchNamespaces) Predicate() predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return w.Contains(obj.GetNamespace())
+	})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestWatchNamespaces_IgnoresObjectsOutsideScope(t *testing.T) {
+	scope := WatchNamespaces{"team-a", "team-b"}
+	pred := scope.Predicate()
+
+	tests := []struct {
+		name string
+		obj  client.Object
+		want bool
+	}{
+		{"database in scope", &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db1"}}, true},
+		{"database outside scope", &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "team-c", Name: "db1"}}, false},
+		{"team outside scope", &platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "team-c", Name: "payments"}}, false},
+		{"cluster-scoped tenant", &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := pred.Create(event.CreateEvent{Object: tc.obj}); got != tc.want {
+				t.Fatalf("create: expected %v, got %v", tc.want, got)
+			}
+			if got := pred.Update(event.UpdateEvent{ObjectOld: tc.obj, ObjectNew: tc.obj}); got != tc.want {
+				t.Fatalf("update: expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	// The cache only holds the scoped namespaces, except for brokers
+	opts := scope.CacheOptions()
+	if len(opts.DefaultNamespaces) != 2 {
+		t.Fatalf("expected the cache to be restricted to 2 namespaces, got %v", opts.DefaultNamespaces)
+	}
+	for obj, byObject := range opts.ByObject {
+		if _, ok := obj.(*platformv1.Broker); !ok {
+			t.Fatalf("unexpected cache settings for %T", obj)
+		}
+		if _, ok := byObject.Namespaces[cache.AllNamespaces]; !ok {
+			t.Fatalf("expected brokers to be cached in every namespace, got %v", byObject.Namespaces)
+		}
+	}
+	if len(opts.ByObject) != 1 {
+		t.Fatalf("expected broker cache settings, got %v", opts.ByObject)
+	}
+
+	// No scope watches everything
+	if !WatchNamespaces(nil).Contains("team-c") || WatchNamespaces(nil).CacheOptions().DefaultNamespaces != nil {
+		t.Fatal("expected an empty scope to watch every namespace")
+	}
+	if WatchNamespaces(nil).ClusterReader(fake.NewClientBuilder().Build()) != nil {
+		t.Fatal("expected an empty scope to list through the manager's cache")
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the manager's own Prometheus metrics. They are
+// registered with controller-runtime's registry, so they are served on the
+// manager's metrics endpoint alongside the controller-runtime defaults.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kidp_reconcile_duration_seconds",
+		Help:    "Time taken by each call to a controller's Reconcile, by controller.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"controller"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kidp_reconcile_errors_total",
+		Help: "Reconciles that returned an error, by controller.",
+	}, []string{"controller"})
+
+	databasesByPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kidp_databases",
+		Help: "Databases by the phase they were in when last reconciled.",
+	}, []string{"phase"})
+
+	databaseTimeToReady = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "kidp_database_time_to_ready_seconds",
+		Help:    "Time from a Database being created to it first becoming Ready.",
+		Buckets: []float64{30, 60, 120, 300, 600, 900, 1800, 3600, 7200},
+	})
+)
+
+// DatabasePhases tracks the phase of every Database the manager has
+// reconciled and reports them through the kidp_databases gauge
+var DatabasePhases = NewPhaseGauge(databasesByPhase, "Provisioning", "Ready", "Failed")
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(reconcileDuration, reconcileErrors, databasesByPhase, databaseTimeToReady)
+}
+
+// ObserveReconcile records a Reconcile of controller that began at start,
+// counting an error if *err is set once it returns. It is meant to be
+// deferred on entry to Reconcile, with err pointing at the named error result.
+func ObserveReconcile(controller string, start time.Time, err *error) {
+	reconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil {
+		reconcileErrors.WithLabelValues(controller).Inc()
+	}
+}
+
+// DatabaseReady records how long a Database created at created took to
+// become Ready for the first time
+func DatabaseReady(created time.Time) {
+	databaseTimeToReady.Observe(time.Since(created).Seconds())
+}
+
+// PhaseGauge counts objects by phase in a gauge labelled by phase. Each
+// object is counted under the last phase set for it until it is deleted.
+type PhaseGauge struct {
+	gauge *prometheus.GaugeVec
+
+	mu     sync.Mutex
+	phases map[string]string
+	seen   map[string]bool
+}
+
+// NewPhaseGauge returns a PhaseGauge reporting through gauge. The listed
+// phases are reported as zero until an object reaches them, so dashboards
+// see them from the start.
+func NewPhaseGauge(gauge *prometheus.GaugeVec, phases ...string) *PhaseGauge {
+	g := &PhaseGauge{
+		gauge:  gauge,
+		phases: map[string]string{},
+		seen:   map[string]bool{},
+	}
+	for _, phase := range phases {
+		g.seen[phase] = true
+		gauge.WithLabelValues(phase).Set(0)
+	}
+	return g
+}
+
+// Set records that the object identified by key is in phase. An empty phase
+// stops counting the object, as for Delete.
+func (g *PhaseGauge) Set(key, phase string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if phase == "" {
+		delete(g.phases, key)
+	} else {
+		g.phases[key] = phase
+		g.seen[phase] = true
+	}
+	g.update()
+}
+
+// Delete stops counting the object identified by key
+func (g *PhaseGauge) Delete(key string) {
+	g.Set(key, "")
+}
+
+// update recounts the gauge, leaving phases no object is in at zero. The
+// caller must hold g.mu.
+func (g *PhaseGauge) update() {
+	counts := map[string]int{}
+	for _, phase := range g.phases {
+		counts[phase]++
+	}
+	for phase := range g.seen {
+		g.gauge.WithLabelValues(phase).Set(float64(counts[phase]))
+	}
+}
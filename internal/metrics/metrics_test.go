@@ -0,0 +1,78 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveReconcile(t *testing.T) {
+	reconcile := func(fail bool) (err error) {
+		defer ObserveReconcile("test", time.Now(), &err)
+		if fail {
+			return errors.New("boom")
+		}
+		return nil
+	}
+	_ = reconcile(false)
+	_ = reconcile(true)
+	_ = reconcile(true)
+
+	if got := testutil.CollectAndCount(reconcileDuration, "kidp_reconcile_duration_seconds"); got != 1 {
+		t.Fatalf("expected one duration series, got %d", got)
+	}
+	if got := testutil.ToFloat64(reconcileErrors.WithLabelValues("test")); got != 2 {
+		t.Fatalf("expected 2 reconcile errors, got %v", got)
+	}
+}
+
+func TestPhaseGauge(t *testing.T) {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_phases"}, []string{"phase"})
+	phases := NewPhaseGauge(gauge, "Provisioning", "Ready")
+	count := func(phase string) float64 { return testutil.ToFloat64(gauge.WithLabelValues(phase)) }
+
+	if got := count("Ready"); got != 0 {
+		t.Fatalf("expected listed phases to start at 0, got %v", got)
+	}
+
+	phases.Set("ns/a", "Provisioning")
+	phases.Set("ns/b", "Provisioning")
+	phases.Set("ns/a", "Ready")
+	phases.Set("ns/a", "Ready")
+	if count("Provisioning") != 1 || count("Ready") != 1 {
+		t.Fatalf("expected 1 Provisioning and 1 Ready, got %v and %v", count("Provisioning"), count("Ready"))
+	}
+
+	// Leaving a phase that wasn't listed reports it as zero rather than
+	// dropping the series
+	phases.Set("ns/b", "Failed")
+	phases.Set("ns/b", "Ready")
+	if count("Failed") != 0 || count("Ready") != 2 {
+		t.Fatalf("expected 0 Failed and 2 Ready, got %v and %v", count("Failed"), count("Ready"))
+	}
+
+	phases.Delete("ns/a")
+	phases.Set("ns/b", "")
+	if count("Ready") != 0 || count("Provisioning") != 0 {
+		t.Fatalf("expected deleted objects to stop being counted, got %v Ready", count("Ready"))
+	}
+}
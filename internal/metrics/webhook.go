@@ -0,0 +1,86 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Reasons a broker callback was rejected, recorded by CallbackRejected
+const (
+	// CallbackRejectedMissingHeaders is a callback without the broker name,
+	// timestamp or signature header
+	CallbackRejectedMissingHeaders = "missing_headers"
+	// CallbackRejectedBadTimestamp is a callback whose timestamp doesn't parse
+	CallbackRejectedBadTimestamp = "bad_timestamp"
+	// CallbackRejectedReplay is a callback whose timestamp is outside the
+	// allowed skew, as a replayed request's would be
+	CallbackRejectedReplay = "replay"
+	// CallbackRejectedUnknownBroker is a callback naming a Broker that
+	// doesn't exist
+	CallbackRejectedUnknownBroker = "unknown_broker"
+	// CallbackRejectedBadSignature is a callback whose signature doesn't
+	// verify against any of the broker's keys, or whose broker has no key
+	CallbackRejectedBadSignature = "bad_signature"
+	// CallbackRejectedBadToken is a callback whose callback token is missing,
+	// wrong or expired
+	CallbackRejectedBadToken = "bad_token"
+)
+
+var (
+	callbacksReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kidp_webhook_callbacks_received_total",
+		Help: "Broker callbacks received by the webhook.",
+	})
+
+	callbacksVerified = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kidp_webhook_callbacks_verified_total",
+		Help: "Broker callbacks whose signature verified.",
+	})
+
+	callbacksRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kidp_webhook_callbacks_rejected_total",
+		Help: "Broker callbacks rejected for failing authentication, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	for _, reason := range []string{
+		CallbackRejectedMissingHeaders, CallbackRejectedBadTimestamp, CallbackRejectedReplay,
+		CallbackRejectedUnknownBroker, CallbackRejectedBadSignature, CallbackRejectedBadToken,
+	} {
+		callbacksRejected.WithLabelValues(reason)
+	}
+	ctrlmetrics.Registry.MustRegister(callbacksReceived, callbacksVerified, callbacksRejected)
+}
+
+// CallbackReceived counts a callback arriving at the webhook
+func CallbackReceived() {
+	callbacksReceived.Inc()
+}
+
+// CallbackVerified counts a callback whose signature verified
+func CallbackVerified() {
+	callbacksVerified.Inc()
+}
+
+// CallbackRejected counts a callback rejected for one of the
+// CallbackRejected reasons
+func CallbackRejected(reason string) {
+	callbacksRejected.WithLabelValues(reason).Inc()
+}
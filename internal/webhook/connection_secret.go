@@ -0,0 +1,90 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=create;patch
+
+// connectionSecretKeys are the callback details copied into a Database's
+// connection Secret
+var connectionSecretKeys = []string{"host", "port", "username", "password", "database"}
+
+// ensureConnectionSecret writes the connection details a broker reported in
+// a Ready callback to the Secret the callback names, owned by the Database so
+// it is garbage collected with it. Brokers that create the Secret themselves
+// send no details and are left alone.
+func (h databaseCallbackHandler) ensureConnectionSecret(ctx context.Context, database *platformv1.Database, callback CallbackRequest) error {
+	if callback.ConnectionSecret == "" {
+		return nil
+	}
+	data := connectionSecretData(callback.Details)
+	if len(data) == 0 {
+		return nil
+	}
+
+	secret := &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: callback.ConnectionSecret, Namespace: database.Namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       data,
+	}
+	if err := controllerutil.SetControllerReference(database, secret, h.client.Scheme()); err != nil {
+		return fmt.Errorf("failed to set owner of secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	// Create, or patch an existing Secret without reading it, so the webhook
+	// server doesn't need to watch every Secret in the cluster
+	err := h.client.Create(ctx, secret)
+	if apierrors.IsAlreadyExists(err) {
+		err = h.client.Patch(ctx, secret, client.Merge)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write connection secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
+
+// connectionSecretData returns the connection details present in a
+// callback's details as Secret data. JSON numbers, such as the port, are
+// written without a fractional part.
+func connectionSecretData(details map[string]interface{}) map[string][]byte {
+	data := map[string][]byte{}
+	for _, key := range connectionSecretKeys {
+		switch v := details[key].(type) {
+		case string:
+			if v != "" {
+				data[key] = []byte(v)
+			}
+		case float64:
+			data[key] = []byte(strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	return data
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"container/list"
+	"sync"
+)
+
+// recentCallbackCapacity is how many processed callbacks are remembered for
+// deduplication
+const recentCallbackCapacity = 4096
+
+// recentCallbacks is a bounded LRU of the deployment ID and nonce pairs of
+// recently processed callbacks
+type recentCallbacks struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+func newRecentCallbacks(capacity int) *recentCallbacks {
+	return &recentCallbacks{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// contains reports whether the callback was processed recently. Callbacks
+// without a nonce, from brokers that don't send one, are never duplicates.
+func (r *recentCallbacks) contains(deploymentID, nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	el, ok := r.entries[deploymentID+"/"+nonce]
+	if ok {
+		r.order.MoveToFront(el)
+	}
+	return ok
+}
+
+// add records a processed callback, evicting the least recently seen one
+// when full
+func (r *recentCallbacks) add(deploymentID, nonce string) {
+	if nonce == "" {
+		return
+	}
+	key := deploymentID + "/" + nonce
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if el, ok := r.entries[key]; ok {
+		r.order.MoveToFront(el)
+		return
+	}
+	r.entries[key] = r.order.PushFront(key)
+	if r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(string))
+	}
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+)
+
+// ConditionInitFailed is set on a Database whose init scripts failed
+const ConditionInitFailed = "InitFailed"
+
+// initScriptsStep is the step brokers name on the failure callback when a
+// database's init scripts fail
+const initScriptsStep = "init-scripts"
+
+// CallbackHandler applies a broker callback to the resource it reports on.
+// Returning an error wrapping errUnauthorized rejects the callback's token.
+type CallbackHandler interface {
+	Handle(ctx context.Context, callback CallbackRequest) error
+}
+
+// callbackAuthenticator is implemented by handlers that can check a
+// callback's token before handling it. The server only answers a repeated
+// callback from its deduplication cache once the callback is authenticated;
+// callbacks to other handlers that carry only a token are always handled.
+type callbackAuthenticator interface {
+	Authenticate(ctx context.Context, callback CallbackRequest) error
+}
+
+// CallbackHandlerFunc adapts a function to a CallbackHandler
+type CallbackHandlerFunc func(ctx context.Context, callback CallbackRequest) error
+
+// Handle calls f(ctx, callback)
+func (f CallbackHandlerFunc) Handle(ctx context.Context, callback CallbackRequest) error {
+	return f(ctx, callback)
+}
+
+// RegisterCallbackHandler routes callbacks for a resource type to handler,
+// replacing any handler already registered for it. Resource types are
+// normalized, so "Database" and "database" share a handler.
+func (s *Server) RegisterCallbackHandler(resourceType string, handler CallbackHandler) {
+	s.handlers[platformv1.NormalizeResourceType(resourceType)] = handler
+}
+
+// UnregisterCallbackHandler stops routing callbacks for a resource type, for
+// a manager that doesn't run its controller. Callbacks for it are deferred
+// rather than rejected, so the broker retries them once it is enabled again.
+func (s *Server) UnregisterCallbackHandler(resourceType string) {
+	delete(s.handlers, platformv1.NormalizeResourceType(resourceType))
+}
+
+// knownResourceType reports whether the platform defines resourceType,
+// whether or not a handler is registered for it
+func knownResourceType(resourceType string) bool {
+	return slices.Contains(platformv1.ResourceTypes, platformv1.NormalizeResourceType(resourceType))
+}
+
+// callbackHandler returns the handler registered for a resource type
+func (s *Server) callbackHandler(resourceType string) (CallbackHandler, bool) {
+	handler, ok := s.handlers[platformv1.NormalizeResourceType(resourceType)]
+	return handler, ok
+}
+
+// databaseCallbackHandler updates the Database CR a callback reports on
+type databaseCallbackHandler struct {
+	client client.Client
+}
+
+// database returns the Database CR the callback reports on, checking the
+// callback's token against it
+func (h databaseCallbackHandler) database(ctx context.Context, callback CallbackRequest) (*platformv1.Database, error) {
+	// Find the Database CR by deploymentId
+	// We need to list all databases and find the one with matching deploymentId
+	var dbList platformv1.DatabaseList
+	if err := h.client.List(ctx, &dbList, client.InNamespace(callback.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	var database *platformv1.Database
+	for i := range dbList.Items {
+		if dbList.Items[i].Status.DeploymentID == callback.DeploymentID {
+			database = &dbList.Items[i]
+			break
+		}
+	}
+
+	if database == nil {
+		return nil, fmt.Errorf("database not found for deploymentId: %s", callback.DeploymentID)
+	}
+
+	if err := verifyCallbackToken(callback.Token, database.Status.CallbackTokenHash, database.Status.CallbackTokenExpiry); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthorized, err)
+	}
+	return database, nil
+}
+
+// Authenticate checks the callback's token against its Database
+func (h databaseCallbackHandler) Authenticate(ctx context.Context, callback CallbackRequest) error {
+	_, err := h.database(ctx, callback)
+	return err
+}
+
+// Handle updates the Database CR based on the callback
+func (h databaseCallbackHandler) Handle(ctx context.Context, callback CallbackRequest) error {
+	database, err := h.database(ctx, callback)
+	if err != nil {
+		return err
+	}
+
+	// A callback arriving after deletion started must not bring the Database
+	// back to Ready while its finalizer deprovisions it
+	if !database.DeletionTimestamp.IsZero() {
+		return h.recordCallbackDuringDeletion(ctx, database, callback)
+	}
+
+	// Update the database status
+	firstReady := callback.Phase == "Ready" && !hasBeenReady(&database.Status)
+	database.Status.SetPhase(callback.Phase, transitionReason(callback))
+
+	// Update resource details if provided
+	if callback.Status == "success" && callback.Phase == "Ready" {
+		database.Status.Endpoint = callback.Endpoint
+		database.Status.Port = callback.Port
+		// Brokers that don't report a region leave the broker's own
+		if callback.Region != "" {
+			database.Status.Region = callback.Region
+		}
+
+		// Set connection secret reference, creating the Secret from the
+		// callback's details if the broker sent the credentials
+		if err := h.ensureConnectionSecret(ctx, database, callback); err != nil {
+			return err
+		}
+		if callback.ConnectionSecret != "" {
+			database.Status.ConnectionSecretRef = &platformv1.SecretReference{
+				Name:      callback.ConnectionSecret,
+				Namespace: callback.Namespace,
+			}
+		}
+
+		// Brokers that don't report the applied spec leave the last known values
+		if callback.AppliedSpec != nil {
+			applyGuardrails(&database.Status, callback.AppliedSpec)
+		}
+	}
+	if conditions := readyConditions(callback); conditions != nil {
+		database.Status.Conditions = conditions
+	}
+	if step, _ := callback.Details["step"].(string); callback.Status == "failed" && step == initScriptsStep {
+		meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+			Type:               ConditionInitFailed,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.NewTime(callback.Time),
+			Reason:             "InitScriptFailed",
+			Message:            callback.Error,
+		})
+	}
+
+	// Update the status
+	if err := h.client.Status().Update(ctx, database); err != nil {
+		return fmt.Errorf("failed to update database status: %w", err)
+	}
+	if firstReady {
+		metrics.DatabaseReady(database.CreationTimestamp.Time)
+	}
+
+	log.Printf("Updated database %s/%s: phase=%s, status=%s",
+		database.Namespace, database.Name, database.Status.Phase, callback.Status)
+
+	return nil
+}
+
+// recordCallbackDuringDeletion leaves a deleting Database's phase and
+// connection details alone. A late terminal callback is noted on the Ready
+// condition so it isn't lost; progress callbacks are dropped.
+func (h databaseCallbackHandler) recordCallbackDuringDeletion(ctx context.Context, database *platformv1.Database, callback CallbackRequest) error {
+	if readyConditions(callback) == nil {
+		log.Printf("Ignoring %s callback for database %s/%s being deleted",
+			callback.Status, database.Namespace, database.Name)
+		return nil
+	}
+
+	message := callback.Message
+	if callback.Status == "failed" {
+		message = callback.Error
+	}
+	meta.SetStatusCondition(&database.Status.Conditions, metav1.Condition{
+		Type:    "Ready",
+		Status:  metav1.ConditionFalse,
+		Reason:  "Deleting",
+		Message: fmt.Sprintf("Ignored %s callback for deployment %s received during deletion: %s", callback.Status, callback.DeploymentID, message),
+	})
+	if err := h.client.Status().Update(ctx, database); err != nil {
+		return fmt.Errorf("failed to update database status: %w", err)
+	}
+
+	log.Printf("Ignored %s callback for database %s/%s being deleted",
+		callback.Status, database.Namespace, database.Name)
+	return nil
+}
+
+// cacheCallbackHandler updates the Cache CR a callback reports on
+type cacheCallbackHandler struct {
+	client client.Client
+}
+
+// cache returns the Cache CR the callback reports on, checking the callback's
+// token against it
+func (h cacheCallbackHandler) cache(ctx context.Context, callback CallbackRequest) (*platformv1.Cache, error) {
+	var cacheList platformv1.CacheList
+	if err := h.client.List(ctx, &cacheList, client.InNamespace(callback.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list caches: %w", err)
+	}
+
+	var cache *platformv1.Cache
+	for i := range cacheList.Items {
+		if cacheList.Items[i].Status.DeploymentID == callback.DeploymentID {
+			cache = &cacheList.Items[i]
+			break
+		}
+	}
+	if cache == nil {
+		return nil, fmt.Errorf("cache not found for deploymentId: %s", callback.DeploymentID)
+	}
+
+	if err := verifyCallbackToken(callback.Token, cache.Status.CallbackTokenHash, cache.Status.CallbackTokenExpiry); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthorized, err)
+	}
+	return cache, nil
+}
+
+// Authenticate checks the callback's token against its Cache
+func (h cacheCallbackHandler) Authenticate(ctx context.Context, callback CallbackRequest) error {
+	_, err := h.cache(ctx, callback)
+	return err
+}
+
+// Handle updates the Cache CR based on the callback
+func (h cacheCallbackHandler) Handle(ctx context.Context, callback CallbackRequest) error {
+	cache, err := h.cache(ctx, callback)
+	if err != nil {
+		return err
+	}
+
+	cache.Status.Phase = callback.Phase
+	if callback.Status == "success" && callback.Phase == "Ready" {
+		cache.Status.Endpoint = callback.Endpoint
+		cache.Status.Port = callback.Port
+		if callback.ConnectionSecret != "" {
+			cache.Status.ConnectionSecretRef = &platformv1.SecretReference{
+				Name:      callback.ConnectionSecret,
+				Namespace: callback.Namespace,
+			}
+		}
+	}
+	if conditions := readyConditions(callback); conditions != nil {
+		cache.Status.Conditions = conditions
+	}
+
+	if err := h.client.Status().Update(ctx, cache); err != nil {
+		return fmt.Errorf("failed to update cache status: %w", err)
+	}
+
+	log.Printf("Updated cache %s/%s: phase=%s, status=%s",
+		cache.Namespace, cache.Name, cache.Status.Phase, callback.Status)
+
+	return nil
+}
+
+// topicCallbackHandler updates the Topic CR a callback reports on
+type topicCallbackHandler struct {
+	client client.Client
+}
+
+// topic returns the Topic CR the callback reports on, checking the callback's
+// token against it
+func (h topicCallbackHandler) topic(ctx context.Context, callback CallbackRequest) (*platformv1.Topic, error) {
+	var topicList platformv1.TopicList
+	if err := h.client.List(ctx, &topicList, client.InNamespace(callback.Namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	var topic *platformv1.Topic
+	for i := range topicList.Items {
+		if topicList.Items[i].Status.DeploymentID == callback.DeploymentID {
+			topic = &topicList.Items[i]
+			break
+		}
+	}
+	if topic == nil {
+		return nil, fmt.Errorf("topic not found for deploymentId: %s", callback.DeploymentID)
+	}
+
+	if err := verifyCallbackToken(callback.Token, topic.Status.CallbackTokenHash, topic.Status.CallbackTokenExpiry); err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnauthorized, err)
+	}
+	return topic, nil
+}
+
+// Authenticate checks the callback's token against its Topic
+func (h topicCallbackHandler) Authenticate(ctx context.Context, callback CallbackRequest) error {
+	_, err := h.topic(ctx, callback)
+	return err
+}
+
+// Handle updates the Topic CR based on the callback
+func (h topicCallbackHandler) Handle(ctx context.Context, callback CallbackRequest) error {
+	topic, err := h.topic(ctx, callback)
+	if err != nil {
+		return err
+	}
+
+	topic.Status.Phase = callback.Phase
+	if callback.Status == "success" && callback.Phase == "Ready" {
+		topic.Status.Endpoint = callback.Endpoint
+		topic.Status.Port = callback.Port
+		if callback.ConnectionSecret != "" {
+			topic.Status.ConnectionSecretRef = &platformv1.SecretReference{
+				Name:      callback.ConnectionSecret,
+				Namespace: callback.Namespace,
+			}
+		}
+	}
+	if conditions := readyConditions(callback); conditions != nil {
+		topic.Status.Conditions = conditions
+	}
+
+	if err := h.client.Status().Update(ctx, topic); err != nil {
+		return fmt.Errorf("failed to update topic status: %w", err)
+	}
+
+	log.Printf("Updated topic %s/%s: phase=%s, status=%s",
+		topic.Namespace, topic.Name, topic.Status.Phase, callback.Status)
+
+	return nil
+}
@@ -20,19 +20,40 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"crypto/ed25519"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/tracing"
 )
 
+// maxCallbackBodyBytes bounds the size of a callback request body
+const maxCallbackBodyBytes = 1 << 20
+
+// resourceTypeDisabledRetryAfter is the Retry-After, in seconds, sent with
+// callbacks deferred because their resource type isn't enabled
+const resourceTypeDisabledRetryAfter = "60"
+
+// errUnauthorized marks callbacks rejected for failing authentication
+var errUnauthorized = errors.New("unauthorized callback")
+
 // CallbackRequest mirrors the broker's CallbackRequest structure
 type CallbackRequest struct {
 	DeploymentID         string                 `json:"deploymentId"`
@@ -47,51 +68,139 @@ type CallbackRequest struct {
 	Endpoint             string                 `json:"endpoint,omitempty"`
 	Port                 int32                  `json:"port,omitempty"`
 	ConnectionSecret     string                 `json:"connectionSecret,omitempty"`
+	Region               string                 `json:"region,omitempty"`
 	Details              map[string]interface{} `json:"details,omitempty"`
 	AdditionalMetadata   map[string]string      `json:"additionalMetadata,omitempty"`
 	EstimatedMonthlyCost float64                `json:"estimatedMonthlyCost,omitempty"`
+	AppliedSpec          map[string]interface{} `json:"appliedSpec,omitempty"`
+	Nonce                string                 `json:"nonce,omitempty"`
+	Logs                 string                 `json:"logs,omitempty"`
+
+	// Token is the callback token presented in the request headers. It
+	// isn't part of the body the broker signs.
+	Token string `json:"-"`
 }
 
 // Server handles webhook callbacks from the broker
 type Server struct {
-	client client.Client
-	port   int
+	client          client.Client
+	clusterReader   client.Reader
+	port            int
+	registry        *brokerregistry.Registry
+	brokerNamespace string
+	seen            *recentCallbacks
+	handlers        map[string]CallbackHandler
+	shutdownTimeout time.Duration
 }
 
-// NewServer creates a new webhook server
+// DefaultShutdownTimeout is how long in-flight callbacks get to finish when
+// the server shuts down, matching the broker's default
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultBrokerNamespace is where signed callbacks' Broker CRs are looked up
+// when the broker doesn't send X-KIDP-Broker-Namespace
+const DefaultBrokerNamespace = "default"
+
+// NewServer creates a new webhook server with handlers registered for
+// database, cache and topic callbacks
 func NewServer(client client.Client, port int) *Server {
-	return &Server{
-		client: client,
-		port:   port,
+	s := &Server{
+		client:          client,
+		port:            port,
+		brokerNamespace: DefaultBrokerNamespace,
+		seen:            newRecentCallbacks(recentCallbackCapacity),
+		handlers:        map[string]CallbackHandler{},
+		shutdownTimeout: DefaultShutdownTimeout,
 	}
+	s.RegisterCallbackHandler(platformv1.ResourceTypeDatabase, databaseCallbackHandler{client: client})
+	s.RegisterCallbackHandler(platformv1.ResourceTypeCache, cacheCallbackHandler{client: client})
+	s.RegisterCallbackHandler(platformv1.ResourceTypeTopic, topicCallbackHandler{client: client})
+	return s
+}
+
+// SetBrokerNamespace sets the namespace Broker CRs are looked up in when a
+// signed callback doesn't name one
+func (s *Server) SetBrokerNamespace(namespace string) {
+	s.brokerNamespace = namespace
+}
+
+// SetShutdownTimeout sets how long in-flight callbacks get to finish when the
+// server shuts down before they are aborted
+func (s *Server) SetShutdownTimeout(timeout time.Duration) {
+	s.shutdownTimeout = timeout
+}
+
+// SetBrokerRegistry sets the registry whose capacity reservations are
+// released when a deployment's final callback arrives. A nil registry
+// disables this.
+func (s *Server) SetBrokerRegistry(registry *brokerregistry.Registry) {
+	s.registry = registry
+}
+
+// SetClusterReader sets the reader the status summary lists resources with,
+// for a manager whose cache holds only some namespaces. A nil reader uses the
+// server's client.
+func (s *Server) SetClusterReader(reader client.Reader) {
+	s.clusterReader = reader
 }
 
-// Start starts the webhook server
+// Start starts the webhook server and blocks until ctx is cancelled and the
+// server has shut down
 func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on :%d: %w", s.port, err)
+	}
+	log.Printf("Webhook server listening on :%d", s.port)
+	return s.serve(ctx, listener)
+}
+
+// serve handles requests on listener until ctx is cancelled. Shutting down
+// stops accepting requests and waits up to the shutdown timeout for in-flight
+// callbacks to finish their status writes. Callbacks still running after
+// that have their context cancelled, and serve waits for them to abort, so
+// nothing is left writing to the API server once it returns.
+func (s *Server) serve(ctx context.Context, listener net.Listener) error {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/v1/callback", s.handleCallback)
+	mux.HandleFunc("/v1/summary", s.handleSummary)
 	mux.HandleFunc("/health", s.handleHealth)
 
+	// Requests don't inherit ctx's cancellation, so shutting down doesn't
+	// interrupt a callback halfway through updating a resource
+	requestCtx, abortRequests := context.WithCancel(context.WithoutCancel(ctx))
+	defer abortRequests()
+
+	var inFlight sync.WaitGroup
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: mux,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Add(1)
+			defer inFlight.Done()
+			mux.ServeHTTP(w, r)
+		}),
+		BaseContext: func(net.Listener) context.Context { return requestCtx },
 	}
 
-	// Start server in goroutine
+	serveErr := make(chan error, 1)
 	go func() {
-		log.Printf("Webhook server listening on :%d", s.port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("Webhook server error: %v", err)
-		}
+		serveErr <- server.Serve(listener)
 	}()
 
-	// Wait for context cancellation
-	<-ctx.Done()
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("webhook server stopped: %w", err)
+	case <-ctx.Done():
+	}
 
-	// Shutdown gracefully
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
 	defer cancel()
-	return server.Shutdown(shutdownCtx)
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("In-flight callbacks still running after %v, aborting them", s.shutdownTimeout)
+		abortRequests()
+	}
+	inFlight.Wait()
+	return err
 }
 
 // handleCallback processes callbacks from the broker
@@ -101,172 +210,309 @@ func (s *Server) handleCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Read full body for signature verification
+	ctx, span := tracing.StartServerSpan(r, "webhook.callback")
+	defer span.End()
+	metrics.CallbackReceived()
+
+	// Read full body for signature verification: the signature covers the
+	// bytes the broker sent, which re-encoding the decoded struct wouldn't
+	// reproduce if the broker sends fields this manager doesn't know
+	rawBody, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBodyBytes))
+	if err != nil {
+		log.Printf("Failed to read callback: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// A callback is authenticated by the broker's signature, the deployment's
+	// callback token, or both. The token is checked once the deployment is found.
+	brokerName := r.Header.Get("X-KIDP-Broker-Name")
+	timestamp := r.Header.Get("X-KIDP-Timestamp")
+	signature := r.Header.Get("X-KIDP-Signature")
+	token := r.Header.Get(callbacktoken.Header)
+
+	signed := brokerName != "" || timestamp != "" || signature != "" || token == ""
+	if signed {
+		if !s.verifyBrokerSignature(ctx, w, r, rawBody) {
+			return
+		}
+	}
+
 	var callback CallbackRequest
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&callback); err != nil {
+	if err := json.Unmarshal(rawBody, &callback); err != nil {
 		log.Printf("Failed to decode callback: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	callback.Token = token
+
+	log.Printf("Received callback: deploymentId=%s, resourceType=%s, status=%s, phase=%s",
+		callback.DeploymentID, callback.ResourceType, callback.Status, callback.Phase)
+	span.SetAttributes(
+		attribute.String("kidp.deployment_id", callback.DeploymentID),
+		attribute.String("kidp.callback_status", callback.Status),
+	)
+
+	// Route to the handler registered for the resource type
+	handler, ok := s.callbackHandler(callback.ResourceType)
+	if !ok && knownResourceType(callback.ResourceType) {
+		// The broker retries 5xx responses, so the callback is delivered
+		// once handling for the type is enabled
+		log.Printf("Deferring callback for deployment %s: %s callbacks aren't enabled on this manager",
+			callback.DeploymentID, callback.ResourceType)
+		w.Header().Set("Retry-After", resourceTypeDisabledRetryAfter)
+		http.Error(w, "Resource type not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	if !ok {
+		// No retry will make an unknown type acceptable
+		log.Printf("Rejecting callback for deployment %s: unknown resource type %q",
+			callback.DeploymentID, callback.ResourceType)
+		http.Error(w, "Unknown resource type", http.StatusUnprocessableEntity)
+		return
+	}
+
+	// A callback carrying only a token is authenticated before the
+	// deduplication cache is consulted, so the cache's answer doesn't tell an
+	// unauthenticated caller which callbacks were processed
+	authenticated := signed
+	if authenticator, ok := handler.(callbackAuthenticator); ok && !authenticated {
+		if err := authenticator.Authenticate(ctx, callback); err != nil {
+			writeCallbackError(w, span, callback, err)
+			return
+		}
+		authenticated = true
+	}
+
+	// A broker retrying an update we already processed gets the same answer
+	// without the update being applied twice
+	if authenticated && s.seen.contains(callback.DeploymentID, callback.Nonce) {
+		log.Printf("Ignoring duplicate callback: deploymentId=%s, nonce=%s", callback.DeploymentID, callback.Nonce)
+		writeAccepted(w)
+		return
+	}
+
+	if err := handler.Handle(ctx, callback); err != nil {
+		writeCallbackError(w, span, callback, err)
+		return
+	}
+
+	s.seen.add(callback.DeploymentID, callback.Nonce)
+
+	// The deployment no longer holds a slot on its broker once it finishes
+	if s.registry != nil && (callback.Status == "success" || callback.Status == "failed") {
+		s.registry.Release(callback.DeploymentID)
+	}
+
+	writeAccepted(w)
+}
+
+// writeCallbackError answers a callback its handler failed, with 401 for a
+// rejected token
+func writeCallbackError(w http.ResponseWriter, span trace.Span, callback CallbackRequest, err error) {
+	span.SetStatus(codes.Error, err.Error())
+	if errors.Is(err, errUnauthorized) {
+		log.Printf("Rejected callback for deployment %s: %v", callback.DeploymentID, err)
+		metrics.CallbackRejected(metrics.CallbackRejectedBadToken)
+		http.Error(w, "Invalid callback token", http.StatusUnauthorized)
+		return
+	}
+	log.Printf("Failed to process callback: %v", err)
+	http.Error(w, "Failed to process callback", http.StatusInternalServerError)
+}
+
+// writeAccepted acknowledges a callback
+func writeAccepted(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"status": "accepted",
+	}); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
 
-	// Verify signature headers: Broker-Name, Timestamp, Signature
+// verifyBrokerSignature checks the broker-wide Ed25519 signature on a
+// callback, writing an error response and returning false if it is invalid
+func (s *Server) verifyBrokerSignature(ctx context.Context, w http.ResponseWriter, r *http.Request, rawBody []byte) bool {
 	brokerName := r.Header.Get("X-KIDP-Broker-Name")
 	timestamp := r.Header.Get("X-KIDP-Timestamp")
 	signature := r.Header.Get("X-KIDP-Signature")
 
 	if brokerName == "" || timestamp == "" || signature == "" {
 		log.Printf("Missing signature headers: broker=%s timestamp=%s signature=%s", brokerName, timestamp, signature)
+		metrics.CallbackRejected(metrics.CallbackRejectedMissingHeaders)
 		http.Error(w, "Missing signature headers", http.StatusUnauthorized)
-		return
+		return false
 	}
 
 	// Replay protection: allow small skew (5m)
 	ts, terr := time.Parse(time.RFC3339, timestamp)
 	if terr != nil {
 		log.Printf("Invalid timestamp header: %v", terr)
+		metrics.CallbackRejected(metrics.CallbackRejectedBadTimestamp)
 		http.Error(w, "Invalid timestamp", http.StatusBadRequest)
-		return
+		return false
 	}
 	if time.Since(ts) > 5*time.Minute || time.Until(ts) > 1*time.Minute {
 		log.Printf("Timestamp outside allowed skew: %v", ts)
+		metrics.CallbackRejected(metrics.CallbackRejectedReplay)
 		http.Error(w, "Timestamp outside allowed range", http.StatusUnauthorized)
-		return
+		return false
 	}
 
 	// Lookup Broker CR by name to get stored public key
+	brokerNamespace := r.Header.Get("X-KIDP-Broker-Namespace")
+	if brokerNamespace == "" {
+		brokerNamespace = s.brokerNamespace
+	}
 	var brokerCR platformv1.Broker
-	if getErr := s.client.Get(r.Context(), client.ObjectKey{Namespace: "default", Name: brokerName}, &brokerCR); getErr != nil {
-		log.Printf("Failed to get Broker CR for %s: %v", brokerName, getErr)
+	if getErr := s.client.Get(ctx, client.ObjectKey{Namespace: brokerNamespace, Name: brokerName}, &brokerCR); getErr != nil {
+		log.Printf("Failed to get Broker CR %s/%s: %v", brokerNamespace, brokerName, getErr)
+		metrics.CallbackRejected(metrics.CallbackRejectedUnknownBroker)
 		http.Error(w, "Unknown broker", http.StatusUnauthorized)
-		return
+		return false
 	}
 
-	pubB64 := brokerCR.Status.CallbackPublicKey
-	if pubB64 == "" {
+	keys := brokerCR.Status.CallbackKeys()
+	if len(keys) == 0 {
 		// Accept public key from header only if CR doesn't have one (initial registration)
-		pubB64 = r.Header.Get("X-KIDP-Public-Key")
+		pubB64 := r.Header.Get("X-KIDP-Public-Key")
 		if pubB64 == "" {
 			log.Printf("No public key available for broker %s", brokerName)
+			metrics.CallbackRejected(metrics.CallbackRejectedBadSignature)
 			http.Error(w, "No public key available", http.StatusUnauthorized)
-			return
+			return false
 		}
 		// Optionally, persist this key to the Broker CR (left as future work)
+		keys = []string{pubB64}
 	}
 
-	// Reconstruct the raw body for verification: we need the original JSON bytes.
-	// Since we've already decoded into struct, re-marshal to get deterministic bytes.
-	rawBody, mErr := json.Marshal(callback)
-	if mErr != nil {
-		log.Printf("Failed to re-marshal callback for verification: %v", mErr)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
-
-	if ok, vErr := verifySignature(rawBody, timestamp, signature, pubB64); !ok {
+	if vErr := verifyWithKeys(rawBody, timestamp, signature, r.Header.Get("X-KIDP-Key-ID"), keys); vErr != nil {
 		log.Printf("Signature verification failed for broker %s: %v", brokerName, vErr)
+		metrics.CallbackRejected(metrics.CallbackRejectedBadSignature)
 		http.Error(w, "Invalid signature", http.StatusUnauthorized)
-		return
+		return false
 	}
 
-	log.Printf("Received callback: deploymentId=%s, resourceType=%s, status=%s, phase=%s",
-		callback.DeploymentID, callback.ResourceType, callback.Status, callback.Phase)
+	metrics.CallbackVerified()
+	return true
+}
 
-	// Route to appropriate handler based on resource type
-	var err error
-	switch callback.ResourceType {
-	case "database":
-		err = s.handleDatabaseCallback(r.Context(), callback)
-	default:
-		log.Printf("Unknown resource type: %s", callback.ResourceType)
-		http.Error(w, "Unknown resource type", http.StatusBadRequest)
-		return
+// verifyWithKeys verifies a signature against each of a broker's accepted
+// public keys, trying the one keyID names first, so callbacks signed with a
+// key being rotated out still verify
+func verifyWithKeys(body []byte, timestamp, signatureB64, keyID string, keys []string) error {
+	ordered := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if keyID != "" && platformv1.CallbackKeyID(key) == keyID {
+			ordered = append([]string{key}, ordered...)
+		} else {
+			ordered = append(ordered, key)
+		}
 	}
-
-	if err != nil {
-		log.Printf("Failed to process callback: %v", err)
-		http.Error(w, "Failed to process callback", http.StatusInternalServerError)
-		return
+	var lastErr error
+	for _, key := range ordered {
+		ok, err := verifySignature(body, timestamp, signatureB64, key)
+		if ok {
+			return nil
+		}
+		lastErr = err
 	}
+	return fmt.Errorf("no accepted key verified the signature (tried %d): %w", len(keys), lastErr)
+}
 
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(map[string]string{
-		"status": "accepted",
-	}); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+// readyConditions returns the Ready condition for a callback that finished
+// provisioning, successfully or not, and nil for progress callbacks. A failed
+// Ready condition points at the broker's logs of the deployment when the
+// callback carries them.
+func readyConditions(callback CallbackRequest) []metav1.Condition {
+	now := metav1.NewTime(callback.Time)
+	switch {
+	case callback.Status == "success" && callback.Phase == "Ready":
+		return []metav1.Condition{{
+			Type:               "Ready",
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: now,
+			Reason:             "ProvisioningSucceeded",
+			Message:            callback.Message,
+		}}
+	case callback.Status == "failed":
+		message := callback.Error
+		if callback.Logs != "" {
+			message = fmt.Sprintf("%s (broker logs: %s)", message, callback.Logs)
+		}
+		return []metav1.Condition{{
+			Type:               "Ready",
+			Status:             metav1.ConditionFalse,
+			LastTransitionTime: now,
+			Reason:             "ProvisioningFailed",
+			Message:            message,
+		}}
 	}
+	return nil
 }
 
-// handleDatabaseCallback updates the Database CR based on the callback
-func (s *Server) handleDatabaseCallback(ctx context.Context, callback CallbackRequest) error {
-	// Find the Database CR by deploymentId
-	// We need to list all databases and find the one with matching deploymentId
-	var dbList platformv1.DatabaseList
-	if err := s.client.List(ctx, &dbList, client.InNamespace(callback.Namespace)); err != nil {
-		return fmt.Errorf("failed to list databases: %w", err)
+// transitionReason is the reason recorded for a phase change a callback
+// causes: the Ready condition's reason for terminal callbacks, otherwise
+// BrokerProgress
+func transitionReason(callback CallbackRequest) string {
+	if conditions := readyConditions(callback); len(conditions) > 0 {
+		return conditions[0].Reason
 	}
+	return "BrokerProgress"
+}
 
-	var database *platformv1.Database
-	for i := range dbList.Items {
-		if dbList.Items[i].Status.DeploymentID == callback.DeploymentID {
-			database = &dbList.Items[i]
-			break
+// hasBeenReady reports whether a Database has reached Ready before, so only
+// its first Ready counts towards time-to-Ready. Transitions are trimmed, so
+// an endpoint left by an earlier Ready callback counts too.
+func hasBeenReady(status *platformv1.DatabaseStatus) bool {
+	if status.Phase == "Ready" {
+		return true
+	}
+	for _, transition := range status.Transitions {
+		if transition.To == "Ready" {
+			return true
 		}
 	}
+	return status.Endpoint != ""
+}
 
-	if database == nil {
-		return fmt.Errorf("database not found for deploymentId: %s", callback.DeploymentID)
+// applyGuardrails records the connection limit, statement timeout and
+// read-only mode the broker applied. The controller compares them with the spec to decide
+// whether to reconfigure.
+func applyGuardrails(status *platformv1.DatabaseStatus, spec map[string]interface{}) {
+	status.ConnectionLimit = nil
+	if limit, ok := spec["connectionLimit"].(float64); ok {
+		l := int32(limit)
+		status.ConnectionLimit = &l
 	}
-
-	// Update the database status
-	database.Status.Phase = callback.Phase
-
-	// Update resource details if provided
-	if callback.Status == "success" && callback.Phase == "Ready" {
-		database.Status.Endpoint = callback.Endpoint
-		database.Status.Port = callback.Port
-
-		// Set connection secret reference
-		if callback.ConnectionSecret != "" {
-			database.Status.ConnectionSecretRef = &platformv1.SecretReference{
-				Name:      callback.ConnectionSecret,
-				Namespace: callback.Namespace,
-			}
+	status.StatementTimeout = nil
+	if s, ok := spec["statementTimeout"].(string); ok {
+		if timeout, err := time.ParseDuration(s); err == nil {
+			status.StatementTimeout = &metav1.Duration{Duration: timeout}
+		} else {
+			log.Printf("Ignoring unparseable applied statementTimeout %q: %v", s, err)
 		}
+	}
+	readOnly, _ := spec["readOnly"].(bool)
+	status.ReadOnly = readOnly
+}
 
-		// Set conditions
-		now := metav1.NewTime(callback.Time)
-		database.Status.Conditions = []metav1.Condition{
-			{
-				Type:               "Ready",
-				Status:             metav1.ConditionTrue,
-				LastTransitionTime: now,
-				Reason:             "ProvisioningSucceeded",
-				Message:            callback.Message,
-			},
-		}
-	} else if callback.Status == "failed" {
-		now := metav1.NewTime(callback.Time)
-		database.Status.Conditions = []metav1.Condition{
-			{
-				Type:               "Ready",
-				Status:             metav1.ConditionFalse,
-				LastTransitionTime: now,
-				Reason:             "ProvisioningFailed",
-				Message:            callback.Error,
-			},
+// verifyCallbackToken checks the token presented on a callback against the one
+// issued for the deployment. Deployments provisioned before tokens were issued
+// have no hash and rely on the broker signature alone.
+func verifyCallbackToken(token, hash string, expiry *metav1.Time) error {
+	if hash == "" {
+		if token != "" {
+			return callbacktoken.ErrInvalid
 		}
+		return nil
 	}
-
-	// Update the status
-	if err := s.client.Status().Update(ctx, database); err != nil {
-		return fmt.Errorf("failed to update database status: %w", err)
+	var expires time.Time
+	if expiry != nil {
+		expires = expiry.Time
 	}
-
-	log.Printf("Updated database %s/%s: phase=%s, status=%s",
-		database.Namespace, database.Name, database.Status.Phase, callback.Status)
-
-	return nil
+	return callbacktoken.Verify(token, hash, expires, time.Now())
 }
 
 // verifySignature verifies an Ed25519 signature. signatureB64 and pubKeyB64 are base64 encoded.
@@ -0,0 +1,1068 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/internal/metrics"
+	"github.com/aykay76/kidp/pkg/brokerregistry"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+)
+
+const readyCallback = `{"deploymentId":"deploy-1","resourceType":"database","resourceName":"db1","namespace":"dev",` +
+	`"status":"success","phase":"Ready","message":"ready","time":"2025-10-01T12:00:00Z","endpoint":"db1.dev.svc"}`
+
+// newTokenTestServer returns a server with one Database provisioned under
+// deploy-1, issued the given token hash and expiry
+func newTokenTestServer(t *testing.T, hash string, expires time.Time) (*Server, client.Client) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"}}
+	db.Status.Phase = "Provisioning"
+	db.Status.DeploymentID = "deploy-1"
+	db.Status.CallbackTokenHash = hash
+	if !expires.IsZero() {
+		e := metav1.NewTime(expires)
+		db.Status.CallbackTokenExpiry = &e
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).WithStatusSubresource(db).Build()
+	return NewServer(cl, 0), cl
+}
+
+func postCallback(s *Server, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(readyCallback))
+	if token != "" {
+		req.Header.Set(callbacktoken.Header, token)
+	}
+	rec := httptest.NewRecorder()
+	s.handleCallback(rec, req)
+	return rec
+}
+
+func TestHandleCallback_CallbackToken(t *testing.T) {
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, _ := callbacktoken.Issue(time.Now(), time.Hour)
+
+	tests := []struct {
+		name    string
+		hash    string
+		expires time.Time
+		token   string
+		want    int
+	}{
+		{"valid token", issued.Hash, issued.Expires, issued.Token, http.StatusOK},
+		{"forged token", issued.Hash, issued.Expires, "forged", http.StatusUnauthorized},
+		{"another deployment's token", issued.Hash, issued.Expires, other.Token, http.StatusUnauthorized},
+		{"expired token", issued.Hash, time.Now().Add(-time.Minute), issued.Token, http.StatusUnauthorized},
+		{"no credentials", issued.Hash, issued.Expires, "", http.StatusUnauthorized},
+		{"token for a deployment issued none", "", time.Time{}, issued.Token, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cl := newTokenTestServer(t, tt.hash, tt.expires)
+
+			rec := postCallback(s, tt.token)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, out); err != nil {
+				t.Fatalf("failed to get db: %v", err)
+			}
+			wantPhase := "Provisioning"
+			if tt.want == http.StatusOK {
+				wantPhase = "Ready"
+			}
+			if out.Status.Phase != wantPhase {
+				t.Fatalf("expected phase %s after callback, got %s", wantPhase, out.Status.Phase)
+			}
+		})
+	}
+}
+
+func TestHandleCallback_ResourceTypeCasing(t *testing.T) {
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, resourceType := range []string{"database", "Database", " DATABASE "} {
+		t.Run(resourceType, func(t *testing.T) {
+			s, cl := newTokenTestServer(t, issued.Hash, issued.Expires)
+			body := strings.Replace(readyCallback, `"resourceType":"database"`, `"resourceType":"`+resourceType+`"`, 1)
+			req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(body))
+			req.Header.Set(callbacktoken.Header, issued.Token)
+			rec := httptest.NewRecorder()
+			s.handleCallback(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected %q to route to the database handler, got %d: %s", resourceType, rec.Code, rec.Body.String())
+			}
+
+			var db platformv1.Database
+			if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+				t.Fatal(err)
+			}
+			if db.Status.Phase != "Ready" {
+				t.Fatalf("expected the database to be Ready, got %s", db.Status.Phase)
+			}
+		})
+	}
+}
+
+func TestHandleCallback_RegisteredHandler(t *testing.T) {
+	s, _ := newTokenTestServer(t, "", time.Time{})
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []CallbackRequest
+	s.RegisterCallbackHandler("Queue", CallbackHandlerFunc(func(ctx context.Context, callback CallbackRequest) error {
+		got = append(got, callback)
+		return nil
+	}))
+
+	body := `{"deploymentId":"deploy-9","resourceType":"queue","namespace":"dev","status":"success","phase":"Ready"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(body))
+	req.Header.Set(callbacktoken.Header, issued.Token)
+	rec := httptest.NewRecorder()
+	s.handleCallback(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(got) != 1 || got[0].DeploymentID != "deploy-9" || got[0].Token != issued.Token {
+		t.Fatalf("expected the queue handler to receive the callback and its token, got %+v", got)
+	}
+
+	// Unregistered types are still rejected
+	req = httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(strings.Replace(body, "queue", "bucket", 1)))
+	req.Header.Set(callbacktoken.Header, issued.Token)
+	rec = httptest.NewRecorder()
+	s.handleCallback(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for an unregistered resource type, got %d", rec.Code)
+	}
+}
+
+func TestHandleCallback_UnsupportedResourceTypes(t *testing.T) {
+	s, _ := newTokenTestServer(t, "", time.Time{})
+	s.UnregisterCallbackHandler(platformv1.ResourceTypeCache)
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		resourceType   string
+		wantCode       int
+		wantRetryAfter string
+	}{
+		// A type this manager has never heard of won't become acceptable,
+		// so the broker must not retry it
+		{name: "unknown type", resourceType: "bucket", wantCode: http.StatusUnprocessableEntity},
+		// A known type whose handling is off is worth retrying
+		{name: "known type not enabled", resourceType: "Cache", wantCode: http.StatusServiceUnavailable, wantRetryAfter: "60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"deploymentId":"deploy-9","resourceType":"` + tt.resourceType + `","namespace":"dev","status":"success","phase":"Ready"}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(body))
+			req.Header.Set(callbacktoken.Header, issued.Token)
+			rec := httptest.NewRecorder()
+			s.handleCallback(rec, req)
+			if rec.Code != tt.wantCode || rec.Header().Get("Retry-After") != tt.wantRetryAfter {
+				t.Fatalf("expected %d with Retry-After %q, got %d with %q: %s",
+					tt.wantCode, tt.wantRetryAfter, rec.Code, rec.Header().Get("Retry-After"), rec.Body)
+			}
+		})
+	}
+}
+
+func TestHandleDatabaseCallback_RecordsAppliedGuardrails(t *testing.T) {
+	_, cl := newTokenTestServer(t, "", time.Time{})
+	handler := databaseCallbackHandler{client: cl}
+
+	callback := CallbackRequest{
+		DeploymentID: "deploy-1",
+		Namespace:    "dev",
+		Status:       "success",
+		Phase:        "Ready",
+		Time:         time.Now(),
+		// JSON numbers decode as float64
+		AppliedSpec: map[string]interface{}{"engine": "postgresql", "connectionLimit": float64(200), "statementTimeout": "30s"},
+	}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var db platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.ConnectionLimit == nil || *db.Status.ConnectionLimit != 200 {
+		t.Fatalf("expected applied connection limit 200, got %v", db.Status.ConnectionLimit)
+	}
+	if db.Status.StatementTimeout == nil || db.Status.StatementTimeout.Duration != 30*time.Second {
+		t.Fatalf("expected applied statement timeout 30s, got %v", db.Status.StatementTimeout)
+	}
+
+	// Removing a guardrail from the spec clears it once the broker applies that
+	callback.AppliedSpec = map[string]interface{}{"engine": "postgresql", "statementTimeout": "30s"}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.ConnectionLimit != nil {
+		t.Fatalf("expected connection limit to be cleared, got %d", *db.Status.ConnectionLimit)
+	}
+
+	callback.AppliedSpec = map[string]interface{}{"engine": "postgresql", "readOnly": true}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if !db.Status.ReadOnly {
+		t.Fatal("expected the database to be recorded as read-only")
+	}
+}
+
+func TestHandleDatabaseCallback_RecordsPhaseTransitions(t *testing.T) {
+	_, cl := newTokenTestServer(t, "", time.Time{})
+	handler := databaseCallbackHandler{client: cl}
+
+	callbacks := []CallbackRequest{
+		{Status: "in-progress", Phase: "Provisioning"},
+		{Status: "success", Phase: "Ready"},
+		{Status: "failed", Phase: "Failed", Error: "disk lost"},
+	}
+	for _, callback := range callbacks {
+		callback.DeploymentID = "deploy-1"
+		callback.Namespace = "dev"
+		callback.Time = time.Now()
+		if err := handler.Handle(context.Background(), callback); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	var db platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	// The progress callback doesn't change the phase, so records nothing
+	want := []platformv1.PhaseTransition{
+		{From: "Provisioning", To: "Ready", Reason: "ProvisioningSucceeded"},
+		{From: "Ready", To: "Failed", Reason: "ProvisioningFailed"},
+	}
+	if len(db.Status.Transitions) != len(want) {
+		t.Fatalf("expected %d transitions, got %+v", len(want), db.Status.Transitions)
+	}
+	for i, got := range db.Status.Transitions {
+		if got.From != want[i].From || got.To != want[i].To || got.Reason != want[i].Reason {
+			t.Fatalf("transition %d: expected %+v, got %+v", i, want[i], got)
+		}
+		if got.Timestamp.IsZero() {
+			t.Fatalf("transition %d has no timestamp", i)
+		}
+	}
+}
+
+func TestHandleDatabaseCallback_InitScriptsFailed(t *testing.T) {
+	_, cl := newTokenTestServer(t, "", time.Time{})
+	handler := databaseCallbackHandler{client: cl}
+
+	callback := CallbackRequest{
+		DeploymentID: "deploy-1",
+		Namespace:    "dev",
+		Status:       "failed",
+		Phase:        "Failed",
+		Error:        "init scripts job team-a/db1-init failed (BackoffLimitExceeded): Job has reached the specified backoff limit",
+		Time:         time.Now(),
+		Details:      map[string]interface{}{"step": "init-scripts"},
+	}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var db platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.Phase != "Failed" || meta.IsStatusConditionTrue(db.Status.Conditions, "Ready") {
+		t.Fatalf("expected the database to fail rather than become Ready, got %+v", db.Status)
+	}
+	cond := meta.FindStatusCondition(db.Status.Conditions, ConditionInitFailed)
+	if cond == nil || cond.Status != metav1.ConditionTrue || !strings.Contains(cond.Message, "db1-init") {
+		t.Fatalf("expected an InitFailed condition carrying the error, got %+v", cond)
+	}
+
+	// Other failures don't blame the init scripts
+	callback.Details = map[string]interface{}{"step": "wait-ready"}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if meta.FindStatusCondition(db.Status.Conditions, ConditionInitFailed) != nil {
+		t.Fatalf("expected no InitFailed condition for a failure in another step")
+	}
+}
+
+func TestHandleDatabaseCallback_CreatesConnectionSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1", UID: "db1-uid"}}
+	db.Status.Phase = "Provisioning"
+	db.Status.DeploymentID = "deploy-1"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).WithStatusSubresource(db).Build()
+	handler := databaseCallbackHandler{client: cl}
+
+	callback := CallbackRequest{
+		DeploymentID: "deploy-1", Namespace: "dev", Status: "success", Phase: "Ready", Time: time.Now(),
+		Endpoint: "db1.example.com", Port: 5432, ConnectionSecret: "db1-conn",
+		// JSON numbers decode as float64
+		Details: map[string]interface{}{"host": "db1.example.com", "port": float64(5432), "username": "app", "password": "s3cret"},
+	}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret := &corev1.Secret{}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1-conn"}, secret); err != nil {
+		t.Fatalf("expected the connection secret to be created: %v", err)
+	}
+	want := map[string]string{"host": "db1.example.com", "port": "5432", "username": "app", "password": "s3cret"}
+	if len(secret.Data) != len(want) {
+		t.Fatalf("expected keys %v, got %v", want, secret.Data)
+	}
+	for key, value := range want {
+		if string(secret.Data[key]) != value {
+			t.Fatalf("expected %s=%q, got %q", key, value, secret.Data[key])
+		}
+	}
+	owner := metav1.GetControllerOf(secret)
+	if owner == nil || owner.Kind != "Database" || owner.Name != "db1" || owner.UID != "db1-uid" {
+		t.Fatalf("expected the secret to be owned by the database, got %+v", secret.OwnerReferences)
+	}
+
+	// A later callback with rotated credentials updates the existing secret
+	callback.Details["password"] = "rotated"
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1-conn"}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["password"]) != "rotated" {
+		t.Fatalf("expected the password to be updated, got %q", secret.Data["password"])
+	}
+
+	var out platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.ConnectionSecretRef == nil || out.Status.ConnectionSecretRef.Name != "db1-conn" {
+		t.Fatalf("expected the connection secret to be referenced, got %+v", out.Status.ConnectionSecretRef)
+	}
+}
+
+func TestHandleDatabaseCallback_DuringDeletion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	now := metav1.Now()
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{
+		Namespace: "dev", Name: "db1", DeletionTimestamp: &now, Finalizers: []string{"platform.company.com/database-cleanup"},
+	}}
+	db.Status.Phase = "Provisioning"
+	db.Status.DeploymentID = "deploy-1"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).WithStatusSubresource(db).Build()
+	handler := databaseCallbackHandler{client: cl}
+
+	// Progress is dropped, the late success is recorded without going Ready
+	for _, callback := range []CallbackRequest{
+		{DeploymentID: "deploy-1", Namespace: "dev", Status: "in-progress", Phase: "Provisioning", Time: time.Now()},
+		{DeploymentID: "deploy-1", Namespace: "dev", Status: "success", Phase: "Ready", Message: "ready",
+			Time: time.Now(), Endpoint: "db1.dev.svc", Port: 5432, ConnectionSecret: "db1-credentials"},
+	} {
+		if err := handler.Handle(context.Background(), callback); err != nil {
+			t.Fatalf("unexpected error for %s callback: %v", callback.Status, err)
+		}
+	}
+
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.Phase != "Provisioning" || out.Status.Endpoint != "" || out.Status.ConnectionSecretRef != nil {
+		t.Fatalf("expected the deleting database's status to be left alone, got %+v", out.Status)
+	}
+	cond := meta.FindStatusCondition(out.Status.Conditions, "Ready")
+	if cond == nil || cond.Status != metav1.ConditionFalse || cond.Reason != "Deleting" || !strings.Contains(cond.Message, "success callback") {
+		t.Fatalf("expected the late callback to be recorded on a not-Ready condition, got %+v", cond)
+	}
+}
+
+func TestHandleDatabaseCallback_RecordsRegion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	tests := []struct {
+		name   string
+		region string
+		want   string
+	}{
+		{name: "broker reports its placement", region: "northeurope", want: "northeurope"},
+		{name: "broker doesn't report a region", want: "westeurope"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"}}
+			db.Status.Phase = "Provisioning"
+			db.Status.DeploymentID = "deploy-1"
+			db.Status.Region = "westeurope"
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(db).WithStatusSubresource(db).Build()
+			handler := databaseCallbackHandler{client: cl}
+
+			callback := CallbackRequest{DeploymentID: "deploy-1", Namespace: "dev", Status: "success", Phase: "Ready",
+				Time: time.Now(), Endpoint: "db1.dev.svc", Port: 5432, Region: tt.region}
+			if err := handler.Handle(context.Background(), callback); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := &platformv1.Database{}
+			if err := cl.Get(context.Background(), client.ObjectKeyFromObject(db), out); err != nil {
+				t.Fatal(err)
+			}
+			if out.Status.Region != tt.want {
+				t.Fatalf("expected region %q, got %q", tt.want, out.Status.Region)
+			}
+		})
+	}
+}
+
+func TestHandleCallback_Cache(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	cache := &platformv1.Cache{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "sessions"}}
+	cache.Status.Phase = "Provisioning"
+	cache.Status.DeploymentID = "deploy-2"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cache).WithStatusSubresource(cache).Build()
+	handler := cacheCallbackHandler{client: cl}
+
+	callback := CallbackRequest{DeploymentID: "deploy-2", Namespace: "dev", Status: "success", Phase: "Ready",
+		Time: time.Now(), Endpoint: "sessions.dev.svc", Port: 6379}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := &platformv1.Cache{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(cache), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.Phase != "Ready" || out.Status.Endpoint != "sessions.dev.svc" || out.Status.Port != 6379 {
+		t.Fatalf("expected the cache to be Ready at sessions.dev.svc:6379, got %+v", out.Status)
+	}
+}
+
+func TestHandleCallback_Topic(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	topic := &platformv1.Topic{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "orders"}}
+	topic.Status.Phase = "Provisioning"
+	topic.Status.DeploymentID = "deploy-3"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(topic).WithStatusSubresource(topic).Build()
+	handler := topicCallbackHandler{client: cl}
+
+	callback := CallbackRequest{DeploymentID: "deploy-3", Namespace: "dev", Status: "success", Phase: "Ready",
+		Time: time.Now(), Endpoint: "kafka.dev.svc", Port: 9092, ConnectionSecret: "orders-conn"}
+	if err := handler.Handle(context.Background(), callback); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := &platformv1.Topic{}
+	if err := cl.Get(context.Background(), client.ObjectKeyFromObject(topic), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Status.Phase != "Ready" || out.Status.Endpoint != "kafka.dev.svc" || out.Status.Port != 9092 {
+		t.Fatalf("expected the topic to be Ready at kafka.dev.svc:9092, got %+v", out.Status)
+	}
+	if out.Status.ConnectionSecretRef == nil || out.Status.ConnectionSecretRef.Name != "orders-conn" {
+		t.Fatalf("expected the connection secret to be recorded, got %+v", out.Status.ConnectionSecretRef)
+	}
+}
+
+func TestHandleCallback_ReleasesBrokerReservation(t *testing.T) {
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, cl := newTokenTestServer(t, issued.Hash, issued.Expires)
+
+	broker := &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"},
+		Spec: platformv1.BrokerSpec{
+			MaxConcurrentDeployments: 1,
+			Capabilities:             []platformv1.BrokerCapability{{ResourceType: "Database"}},
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready"},
+	}
+	if err := cl.Create(context.Background(), broker); err != nil {
+		t.Fatal(err)
+	}
+	registry := brokerregistry.NewRegistry(cl)
+	registry.Reserve(broker, "deploy-1")
+	s.SetBrokerRegistry(registry)
+
+	criteria := brokerregistry.SelectionCriteria{ResourceType: "database"}
+	if _, err := registry.Select(context.Background(), criteria); !errors.Is(err, brokerregistry.ErrBrokersAtCapacity) {
+		t.Fatalf("expected the reservation to fill the broker, got %v", err)
+	}
+
+	if rec := postCallback(s, issued.Token); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := registry.Select(context.Background(), criteria); err != nil {
+		t.Fatalf("expected the final callback to release the reservation, got %v", err)
+	}
+}
+
+// postSignedCallback posts body signed by brokerName with priv, adding any
+// extra headers
+func postSignedCallback(t *testing.T, s *Server, brokerName string, priv ed25519.PrivateKey, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	sig := ed25519.Sign(priv, []byte(timestamp+"."+body))
+	req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(body))
+	req.Header.Set("X-KIDP-Broker-Name", brokerName)
+	req.Header.Set("X-KIDP-Timestamp", timestamp)
+	req.Header.Set("X-KIDP-Signature", base64.StdEncoding.EncodeToString(sig))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.handleCallback(rec, req)
+	return rec
+}
+
+func TestHandleCallback_AcceptsRotatedKeys(t *testing.T) {
+	s, cl := newTokenTestServer(t, "", time.Time{})
+
+	newKey := func() (string, ed25519.PrivateKey) {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(pub), priv
+	}
+	currentPub, currentPriv := newKey()
+	previousPub, previousPriv := newKey()
+	retiredPub, retiredPriv := newKey()
+
+	// The broker rotated from the previous key to the current one; the
+	// retired key has aged out
+	broker := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-a"}}
+	broker.Status.CallbackPublicKey = currentPub
+	broker.Status.CallbackPublicKeys = []string{currentPub, previousPub}
+	if err := cl.Create(context.Background(), broker); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(priv ed25519.PrivateKey, keyID string) int {
+		headers := map[string]string{}
+		if keyID != "" {
+			headers["X-KIDP-Key-ID"] = keyID
+		}
+		return postSignedCallback(t, s, "broker-a", priv, readyCallback, headers).Code
+	}
+
+	tests := []struct {
+		name  string
+		priv  ed25519.PrivateKey
+		keyID string
+		want  int
+	}{
+		{name: "current key", priv: currentPriv, keyID: platformv1.CallbackKeyID(currentPub), want: http.StatusOK},
+		{name: "previous key by id", priv: previousPriv, keyID: platformv1.CallbackKeyID(previousPub), want: http.StatusOK},
+		{name: "previous key without id", priv: previousPriv, want: http.StatusOK},
+		{name: "previous key under the wrong id", priv: previousPriv, keyID: platformv1.CallbackKeyID(currentPub), want: http.StatusOK},
+		{name: "retired key", priv: retiredPriv, keyID: platformv1.CallbackKeyID(retiredPub), want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := post(tt.priv, tt.keyID); got != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHandleCallback_BrokerNamespace(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"}}
+	broker.Status.CallbackPublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	tests := []struct {
+		name             string
+		defaultNamespace string
+		header           string
+		want             int
+	}{
+		{name: "namespace from header", header: "kidp-system", want: http.StatusOK},
+		{name: "configured default namespace", defaultNamespace: "kidp-system", want: http.StatusOK},
+		{name: "header overrides default", defaultNamespace: "brokers", header: "kidp-system", want: http.StatusOK},
+		{name: "not in the default namespace", want: http.StatusUnauthorized},
+		{name: "not in the given namespace", defaultNamespace: "kidp-system", header: "brokers", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, cl := newTokenTestServer(t, "", time.Time{})
+			if err := cl.Create(context.Background(), broker.DeepCopy()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.defaultNamespace != "" {
+				s.SetBrokerNamespace(tt.defaultNamespace)
+			}
+			headers := map[string]string{}
+			if tt.header != "" {
+				headers["X-KIDP-Broker-Namespace"] = tt.header
+			}
+			if rec := postSignedCallback(t, s, "broker-a", priv, readyCallback, headers); rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleCallback_VerifiesSignatureOverRawBody(t *testing.T) {
+	s, cl := newTokenTestServer(t, "", time.Time{})
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-a"}}
+	broker.Status.CallbackPublicKey = base64.StdEncoding.EncodeToString(pub)
+	if err := cl.Create(context.Background(), broker); err != nil {
+		t.Fatal(err)
+	}
+
+	// A newer broker sends a field this manager doesn't know, with its own
+	// key order and spacing; none of it survives decoding and re-encoding
+	body := `{"status": "success", "phase": "Ready", "deploymentId": "deploy-1", "resourceType": "database",` +
+		` "namespace": "dev", "resourceName": "db1", "time": "2025-10-01T12:00:00Z", "futureField": {"x": 1}}`
+	if rec := postSignedCallback(t, s, "broker-a", priv, body, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var db platformv1.Database
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, &db); err != nil {
+		t.Fatal(err)
+	}
+	if db.Status.Phase != "Ready" {
+		t.Fatalf("expected the callback to be processed, got phase %q", db.Status.Phase)
+	}
+
+	// The signature still binds the exact bytes
+	tampered := strings.Replace(body, `"x": 1`, `"x": 2`, 1)
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(tampered))
+	req.Header.Set("X-KIDP-Broker-Name", "broker-a")
+	req.Header.Set("X-KIDP-Timestamp", timestamp)
+	req.Header.Set("X-KIDP-Signature", base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(timestamp+"."+body))))
+	rec := httptest.NewRecorder()
+	s.handleCallback(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a modified body to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestHandleCallback_DeduplicatesRetries(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-a"}}
+	broker.Status.CallbackPublicKey = base64.StdEncoding.EncodeToString(pub)
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"}}
+	db.Status.Phase = "Provisioning"
+	db.Status.DeploymentID = "deploy-1"
+
+	statusWrites := 0
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(broker, db).WithStatusSubresource(db).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				statusWrites++
+				return c.SubResource(subResourceName).Update(ctx, obj, opts...)
+			},
+		}).Build()
+	s := NewServer(cl, 0)
+
+	body := `{"deploymentId":"deploy-1","resourceType":"database","resourceName":"db1","namespace":"dev",` +
+		`"status":"success","phase":"Ready","message":"ready","time":"2025-10-01T12:00:00Z","nonce":"n-1"}`
+	for i := 0; i < 2; i++ {
+		if rec := postSignedCallback(t, s, "broker-a", priv, body, nil); rec.Code != http.StatusOK {
+			t.Fatalf("attempt %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	if statusWrites != 1 {
+		t.Fatalf("expected the status to be updated once, got %d writes", statusWrites)
+	}
+
+	// A new update for the same deployment is processed
+	if rec := postSignedCallback(t, s, "broker-a", priv, strings.Replace(body, "n-1", "n-2", 1), nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if statusWrites != 2 {
+		t.Fatalf("expected a new nonce to be processed, got %d writes", statusWrites)
+	}
+}
+
+func TestHandleCallback_DeduplicatesOnlyAuthenticatedTokenCallbacks(t *testing.T) {
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s, cl := newTokenTestServer(t, issued.Hash, issued.Expires)
+	s.seen.add("deploy-1", "n-1")
+
+	body := strings.Replace(readyCallback, `"status"`, `"nonce":"n-1","status"`, 1)
+	post := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v1/callback", strings.NewReader(body))
+		req.Header.Set(callbacktoken.Header, token)
+		rec := httptest.NewRecorder()
+		s.handleCallback(rec, req)
+		return rec.Code
+	}
+
+	// A processed callback replayed without its token isn't acknowledged
+	if code := post("forged"); code != http.StatusUnauthorized {
+		t.Fatalf("expected a replay with a forged token to be rejected, got %d", code)
+	}
+	if code := post(issued.Token); code != http.StatusOK {
+		t.Fatalf("expected the broker's retry to be acknowledged, got %d", code)
+	}
+	out := &platformv1.Database{}
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dev", Name: "db1"}, out); err != nil {
+		t.Fatalf("failed to get db: %v", err)
+	}
+	if out.Status.Phase != "Provisioning" {
+		t.Fatalf("expected the retry not to be applied again, got phase %s", out.Status.Phase)
+	}
+}
+
+func TestRecentCallbacks_EvictsLeastRecent(t *testing.T) {
+	r := newRecentCallbacks(2)
+	r.add("deploy-1", "a")
+	r.add("deploy-1", "b")
+	r.contains("deploy-1", "a") // a is now the most recently seen
+	r.add("deploy-2", "a")
+
+	if !r.contains("deploy-1", "a") || !r.contains("deploy-2", "a") {
+		t.Fatalf("expected the recently seen callbacks to be kept")
+	}
+	if r.contains("deploy-1", "b") {
+		t.Fatalf("expected the least recently seen callback to be evicted")
+	}
+	r.add("deploy-3", "")
+	if r.contains("deploy-3", "") {
+		t.Fatalf("callbacks without a nonce must never be duplicates")
+	}
+}
+
+// serveSlowCallback serves s on a local listener with a queue handler that
+// signals started and then runs handle, and posts one queue callback to it.
+// It returns the callback's response and serve's result on channels.
+func serveSlowCallback(t *testing.T, s *Server, started chan<- struct{}, handle func(ctx context.Context) error) (context.CancelFunc, <-chan *http.Response, <-chan error) {
+	t.Helper()
+	issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s.RegisterCallbackHandler("queue", CallbackHandlerFunc(func(ctx context.Context, callback CallbackRequest) error {
+		close(started)
+		return handle(ctx)
+	}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(ctx, listener)
+	}()
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		body := `{"deploymentId":"deploy-9","resourceType":"queue","namespace":"dev","status":"success","phase":"Ready"}`
+		req, _ := http.NewRequest(http.MethodPost, "http://"+listener.Addr().String()+"/v1/callback", strings.NewReader(body))
+		req.Header.Set(callbacktoken.Header, issued.Token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("callback failed: %v", err)
+			responses <- nil
+			return
+		}
+		resp.Body.Close()
+		responses <- resp
+	}()
+	return cancel, responses, served
+}
+
+func TestServe_SlowCallbackCompletesDuringShutdown(t *testing.T) {
+	s, _ := newTokenTestServer(t, "", time.Time{})
+	s.SetShutdownTimeout(5 * time.Second)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var handlerErr error
+	cancel, responses, served := serveSlowCallback(t, s, started, func(ctx context.Context) error {
+		<-release
+		handlerErr = ctx.Err()
+		return nil
+	})
+
+	<-started
+	cancel()
+
+	// Shutdown waits for the callback rather than returning under it
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned with a callback in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-served; err != nil {
+		t.Fatalf("expected a clean shutdown, got %v", err)
+	}
+	if handlerErr != nil {
+		t.Fatalf("expected the callback's context to survive shutdown, got %v", handlerErr)
+	}
+	if resp := <-responses; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the callback to be answered with 200, got %+v", resp)
+	}
+}
+
+func TestServe_AbortsCallbacksAfterShutdownTimeout(t *testing.T) {
+	s, _ := newTokenTestServer(t, "", time.Time{})
+	s.SetShutdownTimeout(50 * time.Millisecond)
+
+	started := make(chan struct{})
+	aborted := make(chan struct{})
+	cancel, _, served := serveSlowCallback(t, s, started, func(ctx context.Context) error {
+		<-ctx.Done()
+		close(aborted)
+		return ctx.Err()
+	})
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected the shutdown to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the shutdown timeout")
+	}
+	select {
+	case <-aborted:
+	default:
+		t.Fatal("expected serve to wait for the aborted callback to return")
+	}
+}
+
+// callbackMetric reads a webhook callback counter from the manager's
+// registry, picking the series with the given rejection reason if one is set
+func callbackMetric(t *testing.T, name, reason string) float64 {
+	t.Helper()
+	families, err := ctrlmetrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if reason == "" || (len(m.GetLabel()) == 1 && m.GetLabel()[0].GetValue() == reason) {
+				return m.GetCounter().GetValue()
+			}
+		}
+	}
+	t.Fatalf("metric %s{reason=%q} not registered", name, reason)
+	return 0
+}
+
+func TestHandleCallback_CountsRejections(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broker-a"}}
+	broker.Status.CallbackPublicKey = base64.StdEncoding.EncodeToString(pub)
+
+	tests := []struct {
+		name   string
+		post   func(s *Server) *httptest.ResponseRecorder
+		reason string
+	}{
+		{
+			name: "missing headers",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				return postSignedCallback(t, s, "broker-a", priv, readyCallback, map[string]string{"X-KIDP-Signature": ""})
+			},
+			reason: metrics.CallbackRejectedMissingHeaders,
+		},
+		{
+			name: "bad timestamp",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				return postSignedCallback(t, s, "broker-a", priv, readyCallback, map[string]string{"X-KIDP-Timestamp": "yesterday"})
+			},
+			reason: metrics.CallbackRejectedBadTimestamp,
+		},
+		{
+			name: "replay",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				old := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+				return postSignedCallback(t, s, "broker-a", priv, readyCallback, map[string]string{"X-KIDP-Timestamp": old})
+			},
+			reason: metrics.CallbackRejectedReplay,
+		},
+		{
+			name: "unknown broker",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				return postSignedCallback(t, s, "broker-b", priv, readyCallback, nil)
+			},
+			reason: metrics.CallbackRejectedUnknownBroker,
+		},
+		{
+			name: "bad signature",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				return postSignedCallback(t, s, "broker-a", otherPriv, readyCallback, nil)
+			},
+			reason: metrics.CallbackRejectedBadSignature,
+		},
+		{
+			name: "bad token",
+			post: func(s *Server) *httptest.ResponseRecorder {
+				return postCallback(s, "not-the-token")
+			},
+			reason: metrics.CallbackRejectedBadToken,
+		},
+	}
+	reasons := []string{
+		metrics.CallbackRejectedMissingHeaders, metrics.CallbackRejectedBadTimestamp, metrics.CallbackRejectedReplay,
+		metrics.CallbackRejectedUnknownBroker, metrics.CallbackRejectedBadSignature, metrics.CallbackRejectedBadToken,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issued, err := callbacktoken.Issue(time.Now(), time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, cl := newTokenTestServer(t, issued.Hash, issued.Expires)
+			if err := cl.Create(context.Background(), broker.DeepCopy()); err != nil {
+				t.Fatal(err)
+			}
+
+			before := map[string]float64{}
+			for _, reason := range reasons {
+				before[reason] = callbackMetric(t, "kidp_webhook_callbacks_rejected_total", reason)
+			}
+			received := callbackMetric(t, "kidp_webhook_callbacks_received_total", "")
+
+			if rec := tt.post(s); rec.Code == http.StatusOK {
+				t.Fatal("expected the callback to be rejected")
+			}
+
+			if got := callbackMetric(t, "kidp_webhook_callbacks_received_total", ""); got != received+1 {
+				t.Errorf("expected the callback to be counted as received")
+			}
+			for _, reason := range reasons {
+				want := before[reason]
+				if reason == tt.reason {
+					want++
+				}
+				if got := callbackMetric(t, "kidp_webhook_callbacks_rejected_total", reason); got != want {
+					t.Errorf("expected %s rejections to be %v, got %v", reason, want, got)
+				}
+			}
+		})
+	}
+
+	// A callback that verifies is counted as verified
+	s, cl := newTokenTestServer(t, "", time.Time{})
+	if err := cl.Create(context.Background(), broker.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	verified := callbackMetric(t, "kidp_webhook_callbacks_verified_total", "")
+	if rec := postSignedCallback(t, s, "broker-a", priv, readyCallback, nil); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := callbackMetric(t, "kidp_webhook_callbacks_verified_total", ""); got != verified+1 {
+		t.Fatalf("expected the callback to be counted as verified")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// maxRecentFailures caps the failures listed in a status summary
+const maxRecentFailures = 20
+
+// KindSummary counts the resources of one kind by phase
+type KindSummary struct {
+	Total  int            `json:"total"`
+	Phases map[string]int `json:"phases"`
+}
+
+// ResourceFailure describes a resource in a failed phase
+type ResourceFailure struct {
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name"`
+	Phase     string       `json:"phase"`
+	Reason    string       `json:"reason,omitempty"`
+	Message   string       `json:"message,omitempty"`
+	Time      *metav1.Time `json:"time,omitempty"`
+}
+
+// StatusSummary is a platform-wide view of resource health
+type StatusSummary struct {
+	Time           time.Time              `json:"time"`
+	Resources      map[string]KindSummary `json:"resources"`
+	RecentFailures []ResourceFailure      `json:"recentFailures"`
+}
+
+// handleSummary reports resource counts by phase and the most recent failures
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summary, err := s.summarize(r.Context())
+	if err != nil {
+		log.Printf("Failed to build status summary: %v", err)
+		http.Error(w, "Failed to build status summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		log.Printf("Failed to encode status summary: %v", err)
+	}
+}
+
+// summarize builds a StatusSummary from Databases, Teams, Tenants and Brokers.
+// The manager's client reads from the informer cache, so this does not hit
+// the API server unless a cluster reader was set for a scoped cache.
+func (s *Server) summarize(ctx context.Context) (*StatusSummary, error) {
+	var reader client.Reader = s.client
+	if s.clusterReader != nil {
+		reader = s.clusterReader
+	}
+	summary := &StatusSummary{
+		Time:           time.Now().UTC(),
+		Resources:      make(map[string]KindSummary),
+		RecentFailures: []ResourceFailure{},
+	}
+
+	var databases platformv1.DatabaseList
+	if err := reader.List(ctx, &databases); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	dbSummary := newKindSummary()
+	for _, db := range databases.Items {
+		dbSummary.add(db.Status.Phase)
+		if db.Status.Phase == "Failed" {
+			summary.RecentFailures = append(summary.RecentFailures,
+				newResourceFailure("Database", db.ObjectMeta, db.Status.Phase, db.Status.Conditions))
+		}
+	}
+	summary.Resources["databases"] = dbSummary
+
+	var teams platformv1.TeamList
+	if err := reader.List(ctx, &teams); err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	teamSummary := newKindSummary()
+	for _, team := range teams.Items {
+		teamSummary.add(team.Status.Phase)
+	}
+	summary.Resources["teams"] = teamSummary
+
+	var tenants platformv1.TenantList
+	if err := reader.List(ctx, &tenants); err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	tenantSummary := newKindSummary()
+	for _, tenant := range tenants.Items {
+		tenantSummary.add(tenant.Status.Phase)
+	}
+	summary.Resources["tenants"] = tenantSummary
+
+	var brokers platformv1.BrokerList
+	if err := reader.List(ctx, &brokers); err != nil {
+		return nil, fmt.Errorf("failed to list brokers: %w", err)
+	}
+	brokerSummary := newKindSummary()
+	for _, b := range brokers.Items {
+		brokerSummary.add(b.Status.Phase)
+		if b.Status.Phase == "Unhealthy" || b.Status.Phase == "Offline" {
+			failure := newResourceFailure("Broker", b.ObjectMeta, b.Status.Phase, b.Status.Conditions)
+			if failure.Message == "" {
+				failure.Message = b.Status.Message
+			}
+			summary.RecentFailures = append(summary.RecentFailures, failure)
+		}
+	}
+	summary.Resources["brokers"] = brokerSummary
+
+	// Newest first; failures without a timestamp sort last
+	sort.SliceStable(summary.RecentFailures, func(i, j int) bool {
+		a, b := summary.RecentFailures[i].Time, summary.RecentFailures[j].Time
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return b.Before(a)
+	})
+	if len(summary.RecentFailures) > maxRecentFailures {
+		summary.RecentFailures = summary.RecentFailures[:maxRecentFailures]
+	}
+	return summary, nil
+}
+
+func newKindSummary() KindSummary {
+	return KindSummary{Phases: make(map[string]int)}
+}
+
+// add counts one resource; resources not yet reconciled count as Unknown
+func (k *KindSummary) add(phase string) {
+	if phase == "" {
+		phase = "Unknown"
+	}
+	k.Total++
+	k.Phases[phase]++
+}
+
+// newResourceFailure describes a failed resource, taking the reason, message
+// and time from its Ready condition when it has one
+func newResourceFailure(kind string, obj metav1.ObjectMeta, phase string, conditions []metav1.Condition) ResourceFailure {
+	failure := ResourceFailure{Kind: kind, Namespace: obj.Namespace, Name: obj.Name, Phase: phase}
+	if ready := meta.FindStatusCondition(conditions, "Ready"); ready != nil {
+		failure.Reason = ready.Reason
+		failure.Message = ready.Message
+		t := ready.LastTransitionTime
+		failure.Time = &t
+	}
+	return failure
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func failedDatabase(name string, at time.Time) *platformv1.Database {
+	db := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: name}}
+	db.Status.Phase = "Failed"
+	db.Status.Conditions = []metav1.Condition{{
+		Type: "Ready", Status: metav1.ConditionFalse, Reason: "ProvisioningFailed",
+		Message: name + " failed", LastTransitionTime: metav1.NewTime(at),
+	}}
+	return db
+}
+
+func TestHandleSummary(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	ready := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "ready"}}
+	ready.Status.Phase = "Ready"
+	pending := &platformv1.Database{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "new"}}
+	team := &platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "acme", Name: "payments"}}
+	team.Status.Phase = "Active"
+	tenant := &platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}}
+	tenant.Status.Phase = "Suspended"
+	offline := &platformv1.Broker{ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: "broker-a"}}
+	offline.Status.Phase = "Offline"
+	offline.Status.Message = "no heartbeat"
+
+	objs := []client.Object{
+		ready, pending, team, tenant, offline,
+		failedDatabase("older", now.Add(-time.Hour)),
+		failedDatabase("newer", now),
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	s := NewServer(cl, 0)
+
+	rec := httptest.NewRecorder()
+	s.handleSummary(rec, httptest.NewRequest(http.MethodGet, "/v1/summary", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var summary StatusSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("failed to decode summary: %v", err)
+	}
+
+	dbs := summary.Resources["databases"]
+	if dbs.Total != 4 || dbs.Phases["Ready"] != 1 || dbs.Phases["Failed"] != 2 || dbs.Phases["Unknown"] != 1 {
+		t.Fatalf("unexpected database summary: %+v", dbs)
+	}
+	if summary.Resources["teams"].Phases["Active"] != 1 || summary.Resources["tenants"].Phases["Suspended"] != 1 {
+		t.Fatalf("unexpected team/tenant summary: %+v", summary.Resources)
+	}
+	if summary.Resources["brokers"].Phases["Offline"] != 1 {
+		t.Fatalf("unexpected broker summary: %+v", summary.Resources["brokers"])
+	}
+
+	if len(summary.RecentFailures) != 3 {
+		t.Fatalf("expected 3 failures, got %+v", summary.RecentFailures)
+	}
+	if got := summary.RecentFailures[0]; got.Name != "newer" || got.Reason != "ProvisioningFailed" || got.Message != "newer failed" {
+		t.Fatalf("expected the newest failure first, got %+v", got)
+	}
+	if got := summary.RecentFailures[2]; got.Kind != "Broker" || got.Message != "no heartbeat" {
+		t.Fatalf("expected the undated broker failure last, got %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleSummary(rec, httptest.NewRequest(http.MethodPost, "/v1/summary", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 for POST, got %d", rec.Code)
+	}
+}
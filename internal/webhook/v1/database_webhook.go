@@ -0,0 +1,243 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package v1 contains the admission webhooks for platform.company.com/v1
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// AnnotationAllowPendingOwner lets a Database be admitted before its owner
+// exists, for GitOps tools that apply a tenant's resources in any order. The
+// Database is suspended until the owner appears.
+const AnnotationAllowPendingOwner = "platform.company.com/allow-pending-owner"
+
+// SetupDatabaseWebhookWithManager registers the Database defaulting and
+// validating webhooks
+func SetupDatabaseWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&platformv1.Database{}).
+		WithDefaulter(&DatabaseCustomDefaulter{}).
+		WithValidator(&DatabaseCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-platform-company-com-v1-database,mutating=true,failurePolicy=fail,sideEffects=None,groups=platform.company.com,resources=databases,verbs=create;update,versions=v1,name=mdatabase-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseCustomDefaulter applies the defaults implied by a Database's tier
+type DatabaseCustomDefaulter struct{}
+
+var _ admission.CustomDefaulter = &DatabaseCustomDefaulter{}
+
+// Default fills in the tier defaults for fields the Database leaves unset
+func (d *DatabaseCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	database, ok := obj.(*platformv1.Database)
+	if !ok {
+		return fmt.Errorf("expected a Database but got %T", obj)
+	}
+	database.Spec.Default()
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-platform-company-com-v1-database,mutating=false,failurePolicy=fail,sideEffects=None,groups=platform.company.com,resources=databases,verbs=create;update;delete,versions=v1,name=vdatabase-v1.kb.io,admissionReviewVersions=v1
+
+// DatabaseCustomValidator rejects Databases whose owner does not exist or
+// whose guardrails the engine does not support, and deletes of protected
+// Databases
+type DatabaseCustomValidator struct {
+	Client client.Client
+}
+
+var _ admission.CustomValidator = &DatabaseCustomValidator{}
+
+// ValidateCreate checks the guardrails and init scripts, and that the owner of a new Database exists
+func (v *DatabaseCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	database, ok := obj.(*platformv1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got %T", obj)
+	}
+	spec, err := v.effectiveSpec(ctx, database)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validateSpec(spec); len(errs) > 0 {
+		return nil, invalid(database, errs...)
+	}
+	return v.validateOwner(ctx, database)
+}
+
+// ValidateUpdate checks the guardrails and init scripts, and that the owner exists when it
+// changes. An unchanged owner is not rechecked so a Database whose owner was
+// deleted can still be updated (e.g. to remove its finalizer). Once the
+// Database is provisioned its engine can't change and its version can't be
+// downgraded.
+func (v *DatabaseCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldDatabase, ok := oldObj.(*platformv1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got %T", oldObj)
+	}
+	database, ok := newObj.(*platformv1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got %T", newObj)
+	}
+	spec, err := v.effectiveSpec(ctx, database)
+	if apierrors.IsInvalid(err) && equalClassRef(oldDatabase.Spec.ClassRef, database.Spec.ClassRef) {
+		// The class was deleted after the Database was admitted; don't block
+		// updates, such as removing the finalizer, until it is recreated
+		spec, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if spec != nil {
+		if errs := validateSpec(spec); len(errs) > 0 {
+			return nil, invalid(database, errs...)
+		}
+	} else {
+		spec = database.Spec.DeepCopy()
+	}
+	if oldDatabase.Status.DeploymentID != "" {
+		oldSpec, err := v.effectiveSpec(ctx, oldDatabase)
+		if err != nil {
+			// Compare what was written when the class can't be applied
+			oldSpec = oldDatabase.Spec.DeepCopy()
+		}
+		if errs := spec.ValidateImmutable(oldSpec, field.NewPath("spec")); len(errs) > 0 {
+			return nil, invalid(database, errs...)
+		}
+	}
+	if oldDatabase.Spec.Owner == database.Spec.Owner {
+		return nil, nil
+	}
+	return v.validateOwner(ctx, database)
+}
+
+// ValidateDelete rejects deleting a Database with deletion protection on
+func (v *DatabaseCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	database, ok := obj.(*platformv1.Database)
+	if !ok {
+		return nil, fmt.Errorf("expected a Database but got %T", obj)
+	}
+	if protect := database.Spec.DeletionProtection; protect != nil && *protect {
+		return nil, apierrors.NewForbidden(
+			schema.GroupResource{Group: platformv1.GroupVersion.Group, Resource: "databases"},
+			database.Name,
+			fmt.Errorf("deletion protection is enabled; set spec.deletionProtection to false before deleting"))
+	}
+	return nil, nil
+}
+
+func (v *DatabaseCustomValidator) validateOwner(ctx context.Context, database *platformv1.Database) (admission.Warnings, error) {
+	owner := database.Spec.Owner
+	ownerPath := field.NewPath("spec", "owner")
+
+	var target client.Object
+	key := client.ObjectKey{Name: owner.Name}
+	switch owner.Kind {
+	case "Tenant":
+		// Tenants are cluster-scoped
+		target = &platformv1.Tenant{}
+	case "Team", "Application":
+		key.Namespace = database.Namespace
+		if owner.Namespace != "" {
+			key.Namespace = owner.Namespace
+		}
+		if owner.Kind == "Team" {
+			target = &platformv1.Team{}
+		} else {
+			target = &platformv1.Application{}
+		}
+	default:
+		return nil, invalid(database, field.NotSupported(ownerPath.Child("kind"), owner.Kind, []string{"Tenant", "Team", "Application"}))
+	}
+
+	err := v.Client.Get(ctx, key, target)
+	if err == nil {
+		return nil, nil
+	}
+	described := fmt.Sprintf("%s %q", owner.Kind, key.Name)
+	if key.Namespace != "" {
+		described += fmt.Sprintf(" in namespace %q", key.Namespace)
+	}
+	if !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to look up owner %s: %w", described, err)
+	}
+
+	if database.Annotations[AnnotationAllowPendingOwner] == "true" {
+		return admission.Warnings{fmt.Sprintf("owner %s does not exist yet; the Database will be suspended until it is created", described)}, nil
+	}
+	return nil, invalid(database, field.Invalid(ownerPath, owner.Name,
+		fmt.Sprintf("%s does not exist; create it first or set the %s annotation to \"true\"", described, AnnotationAllowPendingOwner)))
+}
+
+// effectiveSpec returns the Database's spec with its DatabaseClass applied.
+// A class that doesn't exist is reported as an invalid classRef.
+func (v *DatabaseCustomValidator) effectiveSpec(ctx context.Context, database *platformv1.Database) (*platformv1.DatabaseSpec, error) {
+	spec := database.Spec.DeepCopy()
+	if spec.ClassRef == nil {
+		return spec, nil
+	}
+	class := &platformv1.DatabaseClass{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: spec.ClassRef.Name}, class); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, invalid(database, field.NotFound(field.NewPath("spec", "classRef", "name"), spec.ClassRef.Name))
+		}
+		return nil, fmt.Errorf("failed to look up DatabaseClass %q: %w", spec.ClassRef.Name, err)
+	}
+	spec.ApplyClass(&class.Spec)
+	return spec, nil
+}
+
+// equalClassRef reports whether two class references name the same class
+func equalClassRef(a, b *platformv1.DatabaseClassReference) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// validateSpec checks the parts of a Database spec the CRD schema can't,
+// including that a DatabaseClass fills in the required fields a Database
+// referencing it leaves unset, and that options depending on each other are
+// set together
+func validateSpec(spec *platformv1.DatabaseSpec) field.ErrorList {
+	specPath := field.NewPath("spec")
+	var errs field.ErrorList
+	if spec.ClassRef != nil {
+		errs = spec.ValidateRequired(specPath)
+	}
+	errs = append(errs, spec.ValidateGuardrails(specPath)...)
+	errs = append(errs, spec.ValidateCombinations(specPath)...)
+	return append(errs, spec.ValidateInitScripts(specPath)...)
+}
+
+func invalid(database *platformv1.Database, errs ...*field.Error) error {
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: platformv1.GroupVersion.Group, Kind: "Database"},
+		database.Name, errs)
+}
@@ -0,0 +1,530 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func newValidator(t *testing.T) *DatabaseCustomValidator {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&platformv1.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments"}},
+		&platformv1.Application{ObjectMeta: metav1.ObjectMeta{Namespace: "shared", Name: "billing"}},
+	).Build()
+	return &DatabaseCustomValidator{Client: cl}
+}
+
+func databaseOwnedBy(owner platformv1.OwnerReference) *platformv1.Database {
+	return &platformv1.Database{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "db1"},
+		Spec:       platformv1.DatabaseSpec{Owner: owner},
+	}
+}
+
+func TestDatabaseValidator_ExistingOwners(t *testing.T) {
+	v := newValidator(t)
+
+	for _, owner := range []platformv1.OwnerReference{
+		{Kind: "Tenant", Name: "acme"},
+		{Kind: "Team", Name: "payments"},
+		{Kind: "Application", Name: "billing", Namespace: "shared"},
+	} {
+		t.Run(owner.Kind, func(t *testing.T) {
+			warnings, err := v.ValidateCreate(context.Background(), databaseOwnedBy(owner))
+			if err != nil || len(warnings) != 0 {
+				t.Fatalf("expected owner %+v to be accepted, got warnings=%v err=%v", owner, warnings, err)
+			}
+		})
+	}
+}
+
+func TestDatabaseValidator_DanglingOwners(t *testing.T) {
+	v := newValidator(t)
+
+	tests := []struct {
+		name  string
+		owner platformv1.OwnerReference
+		want  string
+	}{
+		{"missing tenant", platformv1.OwnerReference{Kind: "Tenant", Name: "globex"}, `Tenant "globex" does not exist`},
+		{"missing team", platformv1.OwnerReference{Kind: "Team", Name: "search"}, `Team "search" in namespace "dev" does not exist`},
+		{"team in another namespace", platformv1.OwnerReference{Kind: "Team", Name: "payments", Namespace: "prod"}, `namespace "prod"`},
+		{"missing application", platformv1.OwnerReference{Kind: "Application", Name: "billing"}, `Application "billing" in namespace "dev"`},
+		{"unsupported kind", platformv1.OwnerReference{Kind: "Project", Name: "x"}, `spec.owner.kind`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.ValidateCreate(context.Background(), databaseOwnedBy(tt.owner))
+			if err == nil {
+				t.Fatalf("expected dangling owner %+v to be rejected", tt.owner)
+			}
+			if !apierrors.IsInvalid(err) {
+				t.Fatalf("expected an Invalid error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error to contain %q, got: %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDatabaseValidator_AllowPendingOwner(t *testing.T) {
+	v := newValidator(t)
+
+	db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "globex"})
+	db.Annotations = map[string]string{AnnotationAllowPendingOwner: "true"}
+	warnings, err := v.ValidateCreate(context.Background(), db)
+	if err != nil {
+		t.Fatalf("expected pending owner to be admitted, got %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "suspended") {
+		t.Fatalf("expected a warning that the Database will be suspended, got %v", warnings)
+	}
+}
+
+func TestDatabaseValidator_Update(t *testing.T) {
+	v := newValidator(t)
+
+	// An unchanged owner is not rechecked, so a Database whose owner has been
+	// deleted can still be updated
+	old := databaseOwnedBy(platformv1.OwnerReference{Kind: "Team", Name: "deleted"})
+	updated := old.DeepCopy()
+	updated.Spec.Size = "large"
+	if _, err := v.ValidateUpdate(context.Background(), old, updated); err != nil {
+		t.Fatalf("expected update with unchanged owner to be allowed, got %v", err)
+	}
+
+	updated.Spec.Owner = platformv1.OwnerReference{Kind: "Team", Name: "search"}
+	if _, err := v.ValidateUpdate(context.Background(), old, updated); err == nil {
+		t.Fatalf("expected update to a dangling owner to be rejected")
+	}
+}
+
+func TestDatabaseValidator_ImmutableOnceProvisioned(t *testing.T) {
+	v := newValidator(t)
+	ctx := context.Background()
+	if err := v.Client.Create(ctx, &platformv1.DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-standard"},
+		Spec:       platformv1.DatabaseClassSpec{Engine: "postgresql", Version: "15", Size: "medium"},
+	}); err != nil {
+		t.Fatalf("failed to create class: %v", err)
+	}
+
+	provisioned := func() *platformv1.Database {
+		db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+		db.Spec.Engine = "postgresql"
+		db.Spec.Version = "15.4"
+		db.Spec.Size = "small"
+		db.Status.DeploymentID = "deploy-1"
+		return db
+	}
+
+	tests := []struct {
+		name   string
+		update func(db *platformv1.Database)
+		want   string // offending field, empty if the update is allowed
+	}{
+		{"size change", func(db *platformv1.Database) { db.Spec.Size = "large" }, ""},
+		{"minor upgrade", func(db *platformv1.Database) { db.Spec.Version = "15.5" }, ""},
+		{"major upgrade", func(db *platformv1.Database) { db.Spec.Version = "16" }, ""},
+		{"engine from the class", func(db *platformv1.Database) {
+			db.Spec.Engine = ""
+			db.Spec.ClassRef = &platformv1.DatabaseClassReference{Name: "postgres-standard"}
+		}, ""},
+		{"engine change", func(db *platformv1.Database) { db.Spec.Engine = "mysql" }, "spec.engine"},
+		{"minor downgrade", func(db *platformv1.Database) { db.Spec.Version = "15.3" }, "spec.version"},
+		{"major downgrade", func(db *platformv1.Database) { db.Spec.Version = "14" }, "spec.version"},
+		{"downgrade to the class version", func(db *platformv1.Database) {
+			db.Spec.Version = ""
+			db.Spec.ClassRef = &platformv1.DatabaseClassReference{Name: "postgres-standard"}
+		}, "spec.version"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old := provisioned()
+			updated := old.DeepCopy()
+			tc.update(updated)
+			_, err := v.ValidateUpdate(ctx, old, updated)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("expected the update to be allowed, got %v", err)
+				}
+				return
+			}
+			if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected an invalid %s, got %v", tc.want, err)
+			}
+		})
+	}
+
+	// Until the broker has a deployment, anything goes
+	old := provisioned()
+	old.Status.DeploymentID = ""
+	updated := old.DeepCopy()
+	updated.Spec.Engine = "mysql"
+	updated.Spec.Version = "8.0"
+	if _, err := v.ValidateUpdate(ctx, old, updated); err != nil {
+		t.Fatalf("expected an unprovisioned database's engine to be changeable, got %v", err)
+	}
+}
+
+func TestDatabaseValidator_Guardrails(t *testing.T) {
+	v := newValidator(t)
+
+	limit := func(n int32) *int32 { return &n }
+	timeout := func(s string) *metav1.Duration {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &metav1.Duration{Duration: d}
+	}
+
+	tests := []struct {
+		name             string
+		engine           string
+		connectionLimit  *int32
+		statementTimeout *metav1.Duration
+		readOnly         bool
+		wantField        string
+	}{
+		{name: "postgresql with both", engine: "postgresql", connectionLimit: limit(200), statementTimeout: timeout("30s")},
+		{name: "redis connection limit", engine: "redis", connectionLimit: limit(10000)},
+		{name: "zero connection limit", engine: "postgresql", connectionLimit: limit(0), wantField: "spec.connectionLimit"},
+		{name: "sqlserver over max", engine: "sqlserver", connectionLimit: limit(40000), wantField: "spec.connectionLimit"},
+		{name: "redis statement timeout", engine: "redis", statementTimeout: timeout("5s"), wantField: "spec.statementTimeout"},
+		{name: "sqlserver statement timeout", engine: "sqlserver", statementTimeout: timeout("5s"), wantField: "spec.statementTimeout"},
+		{name: "sub-millisecond timeout", engine: "mysql", statementTimeout: timeout("1500us"), wantField: "spec.statementTimeout"},
+		{name: "timeout over a day", engine: "mongodb", statementTimeout: timeout("25h"), wantField: "spec.statementTimeout"},
+		{name: "mysql read-only", engine: "mysql", readOnly: true},
+		{name: "redis read-only", engine: "redis", readOnly: true, wantField: "spec.readOnly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+			db.Spec.Engine = tt.engine
+			db.Spec.ConnectionLimit = tt.connectionLimit
+			db.Spec.StatementTimeout = tt.statementTimeout
+			db.Spec.ReadOnly = tt.readOnly
+
+			_, createErr := v.ValidateCreate(context.Background(), db)
+			old := databaseOwnedBy(db.Spec.Owner)
+			old.Spec.Engine = tt.engine
+			_, updateErr := v.ValidateUpdate(context.Background(), old, db)
+
+			for _, err := range []error{createErr, updateErr} {
+				if tt.wantField == "" {
+					if err != nil {
+						t.Fatalf("expected guardrails to be accepted, got %v", err)
+					}
+					continue
+				}
+				if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), tt.wantField) {
+					t.Fatalf("expected %s to be rejected, got %v", tt.wantField, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseValidator_Combinations(t *testing.T) {
+	v := newValidator(t)
+
+	tests := []struct {
+		name       string
+		backup     *platformv1.BackupConfig
+		encryption *platformv1.EncryptionConfig
+		wantFields []string
+	}{
+		{name: "backups with PITR", backup: &platformv1.BackupConfig{Enabled: true, Retention: "7d", Schedule: "0 2 * * *", PointInTimeRestore: true}},
+		{name: "backups off", backup: &platformv1.BackupConfig{Retention: "7d"}},
+		{name: "PITR without backups", backup: &platformv1.BackupConfig{PointInTimeRestore: true},
+			wantFields: []string{"spec.backup.pointInTimeRestore"}},
+		{name: "schedule without backups", backup: &platformv1.BackupConfig{Schedule: "0 2 * * *"},
+			wantFields: []string{"spec.backup.schedule"}},
+		{name: "encryption with key and TLS version", encryption: &platformv1.EncryptionConfig{
+			AtRest:    platformv1.AtRestEncryption{Enabled: true, KMSKeyID: "key-1"},
+			InTransit: platformv1.InTransitEncryption{Enabled: true, MinTLSVersion: "1.3"},
+		}},
+		{name: "KMS key without encryption at rest", encryption: &platformv1.EncryptionConfig{
+			AtRest: platformv1.AtRestEncryption{KMSKeyID: "key-1"},
+		}, wantFields: []string{"spec.encryption.atRest.kmsKeyId"}},
+		{name: "TLS version without TLS", encryption: &platformv1.EncryptionConfig{
+			InTransit: platformv1.InTransitEncryption{MinTLSVersion: "1.2"},
+		}, wantFields: []string{"spec.encryption.inTransit.minTLSVersion"}},
+		{name: "several at once", backup: &platformv1.BackupConfig{Schedule: "@daily", PointInTimeRestore: true},
+			encryption: &platformv1.EncryptionConfig{AtRest: platformv1.AtRestEncryption{KMSKeyID: "key-1"}},
+			wantFields: []string{"spec.backup.pointInTimeRestore", "spec.backup.schedule", "spec.encryption.atRest.kmsKeyId"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+			db.Spec.Engine = "postgresql"
+			db.Spec.Backup = tt.backup
+			db.Spec.Encryption = tt.encryption
+			_, err := v.ValidateCreate(context.Background(), db)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("expected the combination to be allowed, got %v", err)
+				}
+				return
+			}
+			if !apierrors.IsInvalid(err) {
+				t.Fatalf("expected an invalid Database, got %v", err)
+			}
+			for _, f := range tt.wantFields {
+				if !strings.Contains(err.Error(), f) {
+					t.Errorf("expected %s to be reported, got %v", f, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseValidator_InitScripts(t *testing.T) {
+	v := newValidator(t)
+
+	schema := platformv1.InitScript{Name: "schema", Inline: "CREATE TABLE orders (id bigint PRIMARY KEY);"}
+	seed := platformv1.InitScript{Name: "seed", ConfigMapKeyRef: &platformv1.KeyReference{Name: "orders-seed", Key: "seed.sql"}}
+
+	tests := []struct {
+		name      string
+		engine    string
+		scripts   []platformv1.InitScript
+		wantField string
+	}{
+		{name: "inline and configmap", engine: "postgresql", scripts: []platformv1.InitScript{schema, seed}},
+		{name: "secret", engine: "postgresql", scripts: []platformv1.InitScript{
+			{Name: "grants", SecretKeyRef: &platformv1.KeyReference{Name: "orders-grants", Key: "grants.sql"}},
+		}},
+		{name: "unsupported engine", engine: "redis", scripts: []platformv1.InitScript{schema}, wantField: "spec.initScripts"},
+		{name: "duplicate name", engine: "postgresql", scripts: []platformv1.InitScript{schema, schema}, wantField: "spec.initScripts[1].name"},
+		{name: "no source", engine: "postgresql", scripts: []platformv1.InitScript{{Name: "empty"}}, wantField: "spec.initScripts[0]"},
+		{name: "two sources", engine: "postgresql", scripts: []platformv1.InitScript{
+			{Name: "both", Inline: "SELECT 1;", SecretKeyRef: &platformv1.KeyReference{Name: "s", Key: "k"}},
+		}, wantField: "spec.initScripts[0]"},
+		{name: "invalid key", engine: "postgresql", scripts: []platformv1.InitScript{
+			{Name: "bad", ConfigMapKeyRef: &platformv1.KeyReference{Name: "cm", Key: "../seed.sql"}},
+		}, wantField: "spec.initScripts[0].configMapKeyRef.key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+			db.Spec.Engine = tt.engine
+			db.Spec.InitScripts = tt.scripts
+
+			_, err := v.ValidateCreate(context.Background(), db)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("expected init scripts to be accepted, got %v", err)
+				}
+				return
+			}
+			if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), tt.wantField) {
+				t.Fatalf("expected %s to be rejected, got %v", tt.wantField, err)
+			}
+		})
+	}
+}
+
+func TestDatabaseDefaulter_Tier(t *testing.T) {
+	on, off := true, false
+
+	tests := []struct {
+		name               string
+		tier               string
+		highAvailability   *bool
+		deletionProtection *bool
+		backup             *platformv1.BackupConfig
+		wantHA             *bool
+		wantProtection     *bool
+		wantBackup         *platformv1.BackupConfig
+	}{
+		{name: "no tier", wantHA: nil, wantProtection: nil, wantBackup: nil},
+		{name: "dev", tier: "dev", wantHA: &off, wantProtection: &off, wantBackup: nil},
+		{name: "staging", tier: "staging", wantHA: &off, wantProtection: &off,
+			wantBackup: &platformv1.BackupConfig{Enabled: true, Retention: "7d"}},
+		{name: "prod", tier: "prod", wantHA: &on, wantProtection: &on,
+			wantBackup: &platformv1.BackupConfig{Enabled: true, Retention: "30d"}},
+		{name: "prod with explicit overrides", tier: "prod", highAvailability: &off, deletionProtection: &off,
+			backup: &platformv1.BackupConfig{Enabled: false, Retention: "1d"},
+			wantHA: &off, wantProtection: &off,
+			wantBackup: &platformv1.BackupConfig{Enabled: false, Retention: "1d"}},
+		{name: "dev with explicit HA", tier: "dev", highAvailability: &on, wantHA: &on, wantProtection: &off},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+			db.Spec.Tier = tt.tier
+			db.Spec.HighAvailability = tt.highAvailability
+			db.Spec.DeletionProtection = tt.deletionProtection
+			db.Spec.Backup = tt.backup
+
+			if err := (&DatabaseCustomDefaulter{}).Default(context.Background(), db); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalBool(db.Spec.HighAvailability, tt.wantHA) {
+				t.Fatalf("expected highAvailability %v, got %v", fmtBool(tt.wantHA), fmtBool(db.Spec.HighAvailability))
+			}
+			if !equalBool(db.Spec.DeletionProtection, tt.wantProtection) {
+				t.Fatalf("expected deletionProtection %v, got %v", fmtBool(tt.wantProtection), fmtBool(db.Spec.DeletionProtection))
+			}
+			if (db.Spec.Backup == nil) != (tt.wantBackup == nil) || (db.Spec.Backup != nil && *db.Spec.Backup != *tt.wantBackup) {
+				t.Fatalf("expected backup %+v, got %+v", tt.wantBackup, db.Spec.Backup)
+			}
+		})
+	}
+}
+
+func TestDatabaseDefaulter_VersionSizeAndRetention(t *testing.T) {
+	tests := []struct {
+		name                                 string
+		engine, version, size                string
+		classRef                             *platformv1.DatabaseClassReference
+		backup                               *platformv1.BackupConfig
+		wantVersion, wantSize, wantRetention string
+	}{
+		{name: "postgresql defaults", engine: "postgresql", wantVersion: "15", wantSize: "small"},
+		{name: "mysql defaults", engine: "mysql", wantVersion: "8.0", wantSize: "small"},
+		{name: "explicit values kept", engine: "postgresql", version: "16", size: "large", wantVersion: "16", wantSize: "large"},
+		{name: "class fills version and size", engine: "postgresql", classRef: &platformv1.DatabaseClassReference{Name: "standard"}},
+		{name: "enabled backup without retention", engine: "postgresql", backup: &platformv1.BackupConfig{Enabled: true},
+			wantVersion: "15", wantSize: "small", wantRetention: "7d"},
+		{name: "enabled backup with retention", engine: "postgresql", backup: &platformv1.BackupConfig{Enabled: true, Retention: "14d"},
+			wantVersion: "15", wantSize: "small", wantRetention: "14d"},
+		{name: "disabled backup", engine: "postgresql", backup: &platformv1.BackupConfig{},
+			wantVersion: "15", wantSize: "small"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+			db.Spec.Engine = tt.engine
+			db.Spec.Version = tt.version
+			db.Spec.Size = tt.size
+			db.Spec.ClassRef = tt.classRef
+			db.Spec.Backup = tt.backup
+
+			if err := (&DatabaseCustomDefaulter{}).Default(context.Background(), db); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if db.Spec.Version != tt.wantVersion || db.Spec.Size != tt.wantSize {
+				t.Fatalf("expected version %q and size %q, got %q and %q", tt.wantVersion, tt.wantSize, db.Spec.Version, db.Spec.Size)
+			}
+			if db.Spec.Backup != nil && db.Spec.Backup.Retention != tt.wantRetention {
+				t.Fatalf("expected retention %q, got %q", tt.wantRetention, db.Spec.Backup.Retention)
+			}
+		})
+	}
+}
+
+func TestDatabaseValidator_DeletionProtection(t *testing.T) {
+	v := newValidator(t)
+	db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+
+	if _, err := v.ValidateDelete(context.Background(), db); err != nil {
+		t.Fatalf("expected an unprotected Database to be deletable, got %v", err)
+	}
+
+	protect := true
+	db.Spec.DeletionProtection = &protect
+	_, err := v.ValidateDelete(context.Background(), db)
+	if !apierrors.IsForbidden(err) || !strings.Contains(err.Error(), "deletionProtection") {
+		t.Fatalf("expected delete to be forbidden, got %v", err)
+	}
+}
+
+func equalBool(a, b *bool) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+func fmtBool(b *bool) string {
+	if b == nil {
+		return "unset"
+	}
+	return strconv.FormatBool(*b)
+}
+
+func TestDatabaseValidator_DatabaseClass(t *testing.T) {
+	v := newValidator(t)
+	ctx := context.Background()
+	if err := v.Client.Create(ctx, &platformv1.DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres-standard"},
+		Spec:       platformv1.DatabaseClassSpec{Engine: "postgresql", Version: "15", Size: "medium"},
+	}); err != nil {
+		t.Fatalf("failed to create class: %v", err)
+	}
+	if err := v.Client.Create(ctx, &platformv1.DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "no-size"},
+		Spec:       platformv1.DatabaseClassSpec{Engine: "mysql", Version: "8.0"},
+	}); err != nil {
+		t.Fatalf("failed to create class: %v", err)
+	}
+
+	withClass := func(class string) *platformv1.Database {
+		db := databaseOwnedBy(platformv1.OwnerReference{Kind: "Tenant", Name: "acme"})
+		db.Spec.ClassRef = &platformv1.DatabaseClassReference{Name: class}
+		return db
+	}
+
+	// Guardrails are checked against the engine the class supplies
+	db := withClass("postgres-standard")
+	db.Spec.StatementTimeout = &metav1.Duration{Duration: 30 * time.Second}
+	if _, err := v.ValidateCreate(ctx, db); err != nil {
+		t.Fatalf("expected the class to supply the engine, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name, class, want string
+	}{
+		{"missing class", "postgres-premium", "spec.classRef.name"},
+		{"class without a size", "no-size", "spec.size"},
+	} {
+		_, err := v.ValidateCreate(ctx, withClass(tc.class))
+		if !apierrors.IsInvalid(err) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected an invalid %s, got %v", tc.name, tc.want, err)
+		}
+	}
+
+	// A Database whose class was deleted can still be updated, e.g. to remove
+	// its finalizer, but can't be pointed at a class that doesn't exist
+	orphan := withClass("postgres-premium")
+	updated := orphan.DeepCopy()
+	updated.Finalizers = nil
+	if _, err := v.ValidateUpdate(ctx, orphan, updated); err != nil {
+		t.Fatalf("expected an update with an unchanged class to be allowed, got %v", err)
+	}
+	if _, err := v.ValidateUpdate(ctx, withClass("postgres-standard"), orphan); !apierrors.IsInvalid(err) {
+		t.Fatalf("expected switching to a missing class to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// SetupTeamWebhookWithManager registers the Team validating webhook
+func SetupTeamWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&platformv1.Team{}).
+		WithValidator(&TeamCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-platform-company-com-v1-team,mutating=false,failurePolicy=fail,sideEffects=None,groups=platform.company.com,resources=teams,verbs=create,versions=v1,name=vteam-v1.kb.io,admissionReviewVersions=v1
+
+// TeamCustomValidator rejects new Teams that would take their tenant past
+// its MaxTeams quota
+type TeamCustomValidator struct {
+	Client client.Client
+}
+
+var _ admission.CustomValidator = &TeamCustomValidator{}
+
+// ValidateCreate checks the new Team fits within its tenant's MaxTeams quota
+func (v *TeamCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	team, ok := obj.(*platformv1.Team)
+	if !ok {
+		return nil, fmt.Errorf("expected a Team but got %T", obj)
+	}
+
+	tenantName, err := v.tenantOf(ctx, team)
+	if err != nil || tenantName == "" {
+		// The Team controller suspends Teams without a tenant
+		return nil, err
+	}
+	tenant := &platformv1.Tenant{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: tenantName}, tenant); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if tenant.Spec.Quotas == nil || tenant.Spec.Quotas.MaxTeams == nil {
+		return nil, nil
+	}
+	limit := int(*tenant.Spec.Quotas.MaxTeams)
+
+	// Count Teams by their tenant reference as well as the label, since the
+	// label is only added once the Team controller has reconciled them
+	teams := &platformv1.TeamList{}
+	if err := v.Client.List(ctx, teams); err != nil {
+		return nil, fmt.Errorf("failed to list teams: %w", err)
+	}
+	used := 0
+	for i := range teams.Items {
+		existing := &teams.Items[i]
+		if existing.Namespace == team.Namespace && existing.Name == team.Name {
+			continue
+		}
+		if existing.Labels["platform.company.com/tenant"] == tenantName ||
+			(existing.Spec.TenantRef != nil && existing.Spec.TenantRef.Name == tenantName) {
+			used++
+		}
+	}
+	if used < limit {
+		return nil, nil
+	}
+	return nil, apierrors.NewForbidden(
+		schema.GroupResource{Group: platformv1.GroupVersion.Group, Resource: "teams"},
+		team.Name,
+		fmt.Errorf("tenant %s is at its quota of %d team(s)", tenantName, limit))
+}
+
+// ValidateUpdate allows all updates
+func (v *TeamCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// ValidateDelete allows all deletes
+func (v *TeamCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// tenantOf returns the tenant a Team belongs to, resolved the same way as
+// the Team controller: its tenantRef, else its namespace's tenant label
+func (v *TeamCustomValidator) tenantOf(ctx context.Context, team *platformv1.Team) (string, error) {
+	if team.Spec.TenantRef != nil && team.Spec.TenantRef.Name != "" {
+		return team.Spec.TenantRef.Name, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: team.Namespace}, ns); err != nil {
+		return "", client.IgnoreNotFound(err)
+	}
+	return ns.Labels["platform.company.com/tenant"], nil
+}
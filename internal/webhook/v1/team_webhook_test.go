@@ -0,0 +1,80 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestTeamValidator_MaxTeams(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	maxTeams := int32(2)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&platformv1.Tenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+			Spec:       platformv1.TenantSpec{Quotas: &platformv1.TenantQuotas{MaxTeams: &maxTeams}},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-acme", Labels: map[string]string{"platform.company.com/tenant": "acme"}}},
+		// One labelled and one only referencing the tenant so far
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments", Labels: map[string]string{"platform.company.com/tenant": "acme"}}},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "search"}, Spec: platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "acme"}}},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "other"}, Spec: platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "globex"}}},
+	).Build()
+	v := &TeamCustomValidator{Client: cl}
+
+	for _, team := range []*platformv1.Team{
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "billing"}, Spec: platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "acme"}}},
+		// Tenant inferred from the namespace label
+		{ObjectMeta: metav1.ObjectMeta{Namespace: "tenant-acme", Name: "billing"}},
+	} {
+		_, err := v.ValidateCreate(context.Background(), team)
+		if !apierrors.IsForbidden(err) {
+			t.Fatalf("expected team %s/%s to be rejected at the quota, got %v", team.Namespace, team.Name, err)
+		}
+	}
+
+	// Other tenants, and tenants without a quota, are unaffected
+	team := &platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "billing"}, Spec: platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "globex"}}}
+	if _, err := v.ValidateCreate(context.Background(), team); err != nil {
+		t.Fatalf("expected a team of another tenant to be admitted, got %v", err)
+	}
+
+	maxTeams = 3
+	v.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&platformv1.Tenant{
+			ObjectMeta: metav1.ObjectMeta{Name: "acme"},
+			Spec:       platformv1.TenantSpec{Quotas: &platformv1.TenantQuotas{MaxTeams: &maxTeams}},
+		},
+		&platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "payments", Labels: map[string]string{"platform.company.com/tenant": "acme"}}},
+	).Build()
+	team = &platformv1.Team{ObjectMeta: metav1.ObjectMeta{Namespace: "dev", Name: "billing"}, Spec: platformv1.TeamSpec{TenantRef: &platformv1.ObjectReference{Name: "acme"}}}
+	if _, err := v.ValidateCreate(context.Background(), team); err != nil {
+		t.Fatalf("expected a team under the quota to be admitted, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Audit actions
+const (
+	AuditActionProvision   = "provision"
+	AuditActionReconfigure = "reconfigure"
+	AuditActionDeprovision = "deprovision"
+)
+
+// AuditEvent is one entry in the broker's audit trail: who asked for what,
+// and where the request came from
+type AuditEvent struct {
+	// Type is always "audit" so entries can be picked out of mixed logs
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	Action       string    `json:"action"`
+	DeploymentID string    `json:"deploymentId"`
+	ResourceType string    `json:"resourceType"`
+	ResourceName string    `json:"resourceName"`
+	Namespace    string    `json:"namespace"`
+	Team         string    `json:"team,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	Source       *Source   `json:"source,omitempty"`
+}
+
+// NewAuditEvent builds the audit entry for an accepted request
+func NewAuditEvent(action, deploymentID string, req ProvisionRequest) AuditEvent {
+	return AuditEvent{
+		Action:       action,
+		DeploymentID: deploymentID,
+		ResourceType: req.ResourceType,
+		ResourceName: req.ResourceName,
+		Namespace:    req.Namespace,
+		Team:         req.Team,
+		Owner:        req.Owner,
+		Source:       req.Source,
+	}
+}
+
+// AuditLog writes audit events as JSON lines
+type AuditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditLog creates an audit log writing to w
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{w: w}
+}
+
+// Record appends an event to the audit trail, stamping its type and time
+func (a *AuditLog) Record(e AuditEvent) error {
+	e.Type = "audit"
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog_RecordsProvenance(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAuditLog(&buf)
+
+	req := validProvisionRequest()
+	req.Source = &Source{Repository: "https://github.com/acme/platform", Revision: "4f2c1ab", CorrelationID: "chg-42"}
+	if err := audit.Record(NewAuditEvent(AuditActionProvision, "deploy-1", req)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := audit.Record(AuditEvent{Action: AuditActionDeprovision, DeploymentID: "deploy-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected one JSON line per event, got %q", buf.String())
+	}
+	var e AuditEvent
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatalf("failed to decode audit line: %v", err)
+	}
+	if e.Type != "audit" || e.Time.IsZero() || e.Action != AuditActionProvision || e.Team != "Team/platform" {
+		t.Fatalf("unexpected audit event: %+v", e)
+	}
+	if e.Source == nil || e.Source.Revision != "4f2c1ab" || e.Source.CorrelationID != "chg-42" {
+		t.Fatalf("expected the source to be recorded, got %+v", e.Source)
+	}
+	if strings.Contains(lines[1], `"source"`) {
+		t.Fatalf("expected no source on an event without one, got %s", lines[1])
+	}
+}
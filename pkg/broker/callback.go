@@ -21,113 +21,383 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"net/http"
 	"os"
+	"sync"
 	"time"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/tracing"
+	"github.com/aykay76/kidp/pkg/version"
 )
 
+// CallbackConfig controls how callbacks are retried
+type CallbackConfig struct {
+	// MaxRetries is how many times a failed callback is retried after the
+	// first attempt
+	MaxRetries int
+
+	// BaseBackoff is the wait before the first retry; it doubles for each
+	// further retry up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// JitterFraction randomizes each wait by up to this fraction either way
+	// (0.2 = ±20%), so brokers retrying after a manager restart don't all
+	// call back at once
+	JitterFraction float64
+
+	// URLFailureThreshold is how many deliveries in a row a callback URL may
+	// fail before it is tried after the others. URLRetryAfter is how long it
+	// stays at the back before it is tried in its usual place again.
+	URLFailureThreshold int
+	URLRetryAfter       time.Duration
+}
+
+// DefaultCallbackConfig retries three times, after about 1s, 2s and 4s
+func DefaultCallbackConfig() CallbackConfig {
+	return CallbackConfig{
+		MaxRetries:     3,
+		BaseBackoff:    time.Second,
+		MaxBackoff:     30 * time.Second,
+		JitterFraction: 0.2,
+
+		URLFailureThreshold: 3,
+		URLRetryAfter:       30 * time.Second,
+	}
+}
+
+// backoff returns the wait before the given retry, counting from 1
+func (c CallbackConfig) backoff(retry int) time.Duration {
+	d := c.BaseBackoff
+	for i := 1; i < retry && (c.MaxBackoff <= 0 || d < c.MaxBackoff); i++ {
+		d *= 2
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	if c.JitterFraction > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * c.JitterFraction * float64(d))
+	}
+	return d
+}
+
 // CallbackClient handles webhook callbacks to the manager
 type CallbackClient struct {
-	httpClient *http.Client
-	maxRetries int
+	httpClient  *http.Client
+	config      CallbackConfig
+	deadLetters DeadLetterStore
+	metrics     *Metrics
+
+	// urlHealth tracks recent delivery failures per callback URL
+	mu        sync.Mutex
+	urlHealth map[string]*callbackURLHealth
+}
+
+// callbackURLHealth counts the deliveries to a callback URL that failed in
+// a row, and when the last one did
+type callbackURLHealth struct {
+	failures    int
+	lastFailure time.Time
 }
 
-// NewCallbackClient creates a new callback client with default configuration
-func NewCallbackClient() *CallbackClient {
+// NewCallbackClient creates a callback client that retries as config says
+func NewCallbackClient(config CallbackConfig) *CallbackClient {
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	}
 	return &CallbackClient{
 		httpClient: &http.Client{
 			Timeout: 5 * time.Second,
 		},
-		maxRetries: 3,
+		config:    config,
+		urlHealth: make(map[string]*callbackURLHealth),
 	}
 }
 
-// NotifyStatus sends a status update to the manager via webhook
-// Uses exponential backoff retry strategy: 1s, 2s, 4s
-func (c *CallbackClient) NotifyStatus(ctx context.Context, callbackURL string, payload CallbackRequest) error {
+// SetDeadLetterStore keeps callbacks that exhaust their retries in store so
+// ReplayDeadLetters can deliver them later. A nil store drops them.
+func (c *CallbackClient) SetDeadLetterStore(store DeadLetterStore) {
+	c.deadLetters = store
+}
+
+// SetMetrics counts delivery attempts and undelivered callbacks in metrics
+func (c *CallbackClient) SetMetrics(metrics *Metrics) {
+	c.metrics = metrics
+}
+
+// NotifyStatus sends a status update to the manager via webhook. Each
+// attempt tries callbackURL and then fallbackURLs, such as the other replica
+// of a manager HA pair, until one takes the update; URLs that keep failing
+// are tried last. Transport errors and 5xx responses are retried with
+// jittered exponential backoff; other responses are final, as resending the
+// same update won't change them. An update still undelivered after the last
+// retry is dead-lettered.
+func (c *CallbackClient) NotifyStatus(ctx context.Context, callbackURL string, payload CallbackRequest, fallbackURLs ...string) error {
 	var lastErr error
+	attempts := c.config.MaxRetries + 1
+	urls := append([]string{callbackURL}, fallbackURLs...)
+
+	// Every attempt carries the same nonce so the manager processes the
+	// update once even if an attempt it handled looked failed to us
+	if payload.Nonce == "" {
+		payload.Nonce = newCallbackNonce()
+	}
 
-	for attempt := 0; attempt < c.maxRetries; attempt++ {
+	for attempt := 0; attempt < attempts; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff: 1s, 2s, 4s
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			log.Printf("Callback attempt %d/%d failed, retrying in %v", attempt, c.maxRetries, backoff)
+			backoff := c.config.backoff(attempt)
+			log.Printf("Callback attempt %d/%d failed, retrying in %v", attempt, attempts, backoff)
 
 			select {
 			case <-time.After(backoff):
 				// Continue to retry
 			case <-ctx.Done():
+				c.metrics.CallbackFailed(CallbackFailureCancelled)
 				return fmt.Errorf("callback cancelled: %w", ctx.Err())
 			}
+			c.metrics.CallbackRetry()
 		}
 
-		// Marshal payload to JSON
-		body, err := json.Marshal(payload)
-		if err != nil {
-			return fmt.Errorf("failed to marshal callback payload: %w", err)
+		retryable, err := c.sendAny(ctx, urls, payload, fmt.Sprintf("attempt %d/%d", attempt+1, attempts))
+		if err == nil {
+			c.metrics.CallbackDelivered()
+			// Anything dead-lettered earlier for the deployment is superseded
+			c.discardDeadLetters(payload.DeploymentID)
+			return nil
 		}
-
-		// Create HTTP request
-		req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, bytes.NewBuffer(body))
-		if err != nil {
-			return fmt.Errorf("failed to create callback request: %w", err)
+		lastErr = err
+		if !retryable {
+			c.metrics.CallbackFailed(CallbackFailureRejected)
+			return lastErr
 		}
+	}
 
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("User-Agent", "KIDP-Broker/0.1.0")
+	err := fmt.Errorf("callback failed after %d attempts: %w", attempts, lastErr)
+	c.metrics.CallbackFailed(CallbackFailureRetriesExhausted)
+	c.deadLetter(urls, payload, err)
+	return err
+}
 
-		// Add signature headers using Ed25519. Broker should provide its name via BROKER_NAME
-		brokerName := os.Getenv("BROKER_NAME")
-		if brokerName == "" {
-			brokerName = "unknown-broker"
+// sendAny makes one delivery attempt, trying each callback URL in turn
+// until one accepts the update or rejects it outright. It reports whether a
+// failure is worth retrying.
+func (c *CallbackClient) sendAny(ctx context.Context, urls []string, payload CallbackRequest, attempt string) (retryable bool, err error) {
+	for _, u := range c.orderURLs(urls) {
+		log.Printf("Sending callback to %s (%s): deploymentId=%s, status=%s, phase=%s",
+			u, attempt, payload.DeploymentID, payload.Status, payload.Phase)
+		retryable, err = c.send(ctx, u, payload)
+		c.metrics.CallbackAttempt(err)
+		c.recordURLResult(u, retryable && err != nil)
+		if err == nil || !retryable {
+			return retryable, err
 		}
+	}
+	return retryable, err
+}
 
-		// Timestamp header
-		timestamp := time.Now().UTC().Format(time.RFC3339)
-		req.Header.Set("X-KIDP-Broker-Name", brokerName)
-		req.Header.Set("X-KIDP-Timestamp", timestamp)
+// orderURLs returns the distinct, non-empty URLs in the order given, except
+// that those which failed URLFailureThreshold deliveries in a row within
+// URLRetryAfter come last
+func (c *CallbackClient) orderURLs(urls []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-		// Sign the payload: signature over timestamp + '.' + body
-		sig, pubKeyB64, sigErr := signCallback(body, timestamp)
-		if sigErr != nil {
-			log.Printf("Failed to compute callback signature: %v", sigErr)
-		} else {
-			req.Header.Set("X-KIDP-Signature", sig)
-			// Optionally include public key for first-time registration
-			if pubKeyB64 != "" {
-				req.Header.Set("X-KIDP-Public-Key", pubKeyB64)
-			}
+	seen := make(map[string]bool, len(urls))
+	var healthy, failing []string
+	for _, u := range urls {
+		if u == "" || seen[u] {
+			continue
 		}
+		seen[u] = true
+		h := c.urlHealth[u]
+		if h != nil && c.config.URLFailureThreshold > 0 && h.failures >= c.config.URLFailureThreshold &&
+			time.Since(h.lastFailure) < c.config.URLRetryAfter {
+			failing = append(failing, u)
+			continue
+		}
+		healthy = append(healthy, u)
+	}
+	return append(healthy, failing...)
+}
+
+// recordURLResult updates a callback URL's health after a delivery. Only
+// transport errors and 5xx responses count as the URL failing.
+func (c *CallbackClient) recordURLResult(callbackURL string, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !failed {
+		delete(c.urlHealth, callbackURL)
+		return
+	}
+	h := c.urlHealth[callbackURL]
+	if h == nil {
+		h = &callbackURLHealth{}
+		c.urlHealth[callbackURL] = h
+	}
+	h.failures++
+	h.lastFailure = time.Now()
+	if h.failures == c.config.URLFailureThreshold {
+		log.Printf("Callback URL %s failed %d deliveries in a row, trying it last", callbackURL, h.failures)
+	}
+}
 
-		// Log the attempt
-		log.Printf("Sending callback to %s (attempt %d/%d): deploymentId=%s, status=%s, phase=%s",
-			callbackURL, attempt+1, c.maxRetries, payload.DeploymentID, payload.Status, payload.Phase)
+// send makes one delivery attempt, reporting whether a failure is worth
+// retrying
+func (c *CallbackClient) send(ctx context.Context, callbackURL string, payload CallbackRequest) (retryable bool, err error) {
+	// Marshal payload to JSON
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal callback payload: %w", err)
+	}
 
-		// Send request
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			lastErr = fmt.Errorf("callback request failed: %w", err)
-			log.Printf("Callback request error: %v", lastErr)
+	// Create HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", callbackURL, bytes.NewBuffer(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create callback request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	version.SetHeaders(req, version.ComponentBroker)
+	tracing.Inject(ctx, req.Header)
+	if payload.CallbackToken != "" {
+		req.Header.Set(callbacktoken.Header, payload.CallbackToken)
+	}
+
+	setSignatureHeaders(req, body)
+
+	// Send request
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		err = fmt.Errorf("callback request failed: %w", err)
+		log.Printf("Callback request error: %v", err)
+		return true, err
+	}
+	resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		log.Printf("Callback successful: deploymentId=%s, status=%d", payload.DeploymentID, resp.StatusCode)
+		return false, nil
+	}
+
+	// Non-2xx response
+	log.Printf("Callback failed with status %d", resp.StatusCode)
+	return resp.StatusCode >= 500, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
+
+// deadLetter stores an undelivered callback for replay, logging rather than
+// failing if it can't
+func (c *CallbackClient) deadLetter(urls []string, payload CallbackRequest, cause error) {
+	if c.deadLetters == nil {
+		return
+	}
+	letter := DeadLetter{
+		ID:            payload.Nonce,
+		CallbackURL:   urls[0],
+		FallbackURLs:  urls[1:],
+		Payload:       payload,
+		FailedAt:      time.Now().UTC(),
+		Error:         cause.Error(),
+		CallbackToken: payload.CallbackToken,
+	}
+	if err := c.deadLetters.Write(letter); err != nil {
+		log.Printf("Failed to dead-letter %s callback for deployment %s: %v", payload.Status, payload.DeploymentID, err)
+		return
+	}
+	log.Printf("Dead-lettered %s callback for deployment %s", payload.Status, payload.DeploymentID)
+}
+
+// discardDeadLetters drops the deployment's dead letters once a newer
+// update has been delivered, so replaying them can't roll its status back
+func (c *CallbackClient) discardDeadLetters(deploymentID string) {
+	if c.deadLetters == nil {
+		return
+	}
+	letters, err := c.deadLetters.List()
+	if err != nil {
+		log.Printf("Failed to list dead letters: %v", err)
+		return
+	}
+	for _, letter := range letters {
+		if letter.Payload.DeploymentID != deploymentID {
 			continue
 		}
+		if err := c.deadLetters.Delete(letter.ID); err != nil {
+			log.Printf("Failed to discard superseded dead letter %s: %v", letter.ID, err)
+		}
+	}
+}
 
-		// Check response status
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			resp.Body.Close()
-			log.Printf("Callback successful: deploymentId=%s, status=%d", payload.DeploymentID, resp.StatusCode)
-			return nil
+// ReplayDeadLetters tries once to deliver each dead-lettered callback,
+// oldest first, and returns how many were delivered. Delivered letters and
+// letters the manager rejected outright are deleted. When a deployment's
+// letter still can't be delivered, its later letters wait for the next
+// replay so the manager sees its updates in order.
+func (c *CallbackClient) ReplayDeadLetters(ctx context.Context) (int, error) {
+	if c.deadLetters == nil {
+		return 0, nil
+	}
+	letters, err := c.deadLetters.List()
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	blocked := map[string]bool{}
+	for _, letter := range letters {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+		deploymentID := letter.Payload.DeploymentID
+		if blocked[deploymentID] {
+			continue
 		}
 
-		// Non-2xx response
-		resp.Body.Close()
-		lastErr = fmt.Errorf("callback returned status %d", resp.StatusCode)
-		log.Printf("Callback failed with status %d", resp.StatusCode)
+		payload := letter.Payload
+		payload.CallbackToken = letter.CallbackToken
+		urls := append([]string{letter.CallbackURL}, letter.FallbackURLs...)
+		retryable, err := c.sendAny(ctx, urls, payload, "replay")
+		if err != nil && retryable {
+			blocked[deploymentID] = true
+			continue
+		}
+		if err != nil {
+			log.Printf("Dropping dead-lettered callback for deployment %s: %v", deploymentID, err)
+			c.metrics.CallbackFailed(CallbackFailureRejected)
+		} else {
+			delivered++
+			c.metrics.CallbackDelivered()
+		}
+		if err := c.deadLetters.Delete(letter.ID); err != nil {
+			log.Printf("Failed to delete dead letter %s: %v", letter.ID, err)
+		}
 	}
+	return delivered, nil
+}
 
-	return fmt.Errorf("callback failed after %d attempts: %w", c.maxRetries, lastErr)
+// RunDeadLetterReplayer replays dead letters every interval until ctx is done
+func (c *CallbackClient) RunDeadLetterReplayer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := c.ReplayDeadLetters(ctx); err != nil {
+				log.Printf("Failed to replay dead letters: %v", err)
+			} else if n > 0 {
+				log.Printf("Replayed %d dead-lettered callback(s)", n)
+			}
+		}
+	}
 }
 
 // NotifySuccess is a convenience method to send a success callback
@@ -165,6 +435,47 @@ func (c *CallbackClient) NotifyProgress(ctx context.Context, callbackURL, deploy
 	return c.NotifyStatus(ctx, callbackURL, payload)
 }
 
+// newCallbackNonce returns a random nonce for a status update
+func newCallbackNonce() string {
+	b := make([]byte, 16)
+	if _, err := randRead(b); err != nil {
+		return fmt.Sprintf("%x-%x", time.Now().UnixNano(), fallbackSeq.Add(1))
+	}
+	return hex.EncodeToString(b)
+}
+
+// setSignatureHeaders identifies the broker and signs body with its Ed25519
+// key, so the receiver can verify the request came from this broker
+func setSignatureHeaders(req *http.Request, body []byte) {
+	// Broker should provide its name via BROKER_NAME
+	brokerName := os.Getenv("BROKER_NAME")
+	if brokerName == "" {
+		brokerName = "unknown-broker"
+	}
+
+	// Timestamp header
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	req.Header.Set("X-KIDP-Broker-Name", brokerName)
+	// The manager looks the broker up in its default namespace when unset
+	if brokerNamespace := os.Getenv("BROKER_NAMESPACE"); brokerNamespace != "" {
+		req.Header.Set("X-KIDP-Broker-Namespace", brokerNamespace)
+	}
+	req.Header.Set("X-KIDP-Timestamp", timestamp)
+
+	// Sign the payload: signature over timestamp + '.' + body
+	sig, pubKeyB64, sigErr := signCallback(body, timestamp)
+	if sigErr != nil {
+		log.Printf("Failed to compute request signature: %v", sigErr)
+		return
+	}
+	req.Header.Set("X-KIDP-Signature", sig)
+	// Optionally include public key for first-time registration
+	if pubKeyB64 != "" {
+		req.Header.Set("X-KIDP-Public-Key", pubKeyB64)
+		req.Header.Set("X-KIDP-Key-ID", platformv1.CallbackKeyID(pubKeyB64))
+	}
+}
+
 // signCallback signs the message using Ed25519 private key provided via
 // BROKER_PRIVATE_KEY (base64) or BROKER_PRIVATE_KEY_PATH (file). It returns
 // base64(signature) and base64(publicKey) so the broker may include the public key
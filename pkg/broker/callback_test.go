@@ -0,0 +1,407 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/aykay76/kidp/pkg/callbacktoken"
+	"github.com/aykay76/kidp/pkg/version"
+)
+
+func TestCallbackClient_SendsVersionedUserAgent(t *testing.T) {
+	orig := version.Version
+	version.Version = "v1.2.3"
+	defer func() { version.Version = orig }()
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	err := NewCallbackClient(DefaultCallbackConfig()).NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ua := got.Get("User-Agent"); ua != "KIDP-Broker/v1.2.3" {
+		t.Fatalf("expected versioned User-Agent, got %q", ua)
+	}
+	if v := got.Get(version.HeaderVersion); v != "v1.2.3" {
+		t.Fatalf("expected %s header to be v1.2.3, got %q", version.HeaderVersion, v)
+	}
+}
+
+func TestCallbackClient_EchoesCallbackToken(t *testing.T) {
+	var got http.Header
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	payload := CallbackRequest{DeploymentID: "deploy-1", Status: "success", CallbackToken: "tok-123"}
+	if err := NewCallbackClient(DefaultCallbackConfig()).NotifyStatus(context.Background(), srv.URL, payload); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tok := got.Get(callbacktoken.Header); tok != "tok-123" {
+		t.Fatalf("expected callback token header, got %q", tok)
+	}
+	if strings.Contains(string(body), "tok-123") {
+		t.Fatalf("callback token must not appear in the body: %s", body)
+	}
+}
+
+func TestCallbackClient_KeepsNonceAcrossRetries(t *testing.T) {
+	var nonces []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got CallbackRequest
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		nonces = append(nonces, got.Nonce)
+		if len(nonces) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := NewCallbackClient(fastRetries(3)).NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nonces) != 2 || nonces[0] == "" || nonces[0] != nonces[1] {
+		t.Fatalf("expected both attempts to carry the same nonce, got %q", nonces)
+	}
+}
+
+// fastRetries retries without waiting long, to keep tests quick
+func fastRetries(maxRetries int) CallbackConfig {
+	return CallbackConfig{MaxRetries: maxRetries, BaseBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, JitterFraction: 0.5}
+}
+
+func TestCallbackClient_RetriesServerErrors(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	if err := NewCallbackClient(fastRetries(3)).NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"}); err != nil {
+		t.Fatalf("expected the callback to succeed on the third attempt, got %v", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Fatalf("expected 3 attempts, got %d", n)
+	}
+
+	// Running out of retries reports the last failure
+	attempts.Store(0)
+	err := NewCallbackClient(fastRetries(1)).NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"})
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the callback to fail after 2 attempts, got %v", err)
+	}
+}
+
+func TestCallbackClient_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	err := NewCallbackClient(fastRetries(3)).NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected the 401 to be returned, got %v", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Fatalf("expected a 4xx not to be retried, got %d attempts", n)
+	}
+}
+
+func TestCallbackClient_Metrics(t *testing.T) {
+	var attempts atomic.Int32
+	var status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+
+	metrics := NewMetrics(prometheus.NewRegistry())
+	c := NewCallbackClient(fastRetries(2))
+	c.SetMetrics(metrics)
+	notify := func() error {
+		return c.NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"})
+	}
+
+	status.Store(http.StatusOK)
+	if err := notify(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := testutil.ToFloat64(metrics.callbackSuccesses); got != 1 {
+		t.Fatalf("expected 1 delivered callback, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.callbackAttempts.WithLabelValues("success")); got != 1 {
+		t.Fatalf("expected 1 successful attempt, got %v", got)
+	}
+
+	// Every attempt fails, so both retries are used before giving up
+	status.Store(http.StatusServiceUnavailable)
+	if err := notify(); err == nil {
+		t.Fatal("expected the callback to fail")
+	}
+	if got := testutil.ToFloat64(metrics.callbackAttempts.WithLabelValues("failure")); got != 3 {
+		t.Fatalf("expected 3 failed attempts, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.callbackRetries); got != 2 {
+		t.Fatalf("expected 2 retries, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.callbackFailures.WithLabelValues(CallbackFailureRetriesExhausted)); got != 1 {
+		t.Fatalf("expected 1 callback to exhaust its retries, got %v", got)
+	}
+
+	status.Store(http.StatusUnauthorized)
+	if err := notify(); err == nil {
+		t.Fatal("expected the callback to be rejected")
+	}
+	if got := testutil.ToFloat64(metrics.callbackFailures.WithLabelValues(CallbackFailureRejected)); got != 1 {
+		t.Fatalf("expected 1 rejected callback, got %v", got)
+	}
+	if got := testutil.ToFloat64(metrics.callbackSuccesses); got != 1 {
+		t.Fatalf("expected failures not to count as delivered, got %v", got)
+	}
+}
+
+func TestCallbackConfig_Backoff(t *testing.T) {
+	config := CallbackConfig{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for retry, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := config.backoff(retry); got != want {
+			t.Fatalf("expected retry %d to wait %v, got %v", retry, want, got)
+		}
+	}
+
+	config.JitterFraction = 0.2
+	for i := 0; i < 100; i++ {
+		if got := config.backoff(2); got < 1600*time.Millisecond || got > 2400*time.Millisecond {
+			t.Fatalf("expected 2s ±20%%, got %v", got)
+		}
+	}
+}
+
+func TestCallbackClient_DeadLettersAndReplays(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var up atomic.Bool
+	var received []CallbackRequest
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var payload CallbackRequest
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload)
+		tokens = append(tokens, r.Header.Get(callbacktoken.Header))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := NewCallbackClient(fastRetries(1))
+	c.SetDeadLetterStore(store)
+
+	// The endpoint keeps failing, so both updates are dead-lettered
+	progress := CallbackRequest{DeploymentID: "deploy-1", Status: "in-progress", Phase: "Provisioning", CallbackToken: "tok-1"}
+	final := CallbackRequest{DeploymentID: "deploy-1", Status: "success", Phase: "Ready", CallbackToken: "tok-1"}
+	for _, payload := range []CallbackRequest{progress, final} {
+		if err := c.NotifyStatus(context.Background(), srv.URL, payload); err == nil {
+			t.Fatalf("expected %s callback to fail", payload.Status)
+		}
+	}
+	letters, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].Payload.Status != "in-progress" || letters[1].Payload.Status != "success" {
+		t.Fatalf("expected both callbacks dead-lettered in order, got %+v", letters)
+	}
+
+	// Still down: nothing is delivered and nothing is lost
+	if n, err := c.ReplayDeadLetters(context.Background()); err != nil || n != 0 {
+		t.Fatalf("expected no deliveries while the endpoint is down, got %d, %v", n, err)
+	}
+	if letters, _ := store.List(); len(letters) != 2 {
+		t.Fatalf("expected the dead letters to be kept, got %d", len(letters))
+	}
+
+	// Once it recovers the queue drains in order, with the original nonce and token
+	up.Store(true)
+	if n, err := c.ReplayDeadLetters(context.Background()); err != nil || n != 2 {
+		t.Fatalf("expected 2 replayed callbacks, got %d, %v", n, err)
+	}
+	if len(received) != 2 || received[0].Status != "in-progress" || received[1].Status != "success" {
+		t.Fatalf("expected the callbacks replayed in order, got %+v", received)
+	}
+	if received[1].Nonce != letters[1].ID || tokens[1] != "tok-1" {
+		t.Fatalf("expected the replay to keep the nonce and token, got nonce %q token %q", received[1].Nonce, tokens[1])
+	}
+	if letters, _ := store.List(); len(letters) != 0 {
+		t.Fatalf("expected the dead letter queue to be drained, got %+v", letters)
+	}
+}
+
+func TestCallbackClient_DeliveredUpdateSupersedesDeadLetters(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var up atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c := NewCallbackClient(fastRetries(0))
+	c.SetDeadLetterStore(store)
+	_ = c.NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "in-progress"})
+	_ = c.NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-2", Status: "in-progress"})
+
+	up.Store(true)
+	if err := c.NotifyStatus(context.Background(), srv.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	letters, _ := store.List()
+	if len(letters) != 1 || letters[0].Payload.DeploymentID != "deploy-2" {
+		t.Fatalf("expected only deploy-2's dead letter to remain, got %+v", letters)
+	}
+}
+
+func TestCallbackClient_FailsOverAcrossCallbackURLs(t *testing.T) {
+	var primaryUp atomic.Bool
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		if !primaryUp.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer secondary.Close()
+
+	config := fastRetries(0)
+	config.URLFailureThreshold = 2
+	config.URLRetryAfter = time.Hour
+	c := NewCallbackClient(config)
+	notify := func() {
+		t.Helper()
+		if err := c.NotifyStatus(context.Background(), primary.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "in-progress"}, secondary.URL); err != nil {
+			t.Fatalf("expected the callback to fail over, got %v", err)
+		}
+	}
+
+	// Each update fails over to the secondary within a single attempt
+	notify()
+	notify()
+	if p, s := primaryHits.Load(), secondaryHits.Load(); p != 2 || s != 2 {
+		t.Fatalf("expected the primary tried first each time, got primary=%d secondary=%d", p, s)
+	}
+
+	// Having failed consistently, the primary is skipped in favour of the secondary
+	notify()
+	if p, s := primaryHits.Load(), secondaryHits.Load(); p != 2 || s != 3 {
+		t.Fatalf("expected the failing primary to be skipped, got primary=%d secondary=%d", p, s)
+	}
+
+	// Once its retry window has passed it is tried in its place again
+	primaryUp.Store(true)
+	c.config.URLRetryAfter = 0
+	notify()
+	if p, s := primaryHits.Load(), secondaryHits.Load(); p != 3 || s != 3 {
+		t.Fatalf("expected the recovered primary to be used, got primary=%d secondary=%d", p, s)
+	}
+}
+
+func TestCallbackClient_DeadLettersKeepFallbackURLs(t *testing.T) {
+	store, err := NewFileDeadLetterStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	var up atomic.Bool
+	var delivered atomic.Int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		delivered.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer fallback.Close()
+
+	c := NewCallbackClient(fastRetries(1))
+	c.SetDeadLetterStore(store)
+	if err := c.NotifyStatus(context.Background(), down.URL, CallbackRequest{DeploymentID: "deploy-1", Status: "success"}, fallback.URL); err == nil {
+		t.Fatal("expected the callback to fail with every URL down")
+	}
+	letters, _ := store.List()
+	if len(letters) != 1 || letters[0].CallbackURL != down.URL || len(letters[0].FallbackURLs) != 1 || letters[0].FallbackURLs[0] != fallback.URL {
+		t.Fatalf("expected the dead letter to keep both URLs, got %+v", letters)
+	}
+
+	// The replay reaches the fallback while the primary stays down
+	up.Store(true)
+	if n, err := c.ReplayDeadLetters(context.Background()); err != nil || n != 1 || delivered.Load() != 1 {
+		t.Fatalf("expected the replay delivered through the fallback, got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ErrUnsupportedCapability is returned when a request asks for something the
+// broker does not advertise
+var ErrUnsupportedCapability = errors.New("unsupported capability")
+
+// Capabilities is what the broker advertises it can provision
+type Capabilities struct {
+	ResourceTypes []ResourceCapability `json:"resourceTypes"`
+}
+
+// ResourceCapability describes the providers, regions and sizes supported for
+// one resource type. Empty Regions or Sizes means any value is accepted.
+type ResourceCapability struct {
+	Type      string   `json:"type"`
+	Providers []string `json:"providers"`
+	Regions   []string `json:"regions,omitempty"`
+
+	// ProviderRegions overrides Regions for individual providers
+	ProviderRegions map[string][]string `json:"providerRegions,omitempty"`
+
+	Sizes map[string]SizeMapping `json:"sizes,omitempty"`
+}
+
+// RegionsFor returns the regions a provider is available in; empty means any region
+func (rc *ResourceCapability) RegionsFor(provider string) []string {
+	for p, regions := range rc.ProviderRegions {
+		if strings.EqualFold(p, provider) {
+			return regions
+		}
+	}
+	return rc.Regions
+}
+
+// ProviderRegions lists the regions one provider of a resource type is available in
+type ProviderRegions struct {
+	ResourceType string   `json:"resourceType"`
+	Provider     string   `json:"provider"`
+	Regions      []string `json:"regions"`
+
+	// AnyRegion is set when the broker does not restrict the provider's region
+	AnyRegion bool `json:"anyRegion,omitempty"`
+}
+
+// RegionsResponse is returned by the regions endpoint
+type RegionsResponse struct {
+	Regions []ProviderRegions `json:"regions"`
+}
+
+// SizeMapping maps a t-shirt size to the resources it is provisioned with
+type SizeMapping struct {
+	CPU     string `json:"cpu,omitempty"`
+	Memory  string `json:"memory,omitempty"`
+	Storage string `json:"storage,omitempty"`
+}
+
+// DefaultCapabilities is advertised when no capabilities file is configured
+func DefaultCapabilities() *Capabilities {
+	return &Capabilities{
+		ResourceTypes: []ResourceCapability{{
+			Type:      platformv1.ResourceTypeDatabase,
+			Providers: []string{"postgresql", "mysql", "mongodb", "redis"},
+			Sizes: map[string]SizeMapping{
+				"small":  {CPU: "1", Memory: "2Gi", Storage: "10Gi"},
+				"medium": {CPU: "2", Memory: "4Gi", Storage: "50Gi"},
+				"large":  {CPU: "4", Memory: "8Gi", Storage: "200Gi"},
+				"xlarge": {CPU: "8", Memory: "16Gi", Storage: "500Gi"},
+			},
+		}, {
+			Type:      platformv1.ResourceTypeCache,
+			Providers: []string{"redis", "memcached"},
+			Sizes: map[string]SizeMapping{
+				"small":  {CPU: "500m", Memory: "1Gi"},
+				"medium": {CPU: "1", Memory: "4Gi"},
+				"large":  {CPU: "2", Memory: "16Gi"},
+				"xlarge": {CPU: "4", Memory: "64Gi"},
+			},
+		}, {
+			Type:      platformv1.ResourceTypeTopic,
+			Providers: []string{"kafka", "rabbitmq", "nats"},
+		}},
+	}
+}
+
+// ParseCapabilities parses a YAML or JSON capability advertisement
+func ParseCapabilities(data []byte) (*Capabilities, error) {
+	var caps Capabilities
+	if err := yaml.UnmarshalStrict(data, &caps); err != nil {
+		return nil, fmt.Errorf("failed to parse capabilities: %w", err)
+	}
+	if len(caps.ResourceTypes) == 0 {
+		return nil, fmt.Errorf("capabilities must list at least one resource type")
+	}
+
+	seen := make(map[string]bool)
+	for i, rc := range caps.ResourceTypes {
+		if rc.Type == "" {
+			return nil, fmt.Errorf("resourceTypes[%d].type is required", i)
+		}
+		if len(rc.Providers) == 0 {
+			return nil, fmt.Errorf("resource type %q must list at least one provider", rc.Type)
+		}
+		t := strings.ToLower(rc.Type)
+		if seen[t] {
+			return nil, fmt.Errorf("resource type %q is listed more than once", rc.Type)
+		}
+		seen[t] = true
+		for p := range rc.ProviderRegions {
+			if !containsFold(rc.Providers, p) {
+				return nil, fmt.Errorf("resource type %q has providerRegions for unlisted provider %q", rc.Type, p)
+			}
+		}
+	}
+	return &caps, nil
+}
+
+// ResourceType returns the capability advertised for a resource type
+func (c *Capabilities) ResourceType(resourceType string) (*ResourceCapability, bool) {
+	for i := range c.ResourceTypes {
+		if NormalizeResourceType(c.ResourceTypes[i].Type) == NormalizeResourceType(resourceType) {
+			return &c.ResourceTypes[i], true
+		}
+	}
+	return nil, false
+}
+
+// ValidateRequest checks the request's resource type, provider, region and
+// size against the advertised capabilities. The provider is read from
+// spec.provider, falling back to spec.engine for databases.
+func (c *Capabilities) ValidateRequest(req *ProvisionRequest) error {
+	rc, ok := c.ResourceType(req.ResourceType)
+	if !ok {
+		return fmt.Errorf("%w: resource type %q", ErrUnsupportedCapability, req.ResourceType)
+	}
+
+	provider := specString(req.Spec, "provider")
+	if provider == "" {
+		provider = specString(req.Spec, "engine")
+	}
+	if provider != "" && !containsFold(rc.Providers, provider) {
+		return fmt.Errorf("%w: provider %q for %s (supported: %s)", ErrUnsupportedCapability, provider, rc.Type, strings.Join(rc.Providers, ", "))
+	}
+	if region := specString(req.Spec, "region"); region != "" {
+		if regions := rc.RegionsFor(provider); len(regions) > 0 && !containsFold(regions, region) {
+			return fmt.Errorf("%w: region %q for %s (supported: %s)", ErrUnsupportedCapability, region, rc.Type, strings.Join(regions, ", "))
+		}
+	}
+	if size := specString(req.Spec, "size"); size != "" && len(rc.Sizes) > 0 {
+		if _, ok := rc.Sizes[size]; !ok {
+			return fmt.Errorf("%w: size %q for %s", ErrUnsupportedCapability, size, rc.Type)
+		}
+	}
+	return nil
+}
+
+// Regions lists the regions for each provider, optionally filtered by
+// resource type and provider
+func (c *Capabilities) Regions(resourceType, provider string) []ProviderRegions {
+	result := []ProviderRegions{}
+	for i := range c.ResourceTypes {
+		rc := &c.ResourceTypes[i]
+		if resourceType != "" && !strings.EqualFold(rc.Type, resourceType) {
+			continue
+		}
+		for _, p := range rc.Providers {
+			if provider != "" && !strings.EqualFold(p, provider) {
+				continue
+			}
+			regions := rc.RegionsFor(p)
+			result = append(result, ProviderRegions{
+				ResourceType: rc.Type,
+				Provider:     p,
+				Regions:      append([]string{}, regions...),
+				AnyRegion:    len(regions) == 0,
+			})
+		}
+	}
+	return result
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// CapabilityStore holds the current capabilities, optionally loaded from a
+// file such as a mounted ConfigMap key
+type CapabilityStore struct {
+	path string
+
+	mu      sync.RWMutex
+	current *Capabilities
+	raw     []byte
+
+	// err is the outcome of the last reload
+	err error
+}
+
+// NewCapabilityStore creates a store serving the default capabilities. If
+// path is set, the file is loaded and must parse.
+func NewCapabilityStore(path string) (*CapabilityStore, error) {
+	s := &CapabilityStore{path: path, current: DefaultCapabilities()}
+	if path == "" {
+		return s, nil
+	}
+	if _, err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the current capabilities
+func (s *CapabilityStore) Get() *Capabilities {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Err returns why the last reload failed, or nil if the file currently on
+// disk is what is being served
+func (s *CapabilityStore) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.err
+}
+
+// Reload re-reads the capabilities file, reporting whether it changed. An
+// unreadable or invalid file leaves the current capabilities in place.
+func (s *CapabilityStore) Reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+	changed, err := s.reload()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	return changed, err
+}
+
+func (s *CapabilityStore) reload() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read capabilities file %s: %w", s.path, err)
+	}
+
+	s.mu.RLock()
+	unchanged := s.raw != nil && bytes.Equal(data, s.raw)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	caps, err := ParseCapabilities(data)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.current = caps
+	s.raw = data
+	return true, nil
+}
+
+// Watch polls the capabilities file until ctx is done. Polling rather than
+// inotify copes with the symlink swap the kubelet does when a ConfigMap changes.
+func (s *CapabilityStore) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	if s.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.Reload()
+			if err != nil {
+				logger.Warn("Keeping previous capabilities", "path", s.path, "error", err)
+			} else if changed {
+				logger.Info("Reloaded capabilities", "path", s.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCapabilities = `
+resourceTypes:
+- type: database
+  providers: [postgresql, mysql]
+  regions: [eu-west-1, eu-central-1]
+  sizes:
+    small: {cpu: "1", memory: 2Gi, storage: 10Gi}
+    large: {cpu: "4", memory: 8Gi, storage: 200Gi}
+- type: cache
+  providers: [redis]
+`
+
+// mountConfigMap lays out dir the way the kubelet mounts a ConfigMap: the key
+// is a symlink through ..data into a timestamped directory, and updates swap
+// the ..data symlink atomically
+func mountConfigMap(t *testing.T, dir, key, value, version string) string {
+	t.Helper()
+	versionDir := filepath.Join(dir, "..v"+version)
+	if err := os.MkdirAll(versionDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(versionDir, key), []byte(value), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(versionDir), tmpLink); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(dir, key)
+	if _, err := os.Lstat(keyPath); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join("..data", key), keyPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keyPath
+}
+
+func TestCapabilityStore_LoadsConfigMap(t *testing.T) {
+	path := mountConfigMap(t, t.TempDir(), "capabilities.yaml", testCapabilities, "1")
+
+	store, err := NewCapabilityStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	caps := store.Get()
+	if len(caps.ResourceTypes) != 2 {
+		t.Fatalf("expected 2 resource types, got %+v", caps.ResourceTypes)
+	}
+	db, ok := caps.ResourceType("Database")
+	if !ok {
+		t.Fatalf("expected database capability")
+	}
+	if db.Sizes["large"].Storage != "200Gi" || len(db.Regions) != 2 {
+		t.Fatalf("unexpected database capability: %+v", db)
+	}
+}
+
+func TestCapabilityStore_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	path := mountConfigMap(t, dir, "capabilities.yaml", testCapabilities, "1")
+	store, err := NewCapabilityStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if changed, err := store.Reload(); err != nil || changed {
+		t.Fatalf("expected no change on reload of the same content, got changed=%v err=%v", changed, err)
+	}
+
+	mountConfigMap(t, dir, "capabilities.yaml", "resourceTypes:\n- type: database\n  providers: [mongodb]\n", "2")
+	changed, err := store.Reload()
+	if err != nil || !changed {
+		t.Fatalf("expected reload to pick up the new ConfigMap, got changed=%v err=%v", changed, err)
+	}
+	if _, ok := store.Get().ResourceType("cache"); ok {
+		t.Fatalf("expected cache capability to be gone after reload")
+	}
+
+	// A broken update keeps the last good capabilities
+	mountConfigMap(t, dir, "capabilities.yaml", "resourceTypes: [", "3")
+	if _, err := store.Reload(); err == nil {
+		t.Fatalf("expected error for invalid capabilities")
+	}
+	if db, ok := store.Get().ResourceType("database"); !ok || db.Providers[0] != "mongodb" {
+		t.Fatalf("expected previous capabilities to be kept, got %+v", store.Get())
+	}
+	if store.Err() == nil {
+		t.Fatalf("expected the store to report the failed reload")
+	}
+
+	mountConfigMap(t, dir, "capabilities.yaml", "resourceTypes:\n- type: database\n  providers: [redis]\n", "4")
+	if _, err := store.Reload(); err != nil || store.Err() != nil {
+		t.Fatalf("expected a fixed ConfigMap to clear the error, got %v / %v", err, store.Err())
+	}
+}
+
+func TestParseCapabilities_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"empty":          "resourceTypes: []",
+		"missing type":   "resourceTypes:\n- providers: [postgresql]\n",
+		"no providers":   "resourceTypes:\n- type: database\n",
+		"duplicate type": "resourceTypes:\n- type: database\n  providers: [a]\n- type: Database\n  providers: [b]\n",
+		"unknown field":  "resourceTypes:\n- type: database\n  providers: [a]\n  flavours: [b]\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseCapabilities([]byte(data)); err == nil {
+				t.Fatalf("expected error")
+			}
+		})
+	}
+}
+
+func TestCapabilities_ValidateRequest(t *testing.T) {
+	caps, err := ParseCapabilities([]byte(testCapabilities))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		resourceType string
+		spec         map[string]interface{}
+		wantErr      bool
+	}{
+		{"supported", "database", map[string]interface{}{"engine": "postgresql", "size": "small", "region": "eu-west-1"}, false},
+		{"provider key", "cache", map[string]interface{}{"provider": "redis"}, false},
+		{"unknown resource type", "queue", map[string]interface{}{}, true},
+		{"unsupported engine", "database", map[string]interface{}{"engine": "mongodb"}, true},
+		{"unsupported size", "database", map[string]interface{}{"engine": "mysql", "size": "medium"}, true},
+		{"unsupported region", "database", map[string]interface{}{"engine": "mysql", "region": "us-east-1"}, true},
+		{"any region when none listed", "cache", map[string]interface{}{"provider": "redis", "region": "us-east-1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := caps.ValidateRequest(&ProvisionRequest{ResourceType: tt.resourceType, Spec: tt.spec})
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("wantErr=%v, got %v", tt.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrUnsupportedCapability) {
+				t.Fatalf("expected ErrUnsupportedCapability, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCapabilities_Regions(t *testing.T) {
+	caps, err := ParseCapabilities([]byte(`
+resourceTypes:
+- type: database
+  providers: [postgresql, mysql]
+  regions: [eu-west-1, eu-central-1]
+  providerRegions:
+    mysql: [eu-west-1]
+- type: cache
+  providers: [redis]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	all := caps.Regions("", "")
+	if len(all) != 3 {
+		t.Fatalf("expected an entry per provider, got %+v", all)
+	}
+
+	mysql := caps.Regions("database", "mysql")
+	if len(mysql) != 1 || len(mysql[0].Regions) != 1 || mysql[0].Regions[0] != "eu-west-1" {
+		t.Fatalf("expected mysql to use its provider override, got %+v", mysql)
+	}
+	postgres := caps.Regions("Database", "postgresql")
+	if len(postgres) != 1 || len(postgres[0].Regions) != 2 || postgres[0].AnyRegion {
+		t.Fatalf("expected postgresql to use the resource type regions, got %+v", postgres)
+	}
+	redis := caps.Regions("cache", "")
+	if len(redis) != 1 || !redis[0].AnyRegion {
+		t.Fatalf("expected redis to be available in any region, got %+v", redis)
+	}
+
+	// The provider override is enforced on provision requests too
+	err = caps.ValidateRequest(&ProvisionRequest{ResourceType: "database", Spec: map[string]interface{}{"engine": "mysql", "region": "eu-central-1"}})
+	if !errors.Is(err, ErrUnsupportedCapability) {
+		t.Fatalf("expected mysql in eu-central-1 to be rejected, got %v", err)
+	}
+
+	if _, err := ParseCapabilities([]byte("resourceTypes:\n- type: database\n  providers: [postgresql]\n  providerRegions:\n    mysql: [eu-west-1]\n")); err == nil {
+		t.Fatalf("expected error for providerRegions of an unlisted provider")
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// ErrNoCostModel is returned when an estimator has no pricing for a resource type
+var ErrNoCostModel = errors.New("no cost model for resource type")
+
+// CostLineItem is one component of a cost estimate
+type CostLineItem struct {
+	Item        string  `json:"item"`
+	MonthlyCost float64 `json:"monthlyCost"`
+}
+
+// CostEstimate is the estimated monthly cost of a resource
+type CostEstimate struct {
+	MonthlyCost float64        `json:"monthlyCost"`
+	Currency    string         `json:"currency"`
+	Breakdown   []CostLineItem `json:"breakdown"`
+}
+
+// CostEstimator prices a resource from its type and spec. The broker uses the
+// static table by default; an implementation backed by a cloud pricing API
+// can be swapped in without changing the provision or estimate paths.
+type CostEstimator interface {
+	Estimate(ctx context.Context, resourceType string, spec map[string]interface{}) (*CostEstimate, error)
+}
+
+// StaticCostEstimator prices databases from a fixed rate table
+type StaticCostEstimator struct {
+	Currency string
+
+	// SizeRates is the monthly instance price for each size
+	SizeRates map[string]float64
+
+	// EngineMultipliers scales the instance price per engine (e.g. licensing)
+	EngineMultipliers map[string]float64
+
+	// StorageRatePerGi is the monthly price per Gi of storage and
+	// StorageBySize the storage each size is provisioned with
+	StorageRatePerGi float64
+	StorageBySize    map[string]int
+
+	// BackupRate is the fraction of the instance price charged for backups
+	BackupRate float64
+}
+
+// NewStaticCostEstimator returns an estimator with the default rate table
+func NewStaticCostEstimator() *StaticCostEstimator {
+	return &StaticCostEstimator{
+		Currency: "USD",
+		SizeRates: map[string]float64{
+			"small":  25,
+			"medium": 100,
+			"large":  400,
+			"xlarge": 1200,
+		},
+		EngineMultipliers: map[string]float64{
+			"postgresql": 1.0,
+			"mysql":      1.0,
+			"mongodb":    1.2,
+			"redis":      0.8,
+			"sqlserver":  1.8,
+		},
+		StorageRatePerGi: 0.10,
+		StorageBySize: map[string]int{
+			"small":  10,
+			"medium": 50,
+			"large":  200,
+			"xlarge": 500,
+		},
+		BackupRate: 0.2,
+	}
+}
+
+// Estimate prices a database from its engine, size, high availability and
+// backup settings
+func (e *StaticCostEstimator) Estimate(ctx context.Context, resourceType string, spec map[string]interface{}) (*CostEstimate, error) {
+	if !strings.EqualFold(resourceType, platformv1.ResourceTypeDatabase) {
+		return nil, fmt.Errorf("%w %q", ErrNoCostModel, resourceType)
+	}
+
+	engine := specString(spec, "engine")
+	size := specString(spec, "size")
+	multiplier, ok := e.EngineMultipliers[engine]
+	if !ok {
+		return nil, fmt.Errorf("no price for engine %q", engine)
+	}
+	rate, ok := e.SizeRates[size]
+	if !ok {
+		return nil, fmt.Errorf("no price for size %q", size)
+	}
+
+	instance := rate * multiplier
+	breakdown := []CostLineItem{
+		{Item: fmt.Sprintf("%s %s instance", engine, size), MonthlyCost: instance},
+	}
+	if storage := e.StorageBySize[size]; storage > 0 {
+		breakdown = append(breakdown, CostLineItem{
+			Item:        fmt.Sprintf("%dGi storage", storage),
+			MonthlyCost: float64(storage) * e.StorageRatePerGi,
+		})
+	}
+	if ha, _ := spec["highAvailability"].(bool); ha {
+		breakdown = append(breakdown, CostLineItem{Item: "high availability replica", MonthlyCost: instance})
+	}
+	if backup, ok := spec["backup"].(map[string]interface{}); ok {
+		if enabled, _ := backup["enabled"].(bool); enabled {
+			breakdown = append(breakdown, CostLineItem{Item: "backups", MonthlyCost: instance * e.BackupRate})
+		}
+	}
+
+	estimate := &CostEstimate{Currency: e.Currency, Breakdown: breakdown}
+	for i := range breakdown {
+		breakdown[i].MonthlyCost = roundCents(breakdown[i].MonthlyCost)
+		estimate.MonthlyCost += breakdown[i].MonthlyCost
+	}
+	estimate.MonthlyCost = roundCents(estimate.MonthlyCost)
+	return estimate, nil
+}
+
+// specString returns a lower-cased string value from a resource spec
+func specString(spec map[string]interface{}, key string) string {
+	s, _ := spec[key].(string)
+	return strings.ToLower(s)
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStaticCostEstimator_SizesAndEngines(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  map[string]interface{}
+		want  float64
+		items int
+	}{
+		{"postgresql small", map[string]interface{}{"engine": "postgresql", "size": "small"}, 26, 2},
+		{"postgresql medium", map[string]interface{}{"engine": "postgresql", "size": "medium"}, 105, 2},
+		{"mysql large", map[string]interface{}{"engine": "mysql", "size": "large"}, 420, 2},
+		{"mongodb medium", map[string]interface{}{"engine": "mongodb", "size": "medium"}, 125, 2},
+		{"redis small", map[string]interface{}{"engine": "redis", "size": "small"}, 21, 2},
+		{"sqlserver xlarge", map[string]interface{}{"engine": "sqlserver", "size": "xlarge"}, 2210, 2},
+		{"engine and size are case-insensitive", map[string]interface{}{"engine": "PostgreSQL", "size": "Medium"}, 105, 2},
+		{"high availability doubles the instance", map[string]interface{}{"engine": "postgresql", "size": "medium", "highAvailability": true}, 205, 3},
+		{"backups add a fraction of the instance", map[string]interface{}{
+			"engine": "postgresql", "size": "large", "backup": map[string]interface{}{"enabled": true},
+		}, 500, 3},
+	}
+
+	e := NewStaticCostEstimator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := e.Estimate(context.Background(), "database", tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.MonthlyCost != tt.want {
+				t.Fatalf("expected %.2f, got %.2f (%+v)", tt.want, got.MonthlyCost, got.Breakdown)
+			}
+			if got.Currency != "USD" {
+				t.Fatalf("expected USD, got %s", got.Currency)
+			}
+			if len(got.Breakdown) != tt.items {
+				t.Fatalf("expected %d line items, got %+v", tt.items, got.Breakdown)
+			}
+			var sum float64
+			for _, item := range got.Breakdown {
+				sum += item.MonthlyCost
+			}
+			if roundCents(sum) != got.MonthlyCost {
+				t.Fatalf("breakdown sums to %.2f, total is %.2f", sum, got.MonthlyCost)
+			}
+		})
+	}
+}
+
+func TestStaticCostEstimator_Unpriced(t *testing.T) {
+	e := NewStaticCostEstimator()
+
+	if _, err := e.Estimate(context.Background(), "cache", map[string]interface{}{}); !errors.Is(err, ErrNoCostModel) {
+		t.Fatalf("expected ErrNoCostModel for unknown resource type, got %v", err)
+	}
+	if _, err := e.Estimate(context.Background(), "database", map[string]interface{}{"engine": "oracle", "size": "small"}); err == nil {
+		t.Fatalf("expected error for unknown engine")
+	}
+	if _, err := e.Estimate(context.Background(), "database", map[string]interface{}{"engine": "postgresql"}); err == nil {
+		t.Fatalf("expected error when size is missing")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a status callback that exhausted its retries, kept so it can
+// be replayed once the manager is reachable again
+type DeadLetter struct {
+	// ID is the callback's nonce, so the manager still processes a replayed
+	// update only once
+	ID          string          `json:"id"`
+	CallbackURL string          `json:"callbackUrl"`
+	Payload     CallbackRequest `json:"payload"`
+	FailedAt    time.Time       `json:"failedAt"`
+	Error       string          `json:"error,omitempty"`
+
+	// FallbackURLs are tried in order when CallbackURL fails
+	FallbackURLs []string `json:"fallbackUrls,omitempty"`
+
+	// CallbackToken is persisted separately as the payload never carries it
+	// in its body
+	CallbackToken string `json:"callbackToken,omitempty"`
+}
+
+// DeadLetterStore persists callbacks that could not be delivered
+type DeadLetterStore interface {
+	// Write stores a dead letter, replacing any with the same ID
+	Write(letter DeadLetter) error
+	// List returns the stored dead letters, oldest first
+	List() ([]DeadLetter, error)
+	// Delete removes a dead letter; deleting an unknown ID is not an error
+	Delete(id string) error
+}
+
+// FileDeadLetterStore keeps each dead letter as a JSON file in a directory,
+// so undelivered callbacks survive a broker restart
+type FileDeadLetterStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileDeadLetterStore creates a store in dir, creating it if needed
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create dead letter directory %s: %w", dir, err)
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+func (s *FileDeadLetterStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid dead letter id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Write stores the dead letter. The file is written under a temporary name
+// and renamed, so a crash never leaves a partial letter behind. Files are
+// only readable by the broker as they hold the callback token.
+func (s *FileDeadLetterStore) Write(letter DeadLetter) error {
+	path, err := s.path(letter.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter %s: %w", letter.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write dead letter %s: %w", letter.ID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write dead letter %s: %w", letter.ID, err)
+	}
+	return nil
+}
+
+// List reads every stored dead letter, oldest first. Unreadable files are
+// skipped rather than blocking the rest.
+func (s *FileDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	letters := make([]DeadLetter, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(data, &letter); err != nil || letter.ID == "" {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// Delete removes the dead letter with the given ID
+func (s *FileDeadLetterStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete dead letter %s: %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dead-letters")
+	store, err := NewFileDeadLetterStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for _, letter := range []DeadLetter{
+		{ID: "b", FailedAt: now.Add(time.Second), Payload: CallbackRequest{DeploymentID: "deploy-2"}},
+		{ID: "a", FailedAt: now, Payload: CallbackRequest{DeploymentID: "deploy-1"}, CallbackToken: "tok"},
+	} {
+		if err := store.Write(letter); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected dead letters to be private to the broker, got %v", info.Mode().Perm())
+	}
+
+	// A store reopened on the same directory sees the same letters, oldest first
+	reopened, err := NewFileDeadLetterStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	letters, err := reopened.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].ID != "a" || letters[1].ID != "b" || letters[0].CallbackToken != "tok" {
+		t.Fatalf("expected letters a then b, got %+v", letters)
+	}
+
+	if err := reopened.Delete("a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reopened.Delete("a"); err != nil {
+		t.Fatalf("expected deleting a missing letter to succeed, got %v", err)
+	}
+	if letters, _ := reopened.List(); len(letters) != 1 || letters[0].ID != "b" {
+		t.Fatalf("expected only b to remain, got %+v", letters)
+	}
+
+	if err := store.Write(DeadLetter{ID: "../escape"}); err == nil {
+		t.Fatal("expected an ID naming another directory to be rejected")
+	}
+}
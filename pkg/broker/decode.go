@@ -0,0 +1,88 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DecodeJSON decodes a JSON request body into v. Decode failures are
+// rewritten into messages that point at the offending field or position so
+// callers can fix their payloads.
+func DecodeJSON(r io.Reader, v interface{}) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fmt.Errorf("request body is empty")
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return describeJSONError(body, err)
+	}
+	return nil
+}
+
+// describeJSONError converts encoding/json errors into human-readable messages
+func describeJSONError(body []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		if syntaxErr.Offset >= int64(len(body)) {
+			line, col := lineAndColumn(body, syntaxErr.Offset)
+			return fmt.Errorf("request body ended unexpectedly at line %d, column %d; the JSON is incomplete", line, col)
+		}
+		// Offset counts the bytes read including the offending character
+		line, col := lineAndColumn(body, syntaxErr.Offset-1)
+		return fmt.Errorf("malformed JSON at line %d, column %d (offset %d): %v", line, col, syntaxErr.Offset, syntaxErr)
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return fmt.Errorf("request body must be a JSON %s, got %s", typeErr.Type, typeErr.Value)
+		}
+		line, col := lineAndColumn(body, typeErr.Offset)
+		return fmt.Errorf("field %q must be %s, got %s at line %d, column %d", field, typeErr.Type, typeErr.Value, line, col)
+	default:
+		return err
+	}
+}
+
+// lineAndColumn converts a byte offset into a 1-based line and column
+func lineAndColumn(body []byte, offset int64) (int, int) {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line, col := 1, 1
+	for _, b := range body[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
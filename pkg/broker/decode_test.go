@@ -0,0 +1,87 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "syntax error reports line and column",
+			body: "{\n  \"resourceType\": \"database\",\n  \"resourceName\": db1\n}",
+			want: []string{"malformed JSON", "line 3", "column 19"},
+		},
+		{
+			name: "wrong field type names the field",
+			body: `{"resourceType": "database", "resourceName": 42}`,
+			want: []string{`field "resourceName"`, "must be string", "got number"},
+		},
+		{
+			name: "nested field type is named by path",
+			body: `{"resourceType": "database", "spec": "large"}`,
+			want: []string{`field "spec"`, "got string"},
+		},
+		{
+			name: "truncated body",
+			body: `{"resourceType": "database", "resourceName": "db1"`,
+			want: []string{"ended unexpectedly", "incomplete"},
+		},
+		{
+			name: "empty body",
+			body: "   ",
+			want: []string{"request body is empty"},
+		},
+		{
+			name: "top-level array",
+			body: `[{"resourceType": "database"}]`,
+			want: []string{"must be a JSON", "got array"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ProvisionRequest
+			err := DecodeJSON(strings.NewReader(tt.body), &req)
+			if err == nil {
+				t.Fatalf("expected decode error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeJSON_Valid(t *testing.T) {
+	var req ProvisionRequest
+	body := `{"resourceType": "database", "resourceName": "db1", "namespace": "team-a"}`
+	if err := DecodeJSON(strings.NewReader(body), &req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.ResourceName != "db1" || req.Namespace != "team-a" {
+		t.Fatalf("unexpected decode result: %+v", req)
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aykay76/kidp/pkg/redact"
+)
+
+// MaxDeploymentLogEntries is how many log entries DeploymentStore keeps per
+// deployment; older entries are dropped first
+const MaxDeploymentLogEntries = 200
+
+// MaxFinishedDeployments is how many finished deployments DeploymentStore
+// keeps the status, last callback and log of; the least recently finished is
+// dropped first. Deployments still in flight are always kept.
+const MaxFinishedDeployments = 1000
+
+// maxDeploymentIDAttempts bounds how many IDs NewDeploymentID tries before
+// giving up on finding one the tracker hasn't seen
+const maxDeploymentIDAttempts = 5
+
+// randRead fills b with random bytes; tests replace it to force the fallback
+var randRead = rand.Read
+
+// fallbackSeq makes fallback deployment IDs unique within the process even
+// when generated within the same clock tick
+var fallbackSeq atomic.Uint64
+
+// DeploymentCounts is a point-in-time view of a DeploymentTracker
+type DeploymentCounts struct {
+	Active int64 `json:"activeDeployments"`
+	Total  int64 `json:"totalDeployments"`
+	Failed int64 `json:"failedDeployments"`
+}
+
+// DeploymentTracker counts the deployments this broker has accepted since it
+// started, for reporting on /health, and holds the IDs of those in flight so
+// a new one can't reuse them. Unlike CapacityLimiter it never rejects work;
+// it only records what happened.
+type DeploymentTracker struct {
+	mu     sync.Mutex
+	counts DeploymentCounts
+	ids    map[string]struct{}
+}
+
+// NewDeploymentTracker creates a tracker with all counters at zero
+func NewDeploymentTracker() *DeploymentTracker {
+	return &DeploymentTracker{ids: make(map[string]struct{})}
+}
+
+// NewDeploymentID generates a deployment ID and reserves it until the
+// deployment finishes, regenerating on a collision with an ID still in
+// flight. It fails only if every attempt collides.
+func (t *DeploymentTracker) NewDeploymentID() (string, error) {
+	for i := 0; i < maxDeploymentIDAttempts; i++ {
+		id := generateDeploymentID()
+		if t.reserve(id) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no unique deployment ID after %d attempts", maxDeploymentIDAttempts)
+}
+
+// reserve records id as taken, returning false if it already was
+func (t *DeploymentTracker) reserve(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.ids[id]; ok {
+		return false
+	}
+	t.ids[id] = struct{}{}
+	return true
+}
+
+// generateDeploymentID creates a random deployment identifier. If crypto/rand
+// fails it falls back to the time, process ID and a sequence number, which
+// can't repeat within a process and are unlikely to across brokers.
+func generateDeploymentID() string {
+	b := make([]byte, 16)
+	if _, err := randRead(b); err != nil {
+		return fmt.Sprintf("deploy-%x-%x-%x", time.Now().UnixNano(), os.Getpid(), fallbackSeq.Add(1))
+	}
+	return fmt.Sprintf("deploy-%s", hex.EncodeToString(b))
+}
+
+// Start records an accepted deployment. Callers must call Finish once the
+// deployment completes.
+func (t *DeploymentTracker) Start() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.counts.Active++
+	t.counts.Total++
+}
+
+// Finish records the end of a deployment previously passed to Start,
+// releasing its ID. A non-nil err counts the deployment as failed.
+func (t *DeploymentTracker) Finish(deploymentID string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.ids, deploymentID)
+	if t.counts.Active > 0 {
+		t.counts.Active--
+	}
+	if err != nil {
+		t.counts.Failed++
+	}
+}
+
+// Counts returns the current counters
+func (t *DeploymentTracker) Counts() DeploymentCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.counts
+}
+
+// DeploymentStore keeps the latest phase of the deployments this broker has
+// run, so /v1/status can answer without the manager, the last callback sent
+// for each, so it can be replayed, and its provisioning log. Deployments in
+// flight are always kept and the most recently finished are kept up to a
+// limit. It lives in memory and is lost when the broker restarts.
+type DeploymentStore struct {
+	mu          sync.RWMutex
+	deployments map[string]StatusResponse
+	callbacks   map[string]recordedCallback
+	logs        map[string][]LogEntry
+
+	// finished orders finished deployments, most recently finished first
+	retain   int
+	finished *list.List
+	elements map[string]*list.Element
+}
+
+// recordedCallback is a callback as last sent for a deployment
+type recordedCallback struct {
+	callbackURL string
+	payload     CallbackRequest
+}
+
+// NewDeploymentStore creates an empty store
+func NewDeploymentStore() *DeploymentStore {
+	return &DeploymentStore{
+		deployments: make(map[string]StatusResponse),
+		callbacks:   make(map[string]recordedCallback),
+		logs:        make(map[string][]LogEntry),
+		retain:      MaxFinishedDeployments,
+		finished:    list.New(),
+		elements:    make(map[string]*list.Element),
+	}
+}
+
+// Record stores a phase transition for a deployment. Reaching Ready or Failed
+// finishes it, dropping the least recently finished deployment past the
+// store's limit; any other phase puts it back in flight.
+func (s *DeploymentStore) Record(deploymentID, phase, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deployments[deploymentID] = StatusResponse{
+		DeploymentID: deploymentID,
+		Phase:        phase,
+		Message:      message,
+		LastUpdated:  time.Now().UTC(),
+	}
+
+	if el, ok := s.elements[deploymentID]; ok {
+		s.finished.Remove(el)
+		delete(s.elements, deploymentID)
+	}
+	if phase != "Ready" && phase != "Failed" {
+		return
+	}
+	s.elements[deploymentID] = s.finished.PushFront(deploymentID)
+	for s.finished.Len() > s.retain {
+		oldest := s.finished.Back()
+		s.finished.Remove(oldest)
+		id := oldest.Value.(string)
+		delete(s.elements, id)
+		delete(s.deployments, id)
+		delete(s.callbacks, id)
+		delete(s.logs, id)
+	}
+}
+
+// RecordCallback stores the callback most recently sent for a deployment
+func (s *DeploymentStore) RecordCallback(callbackURL string, payload CallbackRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callbacks[payload.DeploymentID] = recordedCallback{callbackURL: callbackURL, payload: payload}
+}
+
+// Get returns the latest status of a deployment
+func (s *DeploymentStore) Get(deploymentID string) (StatusResponse, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status, ok := s.deployments[deploymentID]
+	return status, ok
+}
+
+// LastCallback returns the callback most recently sent for a deployment and
+// the URL it was sent to
+func (s *DeploymentStore) LastCallback(deploymentID string) (string, CallbackRequest, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cb, ok := s.callbacks[deploymentID]
+	return cb.callbackURL, cb.payload, ok
+}
+
+// AppendLog adds a line to a deployment's provisioning log, masking any
+// credentials in it. Past MaxDeploymentLogEntries the oldest line is dropped.
+func (s *DeploymentStore) AppendLog(deploymentID, step, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := append(s.logs[deploymentID], LogEntry{
+		Time:    time.Now().UTC(),
+		Step:    step,
+		Message: redact.String(message),
+	})
+	if len(entries) > MaxDeploymentLogEntries {
+		entries = entries[len(entries)-MaxDeploymentLogEntries:]
+	}
+	s.logs[deploymentID] = entries
+}
+
+// Logs returns up to limit of a deployment's most recent log entries, oldest
+// first, and whether older ones were left out. A limit of 0 or less returns
+// every entry kept.
+func (s *DeploymentStore) Logs(deploymentID string, limit int) ([]LogEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := s.logs[deploymentID]
+	truncated := false
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+		truncated = true
+	}
+	return append([]LogEntry{}, entries...), truncated
+}
+
+// DeploymentLogsPath returns the broker path serving a deployment's logs
+func DeploymentLogsPath(deploymentID string) string {
+	return "/v1/deployments/" + url.PathEscape(deploymentID) + "/logs"
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDeploymentTracker(t *testing.T) {
+	tracker := NewDeploymentTracker()
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		tracker.Start()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%5 == 0 {
+				err = errors.New("boom")
+			}
+			tracker.Finish(fmt.Sprintf("deploy-%d", i), err)
+		}(i)
+	}
+	wg.Wait()
+
+	want := DeploymentCounts{Active: 0, Total: n, Failed: n / 5}
+	if got := tracker.Counts(); got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	tracker.Start()
+	if got := tracker.Counts(); got.Active != 1 || got.Total != n+1 {
+		t.Fatalf("expected one active deployment, got %+v", got)
+	}
+}
+
+func TestNewDeploymentIDFallbackIsUnique(t *testing.T) {
+	orig := randRead
+	randRead = func([]byte) (int, error) { return 0, errors.New("no entropy") }
+	defer func() { randRead = orig }()
+
+	tracker := NewDeploymentTracker()
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := tracker.NewDeploymentID()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate deployment ID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewDeploymentIDRegeneratesOnCollision(t *testing.T) {
+	orig := randRead
+	defer func() { randRead = orig }()
+
+	// The first two reads yield the same bytes, the third differs
+	calls := 0
+	randRead = func(b []byte) (int, error) {
+		calls++
+		for i := range b {
+			b[i] = 0
+		}
+		if calls >= 3 {
+			b[0] = 1
+		}
+		return len(b), nil
+	}
+
+	tracker := NewDeploymentTracker()
+	first, err := tracker.NewDeploymentID()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := tracker.NewDeploymentID()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first == second {
+		t.Fatalf("expected a fresh ID after collision, got %s twice", first)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 reads, got %d", calls)
+	}
+
+	randRead = func(b []byte) (int, error) {
+		for i := range b {
+			b[i] = 0
+		}
+		return len(b), nil
+	}
+	if _, err := tracker.NewDeploymentID(); err == nil {
+		t.Fatal("expected an error when every attempt collides")
+	}
+}
+
+func TestDeploymentStoreLogs(t *testing.T) {
+	store := NewDeploymentStore()
+	for i := 0; i < MaxDeploymentLogEntries+5; i++ {
+		store.AppendLog("deploy-1", "", fmt.Sprintf("line %d", i))
+	}
+	store.AppendLog("deploy-1", StepInitScripts, "connecting with password=hunter2")
+
+	entries, truncated := store.Logs("deploy-1", 0)
+	if len(entries) != MaxDeploymentLogEntries || truncated {
+		t.Fatalf("expected the %d newest entries, got %d (truncated=%v)", MaxDeploymentLogEntries, len(entries), truncated)
+	}
+	if entries[0].Message != "line 6" {
+		t.Fatalf("expected the oldest entries to be dropped, got %q first", entries[0].Message)
+	}
+
+	entries, truncated = store.Logs("deploy-1", 2)
+	if len(entries) != 2 || !truncated {
+		t.Fatalf("expected a truncated tail of 2, got %d (truncated=%v)", len(entries), truncated)
+	}
+	last := entries[1]
+	if last.Step != StepInitScripts || strings.Contains(last.Message, "hunter2") {
+		t.Fatalf("expected the newest entry last with its password masked, got %+v", last)
+	}
+
+	if entries, _ := store.Logs("deploy-unknown", 10); len(entries) != 0 {
+		t.Fatalf("expected no logs for an unknown deployment, got %+v", entries)
+	}
+}
+
+func TestDeploymentStoreDropsOldFinishedDeployments(t *testing.T) {
+	store := NewDeploymentStore()
+	store.retain = 2
+
+	record := func(id, phase string) {
+		store.Record(id, phase, "")
+		store.RecordCallback("http://manager/v1/callback", CallbackRequest{DeploymentID: id, Phase: phase})
+		store.AppendLog(id, "", phase)
+	}
+	record("deploy-running", "Provisioning")
+	for _, id := range []string{"deploy-1", "deploy-2", "deploy-3"} {
+		record(id, "Ready")
+	}
+
+	// The least recently finished deployment is dropped from every map
+	if _, ok := store.Get("deploy-1"); ok {
+		t.Fatal("expected the oldest finished deployment's status to be dropped")
+	}
+	if _, _, ok := store.LastCallback("deploy-1"); ok {
+		t.Fatal("expected the oldest finished deployment's callback to be dropped")
+	}
+	if entries, _ := store.Logs("deploy-1", 0); len(entries) != 0 {
+		t.Fatalf("expected the oldest finished deployment's log to be dropped, got %+v", entries)
+	}
+	for _, id := range []string{"deploy-running", "deploy-2", "deploy-3"} {
+		if _, ok := store.Get(id); !ok {
+			t.Fatalf("expected %s to be kept", id)
+		}
+	}
+
+	// A reconfigured deployment is in flight again and isn't dropped
+	record("deploy-2", "Provisioning")
+	record("deploy-4", "Failed")
+	record("deploy-5", "Ready")
+	if _, ok := store.Get("deploy-2"); !ok {
+		t.Fatal("expected a deployment back in flight to be kept")
+	}
+	if _, ok := store.Get("deploy-3"); ok {
+		t.Fatal("expected deploy-3 to be dropped once two newer deployments finished")
+	}
+	if _, ok := store.Get("deploy-running"); !ok {
+		t.Fatal("expected an in-flight deployment never to be dropped")
+	}
+}
+
+func TestDeploymentTrackerReleasesFinishedIDs(t *testing.T) {
+	tracker := NewDeploymentTracker()
+	id, err := tracker.NewDeploymentID()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tracker.Start()
+	tracker.Finish(id, nil)
+	if len(tracker.ids) != 0 {
+		t.Fatalf("expected the finished deployment's ID to be released, got %v", tracker.ids)
+	}
+}
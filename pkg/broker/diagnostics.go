@@ -0,0 +1,96 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Overall statuses of a diagnostics report
+const (
+	DiagnosticsHealthy  = "healthy"
+	DiagnosticsDegraded = "degraded"
+)
+
+// DiagnosticCheck is one check run by the diagnostics endpoint. Check returns
+// a short description of what it found, or an error if the check failed.
+type DiagnosticCheck struct {
+	Name  string
+	Check func(ctx context.Context) (string, error)
+}
+
+// DiagnosticResult is the outcome of one diagnostic check
+type DiagnosticResult struct {
+	Name     string `json:"name"`
+	Healthy  bool   `json:"healthy"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// DiagnosticsReport is the structured report returned by the diagnostics endpoint
+type DiagnosticsReport struct {
+	Status  string             `json:"status"`
+	Version string             `json:"version"`
+	Time    string             `json:"time"`
+	Checks  []DiagnosticResult `json:"checks"`
+}
+
+// RunDiagnostics runs every check in turn, each bounded by timeout, and
+// reports the broker degraded if any of them failed
+func RunDiagnostics(ctx context.Context, timeout time.Duration, checks []DiagnosticCheck) DiagnosticsReport {
+	report := DiagnosticsReport{
+		Status: DiagnosticsHealthy,
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Checks: make([]DiagnosticResult, 0, len(checks)),
+	}
+	for _, c := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		detail, err := c.Check(checkCtx)
+		cancel()
+
+		result := DiagnosticResult{
+			Name:     c.Name,
+			Healthy:  err == nil,
+			Detail:   detail,
+			Duration: time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+			report.Status = DiagnosticsDegraded
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report
+}
+
+// ProbeURL checks that an HTTP endpoint answers. Any response, even an error
+// status, means it is reachable; only failing to get one is an error.
+func ProbeURL(ctx context.Context, client *http.Client, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
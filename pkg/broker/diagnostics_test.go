@@ -0,0 +1,67 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunDiagnostics(t *testing.T) {
+	pass := DiagnosticCheck{Name: "pass", Check: func(ctx context.Context) (string, error) { return "fine", nil }}
+	fail := DiagnosticCheck{Name: "fail", Check: func(ctx context.Context) (string, error) { return "looked", errors.New("broken") }}
+	slow := DiagnosticCheck{Name: "slow", Check: func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}}
+
+	report := RunDiagnostics(context.Background(), time.Second, []DiagnosticCheck{pass})
+	if report.Status != DiagnosticsHealthy || len(report.Checks) != 1 || !report.Checks[0].Healthy || report.Checks[0].Detail != "fine" {
+		t.Fatalf("expected a healthy report, got %+v", report)
+	}
+
+	report = RunDiagnostics(context.Background(), 10*time.Millisecond, []DiagnosticCheck{fail, slow, pass})
+	if report.Status != DiagnosticsDegraded || len(report.Checks) != 3 {
+		t.Fatalf("expected a degraded report running every check, got %+v", report)
+	}
+	if c := report.Checks[0]; c.Healthy || c.Error != "broken" || c.Detail != "looked" {
+		t.Fatalf("expected the failed check to keep its detail and error, got %+v", c)
+	}
+	if c := report.Checks[1]; c.Healthy || c.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected the slow check to time out, got %+v", c)
+	}
+	if !report.Checks[2].Healthy {
+		t.Fatalf("expected checks after a failure to still run, got %+v", report.Checks[2])
+	}
+}
+
+func TestProbeURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	if err := ProbeURL(context.Background(), srv.Client(), srv.URL); err != nil {
+		t.Fatalf("expected any response to count as reachable, got %v", err)
+	}
+	srv.Close()
+	if err := ProbeURL(context.Background(), http.DefaultClient, srv.URL); err == nil {
+		t.Fatal("expected a closed server to be unreachable")
+	}
+}
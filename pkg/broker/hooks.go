@@ -0,0 +1,153 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aykay76/kidp/pkg/tracing"
+	"github.com/aykay76/kidp/pkg/version"
+)
+
+// Hook stages
+const (
+	HookPreProvision  = "pre-provision"
+	HookPostProvision = "post-provision"
+)
+
+// ErrProvisionDenied is returned when a pre-provision hook rejects a deployment
+var ErrProvisionDenied = errors.New("provisioning denied by pre-provision hook")
+
+// HookRequest is posted to a provisioning hook. The callback token is
+// stripped from the request so hooks can't impersonate the broker.
+type HookRequest struct {
+	Stage        string           `json:"stage"`
+	DeploymentID string           `json:"deploymentId"`
+	Request      ProvisionRequest `json:"request"`
+
+	// Outcome of the deployment, sent to post-provision hooks only
+	Status string `json:"status,omitempty"` // success, failed
+	Error  string `json:"error,omitempty"`
+}
+
+// HookResponse is a pre-provision hook's decision
+type HookResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Hooks calls an organisation's pre- and post-provision webhooks, e.g. for
+// approvals or ticketing. Requests are signed like callbacks. A nil *Hooks,
+// or an empty URL, disables the hook.
+type Hooks struct {
+	PreProvisionURL  string
+	PostProvisionURL string
+	httpClient       *http.Client
+}
+
+// NewHooks creates hooks calling the given URLs, each call bounded by timeout
+func NewHooks(preProvisionURL, postProvisionURL string, timeout time.Duration) *Hooks {
+	return &Hooks{
+		PreProvisionURL:  preProvisionURL,
+		PostProvisionURL: postProvisionURL,
+		httpClient:       &http.Client{Timeout: timeout},
+	}
+}
+
+// PreProvision asks the pre-provision hook whether the deployment may go
+// ahead. It fails closed: a hook that can't be reached or doesn't answer
+// with a decision stops the deployment as surely as one that denies it.
+func (h *Hooks) PreProvision(ctx context.Context, task ProvisionTask) error {
+	if h == nil || h.PreProvisionURL == "" {
+		return nil
+	}
+
+	resp, err := h.post(ctx, h.PreProvisionURL, hookRequest(HookPreProvision, task))
+	if err != nil {
+		return fmt.Errorf("pre-provision hook failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pre-provision hook returned status %d", resp.StatusCode)
+	}
+
+	var decision HookResponse
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return fmt.Errorf("pre-provision hook returned an invalid response: %w", err)
+	}
+	if !decision.Allowed {
+		if decision.Reason == "" {
+			return ErrProvisionDenied
+		}
+		return fmt.Errorf("%w: %s", ErrProvisionDenied, decision.Reason)
+	}
+	return nil
+}
+
+// PostProvision tells the post-provision hook how the deployment ended. The
+// deployment has already finished, so a failing hook is only reported.
+func (h *Hooks) PostProvision(ctx context.Context, task ProvisionTask, provisionErr error) error {
+	if h == nil || h.PostProvisionURL == "" {
+		return nil
+	}
+
+	payload := hookRequest(HookPostProvision, task)
+	payload.Status = "success"
+	if provisionErr != nil {
+		payload.Status = "failed"
+		payload.Error = provisionErr.Error()
+	}
+
+	resp, err := h.post(ctx, h.PostProvisionURL, payload)
+	if err != nil {
+		return fmt.Errorf("post-provision hook failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("post-provision hook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func hookRequest(stage string, task ProvisionTask) HookRequest {
+	req := task.Request
+	req.CallbackToken = ""
+	return HookRequest{Stage: stage, DeploymentID: task.DeploymentID, Request: req}
+}
+
+// post sends a signed hook request
+func (h *Hooks) post(ctx context.Context, url string, payload HookRequest) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal hook request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	version.SetHeaders(req, version.ComponentBroker)
+	tracing.Inject(ctx, req.Header)
+	setSignatureHeaders(req, body)
+	return h.httpClient.Do(req)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hookServer answers pre-provision hooks with decision and records every
+// request it receives along with its signature
+type hookServer struct {
+	decision HookResponse
+
+	mu         sync.Mutex
+	requests   []HookRequest
+	signatures []string
+}
+
+func (h *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req HookRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	h.mu.Lock()
+	h.requests = append(h.requests, req)
+	h.signatures = append(h.signatures, r.Header.Get("X-KIDP-Signature"))
+	h.mu.Unlock()
+	if req.Stage == HookPreProvision {
+		_ = json.NewEncoder(w).Encode(h.decision)
+	}
+}
+
+func newHookedWorker(t *testing.T, hooks *hookServer) (*Worker, *fakeProvisioner, *recordingNotifier) {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BROKER_PRIVATE_KEY", base64.StdEncoding.EncodeToString(priv))
+
+	srv := httptest.NewServer(hooks)
+	t.Cleanup(srv.Close)
+
+	provisioner := &fakeProvisioner{steps: []string{"apply-manifests"}}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", provisioner)
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+	w.SetHooks(NewHooks(srv.URL+"/pre", srv.URL+"/post", time.Second))
+	return w, provisioner, notifier
+}
+
+func hookedTask() ProvisionTask {
+	req := validProvisionRequest()
+	req.CallbackToken = "secret-token"
+	return ProvisionTask{DeploymentID: "deploy-1", Request: req}
+}
+
+func TestHooks_PreProvisionApproves(t *testing.T) {
+	hooks := &hookServer{decision: HookResponse{Allowed: true}}
+	w, _, notifier := newHookedWorker(t, hooks)
+
+	if err := w.Run(context.Background(), hookedTask()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if final := notifier.payloads[len(notifier.payloads)-1]; final.Status != "success" {
+		t.Fatalf("expected the approved deployment to succeed, got %+v", final)
+	}
+
+	if len(hooks.requests) != 2 {
+		t.Fatalf("expected pre- and post-provision hook calls, got %+v", hooks.requests)
+	}
+	pre, post := hooks.requests[0], hooks.requests[1]
+	if pre.Stage != HookPreProvision || pre.DeploymentID != "deploy-1" || pre.Request.ResourceName != "db1" {
+		t.Fatalf("unexpected pre-provision request: %+v", pre)
+	}
+	if pre.Request.CallbackToken != "" {
+		t.Fatalf("expected the callback token to be withheld from hooks")
+	}
+	if post.Stage != HookPostProvision || post.Status != "success" {
+		t.Fatalf("expected a successful post-provision request, got %+v", post)
+	}
+	for i, sig := range hooks.signatures {
+		if sig == "" {
+			t.Fatalf("expected hook request %d to be signed", i)
+		}
+	}
+}
+
+func TestHooks_PreProvisionDenies(t *testing.T) {
+	hooks := &hookServer{decision: HookResponse{Allowed: false, Reason: "change freeze"}}
+	w, provisioner, notifier := newHookedWorker(t, hooks)
+	provisioner.err = errors.New("provisioner must not run")
+
+	err := w.Run(context.Background(), hookedTask())
+	if !errors.Is(err, ErrProvisionDenied) || !strings.Contains(err.Error(), "change freeze") {
+		t.Fatalf("expected a denial carrying the reason, got %v", err)
+	}
+	if len(notifier.payloads) != 1 {
+		t.Fatalf("expected only the failure callback, got %+v", notifier.payloads)
+	}
+	final := notifier.payloads[0]
+	if final.Status != "failed" || !strings.Contains(final.Error, "change freeze") {
+		t.Fatalf("expected a failed callback with the denial reason, got %+v", final)
+	}
+	if len(hooks.requests) != 1 {
+		t.Fatalf("expected no post-provision hook for a denied deployment, got %+v", hooks.requests)
+	}
+}
+
+func TestHooks_PreProvisionFailsClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	hooks := NewHooks(srv.URL, "", time.Second)
+	if err := hooks.PreProvision(context.Background(), hookedTask()); err == nil || !strings.Contains(err.Error(), "status 500") {
+		t.Fatalf("expected an erroring hook to stop the deployment, got %v", err)
+	}
+
+	var disabled *Hooks
+	if err := disabled.PreProvision(context.Background(), hookedTask()); err != nil {
+		t.Fatalf("expected nil hooks to allow everything, got %v", err)
+	}
+}
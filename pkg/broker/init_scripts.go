@@ -0,0 +1,243 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// StepInitScripts is the provisioning step that runs a database's init
+// scripts. Failure callbacks name it in their details when a script fails.
+const StepInitScripts = "init-scripts"
+
+// initScriptsMountPath is where the init script Job mounts the scripts
+const initScriptsMountPath = "/init-scripts"
+
+// initScript is one script of the initScripts spec field, resolved to its SQL
+type initScript struct {
+	name string
+	sql  string
+}
+
+func initScriptsSecretName(name string) string {
+	return name + "-init-scripts"
+}
+
+func initScriptsJobName(name string) string {
+	return name + "-init"
+}
+
+// runInitScripts runs the request's init scripts with psql in a Job, once
+// the database accepts connections. Scripts run once per database: if the
+// Job already exists its outcome is reported again rather than rerunning it.
+func (p *PostgresProvisioner) runInitScripts(ctx context.Context, task ProvisionTask) (int, error) {
+	req := task.Request
+	namespace := req.WorkloadNamespace()
+	jobs := p.client.Clientset().BatchV1().Jobs(namespace)
+
+	entries, _ := req.Spec["initScripts"].([]interface{})
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	jobName := initScriptsJobName(req.ResourceName)
+	if _, err := jobs.Get(ctx, jobName, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		scripts, err := p.resolveInitScripts(ctx, req, entries)
+		if err != nil {
+			return 0, err
+		}
+		if err := p.createInitScriptsJob(ctx, task, scripts); err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get job %s/%s: %w", namespace, jobName, err)
+	}
+
+	if err := p.waitInitScripts(ctx, namespace, jobName); err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+// resolveInitScripts reads each script's SQL from the spec, or from the
+// ConfigMap or Secret it references in the requesting resource's namespace
+func (p *PostgresProvisioner) resolveInitScripts(ctx context.Context, req ProvisionRequest, entries []interface{}) ([]initScript, error) {
+	core := p.client.Clientset().CoreV1()
+	scripts := make([]initScript, 0, len(entries))
+	for i, entry := range entries {
+		fields, _ := entry.(map[string]interface{})
+		name, _ := fields["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("init script %d has no name", i)
+		}
+
+		if ref, ok := fields["configMapKeyRef"].(map[string]interface{}); ok {
+			refName, _ := ref["name"].(string)
+			key, _ := ref["key"].(string)
+			cm, err := core.ConfigMaps(req.Namespace).Get(ctx, refName, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get configmap %s/%s for init script %s: %w", req.Namespace, refName, name, err)
+			}
+			sql, ok := cm.Data[key]
+			if !ok {
+				return nil, fmt.Errorf("configmap %s/%s has no %q key for init script %s", req.Namespace, refName, key, name)
+			}
+			scripts = append(scripts, initScript{name: name, sql: sql})
+			continue
+		}
+
+		if ref, ok := fields["secretKeyRef"].(map[string]interface{}); ok {
+			refName, _ := ref["name"].(string)
+			key, _ := ref["key"].(string)
+			secret, err := core.Secrets(req.Namespace).Get(ctx, refName, metav1.GetOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to get secret %s/%s for init script %s: %w", req.Namespace, refName, name, err)
+			}
+			sql, ok := secret.Data[key]
+			if !ok {
+				return nil, fmt.Errorf("secret %s/%s has no %q key for init script %s", req.Namespace, refName, key, name)
+			}
+			scripts = append(scripts, initScript{name: name, sql: string(sql)})
+			continue
+		}
+
+		inline, _ := fields["inline"].(string)
+		if inline == "" {
+			return nil, fmt.Errorf("init script %s has no source", name)
+		}
+		scripts = append(scripts, initScript{name: name, sql: inline})
+	}
+	return scripts, nil
+}
+
+// createInitScriptsJob stores the scripts in a Secret, as referenced scripts
+// may come from one, and starts a Job that runs them in order with psql,
+// stopping at the first error
+func (p *PostgresProvisioner) createInitScriptsJob(ctx context.Context, task ProvisionTask, scripts []initScript) error {
+	req := task.Request
+	namespace := req.WorkloadNamespace()
+	name := req.ResourceName
+
+	// Keys are prefixed with the script's position so the shell glob keeps the order
+	data := make(map[string][]byte, len(scripts))
+	for i, script := range scripts {
+		data[fmt.Sprintf("%02d-%s.sql", i, script.name)] = []byte(script.sql)
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: initScriptsSecretName(name), Namespace: namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       data,
+	}
+	ApplyResourceLabels(secret, task.DeploymentID, req)
+	secrets := p.client.Clientset().CoreV1().Secrets(namespace)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update secret %s/%s: %w", namespace, secret.Name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to create secret %s/%s: %w", namespace, secret.Name, err)
+	}
+
+	version, _ := req.Spec["version"].(string)
+	if version == "" {
+		version = defaultPostgresVersion
+	}
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: postgresSecretName(name)},
+			Key:                  key,
+		}}
+	}
+	backoffLimit := int32(0)
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: initScriptsJobName(name), Namespace: namespace},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:  "init-scripts",
+						Image: "postgres:" + version,
+						Command: []string{"sh", "-c", `for f in ` + initScriptsMountPath + `/*.sql; do
+  echo "Running $f"
+  psql -v ON_ERROR_STOP=1 -f "$f" || exit 1
+done`},
+						Env: []corev1.EnvVar{
+							{Name: "PGHOST", ValueFrom: secretKey("host")},
+							{Name: "PGPORT", ValueFrom: secretKey("port")},
+							{Name: "PGUSER", ValueFrom: secretKey("username")},
+							{Name: "PGPASSWORD", ValueFrom: secretKey("password")},
+							{Name: "PGDATABASE", ValueFrom: secretKey("database")},
+						},
+						VolumeMounts: []corev1.VolumeMount{{Name: "scripts", MountPath: initScriptsMountPath, ReadOnly: true}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "scripts",
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName: secret.Name,
+						}},
+					}},
+				},
+			},
+		},
+	}
+	ApplyResourceLabels(job, task.DeploymentID, req)
+	if _, err := p.client.Clientset().BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create job %s/%s: %w", namespace, job.Name, err)
+	}
+	return nil
+}
+
+// waitInitScripts polls until the init script Job completes or fails
+func (p *PostgresProvisioner) waitInitScripts(ctx context.Context, namespace, name string) error {
+	jobs := p.client.Clientset().BatchV1().Jobs(namespace)
+	var failed *batchv1.JobCondition
+	err := wait.PollUntilContextTimeout(ctx, p.PollInterval, p.ReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		job, err := jobs.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch cond.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				failed = cond.DeepCopy()
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return fmt.Errorf("init scripts job %s/%s did not finish: %w", namespace, name, err)
+	}
+	if failed != nil {
+		return fmt.Errorf("init scripts job %s/%s failed (%s): %s; see its pod logs", namespace, name, failed.Reason, failed.Message)
+	}
+	return nil
+}
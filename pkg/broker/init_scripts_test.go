@@ -0,0 +1,145 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// finishJobsWith completes or fails every Job as it is created, as the Job
+// controller would once its pod exits
+func finishJobsWith(cs *fake.Clientset, condition batchv1.JobConditionType) {
+	cs.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		job.Status.Conditions = append(job.Status.Conditions, batchv1.JobCondition{
+			Type: condition, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit",
+		})
+		return false, nil, nil
+	})
+}
+
+func initScriptsTask() ProvisionTask {
+	task := postgresTask()
+	task.Request.Spec["initScripts"] = []interface{}{
+		map[string]interface{}{"name": "schema", "inline": "CREATE TABLE orders (id bigint PRIMARY KEY);"},
+		map[string]interface{}{"name": "seed", "configMapKeyRef": map[string]interface{}{"name": "orders-seed", "key": "seed.sql"}},
+	}
+	return task
+}
+
+func TestPostgresProvisioner_InitScripts(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders-seed", Namespace: "team-a"},
+		Data:       map[string]string{"seed.sql": "INSERT INTO orders VALUES (1);"},
+	})
+	finishJobsWith(cs, batchv1.JobComplete)
+	p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+	p.PollInterval = time.Millisecond
+
+	var steps []string
+	progress := func(step, message string) {
+		steps = append(steps, step)
+		if step == "apply-manifests" {
+			markReady(t, cs, "team-a", "db1")
+		}
+	}
+	if err := p.Provision(ctx, initScriptsTask(), progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := steps[len(steps)-2:]; got[0] != "wait-ready" || got[1] != StepInitScripts {
+		t.Fatalf("expected init scripts to run after the database is ready, got steps %v", steps)
+	}
+
+	secret, err := cs.CoreV1().Secrets("team-a").Get(ctx, "db1-init-scripts", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected init scripts secret: %v", err)
+	}
+	if string(secret.Data["00-schema.sql"]) != "CREATE TABLE orders (id bigint PRIMARY KEY);" ||
+		string(secret.Data["01-seed.sql"]) != "INSERT INTO orders VALUES (1);" {
+		t.Fatalf("expected the scripts in order, got %v", secret.Data)
+	}
+	job, err := cs.BatchV1().Jobs("team-a").Get(ctx, "db1-init", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected init scripts job: %v", err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if container.Image != "postgres:15" || !strings.Contains(container.Command[2], "ON_ERROR_STOP=1") {
+		t.Fatalf("expected psql to stop at the first error, got %+v", container)
+	}
+	if job.Labels[LabelDeploymentID] != "deploy-1" {
+		t.Fatalf("expected ownership labels on the job")
+	}
+
+	// Provisioning again, e.g. to reconfigure, doesn't rerun the scripts
+	if err := p.Provision(ctx, initScriptsTask(), func(string, string) {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var creates int
+	for _, action := range cs.Actions() {
+		if action.Matches("create", "jobs") {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Fatalf("expected the init scripts job to be created once, got %d", creates)
+	}
+}
+
+func TestPostgresProvisioner_InitScriptsFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    string
+	}{
+		{name: "script fails", objects: []runtime.Object{&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "orders-seed", Namespace: "team-a"},
+			Data:       map[string]string{"seed.sql": "INSERT INTO missing VALUES (1);"},
+		}}, want: "backoff limit"},
+		{name: "missing configmap", want: `configmaps "orders-seed" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := fake.NewSimpleClientset(tt.objects...)
+			finishJobsWith(cs, batchv1.JobFailed)
+			p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+			p.PollInterval = time.Millisecond
+
+			progress := func(step, message string) {
+				if step == "apply-manifests" {
+					markReady(t, cs, "team-a", "db1")
+				}
+			}
+			err := p.Provision(context.Background(), initScriptsTask(), progress)
+			var stepErr *StepError
+			if !errors.As(err, &stepErr) || stepErr.Step != StepInitScripts || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected an init-scripts step error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
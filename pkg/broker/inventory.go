@@ -0,0 +1,68 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Inventory lists every deployment whose workloads the broker created, in
+// any namespace, so the manager can recover from lost state. It is read from
+// the workloads' ownership labels rather than the broker's memory, so it
+// survives restarts; deployments that haven't created a workload yet are not
+// listed.
+func (c *StateCollector) Inventory(ctx context.Context) ([]InventoryItem, error) {
+	selector := labels.SelectorFromSet(labels.Set{LabelManagedBy: ManagedByValue}).String()
+	workloads, err := c.listWorkloads(ctx, metav1.NamespaceAll, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	items := []InventoryItem{}
+	for _, w := range workloads {
+		id := w.meta.Labels[LabelDeploymentID]
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var state ResourceState
+		if err := c.setHealth(ctx, &state, w); err != nil {
+			return nil, err
+		}
+		item := InventoryItem{
+			DeploymentID: id,
+			ResourceType: w.meta.Labels[LabelResourceType],
+			ResourceName: w.meta.Labels[LabelResourceName],
+			Namespace:    w.meta.Namespace,
+			Phase:        state.Phase,
+		}
+		if source := w.meta.Annotations[AnnotationSourceNamespace]; source != "" && source != w.meta.Namespace {
+			item.Namespace = source
+			item.TargetNamespace = w.meta.Namespace
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].DeploymentID < items[j].DeploymentID })
+	return items, nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestStateCollector_Inventory(t *testing.T) {
+	sts, svc := provisionedObjects(t)
+
+	// A deployment whose workload lives outside the requesting namespace
+	req := validProvisionRequest()
+	req.ResourceName = "db2"
+	req.Namespace = "team-b"
+	req.TargetNamespace = "infra-databases"
+	shared := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "infra-databases", Name: "db2"}}
+	ApplyResourceLabels(shared, "deploy-2", req)
+
+	unmanaged := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "other"}}
+
+	items, err := NewStateCollector(fake.NewSimpleClientset(sts, svc, shared, unmanaged, postgresPod("db1-0", true, "")), nil).
+		Inventory(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []InventoryItem{
+		{DeploymentID: "deploy-1", ResourceType: "database", ResourceName: "db1", Namespace: "team-a", Phase: "Ready"},
+		{DeploymentID: "deploy-2", ResourceType: "database", ResourceName: "db2", Namespace: "team-b", TargetNamespace: "infra-databases", Phase: "Provisioning"},
+	}
+	if len(items) != len(want) {
+		t.Fatalf("expected %d deployments, got %+v", len(want), items)
+	}
+	for i := range want {
+		if items[i] != want[i] {
+			t.Fatalf("expected %+v, got %+v", want[i], items[i])
+		}
+	}
+}
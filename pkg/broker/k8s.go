@@ -17,9 +17,14 @@ limitations under the License.
 package broker
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -27,8 +32,9 @@ import (
 
 // K8sClient wraps the Kubernetes client
 type K8sClient struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	config    *rest.Config
+	usage     UsageCollector
 }
 
 // NewK8sClient creates a new Kubernetes client
@@ -65,11 +71,23 @@ func NewK8sClient() (*K8sClient, error) {
 	return &K8sClient{
 		clientset: clientset,
 		config:    config,
+		usage:     NewMetricsServerCollector(clientset.Discovery().RESTClient()),
 	}, nil
 }
 
+// NewK8sClientForClientset wraps an existing clientset, e.g. a fake clientset in tests
+func NewK8sClientForClientset(clientset kubernetes.Interface) *K8sClient {
+	return &K8sClient{clientset: clientset}
+}
+
+// SetUsageCollector replaces the collector used to report resource usage.
+// A nil collector disables usage reporting.
+func (c *K8sClient) SetUsageCollector(usage UsageCollector) {
+	c.usage = usage
+}
+
 // Clientset returns the underlying Kubernetes clientset
-func (c *K8sClient) Clientset() *kubernetes.Clientset {
+func (c *K8sClient) Clientset() kubernetes.Interface {
 	return c.clientset
 }
 
@@ -77,3 +95,125 @@ func (c *K8sClient) Clientset() *kubernetes.Clientset {
 func (c *K8sClient) Config() *rest.Config {
 	return c.config
 }
+
+// ListManagedResources finds the workloads the broker created in the requested
+// namespace, matched via the ownership labels applied at creation
+func (c *K8sClient) ListManagedResources(ctx context.Context, req ResourceStateRequest) ([]ResourceState, error) {
+	return NewStateCollector(c.clientset, c.usage).Collect(ctx, req)
+}
+
+// Inventory lists every deployment the broker has workloads for
+func (c *K8sClient) Inventory(ctx context.Context) ([]InventoryItem, error) {
+	return NewStateCollector(c.clientset, nil).Inventory(ctx)
+}
+
+// DeploymentConnection reads the non-secret connection metadata of a
+// deployment from the credentials Secret created for it. Credentials in the
+// Secret are never returned. It returns ErrDeploymentNotFound if the
+// deployment has no credentials Secret.
+func (c *K8sClient) DeploymentConnection(ctx context.Context, deploymentID string) (ConnectionDetails, error) {
+	selector := labels.SelectorFromSet(labels.Set{LabelDeploymentID: deploymentID}).String()
+	secrets, err := c.clientset.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return ConnectionDetails{}, fmt.Errorf("failed to list secrets for deployment %s: %w", deploymentID, err)
+	}
+	for _, secret := range secrets.Items {
+		host := string(secret.Data["host"])
+		if host == "" {
+			continue
+		}
+		details := ConnectionDetails{
+			DeploymentID:     deploymentID,
+			Namespace:        secret.Namespace,
+			Host:             host,
+			Database:         string(secret.Data["database"]),
+			ConnectionSecret: secret.Name,
+		}
+		if port, err := strconv.ParseInt(string(secret.Data["port"]), 10, 32); err == nil {
+			details.Port = int32(port)
+		}
+		return details, nil
+	}
+	return ConnectionDetails{}, fmt.Errorf("%w: %s has no connection details", ErrDeploymentNotFound, deploymentID)
+}
+
+// managedObject is a broker-created object found for deletion
+type managedObject struct {
+	kind   string
+	name   string
+	delete func(context.Context, string, metav1.DeleteOptions) error
+}
+
+// DeleteDeployment deletes the StatefulSets, Deployments, Services and Secrets
+// the broker created for a deployment in namespace, found via the ownership
+// labels, and returns how many it deleted. Pods are removed with their
+// workload; the data volumes of StatefulSets are kept. A deployment with
+// nothing left to delete is not an error, so deprovisioning can be retried.
+func (c *K8sClient) DeleteDeployment(ctx context.Context, namespace, deploymentID string) (int, error) {
+	opts := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(labels.Set{
+		LabelManagedBy:    ManagedByValue,
+		LabelDeploymentID: deploymentID,
+	}).String()}
+
+	objects, err := c.listManagedObjects(ctx, namespace, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	background := metav1.DeletePropagationBackground
+	deleted := 0
+	for _, obj := range objects {
+		if err := obj.delete(ctx, obj.name, metav1.DeleteOptions{PropagationPolicy: &background}); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return deleted, fmt.Errorf("failed to delete %s %s/%s: %w", obj.kind, namespace, obj.name, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// listManagedObjects lists the kinds of object the broker creates in
+// namespace matching opts, workloads first
+func (c *K8sClient) listManagedObjects(ctx context.Context, namespace string, opts metav1.ListOptions) ([]managedObject, error) {
+	var objects []managedObject
+
+	statefulSets := c.clientset.AppsV1().StatefulSets(namespace)
+	stsList, err := statefulSets.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, sts := range stsList.Items {
+		objects = append(objects, managedObject{"statefulset", sts.Name, statefulSets.Delete})
+	}
+
+	deployments := c.clientset.AppsV1().Deployments(namespace)
+	deployList, err := deployments.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deploy := range deployList.Items {
+		objects = append(objects, managedObject{"deployment", deploy.Name, deployments.Delete})
+	}
+
+	services := c.clientset.CoreV1().Services(namespace)
+	svcList, err := services.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, svc := range svcList.Items {
+		objects = append(objects, managedObject{"service", svc.Name, services.Delete})
+	}
+
+	secrets := c.clientset.CoreV1().Secrets(namespace)
+	secretList, err := secrets.List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, secret := range secretList.Items {
+		objects = append(objects, managedObject{"secret", secret.Name, secrets.Delete})
+	}
+
+	return objects, nil
+}
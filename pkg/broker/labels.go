@@ -0,0 +1,130 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Labels and annotations applied to every Kubernetes resource the broker creates.
+// Labels link a live resource back to its deployment so the state-query
+// endpoint can find it; annotations carry values that are not valid label values.
+const (
+	LabelManagedBy    = "platform.company.com/managed-by"
+	LabelDeploymentID = "platform.company.com/deployment-id"
+	LabelResourceType = "platform.company.com/resource-type"
+	LabelResourceName = "platform.company.com/resource-name"
+
+	AnnotationTeam            = "platform.company.com/team"
+	AnnotationOwner           = "platform.company.com/owner"
+	AnnotationSourceNamespace = "platform.company.com/source-namespace"
+
+	// AnnotationDesiredSpec records the request spec a workload was last
+	// provisioned with, as JSON, for drift detection
+	AnnotationDesiredSpec = "platform.company.com/desired-spec"
+
+	// Provenance of the request, from its Source
+	AnnotationSourceRepository  = "platform.company.com/source-repository"
+	AnnotationSourceRevision    = "platform.company.com/source-revision"
+	AnnotationSourcePath        = "platform.company.com/source-path"
+	AnnotationSourceApplication = "platform.company.com/source-application"
+	AnnotationCorrelationID     = "platform.company.com/correlation-id"
+
+	// ManagedByValue is the value of LabelManagedBy on broker-created resources
+	ManagedByValue = "kidp"
+)
+
+// ResourceLabels returns the labels identifying a resource created for a deployment
+func ResourceLabels(deploymentID, resourceType, resourceName string) map[string]string {
+	return map[string]string{
+		LabelManagedBy:    ManagedByValue,
+		LabelDeploymentID: deploymentID,
+		LabelResourceType: resourceType,
+		LabelResourceName: resourceName,
+	}
+}
+
+// ApplyResourceLabels stamps the ownership labels and annotations for a
+// provision request onto obj, preserving any labels already set
+func ApplyResourceLabels(obj metav1.Object, deploymentID string, req ProvisionRequest) {
+	objLabels := obj.GetLabels()
+	if objLabels == nil {
+		objLabels = map[string]string{}
+	}
+	for k, v := range ResourceLabels(deploymentID, req.ResourceType, req.ResourceName) {
+		objLabels[k] = v
+	}
+	obj.SetLabels(objLabels)
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if req.Team != "" {
+		annotations[AnnotationTeam] = req.Team
+	}
+	if req.Owner != "" {
+		annotations[AnnotationOwner] = req.Owner
+	}
+	// Record where the requesting CR lives when the workload is placed elsewhere
+	if req.Namespace != "" && req.WorkloadNamespace() != req.Namespace {
+		annotations[AnnotationSourceNamespace] = req.Namespace
+	}
+	for k, v := range req.Source.Annotations() {
+		annotations[k] = v
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// Annotations returns the provenance annotations for the set fields. They are
+// annotations rather than labels because repository URLs and paths are not
+// valid label values.
+func (s *Source) Annotations() map[string]string {
+	annotations := map[string]string{}
+	if s == nil {
+		return annotations
+	}
+	for k, v := range map[string]string{
+		AnnotationSourceRepository:  s.Repository,
+		AnnotationSourceRevision:    s.Revision,
+		AnnotationSourcePath:        s.Path,
+		AnnotationSourceApplication: s.Application,
+		AnnotationCorrelationID:     s.CorrelationID,
+	} {
+		if v != "" {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// LabelSelector builds the selector matching broker-managed resources for the
+// optional filters in the request
+func (r *ResourceStateRequest) LabelSelector() string {
+	set := labels.Set{LabelManagedBy: ManagedByValue}
+	if r.DeploymentID != "" {
+		set[LabelDeploymentID] = r.DeploymentID
+	}
+	if r.ResourceType != "" {
+		set[LabelResourceType] = r.ResourceType
+	}
+	if r.ResourceName != "" {
+		set[LabelResourceName] = r.ResourceName
+	}
+	return labels.SelectorFromSet(set).String()
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func labeledStatefulSet(name, deploymentID string) *appsv1.StatefulSet {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name}}
+	ApplyResourceLabels(sts, deploymentID, ProvisionRequest{
+		ResourceType: "database",
+		ResourceName: name,
+		Team:         "Team/platform",
+		Owner:        "alice",
+	})
+	return sts
+}
+
+func TestApplyResourceLabels(t *testing.T) {
+	sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "db1"}}}
+	ApplyResourceLabels(sts, "deploy-1", ProvisionRequest{ResourceType: "database", ResourceName: "db1", Team: "Team/platform"})
+
+	want := map[string]string{
+		"app":             "db1",
+		LabelManagedBy:    ManagedByValue,
+		LabelDeploymentID: "deploy-1",
+		LabelResourceType: "database",
+		LabelResourceName: "db1",
+	}
+	for k, v := range want {
+		if sts.Labels[k] != v {
+			t.Fatalf("expected label %s=%s, got %q", k, v, sts.Labels[k])
+		}
+	}
+	if sts.Annotations[AnnotationTeam] != "Team/platform" {
+		t.Fatalf("expected team annotation, got %v", sts.Annotations)
+	}
+	if _, ok := sts.Annotations[AnnotationSourceRepository]; ok {
+		t.Fatalf("expected no source annotations without a source, got %v", sts.Annotations)
+	}
+}
+
+func TestApplyResourceLabels_TagsSource(t *testing.T) {
+	sts := &appsv1.StatefulSet{}
+	req := validProvisionRequest()
+	req.Source = &Source{Repository: "https://github.com/acme/platform", Revision: "4f2c1ab", Path: "envs/prod/db.yaml"}
+	ApplyResourceLabels(sts, "deploy-1", req)
+
+	want := map[string]string{
+		AnnotationSourceRepository: "https://github.com/acme/platform",
+		AnnotationSourceRevision:   "4f2c1ab",
+		AnnotationSourcePath:       "envs/prod/db.yaml",
+	}
+	for k, v := range want {
+		if sts.Annotations[k] != v {
+			t.Fatalf("expected annotation %s=%s, got %q", k, v, sts.Annotations[k])
+		}
+	}
+	for _, k := range []string{AnnotationSourceApplication, AnnotationCorrelationID} {
+		if _, ok := sts.Annotations[k]; ok {
+			t.Fatalf("expected unset source field %s not to be annotated", k)
+		}
+	}
+}
+
+func TestListManagedResources_ByDeploymentID(t *testing.T) {
+	unmanaged := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "other"}}
+	cs := fake.NewSimpleClientset(
+		labeledStatefulSet("db1", "deploy-1"),
+		labeledStatefulSet("db2", "deploy-2"),
+		unmanaged,
+	)
+	c := NewK8sClientForClientset(cs)
+
+	states, err := c.ListManagedResources(context.Background(), ResourceStateRequest{
+		Namespace:    "team-a",
+		DeploymentID: "deploy-2",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("expected 1 resource, got %d: %+v", len(states), states)
+	}
+	if states[0].DeploymentID != "deploy-2" || states[0].ResourceName != "db2" || states[0].ResourceType != "database" {
+		t.Fatalf("unexpected resource state: %+v", states[0])
+	}
+
+	all, err := c.ListManagedResources(context.Background(), ResourceStateRequest{Namespace: "team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("expected only the 2 managed resources, got %d", len(all))
+	}
+}
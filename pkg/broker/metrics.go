@@ -0,0 +1,190 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Provision request results recorded by Metrics
+const (
+	ProvisionResultSucceeded = "succeeded"
+	ProvisionResultFailed    = "failed"
+	ProvisionResultRejected  = "rejected"
+)
+
+// Reasons a callback was not delivered, recorded by Metrics
+const (
+	// CallbackFailureRetriesExhausted is a callback that still failed after
+	// its last retry
+	CallbackFailureRetriesExhausted = "retries_exhausted"
+	// CallbackFailureRejected is a callback the manager refused with a
+	// response that isn't worth retrying
+	CallbackFailureRejected = "rejected"
+	// CallbackFailureCancelled is a callback abandoned because its context
+	// ended while waiting to retry
+	CallbackFailureCancelled = "cancelled"
+)
+
+// Metrics records the broker's Prometheus metrics. A nil *Metrics records
+// nothing, so components work without one.
+type Metrics struct {
+	provisionRequests *prometheus.CounterVec
+	provisionDuration *prometheus.HistogramVec
+	callbackAttempts  *prometheus.CounterVec
+	callbackRetries   prometheus.Counter
+	callbackSuccesses prometheus.Counter
+	callbackFailures  *prometheus.CounterVec
+	httpDuration      *prometheus.HistogramVec
+}
+
+// NewMetrics creates the broker's metrics and registers them with reg
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		provisionRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "broker_provision_requests_total",
+			Help: "Provision and reconfigure requests by resource type and result (succeeded, failed or rejected at capacity).",
+		}, []string{"resource_type", "result"}),
+		provisionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "broker_provision_duration_seconds",
+			Help:    "Time from accepting a deployment to its completion, including time queued.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+		}, []string{"resource_type", "result"}),
+		callbackAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "broker_callback_attempts_total",
+			Help: "Status callback delivery attempts, including retries and replays, by result.",
+		}, []string{"result"}),
+		callbackRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "broker_callback_retries_total",
+			Help: "Status callback delivery attempts that retried a failed attempt.",
+		}),
+		callbackSuccesses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "broker_callback_successes_total",
+			Help: "Status callbacks delivered, including dead letters delivered on replay.",
+		}),
+		callbackFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "broker_callback_failures_total",
+			Help: "Status callbacks not delivered, by reason (retries_exhausted, rejected or cancelled).",
+		}, []string{"reason"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "broker_http_request_duration_seconds",
+			Help:    "HTTP request duration by route and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path", "code"}),
+	}
+	reg.MustRegister(m.provisionRequests, m.provisionDuration, m.callbackAttempts, m.callbackRetries,
+		m.callbackSuccesses, m.callbackFailures, m.httpDuration)
+	return m
+}
+
+// ProvisionRejected counts a request turned away because the broker or the
+// team was at capacity
+func (m *Metrics) ProvisionRejected(resourceType string) {
+	if m == nil {
+		return
+	}
+	m.provisionRequests.WithLabelValues(resourceType, ProvisionResultRejected).Inc()
+}
+
+// ProvisionFinished counts a completed deployment, failed if err is not nil,
+// and records how long it took
+func (m *Metrics) ProvisionFinished(resourceType string, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	result := ProvisionResultSucceeded
+	if err != nil {
+		result = ProvisionResultFailed
+	}
+	m.provisionRequests.WithLabelValues(resourceType, result).Inc()
+	m.provisionDuration.WithLabelValues(resourceType, result).Observe(duration.Seconds())
+}
+
+// CallbackAttempt counts one callback delivery attempt, failed if err is not
+// nil
+func (m *Metrics) CallbackAttempt(err error) {
+	if m == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	m.callbackAttempts.WithLabelValues(result).Inc()
+}
+
+// CallbackRetry counts a retry of a failed callback attempt
+func (m *Metrics) CallbackRetry() {
+	if m == nil {
+		return
+	}
+	m.callbackRetries.Inc()
+}
+
+// CallbackDelivered counts a delivered callback
+func (m *Metrics) CallbackDelivered() {
+	if m == nil {
+		return
+	}
+	m.callbackSuccesses.Inc()
+}
+
+// CallbackFailed counts a callback that was not delivered, for one of the
+// CallbackFailure reasons
+func (m *Metrics) CallbackFailed(reason string) {
+	if m == nil {
+		return
+	}
+	m.callbackFailures.WithLabelValues(reason).Inc()
+}
+
+// HTTPRequest records a handled request. path must be the route pattern
+// rather than the request path, so IDs in the path don't create new series.
+func (m *Metrics) HTTPRequest(path string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpDuration.WithLabelValues(path, strconv.Itoa(code)).Observe(duration.Seconds())
+}
+
+var (
+	activeDeploymentsDesc = prometheus.NewDesc("broker_active_deployments",
+		"Deployments accepted and not yet finished.", nil, nil)
+	totalDeploymentsDesc = prometheus.NewDesc("broker_deployments_total",
+		"Deployments accepted since the broker started.", nil, nil)
+	failedDeploymentsDesc = prometheus.NewDesc("broker_failed_deployments_total",
+		"Deployments that failed since the broker started.", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (t *DeploymentTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeDeploymentsDesc
+	ch <- totalDeploymentsDesc
+	ch <- failedDeploymentsDesc
+}
+
+// Collect implements prometheus.Collector, reporting the tracker's counters
+// as of the scrape
+func (t *DeploymentTracker) Collect(ch chan<- prometheus.Metric) {
+	counts := t.Counts()
+	ch <- prometheus.MustNewConstMetric(activeDeploymentsDesc, prometheus.GaugeValue, float64(counts.Active))
+	ch <- prometheus.MustNewConstMetric(totalDeploymentsDesc, prometheus.CounterValue, float64(counts.Total))
+	ch <- prometheus.MustNewConstMetric(failedDeploymentsDesc, prometheus.CounterValue, float64(counts.Failed))
+}
@@ -18,7 +18,11 @@ limitations under the License.
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // ProvisionRequest represents a request to provision a resource
@@ -26,7 +30,11 @@ type ProvisionRequest struct {
 	// Resource identification
 	ResourceType string `json:"resourceType"` // database, cache, topic, etc.
 	ResourceName string `json:"resourceName"`
-	Namespace    string `json:"namespace"`
+	Namespace    string `json:"namespace"` // Namespace of the requesting CR
+
+	// TargetNamespace is where the broker creates the workload. When empty the
+	// workload is created alongside the CR in Namespace.
+	TargetNamespace string `json:"targetNamespace,omitempty"`
 
 	// Ownership
 	Team  string `json:"team"`
@@ -35,10 +43,34 @@ type ProvisionRequest struct {
 	// Callback configuration
 	CallbackURL string `json:"callbackUrl"` // URL to POST status updates
 
+	// CallbackURLs are further URLs, in order of preference, that status
+	// updates are sent to when CallbackURL fails, such as the other replica
+	// of a manager HA pair
+	CallbackURLs []string `json:"callbackUrls,omitempty"`
+
+	// CallbackToken is issued by the manager for this deployment and must be
+	// echoed on its callbacks
+	CallbackToken string `json:"callbackToken,omitempty"`
+
+	// Source records where the requesting CR came from, for provenance
+	Source *Source `json:"source,omitempty"`
+
+	// Priority orders the request in the worker queue when the broker is
+	// saturated; higher values run first. Unset is PriorityNormal.
+	Priority int `json:"priority,omitempty"`
+
 	// Resource specification
 	Spec map[string]interface{} `json:"spec"` // Resource-specific configuration
 }
 
+// Provisioning priorities. The manager derives them from the resource's tier
+// so production work isn't stuck behind dev work during a capacity crunch.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
 // Validate checks if the provision request is valid
 func (r *ProvisionRequest) Validate() error {
 	if r.ResourceType == "" {
@@ -56,10 +88,34 @@ func (r *ProvisionRequest) Validate() error {
 	if r.CallbackURL == "" {
 		return fmt.Errorf("callbackUrl is required")
 	}
+	for i, u := range r.CallbackURLs {
+		if u == "" {
+			return fmt.Errorf("callbackUrls[%d] is empty", i)
+		}
+	}
 	if r.Spec == nil {
 		return fmt.Errorf("spec is required")
 	}
-	return nil
+	return validateTargetNamespace(r.TargetNamespace)
+}
+
+// WorkloadNamespace returns the namespace the broker should create the workload in
+func (r *ProvisionRequest) WorkloadNamespace() string {
+	if r.TargetNamespace != "" {
+		return r.TargetNamespace
+	}
+	return r.Namespace
+}
+
+// Source is the GitOps provenance of a request: the repository, revision and
+// path the requesting CR was applied from, and a correlation ID linking the
+// deployment to the change that caused it
+type Source struct {
+	Repository    string `json:"repository,omitempty"`
+	Revision      string `json:"revision,omitempty"`
+	Path          string `json:"path,omitempty"`
+	Application   string `json:"application,omitempty"`
+	CorrelationID string `json:"correlationId,omitempty"`
 }
 
 // DeprovisionRequest represents a request to deprovision a resource
@@ -70,6 +126,9 @@ type DeprovisionRequest struct {
 	ResourceName string `json:"resourceName"`
 	Namespace    string `json:"namespace"`
 
+	// TargetNamespace is where the workload was created, if different from Namespace
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
 	// Callback configuration
 	CallbackURL string `json:"callbackUrl"`
 }
@@ -91,14 +150,119 @@ func (r *DeprovisionRequest) Validate() error {
 	if r.CallbackURL == "" {
 		return fmt.Errorf("callbackUrl is required")
 	}
+	return validateTargetNamespace(r.TargetNamespace)
+}
+
+// WorkloadNamespace returns the namespace the workload lives in
+func (r *DeprovisionRequest) WorkloadNamespace() string {
+	if r.TargetNamespace != "" {
+		return r.TargetNamespace
+	}
+	return r.Namespace
+}
+
+// validateTargetNamespace checks an optional target namespace is a valid namespace name
+func validateTargetNamespace(ns string) error {
+	if ns == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+		return fmt.Errorf("targetNamespace %q is invalid: %s", ns, strings.Join(errs, "; "))
+	}
 	return nil
 }
 
+// ReconfigureRequest applies a changed spec to a resource the broker already
+// provisioned. Progress is reported through callbacks as for provisioning.
+type ReconfigureRequest struct {
+	DeploymentID string `json:"deploymentId"`
+	ProvisionRequest
+}
+
+// Validate checks if the reconfigure request is valid
+func (r *ReconfigureRequest) Validate() error {
+	if r.DeploymentID == "" {
+		return fmt.Errorf("deploymentId is required")
+	}
+	return r.ProvisionRequest.Validate()
+}
+
 // ProvisionResponse is the immediate response to a provision request
 type ProvisionResponse struct {
 	Status       string `json:"status"`       // accepted
 	DeploymentID string `json:"deploymentId"` // Unique ID for this deployment
 	Message      string `json:"message"`
+
+	// EstimatedMonthlyCost is the broker's cost estimate for the resource, if one could be made
+	EstimatedMonthlyCost float64 `json:"estimatedMonthlyCost,omitempty"`
+}
+
+// EstimateRequest asks the broker to price a resource without provisioning it
+type EstimateRequest struct {
+	ResourceType string                 `json:"resourceType"`
+	Spec         map[string]interface{} `json:"spec"`
+}
+
+// Validate checks if the estimate request is valid
+func (r *EstimateRequest) Validate() error {
+	if r.ResourceType == "" {
+		return fmt.Errorf("resourceType is required")
+	}
+	if r.Spec == nil {
+		return fmt.Errorf("spec is required")
+	}
+	return nil
+}
+
+// CallbackURLUpdate changes where callbacks for an in-flight deployment are
+// sent, e.g. after the manager's webhook service moves
+type CallbackURLUpdate struct {
+	DeploymentID string `json:"deploymentId"`
+	CallbackURL  string `json:"callbackUrl"`
+}
+
+// Validate checks if the callback URL update is valid
+func (r *CallbackURLUpdate) Validate() error {
+	if r.DeploymentID == "" {
+		return fmt.Errorf("deploymentId is required")
+	}
+	if r.CallbackURL == "" {
+		return fmt.Errorf("callbackUrl is required")
+	}
+	u, err := url.Parse(r.CallbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callbackUrl %q must be an absolute http or https URL", r.CallbackURL)
+	}
+	return nil
+}
+
+// CallbackURLUpdateResponse confirms a callback URL update
+type CallbackURLUpdateResponse struct {
+	Status       string `json:"status"` // updated
+	DeploymentID string `json:"deploymentId"`
+	CallbackURL  string `json:"callbackUrl"`
+}
+
+// CallbackReplayRequest asks the broker to re-send the last callback of a
+// deployment the manager missed
+type CallbackReplayRequest struct {
+	DeploymentID string `json:"deploymentId"`
+}
+
+// Validate checks if the callback replay request is valid
+func (r *CallbackReplayRequest) Validate() error {
+	if r.DeploymentID == "" {
+		return fmt.Errorf("deploymentId is required")
+	}
+	return nil
+}
+
+// CallbackReplayResponse confirms a replayed callback
+type CallbackReplayResponse struct {
+	Status       string `json:"status"` // replayed
+	DeploymentID string `json:"deploymentId"`
+	Phase        string `json:"phase"`
+	CallbackURL  string `json:"callbackUrl"`
 }
 
 // DeprovisionResponse is the immediate response to a deprovision request
@@ -126,11 +290,39 @@ type CallbackRequest struct {
 	Endpoint           string                 `json:"endpoint,omitempty"`           // Connection endpoint
 	Port               int32                  `json:"port,omitempty"`               // Connection port
 	ConnectionSecret   string                 `json:"connectionSecret,omitempty"`   // Name of K8s secret with credentials
+	Region             string                 `json:"region,omitempty"`             // Region the resource was placed in, if known
 	Details            map[string]interface{} `json:"details,omitempty"`            // Additional details
 	AdditionalMetadata map[string]string      `json:"additionalMetadata,omitempty"` // Resource-specific metadata
 
 	// Cost tracking
 	EstimatedMonthlyCost float64 `json:"estimatedMonthlyCost,omitempty"`
+
+	// AppliedSpec is the spec the resource was provisioned or reconfigured
+	// with (populated when Ready)
+	AppliedSpec map[string]interface{} `json:"appliedSpec,omitempty"`
+
+	// Nonce identifies this status update across retries, so the manager can
+	// drop a retry of an update it already processed. It is part of the
+	// signed body.
+	Nonce string `json:"nonce,omitempty"`
+
+	// Logs is the broker path of the deployment's provisioning logs
+	// (populated when failed)
+	Logs string `json:"logs,omitempty"`
+
+	// CallbackToken is sent in a header rather than the body
+	CallbackToken string `json:"-"`
+}
+
+// ConnectionDetails is the non-secret connection metadata of a deployment.
+// Credentials stay in the named Secret.
+type ConnectionDetails struct {
+	DeploymentID     string `json:"deploymentId"`
+	Namespace        string `json:"namespace"`
+	Host             string `json:"host"`
+	Port             int32  `json:"port,omitempty"`
+	Database         string `json:"database,omitempty"`
+	ConnectionSecret string `json:"connectionSecret"`
 }
 
 // StatusResponse is returned when querying the status of a deployment
@@ -141,6 +333,21 @@ type StatusResponse struct {
 	LastUpdated  time.Time `json:"lastUpdated"`
 }
 
+// LogEntry is one line of a deployment's provisioning log
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Step    string    `json:"step,omitempty"`
+	Message string    `json:"message"`
+}
+
+// DeploymentLogsResponse is returned when querying the logs of a deployment.
+// Truncated is set when older entries were left out.
+type DeploymentLogsResponse struct {
+	DeploymentID string     `json:"deploymentId"`
+	Entries      []LogEntry `json:"entries"`
+	Truncated    bool       `json:"truncated,omitempty"`
+}
+
 // ResourceStateRequest represents a request to get the actual state of a resource
 type ResourceStateRequest struct {
 	ResourceType string `json:"resourceType,omitempty"` // Optional filter
@@ -205,6 +412,22 @@ type ResourceStateResponse struct {
 	Namespace string          `json:"namespace"`
 }
 
+// InventoryItem is one deployment the broker manages
+type InventoryItem struct {
+	DeploymentID    string `json:"deploymentId"`
+	ResourceType    string `json:"resourceType"`
+	ResourceName    string `json:"resourceName"`
+	Namespace       string `json:"namespace"`                 // Namespace of the requesting resource, not the workload
+	TargetNamespace string `json:"targetNamespace,omitempty"` // Namespace of the workload when it differs
+	Phase           string `json:"phase"`                     // Provisioning, Ready or Failed
+}
+
+// InventoryResponse is returned by the inventory endpoint
+type InventoryResponse struct {
+	Deployments []InventoryItem `json:"deployments"`
+	Total       int             `json:"total"`
+}
+
 // ErrorResponse is returned when an error occurs
 type ErrorResponse struct {
 	Error   string `json:"error"`
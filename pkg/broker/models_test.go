@@ -0,0 +1,86 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+func validProvisionRequest() ProvisionRequest {
+	return ProvisionRequest{
+		ResourceType: "database",
+		ResourceName: "db1",
+		Namespace:    "team-a",
+		Team:         "Team/platform",
+		CallbackURL:  "http://manager:9090/v1/callback",
+		Spec:         map[string]interface{}{"engine": "postgresql"},
+	}
+}
+
+func TestProvisionRequest_WorkloadNamespace(t *testing.T) {
+	req := validProvisionRequest()
+	if got := req.WorkloadNamespace(); got != "team-a" {
+		t.Fatalf("expected workload namespace to default to team-a, got %s", got)
+	}
+
+	req.TargetNamespace = "infra-databases"
+	if err := req.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+	if got := req.WorkloadNamespace(); got != "infra-databases" {
+		t.Fatalf("expected workload namespace infra-databases, got %s", got)
+	}
+	if req.Namespace != "team-a" {
+		t.Fatalf("source namespace should be unchanged, got %s", req.Namespace)
+	}
+}
+
+func TestProvisionRequest_InvalidTargetNamespace(t *testing.T) {
+	req := validProvisionRequest()
+	req.TargetNamespace = "Infra_DBs"
+	if err := req.Validate(); err == nil {
+		t.Fatalf("expected invalid targetNamespace to fail validation")
+	}
+}
+
+func TestProvisionRequest_EmptyCallbackURLs(t *testing.T) {
+	req := validProvisionRequest()
+	req.CallbackURLs = []string{"http://manager-2:9090/v1/callback", ""}
+	if err := req.Validate(); err == nil || !strings.Contains(err.Error(), "callbackUrls[1]") {
+		t.Fatalf("expected the empty callback URL to fail validation, got %v", err)
+	}
+}
+
+func TestApplyResourceLabels_RecordsSourceNamespace(t *testing.T) {
+	req := validProvisionRequest()
+	req.TargetNamespace = "infra-databases"
+
+	sts := &appsv1.StatefulSet{}
+	ApplyResourceLabels(sts, "deploy-1", req)
+	if sts.Annotations[AnnotationSourceNamespace] != "team-a" {
+		t.Fatalf("expected source namespace annotation team-a, got %v", sts.Annotations)
+	}
+
+	sameNS := &appsv1.StatefulSet{}
+	ApplyResourceLabels(sameNS, "deploy-2", validProvisionRequest())
+	if _, ok := sameNS.Annotations[AnnotationSourceNamespace]; ok {
+		t.Fatalf("did not expect source namespace annotation when namespaces match")
+	}
+}
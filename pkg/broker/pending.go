@@ -0,0 +1,147 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PendingTask is an accepted provisioning task that hasn't finished, kept so
+// it can be resumed if the broker restarts before it does
+type PendingTask struct {
+	DeploymentID         string           `json:"deploymentId"`
+	Request              ProvisionRequest `json:"request"`
+	EstimatedMonthlyCost float64          `json:"estimatedMonthlyCost,omitempty"`
+	QueuedAt             time.Time        `json:"queuedAt"`
+}
+
+// Task returns the task to run
+func (p PendingTask) Task() ProvisionTask {
+	return ProvisionTask{
+		DeploymentID:         p.DeploymentID,
+		Request:              p.Request,
+		EstimatedMonthlyCost: p.EstimatedMonthlyCost,
+	}
+}
+
+// TaskStore persists queued and running provisioning tasks
+type TaskStore interface {
+	// Write stores a task, replacing any with the same deployment ID
+	Write(task PendingTask) error
+	// List returns the stored tasks, oldest first
+	List() ([]PendingTask, error)
+	// Delete removes a task; deleting an unknown ID is not an error
+	Delete(deploymentID string) error
+}
+
+// FileTaskStore keeps each pending task as a JSON file in a directory, so
+// queued provisions survive a broker restart
+type FileTaskStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileTaskStore creates a store in dir, creating it if needed
+func NewFileTaskStore(dir string) (*FileTaskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create pending task directory %s: %w", dir, err)
+	}
+	return &FileTaskStore{dir: dir}, nil
+}
+
+func (s *FileTaskStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid deployment id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Write stores the task. The file is written under a temporary name and
+// renamed, so a crash never leaves a partial task behind. Files are only
+// readable by the broker as they hold the callback token.
+func (s *FileTaskStore) Write(task PendingTask) error {
+	path, err := s.path(task.DeploymentID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending task %s: %w", task.DeploymentID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write pending task %s: %w", task.DeploymentID, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write pending task %s: %w", task.DeploymentID, err)
+	}
+	return nil
+}
+
+// List reads every stored task, oldest first. Unreadable files are skipped
+// rather than blocking the rest.
+func (s *FileTaskStore) List() ([]PendingTask, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending tasks: %w", err)
+	}
+
+	tasks := make([]PendingTask, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var task PendingTask
+		if err := json.Unmarshal(data, &task); err != nil || task.DeploymentID == "" {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].QueuedAt.Before(tasks[j].QueuedAt)
+	})
+	return tasks, nil
+}
+
+// Delete removes the task of the given deployment
+func (s *FileTaskStore) Delete(deploymentID string) error {
+	path, err := s.path(deploymentID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete pending task %s: %w", deploymentID, err)
+	}
+	return nil
+}
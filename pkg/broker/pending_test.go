@@ -0,0 +1,71 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileTaskStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pending-tasks")
+	store, err := NewFileTaskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	for _, task := range []PendingTask{
+		{DeploymentID: "deploy-b", QueuedAt: now.Add(time.Second), Request: validProvisionRequest()},
+		{DeploymentID: "deploy-a", QueuedAt: now, Request: validProvisionRequest()},
+	} {
+		if err := store.Write(task); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "deploy-a.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected pending tasks to be private to the broker, got %v", info.Mode().Perm())
+	}
+
+	tasks, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 || tasks[0].DeploymentID != "deploy-a" || tasks[1].DeploymentID != "deploy-b" {
+		t.Fatalf("expected deploy-a then deploy-b, got %+v", tasks)
+	}
+
+	if err := store.Delete("deploy-a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Delete("deploy-a"); err != nil {
+		t.Fatalf("expected deleting a missing task to succeed, got %v", err)
+	}
+	if tasks, _ := store.List(); len(tasks) != 1 || tasks[0].DeploymentID != "deploy-b" {
+		t.Fatalf("expected only deploy-b to remain, got %+v", tasks)
+	}
+
+	if err := store.Write(PendingTask{DeploymentID: "../escape"}); err == nil {
+		t.Fatal("expected an ID naming another directory to be rejected")
+	}
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	postgresPort           = 5432
+	defaultPostgresVersion = "16"
+	postgresUser           = "app"
+	postgresDatabase       = "app"
+)
+
+// postgresCompute is the CPU and memory requested for each database size
+var postgresCompute = map[string]struct{ cpu, memory string }{
+	"small":  {"1", "2Gi"},
+	"medium": {"2", "4Gi"},
+	"large":  {"4", "8Gi"},
+	"xlarge": {"8", "16Gi"},
+}
+
+// postgresStorage is the data volume for each database size, matching the
+// storage the cost estimator prices
+var postgresStorage = map[string]string{
+	"small":  "10Gi",
+	"medium": "50Gi",
+	"large":  "200Gi",
+	"xlarge": "500Gi",
+}
+
+// PostgresProvisioner runs PostgreSQL as a single-replica StatefulSet behind a
+// headless Service, with generated credentials in a Secret. Provisioning is
+// idempotent: existing credentials are kept and the StatefulSet is updated in
+// place, so reconfigure requests go through the same path.
+type PostgresProvisioner struct {
+	client *K8sClient
+
+	// ReadyTimeout bounds the wait for the database to accept connections
+	ReadyTimeout time.Duration
+
+	// PollInterval is how often readiness is checked
+	PollInterval time.Duration
+}
+
+// NewPostgresProvisioner creates a provisioner using the broker's Kubernetes client
+func NewPostgresProvisioner(client *K8sClient) *PostgresProvisioner {
+	return &PostgresProvisioner{
+		client:       client,
+		ReadyTimeout: 10 * time.Minute,
+		PollInterval: 5 * time.Second,
+	}
+}
+
+// Provision creates or updates the database's Kubernetes resources and waits
+// for it to become ready
+func (p *PostgresProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	namespace := task.Request.WorkloadNamespace()
+	name := task.Request.ResourceName
+
+	if err := p.ensureNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	progress("prepare-namespace", "Namespace "+namespace+" ready")
+
+	if err := p.ensureCredentials(ctx, task); err != nil {
+		return err
+	}
+	progress("create-credentials", "Credentials stored in secret "+postgresSecretName(name))
+
+	if err := p.ensureService(ctx, task); err != nil {
+		return err
+	}
+	sts, err := p.postgresStatefulSet(task)
+	if err != nil {
+		return err
+	}
+	if err := p.applyStatefulSet(ctx, sts); err != nil {
+		return err
+	}
+	progress("apply-manifests", "PostgreSQL service and statefulset applied")
+
+	if err := p.waitReady(ctx, namespace, name); err != nil {
+		return err
+	}
+	progress("wait-ready", "PostgreSQL accepting connections")
+
+	ran, err := p.runInitScripts(ctx, task)
+	if err != nil {
+		return &StepError{Step: StepInitScripts, Err: err}
+	}
+	if ran > 0 {
+		progress(StepInitScripts, fmt.Sprintf("Ran %d init script(s)", ran))
+	}
+	return nil
+}
+
+// Connection reports the in-cluster endpoint and credentials secret of the database
+func (p *PostgresProvisioner) Connection(task ProvisionTask) ConnectionInfo {
+	req := task.Request
+	return ConnectionInfo{
+		Endpoint:         fmt.Sprintf("%s.%s.svc.cluster.local", req.ResourceName, req.WorkloadNamespace()),
+		Port:             postgresPort,
+		ConnectionSecret: postgresSecretName(req.ResourceName),
+	}
+}
+
+func postgresSecretName(name string) string {
+	return name + "-credentials"
+}
+
+// postgresSelector selects the pods of one database
+func postgresSelector(name string) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/name":     "postgresql",
+		"app.kubernetes.io/instance": name,
+	}
+}
+
+func (p *PostgresProvisioner) ensureNamespace(ctx context.Context, namespace string) error {
+	namespaces := p.client.Clientset().CoreV1().Namespaces()
+	if _, err := namespaces.Get(ctx, namespace, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
+	if _, err := namespaces.Create(ctx, ns, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// ensureCredentials creates the credentials secret, keeping an existing one so
+// the password doesn't change under running clients
+func (p *PostgresProvisioner) ensureCredentials(ctx context.Context, task ProvisionTask) error {
+	req := task.Request
+	namespace := req.WorkloadNamespace()
+	name := postgresSecretName(req.ResourceName)
+	secrets := p.client.Clientset().CoreV1().Secrets(namespace)
+
+	if _, err := secrets.Get(ctx, name, metav1.GetOptions{}); err == nil {
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	username, password, err := p.adminCredentials(ctx, req)
+	if err != nil {
+		return err
+	}
+	info := p.Connection(task)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Type:       corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			"host":     []byte(info.Endpoint),
+			"port":     []byte(strconv.Itoa(postgresPort)),
+			"username": username,
+			"password": password,
+			"database": []byte(postgresDatabase),
+		},
+	}
+	ApplyResourceLabels(secret, task.DeploymentID, req)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create secret %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// adminCredentials returns the admin username and password for a new
+// database: those in the Secret named by the adminCredentialsSecretRef spec
+// field if set, otherwise the default user with a generated password. The
+// Secret is read from the requesting resource's namespace, never another.
+func (p *PostgresProvisioner) adminCredentials(ctx context.Context, req ProvisionRequest) ([]byte, []byte, error) {
+	ref, _ := req.Spec["adminCredentialsSecretRef"].(map[string]interface{})
+	name, _ := ref["name"].(string)
+	if name == "" {
+		password := make([]byte, 24)
+		if _, err := rand.Read(password); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		return []byte(postgresUser), []byte(hex.EncodeToString(password)), nil
+	}
+
+	secret, err := p.client.Clientset().CoreV1().Secrets(req.Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get admin credentials secret %s/%s: %w", req.Namespace, name, err)
+	}
+	for _, key := range []string{"username", "password"} {
+		if len(secret.Data[key]) == 0 {
+			return nil, nil, fmt.Errorf("admin credentials secret %s/%s has no %q key", req.Namespace, name, key)
+		}
+	}
+	return secret.Data["username"], secret.Data["password"], nil
+}
+
+// ensureService creates the headless service that gives the database a stable DNS name
+func (p *PostgresProvisioner) ensureService(ctx context.Context, task ProvisionTask) error {
+	req := task.Request
+	namespace := req.WorkloadNamespace()
+	services := p.client.Clientset().CoreV1().Services(namespace)
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: req.ResourceName, Namespace: namespace},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  postgresSelector(req.ResourceName),
+			Ports:     []corev1.ServicePort{{Name: "postgres", Port: postgresPort}},
+		},
+	}
+	ApplyResourceLabels(svc, task.DeploymentID, req)
+	if _, err := services.Create(ctx, svc, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create service %s/%s: %w", namespace, req.ResourceName, err)
+	}
+	return nil
+}
+
+// postgresStatefulSet builds the desired StatefulSet from the request spec
+func (p *PostgresProvisioner) postgresStatefulSet(task ProvisionTask) (*appsv1.StatefulSet, error) {
+	req := task.Request
+	name := req.ResourceName
+	size := specString(req.Spec, "size")
+	compute, ok := postgresCompute[size]
+	if !ok {
+		return nil, fmt.Errorf("unsupported size %q", size)
+	}
+	version, _ := req.Spec["version"].(string)
+	if version == "" {
+		version = defaultPostgresVersion
+	}
+	args, err := postgresArgs(req.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: postgresSecretName(name)},
+			Key:                  key,
+		}}
+	}
+	resources := corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(compute.cpu),
+		corev1.ResourceMemory: resource.MustParse(compute.memory),
+	}
+	replicas := int32(1)
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: req.WorkloadNamespace()},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    &replicas,
+			ServiceName: name,
+			Selector:    &metav1.LabelSelector{MatchLabels: postgresSelector(name)},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: postgresSelector(name)},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:  "postgres",
+						Image: "postgres:" + version,
+						Args:  args,
+						Ports: []corev1.ContainerPort{{Name: "postgres", ContainerPort: postgresPort}},
+						Env: []corev1.EnvVar{
+							{Name: "POSTGRES_USER", ValueFrom: secretKey("username")},
+							{Name: "POSTGRES_PASSWORD", ValueFrom: secretKey("password")},
+							{Name: "POSTGRES_DB", ValueFrom: secretKey("database")},
+							{Name: "PGDATA", Value: "/var/lib/postgresql/data/pgdata"},
+						},
+						Resources: corev1.ResourceRequirements{Requests: resources, Limits: resources},
+						ReadinessProbe: &corev1.Probe{
+							ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{
+								Command: []string{"pg_isready", "-U", postgresUser, "-d", postgresDatabase},
+							}},
+							PeriodSeconds: 10,
+						},
+						VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/var/lib/postgresql/data"}},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{{
+				ObjectMeta: metav1.ObjectMeta{Name: "data"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+					Resources: corev1.VolumeResourceRequirements{Requests: corev1.ResourceList{
+						corev1.ResourceStorage: resource.MustParse(postgresStorage[size]),
+					}},
+				},
+			}},
+		},
+	}
+	ApplyResourceLabels(sts, task.DeploymentID, req)
+	desired, err := json.Marshal(req.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record desired spec: %w", err)
+	}
+	sts.Annotations[AnnotationDesiredSpec] = string(desired)
+	return sts, nil
+}
+
+// postgresArgs turns the connection limit, statement timeout and read-only
+// guardrails into server settings
+func postgresArgs(spec map[string]interface{}) ([]string, error) {
+	var args []string
+	if limit, ok := spec["connectionLimit"].(float64); ok {
+		args = append(args, "-c", fmt.Sprintf("max_connections=%d", int64(limit)))
+	}
+	if timeout, ok := spec["statementTimeout"].(string); ok && timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statementTimeout %q: %w", timeout, err)
+		}
+		args = append(args, "-c", fmt.Sprintf("statement_timeout=%d", d.Milliseconds()))
+	}
+	if readOnly, _ := spec["readOnly"].(bool); readOnly {
+		args = append(args, "-c", "default_transaction_read_only=on")
+	}
+	return args, nil
+}
+
+// applyStatefulSet creates the StatefulSet, or updates the pod template and
+// replicas of an existing one; volume claim templates can't be changed
+func (p *PostgresProvisioner) applyStatefulSet(ctx context.Context, desired *appsv1.StatefulSet) error {
+	statefulSets := p.client.Clientset().AppsV1().StatefulSets(desired.Namespace)
+
+	existing, err := statefulSets.Get(ctx, desired.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := statefulSets.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create statefulset %s/%s: %w", desired.Namespace, desired.Name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get statefulset %s/%s: %w", desired.Namespace, desired.Name, err)
+	}
+
+	existing.Labels = desired.Labels
+	existing.Annotations = desired.Annotations
+	existing.Spec.Replicas = desired.Spec.Replicas
+	existing.Spec.Template = desired.Spec.Template
+	if _, err := statefulSets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update statefulset %s/%s: %w", desired.Namespace, desired.Name, err)
+	}
+	return nil
+}
+
+// waitReady polls until every replica runs the current pod template and is ready
+func (p *PostgresProvisioner) waitReady(ctx context.Context, namespace, name string) error {
+	statefulSets := p.client.Clientset().AppsV1().StatefulSets(namespace)
+	err := wait.PollUntilContextTimeout(ctx, p.PollInterval, p.ReadyTimeout, true, func(ctx context.Context) (bool, error) {
+		sts, err := statefulSets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		return sts.Status.ObservedGeneration >= sts.Generation &&
+			sts.Status.UpdatedReplicas >= replicas &&
+			sts.Status.ReadyReplicas >= replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("statefulset %s/%s not ready: %w", namespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// markReady reports the StatefulSet's replica as updated and ready, as the
+// StatefulSet controller would once the pod passes its readiness probe
+func markReady(t *testing.T, cs kubernetes.Interface, namespace, name string) {
+	t.Helper()
+	sts, err := cs.AppsV1().StatefulSets(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get statefulset: %v", err)
+	}
+	sts.Status.UpdatedReplicas = 1
+	sts.Status.ReadyReplicas = 1
+	if _, err := cs.AppsV1().StatefulSets(namespace).UpdateStatus(context.Background(), sts, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update statefulset status: %v", err)
+	}
+}
+
+func postgresTask() ProvisionTask {
+	req := validProvisionRequest()
+	req.Spec = map[string]interface{}{
+		"engine":           "postgresql",
+		"version":          "15",
+		"size":             "medium",
+		"connectionLimit":  float64(200),
+		"statementTimeout": "30s",
+	}
+	return ProvisionTask{DeploymentID: "deploy-1", Request: req}
+}
+
+func TestPostgresProvisioner_Provision(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+	p.PollInterval = time.Millisecond
+
+	var steps []string
+	progress := func(step, message string) {
+		steps = append(steps, step)
+		if step == "apply-manifests" {
+			markReady(t, cs, "team-a", "db1")
+		}
+	}
+	if err := p.Provision(context.Background(), postgresTask(), progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(steps, ","); got != "prepare-namespace,create-credentials,apply-manifests,wait-ready" {
+		t.Fatalf("unexpected steps: %s", got)
+	}
+
+	ctx := context.Background()
+	if _, err := cs.CoreV1().Namespaces().Get(ctx, "team-a", metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected namespace to be created: %v", err)
+	}
+	secret, err := cs.CoreV1().Secrets("team-a").Get(ctx, "db1-credentials", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected credentials secret: %v", err)
+	}
+	if len(secret.Data["password"]) == 0 || string(secret.Data["host"]) != "db1.team-a.svc.cluster.local" {
+		t.Fatalf("unexpected secret data: %v", secret.Data)
+	}
+	svc, err := cs.CoreV1().Services("team-a").Get(ctx, "db1", metav1.GetOptions{})
+	if err != nil || svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Fatalf("expected a headless service, got %+v (%v)", svc, err)
+	}
+	sts, err := cs.AppsV1().StatefulSets("team-a").Get(ctx, "db1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected statefulset: %v", err)
+	}
+	if sts.Labels[LabelDeploymentID] != "deploy-1" || svc.Labels[LabelDeploymentID] != "deploy-1" {
+		t.Fatalf("expected ownership labels on created resources")
+	}
+	container := sts.Spec.Template.Spec.Containers[0]
+	if container.Image != "postgres:15" {
+		t.Fatalf("expected postgres:15, got %s", container.Image)
+	}
+	if got := strings.Join(container.Args, " "); got != "-c max_connections=200 -c statement_timeout=30000" {
+		t.Fatalf("expected guardrails as server settings, got %q", got)
+	}
+	if storage := sts.Spec.VolumeClaimTemplates[0].Spec.Resources.Requests[corev1.ResourceStorage]; storage.String() != "50Gi" {
+		t.Fatalf("expected 50Gi of storage for medium, got %s", storage.String())
+	}
+
+	info := p.Connection(postgresTask())
+	if info.Endpoint != "db1.team-a.svc.cluster.local" || info.Port != 5432 || info.ConnectionSecret != "db1-credentials" {
+		t.Fatalf("unexpected connection info: %+v", info)
+	}
+}
+
+func TestPostgresProvisioner_AdminCredentialsSecret(t *testing.T) {
+	ctx := context.Background()
+	cs := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db1-admin", Namespace: "team-a"},
+		Data:       map[string][]byte{"username": []byte("owner"), "password": []byte("s3cret")},
+	})
+	p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+	p.PollInterval = time.Millisecond
+
+	task := postgresTask()
+	task.Request.Spec["adminCredentialsSecretRef"] = map[string]interface{}{"name": "db1-admin"}
+	progress := func(step, message string) {
+		if step == "apply-manifests" {
+			markReady(t, cs, "team-a", "db1")
+		}
+	}
+	if err := p.Provision(ctx, task, progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	secret, err := cs.CoreV1().Secrets("team-a").Get(ctx, "db1-credentials", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected credentials secret: %v", err)
+	}
+	if string(secret.Data["username"]) != "owner" || string(secret.Data["password"]) != "s3cret" {
+		t.Fatalf("expected the provided credentials, got %v", secret.Data)
+	}
+}
+
+func TestPostgresProvisioner_AdminCredentialsSecretMissingKey(t *testing.T) {
+	cs := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db1-admin", Namespace: "team-a"},
+		Data:       map[string][]byte{"username": []byte("owner")},
+	})
+	p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+	p.PollInterval = time.Millisecond
+
+	task := postgresTask()
+	task.Request.Spec["adminCredentialsSecretRef"] = map[string]interface{}{"name": "db1-admin"}
+	err := p.Provision(context.Background(), task, func(string, string) {})
+	if err == nil || !strings.Contains(err.Error(), `"password"`) {
+		t.Fatalf("expected a missing password error, got %v", err)
+	}
+	if _, err := cs.CoreV1().Secrets("team-a").Get(context.Background(), "db1-credentials", metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("expected no credentials secret to be created, got %v", err)
+	}
+}
+
+func TestPostgresProvisioner_Reconfigure(t *testing.T) {
+	cs := fake.NewSimpleClientset()
+	p := NewPostgresProvisioner(NewK8sClientForClientset(cs))
+	p.PollInterval = time.Millisecond
+	progress := func(step, message string) {
+		if step == "apply-manifests" {
+			markReady(t, cs, "team-a", "db1")
+		}
+	}
+
+	task := postgresTask()
+	if err := p.Provision(context.Background(), task, progress); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secret, _ := cs.CoreV1().Secrets("team-a").Get(context.Background(), "db1-credentials", metav1.GetOptions{})
+	password := string(secret.Data["password"])
+
+	task.Request.Spec["connectionLimit"] = float64(50)
+	delete(task.Request.Spec, "statementTimeout")
+	if err := p.Provision(context.Background(), task, progress); err != nil {
+		t.Fatalf("unexpected error on reprovision: %v", err)
+	}
+
+	secret, _ = cs.CoreV1().Secrets("team-a").Get(context.Background(), "db1-credentials", metav1.GetOptions{})
+	if string(secret.Data["password"]) != password {
+		t.Fatalf("expected existing credentials to be kept")
+	}
+	sts, _ := cs.AppsV1().StatefulSets("team-a").Get(context.Background(), "db1", metav1.GetOptions{})
+	if got := strings.Join(sts.Spec.Template.Spec.Containers[0].Args, " "); got != "-c max_connections=50" {
+		t.Fatalf("expected the statefulset to be updated, got args %q", got)
+	}
+}
+
+func TestPostgresProvisioner_ReadyTimeout(t *testing.T) {
+	p := NewPostgresProvisioner(NewK8sClientForClientset(fake.NewSimpleClientset()))
+	p.PollInterval = time.Millisecond
+	p.ReadyTimeout = 20 * time.Millisecond
+
+	err := p.Provision(context.Background(), postgresTask(), func(step, message string) {})
+	if err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Fatalf("expected a readiness timeout, got %v", err)
+	}
+}
+
+func TestEngineProvisioner(t *testing.T) {
+	postgres := &fakeProvisioner{steps: []string{"postgres"}}
+	p := &EngineProvisioner{
+		Engines: map[string]Provisioner{"postgresql": postgres},
+		Default: &fakeProvisioner{steps: []string{"stub"}},
+	}
+
+	for engine, want := range map[string]string{"postgresql": "postgres", "PostgreSQL": "postgres", "mysql": "stub"} {
+		task := ProvisionTask{Request: ProvisionRequest{Spec: map[string]interface{}{"engine": engine}}}
+		var got string
+		if err := p.Provision(context.Background(), task, func(step, message string) { got = step }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("engine %s: expected %s provisioner, got %s", engine, want, got)
+		}
+	}
+
+	p.Default = nil
+	task := ProvisionTask{Request: ProvisionRequest{Spec: map[string]interface{}{"engine": "redis"}}}
+	if err := p.Provision(context.Background(), task, func(string, string) {}); err == nil {
+		t.Fatalf("expected an error for an engine without a provisioner")
+	}
+	if info := p.Connection(task); info != (ConnectionInfo{}) {
+		t.Fatalf("expected no connection info, got %+v", info)
+	}
+}
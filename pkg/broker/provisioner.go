@@ -0,0 +1,211 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ProvisionTask is a unit of provisioning work handed to a Provisioner
+type ProvisionTask struct {
+	DeploymentID string
+	Request      ProvisionRequest
+
+	// EstimatedMonthlyCost is reported to the manager once the resource is ready
+	EstimatedMonthlyCost float64
+}
+
+// ProgressFunc is called by a Provisioner as it completes each step
+type ProgressFunc func(step, message string)
+
+// Provisioner performs the provisioning steps for a single resource type
+// (create namespace, apply manifests, wait for ready, run init, ...)
+type Provisioner interface {
+	Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error
+}
+
+// StepError is returned by a Provisioner to name the step that failed. The
+// worker reports the step on the failure callback.
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectionInfo tells the manager how to reach a provisioned resource
+type ConnectionInfo struct {
+	Endpoint         string
+	Port             int32
+	ConnectionSecret string
+}
+
+// ConnectionProvider is implemented by provisioners that can report how to
+// reach the resources they create. The worker includes it in the success callback.
+type ConnectionProvider interface {
+	Connection(task ProvisionTask) ConnectionInfo
+}
+
+// NormalizeResourceType returns the canonical, lower-case form of a resource
+// type. Requests may use any casing; callbacks always carry the canonical form.
+func NormalizeResourceType(resourceType string) string {
+	return strings.ToLower(strings.TrimSpace(resourceType))
+}
+
+// ProvisionerRegistry maps resource types to their provisioners
+type ProvisionerRegistry struct {
+	mu           sync.RWMutex
+	provisioners map[string]Provisioner
+}
+
+// NewProvisionerRegistry creates an empty provisioner registry
+func NewProvisionerRegistry() *ProvisionerRegistry {
+	return &ProvisionerRegistry{
+		provisioners: make(map[string]Provisioner),
+	}
+}
+
+// Register sets the provisioner used for a resource type
+func (r *ProvisionerRegistry) Register(resourceType string, p Provisioner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.provisioners[NormalizeResourceType(resourceType)] = p
+}
+
+// Get returns the provisioner registered for a resource type
+func (r *ProvisionerRegistry) Get(resourceType string) (Provisioner, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.provisioners[NormalizeResourceType(resourceType)]
+	return p, ok
+}
+
+// ResourceTypes returns the resource types that have a registered provisioner
+func (r *ProvisionerRegistry) ResourceTypes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.provisioners))
+	for t := range r.provisioners {
+		types = append(types, t)
+	}
+	return types
+}
+
+// EngineProvisioner routes database provisioning on spec.engine, using
+// Default for engines without a provisioner of their own
+type EngineProvisioner struct {
+	Engines map[string]Provisioner
+	Default Provisioner
+}
+
+// Provision runs the provisioner for the task's engine
+func (p *EngineProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	provisioner := p.provisionerFor(task)
+	if provisioner == nil {
+		return fmt.Errorf("no provisioner for engine %q", specString(task.Request.Spec, "engine"))
+	}
+	return provisioner.Provision(ctx, task, progress)
+}
+
+// Connection reports the connection details from the engine's provisioner, if it has any
+func (p *EngineProvisioner) Connection(task ProvisionTask) ConnectionInfo {
+	if cp, ok := p.provisionerFor(task).(ConnectionProvider); ok {
+		return cp.Connection(task)
+	}
+	return ConnectionInfo{}
+}
+
+func (p *EngineProvisioner) provisionerFor(task ProvisionTask) Provisioner {
+	if provisioner, ok := p.Engines[specString(task.Request.Spec, "engine")]; ok {
+		return provisioner
+	}
+	return p.Default
+}
+
+// StubDatabaseProvisioner walks through the database provisioning steps
+// without creating anything. It stands in for engines the broker has no real
+// provisioner for, so the worker and callback flow still work end to end.
+type StubDatabaseProvisioner struct{}
+
+// Provision reports each database provisioning step as complete
+func (StubDatabaseProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	steps := []struct{ name, message string }{
+		{"prepare-namespace", "Namespace " + task.Request.WorkloadNamespace() + " ready"},
+		{"apply-manifests", "Database manifests applied"},
+		{"wait-ready", "Database reported ready"},
+		{"initialize", "Database initialized"},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress(step.name, step.message)
+	}
+	return nil
+}
+
+// StubCacheProvisioner walks through the cache provisioning steps without
+// creating anything, until the broker has a real cache provisioner
+type StubCacheProvisioner struct{}
+
+// Provision reports each cache provisioning step as complete
+func (StubCacheProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	steps := []struct{ name, message string }{
+		{"prepare-namespace", "Namespace " + task.Request.WorkloadNamespace() + " ready"},
+		{"apply-manifests", "Cache manifests applied"},
+		{"wait-ready", "Cache reported ready"},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress(step.name, step.message)
+	}
+	return nil
+}
+
+// StubTopicProvisioner walks through the topic provisioning steps without
+// creating anything, until the broker has a real topic provisioner
+type StubTopicProvisioner struct{}
+
+// Provision reports each topic provisioning step as complete
+func (StubTopicProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	steps := []struct{ name, message string }{
+		{"prepare-namespace", "Namespace " + task.Request.WorkloadNamespace() + " ready"},
+		{"create-topic", "Topic created"},
+		{"wait-ready", "Topic reported ready"},
+	}
+
+	for _, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		progress(step.name, step.message)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import "context"
+
+// queuedTask is a task waiting for a free worker slot
+type queuedTask struct {
+	ctx  context.Context
+	task ProvisionTask
+	done func(error)
+	seq  uint64 // arrival order, to keep equal priorities first in, first out
+}
+
+// taskQueue orders waiting tasks by priority, highest first, then by arrival.
+// It implements heap.Interface.
+type taskQueue []*queuedTask
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].task.Request.Priority != q[j].task.Request.Priority {
+		return q[i].task.Request.Priority > q[j].task.Request.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x any) { *q = append(*q, x.(*queuedTask)) }
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return item
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrBrokerAtCapacity is returned when the broker already has its maximum
+// number of deployments in flight
+var ErrBrokerAtCapacity = errors.New("broker at capacity")
+
+// ErrTeamQuotaExceeded is returned when a team already has its maximum number
+// of deployments in flight
+var ErrTeamQuotaExceeded = errors.New("team concurrent deployment quota exceeded")
+
+// CapacityLimiter caps the total number of concurrent deployments on the
+// broker. It is the authoritative check; the manager's view of broker load
+// can be stale.
+type CapacityLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active int
+}
+
+// NewCapacityLimiter creates a limiter allowing max concurrent deployments.
+// A max of 0 means unlimited.
+func NewCapacityLimiter(max int) *CapacityLimiter {
+	return &CapacityLimiter{max: max}
+}
+
+// Acquire reserves a deployment slot. Callers must call Release once the
+// deployment finishes.
+func (l *CapacityLimiter) Acquire() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.active >= l.max {
+		return fmt.Errorf("%w: %d of %d deployments in progress", ErrBrokerAtCapacity, l.active, l.max)
+	}
+	l.active++
+	return nil
+}
+
+// Release frees a deployment slot previously reserved by Acquire
+func (l *CapacityLimiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active > 0 {
+		l.active--
+	}
+}
+
+// Active returns the number of deployments in progress
+func (l *CapacityLimiter) Active() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active
+}
+
+// Max returns the configured limit (0 = unlimited)
+func (l *CapacityLimiter) Max() int {
+	return l.max
+}
+
+// TeamLimiter caps the number of concurrent deployments each team may have
+// in flight on this broker, so one team cannot consume all of its capacity
+type TeamLimiter struct {
+	mu           sync.Mutex
+	defaultLimit int
+	limits       map[string]int
+	active       map[string]int
+}
+
+// NewTeamLimiter creates a limiter allowing defaultLimit concurrent
+// deployments per team, with per-team overrides. A limit of 0 means unlimited.
+func NewTeamLimiter(defaultLimit int, overrides map[string]int) *TeamLimiter {
+	limits := make(map[string]int, len(overrides))
+	for team, limit := range overrides {
+		limits[team] = limit
+	}
+	return &TeamLimiter{
+		defaultLimit: defaultLimit,
+		limits:       limits,
+		active:       make(map[string]int),
+	}
+}
+
+// Limit returns the concurrent deployment limit for a team
+func (l *TeamLimiter) Limit(team string) int {
+	if limit, ok := l.limits[team]; ok {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+// Acquire reserves a deployment slot for the team. Callers must call Release
+// once the deployment finishes.
+func (l *TeamLimiter) Acquire(team string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.Limit(team)
+	if limit > 0 && l.active[team] >= limit {
+		return fmt.Errorf("%w: team %q has %d of %d deployments in progress", ErrTeamQuotaExceeded, team, l.active[team], limit)
+	}
+	l.active[team]++
+	return nil
+}
+
+// Release frees a deployment slot previously reserved by Acquire
+func (l *TeamLimiter) Release(team string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[team] <= 1 {
+		delete(l.active, team)
+		return
+	}
+	l.active[team]--
+}
+
+// Active returns the number of deployments the team has in progress
+func (l *TeamLimiter) Active(team string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active[team]
+}
+
+// ParseTeamLimits parses per-team overrides in the form "team-a=10,team-b=2"
+func ParseTeamLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if strings.TrimSpace(s) == "" {
+		return limits, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		team, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || team == "" {
+			return nil, fmt.Errorf("invalid team limit %q: expected team=limit", entry)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid limit for team %q: %q", team, value)
+		}
+		limits[team] = limit
+	}
+	return limits, nil
+}
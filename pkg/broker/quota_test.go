@@ -0,0 +1,82 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTeamLimiter_ThrottlesPerTeam(t *testing.T) {
+	l := NewTeamLimiter(2, nil)
+
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire("team-a"); err != nil {
+			t.Fatalf("acquire %d for team-a: unexpected error: %v", i, err)
+		}
+	}
+	if err := l.Acquire("team-a"); !errors.Is(err, ErrTeamQuotaExceeded) {
+		t.Fatalf("expected team-a to be throttled, got %v", err)
+	}
+
+	// Another team still has its own share
+	if err := l.Acquire("team-b"); err != nil {
+		t.Fatalf("expected team-b to be admitted while team-a is throttled, got %v", err)
+	}
+
+	l.Release("team-a")
+	if err := l.Acquire("team-a"); err != nil {
+		t.Fatalf("expected team-a to be admitted after a release, got %v", err)
+	}
+	if got := l.Active("team-a"); got != 2 {
+		t.Fatalf("expected 2 active deployments for team-a, got %d", got)
+	}
+}
+
+func TestTeamLimiter_Overrides(t *testing.T) {
+	l := NewTeamLimiter(1, map[string]int{"big-team": 3, "unlimited": 0})
+
+	for i := 0; i < 3; i++ {
+		if err := l.Acquire("big-team"); err != nil {
+			t.Fatalf("acquire %d for big-team: unexpected error: %v", i, err)
+		}
+	}
+	if err := l.Acquire("big-team"); err == nil {
+		t.Fatalf("expected big-team to be throttled at its override")
+	}
+	for i := 0; i < 10; i++ {
+		if err := l.Acquire("unlimited"); err != nil {
+			t.Fatalf("expected a zero limit to be unlimited, got %v", err)
+		}
+	}
+}
+
+func TestParseTeamLimits(t *testing.T) {
+	limits, err := ParseTeamLimits("team-a=10, Team/payments=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits["team-a"] != 10 || limits["Team/payments"] != 2 {
+		t.Fatalf("unexpected limits: %v", limits)
+	}
+
+	for _, bad := range []string{"team-a", "=3", "team-a=x", "team-a=-1"} {
+		if _, err := ParseTeamLimits(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ReadinessGate is one condition the broker must meet before serving. Check
+// returns nil when the gate is open, or an error saying why it isn't.
+type ReadinessGate struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// GateResult is the outcome of one readiness gate
+type GateResult struct {
+	Name   string `json:"name"`
+	Ready  bool   `json:"ready"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// EvaluateGates runs every gate, so all failures are reported rather than
+// just the first, and returns whether they all passed
+func EvaluateGates(ctx context.Context, gates []ReadinessGate) (bool, []GateResult) {
+	ready := true
+	results := make([]GateResult, 0, len(gates))
+	for _, g := range gates {
+		result := GateResult{Name: g.Name, Ready: true}
+		if err := g.Check(ctx); err != nil {
+			ready = false
+			result.Ready = false
+			result.Reason = err.Error()
+		}
+		results = append(results, result)
+	}
+	return ready, results
+}
+
+// FailedGatesReason summarises the failed gates as "name: reason; ..."
+func FailedGatesReason(results []GateResult) string {
+	var failed []string
+	for _, r := range results {
+		if !r.Ready {
+			failed = append(failed, fmt.Sprintf("%s: %s", r.Name, r.Reason))
+		}
+	}
+	return strings.Join(failed, "; ")
+}
+
+// SigningKeyStatus tracks whether the callback signing key has been loaded
+// and its public half registered on the Broker CR, where the manager reads it
+// to verify callbacks
+type SigningKeyStatus struct {
+	mu          sync.RWMutex
+	loaded      bool
+	registered  bool
+	registerErr error
+}
+
+// SetLoaded records that the private key is loaded
+func (s *SigningKeyStatus) SetLoaded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = true
+}
+
+// SetRegistered records the outcome of registering the public key; a nil
+// error means the Broker CR holds the current key
+func (s *SigningKeyStatus) SetRegistered(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registered = err == nil
+	s.registerErr = err
+}
+
+// Check is the signing key readiness gate
+func (s *SigningKeyStatus) Check(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	switch {
+	case !s.loaded:
+		return errors.New("signing key not loaded")
+	case s.registerErr != nil:
+		return fmt.Errorf("signing key not registered: %w", s.registerErr)
+	case !s.registered:
+		return errors.New("signing key not registered")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEvaluateGates_ReportsEveryFailure(t *testing.T) {
+	gates := []ReadinessGate{
+		{Name: "a", Check: func(ctx context.Context) error { return errors.New("down") }},
+		{Name: "b", Check: func(ctx context.Context) error { return nil }},
+		{Name: "c", Check: func(ctx context.Context) error { return errors.New("missing") }},
+	}
+
+	ready, results := EvaluateGates(context.Background(), gates)
+	if ready {
+		t.Fatalf("expected not ready")
+	}
+	if len(results) != 3 || results[0].Ready || !results[1].Ready || results[2].Ready {
+		t.Fatalf("unexpected gate results: %+v", results)
+	}
+	if reason := FailedGatesReason(results); reason != "a: down; c: missing" {
+		t.Fatalf("unexpected reason %q", reason)
+	}
+}
+
+func TestSigningKeyStatus(t *testing.T) {
+	var s SigningKeyStatus
+	if err := s.Check(context.Background()); err == nil {
+		t.Fatalf("expected an unloaded key to fail")
+	}
+	s.SetLoaded()
+	if err := s.Check(context.Background()); err == nil {
+		t.Fatalf("expected an unregistered key to fail")
+	}
+	s.SetRegistered(errors.New("forbidden"))
+	if err := s.Check(context.Background()); err == nil {
+		t.Fatalf("expected a failed registration to fail")
+	}
+	s.SetRegistered(nil)
+	if err := s.Check(context.Background()); err != nil {
+		t.Fatalf("expected a loaded and registered key to pass, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Snapshot statuses reported by the broker
+const (
+	SnapshotStatusPending   = "pending"
+	SnapshotStatusCompleted = "completed"
+	SnapshotStatusFailed    = "failed"
+)
+
+// ErrSnapshotsUnsupported is returned by a Snapshotter that can't snapshot
+// the requested resource, e.g. an engine without snapshot support
+var ErrSnapshotsUnsupported = errors.New("snapshots are not supported for this resource")
+
+// SnapshotRequest asks the broker to take a named snapshot of a resource it
+// provisioned, or identifies the resource when looking a snapshot up
+type SnapshotRequest struct {
+	DeploymentID string `json:"deploymentId"`
+	ResourceType string `json:"resourceType"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+
+	// Engine routes database snapshots to the engine's provisioner
+	Engine string `json:"engine,omitempty"`
+
+	// Name is the snapshot name chosen by the requester
+	Name string `json:"name"`
+}
+
+// Validate checks if the snapshot request is valid
+func (r *SnapshotRequest) Validate() error {
+	if r.DeploymentID == "" {
+		return fmt.Errorf("deploymentId is required")
+	}
+	if r.ResourceType == "" {
+		return fmt.Errorf("resourceType is required")
+	}
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(r.Name) > 63 {
+		return fmt.Errorf("name must be at most 63 characters")
+	}
+	return nil
+}
+
+// SnapshotResponse reports a snapshot's progress
+type SnapshotResponse struct {
+	SnapshotID  string     `json:"snapshotId"`
+	Name        string     `json:"name,omitempty"`
+	Status      string     `json:"status"` // pending, completed or failed
+	Message     string     `json:"message,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Snapshotter is implemented by provisioners that can take named snapshots
+// of the resources they create. Snapshot starts one and SnapshotStatus reports
+// on it; the manager polls until it completes or fails.
+type Snapshotter interface {
+	Snapshot(ctx context.Context, req SnapshotRequest) (SnapshotResponse, error)
+	SnapshotStatus(ctx context.Context, req SnapshotRequest, snapshotID string) (SnapshotResponse, error)
+}
+
+// Snapshot takes a snapshot with the engine's provisioner, if it supports them
+func (p *EngineProvisioner) Snapshot(ctx context.Context, req SnapshotRequest) (SnapshotResponse, error) {
+	snapshotter, ok := p.snapshotterFor(req.Engine)
+	if !ok {
+		return SnapshotResponse{}, ErrSnapshotsUnsupported
+	}
+	return snapshotter.Snapshot(ctx, req)
+}
+
+// SnapshotStatus reports a snapshot from the engine's provisioner
+func (p *EngineProvisioner) SnapshotStatus(ctx context.Context, req SnapshotRequest, snapshotID string) (SnapshotResponse, error) {
+	snapshotter, ok := p.snapshotterFor(req.Engine)
+	if !ok {
+		return SnapshotResponse{}, ErrSnapshotsUnsupported
+	}
+	return snapshotter.SnapshotStatus(ctx, req, snapshotID)
+}
+
+func (p *EngineProvisioner) snapshotterFor(engine string) (Snapshotter, bool) {
+	provisioner, ok := p.Engines[engine]
+	if !ok {
+		provisioner = p.Default
+	}
+	snapshotter, ok := provisioner.(Snapshotter)
+	return snapshotter, ok
+}
+
+// Snapshot reports the snapshot as taken straight away
+func (StubDatabaseProvisioner) Snapshot(ctx context.Context, req SnapshotRequest) (SnapshotResponse, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return SnapshotResponse{}, err
+	}
+	now := time.Now().UTC()
+	return SnapshotResponse{
+		SnapshotID:  "snap-" + hex.EncodeToString(id),
+		Name:        req.Name,
+		Status:      SnapshotStatusCompleted,
+		CompletedAt: &now,
+	}, nil
+}
+
+// SnapshotStatus reports every snapshot as completed
+func (StubDatabaseProvisioner) SnapshotStatus(ctx context.Context, req SnapshotRequest, snapshotID string) (SnapshotResponse, error) {
+	return SnapshotResponse{SnapshotID: snapshotID, Status: SnapshotStatusCompleted}, nil
+}
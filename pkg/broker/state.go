@@ -0,0 +1,324 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// driftKeys are the spec fields compared between the desired spec recorded at
+// provisioning time and the spec read back from the workload
+var driftKeys = []string{"engine", "version", "size", "connectionLimit", "statementTimeout", "readOnly"}
+
+// crashReasons are container waiting reasons that mean a pod won't become
+// ready without intervention
+var crashReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+}
+
+// StateCollector reads back the actual state of the workloads the broker
+// created, for drift detection by the manager
+type StateCollector struct {
+	clientset kubernetes.Interface
+	usage     UsageCollector
+}
+
+// NewStateCollector creates a collector; a nil usage collector omits resource usage
+func NewStateCollector(clientset kubernetes.Interface, usage UsageCollector) *StateCollector {
+	return &StateCollector{clientset: clientset, usage: usage}
+}
+
+// workload is the part of a StatefulSet or Deployment the collector inspects
+type workload struct {
+	meta     metav1.ObjectMeta
+	selector *metav1.LabelSelector
+	template corev1.PodTemplateSpec
+	desired  int32
+	ready    int32
+}
+
+// Collect finds the StatefulSets and Deployments matching the request's
+// filters in its namespace and reports their health, connection endpoint and
+// drift from the spec they were provisioned with
+func (c *StateCollector) Collect(ctx context.Context, req ResourceStateRequest) ([]ResourceState, error) {
+	opts := metav1.ListOptions{LabelSelector: req.LabelSelector()}
+	now := time.Now().UTC()
+
+	workloads, err := c.listWorkloads(ctx, req.Namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := c.clientset.CoreV1().Services(req.Namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	states := make([]ResourceState, 0, len(workloads))
+	for _, w := range workloads {
+		state := ResourceState{
+			DeploymentID: w.meta.Labels[LabelDeploymentID],
+			ResourceType: w.meta.Labels[LabelResourceType],
+			ResourceName: w.meta.Labels[LabelResourceName],
+			Namespace:    w.meta.Namespace,
+			LastChecked:  now,
+			ActualSpec:   actualSpec(w),
+		}
+		if err := c.setHealth(ctx, &state, w); err != nil {
+			return nil, err
+		}
+		setEndpoint(&state, services.Items)
+		setDrift(&state, w.meta.Annotations[AnnotationDesiredSpec])
+		states = append(states, state)
+	}
+
+	attachUsage(ctx, c.usage, req.Namespace, states)
+
+	return states, nil
+}
+
+// listWorkloads lists the StatefulSets and Deployments in namespace, all
+// namespaces if empty, matching opts
+func (c *StateCollector) listWorkloads(ctx context.Context, namespace string, opts metav1.ListOptions) ([]workload, error) {
+	var workloads []workload
+	statefulSets, err := c.clientset.AppsV1().StatefulSets(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets: %w", err)
+	}
+	for _, sts := range statefulSets.Items {
+		workloads = append(workloads, workload{
+			meta: sts.ObjectMeta, selector: sts.Spec.Selector, template: sts.Spec.Template,
+			desired: replicasOrDefault(sts.Spec.Replicas), ready: sts.Status.ReadyReplicas,
+		})
+	}
+	deployments, err := c.clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	for _, deploy := range deployments.Items {
+		workloads = append(workloads, workload{
+			meta: deploy.ObjectMeta, selector: deploy.Spec.Selector, template: deploy.Spec.Template,
+			desired: replicasOrDefault(deploy.Spec.Replicas), ready: deploy.Status.ReadyReplicas,
+		})
+	}
+	return workloads, nil
+}
+
+func replicasOrDefault(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// setHealth derives phase and health from the readiness of the workload's
+// pods, or from its replica counts when it has no pod selector
+func (c *StateCollector) setHealth(ctx context.Context, state *ResourceState, w workload) error {
+	ready := w.ready
+	var crashing []string
+	if w.selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(w.selector)
+		if err != nil {
+			return fmt.Errorf("invalid selector on %s/%s: %w", w.meta.Namespace, w.meta.Name, err)
+		}
+		pods, err := c.clientset.CoreV1().Pods(w.meta.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return fmt.Errorf("failed to list pods for %s/%s: %w", w.meta.Namespace, w.meta.Name, err)
+		}
+		ready = 0
+		for _, pod := range pods.Items {
+			if podReady(pod) {
+				ready++
+			} else if reason := podCrashReason(pod); reason != "" {
+				crashing = append(crashing, fmt.Sprintf("pod %s: %s", pod.Name, reason))
+			}
+		}
+	}
+
+	state.Message = fmt.Sprintf("%d/%d pods ready", ready, w.desired)
+	switch {
+	case ready >= w.desired:
+		state.Phase = "Ready"
+		state.HealthStatus = "Healthy"
+	case len(crashing) > 0:
+		state.Phase = "Failed"
+		state.HealthStatus = "Unhealthy"
+		state.Message += "; " + strings.Join(crashing, "; ")
+	default:
+		state.Phase = "Provisioning"
+		state.HealthStatus = "Degraded"
+	}
+	return nil
+}
+
+func podReady(pod corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podCrashReason returns why a pod is failing, or "" if it may still start
+func podCrashReason(pod corev1.Pod) string {
+	if pod.Status.Phase == corev1.PodFailed {
+		return "pod failed"
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && crashReasons[cs.State.Waiting.Reason] {
+			return cs.State.Waiting.Reason
+		}
+	}
+	return ""
+}
+
+// setEndpoint reports the in-cluster address of the service created for the
+// same deployment and resource
+func setEndpoint(state *ResourceState, services []corev1.Service) {
+	for _, svc := range services {
+		if svc.Labels[LabelDeploymentID] != state.DeploymentID || svc.Labels[LabelResourceName] != state.ResourceName {
+			continue
+		}
+		state.Endpoint = fmt.Sprintf("%s.%s.svc.cluster.local", svc.Name, svc.Namespace)
+		if len(svc.Spec.Ports) > 0 {
+			state.Port = svc.Spec.Ports[0].Port
+		}
+		return
+	}
+}
+
+// actualSpec reads the provisioned spec back from the workload's pod template,
+// using the same keys as the provision request
+func actualSpec(w workload) map[string]interface{} {
+	spec := map[string]interface{}{"replicas": w.desired}
+	if engine := w.template.Labels["app.kubernetes.io/name"]; engine != "" {
+		spec["engine"] = engine
+	}
+	if len(w.template.Spec.Containers) == 0 {
+		return spec
+	}
+
+	container := w.template.Spec.Containers[0]
+	if tag := imageTag(container.Image); tag != "" {
+		spec["version"] = tag
+	}
+	cpu, memory := container.Resources.Requests.Cpu(), container.Resources.Requests.Memory()
+	for size, compute := range postgresCompute {
+		if cpu.String() == compute.cpu && memory.String() == compute.memory {
+			spec["size"] = size
+		}
+	}
+
+	// Server settings are passed as "-c name=value" pairs
+	for i := 0; i+1 < len(container.Args); i++ {
+		if container.Args[i] != "-c" {
+			continue
+		}
+		name, value, _ := strings.Cut(container.Args[i+1], "=")
+		switch name {
+		case "max_connections":
+			if n, err := strconv.Atoi(value); err == nil {
+				spec["connectionLimit"] = n
+			}
+		case "statement_timeout":
+			if ms, err := strconv.Atoi(value); err == nil {
+				spec["statementTimeout"] = (time.Duration(ms) * time.Millisecond).String()
+			}
+		case "default_transaction_read_only":
+			if value == "on" {
+				spec["readOnly"] = true
+			}
+		}
+	}
+	return spec
+}
+
+// imageTag returns the tag of an image reference, ignoring any registry port
+// and digest, or "" if it has none
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, _ := strings.Cut(name, ":")
+	return tag
+}
+
+// setDrift compares the actual spec with the desired spec recorded on the
+// workload when it was provisioned. Workloads without one aren't checked.
+func setDrift(state *ResourceState, recorded string) {
+	if recorded == "" {
+		return
+	}
+	var desired map[string]interface{}
+	if err := json.Unmarshal([]byte(recorded), &desired); err != nil {
+		log.Printf("Ignoring unreadable desired spec on %s/%s: %v", state.Namespace, state.ResourceName, err)
+		return
+	}
+	state.DesiredSpec = desired
+
+	for _, key := range driftKeys {
+		want, wantOK := desired[key]
+		got, gotOK := state.ActualSpec[key]
+		if !wantOK && !gotOK {
+			continue
+		}
+		if wantOK && gotOK && specValue(want) == specValue(got) {
+			continue
+		}
+		state.DriftDetails = append(state.DriftDetails, fmt.Sprintf("%s mismatch: desired=%s, actual=%s",
+			key, describeSpecValue(want, wantOK), describeSpecValue(got, gotOK)))
+	}
+	sort.Strings(state.DriftDetails)
+	state.DriftDetected = len(state.DriftDetails) > 0
+}
+
+// specValue normalises a spec value for comparison: numbers decoded from
+// JSON and durations in any unit compare equal to their canonical form
+func specValue(v interface{}) string {
+	switch val := v.(type) {
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case string:
+		if d, err := time.ParseDuration(val); err == nil {
+			return d.String()
+		}
+		return strings.ToLower(val)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+func describeSpecValue(v interface{}, ok bool) string {
+	if !ok {
+		return "unset"
+	}
+	return fmt.Sprint(v)
+}
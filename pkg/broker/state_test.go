@@ -0,0 +1,171 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// provisionedObjects returns the StatefulSet and Service the PostgreSQL
+// provisioner creates for postgresTask
+func provisionedObjects(t *testing.T) (*appsv1.StatefulSet, *corev1.Service) {
+	t.Helper()
+	task := postgresTask()
+	sts, err := (&PostgresProvisioner{}).postgresStatefulSet(task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "db1"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: postgresPort}}},
+	}
+	ApplyResourceLabels(svc, task.DeploymentID, task.Request)
+	return sts, svc
+}
+
+func postgresPod(name string, ready bool, waitingReason string) *corev1.Pod {
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: name, Labels: postgresSelector("db1")}}
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: status}}
+	if waitingReason != "" {
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{
+			Name:  "postgres",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: waitingReason}},
+		}}
+	}
+	return pod
+}
+
+func collect(t *testing.T, req ResourceStateRequest, objs ...runtime.Object) []ResourceState {
+	t.Helper()
+	states, err := NewStateCollector(fake.NewSimpleClientset(objs...), nil).Collect(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return states
+}
+
+func TestStateCollector_InSync(t *testing.T) {
+	sts, svc := provisionedObjects(t)
+	states := collect(t, ResourceStateRequest{Namespace: "team-a"}, sts, svc, postgresPod("db1-0", true, ""))
+
+	if len(states) != 1 {
+		t.Fatalf("expected 1 resource, got %+v", states)
+	}
+	st := states[0]
+	if st.Phase != "Ready" || st.HealthStatus != "Healthy" || st.Message != "1/1 pods ready" {
+		t.Fatalf("expected a healthy resource, got %+v", st)
+	}
+	if st.Endpoint != "db1.team-a.svc.cluster.local" || st.Port != 5432 {
+		t.Fatalf("expected the service endpoint, got %s:%d", st.Endpoint, st.Port)
+	}
+	want := map[string]interface{}{
+		"engine": "postgresql", "version": "15", "size": "medium",
+		"connectionLimit": 200, "statementTimeout": "30s", "replicas": int32(1),
+	}
+	for k, v := range want {
+		if st.ActualSpec[k] != v {
+			t.Fatalf("expected actual %s=%v, got %v", k, v, st.ActualSpec[k])
+		}
+	}
+	if st.DesiredSpec["engine"] != "postgresql" {
+		t.Fatalf("expected the recorded desired spec, got %v", st.DesiredSpec)
+	}
+	if st.DriftDetected || len(st.DriftDetails) != 0 {
+		t.Fatalf("expected no drift, got %v", st.DriftDetails)
+	}
+}
+
+func TestStateCollector_DetectsDrift(t *testing.T) {
+	sts, svc := provisionedObjects(t)
+	// Changed out of band: a new image and the statement timeout removed
+	sts.Spec.Template.Spec.Containers[0].Image = "registry.local:5000/postgres:16"
+	sts.Spec.Template.Spec.Containers[0].Args = []string{"-c", "max_connections=200"}
+
+	states := collect(t, ResourceStateRequest{Namespace: "team-a"}, sts, svc, postgresPod("db1-0", true, ""))
+	st := states[0]
+	if !st.DriftDetected {
+		t.Fatalf("expected drift to be detected")
+	}
+	want := []string{
+		"statementTimeout mismatch: desired=30s, actual=unset",
+		"version mismatch: desired=15, actual=16",
+	}
+	if strings.Join(st.DriftDetails, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected drift details %v, got %v", want, st.DriftDetails)
+	}
+}
+
+func TestStateCollector_Health(t *testing.T) {
+	tests := []struct {
+		name       string
+		pod        *corev1.Pod
+		wantPhase  string
+		wantHealth string
+	}{
+		{name: "starting", pod: postgresPod("db1-0", false, "ContainerCreating"), wantPhase: "Provisioning", wantHealth: "Degraded"},
+		{name: "crash looping", pod: postgresPod("db1-0", false, "CrashLoopBackOff"), wantPhase: "Failed", wantHealth: "Unhealthy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sts, svc := provisionedObjects(t)
+			// The StatefulSet status still claims the replica is ready; pods win
+			sts.Status.ReadyReplicas = 1
+			st := collect(t, ResourceStateRequest{Namespace: "team-a"}, sts, svc, tt.pod)[0]
+			if st.Phase != tt.wantPhase || st.HealthStatus != tt.wantHealth {
+				t.Fatalf("expected %s/%s, got %s/%s (%s)", tt.wantPhase, tt.wantHealth, st.Phase, st.HealthStatus, st.Message)
+			}
+		})
+	}
+}
+
+func TestStateCollector_Filters(t *testing.T) {
+	sts, svc := provisionedObjects(t)
+	cache := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "cache1"}}
+	ApplyResourceLabels(cache, "deploy-2", ProvisionRequest{ResourceType: "cache", ResourceName: "cache1"})
+	objs := []runtime.Object{sts, svc, cache, postgresPod("db1-0", true, "")}
+
+	tests := []struct {
+		req  ResourceStateRequest
+		want string
+	}{
+		{req: ResourceStateRequest{Namespace: "team-a", ResourceType: "cache"}, want: "cache1"},
+		{req: ResourceStateRequest{Namespace: "team-a", ResourceName: "db1"}, want: "db1"},
+		{req: ResourceStateRequest{Namespace: "team-a", DeploymentID: "deploy-2"}, want: "cache1"},
+		{req: ResourceStateRequest{Namespace: "other"}, want: ""},
+	}
+	for _, tt := range tests {
+		var names []string
+		for _, st := range collect(t, tt.req, objs...) {
+			names = append(names, st.ResourceName)
+		}
+		if strings.Join(names, ",") != tt.want {
+			t.Fatalf("%+v: expected %q, got %v", tt.req, tt.want, names)
+		}
+	}
+}
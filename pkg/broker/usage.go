@@ -0,0 +1,119 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/rest"
+)
+
+// ErrMetricsUnavailable is returned by a UsageCollector when the metrics API
+// (usually metrics-server) is not installed or not responding
+var ErrMetricsUnavailable = errors.New("metrics API unavailable")
+
+// UsageCollector reports live resource usage for the pods matching a label selector
+type UsageCollector interface {
+	CollectUsage(ctx context.Context, namespace, labelSelector string) (*ResourceUsage, error)
+}
+
+// metricsServerCollector reads pod usage from the metrics.k8s.io API
+type metricsServerCollector struct {
+	restClient rest.Interface
+}
+
+// NewMetricsServerCollector creates a UsageCollector backed by metrics-server
+func NewMetricsServerCollector(restClient rest.Interface) UsageCollector {
+	return &metricsServerCollector{restClient: restClient}
+}
+
+// podMetricsList is the subset of metrics.k8s.io/v1beta1 PodMetricsList we need
+type podMetricsList struct {
+	Items []struct {
+		Containers []struct {
+			Usage map[string]resource.Quantity `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// CollectUsage sums CPU and memory across the matching pods
+func (m *metricsServerCollector) CollectUsage(ctx context.Context, namespace, labelSelector string) (*ResourceUsage, error) {
+	if m.restClient == nil {
+		return nil, fmt.Errorf("%w: no REST client configured", ErrMetricsUnavailable)
+	}
+
+	raw, err := m.restClient.Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").
+		Param("labelSelector", labelSelector).
+		DoRaw(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMetricsUnavailable, err)
+	}
+
+	var list podMetricsList
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("failed to decode pod metrics: %w", err)
+	}
+
+	cpu := resource.Quantity{}
+	memory := resource.Quantity{}
+	for _, pod := range list.Items {
+		for _, container := range pod.Containers {
+			if q, ok := container.Usage["cpu"]; ok {
+				cpu.Add(q)
+			}
+			if q, ok := container.Usage["memory"]; ok {
+				memory.Add(q)
+			}
+		}
+	}
+
+	return &ResourceUsage{
+		CPUUsage:    cpu.String(),
+		MemoryUsage: memory.String(),
+		Replicas:    int32(len(list.Items)),
+	}, nil
+}
+
+// attachUsage fills in ResourceUsage for each state. When the metrics API is
+// unavailable usage is omitted for the whole lookup and the degradation is
+// logged once, leaving the rest of the state intact.
+func attachUsage(ctx context.Context, collector UsageCollector, namespace string, states []ResourceState) {
+	if collector == nil {
+		return
+	}
+
+	for i := range states {
+		selector := labels.SelectorFromSet(labels.Set{LabelDeploymentID: states[i].DeploymentID}).String()
+		usage, err := collector.CollectUsage(ctx, namespace, selector)
+		if err != nil {
+			if errors.Is(err, ErrMetricsUnavailable) {
+				log.Printf("Resource usage omitted for namespace %s: %v", namespace, err)
+				return
+			}
+			log.Printf("Failed to collect resource usage for deployment %s: %v", states[i].DeploymentID, err)
+			continue
+		}
+		states[i].ResourceUsage = usage
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeUsageCollector struct {
+	calls int
+	err   error
+}
+
+func (f *fakeUsageCollector) CollectUsage(ctx context.Context, namespace, labelSelector string) (*ResourceUsage, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ResourceUsage{CPUUsage: "250m", MemoryUsage: "512Mi", Replicas: 1}, nil
+}
+
+func TestListManagedResources_MetricsUnavailable(t *testing.T) {
+	cs := fake.NewSimpleClientset(
+		labeledStatefulSet("db1", "deploy-1"),
+		labeledStatefulSet("db2", "deploy-2"),
+	)
+	c := NewK8sClientForClientset(cs)
+	collector := &fakeUsageCollector{err: fmt.Errorf("%w: the server could not find the requested resource", ErrMetricsUnavailable)}
+	c.SetUsageCollector(collector)
+
+	states, err := c.ListManagedResources(context.Background(), ResourceStateRequest{Namespace: "team-a"})
+	if err != nil {
+		t.Fatalf("expected lookup to succeed without metrics, got: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(states))
+	}
+	for _, st := range states {
+		if st.ResourceUsage != nil {
+			t.Fatalf("expected ResourceUsage to be omitted, got %+v", st.ResourceUsage)
+		}
+		if st.Phase == "" || st.HealthStatus == "" || st.DeploymentID == "" {
+			t.Fatalf("expected phase, health and identity to be populated, got %+v", st)
+		}
+	}
+	if collector.calls != 1 {
+		t.Fatalf("expected metrics to be queried once per lookup after it is found unavailable, got %d calls", collector.calls)
+	}
+}
+
+func TestListManagedResources_AttachesUsage(t *testing.T) {
+	cs := fake.NewSimpleClientset(labeledStatefulSet("db1", "deploy-1"))
+	c := NewK8sClientForClientset(cs)
+	c.SetUsageCollector(&fakeUsageCollector{})
+
+	states, err := c.ListManagedResources(context.Background(), ResourceStateRequest{Namespace: "team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) != 1 || states[0].ResourceUsage == nil || states[0].ResourceUsage.CPUUsage != "250m" {
+		t.Fatalf("expected usage to be attached, got %+v", states)
+	}
+}
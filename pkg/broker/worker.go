@@ -0,0 +1,424 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aykay76/kidp/pkg/tracing"
+)
+
+// ErrDeploymentNotFound is returned when a deployment is not in flight on this broker
+var ErrDeploymentNotFound = errors.New("deployment not found")
+
+// Notifier delivers status callbacks to the manager
+type Notifier interface {
+	// NotifyStatus delivers payload to callbackURL, or failing that to the
+	// first of fallbackURLs that takes it
+	NotifyStatus(ctx context.Context, callbackURL string, payload CallbackRequest, fallbackURLs ...string) error
+}
+
+// Worker runs provisioning tasks through the registered provisioners and
+// reports progress back to the manager
+type Worker struct {
+	provisioners *ProvisionerRegistry
+	notifier     Notifier
+	hooks        *Hooks
+	deployments  *DeploymentStore
+	tasks        TaskStore
+
+	// callbackURLs holds the current callback URL of each in-flight
+	// deployment so the manager can move it mid-deployment
+	mu           sync.RWMutex
+	callbackURLs map[string]string
+	stopped      bool
+
+	// concurrency caps the tasks Enqueue runs at once; the rest wait in
+	// queue, highest priority first
+	concurrency int
+	running     int
+	queue       taskQueue
+	queued      uint64
+}
+
+// NewWorker creates a worker that dispatches tasks to the given provisioners
+func NewWorker(provisioners *ProvisionerRegistry, notifier Notifier) *Worker {
+	return &Worker{
+		provisioners: provisioners,
+		notifier:     notifier,
+		deployments:  NewDeploymentStore(),
+		callbackURLs: make(map[string]string),
+	}
+}
+
+// SetHooks sets the pre- and post-provision hooks run around each task.
+// A nil hooks disables them.
+func (w *Worker) SetHooks(hooks *Hooks) {
+	w.hooks = hooks
+}
+
+// SetTaskStore persists the tasks passed to Enqueue until they finish, so
+// they can be resumed after a restart. A nil store keeps them in memory only.
+func (w *Worker) SetTaskStore(store TaskStore) {
+	w.tasks = store
+}
+
+// PendingTasks returns the tasks left unfinished in the task store, oldest
+// first, such as those queued or running when the broker last stopped
+func (w *Worker) PendingTasks() ([]PendingTask, error) {
+	if w.tasks == nil {
+		return nil, nil
+	}
+	return w.tasks.List()
+}
+
+// SetConcurrency caps how many tasks Enqueue runs at once. Further tasks
+// wait in the queue. Zero or less, the default, runs every task immediately.
+func (w *Worker) SetConcurrency(n int) {
+	w.mu.Lock()
+	w.concurrency = n
+	w.mu.Unlock()
+	w.dispatch()
+}
+
+// Stop marks the worker as no longer accepting tasks, e.g. while the broker
+// drains on shutdown. Tasks already running are unaffected.
+func (w *Worker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+}
+
+// Ready is the worker readiness gate: the worker must be running and have at
+// least one provisioner to dispatch to
+func (w *Worker) Ready(ctx context.Context) error {
+	w.mu.RLock()
+	stopped := w.stopped
+	w.mu.RUnlock()
+	if stopped {
+		return errors.New("worker stopped")
+	}
+	if len(w.provisioners.ResourceTypes()) == 0 {
+		return errors.New("no provisioners registered")
+	}
+	return nil
+}
+
+// Track registers the task as in flight so its callback URL can be updated
+// and its status queried before Run starts. Run tracks the task itself if
+// this isn't called.
+func (w *Worker) Track(task ProvisionTask) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.callbackURLs[task.DeploymentID]; !ok {
+		w.callbackURLs[task.DeploymentID] = task.Request.CallbackURL
+		w.deployments.Record(task.DeploymentID, "Pending", "Deployment accepted")
+	}
+}
+
+// Status returns the latest phase reported for a deployment
+func (w *Worker) Status(deploymentID string) (StatusResponse, bool) {
+	return w.deployments.Get(deploymentID)
+}
+
+// Logs returns up to limit of a deployment's most recent provisioning log
+// entries and whether older ones were left out
+func (w *Worker) Logs(deploymentID string, limit int) ([]LogEntry, bool) {
+	return w.deployments.Logs(deploymentID, limit)
+}
+
+// LastCallback returns the last callback sent for a deployment, addressed to
+// its current callback URL, so it can be sent again
+func (w *Worker) LastCallback(deploymentID string) (string, CallbackRequest, bool) {
+	callbackURL, payload, ok := w.deployments.LastCallback(deploymentID)
+	if !ok {
+		return "", CallbackRequest{}, false
+	}
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if u, inFlight := w.callbackURLs[deploymentID]; inFlight {
+		callbackURL = u
+	}
+	return callbackURL, payload, true
+}
+
+// InFlight reports whether a deployment is running on this worker
+func (w *Worker) InFlight(deploymentID string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.callbackURLs[deploymentID]
+	return ok
+}
+
+// UpdateCallbackURL redirects the remaining callbacks of an in-flight deployment
+func (w *Worker) UpdateCallbackURL(deploymentID, callbackURL string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.callbackURLs[deploymentID]; !ok {
+		return fmt.Errorf("%w: %s", ErrDeploymentNotFound, deploymentID)
+	}
+	w.callbackURLs[deploymentID] = callbackURL
+	return nil
+}
+
+// CallbackURLs returns up to limit distinct callback URLs of in-flight
+// deployments, sorted so the same sample is taken each time
+func (w *Worker) CallbackURLs(limit int) []string {
+	w.mu.RLock()
+	seen := make(map[string]bool)
+	for _, u := range w.callbackURLs {
+		if u != "" {
+			seen[u] = true
+		}
+	}
+	w.mu.RUnlock()
+
+	urls := make([]string, 0, len(seen))
+	for u := range seen {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls
+}
+
+// InFlightCount returns the number of deployments running on this worker
+func (w *Worker) InFlightCount() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.callbackURLs)
+}
+
+// QueueLength returns the number of tasks waiting for a free slot
+func (w *Worker) QueueLength() int {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.queue.Len()
+}
+
+// Enqueue tracks the task and runs it asynchronously once a slot is free.
+// While the worker is saturated, higher priority tasks run first and tasks
+// of equal priority run in the order they were queued. done, if not nil, is
+// called with the result of Run. The task stays in the task store, if set,
+// until Run returns.
+func (w *Worker) Enqueue(ctx context.Context, task ProvisionTask, done func(error)) {
+	w.Track(task)
+	w.persist(task)
+	w.mu.Lock()
+	w.queued++
+	heap.Push(&w.queue, &queuedTask{ctx: ctx, task: task, done: done, seq: w.queued})
+	w.mu.Unlock()
+	w.dispatch()
+}
+
+// dispatch starts queued tasks while there are free slots
+func (w *Worker) dispatch() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.queue.Len() > 0 && (w.concurrency <= 0 || w.running < w.concurrency) {
+		next := heap.Pop(&w.queue).(*queuedTask)
+		w.running++
+		go func() {
+			err := w.Run(next.ctx, next.task)
+			w.forget(next.task.DeploymentID)
+			w.mu.Lock()
+			w.running--
+			w.mu.Unlock()
+			if next.done != nil {
+				next.done(err)
+			}
+			w.dispatch()
+		}()
+	}
+}
+
+// persist writes the task to the task store. A task that can't be stored
+// still runs; it is only lost if the broker restarts first.
+func (w *Worker) persist(task ProvisionTask) {
+	if w.tasks == nil {
+		return
+	}
+	pending := PendingTask{
+		DeploymentID:         task.DeploymentID,
+		Request:              task.Request,
+		EstimatedMonthlyCost: task.EstimatedMonthlyCost,
+		QueuedAt:             time.Now().UTC(),
+	}
+	if err := w.tasks.Write(pending); err != nil {
+		log.Printf("Deployment %s won't be resumed after a restart: %v", task.DeploymentID, err)
+	}
+}
+
+// forget removes a finished task from the task store
+func (w *Worker) forget(deploymentID string) {
+	if w.tasks == nil {
+		return
+	}
+	if err := w.tasks.Delete(deploymentID); err != nil {
+		log.Printf("Failed to remove finished deployment %s from the task store: %v", deploymentID, err)
+	}
+}
+
+// callbackURL returns the task's current callback URL
+func (w *Worker) callbackURL(task ProvisionTask) string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if u, ok := w.callbackURLs[task.DeploymentID]; ok {
+		return u
+	}
+	return task.Request.CallbackURL
+}
+
+func (w *Worker) untrack(deploymentID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.callbackURLs, deploymentID)
+}
+
+// Run provisions the task synchronously. A progress callback is sent for each
+// step the provisioner completes, followed by a final success or failure callback.
+func (w *Worker) Run(ctx context.Context, task ProvisionTask) error {
+	req := task.Request
+
+	ctx, span := tracing.Tracer().Start(ctx, "broker.worker.provision", trace.WithAttributes(
+		attribute.String("kidp.deployment_id", task.DeploymentID),
+		attribute.String("kidp.resource_type", req.ResourceType),
+		attribute.String("kidp.resource_name", req.ResourceName),
+		attribute.Int("kidp.priority", req.Priority),
+	))
+	defer span.End()
+
+	w.Track(task)
+	defer w.untrack(task.DeploymentID)
+
+	provisioner, ok := w.provisioners.Get(req.ResourceType)
+	if !ok {
+		err := fmt.Errorf("no provisioner registered for resource type %q", req.ResourceType)
+		w.logf(task.DeploymentID, "", "Provisioning failed: %v", err)
+		span.SetStatus(codes.Error, err.Error())
+		w.notify(ctx, task, "failed", "Failed", err.Error(), err.Error(), nil)
+		return err
+	}
+
+	if err := w.hooks.PreProvision(ctx, task); err != nil {
+		w.logf(task.DeploymentID, "", "Pre-provision hook stopped deployment: %v", err)
+		span.SetStatus(codes.Error, err.Error())
+		w.notify(ctx, task, "failed", "Failed", fmt.Sprintf("Provisioning aborted: %v", err), err.Error(), nil)
+		return err
+	}
+
+	w.logf(task.DeploymentID, "", "Starting provisioning (%s/%s)", req.ResourceType, req.ResourceName)
+
+	progress := func(step, message string) {
+		w.logf(task.DeploymentID, step, "Completed step %s: %s", step, message)
+		span.AddEvent(step, trace.WithAttributes(attribute.String("message", message)))
+		w.notify(ctx, task, "in-progress", "Provisioning", message, "", map[string]interface{}{"step": step})
+	}
+
+	if err := provisioner.Provision(ctx, task, progress); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		var details map[string]interface{}
+		var step string
+		var stepErr *StepError
+		if errors.As(err, &stepErr) {
+			step = stepErr.Step
+			details = map[string]interface{}{"step": step}
+		}
+		w.logf(task.DeploymentID, step, "Provisioning failed: %v", err)
+		w.notify(ctx, task, "failed", "Failed", fmt.Sprintf("Provisioning failed: %v", err), err.Error(), details)
+		w.postProvision(ctx, task, err)
+		return err
+	}
+
+	w.logf(task.DeploymentID, "", "Provisioning completed")
+	w.notify(ctx, task, "success", "Ready", fmt.Sprintf("Successfully provisioned %s/%s", req.ResourceType, req.ResourceName), "", nil)
+	w.postProvision(ctx, task, nil)
+	return nil
+}
+
+// postProvision runs the post-provision hook, logging rather than failing on errors
+func (w *Worker) postProvision(ctx context.Context, task ProvisionTask, provisionErr error) {
+	if err := w.hooks.PostProvision(ctx, task, provisionErr); err != nil {
+		w.logf(task.DeploymentID, "", "Post-provision hook: %v", err)
+	}
+}
+
+// notify sends a callback for the task, logging rather than failing on delivery errors
+func (w *Worker) notify(ctx context.Context, task ProvisionTask, status, phase, message, errMsg string, details map[string]interface{}) {
+	w.deployments.Record(task.DeploymentID, phase, message)
+	if w.notifier == nil {
+		return
+	}
+
+	payload := CallbackRequest{
+		DeploymentID: task.DeploymentID,
+		ResourceType: NormalizeResourceType(task.Request.ResourceType),
+		ResourceName: task.Request.ResourceName,
+		Namespace:    task.Request.Namespace,
+		Status:       status,
+		Phase:        phase,
+		Message:      message,
+		Error:        errMsg,
+		Time:         time.Now().UTC(),
+		Details:      details,
+
+		CallbackToken: task.Request.CallbackToken,
+	}
+	if status == "failed" {
+		payload.Logs = DeploymentLogsPath(task.DeploymentID)
+	}
+	if status == "success" {
+		payload.EstimatedMonthlyCost = task.EstimatedMonthlyCost
+		payload.AppliedSpec = task.Request.Spec
+		if provisioner, ok := w.provisioners.Get(task.Request.ResourceType); ok {
+			if cp, ok := provisioner.(ConnectionProvider); ok {
+				info := cp.Connection(task)
+				payload.Endpoint = info.Endpoint
+				payload.Port = info.Port
+				payload.ConnectionSecret = info.ConnectionSecret
+			}
+		}
+	}
+
+	callbackURL := w.callbackURL(task)
+	w.deployments.RecordCallback(callbackURL, payload)
+	if err := w.notifier.NotifyStatus(ctx, callbackURL, payload, task.Request.CallbackURLs...); err != nil {
+		w.logf(task.DeploymentID, "", "Failed to deliver %s callback: %v", status, err)
+	}
+}
+
+// logf logs a line about a deployment and keeps it in the deployment's
+// provisioning log, served on /v1/deployments/{id}/logs
+func (w *Worker) logf(deploymentID, step, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Printf("Deployment %s: %s", deploymentID, message)
+	w.deployments.AppendLog(deploymentID, step, message)
+}
@@ -0,0 +1,475 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingNotifier struct {
+	mu       sync.Mutex
+	payloads []CallbackRequest
+	urls     []string
+	fallback [][]string
+}
+
+func (n *recordingNotifier) NotifyStatus(ctx context.Context, callbackURL string, payload CallbackRequest, fallbackURLs ...string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.payloads = append(n.payloads, payload)
+	n.urls = append(n.urls, callbackURL)
+	n.fallback = append(n.fallback, fallbackURLs)
+	return nil
+}
+
+type fakeProvisioner struct {
+	steps []string
+	err   error
+}
+
+func (f *fakeProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	for _, step := range f.steps {
+		progress(step, "done "+step)
+	}
+	return f.err
+}
+
+func TestWorker_ReportsEachStep(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", &fakeProvisioner{steps: []string{"create-namespace", "apply-manifests", "wait-ready"}})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	task := ProvisionTask{DeploymentID: "deploy-1", Request: validProvisionRequest(), EstimatedMonthlyCost: 105}
+	if err := w.Run(context.Background(), task); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(notifier.payloads) != 4 {
+		t.Fatalf("expected 3 progress callbacks and 1 final callback, got %d", len(notifier.payloads))
+	}
+	for i, step := range []string{"create-namespace", "apply-manifests", "wait-ready"} {
+		p := notifier.payloads[i]
+		if p.Status != "in-progress" || p.Details["step"] != step {
+			t.Fatalf("callback %d: expected in-progress for step %s, got %+v", i, step, p)
+		}
+		if p.ResourceType != "database" || p.ResourceName != "db1" || p.DeploymentID != "deploy-1" {
+			t.Fatalf("callback %d missing resource identity: %+v", i, p)
+		}
+	}
+	final := notifier.payloads[3]
+	if final.Status != "success" || final.Phase != "Ready" || final.EstimatedMonthlyCost != 105 {
+		t.Fatalf("expected final success callback, got %+v", final)
+	}
+	if final.AppliedSpec["engine"] != "postgresql" {
+		t.Fatalf("expected final callback to report the applied spec, got %+v", final.AppliedSpec)
+	}
+	for _, p := range notifier.payloads[:3] {
+		if p.AppliedSpec != nil {
+			t.Fatalf("expected applied spec only on the final callback, got %+v", p)
+		}
+	}
+}
+
+func TestWorker_CanonicalResourceType(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("Database", &fakeProvisioner{steps: []string{"apply-manifests"}})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	req := validProvisionRequest()
+	req.ResourceType = "DATABASE"
+	if err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-1", Request: req}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, p := range notifier.payloads {
+		if p.ResourceType != "database" {
+			t.Fatalf("callback %d: expected the canonical resource type, got %q", i, p.ResourceType)
+		}
+	}
+}
+
+func TestWorker_ProvisionerFailure(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("Database", &fakeProvisioner{steps: []string{"create-namespace"}, err: errors.New("quota exceeded")})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-2", Request: validProvisionRequest()})
+	if err == nil {
+		t.Fatalf("expected provisioning error")
+	}
+
+	final := notifier.payloads[len(notifier.payloads)-1]
+	if final.Status != "failed" || final.Phase != "Failed" || final.Error != "quota exceeded" {
+		t.Fatalf("expected failed callback carrying the error, got %+v", final)
+	}
+	if final.Logs != "/v1/deployments/deploy-2/logs" {
+		t.Fatalf("expected the failed callback to point at the deployment's logs, got %q", final.Logs)
+	}
+	for _, payload := range notifier.payloads[:len(notifier.payloads)-1] {
+		if payload.Logs != "" {
+			t.Fatalf("expected only the failed callback to reference the logs, got %+v", payload)
+		}
+	}
+
+	entries, _ := w.Logs("deploy-2", 0)
+	if len(entries) == 0 {
+		t.Fatal("expected the provisioning to be logged")
+	}
+	if last := entries[len(entries)-1]; last.Message != "Provisioning failed: quota exceeded" {
+		t.Fatalf("expected the failure to be logged before the callback, got %+v", entries)
+	}
+	if entries[1].Step != "create-namespace" {
+		t.Fatalf("expected the completed step to be logged, got %+v", entries)
+	}
+}
+
+func TestWorker_ReportsFailedStep(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("Database", &fakeProvisioner{err: &StepError{Step: StepInitScripts, Err: errors.New("syntax error")}})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	if err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-2", Request: validProvisionRequest()}); err == nil {
+		t.Fatalf("expected provisioning error")
+	}
+
+	final := notifier.payloads[len(notifier.payloads)-1]
+	if final.Status != "failed" || final.Error != "syntax error" || final.Details["step"] != StepInitScripts {
+		t.Fatalf("expected failed callback naming the init-scripts step, got %+v", final)
+	}
+}
+
+func TestWorker_UnknownResourceType(t *testing.T) {
+	notifier := &recordingNotifier{}
+	w := NewWorker(NewProvisionerRegistry(), notifier)
+
+	req := validProvisionRequest()
+	req.ResourceType = "cache"
+	if err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-3", Request: req}); err == nil {
+		t.Fatalf("expected error for unregistered resource type")
+	}
+	if len(notifier.payloads) != 1 || notifier.payloads[0].Status != "failed" {
+		t.Fatalf("expected a single failed callback, got %+v", notifier.payloads)
+	}
+}
+
+// pausingProvisioner reports a step, then waits for resume before finishing
+type pausingProvisioner struct {
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (p *pausingProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	progress("apply-manifests", "applied")
+	close(p.paused)
+	<-p.resume
+	return nil
+}
+
+// orderingProvisioner records the order deployments start in. The deployment
+// named blocker holds its slot until release is closed.
+type orderingProvisioner struct {
+	mu      sync.Mutex
+	order   []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *orderingProvisioner) Provision(ctx context.Context, task ProvisionTask, progress ProgressFunc) error {
+	p.mu.Lock()
+	p.order = append(p.order, task.DeploymentID)
+	p.mu.Unlock()
+	if task.DeploymentID == "blocker" {
+		close(p.started)
+		<-p.release
+	}
+	return nil
+}
+
+func TestWorker_EnqueueRunsHighestPriorityFirst(t *testing.T) {
+	provisioner := &orderingProvisioner{started: make(chan struct{}), release: make(chan struct{})}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", provisioner)
+	w := NewWorker(provisioners, &recordingNotifier{})
+	w.SetConcurrency(1)
+
+	var wg sync.WaitGroup
+	enqueue := func(id string, priority int) {
+		req := validProvisionRequest()
+		req.Priority = priority
+		wg.Add(1)
+		w.Enqueue(context.Background(), ProvisionTask{DeploymentID: id, Request: req}, func(error) { wg.Done() })
+	}
+
+	// Saturate the only slot, then queue work behind it
+	enqueue("blocker", PriorityNormal)
+	<-provisioner.started
+	enqueue("dev-1", PriorityLow)
+	enqueue("staging-1", PriorityNormal)
+	enqueue("prod-1", PriorityHigh)
+	enqueue("dev-2", PriorityLow)
+	enqueue("prod-2", PriorityHigh)
+	if got := w.QueueLength(); got != 5 {
+		t.Fatalf("expected 5 queued tasks behind the blocker, got %d", got)
+	}
+	if !w.InFlight("dev-2") {
+		t.Fatalf("expected queued deployments to be tracked as in flight")
+	}
+
+	close(provisioner.release)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued tasks did not finish")
+	}
+
+	want := []string{"blocker", "prod-1", "prod-2", "staging-1", "dev-1", "dev-2"}
+	if len(provisioner.order) != len(want) {
+		t.Fatalf("expected order %v, got %v", want, provisioner.order)
+	}
+	for i := range want {
+		if provisioner.order[i] != want[i] {
+			t.Fatalf("expected order %v, got %v", want, provisioner.order)
+		}
+	}
+}
+
+func TestWorker_EnqueueUnlimitedConcurrency(t *testing.T) {
+	provisioner := &orderingProvisioner{started: make(chan struct{}), release: make(chan struct{})}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", provisioner)
+	w := NewWorker(provisioners, &recordingNotifier{})
+
+	finished := make(chan string, 2)
+	enqueue := func(id string) {
+		w.Enqueue(context.Background(), ProvisionTask{DeploymentID: id, Request: validProvisionRequest()}, func(error) { finished <- id })
+	}
+	enqueue("blocker")
+	<-provisioner.started
+	enqueue("other")
+
+	// Without a concurrency cap nothing waits behind the blocker
+	select {
+	case id := <-finished:
+		if id != "other" {
+			t.Fatalf("expected other to finish first, got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second task to run alongside the blocker")
+	}
+	close(provisioner.release)
+	<-finished
+}
+
+func TestWorker_UpdateCallbackURL(t *testing.T) {
+	p := &pausingProvisioner{paused: make(chan struct{}), resume: make(chan struct{})}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", p)
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	req := validProvisionRequest()
+	req.CallbackURL = "http://manager.old:9090/v1/callback"
+	task := ProvisionTask{DeploymentID: "deploy-4", Request: req}
+
+	done := make(chan error, 1)
+	go func() { done <- w.Run(context.Background(), task) }()
+	<-p.paused
+
+	if err := w.UpdateCallbackURL("deploy-4", "http://manager.new:9090/v1/callback"); err != nil {
+		t.Fatalf("unexpected error updating in-flight deployment: %v", err)
+	}
+	close(p.resume)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(notifier.urls) != 2 {
+		t.Fatalf("expected a progress and a final callback, got %v", notifier.urls)
+	}
+	if notifier.urls[0] != "http://manager.old:9090/v1/callback" {
+		t.Fatalf("expected progress callback before the update to use the old URL, got %s", notifier.urls[0])
+	}
+	if notifier.urls[1] != "http://manager.new:9090/v1/callback" || notifier.payloads[1].Status != "success" {
+		t.Fatalf("expected final callback at the new URL, got %s %+v", notifier.urls[1], notifier.payloads[1])
+	}
+
+	if err := w.UpdateCallbackURL("deploy-4", "http://manager.new:9090/v1/callback"); !errors.Is(err, ErrDeploymentNotFound) {
+		t.Fatalf("expected ErrDeploymentNotFound once the deployment finished, got %v", err)
+	}
+}
+
+func TestWorker_Status(t *testing.T) {
+	p := &pausingProvisioner{paused: make(chan struct{}), resume: make(chan struct{})}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", p)
+	w := NewWorker(provisioners, nil)
+
+	if _, ok := w.Status("deploy-1"); ok {
+		t.Fatalf("expected no status for an unknown deployment")
+	}
+
+	task := ProvisionTask{DeploymentID: "deploy-1", Request: validProvisionRequest()}
+	w.Track(task)
+	if status, ok := w.Status("deploy-1"); !ok || status.Phase != "Pending" {
+		t.Fatalf("expected a tracked deployment to be Pending, got %+v", status)
+	}
+
+	done := make(chan error)
+	go func() { done <- w.Run(context.Background(), task) }()
+	<-p.paused
+	status, _ := w.Status("deploy-1")
+	if status.Phase != "Provisioning" || status.Message != "applied" || status.LastUpdated.IsZero() {
+		t.Fatalf("expected the in-progress step to be recorded, got %+v", status)
+	}
+
+	close(p.resume)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status, _ := w.Status("deploy-1"); status.Phase != "Ready" {
+		t.Fatalf("expected a completed deployment to be Ready, got %+v", status)
+	}
+}
+
+// connectedProvisioner reports connection details for what it provisions
+type connectedProvisioner struct{ fakeProvisioner }
+
+func (connectedProvisioner) Connection(task ProvisionTask) ConnectionInfo {
+	return ConnectionInfo{Endpoint: task.Request.ResourceName + ".svc", Port: 5432, ConnectionSecret: "creds"}
+}
+
+func TestWorker_ReportsConnection(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", &connectedProvisioner{})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	if err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-1", Request: validProvisionRequest()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	final := notifier.payloads[len(notifier.payloads)-1]
+	if final.Endpoint != "db1.svc" || final.Port != 5432 || final.ConnectionSecret != "creds" {
+		t.Fatalf("expected connection details on the success callback, got %+v", final)
+	}
+}
+
+func TestWorker_PassesFallbackCallbackURLs(t *testing.T) {
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", &fakeProvisioner{})
+	notifier := &recordingNotifier{}
+	w := NewWorker(provisioners, notifier)
+
+	req := validProvisionRequest()
+	req.CallbackURLs = []string{"http://manager-1:9090/v1/callback", "http://manager-2:9090/v1/callback"}
+	if err := w.Run(context.Background(), ProvisionTask{DeploymentID: "deploy-5", Request: req}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(notifier.fallback) != 1 || !reflect.DeepEqual(notifier.fallback[0], req.CallbackURLs) {
+		t.Fatalf("expected the callback to carry the fallback URLs, got %v", notifier.fallback)
+	}
+}
+
+func TestWorker_ResumesPendingTasksAfterRestart(t *testing.T) {
+	store, err := NewFileTaskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first broker is stopped with one task running and two queued
+	blocked := &orderingProvisioner{started: make(chan struct{}), release: make(chan struct{})}
+	provisioners := NewProvisionerRegistry()
+	provisioners.Register("database", blocked)
+	before := NewWorker(provisioners, &recordingNotifier{})
+	before.SetConcurrency(1)
+	before.SetTaskStore(store)
+
+	blockerDone := make(chan struct{})
+	before.Enqueue(context.Background(), ProvisionTask{DeploymentID: "blocker", Request: validProvisionRequest()}, func(error) { close(blockerDone) })
+	<-blocked.started
+	for _, id := range []string{"queued-1", "queued-2"} {
+		req := validProvisionRequest()
+		req.CallbackToken = "tok-" + id
+		before.Enqueue(context.Background(), ProvisionTask{DeploymentID: id, Request: req, EstimatedMonthlyCost: 12.5}, nil)
+	}
+	defer func() {
+		close(blocked.release)
+		<-blockerDone
+	}()
+
+	// A worker started on the same store finds and runs all three
+	provisioners = NewProvisionerRegistry()
+	provisioners.Register("database", &fakeProvisioner{})
+	notifier := &recordingNotifier{}
+	after := NewWorker(provisioners, notifier)
+	after.SetTaskStore(store)
+
+	pending, err := after.PendingTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range pending {
+		ids = append(ids, p.DeploymentID)
+	}
+	if !slices.Equal(ids, []string{"blocker", "queued-1", "queued-2"}) {
+		t.Fatalf("expected the running and queued tasks to be pending in order, got %v", ids)
+	}
+	if task := pending[1].Task(); task.Request.CallbackToken != "tok-queued-1" || task.EstimatedMonthlyCost != 12.5 {
+		t.Fatalf("expected the task to survive the restart intact, got %+v", task)
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range pending {
+		wg.Add(1)
+		after.Enqueue(context.Background(), p.Task(), func(err error) {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			wg.Done()
+		})
+	}
+	wg.Wait()
+
+	notifier.mu.Lock()
+	succeeded := map[string]bool{}
+	for _, payload := range notifier.payloads {
+		if payload.Status == "success" {
+			succeeded[payload.DeploymentID] = true
+		}
+	}
+	notifier.mu.Unlock()
+	if len(succeeded) != 3 {
+		t.Fatalf("expected every resumed task to complete, got %v", succeeded)
+	}
+	if pending, _ := after.PendingTasks(); len(pending) != 0 {
+		t.Fatalf("expected finished tasks to leave the store, got %+v", pending)
+	}
+}
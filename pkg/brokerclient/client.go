@@ -3,16 +3,27 @@ package brokerclient
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/aykay76/kidp/pkg/tracing"
+	"github.com/aykay76/kidp/pkg/version"
 )
 
 // Client is a client for the broker API
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+	signingKey ed25519.PrivateKey
+	apiKey     string
 }
 
 // NewClient creates a new broker client
@@ -25,15 +36,51 @@ func NewClient(baseURL string) *Client {
 	}
 }
 
+// NewClientWithTLS creates a broker client that connects with tlsConfig,
+// which carries the manager's client certificate when the broker requires
+// mutual TLS and the CAs trusted to sign the broker's certificate
+func NewClientWithTLS(baseURL string, tlsConfig *tls.Config) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &Client{
+		baseURL: baseURL,
+		httpClient: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
 // ProvisionRequest represents a provision request to the broker
 type ProvisionRequest struct {
-	ResourceType string                 `json:"resourceType"`
-	ResourceName string                 `json:"resourceName"`
-	Namespace    string                 `json:"namespace"`
-	Team         string                 `json:"team"`
-	Owner        string                 `json:"owner"`
-	CallbackURL  string                 `json:"callbackUrl"`
-	Spec         map[string]interface{} `json:"spec"`
+	ResourceType    string                 `json:"resourceType"`
+	ResourceName    string                 `json:"resourceName"`
+	Namespace       string                 `json:"namespace"`
+	TargetNamespace string                 `json:"targetNamespace,omitempty"`
+	Team            string                 `json:"team"`
+	Owner           string                 `json:"owner"`
+	CallbackURL     string                 `json:"callbackUrl"`
+	CallbackURLs    []string               `json:"callbackUrls,omitempty"`
+	CallbackToken   string                 `json:"callbackToken,omitempty"`
+	Source          *Source                `json:"source,omitempty"`
+	Priority        int                    `json:"priority,omitempty"`
+	Spec            map[string]interface{} `json:"spec"`
+}
+
+// Provisioning priorities; a saturated broker runs higher priorities first
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// Source is the GitOps provenance of a request
+type Source struct {
+	Repository    string `json:"repository,omitempty"`
+	Revision      string `json:"revision,omitempty"`
+	Path          string `json:"path,omitempty"`
+	Application   string `json:"application,omitempty"`
+	CorrelationID string `json:"correlationId,omitempty"`
 }
 
 // ProvisionResponse is the broker's response to a provision request
@@ -43,13 +90,20 @@ type ProvisionResponse struct {
 	Message      string `json:"message"`
 }
 
+// ReconfigureRequest applies a changed spec to an existing deployment
+type ReconfigureRequest struct {
+	DeploymentID string `json:"deploymentId"`
+	ProvisionRequest
+}
+
 // DeprovisionRequest represents a deprovision request to the broker
 type DeprovisionRequest struct {
-	DeploymentID string `json:"deploymentId"`
-	ResourceType string `json:"resourceType"`
-	ResourceName string `json:"resourceName"`
-	Namespace    string `json:"namespace"`
-	CallbackURL  string `json:"callbackUrl"`
+	DeploymentID    string `json:"deploymentId"`
+	ResourceType    string `json:"resourceType"`
+	ResourceName    string `json:"resourceName"`
+	Namespace       string `json:"namespace"`
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	CallbackURL     string `json:"callbackUrl"`
 }
 
 // DeprovisionResponse is the broker's response to a deprovision request
@@ -71,16 +125,17 @@ func (c *Client) Provision(ctx context.Context, req ProvisionRequest) (*Provisio
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("User-Agent", "KIDP-Manager/0.1.0")
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call broker: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("broker returned status %d", resp.StatusCode)
+		return nil, newBrokerError(resp)
 	}
 
 	var provResp ProvisionResponse
@@ -91,6 +146,41 @@ func (c *Client) Provision(ctx context.Context, req ProvisionRequest) (*Provisio
 	return &provResp, nil
 }
 
+// Reconfigure requests the broker to apply a changed spec to a resource it
+// provisioned. Completion is reported through callbacks.
+func (c *Client) Reconfigure(ctx context.Context, req ReconfigureRequest) (*ProvisionResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/reconfigure", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newBrokerError(resp)
+	}
+
+	var reconfResp ProvisionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&reconfResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &reconfResp, nil
+}
+
 // Deprovision requests the broker to deprovision a resource
 func (c *Client) Deprovision(ctx context.Context, req DeprovisionRequest) (*DeprovisionResponse, error) {
 	body, err := json.Marshal(req)
@@ -104,16 +194,17 @@ func (c *Client) Deprovision(ctx context.Context, req DeprovisionRequest) (*Depr
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("User-Agent", "KIDP-Manager/0.1.0")
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call broker: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("broker returned status %d", resp.StatusCode)
+		return nil, newBrokerError(resp)
 	}
 
 	var deprovResp DeprovisionResponse
@@ -124,6 +215,322 @@ func (c *Client) Deprovision(ctx context.Context, req DeprovisionRequest) (*Depr
 	return &deprovResp, nil
 }
 
+// UpdateCallbackURL points the remaining callbacks of an in-flight deployment
+// at a new URL. A *BrokerError with StatusCode 404 means the deployment is no
+// longer in flight on the broker.
+func (c *Client) UpdateCallbackURL(ctx context.Context, deploymentID, callbackURL string) error {
+	body, err := json.Marshal(map[string]string{"deploymentId": deploymentID, "callbackUrl": callbackURL})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPatch, c.baseURL+"/v1/callback-url", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newBrokerError(resp)
+	}
+	return nil
+}
+
+// ProviderRegions lists the regions one provider of a resource type is available in
+type ProviderRegions struct {
+	ResourceType string   `json:"resourceType"`
+	Provider     string   `json:"provider"`
+	Regions      []string `json:"regions"`
+	AnyRegion    bool     `json:"anyRegion,omitempty"`
+}
+
+// RegionsResponse is the broker's list of supported regions
+type RegionsResponse struct {
+	Regions []ProviderRegions `json:"regions"`
+}
+
+// Supports reports whether the broker advertises the region for the resource
+// type and provider
+func (r *RegionsResponse) Supports(resourceType, provider, region string) bool {
+	for _, pr := range r.Regions {
+		if !strings.EqualFold(pr.ResourceType, resourceType) || !strings.EqualFold(pr.Provider, provider) {
+			continue
+		}
+		if pr.AnyRegion {
+			return true
+		}
+		for _, r := range pr.Regions {
+			if strings.EqualFold(r, region) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Regions lists the regions the broker supports per resource type and provider
+func (c *Client) Regions(ctx context.Context) (*RegionsResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/v1/regions", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newBrokerError(resp)
+	}
+
+	var regionsResp RegionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&regionsResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &regionsResp, nil
+}
+
+// InventoryItem is one deployment the broker manages
+type InventoryItem struct {
+	DeploymentID    string `json:"deploymentId"`
+	ResourceType    string `json:"resourceType"`
+	ResourceName    string `json:"resourceName"`
+	Namespace       string `json:"namespace"`
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+	Phase           string `json:"phase"`
+}
+
+// InventoryResponse is the broker's list of the deployments it manages
+type InventoryResponse struct {
+	Deployments []InventoryItem `json:"deployments"`
+	Total       int             `json:"total"`
+}
+
+// Inventory lists every deployment the broker manages
+func (c *Client) Inventory(ctx context.Context) (*InventoryResponse, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/v1/inventory", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newBrokerError(resp)
+	}
+
+	var inventory InventoryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&inventory); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &inventory, nil
+}
+
+// EstimateRequest asks the broker to price a resource without provisioning it
+type EstimateRequest struct {
+	ResourceType string                 `json:"resourceType"`
+	Spec         map[string]interface{} `json:"spec"`
+}
+
+// CostEstimate is the broker's estimated monthly cost of a resource
+type CostEstimate struct {
+	MonthlyCost float64 `json:"monthlyCost"`
+	Currency    string  `json:"currency"`
+}
+
+// Estimate asks the broker what a resource would cost per month
+func (c *Client) Estimate(ctx context.Context, req EstimateRequest) (*CostEstimate, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/estimate", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newBrokerError(resp)
+	}
+
+	var estimate CostEstimate
+	if err := json.NewDecoder(resp.Body).Decode(&estimate); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &estimate, nil
+}
+
+// SnapshotRequest asks the broker to take a named snapshot of a deployment
+type SnapshotRequest struct {
+	DeploymentID string `json:"deploymentId"`
+	ResourceType string `json:"resourceType"`
+	ResourceName string `json:"resourceName,omitempty"`
+	Namespace    string `json:"namespace,omitempty"`
+	Engine       string `json:"engine,omitempty"`
+	Name         string `json:"name"`
+}
+
+// Snapshot statuses reported by the broker
+const (
+	SnapshotStatusPending   = "pending"
+	SnapshotStatusCompleted = "completed"
+	SnapshotStatusFailed    = "failed"
+)
+
+// SnapshotResponse reports a snapshot's progress
+type SnapshotResponse struct {
+	SnapshotID  string     `json:"snapshotId"`
+	Name        string     `json:"name,omitempty"`
+	Status      string     `json:"status"`
+	Message     string     `json:"message,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Snapshot asks the broker to take a named snapshot. The snapshot may still
+// be pending when this returns; poll GetSnapshot for its outcome.
+func (c *Client) Snapshot(ctx context.Context, req SnapshotRequest) (*SnapshotResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/snapshots", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return c.doSnapshot(ctx, httpReq)
+}
+
+// GetSnapshot reports the progress of a snapshot the broker took of the
+// deployment req identifies
+func (c *Client) GetSnapshot(ctx context.Context, req SnapshotRequest, snapshotID string) (*SnapshotResponse, error) {
+	query := url.Values{}
+	query.Set("deploymentId", req.DeploymentID)
+	query.Set("resourceType", req.ResourceType)
+	if req.Engine != "" {
+		query.Set("engine", req.Engine)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/v1/snapshots/"+url.PathEscape(snapshotID)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	return c.doSnapshot(ctx, httpReq)
+}
+
+// doSnapshot sends a snapshot request and decodes the broker's response
+func (c *Client) doSnapshot(ctx context.Context, httpReq *http.Request) (*SnapshotResponse, error) {
+	version.SetHeaders(httpReq, version.ComponentManager)
+	tracing.Inject(ctx, httpReq.Header)
+
+	resp, err := c.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call broker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newBrokerError(resp)
+	}
+
+	var snapshotResp SnapshotResponse
+	if err := json.NewDecoder(resp.Body).Decode(&snapshotResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &snapshotResp, nil
+}
+
+// ErrorResponse is the error body the broker sends with non-2xx responses
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+// maxErrorBodyBytes bounds how much of an error response body is kept
+const maxErrorBodyBytes = 64 << 10
+
+// BrokerError is returned when the broker responds with a non-2xx status.
+// ErrorResponse is decoded from the body when the broker sent one, carrying
+// its machine-readable error (e.g. "broker_at_capacity") and message.
+type BrokerError struct {
+	StatusCode    int
+	Body          string
+	ErrorResponse ErrorResponse
+	RetryAfter    time.Duration
+}
+
+func (e *BrokerError) Error() string {
+	if message := e.Message(); message != "" {
+		return fmt.Sprintf("broker returned status %d: %s", e.StatusCode, message)
+	}
+	return fmt.Sprintf("broker returned status %d", e.StatusCode)
+}
+
+// Message is the broker's human-readable explanation: the decoded message,
+// or the start of the body when the broker didn't send an ErrorResponse
+func (e *BrokerError) Message() string {
+	if e.ErrorResponse.Message != "" {
+		return e.ErrorResponse.Message
+	}
+	body := strings.TrimSpace(e.Body)
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return body
+}
+
+// newBrokerError builds a BrokerError from a non-2xx response
+func newBrokerError(resp *http.Response) *BrokerError {
+	brokerErr := &BrokerError{StatusCode: resp.StatusCode}
+
+	if body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes)); err == nil {
+		brokerErr.Body = string(body)
+		_ = json.Unmarshal(body, &brokerErr.ErrorResponse)
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		brokerErr.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return brokerErr
+}
+
 // Ping checks if the broker is reachable
 func (c *Client) Ping(ctx context.Context) error {
 	httpReq, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"/health", nil)
@@ -131,7 +538,7 @@ func (c *Client) Ping(ctx context.Context) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(httpReq)
+	resp, err := c.do(httpReq)
 	if err != nil {
 		return fmt.Errorf("failed to ping broker: %w", err)
 	}
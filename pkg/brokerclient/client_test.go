@@ -0,0 +1,251 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package brokerclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aykay76/kidp/pkg/version"
+)
+
+func TestClient_SendsVersionedUserAgent(t *testing.T) {
+	orig := version.Version
+	version.Version = "v1.2.3"
+	defer func() { version.Version = orig }()
+
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ProvisionResponse{DeploymentID: "deploy-1", Status: "accepted"})
+	}))
+	defer srv.Close()
+
+	if _, err := NewClient(srv.URL).Provision(context.Background(), ProvisionRequest{ResourceType: "database", ResourceName: "db1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if ua := got.Get("User-Agent"); ua != "KIDP-Manager/v1.2.3" {
+		t.Fatalf("expected versioned User-Agent, got %q", ua)
+	}
+	if v := got.Get(version.HeaderVersion); v != "v1.2.3" {
+		t.Fatalf("expected %s header to be v1.2.3, got %q", version.HeaderVersion, v)
+	}
+}
+
+func TestClient_Regions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/regions" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(RegionsResponse{Regions: []ProviderRegions{
+			{ResourceType: "database", Provider: "postgresql", Regions: []string{"eastus", "westeurope"}},
+			{ResourceType: "database", Provider: "redis", AnyRegion: true},
+		}})
+	}))
+	defer srv.Close()
+
+	regions, err := NewClient(srv.URL).Regions(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		provider, region string
+		want             bool
+	}{
+		{"postgresql", "eastus", true},
+		{"PostgreSQL", "WestEurope", true},
+		{"postgresql", "us-west-2", false},
+		{"redis", "anywhere", true},
+		{"mysql", "eastus", false},
+	}
+	for _, tt := range tests {
+		if got := regions.Supports("Database", tt.provider, tt.region); got != tt.want {
+			t.Errorf("Supports(%s, %s) = %v, want %v", tt.provider, tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestClient_UpdateCallbackURL(t *testing.T) {
+	var method string
+	var got map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		if got["deploymentId"] != "deploy-1" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"deployment_not_found","message":"not in flight","code":404}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"updated"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	if err := c.UpdateCallbackURL(context.Background(), "deploy-1", "http://manager.new:9090/v1/callback"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if method != http.MethodPatch || got["callbackUrl"] != "http://manager.new:9090/v1/callback" {
+		t.Fatalf("expected PATCH with the new callback URL, got %s %v", method, got)
+	}
+
+	err := c.UpdateCallbackURL(context.Background(), "deploy-2", "http://manager.new:9090/v1/callback")
+	var brokerErr *BrokerError
+	if !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusNotFound || brokerErr.ErrorResponse.Error != "deployment_not_found" {
+		t.Fatalf("expected deployment_not_found broker error, got %v", err)
+	}
+}
+
+func TestClient_ReturnsBrokerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/deprovision" {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("upstream unavailable\n"))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": "validation_failed", "message": "resourceName is required", "code": 400})
+	}))
+	defer srv.Close()
+	c := NewClient(srv.URL)
+
+	_, err := c.Provision(context.Background(), ProvisionRequest{ResourceType: "database"})
+	var brokerErr *BrokerError
+	if !errors.As(err, &brokerErr) {
+		t.Fatalf("expected a *BrokerError, got %T: %v", err, err)
+	}
+	if brokerErr.StatusCode != http.StatusBadRequest || brokerErr.ErrorResponse.Error != "validation_failed" ||
+		brokerErr.ErrorResponse.Message != "resourceName is required" || brokerErr.ErrorResponse.Code != http.StatusBadRequest {
+		t.Fatalf("expected the decoded error response, got %+v", brokerErr)
+	}
+	if !strings.Contains(brokerErr.Body, "validation_failed") || brokerErr.Message() != "resourceName is required" {
+		t.Fatalf("expected the raw body and message, got body %q message %q", brokerErr.Body, brokerErr.Message())
+	}
+	if err.Error() != "broker returned status 400: resourceName is required" {
+		t.Fatalf("unexpected error text %q", err.Error())
+	}
+
+	// A body that isn't an ErrorResponse is still surfaced
+	_, err = c.Deprovision(context.Background(), DeprovisionRequest{DeploymentID: "deploy-1"})
+	if !errors.As(err, &brokerErr) || brokerErr.StatusCode != http.StatusBadGateway || brokerErr.Message() != "upstream unavailable" {
+		t.Fatalf("expected the plain body as the message, got %v", err)
+	}
+}
+
+func TestClient_SignsRequests(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var verified, unsigned int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, signature := r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader)
+		if signature == "" {
+			unsigned++
+		} else if sig, err := base64.StdEncoding.DecodeString(signature); err == nil &&
+			ed25519.Verify(pub, SigningPayload(timestamp, r.Method, r.URL.RequestURI(), body), sig) {
+			verified++
+		}
+		_ = json.NewEncoder(w).Encode(ProvisionResponse{Status: "accepted", DeploymentID: "deploy-1"})
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	if _, err := c.Provision(context.Background(), ProvisionRequest{ResourceType: "database"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.SetSigningKey(priv)
+	if _, err := c.Provision(context.Background(), ProvisionRequest{ResourceType: "database"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.GetSnapshot(context.Background(), SnapshotRequest{DeploymentID: "deploy-1", ResourceType: "database"}, "snap-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if unsigned != 1 || verified != 2 {
+		t.Fatalf("expected 1 unsigned and 2 verified requests, got %d and %d", unsigned, verified)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	serverError := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer serverError.Close()
+	invalid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "validation_failed", "message": "size is required"})
+	}))
+	defer invalid.Close()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	provision := func(url string) error {
+		_, err := NewClient(url).Provision(context.Background(), ProvisionRequest{ResourceType: "database", ResourceName: "db1"})
+		return err
+	}
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"server error", provision(serverError.URL), true},
+		{"unreachable", provision(closed.URL), true},
+		{"throttled", &BrokerError{StatusCode: http.StatusTooManyRequests}, true},
+		{"validation", provision(invalid.URL), false},
+		{"not from the broker", errors.New("broker registry not configured"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			classified := Classify(tt.err)
+			var transient *TransientError
+			var permanent *PermanentError
+			if tt.transient && !errors.As(classified, &transient) {
+				t.Fatalf("expected a transient error, got %T: %v", classified, classified)
+			}
+			if !tt.transient && !errors.As(classified, &permanent) {
+				t.Fatalf("expected a permanent error, got %T: %v", classified, classified)
+			}
+			if IsTransient(tt.err) != tt.transient {
+				t.Fatalf("expected IsTransient to be %t", tt.transient)
+			}
+			if !errors.Is(classified, tt.err) {
+				t.Fatalf("expected the classified error to wrap the original")
+			}
+			if Classify(classified) != classified {
+				t.Fatalf("expected classifying twice to return the same error")
+			}
+		})
+	}
+
+	if Classify(nil) != nil {
+		t.Fatalf("expected nil to stay nil")
+	}
+}
@@ -0,0 +1,71 @@
+package brokerclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// TransientError is a failed broker call that retrying may fix: the broker
+// couldn't be reached, timed out, or answered with a server error or a
+// request to slow down
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string { return e.Err.Error() }
+
+func (e *TransientError) Unwrap() error { return e.Err }
+
+// PermanentError is a failed broker call that retrying the same request
+// won't fix, such as the broker rejecting it as invalid
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Classify wraps an error from a broker call in a *TransientError or a
+// *PermanentError. Network failures, timeouts and 408, 429 and 5xx responses
+// are transient; other broker responses and errors that didn't come from the
+// call are permanent. nil and already classified errors are returned as is.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var transient *TransientError
+	var permanent *PermanentError
+	if errors.As(err, &transient) || errors.As(err, &permanent) {
+		return err
+	}
+	if isTransient(err) {
+		return &TransientError{Err: err}
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsTransient reports whether err, classified as by Classify, is transient
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(Classify(err), &transient)
+}
+
+func isTransient(err error) bool {
+	var brokerErr *BrokerError
+	if errors.As(err, &brokerErr) {
+		switch brokerErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return brokerErr.StatusCode >= 500
+	}
+
+	// The request didn't get a response: refused, reset, DNS or timed out
+	var urlErr *url.Error
+	var netErr net.Error
+	return errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -17,17 +17,46 @@ limitations under the License.
 package brokerregistry
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	platformv1 "github.com/aykay76/kidp/api/v1"
 )
 
+// ErrBrokersAtCapacity is returned when brokers match the selection criteria
+// but all of them are at their concurrent deployment limit
+var ErrBrokersAtCapacity = errors.New("all matching brokers are at capacity")
+
+// ErrNoBrokerAvailable is returned when no Ready broker matches the selection
+// criteria and there is no fallback broker
+var ErrNoBrokerAvailable = errors.New("no broker found matching criteria")
+
+// SelectionStrategy decides which of the brokers matching the criteria is chosen
+type SelectionStrategy string
+
+const (
+	// HighestScore always picks the best-scoring broker
+	HighestScore SelectionStrategy = "HighestScore"
+	// WeightedRandom picks at random, in proportion to each broker's score
+	WeightedRandom SelectionStrategy = "WeightedRandom"
+	// RoundRobin takes turns between the matching brokers, ignoring score
+	RoundRobin SelectionStrategy = "RoundRobin"
+)
+
+// SelectionStrategies lists the supported selection strategies
+var SelectionStrategies = []SelectionStrategy{HighestScore, WeightedRandom, RoundRobin}
+
 // Registry manages broker discovery and selection
 type Registry struct {
 	client       client.Client
@@ -35,27 +64,186 @@ type Registry struct {
 	brokerCache  map[string]*platformv1.Broker
 	lastRefresh  time.Time
 	cacheTimeout time.Duration
+
+	// informers feed the broker watch started by StartWatch. While watching,
+	// the cache is re-listed every watchRefreshInterval instead of
+	// cacheTimeout.
+	informers            cache.Informers
+	watching             bool
+	watchRefreshInterval time.Duration
+
+	// fallbackBroker is the namespace/name of a broker of last resort used
+	// when no broker matches the selection criteria
+	fallbackBroker string
+
+	// SelectionStrategy chooses between matching brokers. Empty means
+	// HighestScore.
+	SelectionStrategy SelectionStrategy
+
+	// RegionAffinityBonus is added to the score of a broker whose region is
+	// the requested one, so it beats brokers that serve any region.
+	// CloudProviderAffinityBonus is added for the requested cloud provider.
+	// NewRegistry sets them to DefaultRegionAffinityBonus and
+	// DefaultCloudProviderAffinityBonus.
+	RegionAffinityBonus        float64
+	CloudProviderAffinityBonus float64
+
+	// Rand is the random source for WeightedRandom. Nil uses a source seeded
+	// from the clock; tests set a fixed seed.
+	Rand *rand.Rand
+
+	// pickMu guards Rand and turns, which selections update concurrently
+	pickMu sync.Mutex
+	// turns counts RoundRobin selections per criteria
+	turns map[string]uint64
+
+	// reservations are the provision requests this manager has dispatched,
+	// by deployment ID, which count against a broker's capacity until the
+	// broker reports them finished or they expire. A Broker's reported
+	// ActiveDeployments lags behind them.
+	resMu          sync.Mutex
+	reservations   map[string]reservation
+	reservationTTL time.Duration
+}
+
+// reservation is a dispatched provision request holding a slot on a broker
+type reservation struct {
+	broker  string
+	expires time.Time
+}
+
+// DefaultReservationTTL is how long a dispatched provision request counts
+// against its broker's capacity if no final callback releases it
+const DefaultReservationTTL = 10 * time.Minute
+
+// Default affinity bonuses, on the scale of a broker's 0-100 load score
+const (
+	DefaultRegionAffinityBonus        = 40
+	DefaultCloudProviderAffinityBonus = 15
+)
+
+// Option configures a Registry
+type Option func(*Registry)
+
+// WithFallbackBroker designates a broker (by namespace and name) to use when
+// no broker matches the selection criteria
+func WithFallbackBroker(namespace, name string) Option {
+	return func(r *Registry) {
+		r.fallbackBroker = fmt.Sprintf("%s/%s", namespace, name)
+	}
+}
+
+// WithReservationTTL sets how long a dispatched provision request counts
+// against its broker's capacity before it is released without a callback
+func WithReservationTTL(ttl time.Duration) Option {
+	return func(r *Registry) {
+		r.reservationTTL = ttl
+	}
+}
+
+// WithSelectionStrategy sets how the registry chooses between matching brokers
+func WithSelectionStrategy(strategy SelectionStrategy) Option {
+	return func(r *Registry) {
+		r.SelectionStrategy = strategy
+	}
 }
 
 // SelectionCriteria defines requirements for broker selection
 type SelectionCriteria struct {
-	ResourceType  string
+	ResourceType  string // Compared case-insensitively, e.g. "database"
 	CloudProvider string
 	Region        string
 	Provider      string // Specific provider (e.g., "postgresql", "azure-sql")
+
+	// AllowedRegions and AllowedCloudProviders, when set, must contain the
+	// broker's region and cloud provider. They carry a placement policy such
+	// as data residency, so unlike Region they also rule out brokers that
+	// don't declare one, and the fallback broker.
+	AllowedRegions        []string
+	AllowedCloudProviders []string
+}
+
+// String renders the non-empty criteria, e.g. "resourceType=database, provider=postgresql"
+func (c SelectionCriteria) String() string {
+	var parts []string
+	for _, kv := range [][2]string{
+		{"resourceType", c.ResourceType},
+		{"cloudProvider", c.CloudProvider},
+		{"region", c.Region},
+		{"provider", c.Provider},
+		{"allowedRegions", strings.Join(c.AllowedRegions, "|")},
+		{"allowedCloudProviders", strings.Join(c.AllowedCloudProviders, "|")},
+	} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Selection records which broker was chosen and why
+type Selection struct {
+	Broker     *platformv1.Broker
+	Criteria   SelectionCriteria
+	Score      float64
+	Candidates int
+
+	// Strategy is how the broker was chosen from the candidates
+	Strategy SelectionStrategy
+
+	// Fallback is true when no broker matched and the fallback broker was used
+	Fallback bool
+}
+
+// Basis describes how the broker was chosen, e.g. "best of 3 candidates"
+func (s *Selection) Basis() string {
+	switch s.Strategy {
+	case WeightedRandom:
+		return fmt.Sprintf("weighted random pick of %d candidates", s.Candidates)
+	case RoundRobin:
+		return fmt.Sprintf("round-robin turn of %d candidates", s.Candidates)
+	default:
+		return fmt.Sprintf("best of %d candidates", s.Candidates)
+	}
 }
 
 // NewRegistry creates a new broker registry
-func NewRegistry(client client.Client) *Registry {
-	return &Registry{
+func NewRegistry(client client.Client, opts ...Option) *Registry {
+	r := &Registry{
 		client:       client,
 		brokerCache:  make(map[string]*platformv1.Broker),
 		cacheTimeout: 30 * time.Second,
+		turns:        make(map[string]uint64),
+
+		watchRefreshInterval: DefaultWatchRefreshInterval,
+
+		reservations:   make(map[string]reservation),
+		reservationTTL: DefaultReservationTTL,
+
+		RegionAffinityBonus:        DefaultRegionAffinityBonus,
+		CloudProviderAffinityBonus: DefaultCloudProviderAffinityBonus,
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	return r
 }
 
 // SelectBroker chooses the best broker based on criteria
 func (r *Registry) SelectBroker(ctx context.Context, criteria SelectionCriteria) (*platformv1.Broker, error) {
+	selection, err := r.Select(ctx, criteria)
+	if err != nil {
+		return nil, err
+	}
+	return selection.Broker, nil
+}
+
+// Select chooses the best broker based on criteria and reports the
+// reasoning behind the choice
+func (r *Registry) Select(ctx context.Context, criteria SelectionCriteria) (*Selection, error) {
 	log := log.FromContext(ctx)
 
 	// Refresh cache if needed
@@ -66,25 +254,164 @@ func (r *Registry) SelectBroker(ctx context.Context, criteria SelectionCriteria)
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	candidates, saturated := r.candidates(criteria)
+
+	if len(candidates) == 0 && saturated > 0 {
+		return nil, fmt.Errorf("%w: %d broker(s) match %s", ErrBrokersAtCapacity, saturated, criteria)
+	}
+
+	if len(candidates) == 0 {
+		if fallback := r.fallback(criteria); fallback != nil {
+			log.Info("No broker matched criteria, using fallback broker",
+				"broker", fallback.Name, "namespace", fallback.Namespace, "criteria", criteria.String())
+			return &Selection{
+				Broker:   fallback,
+				Criteria: criteria,
+				Score:    r.calculateScore(fallback, criteria),
+				Fallback: true,
+			}, nil
+		}
+		return nil, noBrokerError(criteria)
+	}
+
+	var selected *platformv1.Broker
+	var score float64
+	switch r.SelectionStrategy {
+	case WeightedRandom:
+		selected, score = r.selectWeightedRandom(candidates, criteria)
+	case RoundRobin:
+		selected, score = r.selectRoundRobin(candidates, criteria)
+	default:
+		selected, score = r.selectBest(candidates, criteria)
+	}
+	log.Info("Selected broker", "broker", selected.Name, "endpoint", selected.Spec.Endpoint,
+		"score", score, "candidates", len(candidates), "strategy", r.strategy())
+
+	return &Selection{
+		Broker:     selected,
+		Criteria:   criteria,
+		Score:      score,
+		Candidates: len(candidates),
+		Strategy:   r.strategy(),
+	}, nil
+}
+
+// SelectBrokers returns every broker matching criteria that has capacity,
+// best score first, so callers can fail over to the next one when a broker
+// can't be reached. Equal scores are ordered by namespace and name. As with
+// Select, the fallback broker is returned alone when nothing matches.
+func (r *Registry) SelectBrokers(ctx context.Context, criteria SelectionCriteria) ([]*platformv1.Broker, error) {
+	if err := r.refreshCacheIfNeeded(ctx); err != nil {
+		return nil, fmt.Errorf("failed to refresh broker cache: %w", err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	candidates, saturated := r.candidates(criteria)
+
+	if len(candidates) == 0 && saturated > 0 {
+		return nil, fmt.Errorf("%w: %d broker(s) match %s", ErrBrokersAtCapacity, saturated, criteria)
+	}
+
+	if len(candidates) == 0 {
+		if fallback := r.fallback(criteria); fallback != nil {
+			return []*platformv1.Broker{fallback}, nil
+		}
+		return nil, noBrokerError(criteria)
+	}
+
+	scores := make(map[*platformv1.Broker]float64, len(candidates))
+	for _, broker := range candidates {
+		scores[broker] = r.calculateScore(broker, criteria)
+	}
+	slices.SortStableFunc(candidates, func(a, b *platformv1.Broker) int {
+		return cmp.Compare(scores[b], scores[a])
+	})
+	return candidates, nil
+}
+
+// ListBrokersMatching returns every cached broker matching criteria, in
+// namespace/name order, including those at capacity, so a CLI can show which
+// brokers could serve a resource before it is created. It reads the cache as
+// is, without refreshing it or consulting the fallback broker.
+func (r *Registry) ListBrokersMatching(criteria SelectionCriteria) []*platformv1.Broker {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var brokers []*platformv1.Broker
+	for _, broker := range r.brokerCache {
+		if r.matchesCriteria(broker, criteria) {
+			brokers = append(brokers, broker.DeepCopy())
+		}
+	}
+	slices.SortFunc(brokers, func(a, b *platformv1.Broker) int {
+		return strings.Compare(brokerKey(a), brokerKey(b))
+	})
+	return brokers
+}
+
+// candidates returns the brokers matching criteria that have capacity, in
+// namespace/name order so every strategy, and ties between equal scores, are
+// independent of map iteration order. It also counts the matching brokers
+// left out for being at capacity. Callers must hold r.mu.
+func (r *Registry) candidates(criteria SelectionCriteria) ([]*platformv1.Broker, int) {
 	var candidates []*platformv1.Broker
+	saturated := 0
+	reserved := r.reservedCounts()
 
 	// Filter brokers by criteria
 	for _, broker := range r.brokerCache {
-		if r.matchesCriteria(broker, criteria) {
-			candidates = append(candidates, broker)
+		if !r.matchesCriteria(broker, criteria) {
+			continue
 		}
+		if atCapacity(broker, reserved[brokerKey(broker)]) {
+			saturated++
+			continue
+		}
+		candidates = append(candidates, broker)
 	}
 
-	if len(candidates) == 0 {
-		return nil, fmt.Errorf("no broker found matching criteria: resourceType=%s, cloudProvider=%s, region=%s, provider=%s",
-			criteria.ResourceType, criteria.CloudProvider, criteria.Region, criteria.Provider)
+	slices.SortFunc(candidates, func(a, b *platformv1.Broker) int {
+		return strings.Compare(brokerKey(a), brokerKey(b))
+	})
+	return candidates, saturated
+}
+
+// noBrokerError reports that no broker matches criteria
+func noBrokerError(criteria SelectionCriteria) error {
+	err := fmt.Errorf("%w: resourceType=%s, cloudProvider=%s, region=%s, provider=%s", ErrNoBrokerAvailable,
+		criteria.ResourceType, criteria.CloudProvider, criteria.Region, criteria.Provider)
+	if len(criteria.AllowedRegions) > 0 || len(criteria.AllowedCloudProviders) > 0 {
+		err = fmt.Errorf("%w, allowedRegions=%s, allowedCloudProviders=%s", err,
+			strings.Join(criteria.AllowedRegions, "|"), strings.Join(criteria.AllowedCloudProviders, "|"))
 	}
+	return err
+}
 
-	// Select best broker
-	selected := r.selectBest(candidates)
-	log.Info("Selected broker", "broker", selected.Name, "endpoint", selected.Spec.Endpoint)
+// fallback returns the configured fallback broker if it exists, is Ready and
+// is allowed by the criteria's placement policy. Callers must hold r.mu.
+func (r *Registry) fallback(criteria SelectionCriteria) *platformv1.Broker {
+	if r.fallbackBroker == "" {
+		return nil
+	}
+	broker, ok := r.brokerCache[r.fallbackBroker]
+	if !ok || broker.Status.Phase != "Ready" || !allowedByPlacement(broker, criteria) {
+		return nil
+	}
+	return broker
+}
 
-	return selected, nil
+// allowedByPlacement reports whether the broker's region and cloud provider
+// are in the criteria's allowed lists, where those are set
+func allowedByPlacement(broker *platformv1.Broker, criteria SelectionCriteria) bool {
+	if len(criteria.AllowedRegions) > 0 && !slices.Contains(criteria.AllowedRegions, broker.Spec.Region) {
+		return false
+	}
+	if len(criteria.AllowedCloudProviders) > 0 && !slices.Contains(criteria.AllowedCloudProviders, broker.Spec.CloudProvider) {
+		return false
+	}
+	return true
 }
 
 // matchesCriteria checks if a broker matches the selection criteria
@@ -104,11 +431,16 @@ func (r *Registry) matchesCriteria(broker *platformv1.Broker, criteria Selection
 		return false
 	}
 
+	// Check placement policy
+	if !allowedByPlacement(broker, criteria) {
+		return false
+	}
+
 	// Check capabilities
 	if criteria.ResourceType != "" {
 		hasCapability := false
 		for _, cap := range broker.Spec.Capabilities {
-			if cap.ResourceType == criteria.ResourceType {
+			if sameResourceType(cap.ResourceType, criteria.ResourceType) && supportsRegion(cap, criteria.Region) {
 				// If specific provider requested, check if broker supports it
 				if criteria.Provider != "" {
 					for _, p := range cap.Providers {
@@ -130,41 +462,169 @@ func (r *Registry) matchesCriteria(broker *platformv1.Broker, criteria Selection
 		}
 	}
 
-	// Check if broker is at capacity
-	if broker.Spec.MaxConcurrentDeployments > 0 &&
-		broker.Status.ActiveDeployments >= broker.Spec.MaxConcurrentDeployments {
-		return false
+	return true
+}
+
+// supportsRegion reports whether a capability is available in the region. A
+// capability without regions is available wherever the broker is.
+func supportsRegion(cap platformv1.BrokerCapability, region string) bool {
+	if region == "" || len(cap.Regions) == 0 {
+		return true
 	}
+	for _, r := range cap.Regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
 
-	return true
+// atCapacity reports whether the broker has reached its concurrent deployment
+// limit, counting reserved requests it may not have reported yet
+func atCapacity(broker *platformv1.Broker, reserved int) bool {
+	return broker.Spec.MaxConcurrentDeployments > 0 &&
+		broker.Status.ActiveDeployments+int32(reserved) >= broker.Spec.MaxConcurrentDeployments
+}
+
+// brokerKey identifies a broker in the cache and in reservations
+func brokerKey(broker *platformv1.Broker) string {
+	return broker.Namespace + "/" + broker.Name
+}
+
+// Reserve counts a provision request dispatched to the broker against its
+// capacity until Release is called with the same deployment ID or the
+// reservation expires
+func (r *Registry) Reserve(broker *platformv1.Broker, deploymentID string) {
+	r.reserve(brokerKey(broker), deploymentID)
+}
+
+// Release frees the capacity reserved for a deployment, e.g. once the broker
+// reports it finished. Unknown deployment IDs are ignored.
+func (r *Registry) Release(deploymentID string) {
+	r.resMu.Lock()
+	defer r.resMu.Unlock()
+	delete(r.reservations, deploymentID)
+}
+
+func (r *Registry) reserve(key, deploymentID string) {
+	r.resMu.Lock()
+	defer r.resMu.Unlock()
+	if r.reservations == nil {
+		r.reservations = make(map[string]reservation)
+	}
+	ttl := r.reservationTTL
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	r.reservations[deploymentID] = reservation{broker: key, expires: time.Now().Add(ttl)}
 }
 
-// selectBest chooses the best broker from candidates
-func (r *Registry) selectBest(candidates []*platformv1.Broker) *platformv1.Broker {
+// reservedCounts returns the number of live reservations per broker,
+// dropping expired ones
+func (r *Registry) reservedCounts() map[string]int {
+	r.resMu.Lock()
+	defer r.resMu.Unlock()
+	now := time.Now()
+	counts := make(map[string]int)
+	for id, res := range r.reservations {
+		if now.After(res.expires) {
+			delete(r.reservations, id)
+			continue
+		}
+		counts[res.broker]++
+	}
+	return counts
+}
+
+// selectBest chooses the best broker from candidates and returns its score
+func (r *Registry) selectBest(candidates []*platformv1.Broker, criteria SelectionCriteria) (*platformv1.Broker, float64) {
 	if len(candidates) == 0 {
-		return nil
+		return nil, 0
 	}
 
 	best := candidates[0]
-	bestScore := r.calculateScore(best)
+	bestScore := r.calculateScore(best, criteria)
 
 	for _, broker := range candidates[1:] {
-		score := r.calculateScore(broker)
+		score := r.calculateScore(broker, criteria)
 		if score > bestScore {
 			best = broker
 			bestScore = score
 		}
 	}
 
-	return best
+	return best, bestScore
+}
+
+// selectWeightedRandom picks a broker at random with probability
+// proportional to its score. Brokers scoring zero or less are only picked
+// when every candidate does, and then uniformly.
+func (r *Registry) selectWeightedRandom(candidates []*platformv1.Broker, criteria SelectionCriteria) (*platformv1.Broker, float64) {
+	scores := make([]float64, len(candidates))
+	total := 0.0
+	for i, broker := range candidates {
+		scores[i] = r.calculateScore(broker, criteria)
+		if scores[i] > 0 {
+			total += scores[i]
+		}
+	}
+
+	r.pickMu.Lock()
+	if r.Rand == nil {
+		r.Rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	if total == 0 {
+		i := r.Rand.Intn(len(candidates))
+		r.pickMu.Unlock()
+		return candidates[i], scores[i]
+	}
+	pick := r.Rand.Float64() * total
+	r.pickMu.Unlock()
+
+	last := 0
+	for i, score := range scores {
+		if score <= 0 {
+			continue
+		}
+		if pick < score {
+			return candidates[i], score
+		}
+		pick -= score
+		last = i
+	}
+	// Rounding can leave pick just past the last weight
+	return candidates[last], scores[last]
+}
+
+// selectRoundRobin takes the next broker in turn for these criteria
+func (r *Registry) selectRoundRobin(candidates []*platformv1.Broker, criteria SelectionCriteria) (*platformv1.Broker, float64) {
+	key := criteria.String()
+	r.pickMu.Lock()
+	if r.turns == nil {
+		r.turns = make(map[string]uint64)
+	}
+	turn := r.turns[key]
+	r.turns[key]++
+	r.pickMu.Unlock()
+
+	selected := candidates[turn%uint64(len(candidates))]
+	return selected, r.calculateScore(selected, criteria)
+}
+
+// strategy returns the selection strategy in effect
+func (r *Registry) strategy() SelectionStrategy {
+	if r.SelectionStrategy == "" {
+		return HighestScore
+	}
+	return r.SelectionStrategy
 }
 
 // calculateScore assigns a score to a broker for selection
-func (r *Registry) calculateScore(broker *platformv1.Broker) float64 {
+func (r *Registry) calculateScore(broker *platformv1.Broker, criteria SelectionCriteria) float64 {
 	score := float64(0)
 
 	// Higher priority gets higher score
-	score += float64(broker.Spec.Priority)
+	score += float64(effectivePriority(broker, criteria))
 
 	// Lower load gets higher score
 	if broker.Spec.MaxConcurrentDeployments > 0 {
@@ -172,6 +632,15 @@ func (r *Registry) calculateScore(broker *platformv1.Broker) float64 {
 		score += (1.0 - loadPercentage) * 100 // Scale to 0-100
 	}
 
+	// Brokers in the requested region or cloud are closer, for latency and
+	// data residency
+	if criteria.Region != "" && broker.Spec.Region == criteria.Region {
+		score += r.RegionAffinityBonus
+	}
+	if criteria.CloudProvider != "" && broker.Spec.CloudProvider == criteria.CloudProvider {
+		score += r.CloudProviderAffinityBonus
+	}
+
 	// Recent heartbeat gets higher score
 	if broker.Status.LastHeartbeat != nil {
 		age := time.Since(broker.Status.LastHeartbeat.Time)
@@ -185,10 +654,48 @@ func (r *Registry) calculateScore(broker *platformv1.Broker) float64 {
 	return score
 }
 
-// refreshCacheIfNeeded refreshes the broker cache if it's expired
+// sameResourceType compares resource types in their canonical form, so a
+// Broker advertising "Database" serves criteria asking for "database"
+func sameResourceType(a, b string) bool {
+	return platformv1.NormalizeResourceType(a) == platformv1.NormalizeResourceType(b)
+}
+
+// effectivePriority returns the most specific priority the broker declares
+// for the requested resource type and provider, falling back to Spec.Priority
+func effectivePriority(broker *platformv1.Broker, criteria SelectionCriteria) int32 {
+	priority := broker.Spec.Priority
+	if criteria.ResourceType == "" {
+		return priority
+	}
+
+	for _, cap := range broker.Spec.Capabilities {
+		if !sameResourceType(cap.ResourceType, criteria.ResourceType) {
+			continue
+		}
+		// Use the capability entry that actually serves the requested provider
+		if criteria.Provider != "" && !slices.Contains(cap.Providers, criteria.Provider) {
+			continue
+		}
+		if cap.Priority != nil {
+			priority = *cap.Priority
+		}
+		if p, ok := cap.ProviderPriorities[criteria.Provider]; ok {
+			priority = p
+		}
+		break
+	}
+	return priority
+}
+
+// refreshCacheIfNeeded refreshes the broker cache if it's expired. A watched
+// cache expires less often, since events keep it current.
 func (r *Registry) refreshCacheIfNeeded(ctx context.Context) error {
 	r.mu.RLock()
-	needsRefresh := time.Since(r.lastRefresh) > r.cacheTimeout
+	timeout := r.cacheTimeout
+	if r.watching {
+		timeout = r.watchRefreshInterval
+	}
+	needsRefresh := time.Since(r.lastRefresh) > timeout
 	r.mu.RUnlock()
 
 	if !needsRefresh {
@@ -215,8 +722,7 @@ func (r *Registry) RefreshCache(ctx context.Context) error {
 	r.brokerCache = make(map[string]*platformv1.Broker)
 	for i := range brokerList.Items {
 		broker := &brokerList.Items[i]
-		key := fmt.Sprintf("%s/%s", broker.Namespace, broker.Name)
-		r.brokerCache[key] = broker
+		r.brokerCache[brokerKey(broker)] = broker
 	}
 
 	r.lastRefresh = time.Now()
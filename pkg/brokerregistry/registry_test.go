@@ -0,0 +1,512 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package brokerregistry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func int32Ptr(v int32) *int32 { return &v }
+
+func readyBroker(name string, priority int32, caps ...platformv1.BrokerCapability) *platformv1.Broker {
+	return &platformv1.Broker{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kidp-system", Name: name},
+		Spec: platformv1.BrokerSpec{
+			Endpoint:      "http://" + name,
+			CloudProvider: "on-prem",
+			Priority:      priority,
+			Capabilities:  caps,
+		},
+		Status: platformv1.BrokerStatus{Phase: "Ready"},
+	}
+}
+
+func TestCalculateScore_PerProviderPriority(t *testing.T) {
+	r := &Registry{}
+	b := readyBroker("pg-specialist", 100, platformv1.BrokerCapability{
+		ResourceType:       "Database",
+		Providers:          []string{"postgresql", "mysql"},
+		ProviderPriorities: map[string]int32{"postgresql": 300, "mysql": 20},
+	})
+
+	pg := r.calculateScore(b, SelectionCriteria{ResourceType: "Database", Provider: "postgresql"})
+	mysql := r.calculateScore(b, SelectionCriteria{ResourceType: "Database", Provider: "mysql"})
+	if pg != 300 || mysql != 20 {
+		t.Fatalf("expected provider priorities to drive the score, got postgresql=%v mysql=%v", pg, mysql)
+	}
+}
+
+func TestCalculateScore_CapabilityPriorityFallbacks(t *testing.T) {
+	r := &Registry{}
+	b := readyBroker("mixed", 100,
+		platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}, Priority: int32Ptr(150)},
+		platformv1.BrokerCapability{ResourceType: "Cache", Providers: []string{"redis"}},
+	)
+
+	tests := []struct {
+		criteria SelectionCriteria
+		want     float64
+	}{
+		{SelectionCriteria{ResourceType: "Database", Provider: "postgresql"}, 150},
+		{SelectionCriteria{ResourceType: "Database"}, 150},
+		{SelectionCriteria{ResourceType: "Cache", Provider: "redis"}, 100},
+		{SelectionCriteria{}, 100},
+	}
+	for _, tt := range tests {
+		if got := r.calculateScore(b, tt.criteria); got != tt.want {
+			t.Errorf("score for %s: expected %v, got %v", tt.criteria, tt.want, got)
+		}
+	}
+}
+
+func TestSelect_PrefersProviderSpecialist(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	dbProviders := []string{"postgresql", "mysql"}
+	pgSpecialist := readyBroker("pg-specialist", 100, platformv1.BrokerCapability{
+		ResourceType: "Database", Providers: dbProviders,
+		ProviderPriorities: map[string]int32{"postgresql": 200, "mysql": 50},
+	})
+	mysqlSpecialist := readyBroker("mysql-specialist", 100, platformv1.BrokerCapability{
+		ResourceType: "Database", Providers: dbProviders,
+		ProviderPriorities: map[string]int32{"postgresql": 50, "mysql": 200},
+	})
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pgSpecialist, mysqlSpecialist).Build()
+	r := NewRegistry(cl)
+
+	for provider, want := range map[string]string{"postgresql": "pg-specialist", "mysql": "mysql-specialist"} {
+		sel, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: provider})
+		if err != nil {
+			t.Fatalf("select for %s: unexpected error: %v", provider, err)
+		}
+		if sel.Broker.Name != want {
+			t.Errorf("expected %s to be selected for %s, got %s", want, provider, sel.Broker.Name)
+		}
+	}
+}
+
+func TestSelect_ResourceTypeCasing(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	// Brokers advertise the type however their authors wrote it
+	capitalized := readyBroker("capitalized", 100, platformv1.BrokerCapability{
+		ResourceType: "Database", Providers: []string{"postgresql"}, Priority: int32Ptr(200),
+	})
+	lower := readyBroker("lower", 100, platformv1.BrokerCapability{
+		ResourceType: "cache", Providers: []string{"redis"},
+	})
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(capitalized, lower).Build()
+	r := NewRegistry(cl)
+
+	for _, tt := range []struct {
+		resourceType, provider, want string
+	}{
+		{"database", "postgresql", "capitalized"},
+		{"Database", "postgresql", "capitalized"},
+		{" DATABASE ", "postgresql", "capitalized"},
+		{"Cache", "redis", "lower"},
+		{"cache", "redis", "lower"},
+	} {
+		criteria := SelectionCriteria{ResourceType: tt.resourceType, Provider: tt.provider}
+		sel, err := r.Select(context.Background(), criteria)
+		if err != nil {
+			t.Fatalf("select for %q: unexpected error: %v", tt.resourceType, err)
+		}
+		if sel.Broker.Name != tt.want {
+			t.Errorf("expected %s to be selected for %q, got %s", tt.want, tt.resourceType, sel.Broker.Name)
+		}
+		// The capability's own priority applies whatever the casing
+		if tt.want == "capitalized" && sel.Score != 200 {
+			t.Errorf("expected capability priority 200 for %q, got %v", tt.resourceType, sel.Score)
+		}
+	}
+}
+
+func TestSelect_FallbackBroker(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	pg := readyBroker("pg-broker", 100, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}})
+	fallback := readyBroker("default-broker", 10, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}})
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(pg, fallback).Build()
+	r := NewRegistry(cl, WithFallbackBroker("kidp-system", "default-broker"))
+
+	// A matching broker is preferred; the fallback does not engage
+	sel, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "postgresql"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sel.Fallback || sel.Broker.Name != "pg-broker" {
+		t.Fatalf("expected pg-broker without fallback, got %s (fallback=%v)", sel.Broker.Name, sel.Fallback)
+	}
+
+	// Nothing serves mongodb, so the fallback engages
+	sel, err = r.Select(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "mongodb"})
+	if err != nil {
+		t.Fatalf("expected fallback broker to be used, got error: %v", err)
+	}
+	if !sel.Fallback || sel.Broker.Name != "default-broker" {
+		t.Fatalf("expected fallback to default-broker, got %s (fallback=%v)", sel.Broker.Name, sel.Fallback)
+	}
+}
+
+func TestSelect_FallbackBrokerUnavailable(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	fallback := readyBroker("default-broker", 10)
+	fallback.Status.Phase = "Unhealthy"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(fallback).Build()
+
+	for name, r := range map[string]*Registry{
+		"unhealthy": NewRegistry(cl, WithFallbackBroker("kidp-system", "default-broker")),
+		"missing":   NewRegistry(cl, WithFallbackBroker("kidp-system", "no-such-broker")),
+		"unset":     NewRegistry(cl),
+	} {
+		if _, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "Database"}); err == nil {
+			t.Errorf("%s fallback: expected selection to fail", name)
+		}
+	}
+}
+
+func TestSelect_CapabilityRegions(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	eu := readyBroker("eu-broker", 100, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}, Regions: []string{"westeurope"}})
+	anywhere := readyBroker("any-broker", 10, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}})
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(eu, anywhere).Build()
+	r := NewRegistry(cl)
+
+	sel, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "postgresql", Region: "westeurope"})
+	if err != nil || sel.Broker.Name != "eu-broker" {
+		t.Fatalf("expected eu-broker for westeurope, got %v (err=%v)", sel, err)
+	}
+
+	sel, err = r.Select(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "postgresql", Region: "eastus"})
+	if err != nil || sel.Broker.Name != "any-broker" {
+		t.Fatalf("expected the broker without region restrictions for eastus, got %v (err=%v)", sel, err)
+	}
+}
+
+func TestSelect_PrefersMatchingRegion(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	// Equally loaded, and the broker serving any region sorts first on a tie
+	pgCap := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	anywhere := readyBroker("a-any-region", 100, pgCap)
+	eu := readyBroker("eu-broker", 100, pgCap)
+	eu.Spec.Region = "westeurope"
+	for _, b := range []*platformv1.Broker{anywhere, eu} {
+		b.Spec.MaxConcurrentDeployments = 10
+		b.Status.ActiveDeployments = 5
+	}
+	us := readyBroker("us-broker", 100, pgCap)
+	us.Spec.Region = "eastus"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(anywhere, eu, us).Build()
+	r := NewRegistry(cl)
+
+	criteria := SelectionCriteria{ResourceType: "Database", Provider: "postgresql", Region: "westeurope", CloudProvider: "on-prem"}
+	sel, err := r.Select(context.Background(), criteria)
+	if err != nil || sel.Broker.Name != "eu-broker" {
+		t.Fatalf("expected eu-broker in the requested region, got %v (err=%v)", sel, err)
+	}
+	want := 100 + 50 + float64(DefaultRegionAffinityBonus+DefaultCloudProviderAffinityBonus)
+	if sel.Score != want {
+		t.Fatalf("expected score %v with both affinity bonuses, got %v", want, sel.Score)
+	}
+
+	// Without the bonus the tie goes back to name order
+	r.RegionAffinityBonus = 0
+	if sel, err := r.Select(context.Background(), criteria); err != nil || sel.Broker.Name != "a-any-region" {
+		t.Fatalf("expected a-any-region without a region bonus, got %v (err=%v)", sel, err)
+	}
+}
+
+func TestSelect_PlacementPolicy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	pgCap := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	eu := readyBroker("eu-broker", 10, pgCap)
+	eu.Spec.Region = "westeurope"
+	us := readyBroker("us-broker", 100, pgCap)
+	us.Spec.Region = "eastus"
+	unplaced := readyBroker("unplaced-broker", 200, pgCap)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(eu, us, unplaced).Build()
+	r := NewRegistry(cl, WithFallbackBroker("kidp-system", "us-broker"))
+
+	criteria := SelectionCriteria{ResourceType: "Database", Provider: "postgresql", AllowedRegions: []string{"westeurope", "northeurope"}}
+	brokers, err := r.SelectBrokers(context.Background(), criteria)
+	if err != nil || len(brokers) != 1 || brokers[0].Name != "eu-broker" {
+		t.Fatalf("expected only eu-broker within the allowed regions, got %v (err=%v)", brokers, err)
+	}
+
+	// The policy also rules out the fallback broker
+	eu.Status.Phase = "Unhealthy"
+	if err := cl.Update(context.Background(), eu); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RefreshCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if sel, err := r.Select(context.Background(), criteria); !errors.Is(err, ErrNoBrokerAvailable) || !strings.Contains(err.Error(), "allowedRegions=westeurope|northeurope") {
+		t.Fatalf("expected no broker within the allowed regions, got %v (err=%v)", sel, err)
+	}
+
+	criteria = SelectionCriteria{ResourceType: "Database", Provider: "postgresql", AllowedCloudProviders: []string{"azure"}}
+	if _, err := r.Select(context.Background(), criteria); !errors.Is(err, ErrNoBrokerAvailable) {
+		t.Fatalf("expected no broker with an allowed cloud provider, got %v", err)
+	}
+}
+
+func TestSelect_Strategies(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	dbCap := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		readyBroker("broker-a", 300, dbCap),
+		readyBroker("broker-b", 100, dbCap),
+		readyBroker("broker-c", 100, dbCap),
+	).Build()
+	criteria := SelectionCriteria{ResourceType: "database", Provider: "postgresql"}
+
+	pick := func(r *Registry, n int) map[string]int {
+		t.Helper()
+		picks := map[string]int{}
+		for i := 0; i < n; i++ {
+			sel, err := r.Select(context.Background(), criteria)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			picks[sel.Broker.Name]++
+		}
+		return picks
+	}
+
+	t.Run("HighestScore is the default", func(t *testing.T) {
+		if picks := pick(NewRegistry(cl), 10); picks["broker-a"] != 10 {
+			t.Fatalf("expected broker-a every time, got %v", picks)
+		}
+	})
+
+	t.Run("WeightedRandom", func(t *testing.T) {
+		r := NewRegistry(cl, WithSelectionStrategy(WeightedRandom))
+		r.Rand = rand.New(rand.NewSource(1))
+		picks := pick(r, 1000)
+
+		// Scores of 300, 100 and 100 give broker-a 60% of the picks
+		if picks["broker-a"] < 550 || picks["broker-a"] > 650 || picks["broker-b"] < 150 || picks["broker-c"] < 150 {
+			t.Fatalf("expected picks in proportion to score, got %v", picks)
+		}
+
+		// The same seed makes the same choices
+		again := NewRegistry(cl, WithSelectionStrategy(WeightedRandom))
+		again.Rand = rand.New(rand.NewSource(1))
+		if replay := pick(again, 1000); replay["broker-a"] != picks["broker-a"] || replay["broker-b"] != picks["broker-b"] {
+			t.Fatalf("expected a seeded source to be deterministic, got %v then %v", picks, replay)
+		}
+	})
+
+	t.Run("RoundRobin", func(t *testing.T) {
+		r := NewRegistry(cl, WithSelectionStrategy(RoundRobin))
+		var order []string
+		for i := 0; i < 4; i++ {
+			sel, err := r.Select(context.Background(), criteria)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			order = append(order, sel.Broker.Name)
+			if sel.Basis() != "round-robin turn of 3 candidates" {
+				t.Fatalf("unexpected selection basis %q", sel.Basis())
+			}
+		}
+		if got := strings.Join(order, ","); got != "broker-a,broker-b,broker-c,broker-a" {
+			t.Fatalf("expected brokers to take turns, got %s", got)
+		}
+	})
+}
+
+func TestSelectBrokers_OrderedByScore(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	db := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	low := readyBroker("low", 10, db)
+	high := readyBroker("high", 300, db)
+	tiedA := readyBroker("tied-a", 100, db)
+	tiedB := readyBroker("tied-b", 100, db)
+	full := readyBroker("full", 500, db)
+	full.Spec.MaxConcurrentDeployments = 2
+	full.Status.ActiveDeployments = 2
+	cache := readyBroker("cache", 1000, platformv1.BrokerCapability{ResourceType: "Cache", Providers: []string{"redis"}})
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tiedB, low, full, high, cache, tiedA).Build()
+	r := NewRegistry(cl)
+
+	brokers, err := r.SelectBrokers(context.Background(), SelectionCriteria{ResourceType: "database", Provider: "postgresql"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var names []string
+	for _, b := range brokers {
+		names = append(names, b.Name)
+	}
+	if got, want := strings.Join(names, ","), "high,tied-a,tied-b,low"; got != want {
+		t.Fatalf("expected brokers %s, got %s", want, got)
+	}
+
+	// The first broker is the one HighestScore selection picks
+	sel, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "database", Provider: "postgresql"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sel.Broker.Name != brokers[0].Name {
+		t.Fatalf("expected Select to pick %s, got %s", brokers[0].Name, sel.Broker.Name)
+	}
+}
+
+func TestSelectBrokers_FallbackAndCapacity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	full := readyBroker("full", 100, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}})
+	full.Spec.MaxConcurrentDeployments = 1
+	full.Status.ActiveDeployments = 1
+	fallback := readyBroker("default-broker", 10)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(full, fallback).Build()
+	r := NewRegistry(cl, WithFallbackBroker("kidp-system", "default-broker"))
+
+	if _, err := r.SelectBrokers(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "postgresql"}); !errors.Is(err, ErrBrokersAtCapacity) {
+		t.Fatalf("expected ErrBrokersAtCapacity, got %v", err)
+	}
+
+	brokers, err := r.SelectBrokers(context.Background(), SelectionCriteria{ResourceType: "Database", Provider: "mongodb"})
+	if err != nil {
+		t.Fatalf("expected the fallback broker, got error: %v", err)
+	}
+	if len(brokers) != 1 || brokers[0].Name != "default-broker" {
+		t.Fatalf("expected only default-broker, got %v", brokers)
+	}
+}
+
+func TestListBrokersMatching(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	pgCap := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	full := readyBroker("full", 10, pgCap)
+	full.Spec.MaxConcurrentDeployments = 1
+	full.Status.ActiveDeployments = 1
+	eu := readyBroker("eu", 10, pgCap)
+	eu.Spec.Region = "westeurope"
+	us := readyBroker("us", 10, pgCap)
+	us.Spec.Region = "eastus"
+	mysql := readyBroker("mysql", 10, platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"mysql"}})
+	unhealthy := readyBroker("unhealthy", 10, pgCap)
+	unhealthy.Status.Phase = "Unhealthy"
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(full, eu, us, mysql, unhealthy).Build()
+	r := NewRegistry(cl)
+
+	// Nothing is listed until the cache is loaded
+	criteria := SelectionCriteria{ResourceType: "Database", Provider: "postgresql", Region: "westeurope"}
+	if brokers := r.ListBrokersMatching(criteria); len(brokers) != 0 {
+		t.Fatalf("expected an empty cache to match nothing, got %d broker(s)", len(brokers))
+	}
+	if err := r.RefreshCache(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, b := range r.ListBrokersMatching(criteria) {
+		names = append(names, b.Name)
+	}
+	if want := []string{"eu", "full"}; !slices.Equal(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+}
+
+func TestSelect_ReservationsCountAgainstCapacity(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	db := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	preferred := readyBroker("preferred", 200, db)
+	preferred.Spec.MaxConcurrentDeployments = 2
+	other := readyBroker("other", 100, db)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(preferred, other).Build()
+	r := NewRegistry(cl)
+	criteria := SelectionCriteria{ResourceType: "Database", Provider: "postgresql"}
+
+	// The broker still reports itself idle while the manager fills it
+	for _, id := range []string{"deploy-1", "deploy-2"} {
+		sel, err := r.Select(context.Background(), criteria)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if sel.Broker.Name != "preferred" {
+			t.Fatalf("expected preferred while it has capacity, got %s", sel.Broker.Name)
+		}
+		r.Reserve(sel.Broker, id)
+	}
+
+	sel, err := r.Select(context.Background(), criteria)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sel.Broker.Name != "other" {
+		t.Fatalf("expected the saturated broker to be skipped, got %s", sel.Broker.Name)
+	}
+
+	r.Release("deploy-1")
+	if sel, _ := r.Select(context.Background(), criteria); sel == nil || sel.Broker.Name != "preferred" {
+		t.Fatalf("expected preferred once a reservation is released, got %+v", sel)
+	}
+}
+
+func TestSelect_ReservationsExpire(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	only := readyBroker("only", 100, platformv1.BrokerCapability{ResourceType: "Database"})
+	only.Spec.MaxConcurrentDeployments = 1
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(only).Build()
+	r := NewRegistry(cl, WithReservationTTL(time.Millisecond))
+
+	r.Reserve(only, "deploy-1")
+	time.Sleep(5 * time.Millisecond)
+	if _, err := r.Select(context.Background(), SelectionCriteria{ResourceType: "Database"}); err != nil {
+		t.Fatalf("expected the expired reservation to be dropped, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package brokerregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+// DefaultWatchRefreshInterval is how often the broker cache is re-listed
+// while the watch keeps it up to date, to recover from missed events
+const DefaultWatchRefreshInterval = 5 * time.Minute
+
+// WithInformers sets the informers StartWatch uses to follow Broker changes,
+// usually the manager's cache
+func WithInformers(informers cache.Informers) Option {
+	return func(r *Registry) {
+		r.informers = informers
+	}
+}
+
+// StartWatch keeps the broker cache up to date from Broker add, update and
+// delete events, so a broker marked Offline stops being selected at once
+// rather than when the cache next expires. The timed refresh still runs,
+// every DefaultWatchRefreshInterval, as a fallback. The watch is removed when
+// ctx is done. It needs WithInformers and can be called before the informers
+// are started.
+func (r *Registry) StartWatch(ctx context.Context) error {
+	if r.informers == nil {
+		return errors.New("no informers configured for the broker watch")
+	}
+	informer, err := r.informers.GetInformer(ctx, &platformv1.Broker{})
+	if err != nil {
+		return fmt.Errorf("failed to get broker informer: %w", err)
+	}
+	registration, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    r.onBrokerChanged,
+		UpdateFunc: func(_, obj interface{}) { r.onBrokerChanged(obj) },
+		DeleteFunc: r.onBrokerDeleted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch brokers: %w", err)
+	}
+
+	r.mu.Lock()
+	r.watching = true
+	r.mu.Unlock()
+	log.FromContext(ctx).Info("Watching brokers", "refreshInterval", r.watchRefreshInterval)
+
+	go func() {
+		<-ctx.Done()
+		_ = informer.RemoveEventHandler(registration)
+		r.mu.Lock()
+		r.watching = false
+		r.mu.Unlock()
+	}()
+	return nil
+}
+
+// onBrokerChanged caches a copy of an added or updated broker. Informer
+// objects are shared and must not be handed out for modification.
+func (r *Registry) onBrokerChanged(obj interface{}) {
+	broker, ok := obj.(*platformv1.Broker)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.brokerCache[brokerKey(broker)] = broker.DeepCopy()
+}
+
+// onBrokerDeleted drops a deleted broker from the cache, including one whose
+// deletion the informer only learnt of on relisting
+func (r *Registry) onBrokerDeleted(obj interface{}) {
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	broker, ok := obj.(*platformv1.Broker)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.brokerCache, brokerKey(broker))
+}
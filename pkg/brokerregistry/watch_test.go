@@ -0,0 +1,89 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package brokerregistry
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	platformv1 "github.com/aykay76/kidp/api/v1"
+)
+
+func TestStartWatch_UpdatesCache(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = platformv1.AddToScheme(scheme)
+
+	pgCap := platformv1.BrokerCapability{ResourceType: "Database", Providers: []string{"postgresql"}}
+	preferred := readyBroker("preferred", 100, pgCap)
+	other := readyBroker("other", 10, pgCap)
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(preferred, other).Build()
+	informers := &informertest.FakeInformers{Scheme: scheme}
+	r := NewRegistry(cl, WithInformers(informers))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r.RefreshCache(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.StartWatch(ctx); err != nil {
+		t.Fatalf("failed to start watch: %v", err)
+	}
+	informer, err := informers.FakeInformerFor(ctx, &platformv1.Broker{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	criteria := SelectionCriteria{ResourceType: "Database", Provider: "postgresql"}
+	selected := func() string {
+		t.Helper()
+		broker, err := r.SelectBroker(ctx, criteria)
+		if err != nil {
+			t.Fatalf("selection failed: %v", err)
+		}
+		return broker.Name
+	}
+	if got := selected(); got != "preferred" {
+		t.Fatalf("expected preferred to be selected, got %s", got)
+	}
+
+	// The cache follows the event straight away, though a re-list would
+	// still find the broker Ready
+	offline := preferred.DeepCopy()
+	offline.Status.Phase = "Offline"
+	informer.Update(preferred, offline)
+	if got := selected(); got != "other" {
+		t.Fatalf("expected the Offline broker to be skipped at once, got %s", got)
+	}
+
+	better := readyBroker("better", 200, pgCap)
+	informer.Add(better)
+	if got := selected(); got != "better" {
+		t.Fatalf("expected the added broker to be selected, got %s", got)
+	}
+
+	informer.Delete(better)
+	// A deletion only noticed on relisting arrives as a tombstone
+	r.onBrokerDeleted(toolscache.DeletedFinalStateUnknown{Key: "kidp-system/other", Obj: other})
+	if brokers := r.ListBrokers(); len(brokers) != 1 || brokers[0].Name != "preferred" {
+		t.Fatalf("expected only the Offline broker to remain cached, got %d broker(s)", len(brokers))
+	}
+}
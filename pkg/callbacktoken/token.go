@@ -0,0 +1,90 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package callbacktoken issues and verifies per-deployment callback tokens.
+//
+// The manager issues a random token with each provision request and keeps
+// only its hash and expiry on the resource's status. The broker echoes the
+// token on every callback for that deployment, so a leaked token can only
+// forge callbacks for one deployment until it expires, unlike the broker-wide
+// signing key.
+package callbacktoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Header carries the token on callbacks
+const Header = "X-KIDP-Callback-Token"
+
+// DefaultTTL is how long a token stays valid after it is issued
+const DefaultTTL = 24 * time.Hour
+
+var (
+	// ErrMissing is returned when a token is required but not presented
+	ErrMissing = errors.New("callback token missing")
+
+	// ErrInvalid is returned when the presented token does not match the issued one
+	ErrInvalid = errors.New("callback token invalid")
+
+	// ErrExpired is returned when the presented token is past its expiry
+	ErrExpired = errors.New("callback token expired")
+)
+
+// Issued is a newly issued token. Token is sent to the broker; only Hash and
+// Expires are stored.
+type Issued struct {
+	Token   string
+	Hash    string
+	Expires time.Time
+}
+
+// Issue creates a random token valid for ttl from now
+func Issue(now time.Time, ttl time.Duration) (*Issued, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate callback token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return &Issued{Token: token, Hash: Hash(token), Expires: now.Add(ttl)}, nil
+}
+
+// Hash returns the hex SHA-256 of a token
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify checks a presented token against the stored hash and expiry
+func Verify(token, hash string, expires, now time.Time) error {
+	if token == "" {
+		return ErrMissing
+	}
+	if subtle.ConstantTimeCompare([]byte(Hash(token)), []byte(hash)) != 1 {
+		return ErrInvalid
+	}
+	if !expires.IsZero() && now.After(expires) {
+		return ErrExpired
+	}
+	return nil
+}
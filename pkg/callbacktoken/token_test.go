@@ -0,0 +1,77 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package callbacktoken
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	a, err := Issue(now, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := Issue(now, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a.Token == b.Token {
+		t.Fatalf("expected each deployment to get a distinct token")
+	}
+	if a.Hash != Hash(a.Token) || strings.Contains(a.Hash, a.Token) {
+		t.Fatalf("expected hash to be derived from, and not contain, the token")
+	}
+	if !a.Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("expected expiry one hour from issue, got %v", a.Expires)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)
+	issued, err := Issue(now, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other, _ := Issue(now, time.Hour)
+
+	tests := []struct {
+		name  string
+		token string
+		at    time.Time
+		want  error
+	}{
+		{"valid", issued.Token, now.Add(time.Minute), nil},
+		{"missing", "", now, ErrMissing},
+		{"forged", "not-the-token", now, ErrInvalid},
+		{"another deployment's token", other.Token, now, ErrInvalid},
+		{"expired", issued.Token, now.Add(2 * time.Hour), ErrExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.token, issued.Hash, issued.Expires, tt.at)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"dial postgres://app:hunter2@db:5432/app", "dial postgres://app:[REDACTED]@db:5432/app"},
+		{"host=db password=hunter2 sslmode=require", "host=db password=[REDACTED] sslmode=require"},
+		{`{"name":"db1","adminPassword":"hunter2","port":5432}`, `{"name":"db1","adminPassword":"[REDACTED]","port":5432}`},
+		{`{"api_key": 12345}`, `{"api_key": [REDACTED]}`},
+		{"deploymentId=deploy-1, status=failed", "deploymentId=deploy-1, status=failed"},
+		{"invalid callback token: callback token expired", "invalid callback token: callback token expired"},
+		{"https://broker.example.com/v1/provision", "https://broker.example.com/v1/provision"},
+	}
+	for _, tt := range tests {
+		if got := String(tt.in); got != tt.want {
+			t.Errorf("String(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	type spec struct {
+		Engine      string            `json:"engine"`
+		Credentials map[string]string `json:"credentials"`
+		Parameters  map[string]string `json:"parameters"`
+	}
+	got := Value(&spec{
+		Engine:      "postgresql",
+		Credentials: map[string]string{"username": "app"},
+		Parameters:  map[string]string{"work_mem": "64MB", "replication_token": "abc"},
+	})
+	want := map[string]any{
+		"engine":      "postgresql",
+		"credentials": Redacted,
+		"parameters":  map[string]any{"work_mem": "64MB", "replication_token": Redacted},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	if got := Value(42); got != 42 {
+		t.Fatalf("expected scalars to pass through, got %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewTextHandler(&buf, nil))).With("apiKey", "k-1")
+	logger.WithGroup("request").Info("token=t-1 received", "name", "db1", "secretRef", "s-1",
+		slog.Group("auth", "password", "p-1", "user", "app"))
+
+	out := buf.String()
+	for _, secret := range []string{"k-1", "t-1", "s-1", "p-1"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("expected %q to be redacted, got %s", secret, out)
+		}
+	}
+	for _, kept := range []string{"request.name=db1", "request.auth.user=app"} {
+		if !strings.Contains(out, kept) {
+			t.Fatalf("expected %q to be kept, got %s", kept, out)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewWriter(&buf), "", 0)
+	logger.Printf("Failed to connect: postgres://app:hunter2@db/app")
+	if got := buf.String(); got != "Failed to connect: postgres://app:[REDACTED]@db/app\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
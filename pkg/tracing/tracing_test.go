@@ -0,0 +1,143 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/aykay76/kidp/pkg/broker"
+	"github.com/aykay76/kidp/pkg/brokerclient"
+	"github.com/aykay76/kidp/pkg/tracing"
+)
+
+func TestSetup_NoopWithoutExporter(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	shutdown, err := tracing.Setup(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "noop")
+	defer span.End()
+	if span.IsRecording() {
+		t.Fatalf("expected a non-recording span when no exporter is configured")
+	}
+
+	header := http.Header{}
+	tracing.Inject(ctx, header)
+	if header.Get("traceparent") != "" {
+		t.Fatalf("expected no traceparent header, got %q", header.Get("traceparent"))
+	}
+}
+
+// TestTraceContextPropagatesEndToEnd follows a provision request from the
+// manager's client through the broker's worker and into the callbacks it sends
+func TestTraceContextPropagatesEndToEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(prev)
+
+	callbacks := make(chan trace.SpanContext, 16)
+	webhookSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartServerSpan(r, "webhook.callback")
+		defer span.End()
+		callbacks <- trace.SpanContextFromContext(ctx)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer webhookSrv.Close()
+
+	provisioners := broker.NewProvisionerRegistry()
+	provisioners.Register("database", broker.StubDatabaseProvisioner{})
+	worker := broker.NewWorker(provisioners, broker.NewCallbackClient(broker.DefaultCallbackConfig()))
+
+	workerDone := make(chan error, 1)
+	brokerSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.StartServerSpan(r, "broker.provision")
+		defer span.End()
+
+		var req broker.ProvisionRequest
+		if err := broker.DecodeJSON(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		task := broker.ProvisionTask{DeploymentID: "deploy-1", Request: req}
+		workerCtx := tracing.Detach(ctx)
+		go func() { workerDone <- worker.Run(workerCtx, task) }()
+
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(broker.ProvisionResponse{Status: "accepted", DeploymentID: "deploy-1"})
+	}))
+	defer brokerSrv.Close()
+
+	ctx, root := tracing.Tracer().Start(context.Background(), "DatabaseReconciler.provision")
+	_, err := brokerclient.NewClient(brokerSrv.URL).Provision(ctx, brokerclient.ProvisionRequest{
+		ResourceType: "database",
+		ResourceName: "db1",
+		Namespace:    "team-a",
+		CallbackURL:  webhookSrv.URL,
+	})
+	root.End()
+	if err != nil {
+		t.Fatalf("provision call failed: %v", err)
+	}
+
+	select {
+	case err := <-workerDone:
+		if err != nil {
+			t.Fatalf("worker failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for worker")
+	}
+
+	traceID := root.SpanContext().TraceID()
+	close(callbacks)
+	count := 0
+	for sc := range callbacks {
+		count++
+		if sc.TraceID() != traceID {
+			t.Fatalf("callback carried trace %s, expected %s", sc.TraceID(), traceID)
+		}
+	}
+	if count == 0 {
+		t.Fatalf("expected callbacks to reach the webhook")
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != traceID {
+			t.Fatalf("span %s is not part of the manager's trace", span.Name())
+		}
+		if span.Name() == "broker.provision" && span.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Fatalf("broker span should be a child of the reconciler span")
+		}
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2025 Keith McClellan
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package version holds the build version of the KIDP binaries and the
+// identifying headers sent on outbound HTTP requests.
+package version
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Version is injected at build time:
+//
+//	go build -ldflags "-X github.com/aykay76/kidp/pkg/version.Version=v0.2.0"
+var Version = "dev"
+
+// Components that make outbound requests
+const (
+	ComponentManager = "Manager"
+	ComponentBroker  = "Broker"
+)
+
+// HeaderVersion carries the sender's version on every outbound request
+const HeaderVersion = "X-KIDP-Version"
+
+// UserAgent returns the User-Agent for a component, e.g. "KIDP-Manager/v0.2.0"
+func UserAgent(component string) string {
+	return fmt.Sprintf("KIDP-%s/%s", component, Version)
+}
+
+// SetHeaders sets the User-Agent and version headers on an outbound request
+func SetHeaders(req *http.Request, component string) {
+	req.Header.Set("User-Agent", UserAgent(component))
+	req.Header.Set(HeaderVersion, Version)
+}